@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"log"
@@ -13,6 +14,9 @@ import (
 	"io/fs"
 
 	"github.com/smallnest/langchat/pkg/chat"
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/skills"
+	"github.com/smallnest/langchat/pkg/version"
 )
 
 //go:embed static
@@ -48,6 +52,22 @@ func main() {
 	// Load environment variables from .env file
 	loadEnv()
 
+	if len(os.Args) > 1 && (os.Args[1] == "--version" || os.Args[1] == "-version" || os.Args[1] == "version") {
+		fmt.Print(version.Get())
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate-sessions" {
+		os.Exit(runMigrateSessions(os.Args[2:]))
+	}
+
+	// Allow starting in production despite failed security checks
+	for _, arg := range os.Args[1:] {
+		if arg == "--insecure-ok" || arg == "-insecure-ok" {
+			os.Setenv("SECURITY_INSECURE_OK", "true")
+		}
+	}
+
 	// Load configuration from environment
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -83,21 +103,11 @@ func main() {
 	// This prevents the first user from experiencing slow tool loading
 	log.Println("🔄 Pre-warming tools initialization...")
 	warmupAgent := chat.NewSimpleChatAgent(server.GetLLM(), *server.GetConfig())
-	warmupAgent.InitializeToolsAsync()
 
-	// Store the warmup agent so it can be reused for the first session
+	// Store the warmup agent so it can be reused for the first session; this
+	// also gives it the server's MCP settings, so it must come before loading tools
 	server.SetWarmupAgent(warmupAgent)
-
-	// Wait for tools to finish loading before starting server
-	go func() {
-		for {
-			// Simple check - in real implementation you might want to add a method to check status
-			time.Sleep(500 * time.Millisecond)
-			// For now, we'll just wait a bit and then show ready message
-			log.Printf("🚀 Server is ready! Access at http://localhost:%s", port)
-			break
-		}
-	}()
+	warmupAgent.InitializeToolsAsync()
 
 	// Setup graceful shutdown
 	serverErr := make(chan error, 1)
@@ -114,6 +124,8 @@ func main() {
 		}
 	}()
 
+	go announceReady(server, warmupAgent, port, 30*time.Second)
+
 	// Wait for interrupt signal or server error
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -147,3 +159,49 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// readyServer is the part of the server the ready banner waits for
+type readyServer interface {
+	Listening() <-chan struct{}
+	WaitLLMProbe(ctx context.Context) error
+	GetConfig() *configpkg.Config
+}
+
+// readyTools is the part of the warmup agent the ready banner waits for
+type readyTools interface {
+	WaitReady(ctx context.Context) error
+	BrokenSkills() []skills.BrokenSkill
+}
+
+// announceReady prints the ready banner once the server accepts requests, the
+// tools have loaded and the LLM endpoint was reachable; tools that take
+// longer than timeout keep loading in the background
+func announceReady(server readyServer, tools readyTools, port string, timeout time.Duration) {
+	<-server.Listening()
+
+	scheme := "http"
+	if server.GetConfig().Server.TLSCertFile != "" {
+		scheme = "https"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	toolsErr := tools.WaitReady(ctx)
+	// The probe logs why the endpoint is unreachable
+	llmErr := server.WaitLLMProbe(ctx)
+	switch {
+	case llmErr != nil:
+		log.Printf("⚠️ Server started but is not ready until the LLM endpoint is reachable. Access at %s://localhost:%s", scheme, port)
+	case toolsErr != nil:
+		log.Printf("🚀 Server started with tools still loading. Access at %s://localhost:%s", scheme, port)
+	default:
+		log.Printf("🚀 Server is ready! Access at %s://localhost:%s", scheme, port)
+	}
+	if toolsErr != nil {
+		return
+	}
+
+	// Self-check: a broken skill is skipped, so make it stand out
+	for _, skill := range tools.BrokenSkills() {
+		log.Printf("⚠️ Skill %s could not be loaded: %s: %s", skill.Name, skill.Path, skill.Error)
+	}
+}
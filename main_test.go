@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+
+	"github.com/smallnest/langchat/pkg/auth"
+	"github.com/smallnest/langchat/pkg/chat"
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/skills"
+)
+
+// mockLLM is an OpenAI-compatible endpoint answering every completion with answer
+func mockLLM(t *testing.T, answer string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /models", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"object":"list","data":[]}`)
+	})
+	mux.HandleFunc("POST /chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-test",
+			"object":  "chat.completion",
+			"created": time.Now().Unix(),
+			"model":   "test-model",
+			"choices": []map[string]any{{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": answer},
+				"finish_reason": "stop",
+			}},
+			"usage": map[string]int{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+		})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// freePort returns a port nothing listens on
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// do sends a request to the server and returns the response
+func do(t *testing.T, client *http.Client, method, url, token string, body any) *http.Response {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	return resp
+}
+
+// send sends a request to the server and decodes a JSON response into out, if given
+func send(t *testing.T, client *http.Client, method, url, token string, body, out any) {
+	t.Helper()
+	resp := do(t, client, method, url, token, body)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s = %s", method, url, resp.Status)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s %s: %v", method, url, err)
+		}
+	}
+}
+
+// bannerLog passes the log on to stderr and reports the ready banner, after
+// calling check while it is printed
+type bannerLog struct {
+	check   func()
+	banners chan string
+}
+
+func (l *bannerLog) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("Access at")) {
+		l.check()
+		l.banners <- string(p)
+	}
+	return os.Stderr.Write(p)
+}
+
+// watchBanner returns the ready banners printed to the log during the test
+func watchBanner(t *testing.T, check func()) <-chan string {
+	t.Helper()
+	l := &bannerLog{check: check, banners: make(chan string, 1)}
+	log.SetOutput(l)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return l.banners
+}
+
+// fakeServer is a server that listens once listening is closed
+type fakeServer struct {
+	listening chan struct{}
+	llmErr    error
+}
+
+func (s *fakeServer) Listening() <-chan struct{}             { return s.listening }
+func (s *fakeServer) WaitLLMProbe(ctx context.Context) error { return s.llmErr }
+func (s *fakeServer) GetConfig() *configpkg.Config           { return &configpkg.Config{} }
+
+// fakeTools are tools that have loaded once ready is closed
+type fakeTools struct{ ready chan struct{} }
+
+func (f *fakeTools) WaitReady(ctx context.Context) error {
+	select {
+	case <-f.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *fakeTools) BrokenSkills() []skills.BrokenSkill { return nil }
+
+// closed reports whether ch is closed
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestReadyBanner(t *testing.T) {
+	tests := []struct {
+		name        string
+		toolsReady  bool
+		listenFirst bool // the listener is bound before the tools load
+		llmErr      error
+		want        string
+	}{
+		{"tools load first", true, false, nil, "🚀 Server is ready! Access at http://localhost:8080"},
+		{"listener bound first", true, true, nil, "🚀 Server is ready! Access at http://localhost:8080"},
+		{"tools still loading", false, true, nil, "🚀 Server started with tools still loading."},
+		{"LLM unreachable", true, false, errors.New("connection refused"), "⚠️ Server started but is not ready until the LLM endpoint is reachable."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{listening: make(chan struct{}), llmErr: tt.llmErr}
+			tools := &fakeTools{ready: make(chan struct{})}
+			banners := watchBanner(t, func() {
+				if !closed(server.listening) {
+					t.Error("banner printed before the server listens")
+				}
+				if tt.toolsReady && !closed(tools.ready) {
+					t.Error("banner printed before the tools loaded")
+				}
+			})
+			timeout := 10 * time.Second
+			if !tt.toolsReady {
+				timeout = 50 * time.Millisecond
+			}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				announceReady(server, tools, "8080", timeout)
+			}()
+			defer func() { <-done }()
+
+			noBanner := func(while string) {
+				select {
+				case banner := <-banners:
+					t.Fatalf("banner %q printed while %s", banner, while)
+				case <-time.After(20 * time.Millisecond):
+				}
+			}
+			if tt.listenFirst {
+				close(server.listening)
+				if tt.toolsReady {
+					noBanner("the tools load")
+					close(tools.ready)
+				}
+			} else {
+				close(tools.ready)
+				noBanner("the server does not listen")
+				close(server.listening)
+			}
+			select {
+			case banner := <-banners:
+				if !strings.Contains(banner, tt.want) {
+					t.Fatalf("banner = %q, want %q", banner, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no banner printed")
+			}
+		})
+	}
+}
+
+func TestServerCloseLeaksNoGoroutines(t *testing.T) {
+	// Runs last, after the mock LLM and the idle client connections are closed
+	defer goleak.VerifyNone(t)
+
+	llm := mockLLM(t, "hello from the mock LLM")
+	defer llm.Close()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("ENVIRONMENT", "development")
+	configPath := dir + "/config.yaml"
+	config := fmt.Sprintf("llm:\n  api_key: test-key\n  base_url: %s\nmonitoring:\n  enabled: true\n  metrics_port: %d\n  health_port: %d\n",
+		llm.URL, freePort(t), freePort(t))
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	port := freePort(t)
+	server, err := chat.NewChatServer(dir+"/sessions", 100, fmt.Sprint(port), configPath)
+	if err != nil {
+		t.Fatalf("NewChatServer: %v", err)
+	}
+	// Closed again below; this only cleans up after a failure
+	defer server.Close()
+	defer http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+
+	// The ready banner follows the listener and the tools of the warmup agent, as in main
+	warmupAgent := chat.NewSimpleChatAgent(server.GetLLM(), *server.GetConfig())
+	server.SetWarmupAgent(warmupAgent)
+	warmupAgent.InitializeToolsAsync()
+	banners := watchBanner(t, func() {
+		if !closed(server.Listening()) {
+			t.Error("banner printed before the server listens")
+		}
+		// Loaded tools are ready at once
+		loaded, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if err := warmupAgent.WaitReady(loaded); err != nil {
+			t.Error("banner printed before the tools loaded")
+		}
+	})
+	announced := make(chan struct{})
+	go func() {
+		defer close(announced)
+		announceReady(server, warmupAgent, fmt.Sprint(port), 10*time.Second)
+	}()
+
+	started := make(chan error, 1)
+	go func() { started <- server.Start(staticFS) }()
+	select {
+	case <-server.Listening():
+	case err := <-started:
+		t.Fatalf("Start: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.WaitLLMProbe(ctx); err != nil {
+		t.Fatalf("WaitLLMProbe: %v", err)
+	}
+	select {
+	case banner := <-banners:
+		if !strings.Contains(banner, "Server is ready!") {
+			t.Fatalf("banner = %q, want the server ready", banner)
+		}
+	case <-ctx.Done():
+		t.Fatal("no banner printed")
+	}
+	<-announced
+
+	transport := &http.Transport{}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	base := fmt.Sprintf("http://127.0.0.1:%d", port)
+	send(t, client, http.MethodGet, base+"/health", "", nil, nil)
+
+	var login auth.LoginResponse
+	send(t, client, http.MethodPost, base+"/api/auth/login", "", auth.LoginRequest{Username: "user", Password: "user123"}, &login)
+	var session struct {
+		SessionID string `json:"session_id"`
+	}
+	send(t, client, http.MethodPost, base+"/api/sessions/new", login.AccessToken, nil, &session)
+	for _, message := range []string{"hello", "how are you?"} {
+		var response struct {
+			Response string `json:"response"`
+		}
+		send(t, client, http.MethodPost, base+"/api/chat", login.AccessToken,
+			map[string]string{"session_id": session.SessionID, "message": message}, &response)
+		if response.Response == "" {
+			t.Fatalf("empty answer to %q", message)
+		}
+	}
+	send(t, client, http.MethodGet, base+"/api/sessions", login.AccessToken, nil, nil)
+
+	// Session IDs naming files outside the session directory are rejected
+	victim := dir + "/victim.json"
+	if err := os.WriteFile(victim, []byte(`{"id":"victim"}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	for _, id := range []string{"../victim", "../../x", `..\victim`} {
+		escaped := url.PathEscape(id)
+		requests := []struct {
+			method, path string
+			body         any
+		}{
+			{http.MethodGet, "/api/sessions/" + escaped + "/history", nil},
+			{http.MethodDelete, "/api/sessions/" + escaped, nil},
+			{http.MethodGet, "/api/sessions/" + escaped + "/export", nil},
+			{http.MethodPost, "/api/feedback", map[string]string{"session_id": id, "message_id": "m1", "feedback": "like"}},
+			{http.MethodGet, "/api/mcp/tools?session_id=" + url.QueryEscape(id), nil},
+			{http.MethodGet, "/api/tools/hierarchical?session_id=" + url.QueryEscape(id), nil},
+			{http.MethodPost, "/api/chat", map[string]string{"session_id": id, "message": "hello"}},
+		}
+		for _, req := range requests {
+			resp := do(t, client, req.method, base+req.path, login.AccessToken, req.body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("%s %s with session %q = %s, want 400", req.method, req.path, id, resp.Status)
+			}
+		}
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Fatalf("file next to the session directory: %v", err)
+	}
+
+	// Shutdown waits for connections that never sent a request; a client may
+	// have dialed one it did not use
+	transport.CloseIdleConnections()
+	if err := server.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := <-started; err != nil {
+		t.Fatalf("Start returned %v after Close", err)
+	}
+	if err := server.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
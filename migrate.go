@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// runMigrateSessions implements the `langchat migrate-sessions` subcommand.
+// It should be run while the server is stopped or in maintenance mode.
+func runMigrateSessions(args []string) int {
+	fs := flag.NewFlagSet("migrate-sessions", flag.ExitOnError)
+	from := fs.String("from", "file", "source session store type")
+	to := fs.String("to", "", "destination session store type")
+	fromDir := fs.String("from-dir", envOr("SESSION_DIR", "./sessions"), "source store location")
+	toDir := fs.String("to-dir", "", "destination store location")
+	deleteSource := fs.Bool("delete-source", false, "delete source sessions after a successful verify")
+	dryRun := fs.Bool("dry-run", false, "report what would be migrated without writing")
+	fs.Parse(args)
+
+	if *to == "" || *toDir == "" {
+		fmt.Fprintln(os.Stderr, "usage: langchat migrate-sessions --from file --to <type> --to-dir <location> [--from-dir dir] [--delete-source] [--dry-run]")
+		return 2
+	}
+
+	report, err := sessionpkg.MigrateTree(*from, *fromDir, *to, *toDir, sessionpkg.MigrateOptions{
+		DeleteSource: *deleteSource,
+		DryRun:       *dryRun,
+	})
+	if report != nil {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// envOr returns the environment variable or a fallback when unset
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,407 @@
+// Package activity tracks the engagement of users: when each user was last
+// seen or sent a message, and how many messages they sent per hour. Only
+// times and counts are kept, never content. Counters are kept in memory and
+// persisted periodically with Flush.
+package activity
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// hourCounts are the messages of one user on one day, per hour of the day
+type hourCounts [24]int64
+
+// user is the in-memory activity of one user. lastSeen is updated without
+// the tracker lock, so authenticated requests only store a timestamp.
+type user struct {
+	lastSeen    atomic.Int64 // Unix seconds, 0 if never seen
+	lastMessage time.Time    // guarded by Tracker.mu
+}
+
+// state is the persisted form of a tracker
+type state struct {
+	Users map[string]userState              `json:"users"`
+	Days  map[string]map[string]*hourCounts `json:"days"` // day -> user ID -> messages per hour
+}
+
+// userState is the persisted activity of one user
+type userState struct {
+	LastSeen    time.Time `json:"last_seen,omitzero"`
+	LastMessage time.Time `json:"last_message,omitzero"`
+}
+
+// DayActivity is the number of messages a user sent on one day
+type DayActivity struct {
+	Day      string    `json:"day"`   // YYYY-MM-DD in the tracker time zone
+	Hours    [24]int64 `json:"hours"` // messages per hour of the day
+	Messages int64     `json:"messages"`
+}
+
+// UserActivity is the activity of one user over the retention period
+type UserActivity struct {
+	UserID      string        `json:"user_id"`
+	LastSeen    *time.Time    `json:"last_seen"`    // last authenticated request
+	LastMessage *time.Time    `json:"last_message"` // last chat message
+	Messages    int64         `json:"messages"`
+	Days        []DayActivity `json:"days,omitempty"` // days with messages, oldest first
+}
+
+// Heatmap is the number of messages of all users per weekday and hour of the
+// day over a range of days
+type Heatmap struct {
+	Timezone    string       `json:"timezone"`
+	From        string       `json:"from"`     // first day, YYYY-MM-DD
+	To          string       `json:"to"`       // last day, today
+	Weekdays    [7][24]int64 `json:"weekdays"` // Monday first
+	Messages    int64        `json:"messages"`
+	ActiveUsers int          `json:"active_users"` // users who sent a message in the range
+}
+
+// Tracker records the activity of every user
+type Tracker struct {
+	location      *time.Location
+	retentionDays int
+	path          string
+	now           func() time.Time
+
+	mu        sync.RWMutex
+	users     map[string]*user
+	days      map[string]map[string]*hourCounts
+	dirty     bool             // messages recorded since the last flush
+	flushedAt map[string]int64 // lastSeen of each user at the last flush
+}
+
+// New creates a tracker and loads the persisted activity. It returns nil
+// when activity tracking is disabled; a nil tracker records nothing.
+func New(config configpkg.ActivityConfig) (*Tracker, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	location, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid activity timezone %q: %w", config.Timezone, err)
+	}
+
+	t := &Tracker{
+		location:      location,
+		retentionDays: config.RetentionDays,
+		path:          config.StatePath,
+		now:           time.Now,
+		users:         make(map[string]*user),
+		days:          make(map[string]map[string]*hourCounts),
+		flushedAt:     make(map[string]int64),
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Seen records an authenticated request of a user. Apart from the first
+// request of a user, it only stores the current time.
+func (t *Tracker) Seen(userID string) {
+	if t == nil || userID == "" {
+		return
+	}
+	t.user(userID).lastSeen.Store(t.now().Unix())
+}
+
+// RecordMessage counts a message sent by a user in the current hour
+func (t *Tracker) RecordMessage(userID string) {
+	if t == nil || userID == "" {
+		return
+	}
+	u := t.user(userID)
+	now := t.now()
+	day, hour := t.dayOf(now), now.In(t.location).Hour()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	users := t.days[day]
+	if users == nil {
+		users = make(map[string]*hourCounts)
+		t.days[day] = users
+	}
+	counts := users[userID]
+	if counts == nil {
+		counts = &hourCounts{}
+		users[userID] = counts
+	}
+	counts[hour]++
+	u.lastMessage = now
+	t.dirty = true
+}
+
+// User returns the activity of a user, and false for users the tracker does
+// not know
+func (t *Tracker) User(userID string) (UserActivity, bool) {
+	activity := UserActivity{UserID: userID}
+	if t == nil {
+		return activity, false
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	u, ok := t.users[userID]
+	if !ok {
+		return activity, false
+	}
+	activity.LastSeen, activity.LastMessage = u.times()
+
+	oldest := t.oldestDay(t.retentionDays)
+	for day, users := range t.days {
+		counts := users[userID]
+		if counts == nil || day < oldest {
+			continue
+		}
+		d := DayActivity{Day: day, Hours: *counts}
+		for _, n := range counts {
+			d.Messages += n
+		}
+		activity.Days = append(activity.Days, d)
+		activity.Messages += d.Messages
+	}
+	slices.SortFunc(activity.Days, func(a, b DayActivity) int { return cmp.Compare(a.Day, b.Day) })
+	return activity, true
+}
+
+// Users returns the activity of every user without the days, most recently
+// seen first
+func (t *Tracker) Users() []UserActivity {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	oldest := t.oldestDay(t.retentionDays)
+	activities := make([]UserActivity, 0, len(t.users))
+	for userID, u := range t.users {
+		activity := UserActivity{UserID: userID}
+		activity.LastSeen, activity.LastMessage = u.times()
+		for day, users := range t.days {
+			if counts := users[userID]; counts != nil && day >= oldest {
+				for _, n := range counts {
+					activity.Messages += n
+				}
+			}
+		}
+		activities = append(activities, activity)
+	}
+	slices.SortFunc(activities, func(a, b UserActivity) int {
+		if c := latest(b).Compare(latest(a)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.UserID, b.UserID)
+	})
+	return activities
+}
+
+// Heatmap returns the messages of all users per weekday and hour over the
+// last days days, today included; days is capped at the retention period
+func (t *Tracker) Heatmap(days int) Heatmap {
+	if t == nil {
+		return Heatmap{}
+	}
+	days = max(1, min(days, t.retentionDays))
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	heatmap := Heatmap{
+		Timezone: t.location.String(),
+		From:     t.oldestDay(days),
+		To:       t.dayOf(t.now()),
+	}
+	active := make(map[string]bool)
+	for day, users := range t.days {
+		if day < heatmap.From {
+			continue
+		}
+		date, err := time.ParseInLocation(time.DateOnly, day, t.location)
+		if err != nil {
+			continue
+		}
+		weekday := (int(date.Weekday()) + 6) % 7
+		for userID, counts := range users {
+			for hour, n := range counts {
+				heatmap.Weekdays[weekday][hour] += n
+				heatmap.Messages += n
+			}
+			active[userID] = true
+		}
+	}
+	heatmap.ActiveUsers = len(active)
+	return heatmap
+}
+
+// Flush persists the activity if it changed since the last flush, after
+// dropping the days older than the retention period
+func (t *Tracker) Flush() error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	changed := t.dirty
+	for userID, u := range t.users {
+		if seen := u.lastSeen.Load(); seen != t.flushedAt[userID] {
+			t.flushedAt[userID] = seen
+			changed = true
+		}
+	}
+	oldest := t.oldestDay(t.retentionDays)
+	for day := range t.days {
+		if day < oldest {
+			delete(t.days, day)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	s := state{Users: make(map[string]userState, len(t.users)), Days: t.days}
+	for userID, u := range t.users {
+		lastSeen, lastMessage := u.times()
+		var us userState
+		if lastSeen != nil {
+			us.LastSeen = *lastSeen
+		}
+		if lastMessage != nil {
+			us.LastMessage = *lastMessage
+		}
+		s.Users[userID] = us
+	}
+	if err := writeState(t.path, s); err != nil {
+		return err
+	}
+	t.dirty = false
+	return nil
+}
+
+// user returns the activity of a user, adding the user on first use
+func (t *Tracker) user(userID string) *user {
+	t.mu.RLock()
+	u, ok := t.users[userID]
+	t.mu.RUnlock()
+	if ok {
+		return u
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if u, ok := t.users[userID]; ok {
+		return u
+	}
+	u = &user{}
+	t.users[userID] = u
+	return u
+}
+
+// times returns when a user was last seen and last sent a message, nil if
+// never. The caller must hold Tracker.mu.
+func (u *user) times() (lastSeen, lastMessage *time.Time) {
+	if seen := u.lastSeen.Load(); seen != 0 {
+		at := time.Unix(seen, 0).UTC()
+		lastSeen = &at
+	}
+	if !u.lastMessage.IsZero() {
+		at := u.lastMessage.UTC()
+		lastMessage = &at
+	}
+	return lastSeen, lastMessage
+}
+
+// dayOf returns the day of a time in the tracker time zone
+func (t *Tracker) dayOf(at time.Time) string {
+	return at.In(t.location).Format(time.DateOnly)
+}
+
+// oldestDay returns the first of the last n days, today included
+func (t *Tracker) oldestDay(n int) string {
+	return t.now().In(t.location).AddDate(0, 0, 1-n).Format(time.DateOnly)
+}
+
+// load reads the state file, if any
+func (t *Tracker) load() error {
+	data, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read activity state: %w", err)
+	}
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("failed to unmarshal activity state: %w", err)
+	}
+
+	for userID, us := range s.Users {
+		u := &user{lastMessage: us.LastMessage}
+		if !us.LastSeen.IsZero() {
+			u.lastSeen.Store(us.LastSeen.Unix())
+		}
+		t.users[userID] = u
+		t.flushedAt[userID] = u.lastSeen.Load()
+	}
+	for day, users := range s.Days {
+		for userID, counts := range users {
+			if counts == nil {
+				continue
+			}
+			if t.days[day] == nil {
+				t.days[day] = make(map[string]*hourCounts)
+			}
+			t.days[day][userID] = counts
+			if _, ok := t.users[userID]; !ok {
+				t.users[userID] = &user{}
+			}
+		}
+	}
+	return nil
+}
+
+// writeState writes the state file atomically
+func writeState(path string, s state) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal activity state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create activity state directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write activity state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write activity state: %w", err)
+	}
+	return nil
+}
+
+// latest returns the later of when a user was last seen and last sent a message
+func latest(a UserActivity) time.Time {
+	var at time.Time
+	if a.LastSeen != nil {
+		at = *a.LastSeen
+	}
+	if a.LastMessage != nil && a.LastMessage.After(at) {
+		at = *a.LastMessage
+	}
+	return at
+}
@@ -48,12 +48,18 @@ func (s AgentState) String() string {
 	}
 }
 
+// MarshalText encodes the state by its name
+func (s AgentState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 // AgentLifecycleConfig holds configuration for agent lifecycle management
 type AgentLifecycleConfig struct {
 	MaxIdleTime         time.Duration `json:"max_idle_time"`         // How long agent can be idle before stopping
 	HealthCheckInterval time.Duration `json:"health_check_interval"` // Health check interval
 	MaxRetries          int           `json:"max_retries"`           // Maximum number of retries on error
 	RetryDelay          time.Duration `json:"retry_delay"`           // Delay between retries
+	EventHistory        int           `json:"event_history"`         // Lifecycle events kept, see History
 }
 
 // DefaultAgentLifecycleConfig returns a default lifecycle configuration
@@ -63,6 +69,7 @@ func DefaultAgentLifecycleConfig() *AgentLifecycleConfig {
 		HealthCheckInterval: 30 * time.Second,
 		MaxRetries:          3,
 		RetryDelay:          5 * time.Second,
+		EventHistory:        DefaultEventHistory,
 	}
 }
 
@@ -79,7 +86,10 @@ type AgentLifecycleManager struct {
 	cancel       context.CancelFunc
 	eventChan    chan LifecycleEvent
 	eventHandler LifecycleEventHandler
+	events       *EventLog
 	metrics      *AgentMetrics
+	wg           sync.WaitGroup // background routines
+	stopOnce     sync.Once
 }
 
 // LifecycleEvent represents a lifecycle event
@@ -88,7 +98,9 @@ type LifecycleEvent struct {
 	EventType string     `json:"event_type"`
 	State     AgentState `json:"state"`
 	Message   string     `json:"message"`
-	Error     error      `json:"error,omitempty"`
+	Error     error      `json:"-"`
+	// ErrorMessage is the text of Error, set when the event is recorded
+	ErrorMessage string `json:"error,omitempty"`
 }
 
 // HealthStatus represents the health status of an agent
@@ -128,10 +140,12 @@ func NewAgentLifecycleManager(config *AgentLifecycleConfig) *AgentLifecycleManag
 		ctx:       ctx,
 		cancel:    cancel,
 		eventChan: make(chan LifecycleEvent, 100),
+		events:    NewEventLog(config.EventHistory),
 		metrics:   &AgentMetrics{StartTime: time.Now()},
 	}
 
 	// Start background routines
+	manager.wg.Add(3)
 	go manager.eventProcessor()
 	go manager.healthChecker()
 	go manager.idleMonitor()
@@ -173,6 +187,7 @@ func (lm *AgentLifecycleManager) SetState(state AgentState, message string, err
 		Message:   message,
 		Error:     err,
 	}
+	lm.events.Record(event)
 
 	select {
 	case lm.eventChan <- event:
@@ -250,30 +265,38 @@ func (lm *AgentLifecycleManager) UpdateTokenMetrics(tokensIn, tokensOut int64) {
 	lm.metrics.TotalTokensOut += tokensOut
 }
 
+// History returns the last lifecycle events and the time spent in each state
+func (lm *AgentLifecycleManager) History() StateHistory {
+	return lm.events.History(time.Now())
+}
+
 // SetEventHandler sets the handler for lifecycle events
 func (lm *AgentLifecycleManager) SetEventHandler(handler LifecycleEventHandler) {
 	lm.eventHandler = handler
 }
 
-// Stop gracefully stops the lifecycle manager
+// Stop gracefully stops the lifecycle manager and waits for its background
+// routines to exit. Calls after the first have no effect.
 func (lm *AgentLifecycleManager) Stop() {
-	if err := lm.SetState(StateStopping, "Lifecycle manager stopping", nil); err != nil {
-		log.Printf("Warning: Failed to set stopping state: %v", err)
-	}
-
-	// Cancel context to stop all background routines
-	lm.cancel()
-
-	// Close event channel
-	close(lm.eventChan)
+	lm.stopOnce.Do(func() {
+		if err := lm.SetState(StateStopping, "Lifecycle manager stopping", nil); err != nil {
+			log.Printf("Warning: Failed to set stopping state: %v", err)
+		}
+		if err := lm.SetState(StateStopped, "Lifecycle manager stopped", nil); err != nil {
+			log.Printf("Warning: Failed to set stopped state: %v", err)
+		}
 
-	if err := lm.SetState(StateStopped, "Lifecycle manager stopped", nil); err != nil {
-		log.Printf("Warning: Failed to set stopped state: %v", err)
-	}
+		// Cancel context to stop all background routines. The event channel
+		// stays open: closing it would make a late SetState panic.
+		lm.cancel()
+		lm.wg.Wait()
+	})
 }
 
 // eventProcessor processes lifecycle events
 func (lm *AgentLifecycleManager) eventProcessor() {
+	defer lm.wg.Done()
+
 	for {
 		select {
 		case <-lm.ctx.Done():
@@ -291,6 +314,8 @@ func (lm *AgentLifecycleManager) eventProcessor() {
 
 // healthChecker periodically checks the health of the agent
 func (lm *AgentLifecycleManager) healthChecker() {
+	defer lm.wg.Done()
+
 	ticker := time.NewTicker(lm.config.HealthCheckInterval)
 	defer ticker.Stop()
 
@@ -329,6 +354,8 @@ func (lm *AgentLifecycleManager) performHealthCheck() {
 
 // idleMonitor monitors agent inactivity and stops idle agents
 func (lm *AgentLifecycleManager) idleMonitor() {
+	defer lm.wg.Done()
+
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultEventHistory is the number of lifecycle events an EventLog keeps
+// when none is configured
+const DefaultEventHistory = 50
+
+// EventLog keeps the last lifecycle events of an agent in a ring buffer.
+// Recording never blocks on a reader and keeps working after the agent is
+// stopped. The zero value keeps no events.
+type EventLog struct {
+	mu     sync.Mutex
+	events []LifecycleEvent // ring buffer of at most cap(events) events
+	next   int              // index of the slot written next once the buffer is full
+}
+
+// StateHistory is the recorded lifecycle of an agent: its last events, oldest
+// first, and the time spent in each state over the period they cover
+type StateHistory struct {
+	State          string                   `json:"state"` // state of the last event
+	Events         []LifecycleEvent         `json:"events"`
+	StateDurations map[string]time.Duration `json:"state_durations"`
+}
+
+// NewEventLog returns an event log keeping the last size events
+func NewEventLog(size int) *EventLog {
+	return &EventLog{events: make([]LifecycleEvent, 0, max(size, 0))}
+}
+
+// Record adds an event, replacing the oldest one when the log is full
+func (l *EventLog) Record(event LifecycleEvent) {
+	if l == nil {
+		return
+	}
+	if event.Error != nil && event.ErrorMessage == "" {
+		event.ErrorMessage = event.Error.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case cap(l.events) == 0:
+	case len(l.events) < cap(l.events):
+		l.events = append(l.events, event)
+	default:
+		l.events[l.next] = event
+		l.next = (l.next + 1) % len(l.events)
+	}
+}
+
+// Events returns the recorded events, oldest first
+func (l *EventLog) Events() []LifecycleEvent {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := make([]LifecycleEvent, 0, len(l.events))
+	events = append(events, l.events[l.next:]...)
+	return append(events, l.events[:l.next]...)
+}
+
+// History returns the recorded events with the time spent in each state up
+// to now. Each state lasts from its event to the next one; the time before
+// the oldest recorded event is unknown and left out.
+func (l *EventLog) History(now time.Time) StateHistory {
+	history := StateHistory{Events: l.Events(), StateDurations: map[string]time.Duration{}}
+	for i, event := range history.Events {
+		end := now
+		if i+1 < len(history.Events) {
+			end = history.Events[i+1].Timestamp
+		}
+		if d := end.Sub(event.Timestamp); d > 0 {
+			history.StateDurations[event.State.String()] += d
+		}
+		history.State = event.State.String()
+	}
+	return history
+}
@@ -1,25 +1,60 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
+	"github.com/smallnest/langchat/pkg/audit"
 	"github.com/smallnest/langchat/pkg/auth"
 	"github.com/smallnest/langchat/pkg/middleware"
+	monitoringpkg "github.com/smallnest/langchat/pkg/monitoring"
 )
 
 // AuthAPI handles authentication related API endpoints
 type AuthAPI struct {
 	authService *auth.AuthService
 	jwtAuth     *middleware.AuthMiddleware
+	metrics     *monitoringpkg.MetricsCollector
+	auditLogger *audit.Logger
+	verifier    *emailVerifier // nil when emails are not verified
 }
 
-// NewAuthAPI creates a new authentication API handler
-func NewAuthAPI(authService *auth.AuthService, jwtAuth *middleware.AuthMiddleware) *AuthAPI {
+// NewAuthAPI creates a new authentication API handler.
+// metrics may be nil, in which case auth events are not recorded.
+func NewAuthAPI(authService *auth.AuthService, jwtAuth *middleware.AuthMiddleware, metrics *monitoringpkg.MetricsCollector) *AuthAPI {
 	return &AuthAPI{
 		authService: authService,
 		jwtAuth:     jwtAuth,
+		metrics:     metrics,
+	}
+}
+
+// SetAuditLogger sets the logger that records redeemed invite codes
+func (a *AuthAPI) SetAuditLogger(auditLogger *audit.Logger) {
+	a.auditLogger = auditLogger
+}
+
+// recordRefreshTokens updates the active refresh token gauge
+func (a *AuthAPI) recordRefreshTokens() {
+	if a.metrics != nil {
+		a.metrics.SetAuthActiveRefreshTokens(a.authService.ActiveRefreshTokens())
+	}
+}
+
+// loginResult maps a login error to a metrics label
+func loginResult(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.Is(err, auth.ErrAccountInactive):
+		return "inactive"
+	default:
+		return "error"
 	}
 }
 
@@ -27,9 +62,11 @@ func NewAuthAPI(authService *auth.AuthService, jwtAuth *middleware.AuthMiddlewar
 func (a *AuthAPI) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/auth/login", a.HandleLogin)
 	mux.HandleFunc("/api/auth/register", a.HandleRegister)
-	mux.HandleFunc("/api/auth/refresh", a.HandleRefresh)
-	mux.HandleFunc("/api/auth/logout", a.HandleLogout)
-	mux.HandleFunc("/api/auth/me", a.HandleGetCurrentUser)
+	mux.HandleFunc("POST /api/auth/refresh", a.HandleRefresh)
+	mux.HandleFunc("POST /api/auth/logout", a.HandleLogout)
+	mux.HandleFunc("GET /api/auth/me", a.HandleGetCurrentUser)
+	mux.HandleFunc("GET /api/auth/verify", a.HandleVerifyEmail)
+	mux.HandleFunc("POST /api/auth/verify/resend", a.HandleResendVerification)
 
 	// Serve login page
 	mux.HandleFunc("/login", a.HandleLoginPage)
@@ -55,6 +92,10 @@ func (a *AuthAPI) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response, err := a.authService.Login(r.Context(), &req)
+	if a.metrics != nil {
+		a.metrics.RecordAuthLogin(loginResult(err))
+	}
+	a.recordRefreshTokens()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
@@ -84,11 +125,35 @@ func (a *AuthAPI) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := a.authService.Register(r.Context(), &req)
-	if err != nil {
+	response, invite, err := a.authService.Register(r.Context(), &req)
+	if invite != nil {
+		a.auditLogger.Log(audit.Event{
+			Action:   "invite.redeem",
+			Actor:    invite.UsedBy,
+			Resource: auth.InviteID(invite.Code),
+			Result:   "success",
+			Details: map[string]any{
+				"username":   req.Username,
+				"roles":      invite.Roles,
+				"created_by": invite.CreatedBy,
+			},
+		})
+	}
+	switch {
+	case errors.Is(err, auth.ErrRegistrationClosed), errors.Is(err, auth.ErrInviteRequired), errors.Is(err, auth.ErrInvalidInvite):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if a.metrics != nil {
+		a.metrics.RecordAuthRegistration()
+	}
+	a.recordRefreshTokens()
+	if a.verifier != nil {
+		a.sendVerificationAsync(response.User.ID)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -96,13 +161,26 @@ func (a *AuthAPI) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// HandleRefresh handles token refresh
-func (a *AuthAPI) HandleRefresh(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// RefreshToken exchanges a refresh token for new tokens and records the
+// refresh in the metrics. It is the refresher of the silent refresh of page
+// loads as well as of HandleRefresh.
+func (a *AuthAPI) RefreshToken(ctx context.Context, refreshToken string) (*auth.LoginResponse, error) {
+	response, err := a.authService.RefreshToken(ctx, refreshToken)
+	if a.metrics != nil {
+		result := "success"
+		if errors.Is(err, auth.ErrInvalidRefreshToken) {
+			result = "invalid_token"
+		} else if err != nil {
+			result = "error"
+		}
+		a.metrics.RecordAuthTokenRefresh(result)
 	}
+	a.recordRefreshTokens()
+	return response, err
+}
 
+// HandleRefresh handles token refresh
+func (a *AuthAPI) HandleRefresh(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		RefreshToken string `json:"refresh_token"`
 	}
@@ -112,7 +190,7 @@ func (a *AuthAPI) HandleRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := a.authService.RefreshToken(r.Context(), req.RefreshToken)
+	response, err := a.RefreshToken(r.Context(), req.RefreshToken)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
@@ -126,11 +204,6 @@ func (a *AuthAPI) HandleRefresh(w http.ResponseWriter, r *http.Request) {
 
 // HandleLogout handles user logout
 func (a *AuthAPI) HandleLogout(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req struct {
 		RefreshToken string `json:"refresh_token"`
 	}
@@ -141,6 +214,7 @@ func (a *AuthAPI) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err := a.authService.Logout(r.Context(), req.RefreshToken)
+	a.recordRefreshTokens()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -154,11 +228,6 @@ func (a *AuthAPI) HandleLogout(w http.ResponseWriter, r *http.Request) {
 
 // HandleGetCurrentUser returns the current authenticated user
 func (a *AuthAPI) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Get user from JWT token
 	user, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
@@ -174,13 +243,7 @@ func (a *AuthAPI) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(&auth.UserInfo{
-		ID:       fullUser.ID,
-		Username: fullUser.Username,
-		Email:    fullUser.Email,
-		Nickname: fullUser.Nickname,
-		Roles:    fullUser.Roles,
-	}); err != nil {
+	if err := json.NewEncoder(w).Encode(fullUser.Info()); err != nil {
 		log.Printf("Warning: Failed to encode user info response: %v", err)
 	}
 }
@@ -188,7 +251,7 @@ func (a *AuthAPI) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
 // serveLoginPage serves the login HTML page
 func (a *AuthAPI) serveLoginPage(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
-	if _, err := w.Write([]byte(loginPageHTML)); err != nil {
+	if _, err := w.Write(middleware.PrefixPaths([]byte(loginPageHTML), middleware.BasePathFrom(r.Context()))); err != nil {
 		log.Printf("Warning: Failed to write login page HTML: %v", err)
 	}
 }
@@ -196,7 +259,7 @@ func (a *AuthAPI) serveLoginPage(w http.ResponseWriter, r *http.Request) {
 // serveRegisterPage serves the registration HTML page
 func (a *AuthAPI) serveRegisterPage(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
-	if _, err := w.Write([]byte(registerPageHTML)); err != nil {
+	if _, err := w.Write(middleware.PrefixPaths([]byte(registerPageHTML), middleware.BasePathFrom(r.Context()))); err != nil {
 		log.Printf("Warning: Failed to write register page HTML: %v", err)
 	}
 }
@@ -522,6 +585,10 @@ const registerPageHTML = `<!DOCTYPE html>
                 <label for="password">密码</label>
                 <input type="password" id="password" name="password" required minlength="6">
             </div>
+            <div class="form-group">
+                <label for="invite_code">邀请码（仅邀请注册时需要）</label>
+                <input type="text" id="invite_code" name="invite_code">
+            </div>
             <button type="submit" class="register-button">注册</button>
         </form>
 
@@ -531,6 +598,11 @@ const registerPageHTML = `<!DOCTYPE html>
     </div>
 
     <script>
+        const inviteCode = new URLSearchParams(window.location.search).get('invite');
+        if (inviteCode) {
+            document.getElementById('invite_code').value = inviteCode;
+        }
+
         document.getElementById('register-form').addEventListener('submit', async (e) => {
             e.preventDefault();
 
@@ -538,6 +610,7 @@ const registerPageHTML = `<!DOCTYPE html>
             const nickname = document.getElementById('nickname').value;
             const email = document.getElementById('email').value;
             const password = document.getElementById('password').value;
+            const invite_code = document.getElementById('invite_code').value.trim();
             const errorDiv = document.getElementById('error-message');
 
             try {
@@ -546,9 +619,14 @@ const registerPageHTML = `<!DOCTYPE html>
                     headers: {
                         'Content-Type': 'application/json',
                     },
-                    body: JSON.stringify({ username, nickname, email, password })
+                    body: JSON.stringify({ username, nickname, email, password, invite_code })
                 });
 
+                if (!response.ok) {
+                    errorDiv.textContent = (await response.text()).trim() || '注册失败';
+                    errorDiv.style.display = 'block';
+                    return;
+                }
                 const data = await response.json();
 
                 if (response.ok) {
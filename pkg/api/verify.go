@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/audit"
+	"github.com/smallnest/langchat/pkg/auth"
+	"github.com/smallnest/langchat/pkg/mail"
+	"github.com/smallnest/langchat/pkg/middleware"
+)
+
+// errResendTooSoon is returned when a verification email was sent too recently
+var errResendTooSoon = errors.New("a verification email was sent recently")
+
+// emailVerifier sends the verification links of new accounts
+type emailVerifier struct {
+	sender         *mail.Sender
+	publicURL      string        // base of the links, without a trailing slash
+	ttl            time.Duration // validity of a link
+	resendInterval time.Duration // minimum time between two emails to a user
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time // user ID -> when the last email was sent
+}
+
+// SetEmailVerifier makes registrations send a verification link through
+// sender. Links point to publicURL and are valid for ttl; a user gets at most
+// one email per resendInterval.
+func (a *AuthAPI) SetEmailVerifier(sender *mail.Sender, publicURL string, ttl, resendInterval time.Duration) {
+	a.verifier = &emailVerifier{
+		sender:         sender,
+		publicURL:      strings.TrimSuffix(publicURL, "/"),
+		ttl:            ttl,
+		resendInterval: resendInterval,
+		lastSent:       make(map[string]time.Time),
+	}
+}
+
+// reserve records that an email is about to be sent to a user, or returns
+// how long to wait when the last one was sent less than resendInterval ago
+func (v *emailVerifier) reserve(userID string) (time.Duration, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	if wait := v.resendInterval - now.Sub(v.lastSent[userID]); wait > 0 {
+		return wait, errResendTooSoon
+	}
+	v.lastSent[userID] = now
+	return 0, nil
+}
+
+// send emails the verification link of the current address of a user
+func (a *AuthAPI) sendVerification(user *auth.User) error {
+	token, err := a.authService.EmailVerificationToken(user, a.verifier.ttl)
+	if err != nil {
+		return err
+	}
+	link := a.verifier.publicURL + "/api/auth/verify?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("您好 %s，\n\n请打开以下链接验证您的电子邮箱：\n\n%s\n\n链接在 %s 内有效。如果您没有注册账号，请忽略此邮件。\n",
+		user.Nickname, link, a.verifier.ttl)
+	return a.verifier.sender.Send(user.Email, "验证您的电子邮箱", body)
+}
+
+// sendVerificationAsync emails the verification link of a new account
+// without holding up its registration
+func (a *AuthAPI) sendVerificationAsync(userID string) {
+	user, ok := a.authService.GetUserByID(userID)
+	if !ok {
+		return
+	}
+	if _, err := a.verifier.reserve(userID); err != nil {
+		return
+	}
+	go func() {
+		if err := a.sendVerification(user); err != nil {
+			log.Printf("Warning: Failed to send verification email to user %s: %v", userID, err)
+		}
+	}()
+}
+
+// HandleVerifyEmail verifies the email address of the token of a
+// verification link and sends the browser on to the chat UI
+func (a *AuthAPI) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authService.VerifyEmail(r.URL.Query().Get("token"))
+	if err != nil {
+		a.auditLogger.Log(audit.Event{Action: "user.verify_email", Result: "failure"})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.auditLogger.Log(audit.Event{Action: "user.verify_email", Actor: user.ID, Resource: user.ID, Result: "success"})
+
+	http.Redirect(w, r, middleware.BasePathFrom(r.Context())+"/?email_verified=1", http.StatusSeeOther)
+}
+
+// HandleResendVerification sends the current user another verification
+// link, at most once per resend interval
+func (a *AuthAPI) HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if a.verifier == nil {
+		http.Error(w, "Email verification is not enabled", http.StatusNotFound)
+		return
+	}
+	user, ok := a.authService.GetUserByID(claims.UserID)
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if !user.EmailVerified {
+		wait, err := a.verifier.reserve(user.ID)
+		if err != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		if err := a.sendVerification(user); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+			http.Error(w, "Failed to send verification email", http.StatusBadGateway)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{
+		"email_verified": user.EmailVerified,
+		"sent":           !user.EmailVerified,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode resend verification response: %v", err)
+	}
+}
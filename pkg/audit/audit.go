@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Event represents a single audit log entry
+type Event struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Action    string         `json:"action"`             // e.g. "sandbox.violation", "user.login"
+	Actor     string         `json:"actor,omitempty"`    // user or session responsible for the action
+	Resource  string         `json:"resource,omitempty"` // object the action applies to
+	Result    string         `json:"result,omitempty"`   // "success", "denied", "failure"
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// Logger appends audit events as JSON lines to a file
+type Logger struct {
+	mu   sync.Mutex
+	file *os.File
+	path string
+}
+
+// NewLogger creates an audit logger writing to the given file path.
+// An empty path returns a logger that only writes to the standard log.
+func NewLogger(path string) (*Logger, error) {
+	logger := &Logger{path: path}
+	if path == "" {
+		return logger, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	logger.file = file
+
+	return logger, nil
+}
+
+// Log records an audit event. It is safe to call on a nil Logger.
+func (l *Logger) Log(event Event) {
+	if l == nil {
+		return
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Warning: Failed to marshal audit event %s: %v", event.Action, err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		log.Printf("AUDIT %s", data)
+		return
+	}
+
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		log.Printf("Warning: Failed to write audit event %s: %v", event.Action, err)
+	}
+}
+
+// Close closes the underlying audit log file
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -4,10 +4,26 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	monitoringpkg "github.com/smallnest/langchat/pkg/monitoring"
+)
+
+var (
+	// ErrInvalidCredentials is returned when the username or password is wrong
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrAccountInactive is returned when logging in to a deactivated account
+	ErrAccountInactive = errors.New("account is inactive")
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown or revoked
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrUserNotFound is returned when no user has an ID
+	ErrUserNotFound = errors.New("user not found")
 )
 
 // User represents a user in the system
@@ -22,6 +38,10 @@ type User struct {
 	UpdatedAt time.Time  `json:"updated_at"`
 	LastLogin *time.Time `json:"last_login,omitempty"`
 	Active    bool       `json:"active"`
+	// EmailVerified is set once the user opened the verification link sent to Email
+	EmailVerified bool `json:"email_verified"`
+	// Workspace is the ID of the workspace the user belongs to, empty for none
+	Workspace string `json:"workspace,omitempty"`
 }
 
 // JWTClaims represents the JWT claims structure (must match middleware)
@@ -29,6 +49,8 @@ type JWTClaims struct {
 	UserID   string   `json:"user_id"`
 	Username string   `json:"username"`
 	Roles    []string `json:"roles"`
+	// Workspace is the workspace of the user when the token was issued
+	Workspace string `json:"workspace,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -44,6 +66,8 @@ type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Nickname string `json:"nickname"`
 	Password string `json:"password" binding:"required,min=6"`
+	// InviteCode is required while registration is by invite
+	InviteCode string `json:"invite_code,omitempty"`
 }
 
 // LoginResponse represents a login response
@@ -61,6 +85,22 @@ type UserInfo struct {
 	Email    string   `json:"email"`
 	Nickname string   `json:"nickname"`
 	Roles    []string `json:"roles"`
+	// EmailVerified is false until the user verifies their email, see SetEmailVerification
+	EmailVerified bool   `json:"email_verified"`
+	Workspace     string `json:"workspace,omitempty"`
+}
+
+// Info returns the client view of a user
+func (u *User) Info() *UserInfo {
+	return &UserInfo{
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		Nickname:      u.Nickname,
+		Roles:         u.Roles,
+		EmailVerified: u.EmailVerified,
+		Workspace:     u.Workspace,
+	}
 }
 
 // AuthService provides authentication services
@@ -70,6 +110,12 @@ type AuthService struct {
 	secretKey     string
 	tokenExpiry   time.Duration
 	refreshExpiry time.Duration
+	metrics       *monitoringpkg.MetricsCollector
+
+	inviteMu         sync.Mutex         // Guards invites and registrationMode, and serializes registrations
+	invites          map[string]*Invite // Invite codes by code
+	registrationMode string
+	verifyEmails     bool // New accounts start unverified, see SetEmailVerification
 }
 
 // NewAuthService creates a new authentication service
@@ -80,9 +126,22 @@ func NewAuthService(secretKey string, tokenExpiry, refreshExpiry time.Duration)
 		secretKey:     secretKey,
 		tokenExpiry:   tokenExpiry,
 		refreshExpiry: refreshExpiry,
+
+		invites:          make(map[string]*Invite),
+		registrationMode: RegistrationOpen,
 	}
 }
 
+// SetMetricsCollector sets the collector used to record password verification latency
+func (a *AuthService) SetMetricsCollector(metrics *monitoringpkg.MetricsCollector) {
+	a.metrics = metrics
+}
+
+// ActiveRefreshTokens returns the number of refresh tokens currently issued
+func (a *AuthService) ActiveRefreshTokens() int {
+	return len(a.refreshTokens)
+}
+
 // CreateUser creates a new user (for testing/demo)
 func (a *AuthService) CreateUser(username, email, nickname, password string, roles []string) (*User, error) {
 	// Check if user already exists
@@ -108,6 +167,8 @@ func (a *AuthService) CreateUser(username, email, nickname, password string, rol
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		Active:    true,
+		// Without verification there is nothing to wait for
+		EmailVerified: !a.verifyEmails,
 	}
 
 	a.users[username] = user
@@ -118,16 +179,21 @@ func (a *AuthService) CreateUser(username, email, nickname, password string, rol
 func (a *AuthService) Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error) {
 	user, exists := a.users[req.Username]
 	if !exists {
-		return nil, fmt.Errorf("invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 
 	if !user.Active {
-		return nil, fmt.Errorf("account is inactive")
+		return nil, ErrAccountInactive
 	}
 
 	// Verify password
-	if !a.verifyPassword(req.Password, user.Password) {
-		return nil, fmt.Errorf("invalid credentials")
+	start := time.Now()
+	valid := a.verifyPassword(req.Password, user.Password)
+	if a.metrics != nil {
+		a.metrics.RecordPasswordVerify(time.Since(start))
+	}
+	if !valid {
+		return nil, ErrInvalidCredentials
 	}
 
 	// Update last login
@@ -153,38 +219,37 @@ func (a *AuthService) Login(ctx context.Context, req *LoginRequest) (*LoginRespo
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 		ExpiresIn:    int64(a.tokenExpiry.Seconds()),
-		User: &UserInfo{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Nickname: user.Nickname,
-			Roles:    user.Roles,
-		},
+		User:         user.Info(),
 	}, nil
 }
 
-// Register creates a new user account
-func (a *AuthService) Register(ctx context.Context, req *RegisterRequest) (*LoginResponse, error) {
+// Register creates a new user account under the registration mode. When
+// the account was registered with an invite code, the redeemed invite is
+// returned as well.
+func (a *AuthService) Register(ctx context.Context, req *RegisterRequest) (*LoginResponse, *Invite, error) {
 	// Check if user already exists
 	if _, exists := a.users[req.Username]; exists {
-		return nil, fmt.Errorf("username already exists")
+		return nil, nil, fmt.Errorf("username already exists")
 	}
 
 	// Create user
-	user, err := a.CreateUser(req.Username, req.Email, req.Nickname, req.Password, []string{"user"})
+	user, invite, err := a.registerUser(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		if errors.Is(err, ErrRegistrationClosed) || errors.Is(err, ErrInviteRequired) || errors.Is(err, ErrInvalidInvite) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
 	// Generate tokens
 	accessToken, err := a.generateAccessToken(user)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+		return nil, invite, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
 	refreshToken, err := a.generateRefreshToken()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, invite, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
 	// Store refresh token
@@ -194,21 +259,15 @@ func (a *AuthService) Register(ctx context.Context, req *RegisterRequest) (*Logi
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 		ExpiresIn:    int64(a.tokenExpiry.Seconds()),
-		User: &UserInfo{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Nickname: user.Nickname,
-			Roles:    user.Roles,
-		},
-	}, nil
+		User:         user.Info(),
+	}, invite, nil
 }
 
 // RefreshToken generates a new access token using a refresh token
 func (a *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*LoginResponse, error) {
 	userID, exists := a.refreshTokens[refreshToken]
 	if !exists {
-		return nil, fmt.Errorf("invalid refresh token")
+		return nil, ErrInvalidRefreshToken
 	}
 
 	// Find user
@@ -244,13 +303,7 @@ func (a *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*L
 		AccessToken:  accessToken,
 		RefreshToken: newRefreshToken,
 		ExpiresIn:    int64(a.tokenExpiry.Seconds()),
-		User: &UserInfo{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Nickname: user.Nickname,
-			Roles:    user.Roles,
-		},
+		User:         user.Info(),
 	}, nil
 }
 
@@ -270,20 +323,49 @@ func (a *AuthService) GetUserByID(userID string) (*User, bool) {
 	return nil, false
 }
 
+// SetUserWorkspace moves a user to a workspace, or out of any with an empty
+// ID. Tokens carry the workspace, so it applies from the next login or token
+// refresh.
+func (a *AuthService) SetUserWorkspace(userID, workspace string) (*User, error) {
+	user, ok := a.GetUserByID(userID)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user.Workspace = workspace
+	user.UpdatedAt = time.Now()
+	return user, nil
+}
+
+// WorkspaceMembers returns the users of a workspace, sorted by username
+func (a *AuthService) WorkspaceMembers(workspace string) []*User {
+	var members []*User
+	for _, user := range a.users {
+		if user.Workspace == workspace {
+			members = append(members, user)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Username < members[j].Username })
+	return members
+}
+
 // CreateDemoUsers creates demo users for testing
 func (a *AuthService) CreateDemoUsers() error {
 	// Create admin user
-	_, err := a.CreateUser("admin", "admin@example.com", "管理员", "admin123", []string{"admin", "user"})
+	admin, err := a.CreateUser("admin", "admin@example.com", "管理员", "admin123", []string{"admin", "user"})
 	if err != nil {
 		return fmt.Errorf("failed to create admin user: %w", err)
 	}
 
 	// Create regular user
-	_, err = a.CreateUser("user", "user@example.com", "普通用户", "user123", []string{"user"})
+	user, err := a.CreateUser("user", "user@example.com", "普通用户", "user123", []string{"user"})
 	if err != nil {
 		return fmt.Errorf("failed to create regular user: %w", err)
 	}
 
+	// The example.com addresses cannot receive a verification link
+	admin.EmailVerified = true
+	user.EmailVerified = true
+
 	return nil
 }
 
@@ -318,9 +400,10 @@ func (a *AuthService) verifyPassword(password, hash string) bool {
 
 func (a *AuthService) generateAccessToken(user *User) (string, error) {
 	claims := JWTClaims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Roles:    user.Roles,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Roles:     user.Roles,
+		Workspace: user.Workspace,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(a.tokenExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Registration modes, see SetRegistrationMode
+const (
+	RegistrationOpen   = "open"   // anyone may register
+	RegistrationInvite = "invite" // registering requires an invite code
+	RegistrationClosed = "closed" // nobody may register
+)
+
+var (
+	// ErrRegistrationClosed is returned when registering while registration is closed
+	ErrRegistrationClosed = errors.New("registration is closed")
+	// ErrInviteRequired is returned when registering without an invite code in invite mode
+	ErrInviteRequired = errors.New("an invite code is required to register")
+	// ErrInvalidInvite is returned for an invite code that is unknown, used or expired
+	ErrInvalidInvite = errors.New("invalid or expired invite code")
+)
+
+// Invite is a single-use code that lets its holder register while
+// registration is by invite
+type Invite struct {
+	Code      string     `json:"code"`
+	Roles     []string   `json:"roles"`      // roles of the account registered with the code
+	CreatedBy string     `json:"created_by"` // ID of the admin who created the code
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // nil never expires
+	UsedBy    string     `json:"used_by,omitempty"`    // ID of the user who redeemed the code
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// InviteID identifies an invite code in logs without revealing the code
+func InviteID(code string) string {
+	return "invite:" + code[:min(8, len(code))]
+}
+
+// valid reports whether the invite can still be redeemed at now
+func (i *Invite) valid(now time.Time) bool {
+	return i.UsedAt == nil && (i.ExpiresAt == nil || now.Before(*i.ExpiresAt))
+}
+
+// SetRegistrationMode sets who may register: RegistrationOpen,
+// RegistrationInvite or RegistrationClosed. Unknown modes close registration.
+func (a *AuthService) SetRegistrationMode(mode string) {
+	a.inviteMu.Lock()
+	defer a.inviteMu.Unlock()
+	a.registrationMode = mode
+}
+
+// RegistrationMode returns who may register
+func (a *AuthService) RegistrationMode() string {
+	a.inviteMu.Lock()
+	defer a.inviteMu.Unlock()
+	return a.registrationMode
+}
+
+// CreateInvite creates an invite code. The account registered with it gets
+// roles, or the user role if roles is empty; a zero expiry never expires.
+func (a *AuthService) CreateInvite(createdBy string, roles []string, expiresAt time.Time) (*Invite, error) {
+	code, err := a.generateRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invite code: %w", err)
+	}
+	if len(roles) == 0 {
+		roles = []string{"user"}
+	}
+
+	invite := &Invite{
+		Code:      code,
+		Roles:     slices.Clone(roles),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+	if !expiresAt.IsZero() {
+		invite.ExpiresAt = &expiresAt
+	}
+
+	a.inviteMu.Lock()
+	defer a.inviteMu.Unlock()
+	a.invites[code] = invite
+	return invite, nil
+}
+
+// Invites returns all invite codes, newest first
+func (a *AuthService) Invites() []Invite {
+	a.inviteMu.Lock()
+	defer a.inviteMu.Unlock()
+
+	invites := make([]Invite, 0, len(a.invites))
+	for _, invite := range a.invites {
+		invites = append(invites, *invite)
+	}
+	sort.Slice(invites, func(i, j int) bool { return invites[i].CreatedAt.After(invites[j].CreatedAt) })
+	return invites
+}
+
+// registerUser creates the account of a registration request under the
+// registration mode. In invite mode the invite code is checked and consumed
+// together with creating the account, so a code registers one account only.
+func (a *AuthService) registerUser(req *RegisterRequest) (*User, *Invite, error) {
+	a.inviteMu.Lock()
+	defer a.inviteMu.Unlock()
+
+	switch a.registrationMode {
+	case RegistrationOpen:
+		user, err := a.CreateUser(req.Username, req.Email, req.Nickname, req.Password, []string{"user"})
+		return user, nil, err
+	case RegistrationInvite:
+	default:
+		return nil, nil, ErrRegistrationClosed
+	}
+
+	if req.InviteCode == "" {
+		return nil, nil, ErrInviteRequired
+	}
+	invite, ok := a.invites[req.InviteCode]
+	now := time.Now()
+	if !ok || !invite.valid(now) {
+		return nil, nil, ErrInvalidInvite
+	}
+
+	user, err := a.CreateUser(req.Username, req.Email, req.Nickname, req.Password, slices.Clone(invite.Roles))
+	if err != nil {
+		return nil, nil, err
+	}
+	invite.UsedBy = user.ID
+	invite.UsedAt = &now
+	redeemed := *invite
+	return user, &redeemed, nil
+}
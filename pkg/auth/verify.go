@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidVerificationToken is returned for a verification token that is
+// malformed, expired, or issued for another email address
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// verificationClaims are the claims of an email verification token
+type verificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// SetEmailVerification sets whether the email addresses of new accounts must
+// be verified. When they need not be, new accounts count as verified.
+func (a *AuthService) SetEmailVerification(required bool) {
+	a.verifyEmails = required
+}
+
+// EmailVerificationRequired reports whether new accounts must verify their email
+func (a *AuthService) EmailVerificationRequired() bool {
+	return a.verifyEmails
+}
+
+// verificationKey signs verification tokens. It differs from the key of
+// access tokens, so neither kind of token is accepted as the other.
+func (a *AuthService) verificationKey() []byte {
+	return []byte(a.secretKey + "\x00email-verification")
+}
+
+// EmailVerificationToken returns a signed token that verifies the current
+// email address of a user until ttl has passed
+func (a *AuthService) EmailVerificationToken(user *User, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := verificationClaims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "chat-agent",
+			Subject:   user.ID,
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.verificationKey())
+	if err != nil {
+		return "", fmt.Errorf("failed to sign verification token: %w", err)
+	}
+	return token, nil
+}
+
+// VerifyEmail marks the email address of the user of a verification token
+// as verified. A token issued before the address changed is rejected.
+func (a *AuthService) VerifyEmail(token string) (*User, error) {
+	var claims verificationClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (any, error) {
+		return a.verificationKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	user, ok := a.GetUserByID(claims.Subject)
+	if !ok || user.Email != claims.Email {
+		return nil, ErrInvalidVerificationToken
+	}
+	if !user.EmailVerified {
+		user.EmailVerified = true
+		user.UpdatedAt = time.Now()
+	}
+	return user, nil
+}
+
+// EmailVerified reports whether the user with an ID has verified their email
+func (a *AuthService) EmailVerified(userID string) bool {
+	user, ok := a.GetUserByID(userID)
+	return ok && user.EmailVerified
+}
@@ -0,0 +1,260 @@
+// Package breaker implements a circuit breaker that stops calling a failing
+// dependency for a cool-down period and then probes it before closing again.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// ErrOpen is returned without calling the dependency while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a breaker
+type State int
+
+const (
+	// StateClosed lets every call through and counts failures
+	StateClosed State = iota
+	// StateHalfOpen lets a limited number of probe calls through after the cool-down
+	StateHalfOpen
+	// StateOpen rejects calls until the cool-down has passed
+	StateOpen
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half_open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// transition is a change of state, reported after the lock is released
+type transition struct {
+	from, to State
+}
+
+// windowBuckets is the number of buckets the failure-rate window is split into
+const windowBuckets = 10
+
+// bucket counts the calls that ended in one slice of the window
+type bucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+// Breaker tracks the failure rate of calls to a dependency. It opens when the
+// failure rate over the window reaches the threshold, rejects calls for the
+// cool-down period, then lets probes through and closes once they succeed.
+type Breaker struct {
+	mu             sync.Mutex
+	state          State
+	openedAt       time.Time
+	buckets        [windowBuckets]bucket
+	probes         int // probes in flight while half-open
+	probeSuccesses int
+	generation     uint64 // incremented on every transition
+	failureRate    float64
+	minRequests    int
+	window         time.Duration
+	coolDown       time.Duration
+	halfOpenProbes int
+	onStateChange  func(from, to State)
+	now            func() time.Time
+}
+
+// New creates a closed breaker from the configuration. onStateChange, if not
+// nil, is called on every transition, outside the breaker's lock.
+func New(config configpkg.BreakerConfig, onStateChange func(from, to State)) *Breaker {
+	b := &Breaker{
+		failureRate:    config.FailureRate,
+		minRequests:    config.MinRequests,
+		window:         config.Window,
+		coolDown:       config.CoolDown,
+		halfOpenProbes: config.HalfOpenProbes,
+		onStateChange:  onStateChange,
+		now:            time.Now,
+	}
+	if b.failureRate <= 0 || b.failureRate > 1 {
+		b.failureRate = 0.5
+	}
+	if b.minRequests <= 0 {
+		b.minRequests = 1
+	}
+	if b.window <= 0 {
+		b.window = time.Minute
+	}
+	if b.coolDown <= 0 {
+		b.coolDown = 30 * time.Second
+	}
+	if b.halfOpenProbes <= 0 {
+		b.halfOpenProbes = 1
+	}
+	return b
+}
+
+// State returns the current state, moving an open breaker to half-open once
+// the cool-down has passed
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	state, t := b.refresh()
+	b.mu.Unlock()
+	b.notify(t)
+	return state
+}
+
+// RetryAfter returns how long an open breaker keeps rejecting calls
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateOpen {
+		return 0
+	}
+	return max(b.openedAt.Add(b.coolDown).Sub(b.now()), 0)
+}
+
+// Allow reports whether a call may proceed. An allowed call must report its
+// error by calling done: nil counts as a success, context.Canceled (the caller
+// gave up) is not counted, and any other error counts as a failure.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	state, t := b.refresh()
+	generation := b.generation
+	switch state {
+	case StateOpen:
+		err = ErrOpen
+	case StateHalfOpen:
+		if b.probes >= b.halfOpenProbes {
+			err = ErrOpen
+		} else {
+			b.probes++
+		}
+	}
+	b.mu.Unlock()
+	b.notify(t)
+
+	if err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.done(state, generation, err) })
+	}, nil
+}
+
+// done records the outcome of a call allowed in the given state. Outcomes of
+// calls that started before the last transition are ignored.
+func (b *Breaker) done(state State, generation uint64, err error) {
+	b.mu.Lock()
+	var t *transition
+
+	success := err == nil
+	if errors.Is(err, context.Canceled) {
+		// Free the probe slot without judging the dependency
+		if generation == b.generation && state == StateHalfOpen {
+			b.probes--
+		}
+	} else if generation == b.generation {
+		switch state {
+		case StateHalfOpen:
+			b.probes--
+			if !success {
+				t = b.open()
+				break
+			}
+			b.probeSuccesses++
+			if b.probeSuccesses >= b.halfOpenProbes {
+				t = b.setState(StateClosed)
+				b.buckets = [windowBuckets]bucket{}
+			}
+		case StateClosed:
+			cur := b.current()
+			if success {
+				cur.successes++
+			} else {
+				cur.failures++
+				if b.tripped() {
+					t = b.open()
+				}
+			}
+		}
+	}
+
+	b.mu.Unlock()
+	b.notify(t)
+}
+
+// refresh moves an open breaker to half-open after the cool-down and returns
+// the resulting state. The caller must hold b.mu.
+func (b *Breaker) refresh() (State, *transition) {
+	if b.state == StateOpen && !b.now().Before(b.openedAt.Add(b.coolDown)) {
+		t := b.setState(StateHalfOpen)
+		b.probes, b.probeSuccesses = 0, 0
+		return b.state, t
+	}
+	return b.state, nil
+}
+
+// open opens the breaker. The caller must hold b.mu.
+func (b *Breaker) open() *transition {
+	b.openedAt = b.now()
+	return b.setState(StateOpen)
+}
+
+// setState changes the state and returns the transition. The caller must hold b.mu.
+func (b *Breaker) setState(state State) *transition {
+	if b.state == state {
+		return nil
+	}
+	t := &transition{from: b.state, to: state}
+	b.state = state
+	b.generation++
+	return t
+}
+
+// notify reports a transition to the state change callback
+func (b *Breaker) notify(t *transition) {
+	if t != nil && b.onStateChange != nil {
+		b.onStateChange(t.from, t.to)
+	}
+}
+
+// current returns the bucket for now, recycling expired buckets. The caller must hold b.mu.
+func (b *Breaker) current() *bucket {
+	now := b.now()
+	width := b.window / windowBuckets
+	start := now.Truncate(width)
+	cur := &b.buckets[(start.UnixNano()/int64(width))%windowBuckets]
+	if !cur.start.Equal(start) {
+		*cur = bucket{start: start}
+	}
+	return cur
+}
+
+// tripped reports whether the failure rate over the window reached the
+// threshold. The caller must hold b.mu.
+func (b *Breaker) tripped() bool {
+	cutoff := b.now().Add(-b.window)
+	var successes, failures int
+	for _, bk := range b.buckets {
+		if bk.start.After(cutoff) {
+			successes += bk.successes
+			failures += bk.failures
+		}
+	}
+	total := successes + failures
+	return total >= b.minRequests && float64(failures)/float64(total) >= b.failureRate
+}
@@ -0,0 +1,204 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+var errOutage = errors.New("provider is down")
+
+// testBreaker returns a breaker on a manual clock and the transitions it reports
+func testBreaker(config configpkg.BreakerConfig) (*Breaker, *time.Time, *[]string) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var transitions []string
+	b := New(config, func(from, to State) {
+		transitions = append(transitions, fmt.Sprintf("%s→%s", from, to))
+	})
+	b.now = func() time.Time { return now }
+	return b, &now, &transitions
+}
+
+// call runs one call through the breaker that ends with err
+func call(t *testing.T, b *Breaker, err error) {
+	t.Helper()
+	done, allowErr := b.Allow()
+	if allowErr != nil {
+		t.Fatalf("Allow = %v in state %s", allowErr, b.State())
+	}
+	done(err)
+}
+
+var testConfig = configpkg.BreakerConfig{
+	FailureRate:    0.5,
+	MinRequests:    4,
+	Window:         time.Minute,
+	CoolDown:       30 * time.Second,
+	HalfOpenProbes: 2,
+}
+
+func TestBreakerOpensAtFailureRate(t *testing.T) {
+	b, _, transitions := testBreaker(testConfig)
+
+	call(t, b, nil)
+	call(t, b, errOutage)
+	call(t, b, errOutage)
+	if state := b.State(); state != StateClosed {
+		t.Fatalf("state = %s below MinRequests, want closed", state)
+	}
+	call(t, b, errOutage)
+	if state := b.State(); state != StateOpen {
+		t.Fatalf("state = %s after 3 of 4 calls failed, want open", state)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Allow = %v while open, want ErrOpen", err)
+	}
+	if got := b.RetryAfter(); got != testConfig.CoolDown {
+		t.Fatalf("RetryAfter = %v, want %v", got, testConfig.CoolDown)
+	}
+	if want := []string{"closed→open"}; !slices.Equal(*transitions, want) {
+		t.Fatalf("transitions = %v, want %v", *transitions, want)
+	}
+}
+
+func TestBreakerStaysClosedBelowFailureRate(t *testing.T) {
+	b, _, _ := testBreaker(testConfig)
+	for range 10 {
+		call(t, b, nil)
+		call(t, b, nil)
+		call(t, b, errOutage)
+	}
+	if state := b.State(); state != StateClosed {
+		t.Fatalf("state = %s with a third of calls failing, want closed", state)
+	}
+}
+
+func TestBreakerForgetsFailuresOutsideTheWindow(t *testing.T) {
+	b, now, _ := testBreaker(testConfig)
+	for range 3 {
+		call(t, b, errOutage)
+	}
+	*now = now.Add(2 * testConfig.Window)
+	call(t, b, errOutage)
+	if state := b.State(); state != StateClosed {
+		t.Fatalf("state = %s with old failures outside the window, want closed", state)
+	}
+}
+
+func TestBreakerHalfOpenProbes(t *testing.T) {
+	b, now, transitions := testBreaker(testConfig)
+	for range 4 {
+		call(t, b, errOutage)
+	}
+
+	*now = now.Add(testConfig.CoolDown)
+	if state := b.State(); state != StateHalfOpen {
+		t.Fatalf("state = %s after the cool-down, want half-open", state)
+	}
+	first, err := b.Allow()
+	if err != nil {
+		t.Fatalf("first probe: %v", err)
+	}
+	second, err := b.Allow()
+	if err != nil {
+		t.Fatalf("second probe: %v", err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("third probe = %v, want ErrOpen", err)
+	}
+
+	first(nil)
+	if state := b.State(); state != StateHalfOpen {
+		t.Fatalf("state = %s after one of two probes, want half-open", state)
+	}
+	second(nil)
+	if state := b.State(); state != StateClosed {
+		t.Fatalf("state = %s after both probes succeeded, want closed", state)
+	}
+	// The outage before opening is forgotten
+	call(t, b, errOutage)
+	if state := b.State(); state != StateClosed {
+		t.Fatalf("state = %s after one failure once closed, want closed", state)
+	}
+
+	want := []string{"closed→open", "open→half_open", "half_open→closed"}
+	if !slices.Equal(*transitions, want) {
+		t.Fatalf("transitions = %v, want %v", *transitions, want)
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	b, now, _ := testBreaker(testConfig)
+	for range 4 {
+		call(t, b, errOutage)
+	}
+	*now = now.Add(testConfig.CoolDown)
+
+	call(t, b, errOutage)
+	if state := b.State(); state != StateOpen {
+		t.Fatalf("state = %s after a failed probe, want open", state)
+	}
+	if got := b.RetryAfter(); got != testConfig.CoolDown {
+		t.Fatalf("RetryAfter = %v, want a new cool-down of %v", got, testConfig.CoolDown)
+	}
+}
+
+func TestBreakerIgnoresCancelledCalls(t *testing.T) {
+	b, now, _ := testBreaker(testConfig)
+	for range 10 {
+		call(t, b, context.Canceled)
+	}
+	if state := b.State(); state != StateClosed {
+		t.Fatalf("state = %s after cancelled calls, want closed", state)
+	}
+
+	for range 4 {
+		call(t, b, errOutage)
+	}
+	*now = now.Add(testConfig.CoolDown)
+	// A cancelled probe frees its slot
+	for range 3 {
+		call(t, b, fmt.Errorf("stream: %w", context.Canceled))
+	}
+	if state := b.State(); state != StateHalfOpen {
+		t.Fatalf("state = %s after cancelled probes, want half-open", state)
+	}
+}
+
+func TestBreakerIgnoresOutcomesOfEarlierStates(t *testing.T) {
+	b, _, _ := testBreaker(testConfig)
+	slow, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	for range 4 {
+		call(t, b, errOutage)
+	}
+
+	// A call allowed while closed does not count once the breaker opened
+	slow(nil)
+	slow(errOutage)
+	if state := b.State(); state != StateOpen {
+		t.Fatalf("state = %s, want open", state)
+	}
+}
+
+func TestNewAppliesDefaults(t *testing.T) {
+	b := New(configpkg.BreakerConfig{FailureRate: 2}, nil)
+	if b.failureRate != 0.5 || b.minRequests != 1 || b.window != time.Minute ||
+		b.coolDown != 30*time.Second || b.halfOpenProbes != 1 {
+		t.Fatalf("defaults = rate %v, min %d, window %v, cool-down %v, probes %d",
+			b.failureRate, b.minRequests, b.window, b.coolDown, b.halfOpenProbes)
+	}
+	// Without a callback transitions are not reported
+	done, _ := b.Allow()
+	done(errOutage)
+	if state := b.State(); state != StateOpen {
+		t.Fatalf("state = %s, want open", state)
+	}
+}
@@ -0,0 +1,413 @@
+// Package budget enforces soft daily token budgets and tool call quotas per
+// user. Counters reset at midnight in the configured time zone and are
+// persisted across restarts.
+package budget
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// DefaultRole is the role reported for users whose budget is the default one
+const DefaultRole = "default"
+
+// Extension is a temporary increase of a user's budget granted by an admin
+type Extension struct {
+	Tokens    int64     `json:"tokens"`
+	ExpiresAt time.Time `json:"expires_at"`
+	GrantedBy string    `json:"granted_by"`
+}
+
+// Limits are daily budgets per role and for users without a budgeted role;
+// they replace the configured ones for some users, such as the members of a
+// workspace
+type Limits struct {
+	Roles   map[string]int64
+	Default int64
+}
+
+// usage is what a user spent today, under the role their budget came from.
+// Limit is the budget of the role without extensions when other limits than
+// the configured ones applied.
+type usage struct {
+	Role   string `json:"role"`
+	Tokens int64  `json:"tokens"`
+	Limit  *int64 `json:"limit,omitempty"`
+}
+
+// state is the persisted form of a tracker
+type state struct {
+	Day        string                `json:"day"`
+	Usage      map[string]*usage     `json:"usage"`
+	Extensions map[string]*Extension `json:"extensions"`
+}
+
+// Decision is the result of a budget check
+type Decision struct {
+	Allowed bool      `json:"allowed"`
+	Role    string    `json:"role"`
+	Limit   int64     `json:"limit"` // 0 means unlimited
+	Used    int64     `json:"used"`
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// UserUsage is the budget state of one user for the admin view
+type UserUsage struct {
+	UserID    string     `json:"user_id"`
+	Role      string     `json:"role"`
+	Used      int64      `json:"used"`
+	Extension *Extension `json:"extension,omitempty"`
+}
+
+// RoleUsage is the aggregated usage of the users of a role
+type RoleUsage struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit"` // sum of the budgets of the users that spent tokens today
+	Users int   `json:"users"`
+}
+
+// Tracker accumulates the prompt and completion tokens of every user per day
+type Tracker struct {
+	mu       sync.Mutex
+	roles    map[string]int64
+	fallback int64
+	location *time.Location
+	path     string
+	state    state
+	dirty    bool // tokens charged since the last save
+	now      func() time.Time
+}
+
+// New creates a tracker and loads the counters of today from the state file.
+// It returns nil when budgets are disabled; a nil tracker allows everything.
+func New(config configpkg.BudgetConfig) (*Tracker, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	location, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid budget timezone %q: %w", config.Timezone, err)
+	}
+
+	t := &Tracker{
+		roles:    config.Roles,
+		fallback: config.Default,
+		location: location,
+		path:     config.StatePath,
+		now:      time.Now,
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	t.rollover()
+	return t, nil
+}
+
+// Check reports whether a user with the given roles may spend estimate more
+// tokens today; nil limits are the configured ones
+func (t *Tracker) Check(userID string, roles []string, estimate int64, limits *Limits) Decision {
+	if t == nil {
+		return Decision{Allowed: true}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	role, limit := t.limit(userID, roles, limits)
+	decision := Decision{
+		Allowed: true,
+		Role:    role,
+		Limit:   limit,
+		ResetAt: t.resetAt(),
+	}
+	if u := t.state.Usage[userID]; u != nil {
+		decision.Used = u.Tokens
+	}
+	if limit > 0 && decision.Used+estimate > limit {
+		decision.Allowed = false
+	}
+	return decision
+}
+
+// Add charges tokens to a user; nil limits are the configured ones. The
+// counters are persisted by the next Flush.
+func (t *Tracker) Add(userID string, roles []string, tokens int64, limits *Limits) {
+	if t == nil || tokens <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	role, _ := t.limit(userID, roles, limits)
+	u := t.state.Usage[userID]
+	if u == nil {
+		u = &usage{}
+		t.state.Usage[userID] = u
+	}
+	u.Role = role
+	u.Tokens += tokens
+	u.Limit = nil
+	if limits != nil {
+		limit := limits.roleLimit(role)
+		u.Limit = &limit
+	}
+	t.dirty = true
+}
+
+// Flush persists the counters if tokens were charged since they were last
+// saved
+func (t *Tracker) Flush() error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.dirty {
+		return nil
+	}
+	return t.save()
+}
+
+// Grant extends the budget of a user by tokens until expiresAt, replacing any
+// previous extension
+func (t *Tracker) Grant(userID string, tokens int64, expiresAt time.Time, grantedBy string) (*Extension, error) {
+	if t == nil {
+		return nil, fmt.Errorf("token budgets are disabled")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	extension := &Extension{Tokens: tokens, ExpiresAt: expiresAt, GrantedBy: grantedBy}
+	t.state.Extensions[userID] = extension
+	if err := t.save(); err != nil {
+		return nil, err
+	}
+	copied := *extension
+	return &copied, nil
+}
+
+// Users returns the usage of every user that spent tokens today or holds an
+// extension, sorted by usage
+func (t *Tracker) Users() []UserUsage {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	users := make([]UserUsage, 0, len(t.state.Usage))
+	seen := make(map[string]bool, len(t.state.Usage))
+	for userID, u := range t.state.Usage {
+		users = append(users, UserUsage{UserID: userID, Role: u.Role, Used: u.Tokens, Extension: t.extension(userID)})
+		seen[userID] = true
+	}
+	for userID := range t.state.Extensions {
+		if !seen[userID] {
+			if extension := t.extension(userID); extension != nil {
+				users = append(users, UserUsage{UserID: userID, Extension: extension})
+			}
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Used != users[j].Used {
+			return users[i].Used > users[j].Used
+		}
+		return users[i].UserID < users[j].UserID
+	})
+	return users
+}
+
+// Roles returns the usage per role. Every configured role is included, so
+// gauges drop back to zero when a new day starts.
+func (t *Tracker) Roles() map[string]RoleUsage {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	roles := make(map[string]RoleUsage, len(t.roles)+1)
+	roles[DefaultRole] = RoleUsage{}
+	for role := range t.roles {
+		roles[role] = RoleUsage{}
+	}
+	for userID, u := range t.state.Usage {
+		r := roles[u.Role]
+		r.Used += u.Tokens
+		r.Users++
+		limit := t.roleLimit(u.Role)
+		if u.Limit != nil {
+			limit = *u.Limit
+		}
+		if limit > 0 {
+			r.Limit += limit + t.extensionTokens(userID)
+		}
+		roles[u.Role] = r
+	}
+	return roles
+}
+
+// ResetAt returns when the current budget day ends
+func (t *Tracker) ResetAt() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.resetAt()
+}
+
+// limit returns the role a user's budget comes from and the budget including
+// extensions. The most generous role wins; 0 means unlimited. The caller must hold t.mu.
+func (t *Tracker) limit(userID string, roles []string, limits *Limits) (string, int64) {
+	if limits == nil {
+		limits = &Limits{Roles: t.roles, Default: t.fallback}
+	}
+	role, limit, matched := DefaultRole, limits.Default, false
+	for _, r := range roles {
+		l, ok := limits.Roles[r]
+		if !ok {
+			continue
+		}
+		if !matched || l == 0 || l > limit {
+			role, limit = r, l
+		}
+		matched = true
+		if l == 0 {
+			break
+		}
+	}
+	if limit == 0 {
+		return role, 0
+	}
+	return role, limit + t.extensionTokens(userID)
+}
+
+// roleLimit returns the configured budget of a role. The caller must hold t.mu.
+func (t *Tracker) roleLimit(role string) int64 {
+	return (&Limits{Roles: t.roles, Default: t.fallback}).roleLimit(role)
+}
+
+// roleLimit returns the budget of a role
+func (l *Limits) roleLimit(role string) int64 {
+	if limit, ok := l.Roles[role]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// extension returns a copy of the unexpired extension of a user. The caller must hold t.mu.
+func (t *Tracker) extension(userID string) *Extension {
+	extension := t.state.Extensions[userID]
+	if extension == nil || !t.now().Before(extension.ExpiresAt) {
+		return nil
+	}
+	copied := *extension
+	return &copied
+}
+
+// extensionTokens returns the tokens of the unexpired extension of a user. The caller must hold t.mu.
+func (t *Tracker) extensionTokens(userID string) int64 {
+	if extension := t.extension(userID); extension != nil {
+		return extension.Tokens
+	}
+	return 0
+}
+
+// today returns the current day in the budget time zone
+func (t *Tracker) today() string {
+	return t.now().In(t.location).Format(time.DateOnly)
+}
+
+// resetAt returns the next midnight in the budget time zone
+func (t *Tracker) resetAt() time.Time {
+	now := t.now().In(t.location)
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, t.location)
+}
+
+// rollover clears the counters and expired extensions when a new day has
+// started. The caller must hold t.mu.
+func (t *Tracker) rollover() {
+	if t.state.Usage == nil {
+		t.state.Usage = make(map[string]*usage)
+	}
+	if t.state.Extensions == nil {
+		t.state.Extensions = make(map[string]*Extension)
+	}
+
+	today := t.today()
+	if t.state.Day == today {
+		return
+	}
+	t.state.Day = today
+	t.state.Usage = make(map[string]*usage)
+	for userID, extension := range t.state.Extensions {
+		if !t.now().Before(extension.ExpiresAt) {
+			delete(t.state.Extensions, userID)
+		}
+	}
+}
+
+// load reads the state file, if any
+func (t *Tracker) load() error {
+	data, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read budget state: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.state); err != nil {
+		return fmt.Errorf("failed to unmarshal budget state: %w", err)
+	}
+	return nil
+}
+
+// save writes the state file atomically. The caller must hold t.mu.
+func (t *Tracker) save() error {
+	if err := writeState(t.path, t.state, "budget"); err != nil {
+		return err
+	}
+	t.dirty = false
+	return nil
+}
+
+// writeState writes a state file atomically; what names the state in errors
+func writeState(path string, state any, what string) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s state: %w", what, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s state directory: %w", what, err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s state: %w", what, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s state: %w", what, err)
+	}
+	return nil
+}
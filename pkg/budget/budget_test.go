@@ -0,0 +1,98 @@
+package budget
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+func TestAddIsPersistedByFlush(t *testing.T) {
+	config := configpkg.BudgetConfig{
+		Enabled:   true,
+		Default:   1000,
+		Timezone:  "UTC",
+		StatePath: filepath.Join(t.TempDir(), "budget.json"),
+	}
+	tracker, err := New(config)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// Turns only charge the counters in memory
+	for range 3 {
+		tracker.Add("alice", nil, 100, nil)
+	}
+	if _, err := os.Stat(config.StatePath); !os.IsNotExist(err) {
+		t.Fatalf("state file after Add: %v, want none before a flush", err)
+	}
+	if decision := tracker.Check("alice", nil, 0, nil); decision.Used != 300 {
+		t.Fatalf("used = %d, want 300", decision.Used)
+	}
+
+	if err := tracker.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	info, err := os.Stat(config.StatePath)
+	if err != nil {
+		t.Fatalf("state file after Flush: %v", err)
+	}
+	// Without new charges, nothing is written again
+	modified := info.ModTime().Add(-time.Hour)
+	if err := os.Chtimes(config.StatePath, modified, modified); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	if err := tracker.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if info, err := os.Stat(config.StatePath); err != nil || !info.ModTime().Equal(modified) {
+		t.Fatalf("state file rewritten by a flush without charges: %v", err)
+	}
+
+	reloaded, err := New(config)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if decision := reloaded.Check("alice", nil, 701, nil); decision.Used != 300 || decision.Allowed {
+		t.Fatalf("after a restart %+v, want 300 used of the 1000", decision)
+	}
+}
+
+func TestGrantSavesImmediately(t *testing.T) {
+	config := configpkg.BudgetConfig{
+		Enabled:   true,
+		Default:   1000,
+		Timezone:  "UTC",
+		StatePath: filepath.Join(t.TempDir(), "budget.json"),
+	}
+	tracker, err := New(config)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	tracker.Add("alice", nil, 200, nil)
+	if _, err := tracker.Grant("alice", 500, time.Now().Add(time.Hour), "admin"); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+
+	// The grant saves the charged tokens too
+	reloaded, err := New(config)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if decision := reloaded.Check("alice", nil, 0, nil); decision.Used != 200 || decision.Limit != 1500 {
+		t.Fatalf("after a restart %+v, want 200 used of 1500", decision)
+	}
+}
+
+func TestNilTracker(t *testing.T) {
+	var tracker *Tracker
+	tracker.Add("alice", nil, 100, nil)
+	if err := tracker.Flush(); err != nil {
+		t.Fatalf("Flush of a nil tracker: %v", err)
+	}
+	if decision := tracker.Check("alice", nil, 100, nil); !decision.Allowed {
+		t.Fatalf("nil tracker denied %+v", decision)
+	}
+}
@@ -0,0 +1,258 @@
+package budget
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// Scopes of tool quotas
+const (
+	ScopeSession = "session"
+	ScopeDay     = "day"
+)
+
+// AnyTool is the key of the quota of tools without their own quota
+const AnyTool = "*"
+
+// sessionCalls are the tool calls made in a session
+type sessionCalls struct {
+	UserID string         `json:"user_id"`
+	Calls  map[string]int `json:"calls"`
+}
+
+// toolState is the persisted form of a tool tracker. Daily counters are
+// cleared when a new day starts, session counters when the session is deleted.
+type toolState struct {
+	Day      string                    `json:"day"`
+	Daily    map[string]map[string]int `json:"daily"` // user -> tool -> calls today
+	Sessions map[string]*sessionCalls  `json:"sessions"`
+}
+
+// ToolDecision is the result of a tool quota check
+type ToolDecision struct {
+	Allowed bool      `json:"allowed"`
+	Scope   string    `json:"scope,omitempty"` // quota that refused the call
+	Limit   int       `json:"limit,omitempty"`
+	Used    int       `json:"used,omitempty"`
+	ResetAt time.Time `json:"reset_at"` // set when the daily quota refused the call
+}
+
+// ToolUsage is the consumption of a tool by one user for the admin view
+type ToolUsage struct {
+	UserID        string         `json:"user_id"`
+	Tool          string         `json:"tool"`
+	Today         int            `json:"today"`
+	PerUserPerDay int            `json:"per_user_per_day"` // 0 means unlimited
+	Sessions      map[string]int `json:"sessions,omitempty"`
+	PerSession    int            `json:"per_session"` // 0 means unlimited
+}
+
+// ToolTracker counts tool calls per session and per user per day
+type ToolTracker struct {
+	mu       sync.Mutex
+	limits   map[string]configpkg.ToolQuota
+	location *time.Location
+	path     string
+	state    toolState
+	now      func() time.Time
+}
+
+// NewToolTracker creates a tool tracker and loads the counters from the state
+// file. It returns nil when tool quotas are disabled; a nil tracker allows every call.
+func NewToolTracker(config configpkg.ToolQuotaConfig) (*ToolTracker, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	location, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tool quota timezone %q: %w", config.Timezone, err)
+	}
+
+	t := &ToolTracker{
+		limits:   config.Limits,
+		location: location,
+		path:     config.StatePath,
+		now:      time.Now,
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	t.rollover()
+	return t, nil
+}
+
+// Use counts a call of a tool if the quotas of the session and the user allow
+// it. The decision is valid even when saving the counters fails.
+func (t *ToolTracker) Use(userID, sessionID, tool string) (ToolDecision, error) {
+	if t == nil {
+		return ToolDecision{Allowed: true}, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	quota := t.quota(tool)
+	session := t.state.Sessions[sessionID]
+	if used := session.count(tool); quota.PerSession > 0 && used >= quota.PerSession {
+		return ToolDecision{Scope: ScopeSession, Limit: quota.PerSession, Used: used}, nil
+	}
+	if used := t.state.Daily[userID][tool]; quota.PerUserPerDay > 0 && used >= quota.PerUserPerDay {
+		return ToolDecision{Scope: ScopeDay, Limit: quota.PerUserPerDay, Used: used, ResetAt: t.resetAt()}, nil
+	}
+
+	if session == nil {
+		session = &sessionCalls{UserID: userID, Calls: make(map[string]int)}
+		t.state.Sessions[sessionID] = session
+	}
+	session.Calls[tool]++
+	if t.state.Daily[userID] == nil {
+		t.state.Daily[userID] = make(map[string]int)
+	}
+	t.state.Daily[userID][tool]++
+	return ToolDecision{Allowed: true}, t.save()
+}
+
+// ForgetSession drops the counters of a deleted session
+func (t *ToolTracker) ForgetSession(sessionID string) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.state.Sessions[sessionID]; !ok {
+		return nil
+	}
+	delete(t.state.Sessions, sessionID)
+	return t.save()
+}
+
+// Usage returns the consumption of every tool a user called today or in a
+// session that still exists, sorted by user and tool
+func (t *ToolTracker) Usage() []ToolUsage {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	type key struct{ userID, tool string }
+	usages := make(map[key]*ToolUsage)
+	entry := func(userID, tool string) *ToolUsage {
+		k := key{userID, tool}
+		if u := usages[k]; u != nil {
+			return u
+		}
+		quota := t.quota(tool)
+		u := &ToolUsage{UserID: userID, Tool: tool, PerUserPerDay: quota.PerUserPerDay, PerSession: quota.PerSession}
+		usages[k] = u
+		return u
+	}
+	for userID, calls := range t.state.Daily {
+		for tool, n := range calls {
+			entry(userID, tool).Today = n
+		}
+	}
+	for sessionID, session := range t.state.Sessions {
+		for tool, n := range session.Calls {
+			u := entry(session.UserID, tool)
+			if u.Sessions == nil {
+				u.Sessions = make(map[string]int)
+			}
+			u.Sessions[sessionID] = n
+		}
+	}
+
+	result := make([]ToolUsage, 0, len(usages))
+	for _, u := range usages {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].UserID != result[j].UserID {
+			return result[i].UserID < result[j].UserID
+		}
+		return result[i].Tool < result[j].Tool
+	})
+	return result
+}
+
+// ResetAt returns when the daily counters are reset
+func (t *ToolTracker) ResetAt() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.resetAt()
+}
+
+// quota returns the quota of a tool, falling back to the quota of AnyTool
+func (t *ToolTracker) quota(tool string) configpkg.ToolQuota {
+	if quota, ok := t.limits[tool]; ok {
+		return quota
+	}
+	return t.limits[AnyTool]
+}
+
+// count returns how often a tool was called in the session
+func (s *sessionCalls) count(tool string) int {
+	if s == nil {
+		return 0
+	}
+	return s.Calls[tool]
+}
+
+// resetAt returns the next midnight in the quota time zone
+func (t *ToolTracker) resetAt() time.Time {
+	now := t.now().In(t.location)
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, t.location)
+}
+
+// rollover clears the daily counters when a new day has started. The caller must hold t.mu.
+func (t *ToolTracker) rollover() {
+	if t.state.Daily == nil {
+		t.state.Daily = make(map[string]map[string]int)
+	}
+	if t.state.Sessions == nil {
+		t.state.Sessions = make(map[string]*sessionCalls)
+	}
+
+	today := t.now().In(t.location).Format(time.DateOnly)
+	if t.state.Day == today {
+		return
+	}
+	t.state.Day = today
+	t.state.Daily = make(map[string]map[string]int)
+}
+
+// load reads the state file, if any
+func (t *ToolTracker) load() error {
+	data, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read tool quota state: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.state); err != nil {
+		return fmt.Errorf("failed to unmarshal tool quota state: %w", err)
+	}
+	return nil
+}
+
+// save writes the state file atomically. The caller must hold t.mu.
+func (t *ToolTracker) save() error {
+	return writeState(t.path, t.state, "tool quota")
+}
@@ -0,0 +1,114 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/middleware"
+	"github.com/smallnest/langchat/pkg/workspace"
+)
+
+// defaultHeatmapDays is the number of days of the activity heatmap when the
+// request sets none
+const defaultHeatmapDays = 28
+
+// trackActivity records when the user of an authenticated request was last seen
+func (cs *ChatServer) trackActivity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
+			cs.activity.Seen(workspace.UserKey(claims.Workspace, claims.UserID))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startActivityFlusher persists changed activity every interval until ctx is done
+func (cs *ChatServer) startActivityFlusher(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := cs.activity.Flush(); err != nil {
+					log.Printf("Warning: Failed to save activity: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// HandleActivity returns the messages of all users per weekday and hour over
+// the last days query parameter days, 28 by default, and when each user was
+// last seen and sent a message. Only counts and times are returned; in
+// privacy mode the user IDs are hashed as in exports.
+func (cs *ChatServer) HandleActivity(w http.ResponseWriter, r *http.Request) {
+	if cs.activity == nil {
+		http.Error(w, "Activity tracking is disabled", http.StatusNotFound)
+		return
+	}
+	private, err := cs.exportPrivacy(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	days := defaultHeatmapDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			http.Error(w, "days must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	users := cs.activity.Users()
+	if private {
+		for i := range users {
+			users[i].UserID = cs.privacy.ID(users[i].UserID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"heatmap": cs.activity.Heatmap(days),
+		"users":   users,
+		"privacy": private,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode activity: %v", err)
+	}
+}
+
+// HandleUserActivity returns when a user was last seen and sent a message,
+// and their messages per hour of each day of the retention period
+func (cs *ChatServer) HandleUserActivity(w http.ResponseWriter, r *http.Request) {
+	if cs.activity == nil {
+		http.Error(w, "Activity tracking is disabled", http.StatusNotFound)
+		return
+	}
+	private, err := cs.exportPrivacy(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	activity, ok := cs.activity.User(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "No activity recorded for this user", http.StatusNotFound)
+		return
+	}
+	if private {
+		activity.UserID = cs.privacy.ID(activity.UserID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(activity); err != nil {
+		log.Printf("Warning: Failed to encode user activity: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/audit"
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// AdminEvent is a notification pushed to admin dashboards
+type AdminEvent struct {
+	Type string    `json:"type"` // e.g. "config_reload"
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// adminEventHub fans out admin events to connected SSE clients
+type adminEventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan AdminEvent]struct{}
+}
+
+// subscribe registers a new subscriber
+func (h *adminEventHub) subscribe() chan AdminEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan AdminEvent]struct{})
+	}
+	ch := make(chan AdminEvent, 16)
+	h.subscribers[ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe removes a subscriber
+func (h *adminEventHub) unsubscribe(ch chan AdminEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, ch)
+}
+
+// publish sends an event to all subscribers without blocking on slow clients
+func (h *adminEventHub) publish(event AdminEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Subscriber is not keeping up, drop the event
+		}
+	}
+}
+
+// handleConfigReload records a configuration reload attempt
+func (cs *ChatServer) handleConfigReload(event configpkg.ReloadEvent) {
+	cs.metricsCollector.RecordConfigReload(event.Result)
+
+	paths := make([]string, 0, len(event.Changes))
+	for _, change := range event.Changes {
+		paths = append(paths, change.Path)
+	}
+
+	if event.Result == "success" {
+		cs.metricsCollector.SetConfigHash(event.Hash)
+		cs.reloadConfig()
+		cs.reloadPrompts()
+		log.Printf("config_reload result=success hash=%s changed=%d fields=[%s]", event.Hash, len(event.Changes), strings.Join(paths, ","))
+	} else {
+		log.Printf("config_reload result=failure hash=%s error=%q", event.Hash, event.Error)
+	}
+
+	cs.auditLogger.Log(audit.Event{
+		Timestamp: event.Time,
+		Action:    "config.reload",
+		Actor:     "system",
+		Result:    event.Result,
+		Details: map[string]any{
+			"hash":    event.Hash,
+			"error":   event.Error,
+			"changes": event.Changes,
+		},
+	})
+
+	cs.adminEvents.publish(AdminEvent{Type: "config_reload", Time: event.Time, Data: event})
+}
+
+// HandleAdminEvents streams admin notifications (e.g. config reloads) using SSE
+func (cs *ChatServer) HandleAdminEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	events := cs.adminEvents.subscribe()
+	defer cs.adminEvents.unsubscribe(events)
+
+	fmt.Fprintf(w, "event: start\ndata: {\"type\": \"start\"}\n\n")
+	flusher.Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-cs.shutdown:
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Warning: Failed to encode admin event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	agentpkg "github.com/smallnest/langchat/pkg/agent"
+)
+
+// recordState records a lifecycle event of the agent in its event log
+func (a *SimpleChatAgent) recordState(state agentpkg.AgentState, message string, err error) {
+	a.events.Record(agentpkg.LifecycleEvent{
+		Timestamp: time.Now(),
+		EventType: "state_change",
+		State:     state,
+		Message:   message,
+		Error:     err,
+	})
+}
+
+// HandleAgentEvents returns the last lifecycle events of the agent of a
+// session held in memory, with the time it spent in each state
+func (cs *ChatServer) HandleAgentEvents(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("sessionID")
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
+
+	cs.agentMu.RLock()
+	agent, _ := cs.agents[sessionID].(*SimpleChatAgent)
+	cs.agentMu.RUnlock()
+	if agent == nil {
+		http.Error(w, "no agent of the session is in memory", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		SessionID string `json:"session_id"`
+		agentpkg.StateHistory
+	}{sessionID, agent.events.History(time.Now())}); err != nil {
+		log.Printf("Warning: Failed to encode agent events response: %v", err)
+	}
+}
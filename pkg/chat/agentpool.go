@@ -0,0 +1,165 @@
+package chat
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	monitoringpkg "github.com/smallnest/langchat/pkg/monitoring"
+)
+
+// poolBuildTimeout bounds the tool loading of a single pooled agent
+const poolBuildTimeout = 2 * time.Minute
+
+// pooledAgent is a warm agent together with the time it took to build
+type pooledAgent struct {
+	agent     *SimpleChatAgent
+	buildTime time.Duration
+}
+
+// agentPool keeps pre-constructed agents ready so the first message of a new
+// session does not pay for agent construction and tool loading. A background
+// filler tops the pool up whenever an agent is taken.
+type agentPool struct {
+	agents   chan pooledAgent
+	build    func() *SimpleChatAgent
+	preload  bool // load tools before an agent enters the pool
+	metrics  *monitoringpkg.MetricsCollector
+	wake     chan struct{}
+	ctx      context.Context // cancelled when the pool is closed
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// newAgentPool creates a pool of size agents built by build. When preload is
+// set, tools are loaded before an agent enters the pool; otherwise the caller
+// loads them after taking the agent, e.g. because they depend on the session.
+func newAgentPool(size int, build func() *SimpleChatAgent, preload bool, metrics *monitoringpkg.MetricsCollector) *agentPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &agentPool{
+		agents:  make(chan pooledAgent, size),
+		build:   build,
+		preload: preload,
+		metrics: metrics,
+		wake:    make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// start runs the background filler
+func (p *agentPool) start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for {
+			p.fill()
+			select {
+			case <-p.wake:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// fill builds agents until the pool is full, one at a time so tool loading
+// does not compete with live sessions
+func (p *agentPool) fill() {
+	for len(p.agents) < cap(p.agents) {
+		select {
+		case <-p.ctx.Done():
+			return
+		default:
+		}
+
+		start := time.Now()
+		agent := p.build()
+		if p.preload {
+			agent.InitializeToolsAsync()
+			ctx, cancel := context.WithTimeout(p.ctx, poolBuildTimeout)
+			err := agent.WaitReady(ctx)
+			cancel()
+			if err != nil {
+				log.Printf("Warning: Pooled agent tools did not load in time: %v", err)
+			}
+		}
+
+		select {
+		case p.agents <- pooledAgent{agent: agent, buildTime: time.Since(start)}:
+			p.metrics.SetAgentPoolSize(len(p.agents))
+		case <-p.ctx.Done():
+			closeAgent(agent)
+			return
+		}
+	}
+}
+
+// get takes a warm agent from the pool without blocking
+func (p *agentPool) get() (*SimpleChatAgent, bool) {
+	select {
+	case pooled := <-p.agents:
+		p.metrics.SetAgentPoolSize(len(p.agents))
+		p.metrics.RecordAgentPoolRequest("hit", pooled.buildTime)
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+		pooled.agent.Reset()
+		return pooled.agent, true
+	default:
+		p.metrics.RecordAgentPoolRequest("miss", 0)
+		return nil, false
+	}
+}
+
+// each calls fn for every agent waiting in the pool, e.g. to apply a change
+// of the installed skills. Agents taken meanwhile are not visited.
+func (p *agentPool) each(fn func(*SimpleChatAgent)) {
+	var waiting []pooledAgent
+	for {
+		select {
+		case pooled := <-p.agents:
+			waiting = append(waiting, pooled)
+			continue
+		default:
+		}
+		break
+	}
+	for _, pooled := range waiting {
+		fn(pooled.agent)
+		select {
+		case p.agents <- pooled:
+		default:
+			// The filler refilled the pool meanwhile
+			closeAgent(pooled.agent)
+		}
+	}
+	p.metrics.SetAgentPoolSize(len(p.agents))
+}
+
+// close stops the filler and releases the agents left in the pool
+func (p *agentPool) close() {
+	p.stopOnce.Do(func() {
+		p.cancel()
+		p.wg.Wait()
+		for {
+			select {
+			case pooled := <-p.agents:
+				closeAgent(pooled.agent)
+			default:
+				p.metrics.SetAgentPoolSize(0)
+				return
+			}
+		}
+	})
+}
+
+// closeAgent releases an agent, logging failures
+func closeAgent(agent *SimpleChatAgent) {
+	if err := agent.Close(); err != nil {
+		log.Printf("Warning: Failed to close pooled agent: %v", err)
+	}
+}
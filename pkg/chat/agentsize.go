@@ -0,0 +1,266 @@
+package chat
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// Rough per-item costs of the agent memory estimate, in bytes. The estimate
+// only has to rank agents and show trends, not match the heap.
+const (
+	messageOverhead = 64   // a message and its part slice, beside the content
+	toolOverhead    = 1024 // a tool value with its name, description and client
+	schemaOverhead  = 512  // a parameter schema, raw or compiled
+)
+
+// agentSweepInterval is how often idle agents are looked for
+const agentSweepInterval = time.Minute
+
+// evictGrace is how long an agent must be idle before the memory budget may
+// evict it ahead of the idle timeout
+const evictGrace = time.Minute
+
+// agentSize is the memory estimate of an agent, with what it was computed from
+type agentSize struct {
+	messages int   // number of messages
+	tools    int   // number of tools and schemas
+	bytes    int64 // estimated bytes
+}
+
+// EstimateSize returns a cheap estimate of the memory an agent holds, in
+// bytes: its history, loaded skill and MCP tools and cached tool schemas.
+// The estimate is recomputed only when the number of messages or tools has
+// changed. While a turn holds the agent, the last estimate is returned
+// rather than waiting for the turn to finish.
+func (a *SimpleChatAgent) EstimateSize() int64 {
+	if !a.mu.TryRLock() {
+		a.sizeMu.Lock()
+		defer a.sizeMu.Unlock()
+		return a.size.bytes
+	}
+	defer a.mu.RUnlock()
+
+	tools := len(a.mcpTools) + len(a.toolSchemas) + len(a.compiledSchemas)
+	for _, skill := range a.skills {
+		tools += len(skill.Tools)
+	}
+
+	a.sizeMu.Lock()
+	defer a.sizeMu.Unlock()
+	if a.size.bytes > 0 && a.size.messages == len(a.messages) && a.size.tools == tools {
+		return a.size.bytes
+	}
+
+	var bytes int64
+	for _, msg := range a.messages {
+		bytes += messageOverhead
+		for _, part := range msg.Parts {
+			bytes += partSize(part)
+		}
+	}
+	for _, skill := range a.skills {
+		if skill.Package != nil {
+			bytes += int64(len(skill.Package.Body))
+		}
+	}
+	bytes += int64(tools-len(a.toolSchemas)-len(a.compiledSchemas)) * toolOverhead
+	bytes += int64(len(a.toolSchemas)+len(a.compiledSchemas)) * schemaOverhead
+
+	a.size = agentSize{messages: len(a.messages), tools: tools, bytes: bytes}
+	return bytes
+}
+
+// partSize returns the size of the content of a message part
+func partSize(part llms.ContentPart) int64 {
+	switch p := part.(type) {
+	case llms.TextContent:
+		return int64(len(p.Text))
+	case llms.ImageURLContent:
+		return int64(len(p.URL))
+	case llms.BinaryContent:
+		return int64(len(p.Data))
+	case llms.ToolCall:
+		if p.FunctionCall != nil {
+			return int64(len(p.FunctionCall.Name) + len(p.FunctionCall.Arguments))
+		}
+	case llms.ToolCallResponse:
+		return int64(len(p.Content))
+	}
+	return 0
+}
+
+// touch records that the agent was just used
+func (a *SimpleChatAgent) touch() {
+	a.lastUsed.Store(time.Now().UnixNano())
+}
+
+// touchAgent records that a session agent was just used
+func touchAgent(agent ChatAgent) {
+	if simpleAgent, ok := agent.(*SimpleChatAgent); ok {
+		simpleAgent.touch()
+	}
+}
+
+// idleFor returns how long the agent has not been used
+func (a *SimpleChatAgent) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, a.lastUsed.Load()))
+}
+
+// agentUsage is the memory estimate of the agent of a session
+type agentUsage struct {
+	SessionID      string  `json:"session_id"`
+	EstimatedBytes int64   `json:"estimated_bytes"`
+	Messages       int     `json:"messages"`
+	Tools          int     `json:"tools"`
+	IdleSeconds    float64 `json:"idle_seconds"`
+
+	agent *SimpleChatAgent
+}
+
+// agentUsages returns the memory estimates of the session agents, largest
+// first, and their total, which is also reported as a metric
+func (cs *ChatServer) agentUsages() ([]agentUsage, int64) {
+	cs.agentMu.RLock()
+	agents := make(map[string]*SimpleChatAgent, len(cs.agents))
+	for sessionID, agent := range cs.agents {
+		if simpleAgent, ok := agent.(*SimpleChatAgent); ok {
+			agents[sessionID] = simpleAgent
+		}
+	}
+	cs.agentMu.RUnlock()
+
+	now := time.Now()
+	var total int64
+	usages := make([]agentUsage, 0, len(agents))
+	for sessionID, agent := range agents {
+		bytes := agent.EstimateSize()
+		agent.sizeMu.Lock()
+		size := agent.size
+		agent.sizeMu.Unlock()
+		usages = append(usages, agentUsage{
+			SessionID:      sessionID,
+			EstimatedBytes: bytes,
+			Messages:       size.messages,
+			Tools:          size.tools,
+			IdleSeconds:    agent.idleFor(now).Seconds(),
+			agent:          agent,
+		})
+		total += bytes
+	}
+	slices.SortFunc(usages, func(a, b agentUsage) int { return cmp.Compare(b.EstimatedBytes, a.EstimatedBytes) })
+
+	cs.metricsCollector.SetAgentMemoryEstimate(total)
+	return usages, total
+}
+
+// evictIdleAgents closes the session agents idle longer than the session
+// timeout and, while the estimated memory of all agents exceeds the memory
+// budget, the largest agents idle for at least evictGrace. The session itself
+// is kept; as after a restart, its next turn gets a new agent without the
+// earlier conversation as context.
+func (cs *ChatServer) evictIdleAgents() {
+	config := cs.GetConfig().Agent
+	timeout, budget := config.SessionTimeout, config.MemoryBudget
+	if timeout <= 0 && budget <= 0 {
+		return
+	}
+
+	usages, total := cs.agentUsages()
+	now := time.Now()
+	for _, usage := range usages {
+		idle := usage.agent.idleFor(now)
+		expired := timeout > 0 && idle > timeout
+		overBudget := budget > 0 && total > budget && idle > evictGrace
+		if !expired && !overBudget {
+			continue
+		}
+		if !cs.evictAgent(usage.SessionID, usage.agent) {
+			continue
+		}
+		total -= usage.EstimatedBytes
+		log.Printf("Evicted idle agent of session %s (~%d bytes, idle %v)", redact.LogID(usage.SessionID), usage.EstimatedBytes, idle.Round(time.Second))
+	}
+	cs.metricsCollector.SetAgentMemoryEstimate(total)
+
+	cs.agentMu.RLock()
+	cs.reportAgentCapacityLocked()
+	cs.agentMu.RUnlock()
+}
+
+// evictAgent drops the agent of a session and closes it, unless the agent
+// was replaced or is answering a turn
+func (cs *ChatServer) evictAgent(sessionID string, agent *SimpleChatAgent) bool {
+	cs.agentMu.Lock()
+	if current, ok := cs.agents[sessionID]; !ok || current != ChatAgent(agent) {
+		cs.agentMu.Unlock()
+		return false
+	}
+	if !agent.mu.TryLock() {
+		cs.agentMu.Unlock()
+		return false
+	}
+	agent.mu.Unlock()
+	delete(cs.agents, sessionID)
+	cs.agentMu.Unlock()
+
+	go func() {
+		if err := agent.Close(); err != nil {
+			log.Printf("Error closing evicted agent of session %s: %v", redact.LogID(sessionID), err)
+		}
+	}()
+	return true
+}
+
+// startAgentSweeper evicts idle agents every agentSweepInterval until ctx is done
+func (cs *ChatServer) startAgentSweeper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(agentSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cs.evictIdleAgents()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// HandleListAgents returns the session agents using the most memory by
+// estimate, largest first: at most the limit query parameter, 20 by default
+func (cs *ChatServer) HandleListAgents(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	usages, total := cs.agentUsages()
+	count := len(usages)
+	usages = usages[:min(limit, len(usages))]
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"total_estimated_bytes": total,
+		"memory_budget":         cs.GetConfig().Agent.MemoryBudget,
+		"count":                 count,
+		"agents":                usages,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode agent list response: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tmc/langchaingo/llms"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// idleAgent adds a session agent holding n messages of size bytes of text,
+// last used idle ago, and returns its session ID
+func idleAgent(cs *ChatServer, n, size int, idle time.Duration) (string, *SimpleChatAgent) {
+	agent := cs.newAgent()
+	for range n {
+		agent.messages = append(agent.messages, llms.TextParts(llms.ChatMessageTypeHuman, strings.Repeat("x", size)))
+	}
+	agent.lastUsed.Store(time.Now().Add(-idle).UnixNano())
+	sessionID := sessionpkg.UUIDGenerator.NewID()
+	cs.agentMu.Lock()
+	cs.agents[sessionID] = agent
+	cs.agentMu.Unlock()
+	return sessionID, agent
+}
+
+// gaugeValue returns the value of the gauge with the given labels
+func gaugeValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if want, ok := labels[label.GetName()]; ok && want != label.GetValue() {
+					continue metrics
+				}
+			}
+			return metric.GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestEstimateSizeGrowsWithHistory(t *testing.T) {
+	cs := newTestServer(t)
+	agent := cs.newAgent()
+	last := agent.EstimateSize()
+	for i := range 5 {
+		agent.messages = append(agent.messages,
+			llms.TextParts(llms.ChatMessageTypeHuman, strings.Repeat("q", 100)),
+			llms.MessageContent{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{
+				llms.ToolCallResponse{ToolCallID: "call", Name: "search", Content: strings.Repeat("r", 1000)},
+			}},
+		)
+		size := agent.EstimateSize()
+		if size <= last {
+			t.Fatalf("estimate after %d turns = %d, want more than %d", i+1, size, last)
+		}
+		last = size
+	}
+	if last < 5*1100 {
+		t.Fatalf("estimate = %d, want at least the %d bytes of content", last, 5*1100)
+	}
+
+	// Loaded tools and cached schemas count too
+	agent.mcpTools = append(agent.mcpTools, &faultTool{})
+	if size := agent.EstimateSize(); size != last+toolOverhead {
+		t.Fatalf("estimate with a tool = %d, want %d", size, last+toolOverhead)
+	}
+
+	// A turn in progress gets the last estimate without waiting
+	agent.mu.Lock()
+	agent.messages = append(agent.messages, llms.TextParts(llms.ChatMessageTypeHuman, "more"))
+	size := agent.EstimateSize()
+	agent.mu.Unlock()
+	if size != last+toolOverhead {
+		t.Fatalf("estimate during a turn = %d, want the last estimate %d", size, last+toolOverhead)
+	}
+}
+
+func TestEvictIdleAgents(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		budget      int64
+		wantEvicted []string
+	}{
+		{name: "disabled", wantEvicted: nil},
+		{name: "idle timeout", timeout: time.Hour, wantEvicted: []string{"expired"}},
+		{name: "memory budget evicts the largest idle first", budget: 40_000, wantEvicted: []string{"large"}},
+		{name: "memory budget far exceeded", budget: 1, wantEvicted: []string{"expired", "large", "small"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := newTestServer(t)
+			config := *cs.GetConfig()
+			config.Agent.SessionTimeout, config.Agent.MemoryBudget = tt.timeout, tt.budget
+			cs.config.Store(&config)
+
+			names := map[string]string{}
+			add := func(name string, n int, idle time.Duration) *SimpleChatAgent {
+				sessionID, agent := idleAgent(cs, n, 1000, idle)
+				names[sessionID] = name
+				return agent
+			}
+			add("expired", 1, 2*time.Hour)
+			add("large", 20, 5*time.Minute)
+			add("small", 5, 5*time.Minute)
+			add("recent", 30, time.Second)
+			busy := add("busy", 40, 3*time.Hour)
+			busy.mu.Lock()
+			cs.evictIdleAgents()
+			busy.mu.Unlock()
+
+			var evicted []string
+			for sessionID, name := range names {
+				if _, ok := cs.agents[sessionID]; !ok {
+					evicted = append(evicted, name)
+				}
+			}
+			slices.Sort(evicted)
+			if !slices.Equal(evicted, tt.wantEvicted) {
+				t.Fatalf("evicted %v, want %v", evicted, tt.wantEvicted)
+			}
+			if tt.timeout > 0 || tt.budget > 0 {
+				_, total := cs.agentUsages()
+				if got := gaugeValue(t, "agent_memory_estimated_bytes", nil); got != float64(total) {
+					t.Fatalf("agent_memory_estimated_bytes = %v, want %d", got, total)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleListAgents(t *testing.T) {
+	cs := newTestServer(t)
+	small, _ := idleAgent(cs, 1, 10, 0)
+	large, largeAgent := idleAgent(cs, 10, 1000, 0)
+	medium, _ := idleAgent(cs, 5, 100, 0)
+
+	list := func(query string) (int, []agentUsage, int) {
+		w := httptest.NewRecorder()
+		cs.HandleListAgents(w, httptest.NewRequest(http.MethodGet, "/api/admin/agents"+query, nil))
+		var body struct {
+			Count  int          `json:"count"`
+			Agents []agentUsage `json:"agents"`
+		}
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+		}
+		return w.Code, body.Agents, body.Count
+	}
+
+	code, agents, count := list("")
+	var ids []string
+	for _, agent := range agents {
+		ids = append(ids, agent.SessionID)
+	}
+	if code != http.StatusOK || count != 3 || !slices.Equal(ids, []string{large, medium, small}) {
+		t.Fatalf("agents = %d %v (count %d), want all three largest first", code, ids, count)
+	}
+	if agents[0].Messages != len(largeAgent.messages) || agents[0].EstimatedBytes <= agents[1].EstimatedBytes {
+		t.Fatalf("largest agent = %+v", agents[0])
+	}
+	if _, agents, count := list("?limit=1"); len(agents) != 1 || agents[0].SessionID != large || count != 3 {
+		t.Fatalf("limit=1 listed %+v of %d, want the largest of 3", agents, count)
+	}
+	for _, query := range []string{"?limit=0", "?limit=x"} {
+		if code, _, _ := list(query); code != http.StatusBadRequest {
+			t.Fatalf("%s = %d, want 400", query, code)
+		}
+	}
+}
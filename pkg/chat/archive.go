@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// HandleArchiveSession archives a session
+func (cs *ChatServer) HandleArchiveSession(w http.ResponseWriter, r *http.Request) {
+	cs.setSessionArchived(w, r, true)
+}
+
+// HandleUnarchiveSession makes an archived session writable and listed again
+func (cs *ChatServer) HandleUnarchiveSession(w http.ResponseWriter, r *http.Request) {
+	cs.setSessionArchived(w, r, false)
+}
+
+// setSessionArchived changes the archive state of a session and notifies the user's other devices
+func (cs *ChatServer) setSessionArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	if cs.rejectIfMaintenance(w) {
+		return
+	}
+
+	userID := cs.getClientID(r)
+	sm := cs.GetSessionManager(userID)
+	sessionID := r.PathValue("id")
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
+
+	if err := sm.SetSessionArchived(sessionID, archived); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	eventType := "session_unarchived"
+	if archived {
+		eventType = "session_archived"
+	}
+	cs.sessionEvents.publish(userID, SessionEvent{Type: eventType, SessionID: sessionID})
+
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), sessionLoadStatus(err))
+		return
+	}
+
+	summary := session.Summary()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"id":          summary.ID,
+		"archived":    summary.Archived,
+		"archived_at": summary.ArchivedAt,
+		"updated_at":  summary.UpdatedAt,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode session archive response: %v", err)
+	}
+}
+
+// rejectIfArchived refuses to continue an archived session with 409 and the
+// session_archived error code
+func rejectIfArchived(w http.ResponseWriter, session *sessionpkg.Session) bool {
+	if !session.IsArchived() {
+		return false
+	}
+	http.Error(w, "session_archived: "+sessionpkg.ErrSessionArchived.Error()+"; unarchive it to continue", http.StatusConflict)
+	return true
+}
@@ -0,0 +1,263 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/smallnest/langchat/pkg/middleware"
+)
+
+// assetPrefix is the URL path static assets are served under
+const assetPrefix = "/static/"
+
+// Static assets are fingerprinted once per build of the static filesystem:
+// every file gets a versioned path with the hash of its content, e.g.
+// css/main.css is also served as css/main.1a2b3c4d5e6f.css. A versioned path
+// never changes its content, so it is cached forever; the pages refer to the
+// versioned paths, so a new build is fetched as soon as a page is.
+type assetManifest struct {
+	staticSubFS fs.FS             // the static directory
+	paths       map[string]string // logical name -> versioned URL path
+	logical     map[string]string // versioned name -> logical name
+	etags       map[string]string // logical name -> hash of the content
+
+	manifest       []byte // paths as JSON, served by HandleAssetManifest
+	manifestTag    string // ETag of manifest
+	webManifest    []byte // served by HandleWebAppManifest
+	webManifestTag string // ETag of webManifest
+}
+
+// loadAssetManifest hashes the files of the static directory of staticFS.
+// HTML pages are served by their own routes and are not fingerprinted.
+func loadAssetManifest(staticFS fs.FS) (*assetManifest, error) {
+	staticSubFS, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sub filesystem: %w", err)
+	}
+	a := &assetManifest{
+		staticSubFS: staticSubFS,
+		paths:       make(map[string]string),
+		logical:     make(map[string]string),
+		etags:       make(map[string]string),
+	}
+	err = fs.WalkDir(staticFS, "static", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) == ".html" {
+			return err
+		}
+		data, err := fs.ReadFile(staticFS, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:6])
+
+		logical := strings.TrimPrefix(name, "static/")
+		ext := path.Ext(logical)
+		versioned := strings.TrimSuffix(logical, ext) + "." + hash + ext
+		a.paths[logical] = assetPrefix + versioned
+		a.logical[versioned] = logical
+		a.etags[logical] = `"` + hash + `"`
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint static assets: %w", err)
+	}
+
+	if a.manifest, err = json.Marshal(a.paths); err != nil {
+		return nil, fmt.Errorf("failed to marshal asset manifest: %w", err)
+	}
+	a.manifestTag = documentTag(a.manifest)
+	if err := a.buildWebAppManifest(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// documentTag returns the ETag of a document generated at startup
+func documentTag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// URL returns the versioned URL path of an asset, or its plain path if it is
+// not in the manifest; a may be nil
+func (a *assetManifest) URL(logical string) string {
+	if a != nil {
+		if versioned, ok := a.paths[logical]; ok {
+			return versioned
+		}
+	}
+	return assetPrefix + logical
+}
+
+// assetRef matches a quoted or parenthesized reference to a static asset,
+// with an optional ?v= cache buster of hand-versioned URLs
+var assetRef = regexp.MustCompile(`(["'(])/static/([^"'()?\s]+)(\?v=[^"'()\s]*)?`)
+
+// rewrite replaces the asset references of a page by their versioned paths.
+// References built at runtime, e.g. from a theme name, are left alone.
+func (a *assetManifest) rewrite(page []byte) []byte {
+	return assetRef.ReplaceAllFunc(page, func(ref []byte) []byte {
+		m := assetRef.FindSubmatch(ref)
+		versioned, ok := a.paths[string(m[2])]
+		if !ok {
+			return ref
+		}
+		return append(slices.Clip(m[1]), versioned...)
+	})
+}
+
+// handler serves the static assets: versioned paths as immutable, plain
+// paths revalidated by ETag, and files missing from the manifest, such as
+// files added to a development directory after startup, by next
+func (a *assetManifest) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, assetPrefix)
+		if logical, ok := a.logical[name]; ok {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			http.ServeFileFS(w, r, a.staticSubFS, logical)
+			return
+		}
+		if etag, ok := a.etags[name]; ok {
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", "public, no-cache")
+			http.ServeFileFS(w, r, a.staticSubFS, name)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveDocument writes a document generated at startup, or 304 Not Modified
+// when the client already has it; clients must revalidate it
+func serveDocument(w http.ResponseWriter, r *http.Request, data []byte, etag, contentType string) {
+	headers := w.Header()
+	headers.Set("ETag", etag)
+	headers.Set("Cache-Control", "public, no-cache")
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	headers.Set("Content-Type", contentType)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Warning: Failed to write %s: %v", r.URL.Path, err)
+	}
+}
+
+// HandleAssetManifest returns the versioned URL path of every static asset,
+// keyed by its path below /static/, for the service worker to precache
+func (cs *ChatServer) HandleAssetManifest(w http.ResponseWriter, r *http.Request) {
+	basePath := middleware.BasePathFrom(r.Context())
+	if basePath == "" {
+		serveDocument(w, r, cs.assets.manifest, cs.assets.manifestTag, "application/json")
+		return
+	}
+	paths := make(map[string]string, len(cs.assets.paths))
+	for logical, versioned := range cs.assets.paths {
+		paths[logical] = basePath + versioned
+	}
+	data, err := json.Marshal(paths)
+	if err != nil {
+		http.Error(w, "Failed to encode asset manifest", http.StatusInternalServerError)
+		return
+	}
+	serveDocument(w, r, data, documentTag(data), "application/json")
+}
+
+// webAppManifest is the manifest that makes the web UI installable
+type webAppManifest struct {
+	Name            string       `json:"name"`
+	ShortName       string       `json:"short_name"`
+	StartURL        string       `json:"start_url"`
+	Scope           string       `json:"scope"`
+	Display         string       `json:"display"`
+	BackgroundColor string       `json:"background_color"`
+	ThemeColor      string       `json:"theme_color"`
+	Icons           []webAppIcon `json:"icons"`
+}
+
+// webAppIcon is an icon of the web app manifest
+type webAppIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+// buildWebAppManifest builds the web app manifest of the root
+func (a *assetManifest) buildWebAppManifest() error {
+	data, err := a.webAppManifest("")
+	if err != nil {
+		return err
+	}
+	a.webManifest = data
+	a.webManifestTag = documentTag(data)
+	return nil
+}
+
+// webAppManifest returns the web app manifest of the web UI below a base
+// path, pointing at the versioned icons
+func (a *assetManifest) webAppManifest(basePath string) ([]byte, error) {
+	data, err := json.Marshal(webAppManifest{
+		Name:            "LangGraphGo 聊天",
+		ShortName:       "LangChat",
+		StartURL:        basePath + "/",
+		Scope:           basePath + "/",
+		Display:         "standalone",
+		BackgroundColor: "#ffffff",
+		ThemeColor:      "#ffffff",
+		Icons: []webAppIcon{
+			{Src: basePath + a.URL("images/android-chrome-192x192.png"), Sizes: "192x192", Type: "image/png"},
+			{Src: basePath + a.URL("images/android-chrome-512x512.png"), Sizes: "512x512", Type: "image/png"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal web app manifest: %w", err)
+	}
+	return data, nil
+}
+
+// HandleWebAppManifest returns the web app manifest
+func (cs *ChatServer) HandleWebAppManifest(w http.ResponseWriter, r *http.Request) {
+	basePath := middleware.BasePathFrom(r.Context())
+	if basePath == "" {
+		serveDocument(w, r, cs.assets.webManifest, cs.assets.webManifestTag, "application/manifest+json")
+		return
+	}
+	data, err := cs.assets.webAppManifest(basePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveDocument(w, r, data, documentTag(data), "application/manifest+json")
+}
+
+// serviceWorker is the service worker script below /static/. It is served
+// from the root, so its scope covers the whole web UI.
+const serviceWorker = "sw.js"
+
+// HandleServiceWorker serves the service worker script. Browsers check it for
+// updates on every navigation, so it is always revalidated, never versioned.
+func (cs *ChatServer) HandleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	etag, ok := cs.assets.etags[serviceWorker]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Service-Worker-Allowed", middleware.BasePathFrom(r.Context())+"/")
+	http.ServeFileFS(w, r, cs.assets.staticSubFS, serviceWorker)
+}
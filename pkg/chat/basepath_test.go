@@ -0,0 +1,157 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/api"
+	"github.com/smallnest/langchat/pkg/auth"
+	"github.com/smallnest/langchat/pkg/middleware"
+)
+
+// cookieNamed returns the cookie of a response with the given name
+func cookieNamed(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// A browser signs in and chats with the server reached under /chat, whether
+// the prefix is configured or sent by a trusted proxy
+func TestSignInAndChatUnderBasePath(t *testing.T) {
+	tests := []struct {
+		name           string
+		basePath       string
+		trustedProxies []string
+		header         string
+	}{
+		{"configured", "/chat", nil, ""},
+		// httptest requests come from 192.0.2.1
+		{"auto from a trusted proxy", "auto", []string{"192.0.2.0/24"}, "/chat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := newTestServer(t)
+			cs.llm = &stubLLM{answer: "hello under the prefix"}
+			cs.authService = auth.NewAuthService("test-secret", time.Hour, time.Hour)
+			cs.jwtAuth = middleware.NewAuthMiddleware("test-secret", time.Hour, time.Hour)
+			cs.authAPI = api.NewAuthAPI(cs.authService, cs.jwtAuth, cs.metricsCollector)
+			cs.jwtAuth.SetRefresher(cs.authAPI)
+			if _, err := cs.authService.CreateUser("alice", "alice@example.com", "", "alice-password", []string{"user"}); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			config := *cs.GetConfig()
+			config.Server.BasePath, config.Server.TrustedProxies = tt.basePath, tt.trustedProxies
+			cs.config.Store(&config)
+			handler, err := cs.routes(os.DirFS("../.."))
+			if err != nil {
+				t.Fatalf("routes: %v", err)
+			}
+			serve := func(method, target string, body any, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+				var data []byte
+				if body != nil {
+					if data, err = json.Marshal(body); err != nil {
+						t.Fatalf("Marshal: %v", err)
+					}
+				}
+				r := httptest.NewRequest(method, target, bytes.NewReader(data))
+				if method == http.MethodGet {
+					r.Header.Set("Accept", "text/html")
+				}
+				if tt.header != "" {
+					r.Header.Set("X-Forwarded-Prefix", tt.header)
+				}
+				for _, cookie := range cookies {
+					r.AddCookie(cookie)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				return w
+			}
+
+			// The browser is sent to the login page under the prefix
+			w := serve(http.MethodGet, "/chat/", nil)
+			if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/chat/login" {
+				t.Fatalf("signed out page = %d to %q, want a redirect to /chat/login", w.Code, w.Header().Get("Location"))
+			}
+			// whose script posts below the prefix and keeps the tokens under it
+			w = serve(http.MethodGet, "/chat/login", nil)
+			if page := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(page, "'/chat/api/auth/login'") ||
+				!strings.Contains(page, "path=/chat/;") || strings.Contains(page, "path=/;") {
+				t.Fatalf("login page = %d, want its paths under /chat", w.Code)
+			}
+
+			w = serve(http.MethodPost, "/chat/api/auth/login", auth.LoginRequest{Username: "alice", Password: "alice-password"})
+			var tokens auth.LoginResponse
+			if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&tokens) != nil || tokens.AccessToken == "" {
+				t.Fatalf("login = %d %s", w.Code, w.Body)
+			}
+			accessToken := &http.Cookie{Name: "access_token", Value: tokens.AccessToken}
+			refreshToken := &http.Cookie{Name: "refresh_token", Value: tokens.RefreshToken}
+
+			// The signed in browser gets the page and its session cookie under the prefix
+			if w := serve(http.MethodGet, "/chat/", nil, accessToken); w.Code != http.StatusOK {
+				t.Fatalf("signed in page = %d to %q", w.Code, w.Header().Get("Location"))
+			}
+			w = serve(http.MethodPost, "/chat/api/sessions/new", map[string]any{}, accessToken)
+			var session struct {
+				SessionID string `json:"session_id"`
+			}
+			if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&session) != nil || session.SessionID == "" {
+				t.Fatalf("new session = %d %s", w.Code, w.Body)
+			}
+			if cookie := cookieNamed(w, "user_id"); cookie == nil || cookie.Path != "/chat/" {
+				t.Fatalf("user_id cookie = %v, want the path /chat/", cookie)
+			}
+
+			w = serve(http.MethodPost, "/chat/api/chat", chatRequest{SessionID: session.SessionID, Message: "hi"}, accessToken)
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "hello under the prefix") {
+				t.Fatalf("chat = %d %s", w.Code, w.Body)
+			}
+
+			// A page load after the access token cookie expired is signed in
+			// again, with the new cookies under the prefix
+			w = serve(http.MethodGet, "/chat/", nil, refreshToken)
+			if w.Code != http.StatusOK {
+				t.Fatalf("refreshed page = %d to %q", w.Code, w.Header().Get("Location"))
+			}
+			for _, name := range []string{"access_token", "refresh_token"} {
+				if cookie := cookieNamed(w, name); cookie == nil || cookie.Path != "/chat/" {
+					t.Fatalf("refreshed %s cookie = %v, want the path /chat/", name, cookie)
+				}
+			}
+		})
+	}
+}
+
+// A client that is not a trusted proxy cannot move the server under a prefix
+func TestUntrustedForwardedPrefixIsIgnored(t *testing.T) {
+	cs := newTestServer(t)
+	cs.jwtAuth = middleware.NewAuthMiddleware("test-secret", time.Hour, time.Hour)
+	cs.authAPI = api.NewAuthAPI(auth.NewAuthService("test-secret", time.Hour, time.Hour), cs.jwtAuth, cs.metricsCollector)
+	config := *cs.GetConfig()
+	config.Server.BasePath, config.Server.TrustedProxies = "auto", []string{"10.0.0.0/8"}
+	cs.config.Store(&config)
+	handler, err := cs.routes(os.DirFS("../.."))
+	if err != nil {
+		t.Fatalf("routes: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "text/html")
+	r.Header.Set("X-Forwarded-Prefix", "/evil")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/login" {
+		t.Fatalf("page = %d to %q, want a redirect to /login", w.Code, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,165 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/audit"
+	"github.com/smallnest/langchat/pkg/middleware"
+	"github.com/smallnest/langchat/pkg/usage"
+)
+
+// userRoles returns the roles of the authenticated user
+func userRoles(r *http.Request) []string {
+	if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
+		return claims.Roles
+	}
+	return nil
+}
+
+// rejectIfOverBudget fails a chat request with 429 when the tokens the user
+// spent today plus the estimated prompt would exceed their daily budget
+func (cs *ChatServer) rejectIfOverBudget(w http.ResponseWriter, r *http.Request, userID, message string) bool {
+	if cs.budget == nil {
+		return false
+	}
+	decision := cs.budget.Check(userID, cs.budgetRoles(r), int64(usage.EstimateTokens(message)), cs.budgetLimits(r))
+	if decision.Allowed {
+		return false
+	}
+
+	retryAfter := time.Until(decision.ResetAt)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"error":    "budget_exceeded",
+		"message":  fmt.Sprintf("daily token budget of %d tokens exhausted, resets at %s", decision.Limit, decision.ResetAt.Format(time.RFC3339)),
+		"limit":    decision.Limit,
+		"used":     decision.Used,
+		"reset_at": decision.ResetAt,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode budget response: %v", err)
+	}
+	return true
+}
+
+// chargeBudget adds the tokens of a turn to the user's daily usage. The
+// provider-reported usage is used when available, estimates otherwise.
+func (cs *ChatServer) chargeBudget(r *http.Request, userID, prompt, response string, result *StreamResult) {
+	if cs.budget == nil {
+		return
+	}
+	tokens := int64(usage.EstimateTokens(prompt) + usage.EstimateTokens(response))
+	if result != nil && result.Usage.PromptTokens+result.Usage.CompletionTokens > 0 {
+		tokens = int64(result.Usage.PromptTokens + result.Usage.CompletionTokens)
+	}
+	cs.budget.Add(userID, cs.budgetRoles(r), tokens, cs.budgetLimits(r))
+	cs.updateBudgetGauges()
+}
+
+// startBudgetFlusher persists charged tokens every interval until ctx is done
+func (cs *ChatServer) startBudgetFlusher(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := cs.budget.Flush(); err != nil {
+					log.Printf("Warning: Failed to save token budget: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// updateBudgetGauges publishes the budget utilization of every role
+func (cs *ChatServer) updateBudgetGauges() {
+	for role, u := range cs.budget.Roles() {
+		cs.metricsCollector.SetTokenBudget(role, u.Used, u.Limit)
+	}
+}
+
+// HandleGetBudget returns the token usage of today per role and user
+func (cs *ChatServer) HandleGetBudget(w http.ResponseWriter, r *http.Request) {
+	if cs.budget == nil {
+		http.Error(w, "Token budgets are disabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"timezone": cs.GetConfig().Budget.Timezone,
+		"reset_at": cs.budget.ResetAt(),
+		"roles":    cs.budget.Roles(),
+		"users":    cs.budget.Users(),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode budget: %v", err)
+	}
+}
+
+// HandleGrantBudgetExtension temporarily raises the daily budget of a user
+func (cs *ChatServer) HandleGrantBudgetExtension(w http.ResponseWriter, r *http.Request) {
+	if cs.budget == nil {
+		http.Error(w, "Token budgets are disabled", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		UserID           string `json:"user_id"`
+		Tokens           int64  `json:"tokens"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"` // default: until the budget resets
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" || req.Tokens <= 0 {
+		http.Error(w, "user_id and a positive tokens are required", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInSeconds < 0 {
+		http.Error(w, "expires_in_seconds cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	expiresAt := cs.budget.ResetAt()
+	if req.ExpiresInSeconds > 0 {
+		expiresAt = time.Now().Add(time.Duration(req.ExpiresInSeconds) * time.Second)
+	}
+
+	actor := cs.getClientID(r)
+	extension, err := cs.budget.Grant(req.UserID, req.Tokens, expiresAt, actor)
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	cs.auditLogger.Log(audit.Event{
+		Action:   "budget.extend",
+		Actor:    actor,
+		Resource: req.UserID,
+		Result:   result,
+		Details:  map[string]any{"tokens": req.Tokens, "expires_at": expiresAt},
+	})
+	if err != nil {
+		log.Printf("Failed to grant budget extension to %s: %v", req.UserID, err)
+		http.Error(w, "Failed to grant budget extension", http.StatusInternalServerError)
+		return
+	}
+	cs.updateBudgetGauges()
+
+	log.Printf("💰 Budget of %s extended by %d tokens until %s", req.UserID, req.Tokens, expiresAt.Format(time.RFC3339))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(extension); err != nil {
+		log.Printf("Warning: Failed to encode budget extension: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// capacityWarnRatio is the share of a cap in use above which a warning is
+// logged and a capacity_warning admin event is published
+const capacityWarnRatio = 0.8
+
+// namespaceRetryAfter is the Retry-After of a rejected anonymous namespace:
+// by then idle session managers may be evicted
+const namespaceRetryAfter = evictGrace
+
+// capacityAlerts records which caps are above capacityWarnRatio, so each
+// crossing is reported once
+type capacityAlerts struct {
+	managers atomic.Bool
+	agents   atomic.Bool
+}
+
+// capacityWarning is the data of a capacity_warning admin event
+type capacityWarning struct {
+	Resource string `json:"resource"`
+	InUse    int    `json:"in_use"`
+	Limit    int    `json:"limit"`
+}
+
+// reportCapacity publishes the use of a capped resource and warns when it
+// rises above capacityWarnRatio of its limit
+func (cs *ChatServer) reportCapacity(alerted *atomic.Bool, resource string, inUse, limit int) {
+	cs.metricsCollector.SetCapacity(resource, inUse, limit)
+	if limit <= 0 || float64(inUse) <= capacityWarnRatio*float64(limit) {
+		alerted.Store(false)
+		return
+	}
+	if !alerted.CompareAndSwap(false, true) {
+		return
+	}
+	log.Printf("Warning: %d of %d %s in use, over %.0f%% of the cap", inUse, limit, strings.ReplaceAll(resource, "_", " "), capacityWarnRatio*100)
+	cs.adminEvents.publish(AdminEvent{
+		Type: "capacity_warning",
+		Time: time.Now(),
+		Data: capacityWarning{Resource: resource, InUse: inUse, Limit: limit},
+	})
+}
+
+// roomForSessionManagerLocked makes room for a new session manager at the
+// configured cap by evicting the least recently used manager idle for at
+// least evictGrace, and reports whether there is room. The caller must hold
+// cs.smMu.
+func (cs *ChatServer) roomForSessionManagerLocked() bool {
+	limit := cs.GetConfig().Agent.MaxSessionManagers
+	if limit <= 0 || len(cs.sessionManagers) < limit {
+		return true
+	}
+
+	var oldestID string
+	var oldest time.Time
+	for userID := range cs.sessionManagers {
+		if lastUsed := cs.smLastUsed[userID]; oldestID == "" || lastUsed.Before(oldest) {
+			oldestID, oldest = userID, lastUsed
+		}
+	}
+	if oldestID == "" || time.Since(oldest) < evictGrace {
+		return false
+	}
+
+	// Write what is still queued before the sessions are reloaded from the
+	// store by a new manager
+	sm := cs.sessionManagers[oldestID]
+	if err := sm.Close(); err != nil {
+		log.Printf("Warning: Failed to save sessions of evicted user %s: %v", redact.LogID(oldestID), err)
+	}
+	delete(cs.sessionManagers, oldestID)
+	delete(cs.smLastUsed, oldestID)
+	log.Printf("Evicted idle session manager of user %s (idle %v)", redact.LogID(oldestID), time.Since(oldest).Round(time.Second))
+	cs.reportCapacity(&cs.capacity.managers, "session_managers", len(cs.sessionManagers), limit)
+	return true
+}
+
+// limitNamespaces rejects anonymous requests with 429 when they would need a
+// new session manager beyond the cap and no idle one can be evicted.
+// Authenticated users are always served; their managers may exceed the cap.
+func (cs *ChatServer) limitNamespaces(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims := cs.requestClaims(r); claims != nil && claims.UserID != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		clientID := cs.getClientID(r)
+		cs.smMu.Lock()
+		_, exists := cs.sessionManagers[clientID]
+		admitted := exists || cs.roomForSessionManagerLocked()
+		cs.smMu.Unlock()
+		if admitted {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(int(namespaceRetryAfter.Seconds())))
+		w.WriteHeader(http.StatusTooManyRequests)
+		if err := json.NewEncoder(w).Encode(map[string]any{
+			"error":   "too_many_namespaces",
+			"message": "the server holds too many sessions of anonymous clients, try again later or sign in",
+		}); err != nil {
+			log.Printf("Warning: Failed to encode namespace limit response: %v", err)
+		}
+	})
+}
+
+// roomForAgentLocked evicts the least recently used session agent that is
+// not answering a turn when the agents are at the configured cap. When all
+// of them are busy, the cap is exceeded. The caller must hold cs.agentMu.
+func (cs *ChatServer) roomForAgentLocked() {
+	limit := cs.GetConfig().Agent.MaxAgents
+	if limit <= 0 || len(cs.agents) < limit {
+		return
+	}
+
+	var oldestID string
+	var oldest *SimpleChatAgent
+	for sessionID, agent := range cs.agents {
+		simpleAgent, ok := agent.(*SimpleChatAgent)
+		if !ok {
+			continue
+		}
+		if oldest == nil || simpleAgent.lastUsed.Load() < oldest.lastUsed.Load() {
+			if !simpleAgent.mu.TryLock() {
+				continue
+			}
+			simpleAgent.mu.Unlock()
+			oldestID, oldest = sessionID, simpleAgent
+		}
+	}
+	if oldest == nil {
+		log.Printf("Warning: All %d session agents are busy, exceeding the cap of %d", len(cs.agents), limit)
+		return
+	}
+
+	delete(cs.agents, oldestID)
+	log.Printf("Evicted least recently used agent of session %s (idle %v)", redact.LogID(oldestID), oldest.idleFor(time.Now()).Round(time.Second))
+	go func() {
+		if err := oldest.Close(); err != nil {
+			log.Printf("Error closing evicted agent of session %s: %v", redact.LogID(oldestID), err)
+		}
+	}()
+}
+
+// reportAgentCapacityLocked publishes the number of session agents. The
+// caller must hold cs.agentMu.
+func (cs *ChatServer) reportAgentCapacityLocked() {
+	cs.reportCapacity(&cs.capacity.agents, "agents", len(cs.agents), cs.GetConfig().Agent.MaxAgents)
+}
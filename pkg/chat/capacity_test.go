@@ -0,0 +1,266 @@
+package chat
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/activity"
+	"github.com/smallnest/langchat/pkg/api"
+	"github.com/smallnest/langchat/pkg/auth"
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/middleware"
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+	"github.com/smallnest/langchat/pkg/workspace"
+)
+
+// capServer returns a test server holding at most managers session managers
+// and agents session agents
+func capServer(t *testing.T, managers, agents int) *ChatServer {
+	t.Helper()
+	cs := newTestServer(t)
+	config := *cs.GetConfig()
+	config.Agent.MaxSessionManagers, config.Agent.MaxAgents = managers, agents
+	cs.config.Store(&config)
+	return cs
+}
+
+// backdateManagers makes every session manager look idle for longer than evictGrace
+func backdateManagers(cs *ChatServer) {
+	cs.smMu.Lock()
+	defer cs.smMu.Unlock()
+	for userID := range cs.smLastUsed {
+		cs.smLastUsed[userID] = time.Now().Add(-2 * evictGrace)
+	}
+}
+
+func TestRotatingClientsStayBounded(t *testing.T) {
+	const limit, clients = 100, 10_000
+	cs := capServer(t, limit, 0)
+	// Handlers open the namespace of the client, as the API handlers do
+	handler := cs.limitNamespaces(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cs.GetSessionManager(cs.getClientID(r))
+	}))
+	// A scanner rotating its User-Agent, so that each request is a new client
+	scan := func(round string) (admitted int) {
+		for i := range clients {
+			r := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+			r.Header.Set("User-Agent", fmt.Sprintf("scanner/%s-%d", round, i))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			switch w.Code {
+			case http.StatusOK:
+				admitted++
+			case http.StatusTooManyRequests:
+				if w.Header().Get("Retry-After") != "60" || !strings.Contains(w.Body.String(), "too_many_namespaces") {
+					t.Fatalf("rejection = %v %s", w.Header(), w.Body)
+				}
+			default:
+				t.Fatalf("request %d = %d %s", i, w.Code, w.Body)
+			}
+		}
+		return admitted
+	}
+	held := func() (managers, lastUsed int) {
+		cs.smMu.RLock()
+		defer cs.smMu.RUnlock()
+		return len(cs.sessionManagers), len(cs.smLastUsed)
+	}
+
+	if admitted := scan("a"); admitted != limit {
+		t.Fatalf("admitted %d new clients, want the %d of the cap", admitted, limit)
+	}
+	if managers, lastUsed := held(); managers != limit || lastUsed != limit {
+		t.Fatalf("holding %d session managers and %d use times, want %d", managers, lastUsed, limit)
+	}
+	// Rejected clients get no session directory either
+	dirs, err := os.ReadDir(filepath.Join(cs.sessionDir, "users"))
+	if err != nil || len(dirs) != limit {
+		t.Fatalf("%d user directories, %v, want %d", len(dirs), err, limit)
+	}
+
+	// Once idle, the managers make room for new clients, but only as many as the cap
+	backdateManagers(cs)
+	if admitted := scan("b"); admitted != limit {
+		t.Fatalf("admitted %d new clients after the others went idle, want %d", admitted, limit)
+	}
+	if managers, lastUsed := held(); managers != limit || lastUsed != limit {
+		t.Fatalf("holding %d session managers and %d use times, want %d", managers, lastUsed, limit)
+	}
+	if got := gaugeValue(t, "capacity_in_use", map[string]string{"resource": "session_managers"}); got != limit {
+		t.Fatalf("capacity_in_use{session_managers} = %v, want %d", got, limit)
+	}
+	if got := gaugeValue(t, "capacity_limit", map[string]string{"resource": "session_managers"}); got != limit {
+		t.Fatalf("capacity_limit{session_managers} = %v, want %d", got, limit)
+	}
+}
+
+func TestNamespaceCapServesKnownAndSignedInUsers(t *testing.T) {
+	cs := capServer(t, 1, 0)
+	cs.jwtAuth = middleware.NewAuthMiddleware("test-secret", time.Hour, time.Hour)
+	handler := cs.limitNamespaces(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cs.GetSessionManager(cs.getClientID(r))
+	}))
+	request := func(userAgent, user string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+		r.Header.Set("User-Agent", userAgent)
+		if user != "" {
+			token, err := cs.jwtAuth.GenerateToken(user, user, []string{"user"})
+			if err != nil {
+				t.Fatalf("GenerateToken: %v", err)
+			}
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := request("first", ""); code != http.StatusOK {
+		t.Fatalf("first client = %d", code)
+	}
+	if code := request("second", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("second anonymous client = %d, want 429", code)
+	}
+	if code := request("first", ""); code != http.StatusOK {
+		t.Fatalf("returning client = %d, want its namespace served", code)
+	}
+	if code := request("second", "alice"); code != http.StatusOK {
+		t.Fatalf("signed in user = %d, want served beyond the cap", code)
+	}
+}
+
+// In the API chain, the namespace cap rejects before authentication, and
+// activity is tracked after it
+func TestProtectedChainStages(t *testing.T) {
+	cs := capServer(t, 1, 0)
+	cs.jwtAuth = middleware.NewAuthMiddleware("test-secret", time.Hour, time.Hour)
+	cs.authAPI = api.NewAuthAPI(auth.NewAuthService("test-secret", time.Hour, time.Hour), cs.jwtAuth, cs.metricsCollector)
+	tracker, err := activity.New(configpkg.ActivityConfig{Enabled: true, Timezone: "UTC", RetentionDays: 7,
+		StatePath: filepath.Join(t.TempDir(), "activity.json")})
+	if err != nil {
+		t.Fatalf("activity.New: %v", err)
+	}
+	cs.activity = tracker
+	handler, err := cs.routes(os.DirFS("../.."))
+	if err != nil {
+		t.Fatalf("routes: %v", err)
+	}
+	cs.GetSessionManager("holder")
+
+	list := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	if w := list(""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("anonymous request at the cap = %d %s, want 429 before authentication", w.Code, w.Body)
+	}
+
+	token, err := cs.jwtAuth.GenerateToken("alice", "alice", []string{"user"})
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if w := list(token); w.Code != http.StatusOK {
+		t.Fatalf("signed in request = %d %s", w.Code, w.Body)
+	}
+	if user, ok := tracker.User(workspace.UserKey("", "alice")); !ok || user.LastSeen == nil {
+		t.Fatalf("activity of the signed in user = %+v, %v, want it seen", user, ok)
+	}
+}
+
+func TestEvictedSessionManagerSavesQueuedSessions(t *testing.T) {
+	cs := capServer(t, 1, 0)
+	sm := cs.GetSessionManager("victim")
+	session := sm.CreateSession()
+	if _, err := sm.AddMessage(session.ID, "user", "keep me"); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+
+	backdateManagers(cs)
+	cs.GetSessionManager("newcomer")
+	cs.smMu.RLock()
+	_, kept := cs.sessionManagers["victim"]
+	cs.smMu.RUnlock()
+	if kept {
+		t.Fatal("idle session manager kept at the cap")
+	}
+	if _, err := os.Stat(filepath.Join(cs.sessionDir, "users", "victim", session.ID+".json")); err != nil {
+		t.Fatalf("queued session of the evicted manager: %v", err)
+	}
+	messages, err := cs.GetSessionManager("victim").GetMessages(session.ID)
+	if err != nil || len(messages) != 1 || messages[0].Content != "keep me" {
+		t.Fatalf("reloaded session = %v, %v", messages, err)
+	}
+}
+
+func TestAgentCapEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Setenv("SKILLS_DIR", t.TempDir())
+	t.Setenv("MCP_CONFIG_PATH", filepath.Join(t.TempDir(), "missing-mcp.json"))
+	cs := capServer(t, 0, 3)
+	oldest, _ := idleAgent(cs, 1, 10, 3*time.Hour)
+	busyID, busy := idleAgent(cs, 1, 10, 4*time.Hour)
+	recent, _ := idleAgent(cs, 1, 10, time.Minute)
+
+	// The busy agent is older, but answering a turn
+	busy.mu.Lock()
+	newcomer, err := cs.GetOrCreateAgent(sessionpkg.UUIDGenerator.NewID())
+	busy.mu.Unlock()
+	if err != nil {
+		t.Fatalf("GetOrCreateAgent: %v", err)
+	}
+	if err := newcomer.(*SimpleChatAgent).WaitReady(t.Context()); err != nil {
+		t.Fatalf("WaitReady: %v", err)
+	}
+
+	cs.agentMu.RLock()
+	_, oldestKept := cs.agents[oldest]
+	_, busyKept := cs.agents[busyID]
+	_, recentKept := cs.agents[recent]
+	count := len(cs.agents)
+	cs.agentMu.RUnlock()
+	if oldestKept || !busyKept || !recentKept || count != 3 {
+		t.Fatalf("kept oldest %v, busy %v, recent %v of %d agents, want the oldest idle one evicted", oldestKept, busyKept, recentKept, count)
+	}
+	if got := gaugeValue(t, "capacity_in_use", map[string]string{"resource": "agents"}); got != 3 {
+		t.Fatalf("capacity_in_use{agents} = %v, want 3", got)
+	}
+}
+
+func TestCapacityWarning(t *testing.T) {
+	cs := newTestServer(t)
+	logs := captureLog(t, redact.NewLogPolicy(configpkg.LoggingConfig{}))
+	events := cs.adminEvents.subscribe()
+	defer cs.adminEvents.unsubscribe(events)
+
+	// Each crossing of 80% of the cap warns once
+	for _, inUse := range []int{7, 8, 9, 10, 9, 5, 9} {
+		cs.reportCapacity(&cs.capacity.agents, "agents", inUse, 10)
+	}
+	if got := strings.Count(logs.String(), "Warning: 9 of 10 agents in use, over 80% of the cap"); got != 2 {
+		t.Fatalf("logged %d warnings, want 2:\n%s", got, logs)
+	}
+	for range 2 {
+		select {
+		case event := <-events:
+			if warning, ok := event.Data.(capacityWarning); event.Type != "capacity_warning" || !ok || warning != (capacityWarning{"agents", 9, 10}) {
+				t.Fatalf("admin event = %+v", event)
+			}
+		default:
+			t.Fatal("capacity_warning event missing")
+		}
+	}
+	if len(events) != 0 {
+		t.Fatalf("%d more admin events, want 2 in all", len(events))
+	}
+}
@@ -1,39 +1,68 @@
 package chat
 
 import (
+	"cmp"
 	"context"
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
+	"maps"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/santhosh-tekuri/jsonschema/v6"
 	"github.com/smallnest/goskills"
 	mcpclient "github.com/smallnest/goskills/mcp"
 	adaptergoskills "github.com/smallnest/langgraphgo/adapter/goskills"
 	"github.com/smallnest/langgraphgo/adapter/mcp"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/openai"
 	"github.com/tmc/langchaingo/tools"
 
+	"github.com/smallnest/langchat/pkg/activity"
 	agentpkg "github.com/smallnest/langchat/pkg/agent"
 	"github.com/smallnest/langchat/pkg/api"
+	"github.com/smallnest/langchat/pkg/audit"
 	"github.com/smallnest/langchat/pkg/auth"
+	"github.com/smallnest/langchat/pkg/breaker"
+	"github.com/smallnest/langchat/pkg/budget"
 	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/dataset"
+	"github.com/smallnest/langchat/pkg/events"
+	"github.com/smallnest/langchat/pkg/experiment"
+	"github.com/smallnest/langchat/pkg/faults"
+	"github.com/smallnest/langchat/pkg/httpclient"
+	"github.com/smallnest/langchat/pkg/mail"
 	"github.com/smallnest/langchat/pkg/middleware"
 	monitoringpkg "github.com/smallnest/langchat/pkg/monitoring"
+	"github.com/smallnest/langchat/pkg/privacy"
+	"github.com/smallnest/langchat/pkg/prompts"
+	"github.com/smallnest/langchat/pkg/redact"
+	"github.com/smallnest/langchat/pkg/sandbox"
+	"github.com/smallnest/langchat/pkg/secrets"
 	sessionpkg "github.com/smallnest/langchat/pkg/session"
+	"github.com/smallnest/langchat/pkg/skills"
+	"github.com/smallnest/langchat/pkg/usage"
+	"github.com/smallnest/langchat/pkg/version"
+	"github.com/smallnest/langchat/pkg/workspace"
 )
 
 // SkillInfo stores basic info about a skill
 type SkillInfo struct {
 	Name        string
 	Description string
+	Version     string // active version, empty if the skill has none
 	Package     *goskills.SkillPackage
 	Tools       []tools.Tool // Cached tools for the skill
 	Loaded      bool         // Whether tools have been loaded
@@ -47,34 +76,125 @@ type ChatAgent interface {
 
 // SimpleChatAgent manages conversation history for a session
 type SimpleChatAgent struct {
-	llm           llms.Model
-	messages      []llms.MessageContent
-	mu            sync.RWMutex
-	mcpClient     *mcpclient.Client
-	mcpTools      []tools.Tool
-	skills        []SkillInfo
-	selectedSkill string // Currently selected skill name
-	toolsEnabled  bool
-	toolsLoading  bool // true when tools are being loaded asynchronously
-	toolsLoaded   bool // true when tools have finished loading
+	llm             llms.Model
+	auxLLM          llms.Model // skill and tool selection; llm unless SetAuxLLM is called
+	messages        []llms.MessageContent
+	mu              sync.RWMutex
+	mcpClient       *mcpclient.Client
+	mcpTools        []tools.Tool
+	skills          []SkillInfo
+	selectedSkill   string // Currently selected skill name
+	toolsEnabled    bool
+	toolsLoading    bool                          // true when tools are being loaded asynchronously
+	toolsLoaded     bool                          // true when tools have finished loading
+	toolsDone       chan struct{}                 // closed when asynchronous tool loading has finished
+	brokenSkills    []skills.BrokenSkill          // Skill packages of the skills directory that failed to load
+	sessionID       string                        // Session this agent serves (empty for the warmup agent)
+	sandbox         *sandbox.Sandbox              // Optional sandbox applied to skill and MCP tools
+	reasoningMode   string                        // How reasoning traces are handled (see ReasoningStream etc.)
+	toolSchemas     map[string]any                // Parameter schemas of loaded tools, keyed by tool name
+	compiledSchemas map[string]*jsonschema.Schema // Compiled toolSchemas, built on first use
+	prompts         *prompts.Set                  // Skill/tool selection prompt templates
+	callOptions     []llms.CallOption             // Options of the answering LLM call, set by an experiment variant
+	hasMemories     bool                          // Whether messages[1] holds the user's memories
+	systemPrompt    string                        // System prompt of the experiment variant; empty for the default
+	topicScope      string                        // Scope instruction put before the system prompt, see SetTopicScope
+	userMCP         *userMCPClient                // Per-user MCP servers launched for the session's user
+	mcpServers      *mcpServerPool                // Runs lazily started MCP servers; nil when not given one
+	toolsProgress   toolsProgressHub              // Progress events of the current tool loading
+	lastUsed        atomic.Int64                  // When the agent was last handed out, unix nanoseconds
+	events          *agentpkg.EventLog            // Last lifecycle events, see recordState
+	sizeMu          sync.Mutex                    // Guards size
+	size            agentSize                     // Last memory estimate, see EstimateSize
 }
 
+// defaultSystemPrompt is the system prompt of agents outside experiments
+const defaultSystemPrompt = "You are a helpful AI assistant. Be concise and friendly."
+
 // NewSimpleChatAgent creates a simple chat agent
 func NewSimpleChatAgent(llm llms.Model, config configpkg.Config) *SimpleChatAgent {
 	// Add system message
 	systemMsg := llms.MessageContent{
 		Role:  llms.ChatMessageTypeSystem,
-		Parts: []llms.ContentPart{llms.TextPart("You are a helpful AI assistant. Be concise and friendly.")},
+		Parts: []llms.ContentPart{llms.TextPart(defaultSystemPrompt)},
 	}
 
 	agent := &SimpleChatAgent{
-		llm:      llm,
-		messages: []llms.MessageContent{systemMsg},
+		llm:           llm,
+		auxLLM:        llm,
+		messages:      []llms.MessageContent{systemMsg},
+		reasoningMode: config.LLM.ReasoningMode,
+		prompts:       prompts.Default(),
+		events:        agentpkg.NewEventLog(config.Agent.EventHistory),
 	}
+	agent.recordState(agentpkg.StateInitializing, "agent created", nil)
 
 	return agent
 }
 
+// SetAuxLLM sets the model of the skill and tool selection calls. It must be
+// called before the agent is used.
+func (a *SimpleChatAgent) SetAuxLLM(llm llms.Model) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.auxLLM = llm
+}
+
+// SetPrompts sets the templates used to build skill and tool selection prompts
+func (a *SimpleChatAgent) SetPrompts(set *prompts.Set) {
+	if set == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prompts = set
+}
+
+// SetVariant applies the system prompt, model and parameters of an experiment
+// variant to the following turns; nil restores the defaults
+func (a *SimpleChatAgent) SetVariant(variant *configpkg.VariantConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	systemPrompt := defaultSystemPrompt
+	a.callOptions = nil
+	if variant != nil {
+		if variant.SystemPrompt != "" {
+			systemPrompt = variant.SystemPrompt
+		}
+		if variant.Model != "" {
+			a.callOptions = append(a.callOptions, llms.WithModel(variant.Model))
+		}
+		if variant.Temperature != nil {
+			a.callOptions = append(a.callOptions, llms.WithTemperature(*variant.Temperature))
+		}
+		if variant.MaxTokens > 0 {
+			a.callOptions = append(a.callOptions, llms.WithMaxTokens(variant.MaxTokens))
+		}
+	}
+
+	a.systemPrompt = systemPrompt
+	a.updateSystemPrompt()
+}
+
+// SetMCPServers sets the pool that runs the agent's lazily started MCP
+// servers. It must be called before InitializeToolsAsync; without a pool all
+// MCP servers are started when tools are loaded.
+func (a *SimpleChatAgent) SetMCPServers(pool *mcpServerPool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.mcpServers = pool
+}
+
+// SetSandbox binds the agent to a session and the sandbox its tools run in.
+// It must be called before InitializeToolsAsync.
+func (a *SimpleChatAgent) SetSandbox(sb *sandbox.Sandbox, sessionID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sandbox = sb
+	a.sessionID = sessionID
+}
+
 // InitializeToolsAsync asynchronously loads Skills and MCP tools in the background
 // This prevents blocking server startup while tools are being loaded
 func (a *SimpleChatAgent) InitializeToolsAsync() {
@@ -82,8 +202,13 @@ func (a *SimpleChatAgent) InitializeToolsAsync() {
 	a.mu.Lock()
 	a.toolsLoading = true
 	a.toolsLoaded = false
+	done := make(chan struct{})
+	a.toolsDone = done
 	a.mu.Unlock()
 
+	a.toolsProgress.reset()
+	progress := ToolsProgressFunc(a.toolsProgress.publish)
+
 	go func() {
 		defer func() {
 			// Mark as loaded regardless of success/failure to prevent blocking
@@ -93,6 +218,9 @@ func (a *SimpleChatAgent) InitializeToolsAsync() {
 			skillsCount := len(a.skills)
 			mcpToolsCount := len(a.mcpTools)
 			a.mu.Unlock()
+			close(done)
+			progress(ToolsEvent{Type: toolsEventDone, Count: a.toolCount()})
+			a.recordState(agentpkg.StateReady, fmt.Sprintf("tools loaded: %d skills, %d MCP tools", skillsCount, mcpToolsCount), nil)
 			log.Printf("✓ Tools pre-warming complete: %d Skills, %d MCP tools loaded", skillsCount, mcpToolsCount)
 		}()
 
@@ -102,63 +230,118 @@ func (a *SimpleChatAgent) InitializeToolsAsync() {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("Panic during tools initialization: %v", r)
+				progress(ToolsEvent{Type: toolsEventError, Error: fmt.Sprintf("panic during tools initialization: %v", r)})
 			}
 		}()
 
 		// Load Skills
-		skillsDir := os.Getenv("SKILLS_DIR")
-		if skillsDir == "" {
-			skillsDir = "../../testdata/skills"
-		}
+		skillsDir := skillsDir()
 
 		if _, err := os.Stat(skillsDir); err == nil {
-			packages, err := goskills.ParseSkillPackages(skillsDir)
+			packages, broken, err := skills.Load(skillsDir)
 			if err != nil {
 				log.Printf("Failed to parse skills packages: %v", err)
+				progress(ToolsEvent{Type: toolsEventError, Error: fmt.Sprintf("failed to parse skills packages: %v", err)})
 			} else {
 				a.mu.Lock()
 				for _, skill := range packages {
+					// A skill installed while loading may already be there
+					if a.hasSkill(skill.Package.Meta.Name) {
+						continue
+					}
 					// Store skill info without converting to tools yet
 					a.skills = append(a.skills, SkillInfo{
-						Name:        skill.Meta.Name,
-						Description: skill.Meta.Description,
-						Package:     skill,
+						Name:        skill.Package.Meta.Name,
+						Description: skill.Package.Meta.Description,
+						Version:     skill.Version,
+						Package:     skill.Package,
 						Loaded:      false,
 					})
 				}
+				a.brokenSkills = broken
 				a.toolsEnabled = true
 				a.mu.Unlock()
-				log.Printf("Loaded %d skills info", len(packages))
+				log.Printf("Loaded %d skills info, %d broken", len(packages), len(broken))
+				progress(ToolsEvent{Type: toolsEventSkillsParsed, Count: len(packages)})
 
 				// Pre-warm: Load tools for all skills
 				log.Println("Pre-loading tools for all skills...")
-				for i := range a.skills {
-					skillName := a.skills[i].Name
-					if _, err := a.loadSkillTools(skillName); err != nil {
+				// Skills may be installed or removed meanwhile, so iterate over a snapshot
+				skillNames := a.skillNames()
+				for _, skillName := range skillNames {
+					skillTools, err := a.skillTools(skillName)
+					if err != nil {
 						log.Printf("Failed to pre-load tools for skill '%s': %v", skillName, err)
+						progress(ToolsEvent{Type: toolsEventError, Name: skillName, Error: err.Error()})
+						continue
 					}
+					progress(ToolsEvent{Type: toolsEventSkillToolsLoaded, Name: skillName, Count: len(skillTools)})
 				}
-				log.Printf("Pre-loaded tools for %d skills", len(a.skills))
+				log.Printf("Pre-loaded tools for %d skills", len(skillNames))
 			}
 		} else {
 			log.Printf("Skills directory not found at %s", skillsDir)
 		}
 
 		// Load MCP
-		mcpConfigPath := os.Getenv("MCP_CONFIG_PATH")
-		if mcpConfigPath == "" {
-			mcpConfigPath = "../../testdata/mcp/mcp.json"
-		}
-
 		// Safely initialize MCP with error recovery
-		if err := a.initializeMCP(mcpConfigPath); err != nil {
+		if err := a.initializeMCP(mcpConfigFile(), progress); err != nil {
 			log.Printf("MCP initialization failed (continuing without MCP): %v", err)
+			progress(ToolsEvent{Type: toolsEventError, Error: err.Error()})
 		}
 	}()
 }
 
-// initializeMCP safely initializes MCP client with error recovery
-func (a *SimpleChatAgent) initializeMCP(mcpConfigPath string) (err error) {
+// toolCount returns the number of loaded skill and MCP tools
+func (a *SimpleChatAgent) toolCount() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	count := len(a.mcpTools)
+	for _, skill := range a.skills {
+		count += len(skill.Tools)
+	}
+	return count
+}
+
+// WaitReady blocks until asynchronous tool loading has finished or ctx is done.
+// It returns immediately if tool loading was never started.
+func (a *SimpleChatAgent) WaitReady(ctx context.Context) error {
+	a.mu.RLock()
+	done := a.toolsDone
+	a.mu.RUnlock()
+	if done == nil {
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reset clears the conversation history and restores the default settings,
+// keeping loaded tools. It prepares a pooled agent for a new session.
+func (a *SimpleChatAgent) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.messages = []llms.MessageContent{{
+		Role:  llms.ChatMessageTypeSystem,
+		Parts: []llms.ContentPart{llms.TextPart(defaultSystemPrompt)},
+	}}
+	a.selectedSkill = ""
+	a.callOptions = nil
+	a.hasMemories = false
+	a.systemPrompt = ""
+	a.topicScope = ""
+}
+
+// initializeMCP safely initializes MCP client with error recovery, reporting
+// the tools of every connected server to progress
+func (a *SimpleChatAgent) initializeMCP(mcpConfigPath string, progress ToolsProgressFunc) (err error) {
 	// Add panic recovery to prevent crashes from MCP initialization
 	defer func() {
 		if r := recover(); r != nil {
@@ -167,20 +350,139 @@ func (a *SimpleChatAgent) initializeMCP(mcpConfigPath string) (err error) {
 		}
 	}()
 
+	// Load MCP config
+	config, options, err := loadMCPConfig(mcpConfigPath)
+	if err != nil {
+		return err
+	}
+	// Per-user servers are launched for each user with their secrets, see applyUserMCP
+	for name := range config.MCPServers {
+		if options[name].PerUser {
+			delete(config.MCPServers, name)
+		}
+	}
+
+	// Servers with a tool manifest are started when one of their tools is first called
+	var lazyTools []tools.Tool
+	lazySchemas := make(map[string]any)
+	a.mu.RLock()
+	lazy := a.mcpServers.enabled()
+	a.mu.RUnlock()
+	if lazy {
+		for name, server := range config.MCPServers {
+			manifest := options[name].Tools
+			if len(manifest) == 0 {
+				continue
+			}
+			serverTools, schemas := a.lazyMCPTools(name, server, config.MaxRetries, manifest, false)
+			lazyTools = append(lazyTools, serverTools...)
+			maps.Copy(lazySchemas, schemas)
+			delete(config.MCPServers, name)
+			progress(ToolsEvent{Type: toolsEventMCPDeferred, Server: name, Count: len(serverTools)})
+		}
+	}
+
+	// The other servers are offered from the manifests cached when they were
+	// last reached while they connect; the tools of a server that cannot be
+	// reached stay selectable and fail fast when called
+	manifests := a.mcpServers.manifestCache()
+	hashes := make(map[string]string, len(config.MCPServers))
+	cachedTools := make(map[string][]tools.Tool)
+	cachedSchemas := make(map[string]any)
+	for name, server := range config.MCPServers {
+		hashes[name] = mcpServerHash(server)
+		if manifest, ok := manifests.lookup(name, hashes[name]); ok {
+			serverTools, schemas := a.lazyMCPTools(name, server, config.MaxRetries, manifest, true)
+			cachedTools[name] = serverTools
+			maps.Copy(cachedSchemas, schemas)
+		}
+	}
+	manifests.prune(hashes)
+	if len(cachedTools) > 0 {
+		a.mu.Lock()
+		a.mcpTools = slices.Concat(slices.Concat(slices.Collect(maps.Values(cachedTools))...), lazyTools, a.userMCP.toolList())
+		a.setToolSchemas(cachedSchemas)
+		a.setToolSchemas(lazySchemas)
+		a.toolsEnabled = true
+		a.mu.Unlock()
+		for name, serverTools := range cachedTools {
+			progress(ToolsEvent{Type: toolsEventMCPCached, Server: name, Count: len(serverTools)})
+		}
+	}
+
+	var client *mcpclient.Client
+	var unreachedTools []tools.Tool
+	var tools []tools.Tool
+	var schemas map[string]any
+	if len(config.MCPServers) > 0 {
+		if client, tools, schemas, err = a.connectMCP(config); err != nil {
+			if len(cachedTools) == 0 {
+				return err
+			}
+			log.Printf("Warning: MCP servers could not be reached, keeping their cached tools: %v", err)
+		}
+	}
+
+	// Reconcile: reached servers replace their cached tools and refresh the
+	// cache, the others keep the cached tools
+	reached := mcpManifests(tools, schemas)
+	for name := range config.MCPServers {
+		if manifest, ok := reached[name]; ok {
+			manifests.connected(name, hashes[name], manifest)
+			continue
+		}
+		manifests.failed(name)
+		if cached, ok := cachedTools[name]; ok {
+			log.Printf("MCP server %s could not be reached, offering %d cached tools", name, len(cached))
+			unreachedTools = append(unreachedTools, cached...)
+		}
+	}
+	if client == nil && len(lazyTools) == 0 && len(unreachedTools) == 0 {
+		log.Printf("No MCP tools found, closing client")
+		return nil
+	}
+
+	// Successfully initialized
+	a.mu.Lock()
+	a.mcpClient = client
+	a.mcpTools = slices.Concat(tools, unreachedTools, lazyTools, a.userMCP.toolList())
+	a.setToolSchemas(schemas)
+	a.setToolSchemas(lazySchemas)
+	a.toolsEnabled = true
+	a.mu.Unlock()
+	log.Printf("Successfully loaded %d MCP tools (%d started lazily, %d of unreachable servers)",
+		len(tools)+len(lazyTools)+len(unreachedTools), len(lazyTools), len(unreachedTools))
+
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		names = append(names, tool.Name())
+	}
+	for server, count := range mcpServerCounts(names) {
+		progress(ToolsEvent{Type: toolsEventMCPConnected, Server: server, Count: count})
+	}
+
+	return nil
+}
+
+// connectMCP starts the servers of an MCP config, in the session sandbox if
+// enabled, and loads their tools and parameter schemas. Without tools the
+// client is closed again and nil is returned.
+func (a *SimpleChatAgent) connectMCP(config *mcpclient.Config) (*mcpclient.Client, []tools.Tool, map[string]any, error) {
 	// Use a longer timeout for initialization as npx downloads may be slow
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	// Load MCP config
-	config, err := mcpclient.LoadConfig(mcpConfigPath)
-	if err != nil {
-		return fmt.Errorf("failed to load MCP config: %w", err)
+	// Restrict MCP server processes to the session sandbox
+	if a.sandbox.Enabled() && a.sessionID != "" {
+		if err := a.sandbox.ApplyMCP(a.sessionID, config); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to apply sandbox to MCP config: %w", err)
+		}
 	}
 
 	// Create MCP client with error handling
 	client, err := mcpclient.NewClient(ctx, config)
 	if err != nil {
-		return fmt.Errorf("failed to create MCP client: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to create MCP client: %w", err)
 	}
 
 	// Get tools from MCP with timeout
@@ -193,26 +495,29 @@ func (a *SimpleChatAgent) initializeMCP(mcpConfigPath string) (err error) {
 		if closeErr := a.closeMCPClient(client); closeErr != nil {
 			log.Printf("Failed to close MCP client after error: %v", closeErr)
 		}
-		return fmt.Errorf("failed to get MCP tools: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to get MCP tools: %w", err)
 	}
 
 	if len(tools) == 0 {
-		log.Printf("No MCP tools found, closing client")
 		if closeErr := a.closeMCPClient(client); closeErr != nil {
 			log.Printf("Failed to close MCP client: %v", closeErr)
 		}
-		return nil
+		return nil, nil, nil, nil
 	}
 
-	// Successfully initialized
-	a.mu.Lock()
-	a.mcpClient = client
-	a.mcpTools = tools
-	a.toolsEnabled = true
-	a.mu.Unlock()
-	log.Printf("Successfully loaded %d MCP tools", len(tools))
+	// Keep parameter schemas so failed calls can be retried against them
+	schemas := make(map[string]any, len(tools))
+	if defs, err := client.GetTools(toolsCtx); err != nil {
+		log.Printf("Warning: Failed to load MCP tool schemas: %v", err)
+	} else {
+		for _, def := range defs {
+			if def.Function != nil {
+				schemas[def.Function.Name] = def.Function.Parameters
+			}
+		}
+	}
 
-	return nil
+	return client, tools, schemas, nil
 }
 
 // closeMCPClient safely closes an MCP client with panic recovery and timeout
@@ -269,21 +574,33 @@ func (a *SimpleChatAgent) Close() error {
 		a.mcpTools = nil
 		log.Printf("MCP client closed and cleared")
 	}
+	if userMCP := a.detachUserMCP(); userMCP != nil {
+		a.closeUserMCP(userMCP)
+	}
+	a.mcpServers.closeAgent(a)
+	a.recordState(agentpkg.StateStopped, "agent closed", nil)
 
 	return nil
 }
 
 // GetAvailableTools returns the list of available skills and MCP tools
 func (a *SimpleChatAgent) GetAvailableTools() []map[string]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
 	var tools []map[string]string
 
-	// Add MCP tools
+	// Add MCP tools; those of a server that could not be reached are unverified
 	for _, tool := range a.mcpTools {
-		tools = append(tools, map[string]string{
+		info := map[string]string{
 			"name":        tool.Name(),
 			"description": tool.Description(),
 			"type":        "mcp",
-		})
+		}
+		if lazy, ok := tool.(*lazyMCPTool); ok && lazy.cached {
+			info["status"] = "unverified"
+		}
+		tools = append(tools, info)
 	}
 
 	// Add skills (not loaded as tools yet)
@@ -310,99 +627,30 @@ func (a *SimpleChatAgent) Chat(ctx context.Context, message string, enableSkills
 	}
 	a.messages = append(a.messages, userMsg)
 
-	toolUsed := false
-	var toolResult string
-	var toolName string
-
 	if a.toolsEnabled {
-		// Stage 1: Select skill if needed (only if user enables Skills)
-		if enableSkills && len(a.skills) > 0 {
-			selectedSkill, err := a.selectSkillForTask(ctx, message)
-			if err != nil {
-				log.Printf("Skill selection error: %v", err)
-			} else if selectedSkill != "" {
-				// Load tools for the selected skill
-				skillTools, err := a.loadSkillTools(selectedSkill)
-				if err != nil {
-					log.Printf("Failed to load skill tools: %v", err)
-				} else {
-					a.selectedSkill = selectedSkill
-
-					// Stage 2: Select specific tool from the skill
-					tool, args, err := a.selectToolForTask(ctx, message, skillTools)
-					if err != nil {
-						log.Printf("Tool selection error: %v", err)
-					} else if tool != nil {
-						// Convert args to JSON string
-						argsJSON, _ := json.Marshal(args)
-						argsStr := string(argsJSON)
-						if argsStr == "null" {
-							argsStr = "{}"
-						}
-
-						// Call the tool
-						result, err := (*tool).Call(ctx, argsStr)
-						if err != nil {
-							log.Printf("Tool %s call failed: %v", (*tool).Name(), err)
-						} else {
-							toolUsed = true
-							toolResult = result
-							toolName = (*tool).Name()
-							log.Printf("Successfully used tool '%s' from skill '%s'", (*tool).Name(), selectedSkill)
-						}
-					}
-				}
-			}
-		}
-
-		// If no skill was selected, try MCP tools (only if user enables MCP)
-		if !toolUsed && enableMCP && len(a.mcpTools) > 0 {
-			tool, args, err := a.selectToolForTask(ctx, message, a.mcpTools)
-			if err != nil {
-				log.Printf("MCP tool selection error: %v", err)
-			} else if tool != nil {
-				// Convert args to JSON string
-				argsJSON, _ := json.Marshal(args)
-				argsStr := string(argsJSON)
-				if argsStr == "null" {
-					argsStr = "{}"
-				}
-
-				// Call the tool
-				result, err := (*tool).Call(ctx, argsStr)
-				if err != nil {
-					log.Printf("MCP tool %s call failed: %v", (*tool).Name(), err)
-				} else {
-					toolUsed = true
-					toolResult = result
-					toolName = (*tool).Name()
-					log.Printf("Successfully used MCP tool '%s'", (*tool).Name())
-				}
-			}
-		}
-	}
-
-	// Add tool result to conversation if a tool was used
-	if toolUsed && toolResult != "" {
-		toolMsg := llms.MessageContent{
-			Role: llms.ChatMessageTypeSystem,
-			Parts: []llms.ContentPart{
-				llms.TextPart(fmt.Sprintf("I used the '%s' tool to help with your request. Here's the result:\n\n%s", toolName, toolResult)),
-			},
+		record := a.useTools(ctx, message, enableSkills, enableMCP, toolHooks{})
+		// Feed the tool result, or a structured description of its failure, back to the model
+		if record != nil && (record.Failed() || record.Result != "" || record.DryRun) {
+			a.messages = append(a.messages, a.toolResultMessage(*record))
 		}
-		a.messages = append(a.messages, toolMsg)
 	}
 
 	// Call LLM with full history
-	response, err := a.llm.GenerateContent(ctx, a.messages)
+	messages := a.answerMessages(ctx)
+	response, err := a.llm.GenerateContent(ctx, messages, a.answerOptions(ctx)...)
 	if err != nil {
 		return "", fmt.Errorf("LLM call failed: %w", err)
 	}
 
-	// Extract response text
+	// Extract response text, dropping any inline reasoning trace
 	var responseText string
 	if response != nil && len(response.Choices) > 0 {
-		responseText = response.Choices[0].Content
+		responseText, _ = splitThinking(response.Choices[0].Content)
+	}
+	if format := responseFormatFrom(ctx); format != nil {
+		if responseText, err = a.conformAnswer(ctx, format, messages, responseText); err != nil {
+			return "", err
+		}
 	}
 
 	// Add assistant response to history
@@ -415,8 +663,36 @@ func (a *SimpleChatAgent) Chat(ctx context.Context, message string, enableSkills
 	return responseText, nil
 }
 
+// answerOptions returns the call options of the answer, capped in length for
+// a degraded turn and in JSON mode for a JSON answer the provider supports
+func (a *SimpleChatAgent) answerOptions(ctx context.Context) []llms.CallOption {
+	options := slices.Clone(a.callOptions)
+	if maxTokens := maxTokensFrom(ctx); maxTokens > 0 {
+		options = append(options, llms.WithMaxTokens(maxTokens))
+	}
+	if format := responseFormatFrom(ctx); format != nil && format.native {
+		options = append(options, llms.WithJSONMode())
+	}
+	return options
+}
+
 // ChatStream sends a message and streams response
 func (a *SimpleChatAgent) ChatStream(ctx context.Context, message string, enableSkills bool, enableMCP bool, onChunk func(context.Context, []byte) error) (string, error) {
+	result, err := a.ChatStreamWithEvents(ctx, message, enableSkills, enableMCP, onChunk, nil)
+	if err != nil {
+		if result != nil {
+			// Partial answer of a cancelled turn
+			return result.Response, err
+		}
+		return "", err
+	}
+	return result.Response, nil
+}
+
+// ChatStreamWithEvents streams the response like ChatStream and additionally
+// reports structured events (reasoning traces, tool errors) to onEvent.
+// Reasoning is returned separately and never added to the history.
+func (a *SimpleChatAgent) ChatStreamWithEvents(ctx context.Context, message string, enableSkills bool, enableMCP bool, onChunk func(context.Context, []byte) error, onEvent StreamEventFunc) (*StreamResult, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -430,141 +706,158 @@ func (a *SimpleChatAgent) ChatStream(ctx context.Context, message string, enable
 	}
 	a.messages = append(a.messages, userMsg)
 
-	toolUsed := false
-	var toolResult string
-	var toolName string
-
-	if a.toolsEnabled {
-		// Stage 1: Select skill if needed (only if user enables Skills)
-		if enableSkills && len(a.skills) > 0 {
-			selectedSkill, err := a.selectSkillForTask(ctx, message)
-			if err != nil {
-				log.Printf("Skill selection error: %v", err)
-			} else if selectedSkill != "" {
-				// Load tools for the selected skill
-				skillTools, err := a.loadSkillTools(selectedSkill)
-				if err != nil {
-					log.Printf("Failed to load skill tools: %v", err)
-				} else {
-					a.selectedSkill = selectedSkill
-
-					// Stage 2: Select specific tool from the skill
-					tool, args, err := a.selectToolForTask(ctx, message, skillTools)
-					if err != nil {
-						log.Printf("Tool selection error: %v", err)
-					} else if tool != nil {
-						// Convert args to JSON string
-						argsJSON, _ := json.MarshalIndent(args, "", "  ")
-						argsStr := string(argsJSON)
-						if argsStr == "null" {
-							argsStr = "{}"
-						}
-
-						// Notify start of tool execution
-						toolName = (*tool).Name()
-						notifyStart := fmt.Sprintf("\n\n> 🛠️ Calling tool **%s**...\n\n", toolName)
-						if err := onChunk(ctx, []byte(notifyStart)); err != nil {
-							log.Printf("Warning: Failed to send tool start notification: %v", err)
-						}
-						fullResponseBuilder.WriteString(notifyStart)
-
-						// Call the tool
-						result, err := (*tool).Call(ctx, argsStr)
-
-						// Notify end of tool execution
-						if err != nil {
-							log.Printf("Tool %s call failed: %v", toolName, err)
-							notifyError := fmt.Sprintf("\n\n> ❌ Tool error: %v\n\n", err)
-							if err := onChunk(ctx, []byte(notifyError)); err != nil {
-								log.Printf("Warning: Failed to send tool error notification: %v", err)
-							}
-							fullResponseBuilder.WriteString(notifyError)
-						} else {
-							toolUsed = true
-							toolResult = result
-							log.Printf("Successfully used tool '%s' from skill '%s'", toolName, selectedSkill)
-
-							// Format result in collapsible details
-							notifyResult := fmt.Sprintf("\n\n<details>\n<summary>Tool Result: %s</summary>\n\n```\n%s\n```\n\n</details>\n\n", toolName, result)
-							if err := onChunk(ctx, []byte(notifyResult)); err != nil {
-								log.Printf("Warning: Failed to send tool result notification: %v", err)
-							}
-							fullResponseBuilder.WriteString(notifyResult)
-						}
-					}
-				}
+	result := &StreamResult{}
+
+	// A write that fails means the client is gone: cancel the turn instead of
+	// generating an answer nobody reads
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	sink := &streamSink{onChunk: onChunk, onEvent: onEvent, abort: abort}
+
+	// Report tool progress in the answer and as structured events. Notices are
+	// kept in the answer even if they could not be sent, like the rest of a
+	// partial answer.
+	hooks := toolHooks{
+		start: func(name string) {
+			notifyStart := fmt.Sprintf("\n\n> 🛠️ Calling tool **%s**...\n\n", name)
+			_ = sink.chunk(ctx, notifyStart)
+			fullResponseBuilder.WriteString(notifyStart)
+		},
+		retry: func(name string, err error) {
+			notifyRetry := fmt.Sprintf("\n\n> 🔁 Retrying tool **%s** with corrected arguments...\n\n", name)
+			_ = sink.chunk(ctx, notifyRetry)
+			fullResponseBuilder.WriteString(notifyRetry)
+		},
+		decided: func(decision sessionpkg.SelectionDecision) {
+			result.Decisions = append(result.Decisions, decision)
+		},
+		done: func(record ToolCallRecord) {
+			result.ToolCalls = append(result.ToolCalls, record)
+
+			if record.Failed() {
+				notifyError := fmt.Sprintf("\n\n> ❌ Tool error: %s\n\n", record.Error)
+				_ = sink.chunk(ctx, notifyError)
+				fullResponseBuilder.WriteString(notifyError)
+
+				_ = sink.event(ctx, events.ToolError{
+					Tool:             record.Tool,
+					Source:           record.Source,
+					Error:            record.Error,
+					ErrorClass:       string(record.ErrorClass),
+					ValidationErrors: record.ValidationErrors,
+					Attempts:         record.Attempts,
+				})
+				return
 			}
-		}
-
-		// If no skill was selected, try MCP tools (only if user enables MCP)
-		if !toolUsed && enableMCP && len(a.mcpTools) > 0 {
-			tool, args, err := a.selectToolForTask(ctx, message, a.mcpTools)
-			if err != nil {
-				log.Printf("MCP tool selection error: %v", err)
-			} else if tool != nil {
-				// Convert args to JSON string
-				argsJSON, _ := json.MarshalIndent(args, "", "  ")
-				argsStr := string(argsJSON)
-				if argsStr == "null" {
-					argsStr = "{}"
-				}
 
-				// Notify start of tool execution
-				toolName = (*tool).Name()
-				notifyStart := fmt.Sprintf("\n\n> 🛠️ Calling tool **%s**...\n\n", toolName)
-				if err := onChunk(ctx, []byte(notifyStart)); err != nil {
-					log.Printf("Warning: Failed to send MCP tool start notification: %v", err)
-				}
-				fullResponseBuilder.WriteString(notifyStart)
+			if record.DryRun {
+				summary := dryRunSummary(record)
+				notifyDryRun := fmt.Sprintf("\n\n> 🧪 %s\n\n", summary)
+				_ = sink.chunk(ctx, notifyDryRun)
+				fullResponseBuilder.WriteString(notifyDryRun)
+
+				_ = sink.event(ctx, events.ToolResult{
+					Tool:   record.Tool,
+					Source: record.Source,
+					Args:   record.Args,
+					DryRun: true,
+					Result: summary,
+				})
+				return
+			}
 
-				// Call the tool
-				result, err := (*tool).Call(ctx, argsStr)
+			// Format result in collapsible details
+			notifyResult := fmt.Sprintf("\n\n<details>\n<summary>Tool Result: %s</summary>\n\n```\n%s\n```\n\n</details>\n\n", record.Tool, record.Result)
+			_ = sink.chunk(ctx, notifyResult)
+			fullResponseBuilder.WriteString(notifyResult)
+		},
+	}
 
-				// Notify end of tool execution
-				if err != nil {
-					log.Printf("MCP tool %s call failed: %v", toolName, err)
-					notifyError := fmt.Sprintf("\n\n> ❌ Tool error: %v\n\n", err)
-					if err := onChunk(ctx, []byte(notifyError)); err != nil {
-						log.Printf("Warning: Failed to send MCP tool error notification: %v", err)
-					}
-					fullResponseBuilder.WriteString(notifyError)
-				} else {
-					toolUsed = true
-					toolResult = result
-					log.Printf("Successfully used MCP tool '%s'", toolName)
-
-					// Format result in collapsible details
-					notifyResult := fmt.Sprintf("\n\n<details>\n<summary>Tool Result: %s</summary>\n\n```\n%s\n```\n\n</details>\n\n", toolName, result)
-					if err := onChunk(ctx, []byte(notifyResult)); err != nil {
-						log.Printf("Warning: Failed to send MCP tool result notification: %v", err)
-					}
-					fullResponseBuilder.WriteString(notifyResult)
-				}
-			}
+	if a.toolsEnabled {
+		record := a.useTools(ctx, message, enableSkills, enableMCP, hooks)
+		// Feed the tool result, or a structured description of its failure, back to the model
+		if record != nil && (record.Failed() || record.Result != "" || record.DryRun) {
+			a.messages = append(a.messages, a.toolResultMessage(*record))
 		}
 	}
+	if sink.err != nil {
+		return a.disconnected(result, fullResponseBuilder.String(), sink.err)
+	}
 
-	// Add tool result to conversation if a tool was used
-	if toolUsed && toolResult != "" {
-		toolMsg := llms.MessageContent{
-			Role: llms.ChatMessageTypeSystem,
-			Parts: []llms.ContentPart{
-				llms.TextPart(fmt.Sprintf("I used the '%s' tool to help with your request. Here's the result:\n\n%s", toolName, toolResult)),
-			},
+	// Route provider reasoning fields and inline <think> blocks away from the answer
+	splitter := &thinkSplitter{}
+	var streamed strings.Builder // answer text sent so far
+	emitReasoning := func(ctx context.Context, chunk string) error {
+		if chunk == "" || a.reasoningMode == ReasoningDiscard {
+			return nil
+		}
+		return sink.event(ctx, events.Reasoning{Chunk: chunk})
+	}
+	streamFunc := func(ctx context.Context, reasoningChunk, chunk []byte) error {
+		if err := emitReasoning(ctx, string(reasoningChunk)); err != nil {
+			return err
+		}
+		content, thinking := splitter.Write(string(chunk))
+		if err := emitReasoning(ctx, thinking); err != nil {
+			return err
 		}
-		a.messages = append(a.messages, toolMsg)
+		if content == "" {
+			return nil
+		}
+		if err := sink.chunk(ctx, content); err != nil {
+			return err
+		}
+		streamed.WriteString(content)
+		return nil
 	}
 
 	// Call LLM with full history and streaming
-	response, err := a.llm.GenerateContent(ctx, a.messages, llms.WithStreamingFunc(onChunk))
+	messages := a.answerMessages(ctx)
+	options := append(a.answerOptions(ctx), llms.WithStreamingReasoningFunc(streamFunc))
+	response, err := a.llm.GenerateContent(ctx, messages, options...)
+	if sink.err != nil {
+		return a.disconnected(result, fullResponseBuilder.String()+streamed.String(), sink.err)
+	}
 	if err != nil {
-		return "", fmt.Errorf("LLM call failed: %w", err)
+		err = fmt.Errorf("LLM call failed: %w", err)
+		if errors.Is(err, context.Canceled) {
+			// The request was cancelled, e.g. by the client going away before a write failed
+			return a.disconnected(result, fullResponseBuilder.String()+streamed.String(), err)
+		}
+		return nil, err
+	}
+
+	if content, thinking := splitter.Flush(); content != "" || thinking != "" {
+		if err := emitReasoning(ctx, thinking); err != nil {
+			log.Printf("Warning: Failed to send reasoning chunk: %v", err)
+		}
+		if content != "" {
+			if err := sink.chunk(ctx, content); err != nil {
+				log.Printf("Warning: Failed to send final chunk: %v", err)
+			}
+		}
 	}
 
-	// Extract response text
+	// Extract response text and reasoning
 	var responseText string
 	if response != nil && len(response.Choices) > 0 {
-		responseText = response.Choices[0].Content
+		responseText, result.Reasoning = splitThinking(response.Choices[0].Content)
+		if response.Choices[0].ReasoningContent != "" {
+			result.Reasoning = strings.TrimSpace(response.Choices[0].ReasoningContent)
+		}
+	}
+	result.Usage = responseUsage(response, messages, responseText+result.Reasoning)
+	if a.reasoningMode == ReasoningDiscard {
+		result.Reasoning = ""
+	}
+
+	// A constrained answer is checked once complete; the answer is the JSON
+	// alone, the tool notices were only streamed
+	if format := responseFormatFrom(ctx); format != nil {
+		if responseText, err = a.conformAnswer(ctx, format, messages, responseText); err != nil {
+			return nil, err
+		}
+		fullResponseBuilder.Reset()
 	}
 
 	// Append LLM response to full response
@@ -578,41 +871,55 @@ func (a *SimpleChatAgent) ChatStream(ctx context.Context, message string, enable
 	}
 	a.messages = append(a.messages, assistantMsg)
 
-	return fullResponse, nil
+	result.Response = fullResponse
+	return result, nil
+}
+
+// disconnected ends a turn that was cancelled, usually because its client
+// went away. The partial answer is returned with the error and kept in the
+// history, so the conversation goes on from what the caller stores.
+func (a *SimpleChatAgent) disconnected(result *StreamResult, partial string, err error) (*StreamResult, error) {
+	if partial != "" {
+		a.messages = append(a.messages, llms.MessageContent{
+			Role:  llms.ChatMessageTypeAI,
+			Parts: []llms.ContentPart{llms.TextPart(partial)},
+		})
+	}
+	result.Response = partial
+	return result, err
 }
 
 // getUserID extracts the authenticated user ID from the request context
 func (cs *ChatServer) getUserID(r *http.Request) string {
-	// Try to get user from context first (for authenticated requests)
-	if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
+	if claims := cs.requestClaims(r); claims != nil {
 		return claims.UserID
 	}
 
-	// Fallback: check token in Authorization header
-	token := r.Header.Get("Authorization")
-	if token != "" && strings.HasPrefix(token, "Bearer ") {
-		tokenStr := strings.TrimPrefix(token, "Bearer ")
-		if claims, err := cs.jwtAuth.ValidateToken(tokenStr); err == nil {
-			return claims.UserID
-		}
-	}
-
-	// Fallback: check token in cookie
-	if cookie, err := r.Cookie("access_token"); err == nil {
-		if claims, err := cs.jwtAuth.ValidateToken(cookie.Value); err == nil {
-			return claims.UserID
-		}
-	}
-
 	// If no authenticated user, return empty string
 	// This should not happen for protected routes
 	return ""
 }
 
+// requestClaims returns the claims of the authenticated user of a request,
+// or nil
+func (cs *ChatServer) requestClaims(r *http.Request) *auth.JWTClaims {
+	// Try to get user from context first (for authenticated requests)
+	if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
+		return claims
+	}
+
+	// Fallback: check the token as the authentication middleware does
+	if claims, err := cs.jwtAuth.Authenticate(r); err == nil {
+		return claims
+	}
+	return nil
+}
+
 // getClientID generates a unique client ID based on authenticated user ID
+// and workspace
 func (cs *ChatServer) getClientID(r *http.Request) string {
-	userID := cs.getUserID(r)
-	if userID == "" {
+	claims := cs.requestClaims(r)
+	if claims == nil || claims.UserID == "" {
 		// This should not happen for protected routes, but handle gracefully
 		// Fallback to IP-based ID for unauthenticated access (should be redirected to login)
 		clientIP := r.Header.Get("X-Forwarded-For")
@@ -633,22 +940,27 @@ func (cs *ChatServer) getClientID(r *http.Request) string {
 		return fmt.Sprintf("fallback_%x", h.Sum(nil))[:16]
 	}
 
-	// Return the actual user ID
-	return userID
+	// Members of a workspace keep their state apart from the other users
+	return workspace.UserKey(claims.Workspace, claims.UserID)
 }
 
 // ChatServer manages HTTP endpoints and chat agents
 type ChatServer struct {
 	maxHistory      int
 	sessionDir      string
-	agents          map[string]ChatAgent
+	agents          map[string]ChatAgent // sessionID -> agent
+	warmupAgent     *SimpleChatAgent     // agent built at startup, kept apart from the session agents
 	llm             llms.Model
+	auxLLM          llms.Model // selection, tags, memories and suggestions
 	agentMu         sync.RWMutex
 	port            string
-	config          configpkg.Config
+	config          atomic.Pointer[configpkg.Config]      // active config; replaced on reload, never modified
 	sessionManagers map[string]*sessionpkg.SessionManager // clientID -> SessionManager
+	smLastUsed      map[string]time.Time                  // clientID -> when its SessionManager was last handed out
 	smMu            sync.RWMutex
 	requestSem      chan struct{} // Semaphore for controlling concurrent requests
+	taggingSem      chan struct{} // Limits concurrent background tagging calls
+	memorySem       chan struct{} // Limits concurrent background memory extraction calls
 	maxConcurrent   int           // Maximum number of concurrent requests
 
 	// New components for enterprise features
@@ -656,6 +968,51 @@ type ChatServer struct {
 	metricsCollector *monitoringpkg.MetricsCollector
 	configManager    *configpkg.Manager
 	healthChecker    *monitoringpkg.HealthChecker
+	healthServer     *http.Server // dedicated health probe server; nil unless monitoring.health_port is set
+	healthServerMu   sync.Mutex
+	auditLogger      *audit.Logger
+	dataset          *dataset.Logger // nil when dataset logging is disabled
+	sandbox          *sandbox.Sandbox
+	loadShedder      *loadShedder
+	egress           *httpclient.EgressGuard // checks outbound connections of the default transport
+	prompts          *prompts.Set
+	environment      configpkg.Environment
+	demoUsers        bool                // whether demo accounts were created at startup
+	pricing          *usage.Pricing      // nil when usage reporting is disabled
+	llmBreaker       *breaker.Breaker    // nil when the LLM circuit breaker is disabled
+	llmProbe         *llmProbe           // nil when LLM.SkipStartupProbe is set
+	budget           *budget.Tracker     // nil when token budgets are disabled
+	toolQuotas       *budget.ToolTracker // nil when tool quotas are disabled
+	activity         *activity.Tracker   // nil when activity tracking is disabled
+	workspaces       *workspace.Store    // nil when workspaces are disabled
+	faults           *faults.Injector    // nil when fault injection is disabled
+	skillInstaller   *skills.Installer
+	maintenance      maintenanceState
+	capacity         capacityAlerts
+	adminEvents      adminEventHub
+	sessionEvents    sessionEventHub
+	experimentStats  *experiment.Stats
+	selectionStats   *selectionStats
+	agentPool        *agentPool // nil when the warm agent pool is disabled
+	privacy          *privacy.Filter
+	previewRedactor  *redact.Redactor // nil when session list previews are not redacted
+	secrets          *secrets.Box     // nil when no encryption key is set
+	chatPipeline     *ChatPipeline    // stages of HandleChat
+	editPipeline     *ChatPipeline    // stages of HandleEditMessage
+	regenPipeline    *ChatPipeline    // stages of HandleRegenerate
+	mcpServers       *mcpServerPool   // lazily started MCP servers of all agents
+	httpServer       *http.Server     // set by Start
+	pages            *staticPages     // loaded by Start
+	assets           *assetManifest   // versioned static asset paths, loaded by Start
+	httpServerMu     sync.Mutex
+	listening        chan struct{} // closed by Start once the listener is bound
+
+	// Components stopped on shutdown, in registration order; see registerComponents
+	components   []namedComponent
+	componentsMu sync.Mutex
+	shutdown     chan struct{} // closed when the server starts shutting down
+	closeOnce    sync.Once
+	closeErr     error
 
 	// Authentication components
 	authService   *auth.AuthService
@@ -667,7 +1024,7 @@ type ChatServer struct {
 // NewChatServer creates a new chat server
 func NewChatServer(sessionDir string, maxHistory int, port string, configPath string) (*ChatServer, error) {
 	// Initialize configuration manager
-	configManager := configpkg.NewManager(configpkg.Development)
+	configManager := configpkg.NewManager(configpkg.EnvironmentFromEnv())
 	if _, err := os.Stat(configPath); err == nil {
 		if err := configManager.Load(configPath); err != nil {
 			log.Printf("Warning: Failed to load config from file: %v", err)
@@ -696,40 +1053,92 @@ func NewChatServer(sessionDir string, maxHistory int, port string, configPath st
 		config.LLM.BaseURL = os.Getenv("OPENAI_API_BASE")
 	}
 
-	// Create OpenAI LLM (works with OpenAI-compatible APIs like Baidu)
-	var llm llms.Model
-	var err error
+	// Keep user content and credentials out of the logs from here on
+	logPolicy := redact.NewLogPolicy(config.Logging, config.LLM.APIKey, config.LLM.AuxAPIKey, config.Security.JWTSecret)
+	redact.SetLogPolicy(logPolicy)
+	log.SetOutput(logPolicy.Writer(log.Writer()))
 
-	if config.LLM.BaseURL != "" {
-		llm, err = openai.New(
-			openai.WithModel(config.LLM.Model),
-			openai.WithToken(config.LLM.APIKey),
-			openai.WithBaseURL(config.LLM.BaseURL),
-		)
-	} else {
-		llm, err = openai.New(
-			openai.WithModel(config.LLM.Model),
-			openai.WithToken(config.LLM.APIKey),
-		)
+	// Refuse to start in production with unsafe settings unless explicitly allowed
+	if err := checkStartupSecurity(config, configManager.Environment()); err != nil {
+		return nil, err
+	}
+
+	// Route outbound requests through the configured proxy and CA bundle
+	var llmClient *http.Client
+	if httpclient.Configured(config.LLM) {
+		client, err := httpclient.New(config.LLM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure outbound HTTP client: %w", err)
+		}
+		llmClient = client
+		// The built-in web tools and MCP SSE clients use the default transport
+		http.DefaultTransport = client.Transport
+		if config.LLM.ProxyURL != "" {
+			if proxyURL, err := url.Parse(config.LLM.ProxyURL); err == nil {
+				log.Printf("🌐 Outbound requests use proxy %s", proxyURL.Redacted())
+			}
+		}
+		if config.LLM.CABundle != "" {
+			log.Printf("🔏 Outbound requests trust the CA bundle %s", config.LLM.CABundle)
+		}
+	}
+
+	// Outbound connections of the built-in tools and MCP SSE clients are
+	// checked against the egress policy below; the LLM endpoint is set by the
+	// operator, so the LLM keeps the unchecked transport
+	egressPolicy, err := httpclient.NewEgressPolicy(config.Security.Egress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid egress policy: %w", err)
+	}
+	if llmClient == nil {
+		llmClient = &http.Client{Transport: http.DefaultTransport}
 	}
 
+	// Create the OpenAI LLMs (works with OpenAI-compatible APIs like Baidu);
+	// auxiliary calls may use a cheaper model or an endpoint of their own
+	llm, auxLLM, err := newModels(config.LLM, llmClient)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create LLM: %w", err)
+		return nil, err
+	}
+	if auxConfigured(config.LLM) {
+		log.Printf("🧩 Auxiliary LLM calls use model %s", auxModelName(config.LLM))
 	}
 
 	// Initialize monitoring components
 	metricsCollector := monitoringpkg.NewMetricsCollector()
+	buildInfo := version.Get()
+	metricsCollector.SetBuildInfo(buildInfo.Version, buildInfo.Commit, buildInfo.GoVersion,
+		buildInfo.Dependencies["github.com/tmc/langchaingo"], buildInfo.Dependencies["github.com/smallnest/goskills"])
 	healthChecker := monitoringpkg.NewHealthChecker()
 
-	// Start metrics server if monitoring is enabled
-	if config.Monitoring.Enabled {
-		go func() {
-			metricsServer := monitoringpkg.NewMetricsServer(metricsCollector, config.Monitoring.MetricsPort)
-			log.Printf("🔧 Starting metrics server on port %d", config.Monitoring.MetricsPort)
-			if err := metricsServer.Start(); err != nil {
-				log.Printf("Failed to start metrics server: %v", err)
-			}
-		}()
+	// Injected faults go through the breaker like real ones
+	if config.Testing.FaultInjection.Enabled && configManager.Environment() == configpkg.Production {
+		return nil, fmt.Errorf("fault injection cannot be enabled in the production environment")
+	}
+	faultInjector := faults.New(config.Testing.FaultInjection, func(target string, fault faults.Fault) {
+		metricsCollector.RecordInjectedFault(target, string(fault))
+	})
+	if faultInjector != nil {
+		log.Printf("🧪 Fault injection enabled (header: %s); do not use this server for real traffic", config.Testing.FaultInjection.Header)
+		llm = faultInjector.WrapModel(llm)
+		auxLLM = faultInjector.WrapModel(auxLLM)
+	}
+
+	// The metrics tell answers and auxiliary calls apart, so the cost split is visible
+	llm = newMeteredModel(llm, config.LLM.Provider, config.LLM.Model, llmPurposeChat, metricsCollector)
+	auxLLM = newMeteredModel(auxLLM, config.LLM.Provider, auxModelName(config.LLM), llmPurposeAux, metricsCollector)
+
+	// Fail fast while the provider is down instead of waiting for every request
+	// to time out. Auxiliary calls to the same endpoint share the breaker.
+	var llmBreaker *breaker.Breaker
+	if config.LLM.Breaker.Enabled {
+		guarded := newBreakerModel(llm, config.LLM.Provider, config.LLM, metricsCollector)
+		llm, llmBreaker = guarded, guarded.breaker
+		if config.LLM.AuxBaseURL != "" {
+			auxLLM = newBreakerModel(auxLLM, config.LLM.Provider+"_aux", config.LLM, metricsCollector)
+		} else {
+			auxLLM = &breakerModel{Model: auxLLM, breaker: llmBreaker}
+		}
 	}
 
 	// Initialize agent lifecycle manager
@@ -738,6 +1147,7 @@ func NewChatServer(sessionDir string, maxHistory int, port string, configPath st
 	lifecycleConfig.HealthCheckInterval = config.Agent.HealthCheckInterval
 	lifecycleConfig.MaxRetries = config.Agent.MaxRetries
 	lifecycleConfig.RetryDelay = config.Agent.RetryDelay
+	lifecycleConfig.EventHistory = config.Agent.EventHistory
 	lifecycleManager := agentpkg.NewAgentLifecycleManager(lifecycleConfig)
 
 	// Set lifecycle event handler
@@ -757,13 +1167,23 @@ func NewChatServer(sessionDir string, maxHistory int, port string, configPath st
 		return nil
 	})
 
+	// The endpoint is probed in the background once the components start, so
+	// an unreachable endpoint degrades the health instead of failing startup
+	var probe *llmProbe
+	if !config.LLM.SkipStartupProbe {
+		if probe, err = newLLMProbe(cmp.Or(config.LLM.BaseURL, defaultLLMBaseURL), llmClient); err != nil {
+			return nil, err
+		}
+	}
 	healthChecker.RegisterCheck("llm_connection", func(ctx context.Context) error {
-		// Simple check - in a real implementation, you might test the LLM connection
 		if llm == nil {
 			return fmt.Errorf("LLM is not initialized")
 		}
-		return nil
+		return probe.Err()
 	})
+	if llmBreaker != nil {
+		healthChecker.RegisterCheck("llm_circuit_breaker", llmBreakerCheck(llmBreaker))
+	}
 
 	// Initialize authentication components
 	jwtAuth := middleware.NewAuthMiddleware(
@@ -779,17 +1199,137 @@ func NewChatServer(sessionDir string, maxHistory int, port string, configPath st
 	)
 
 	// Create demo users for testing
-	if err := authService.CreateDemoUsers(); err != nil {
-		log.Printf("Warning: Failed to create demo users: %v", err)
+	if config.Security.DemoUsers {
+		if err := authService.CreateDemoUsers(); err != nil {
+			log.Printf("Warning: Failed to create demo users: %v", err)
+		}
 	}
 
-	authAPI := api.NewAuthAPI(authService, jwtAuth)
-	staticHandler := api.NewStaticHandler(authAPI)
+	// Initialize audit logging and the tool sandbox
+	auditLogger, err := audit.NewLogger(config.Logging.AuditFile)
+	if err != nil {
+		log.Printf("Warning: Failed to open audit log, falling back to standard log: %v", err)
+		auditLogger, _ = audit.NewLogger("")
+	}
+	toolSandbox := sandbox.New(config.Tools.Sandbox, auditLogger)
+
+	egressGuard := httpclient.NewEgressGuard(egressPolicy, func(v httpclient.EgressViolation) {
+		log.Printf("Warning: Blocked outbound connection to %s (%s): %s", v.Host, v.IP, v.Reason)
+		auditLogger.Log(audit.Event{
+			Action:   "egress.violation",
+			Resource: v.Host,
+			Result:   "denied",
+			Details: map[string]any{
+				"ip":     v.IP,
+				"reason": v.Reason,
+			},
+		})
+	})
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		http.DefaultTransport = egressGuard.Transport(transport)
+	} else {
+		log.Printf("Warning: Default HTTP transport is replaced, egress policy is not enforced")
+	}
+	if egressPolicy.Active() {
+		log.Printf("🧱 Outbound connections of tools are restricted (block private: %v, allow: %d, deny: %d)",
+			config.Security.Egress.BlockPrivate, len(config.Security.Egress.Allow), len(config.Security.Egress.Deny))
+	}
+	if toolSandbox.Enabled() {
+		log.Printf("🔒 Tool sandbox enabled (root: %s, read-only: %v)", config.Tools.Sandbox.Root, config.Tools.Sandbox.ReadOnly)
+	}
 
-	// Set default max concurrent requests from configuration
-	maxConcurrent := config.Agent.MaxConcurrent
+	// Sampled prompt/response logging for offline evaluation
+	datasetLogger, err := dataset.NewLogger(config.Dataset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize dataset logging: %w", err)
+	}
+	if datasetLogger != nil {
+		log.Printf("🧪 Dataset logging enabled (dir: %s, sample rate: %v)", config.Dataset.Dir, config.Dataset.SampleRate)
+	}
 
-	server := &ChatServer{
+	// Daily token budgets
+	budgetTracker, err := budget.New(config.Budget)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize token budgets: %w", err)
+	}
+	if budgetTracker != nil {
+		log.Printf("💰 Token budgets enabled (timezone: %s, state: %s)", config.Budget.Timezone, config.Budget.StatePath)
+	}
+	toolQuotas, err := budget.NewToolTracker(config.Tools.Quotas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize tool quotas: %w", err)
+	}
+	if toolQuotas != nil {
+		log.Printf("🧮 Tool quotas enabled for %d tools (timezone: %s, state: %s)", len(config.Tools.Quotas.Limits), config.Tools.Quotas.Timezone, config.Tools.Quotas.StatePath)
+	}
+
+	// Last-seen times and hourly message counts for the admin activity views
+	activityTracker, err := activity.New(config.Activity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize activity tracking: %w", err)
+	}
+
+	// Teams hosted on the server with their own sessions and config overrides
+	workspaceStore, err := workspace.New(config.Workspaces)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize workspaces: %w", err)
+	}
+	if workspaceStore != nil {
+		log.Printf("🏢 Workspaces enabled (%d workspaces, state: %s)", len(workspaceStore.List()), config.Workspaces.StatePath)
+	}
+
+	// Installation of skill packages through the admin API
+	skillInstaller, err := skills.NewInstaller(skillsDir(), config.Skills)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize skill installation: %w", err)
+	}
+
+	// Privacy mode of admin exports
+	privacyFilter, err := privacy.New(config.Privacy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize export privacy: %w", err)
+	}
+
+	// Redaction of the session list, with the patterns of exports
+	var previewRedactor *redact.Redactor
+	if config.UI.RedactPreviews {
+		previewRedactor, err = redact.New(config.Privacy.RedactPatterns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize preview redaction: %w", err)
+		}
+	}
+
+	// Encryption of user secrets
+	secretBox, err := secrets.New(config.Security.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize secrets: %w", err)
+	}
+
+	authService.SetMetricsCollector(metricsCollector)
+	authService.SetRegistrationMode(config.Security.RegistrationMode)
+	authAPI := api.NewAuthAPI(authService, jwtAuth, metricsCollector)
+	authAPI.SetAuditLogger(auditLogger)
+	if sender := mail.New(config.SMTP); sender != nil {
+		authService.SetEmailVerification(true)
+		authAPI.SetEmailVerifier(sender, config.Server.PublicURL, config.Security.Verification.TokenTTL, config.Security.Verification.ResendInterval)
+		log.Printf("📧 Email verification enabled via %s", config.SMTP.Host)
+	}
+	jwtAuth.SetRefresher(authAPI)
+	staticHandler := api.NewStaticHandler(authAPI)
+
+	// Load and validate the selection prompt templates
+	promptSet, err := prompts.Load(config.Agent.PromptsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prompt templates: %w", err)
+	}
+	if config.Agent.PromptsDir != "" {
+		log.Printf("📝 Loaded prompt templates from %s", config.Agent.PromptsDir)
+	}
+
+	// Set default max concurrent requests from configuration
+	maxConcurrent := config.Agent.MaxConcurrent
+
+	server := &ChatServer{
 		authService:      authService,
 		jwtAuth:          jwtAuth,
 		authAPI:          authAPI,
@@ -798,37 +1338,105 @@ func NewChatServer(sessionDir string, maxHistory int, port string, configPath st
 		sessionDir:       sessionDir,
 		agents:           make(map[string]ChatAgent),
 		llm:              llm,
+		auxLLM:           auxLLM,
+		llmBreaker:       llmBreaker,
+		llmProbe:         probe,
+		budget:           budgetTracker,
+		toolQuotas:       toolQuotas,
+		activity:         activityTracker,
+		workspaces:       workspaceStore,
+		faults:           faultInjector,
+		skillInstaller:   skillInstaller,
 		port:             port,
-		config:           *config,
 		sessionManagers:  make(map[string]*sessionpkg.SessionManager),
+		smLastUsed:       make(map[string]time.Time),
 		requestSem:       make(chan struct{}, maxConcurrent),
+		taggingSem:       make(chan struct{}, 2),
+		memorySem:        make(chan struct{}, 2),
 		maxConcurrent:    maxConcurrent,
 		lifecycleManager: lifecycleManager,
 		metricsCollector: metricsCollector,
 		configManager:    configManager,
 		healthChecker:    healthChecker,
-	}
+		auditLogger:      auditLogger,
+		dataset:          datasetLogger,
+		experimentStats:  experiment.NewStats(),
+		selectionStats:   newSelectionStats(),
+		privacy:          privacyFilter,
+		previewRedactor:  previewRedactor,
+		secrets:          secretBox,
+		mcpServers:       newMCPServerPool(config.Tools.MCP),
+		sandbox:          toolSandbox,
+		loadShedder:      &loadShedder{},
+		egress:           egressGuard,
+		prompts:          promptSet,
+		environment:      configManager.Environment(),
+		demoUsers:        config.Security.DemoUsers,
+		shutdown:         make(chan struct{}),
+		listening:        make(chan struct{}),
+	}
+	server.config.Store(config)
+	server.chatPipeline = server.newChatPipeline()
+	server.editPipeline = server.newEditPipeline()
+	server.regenPipeline = server.newRegeneratePipeline()
+	if budgetTracker != nil {
+		server.updateBudgetGauges()
+	}
+	healthChecker.RegisterCheck("session_storage", server.sessionStorageCheck)
+	if config.Usage.Enabled {
+		server.pricing = usage.NewPricing(config.Usage.Pricing)
+	}
+	if config.Agent.PoolSize > 0 {
+		// Sandboxed tools are bound to their session, so they can only be loaded after assignment
+		server.agentPool = newAgentPool(config.Agent.PoolSize, server.newAgent, !toolSandbox.Enabled(), metricsCollector)
+		log.Printf("🔥 Warm agent pool enabled (size: %d)", config.Agent.PoolSize)
+	}
+
+	// Report configuration hot-reloads
+	metricsCollector.SetConfigHash(configpkg.Hash(config))
+	configManager.OnReload(server.handleConfigReload)
 
 	// Initialize lifecycle manager
 	if err := lifecycleManager.SetState(agentpkg.StateInitializing, "Server starting", nil); err != nil {
 		log.Printf("Warning: Failed to set initial lifecycle state: %v", err)
 	}
 
+	// Background work of the components is stopped again by Close
+	server.registerComponents()
+	if err := server.startComponents(context.Background()); err != nil {
+		return nil, err
+	}
+
 	return server, nil
 }
 
-// getSessionManager gets or creates a SessionManager for a specific user
+// getSessionManager gets or creates a SessionManager for a specific user. At
+// the configured cap the least recently used idle manager is evicted first;
+// when none is idle the cap is exceeded, except for the anonymous namespaces
+// rejected by limitNamespaces.
 func (cs *ChatServer) GetSessionManager(userID string) *sessionpkg.SessionManager {
 	cs.smMu.Lock()
 	defer cs.smMu.Unlock()
 
 	sm, exists := cs.sessionManagers[userID]
 	if !exists {
+		config := cs.GetConfig()
+		cs.roomForSessionManagerLocked()
 		userSessionDir := fmt.Sprintf("%s/users/%s", cs.sessionDir, userID)
-		store := sessionpkg.NewFileSessionStore(userSessionDir)
+		store, err := sessionpkg.NewStore(config.Database, config.Cache, userSessionDir)
+		if err != nil {
+			log.Printf("Warning: Failed to open session store, falling back to files: %v", err)
+			store = sessionpkg.NewFileSessionStore(userSessionDir, sessionpkg.WithCompression(config.Database.Compression))
+		}
 		sm = sessionpkg.NewSessionManager(store, cs.maxHistory)
+		sm.SetSaveFailureHook(func(error) { cs.metricsCollector.RecordSessionSaveFailure() })
+		sm.SetPreviewRedactor(cs.previewRedactor)
+		// Keep disk latency out of chat turns; flushed in Close
+		sm.EnableWriteBehind(config.Database.WriteQueueSize)
 		cs.sessionManagers[userID] = sm
+		cs.reportCapacity(&cs.capacity.managers, "session_managers", len(cs.sessionManagers), config.Agent.MaxSessionManagers)
 	}
+	cs.smLastUsed[userID] = time.Now()
 	return sm
 }
 
@@ -839,6 +1447,7 @@ func (cs *ChatServer) GetOrCreateAgent(sessionID string) (ChatAgent, error) {
 	cs.agentMu.RUnlock()
 
 	if exists {
+		touchAgent(agent)
 		return agent, nil
 	}
 
@@ -848,31 +1457,55 @@ func (cs *ChatServer) GetOrCreateAgent(sessionID string) (ChatAgent, error) {
 
 	// Double-check after acquiring write lock
 	if agent, exists := cs.agents[sessionID]; exists {
+		touchAgent(agent)
 		return agent, nil
 	}
+	cs.roomForAgentLocked()
+	defer cs.reportAgentCapacityLocked()
 
 	// Try to use the warmup agent configuration but create a new instance
-	if warmupAgent, exists := cs.agents["__warmup__"]; exists {
-		log.Printf("Using pre-warmed agent configuration for session %s", sessionID)
+	if warmupAgent := cs.warmupAgent; warmupAgent != nil {
+		log.Printf("Using pre-warmed agent configuration for session %s", redact.LogID(sessionID))
 		// Don't reuse the warmup agent instance to avoid state sharing issues
 		// Instead, create a new agent with the same configuration
 		// Clean up the warmup agent asynchronously
-		go func() {
-			if warmupAgentCloser, ok := warmupAgent.(interface{ Close() error }); ok {
-				warmupAgentCloser.Close()
+		go warmupAgent.Close()
+		cs.warmupAgent = nil
+	}
+
+	// Take a warm agent from the pool; its tools are already loaded unless they are sandboxed
+	if cs.agentPool != nil {
+		if simpleAgent, ok := cs.agentPool.get(); ok {
+			simpleAgent.SetSandbox(cs.sandbox, sessionID)
+			simpleAgent.SetPrompts(cs.prompts)
+			simpleAgent.touch()
+			cs.agents[sessionID] = simpleAgent
+			if !cs.agentPool.preload {
+				simpleAgent.InitializeToolsAsync()
 			}
-		}()
-		delete(cs.agents, "__warmup__")
+			return simpleAgent, nil
+		}
 	}
 
 	// Create a new agent instance for this session
-	agent = NewSimpleChatAgent(cs.llm, cs.config)
-	cs.agents[sessionID] = agent
+	simpleAgent := cs.newAgent()
+	simpleAgent.SetSandbox(cs.sandbox, sessionID)
+	simpleAgent.touch()
+	cs.agents[sessionID] = simpleAgent
 
 	// Initialize tools asynchronously to avoid blocking
-	agent.(*SimpleChatAgent).InitializeToolsAsync()
+	simpleAgent.InitializeToolsAsync()
 
-	return agent, nil
+	return simpleAgent, nil
+}
+
+// newAgent constructs an agent with the server's configuration, not yet bound to a session
+func (cs *ChatServer) newAgent() *SimpleChatAgent {
+	agent := NewSimpleChatAgent(cs.llm, *cs.GetConfig())
+	agent.SetAuxLLM(cs.auxLLM)
+	agent.SetPrompts(cs.prompts)
+	agent.SetMCPServers(cs.mcpServers)
+	return agent
 }
 
 // GetWarmupAgent returns the warmup agent for reuse
@@ -880,17 +1513,24 @@ func (cs *ChatServer) GetWarmupAgent() *SimpleChatAgent {
 	cs.agentMu.Lock()
 	defer cs.agentMu.Unlock()
 
-	if warmupAgent, exists := cs.agents["__warmup__"]; exists {
-		return warmupAgent.(*SimpleChatAgent)
-	}
-	return nil
+	return cs.warmupAgent
+}
+
+// Listening returns a channel that is closed once Start has bound the
+// listener of the main server. It is never closed if Start fails before that.
+func (cs *ChatServer) Listening() <-chan struct{} {
+	return cs.listening
 }
 
 // SetWarmupAgent stores a warmup agent for reuse
 func (cs *ChatServer) SetWarmupAgent(agent *SimpleChatAgent) {
+	agent.SetAuxLLM(cs.auxLLM)
+	agent.SetPrompts(cs.prompts)
+	agent.SetMCPServers(cs.mcpServers)
+
 	cs.agentMu.Lock()
 	defer cs.agentMu.Unlock()
-	cs.agents["__warmup__"] = agent
+	cs.warmupAgent = agent
 }
 
 // GetLLM returns the LLM instance
@@ -898,9 +1538,31 @@ func (cs *ChatServer) GetLLM() llms.Model {
 	return cs.llm
 }
 
-// GetConfig returns the server config
+// GetConfig returns a snapshot of the active server config. A reload
+// replaces the snapshot instead of updating it, so callers may keep reading
+// it but must not modify it.
 func (cs *ChatServer) GetConfig() *configpkg.Config {
-	return &cs.config
+	return cs.config.Load()
+}
+
+// reloadConfig replaces the config snapshot with the reloaded config. The
+// LLM, server, database and monitoring sections are only read at startup, so
+// they keep their running values until a restart.
+func (cs *ChatServer) reloadConfig() {
+	config := cs.configManager.Get()
+	current := cs.config.Load()
+	config.LLM = current.LLM
+	config.Server = current.Server
+	config.Database = current.Database
+	config.Monitoring = current.Monitoring
+	cs.config.Store(config)
+
+	if policy, err := httpclient.NewEgressPolicy(config.Security.Egress); err != nil {
+		log.Printf("Warning: Failed to reload egress policy, keeping previous one: %v", err)
+	} else {
+		cs.egress.SetPolicy(policy)
+	}
+	cs.authService.SetRegistrationMode(config.Security.RegistrationMode)
 }
 
 // GetLifecycleManager returns the agent lifecycle manager
@@ -944,399 +1606,396 @@ func (cs *ChatServer) releaseRequest() {
 }
 
 // HandleIndex serves the main HTML page
-func (cs *ChatServer) HandleIndex(w http.ResponseWriter, r *http.Request, staticFS fs.FS) {
+func (cs *ChatServer) HandleIndex(w http.ResponseWriter, r *http.Request) {
 	// Serve index.html for root path and session routes (SPA support)
 	if r.URL.Path != "/" && !strings.HasPrefix(r.URL.Path, "/sessions/") {
 		http.NotFound(w, r)
 		return
 	}
+	cs.pages.index.serve(w, r)
+}
 
-	// Read index.html from embedded filesystem
-	data, err := fs.ReadFile(staticFS, "static/index.html")
-	if err != nil {
-		http.Error(w, "Failed to load page", http.StatusInternalServerError)
-		log.Printf("Failed to read index.html: %v", err)
+// HandleIndex2 serves the alternative HTML page
+func (cs *ChatServer) HandleIndex2(w http.ResponseWriter, r *http.Request) {
+	cs.pages.index2.serve(w, r)
+}
+
+// HandleNewSession creates a new chat session. The optional JSON body may
+// choose a configured persona, whose greeting replaces the default one, and
+// set session variables, which are substituted in the greeting.
+func (cs *ChatServer) HandleNewSession(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfMaintenance(w) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if _, err := w.Write(data); err != nil {
-		log.Printf("Warning: Failed to write index.html: %v", err)
+	var req struct {
+		Persona   string            `json:"persona"`
+		Variables map[string]string `json:"variables"` // substituted in the greeting and later messages
 	}
-}
-
-// HandleIndex2 serves the alternative HTML page
-func (cs *ChatServer) HandleIndex2(w http.ResponseWriter, r *http.Request, staticFS fs.FS) {
-	// Read index2.html from embedded filesystem
-	data, err := fs.ReadFile(staticFS, "static/index2.html")
-	if err != nil {
-		http.Error(w, "Failed to load page", http.StatusInternalServerError)
-		log.Printf("Failed to read index2.html: %v", err)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if _, err := w.Write(data); err != nil {
-		log.Printf("Warning: Failed to write index2.html: %v", err)
+	if err := sessionpkg.ValidateVariables(req.Variables); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-}
 
-// HandleNewSession creates a new chat session
-func (cs *ChatServer) HandleNewSession(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	uiConfig := cs.configFor(r).UI
+	greeting := uiConfig.GreetingMessage
+	if req.Persona != "" {
+		persona, ok := uiConfig.Persona(req.Persona)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown persona: %s", req.Persona), http.StatusBadRequest)
+			return
+		}
+		if persona.Greeting != "" {
+			greeting = persona.Greeting
+		}
+	}
+	greeting, ok := expandSessionVariables(w, greeting, req.Variables)
+	if !ok {
 		return
 	}
 
 	userID := cs.getClientID(r)
 	sm := cs.GetSessionManager(userID)
 	session := sm.CreateSession()
+	if len(req.Variables) > 0 {
+		if _, err := sm.SetSessionVariables(session.ID, req.Variables); err != nil {
+			log.Printf("Warning: Failed to save variables of session %s: %v", redact.LogID(session.ID), err)
+		}
+	}
+
+	// Saving the greeting also persists the session, so it shows up in history
+	var greetingMsg *sessionpkg.Message
+	if greeting != "" || req.Persona != "" {
+		msg, err := sm.StartSession(session.ID, req.Persona, greeting)
+		if err != nil {
+			log.Printf("Warning: Failed to save greeting of session %s: %v", redact.LogID(session.ID), err)
+		}
+		greetingMsg = msg
+	}
 
 	// Set user ID cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:     "user_id",
 		Value:    userID,
-		Path:     "/",
+		Path:     middleware.CookiePath(r),
 		MaxAge:   86400 * 30, // 30 days
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
 	})
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]string{
+	response := map[string]any{
 		"session_id": session.ID,
 		"user_id":    userID,
-	}); err != nil {
+	}
+	if req.Persona != "" {
+		response["persona"] = req.Persona
+	}
+	if len(req.Variables) > 0 {
+		response["variables"] = req.Variables
+	}
+	if greetingMsg != nil {
+		response["greeting"] = greetingMsg
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Warning: Failed to encode new session response: %v", err)
 	}
 }
 
-// HandleListSessions returns all active sessions for the client
+// HandleListSessions returns all active sessions for the client.
+// The optional folder_id query parameter restricts the list to one folder ("root" for unfiled sessions),
+// and tag to sessions carrying that tag. The list has an ETag that changes with any session of the
+// user, and conditional requests get 304 Not Modified. With limit, offset or cursor, one page of the
+// list is returned, with the total and the cursor of the next page. Pinned sessions come first, and
+// each group is ordered most recently updated first.
 func (cs *ChatServer) HandleListSessions(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	query := r.URL.Query()
+	paginated := query.Has("limit") || query.Has("offset") || query.Has("cursor")
+	offset, limit, err := sessionPageParams(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	userID := cs.getClientID(r)
 	sm := cs.GetSessionManager(userID)
-	sessions := sm.ListSessions()
+	// Read before the sessions, so a concurrent change gets a new tag
+	version := sm.ListVersion()
+	if checkNotModified(w, r, userID, version) {
+		return
+	}
+
+	folderFilter, filterByFolder := query.Get("folder_id"), query.Has("folder_id")
+	tagFilter := query.Get("tag")
+	includeArchived := query.Get("archived") == "true"
+	if folderFilter == "root" {
+		folderFilter = ""
+	}
+	keep := func(session *sessionpkg.Session) bool {
+		summary := session.Summary()
+		if filterByFolder && summary.FolderID != folderFilter {
+			return false
+		}
+		if tagFilter != "" && !session.HasTag(tagFilter) {
+			return false
+		}
+		return includeArchived || !summary.Archived
+	}
+
+	// Unpaginated, the whole list is one page
+	if !paginated {
+		offset, limit = 0, 0
+	}
+	sessions, total := sm.ListSessionsPage(offset, limit, keep)
 
 	type SessionInfo struct {
-		ID           string    `json:"id"`
-		Title        string    `json:"title"`
-		MessageCount int       `json:"message_count"`
-		CreatedAt    time.Time `json:"created_at"`
-		UpdatedAt    time.Time `json:"updated_at"`
+		ID            string    `json:"id"`
+		FolderID      string    `json:"folder_id,omitempty"`
+		Tags          []string  `json:"tags,omitempty"`
+		Archived      bool      `json:"archived,omitempty"`
+		Pinned        bool      `json:"pinned,omitempty"`
+		Title         string    `json:"title"`
+		MessageCount  int       `json:"message_count"`
+		LastAssistant string    `json:"last_assistant,omitempty"` // first line of the last answer
+		LastActivity  string    `json:"last_activity,omitempty"`  // first line of the last message
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
 	}
 
 	sessionInfos := make([]SessionInfo, 0, len(sessions))
 	for _, session := range sessions {
-		// Get the first user message as title
-		title := "新会话"
-		for _, msg := range session.Messages {
-			if msg.Role == "user" {
-				// Convert string to rune slice to properly handle UTF-8 characters
-				runes := []rune(msg.Content)
-				if len(runes) > 20 {
-					title = string(runes[:20]) + "..."
-				} else {
-					title = msg.Content
-				}
-				break
-			}
-		}
-
+		// The preview is maintained as messages are added, so the messages are not read
+		summary := session.Summary()
 		sessionInfos = append(sessionInfos, SessionInfo{
-			ID:           session.ID,
-			Title:        title,
-			MessageCount: len(session.Messages),
-			CreatedAt:    session.CreatedAt,
-			UpdatedAt:    session.UpdatedAt,
+			ID:            summary.ID,
+			FolderID:      summary.FolderID,
+			Tags:          summary.Tags,
+			Archived:      summary.Archived,
+			Pinned:        summary.Pinned,
+			Title:         summary.Preview.Title,
+			MessageCount:  summary.Preview.MessageCount,
+			LastAssistant: summary.Preview.LastAssistant,
+			LastActivity:  summary.Preview.LastActivity,
+			CreatedAt:     summary.CreatedAt,
+			UpdatedAt:     summary.UpdatedAt,
 		})
 	}
 
+	// Without paging parameters the bare list is returned, as before paging existed
+	var response any = sessionInfos
+	if paginated {
+		page := map[string]any{
+			"sessions": sessionInfos,
+			"total":    total,
+		}
+		if next := offset + len(sessionInfos); next < total {
+			page["next_cursor"] = strconv.Itoa(next)
+		}
+		response = page
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(sessionInfos); err != nil {
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Warning: Failed to encode sessions list response: %v", err)
 	}
 }
 
-// HandleDeleteSession deletes a session
-func (cs *ChatServer) HandleDeleteSession(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	userID := cs.getClientID(r)
-	sm := cs.GetSessionManager(userID)
+// Page sizes of the session list
+const (
+	defaultSessionPageSize = 50
+	maxSessionPageSize     = 200
+)
 
-	sessionID := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
-	if sessionID == "" {
-		http.Error(w, "Session ID required", http.StatusBadRequest)
-		return
+// sessionPageParams returns the offset and limit of a page of the session
+// list. The cursor is the next_cursor of the previous page and takes the
+// place of offset.
+func sessionPageParams(query url.Values) (offset, limit int, err error) {
+	limit = defaultSessionPageSize
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("limit must be a positive integer")
+		}
+		limit = min(limit, maxSessionPageSize)
 	}
 
-	// Close and delete agent
-	cs.agentMu.Lock()
-	if agent, exists := cs.agents[sessionID]; exists {
-		// Close agent if it implements Close method
-		log.Printf("Closing agent for deleted session %s", sessionID)
-		if simpleAgent, ok := agent.(*SimpleChatAgent); ok {
-			// Use a goroutine with timeout to prevent blocking
-			done := make(chan error, 1)
-			go func() {
-				done <- simpleAgent.Close()
-			}()
-
-			// Wait for close with timeout
-			select {
-			case err := <-done:
-				if err != nil {
-					log.Printf("Error closing agent for session %s: %v", sessionID, err)
-				}
-			case <-time.After(10 * time.Second):
-				log.Printf("Warning: Agent close for session %s timed out", sessionID)
-			}
+	value := query.Get("offset")
+	if cursor := query.Get("cursor"); cursor != "" {
+		value = cursor
+	}
+	if value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset and cursor must be non-negative integers")
 		}
-		delete(cs.agents, sessionID)
-		log.Printf("Agent for session %s deleted", sessionID)
 	}
-	cs.agentMu.Unlock()
+	return offset, limit, nil
+}
 
-	// Delete session
-	err := sm.DeleteSession(sessionID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
+// rejectInvalidSessionID writes a 400 response and returns true when a
+// session ID of the client is not one the session manager could have issued.
+// IDs are checked before they are used as agent keys or store names.
+func rejectInvalidSessionID(w http.ResponseWriter, sessionID string) bool {
+	if sessionpkg.ValidID(sessionID) {
+		return false
 	}
+	http.Error(w, "Invalid session ID", http.StatusBadRequest)
+	return true
+}
 
-	w.WriteHeader(http.StatusNoContent)
+// sessionLoadStatus maps an error of SessionManager.GetSession to an HTTP
+// status code: a damaged session file is a server error, anything else means
+// the session does not exist
+func sessionLoadStatus(err error) int {
+	if errors.Is(err, sessionpkg.ErrCorruptSession) {
+		return http.StatusInternalServerError
+	}
+	return http.StatusNotFound
 }
 
-// HandleGetHistory retrieves chat history for a session
-func (cs *ChatServer) HandleGetHistory(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// HandleDeleteSession deletes a session
+func (cs *ChatServer) HandleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfMaintenance(w) {
 		return
 	}
 
 	userID := cs.getClientID(r)
 	sm := cs.GetSessionManager(userID)
 
-	sessionID := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
-	sessionID = strings.TrimSuffix(sessionID, "/history")
+	sessionID := r.PathValue("id")
 	if sessionID == "" {
 		http.Error(w, "Session ID required", http.StatusBadRequest)
 		return
 	}
-
-	messages, err := sm.GetMessages(sessionID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if rejectInvalidSessionID(w, sessionID) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(messages); err != nil {
-		log.Printf("Warning: Failed to encode session messages response: %v", err)
+	// Only the user's own sessions are found, so the agent of another
+	// user's session is left alone
+	if _, err := sm.GetSession(sessionID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
 	}
-}
 
-// HandleChat handles chat message requests
-func (cs *ChatServer) HandleChat(w http.ResponseWriter, r *http.Request) {
-	startTime := time.Now()
-
-	if r.Method != http.MethodPost {
-		cs.metricsCollector.RecordHTTPRequest(r.Method, r.URL.Path, "405", 0, 0, 0)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// Delete session, closing its agent and removing its sandbox working
+	// directory and tool counters
+	err := sm.DeleteSession(sessionID)
+	cs.forgetDeletedSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	// Acquire request slot for concurrency control
-	if err := cs.acquireRequest(); err != nil {
-		cs.metricsCollector.RecordHTTPRequest(r.Method, r.URL.Path, "429", 0, 0, 0)
-		log.Printf("Request rejected: %v", err)
-		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleMigrateSessions copies all sessions from the server's file store to
+// another store. It requires maintenance mode, so chats do not change the
+// sessions while they are copied, and answers 409 Conflict otherwise.
+func (cs *ChatServer) HandleMigrateSessions(w http.ResponseWriter, r *http.Request) {
+	if enabled, _ := cs.maintenance.active(); !enabled {
+		http.Error(w, "Sessions can only be migrated in maintenance mode", http.StatusConflict)
 		return
 	}
-	defer cs.releaseRequest()
 
 	var req struct {
-		SessionID    string `json:"session_id"`
-		Message      string `json:"message"`
-		UserSettings struct {
-			EnableSkills bool `json:"enable_skills"`
-			EnableMCP    bool `json:"enable_mcp"`
-		} `json:"user_settings"`
-		Stream bool `json:"stream"` // New field for streaming request
+		To           string `json:"to"`
+		ToDir        string `json:"to_dir"`
+		DeleteSource bool   `json:"delete_source"`
+		DryRun       bool   `json:"dry_run"`
 	}
-
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Failed to decode request: %v", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-
-	if req.SessionID == "" || req.Message == "" {
-		http.Error(w, "session_id and message are required", http.StatusBadRequest)
+	if req.To == "" || req.ToDir == "" {
+		http.Error(w, "to and to_dir are required", http.StatusBadRequest)
 		return
 	}
 
-	userID := cs.getClientID(r)
-	sm := cs.GetSessionManager(userID)
+	// The migration reads the session files, so write what is still queued
+	cs.smMu.Lock()
+	for _, sm := range cs.sessionManagers {
+		sm.Flush()
+	}
+	cs.smMu.Unlock()
 
-	log.Printf("Chat request for session %s: %s (stream: %v)", req.SessionID, req.Message, req.Stream)
+	report, err := sessionpkg.MigrateTree("file", cs.sessionDir, req.To, req.ToDir, sessionpkg.MigrateOptions{
+		DeleteSource: req.DeleteSource,
+		DryRun:       req.DryRun,
+	})
 
-	// Verify session exists
-	_, err := sm.GetSession(req.SessionID)
+	result := "success"
 	if err != nil {
-		log.Printf("Session not found: %s", req.SessionID)
-		http.Error(w, "Session not found", http.StatusNotFound)
-		return
-	}
+		result = "failure"
+	}
+	cs.auditLogger.Log(audit.Event{
+		Action:   "sessions.migrate",
+		Actor:    cs.getClientID(r),
+		Resource: req.To + ":" + req.ToDir,
+		Result:   result,
+		Details:  map[string]any{"report": report, "delete_source": req.DeleteSource, "dry_run": req.DryRun},
+	})
 
-	// Get or create agent for this session
-	agent, err := cs.GetOrCreateAgent(req.SessionID)
-	if err != nil {
-		log.Printf("Failed to create agent: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to create agent: %v", err), http.StatusInternalServerError)
+	if report == nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Add user message to history
-	_, _ = sm.AddMessage(req.SessionID, "user", req.Message)
-
-	// Use user settings directly
-	enableSkills := req.UserSettings.EnableSkills
-	enableMCP := req.UserSettings.EnableMCP
-
-	log.Printf("Tool settings for session %s - Skills: %v, MCP: %v",
-		req.SessionID, enableSkills, enableMCP)
-
-	// Record metrics
-	duration := time.Since(startTime)
-	requestSize := int64(r.ContentLength)
-	cs.metricsCollector.RecordHTTPRequest(r.Method, r.URL.Path, "200", duration, requestSize, 0)
-
-	if req.Stream {
-		// Handle streaming response
-		cs.HandleChatStream(w, r, agent, req.SessionID, req.Message, enableSkills, enableMCP)
-	} else {
-		// Handle non-streaming response (original behavior)
-		cs.HandleChatNonStream(w, r, agent, req.SessionID, req.Message, enableSkills, enableMCP)
+	// Source sessions are gone; drop cached managers so they reload from disk
+	if req.DeleteSource && report.Deleted > 0 {
+		cs.smMu.Lock()
+		cs.sessionManagers = make(map[string]*sessionpkg.SessionManager)
+		cs.smLastUsed = make(map[string]time.Time)
+		cs.smMu.Unlock()
 	}
 
-	// Record agent session event
-	cs.metricsCollector.RecordAgentSession("chat_request")
-}
-
-// HandleChatNonStream handles non-streaming chat responses (original behavior)
-func (cs *ChatServer) HandleChatNonStream(w http.ResponseWriter, r *http.Request, agent ChatAgent, sessionID, message string, enableSkills, enableMCP bool) {
-	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
-	defer cancel()
-
-	response, err := agent.Chat(ctx, message, enableSkills, enableMCP)
+	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
-		log.Printf("Chat error for session %s: %v", sessionID, err)
-		cs.metricsCollector.RecordAgentError(sessionID, "chat_error")
-		http.Error(w, fmt.Sprintf("Chat failed: %v", err), http.StatusInternalServerError)
-		return
+		w.WriteHeader(http.StatusInternalServerError)
 	}
-
-	log.Printf("Chat response for session %s: %s", sessionID, response)
-
-	// Record agent metrics
-	cs.metricsCollector.RecordAgentMessage(sessionID, "assistant")
-	cs.metricsCollector.RecordAgentTokenUsage(sessionID, "response", int64(len(response)))
-
-	// Add assistant response to history
-	userID := cs.getClientID(r)
-	sm := cs.GetSessionManager(userID)
-	msgID, _ := sm.AddMessage(sessionID, "assistant", response)
-
-	// Send response
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]string{
-		"response":   response,
-		"message_id": msgID,
-	}); err != nil {
-		log.Printf("Warning: Failed to encode chat response: %v", err)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Warning: Failed to encode migration report: %v", err)
 	}
 }
 
-// HandleChatStream handles streaming chat responses using SSE
-func (cs *ChatServer) HandleChatStream(w http.ResponseWriter, r *http.Request, agent ChatAgent, sessionID, message string, enableSkills, enableMCP bool) {
-	// Set SSE headers
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	// Get a flusher
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		log.Printf("Streaming not supported")
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
-	defer cancel()
-
-	userID := cs.getClientID(r)
-	sm := cs.GetSessionManager(userID)
-
-	// Send initial event
-	fmt.Fprintf(w, "event: start\ndata: {\"type\": \"start\"}\n\n")
-	flusher.Flush()
-
-	// Define streaming callback
-	streamFunc := func(ctx context.Context, chunk []byte) error {
-		data := map[string]any{
-			"type":  "chunk",
-			"chunk": string(chunk),
+// clientDisconnected stores the partial answer of a streamed turn whose
+// client went away, marked as truncated, and counts the abort
+func (cs *ChatServer) clientDisconnected(userID, sessionID, partial string, result *StreamResult, assignment *experiment.Assignment, typing *generationBroadcast) {
+	log.Printf("Client of session %s disconnected, generation stopped after %d bytes", redact.LogID(sessionID), len(partial))
+	cs.metricsCollector.RecordAgentError(sessionID, sessionpkg.TruncatedClientDisconnect)
+
+	var msgID string
+	if partial != "" {
+		var toolCalls []ToolCallRecord
+		var decisions []sessionpkg.SelectionDecision
+		if result != nil {
+			toolCalls, decisions = result.ToolCalls, result.Decisions
 		}
-		jsonData, err := json.Marshal(data)
-		if err != nil {
-			return err
+		msg := sessionpkg.Message{
+			Role:      "assistant",
+			Content:   partial,
+			ToolCalls: sessionToolCalls(toolCalls),
+			Decisions: decisions,
+			Truncated: sessionpkg.TruncatedClientDisconnect,
 		}
-		fmt.Fprintf(w, "event: chunk\ndata: %s\n\n", jsonData)
-		flusher.Flush()
-		return nil
-	}
-
-	// Get the full response from agent while streaming
-	response, err := agent.ChatStream(ctx, message, enableSkills, enableMCP, streamFunc)
-	if err != nil {
-		fmt.Fprintf(w, "event: error\ndata: {\"type\": \"error\", \"error\": %q}\n\n", err.Error())
-		flusher.Flush()
-		return
-	}
-
-	// Save the complete response to history
-	msgID, _ := sm.AddMessage(sessionID, "assistant", response)
-
-	// Send end event
-	endData := map[string]any{
-		"type":       "end",
-		"message":    response,
-		"message_id": msgID,
+		stampExperiment(&msg, assignment)
+		var err error
+		if msgID, err = cs.GetSessionManager(userID).AppendMessage(sessionID, msg); err != nil {
+			log.Printf("Warning: Failed to save partial answer of session %s: %v", redact.LogID(sessionID), err)
+		}
+		cs.recordToolCalls(toolCalls)
+		cs.recordSelections(decisions)
 	}
-	jsonEndData, _ := json.Marshal(endData)
-	fmt.Fprintf(w, "event: end\ndata: %s\n\n", jsonEndData)
-	flusher.Flush()
+	typing.finish(generationCancelled, msgID)
 }
 
 // HandleGetClientID returns the client ID for the current user
 func (cs *ChatServer) HandleGetClientID(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	userID := cs.getClientID(r)
 
 	// Set user ID cookie if not already set
@@ -1345,7 +2004,7 @@ func (cs *ChatServer) HandleGetClientID(w http.ResponseWriter, r *http.Request)
 		http.SetCookie(w, &http.Cookie{
 			Name:     "user_id",
 			Value:    userID,
-			Path:     "/",
+			Path:     middleware.CookiePath(r),
 			MaxAge:   86400 * 30, // 30 days
 			HttpOnly: true,
 			SameSite: http.SameSiteLaxMode,
@@ -1367,6 +2026,9 @@ func (cs *ChatServer) HandleMCPTools(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "session_id is required", http.StatusBadRequest)
 		return
 	}
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
 
 	// Get or create agent for this session
 	agent, err := cs.GetOrCreateAgent(sessionID)
@@ -1383,11 +2045,14 @@ func (cs *ChatServer) HandleMCPTools(w http.ResponseWriter, r *http.Request) {
 	}
 
 	tools := simpleAgent.GetAvailableTools()
+	simpleAgent.mu.RLock()
+	enabled := simpleAgent.toolsEnabled
+	simpleAgent.mu.RUnlock()
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]any{
 		"tools":   tools,
-		"enabled": simpleAgent.toolsEnabled,
+		"enabled": enabled,
 	}); err != nil {
 		log.Printf("Warning: Failed to encode MCP tools response: %v", err)
 	}
@@ -1400,6 +2065,9 @@ func (cs *ChatServer) HandleToolsHierarchical(w http.ResponseWriter, r *http.Req
 		http.Error(w, "session_id is required", http.StatusBadRequest)
 		return
 	}
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
 
 	// Get or create agent for this session
 	agent, err := cs.GetOrCreateAgent(sessionID)
@@ -1417,11 +2085,12 @@ func (cs *ChatServer) HandleToolsHierarchical(w http.ResponseWriter, r *http.Req
 
 	// Prepare hierarchical data
 	var result struct {
-		Skills       []map[string]any `json:"skills"`
-		MCPTools     []map[string]any `json:"mcp_tools"`
-		Enabled      bool             `json:"enabled"`
-		ToolsLoading bool             `json:"tools_loading"`
-		ToolsLoaded  bool             `json:"tools_loaded"`
+		Skills       []map[string]any     `json:"skills"`
+		BrokenSkills []skills.BrokenSkill `json:"broken_skills"` // skills that failed to load, with why
+		MCPTools     []map[string]any     `json:"mcp_tools"`
+		Enabled      bool                 `json:"enabled"`
+		ToolsLoading bool                 `json:"tools_loading"`
+		ToolsLoaded  bool                 `json:"tools_loaded"`
 	}
 
 	// Lock for reading skills and MCP tools
@@ -1429,17 +2098,19 @@ func (cs *ChatServer) HandleToolsHierarchical(w http.ResponseWriter, r *http.Req
 	result.Enabled = simpleAgent.toolsEnabled
 	result.ToolsLoading = simpleAgent.toolsLoading
 	result.ToolsLoaded = simpleAgent.toolsLoaded
-	skills := make([]SkillInfo, len(simpleAgent.skills))
-	copy(skills, simpleAgent.skills)
+	result.BrokenSkills = slices.Clone(simpleAgent.brokenSkills)
+	skillInfos := make([]SkillInfo, len(simpleAgent.skills))
+	copy(skillInfos, simpleAgent.skills)
 	mcpTools := make([]tools.Tool, len(simpleAgent.mcpTools))
 	copy(mcpTools, simpleAgent.mcpTools)
 	simpleAgent.mu.RUnlock()
 
 	// Add skills with their tools
-	for _, skill := range skills {
+	for _, skill := range skillInfos {
 		skillData := map[string]any{
 			"name":        skill.Name,
 			"description": skill.Description,
+			"version":     skill.Version,
 			"tools":       []map[string]any{},
 		}
 
@@ -1453,7 +2124,7 @@ func (cs *ChatServer) HandleToolsHierarchical(w http.ResponseWriter, r *http.Req
 			}
 		} else {
 			// Load tools on demand
-			if tools, err := simpleAgent.loadSkillTools(skill.Name); err == nil {
+			if tools, err := simpleAgent.skillTools(skill.Name); err == nil {
 				for _, tool := range tools {
 					skillData["tools"] = append(skillData["tools"].([]map[string]any), map[string]any{
 						"name":        tool.Name(),
@@ -1503,10 +2174,10 @@ func (cs *ChatServer) HandleToolsHierarchical(w http.ResponseWriter, r *http.Req
 	}
 }
 
-// HandleFeedback handles message feedback (like/dislike)
+// HandleFeedback sets or clears the like/dislike feedback of a message of
+// a session of the current user
 func (cs *ChatServer) HandleFeedback(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if cs.rejectIfMaintenance(w) {
 		return
 	}
 
@@ -1520,202 +2191,443 @@ func (cs *ChatServer) HandleFeedback(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if rejectInvalidSessionID(w, req.SessionID) {
+		return
+	}
+	if !sessionpkg.ValidFeedback(req.Feedback) {
+		http.Error(w, fmt.Sprintf("invalid feedback %q, expected like, dislike or empty", req.Feedback), http.StatusBadRequest)
+		return
+	}
+	if req.MessageID == "" {
+		http.Error(w, "Message ID required", http.StatusBadRequest)
+		return
+	}
 
 	userID := cs.getClientID(r)
 	sm := cs.GetSessionManager(userID)
 
-	err := sm.UpdateMessageFeedback(req.SessionID, req.MessageID, req.Feedback)
+	// Sessions are looked up in the namespace of the caller only, so the
+	// messages of other users are not found
+	previous, err := sm.GetMessage(req.SessionID, req.MessageID)
 	if err != nil {
+		http.Error(w, err.Error(), feedbackErrorStatus(err))
+		return
+	}
+	if err := sm.UpdateMessageFeedback(req.SessionID, req.MessageID, req.Feedback); err != nil {
 		log.Printf("Failed to update feedback: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), feedbackErrorStatus(err))
 		return
 	}
+	cs.metricsCollector.RecordFeedback(req.Feedback)
+	cs.recordExperimentFeedback(previous, req.Feedback)
+	cs.recordSelectionFeedback(previous, req.Feedback)
+	if !sm.Preferences().DatasetOptOut {
+		cs.dataset.LogFeedback(req.MessageID, req.Feedback)
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// feedbackErrorStatus maps a feedback update error to an HTTP status
+func feedbackErrorStatus(err error) int {
+	if errors.Is(err, sessionpkg.ErrInvalidFeedback) {
+		return http.StatusBadRequest
+	}
+	return messageErrorStatus(err)
+}
+
+// messageErrorStatus maps an error looking up or changing a message to an
+// HTTP status
+func messageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sessionpkg.ErrMessageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, sessionpkg.ErrNotPersisted):
+		return http.StatusInternalServerError
+	}
+	return sessionLoadStatus(err)
+}
+
 // HandleConfig returns the chat configuration
 func (cs *ChatServer) HandleConfig(w http.ResponseWriter, r *http.Request) {
+	buildInfo := version.Get()
+	config := cs.configFor(r)
+	basePath := middleware.BasePathFrom(r.Context())
+	var workspaceID string
+	if claims := cs.requestClaims(r); claims != nil {
+		workspaceID = claims.Workspace
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]any{
-		"chatTitle":      "聊天智能体",
-		"appLogo":        "/static/images/logo.png",
-		"enableFeedback": cs.config.Features.FeedbackEnabled,
+		"chatTitle":      config.UI.ChatTitle,
+		"appLogo":        basePath + config.UI.AppLogo,
+		"basePath":       basePath,
+		"enableFeedback": config.Features.FeedbackEnabled,
 		"environment":    "development", // TODO: Get from config manager
-		"llmModel":       cs.config.LLM.Model,
-		"version":        "1.0.0",
+		"llmModel":       config.LLM.Model,
+		"personas":       config.UI.Personas,
+		"workspace":      workspaceID,
+		"version":        buildInfo.Version,
+		"commit":         buildInfo.Commit,
+		"buildTime":      buildInfo.BuildTime,
 	}); err != nil {
 		log.Printf("Warning: Failed to encode config response: %v", err)
 	}
 }
 
-// Close gracefully shuts down the server and cleans up all resources
+// Close gracefully shuts down the server and cleans up all resources by
+// closing the registered components in reverse order. Calls after the first
+// return the result of the first.
 func (cs *ChatServer) Close() error {
-	log.Printf("Shutting down chat server...")
+	cs.closeOnce.Do(func() {
+		log.Printf("Shutting down chat server...")
 
+		cs.componentsMu.Lock()
+		components := cs.components
+		cs.componentsMu.Unlock()
+
+		cs.closeErr = closeComponents(components)
+		if cs.closeErr != nil {
+			log.Printf("Chat server shutdown completed with errors")
+			return
+		}
+		log.Printf("Chat server shutdown complete")
+	})
+	return cs.closeErr
+}
+
+// closeAgents closes the agents of all sessions
+func (cs *ChatServer) closeAgents() error {
 	cs.agentMu.Lock()
 	defer cs.agentMu.Unlock()
 
 	// Close all agents with error collection
 	var closeErrors []error
 	for sessionID, agent := range cs.agents {
-		log.Printf("Closing agent for session %s", sessionID)
+		log.Printf("Closing agent for session %s", redact.LogID(sessionID))
 		if simpleAgent, ok := agent.(*SimpleChatAgent); ok {
 			if err := simpleAgent.Close(); err != nil {
-				log.Printf("Error closing agent for session %s: %v", sessionID, err)
+				log.Printf("Error closing agent for session %s: %v", redact.LogID(sessionID), err)
 				closeErrors = append(closeErrors, fmt.Errorf("session %s: %w", sessionID, err))
 			}
 		}
 	}
 
+	if cs.warmupAgent != nil {
+		if err := cs.warmupAgent.Close(); err != nil {
+			closeErrors = append(closeErrors, fmt.Errorf("warmup agent: %w", err))
+		}
+		cs.warmupAgent = nil
+	}
+
 	// Clear agents map
 	cs.agents = make(map[string]ChatAgent)
+	return errors.Join(closeErrors...)
+}
 
-	if len(closeErrors) > 0 {
-		log.Printf("Chat server shutdown completed with %d errors", len(closeErrors))
-		// Return first error but log all
-		return closeErrors[0]
-	}
+// closeSessionManagers writes the sessions still waiting in the write-behind
+// queues of all users
+func (cs *ChatServer) closeSessionManagers() error {
+	cs.smMu.Lock()
+	defer cs.smMu.Unlock()
 
-	log.Printf("Chat server shutdown complete")
-	return nil
+	var closeErrors []error
+	for userID, sm := range cs.sessionManagers {
+		if err := sm.Close(); err != nil {
+			log.Printf("Error saving sessions of user %s: %v", userID, err)
+			closeErrors = append(closeErrors, fmt.Errorf("sessions of user %s: %w", userID, err))
+		}
+	}
+	return errors.Join(closeErrors...)
 }
 
 // Start starts the HTTP server
 func (cs *ChatServer) Start(staticFS fs.FS) error {
+	handler, err := cs.routes(staticFS)
+	if err != nil {
+		return err
+	}
+
+	// Unauthenticated probes for load balancers on their own port
+	if err := cs.startHealthServer(); err != nil {
+		return err
+	}
+
+	serverConfig := cs.GetConfig().Server
+	server := &http.Server{
+		Addr:    ":" + cs.port,
+		Handler: handler,
+	}
+	cs.httpServerMu.Lock()
+	cs.httpServer = server
+	cs.httpServerMu.Unlock()
+
+	// Bind before serving, so Listening is only signaled once requests are accepted
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %s: %w", cs.port, err)
+	}
+
+	loginPath := "/login"
+	if basePath, ok := configpkg.NormalizeBasePath(serverConfig.BasePath); ok && serverConfig.BasePath != configpkg.BasePathAuto {
+		loginPath = basePath + loginPath
+	}
+	log.Printf("🔐 Authentication enabled - visit %s to sign in", loginPath)
+	if cert, key := serverConfig.TLSCertFile, serverConfig.TLSKeyFile; cert != "" && key != "" {
+		log.Printf("🌐 HTTPS server listening on https://localhost%s", server.Addr)
+		close(cs.listening)
+		err = server.ServeTLS(listener, cert, key)
+	} else {
+		log.Printf("🌐 HTTP server listening on http://localhost%s", server.Addr)
+		close(cs.listening)
+		err = server.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// routes returns the handler of the HTTP server: the web UI and its API,
+// served with the pages and assets of staticFS under the base path
+func (cs *ChatServer) routes(staticFS fs.FS) (http.Handler, error) {
 	// Create a new ServeMux for better route handling
 	mux := http.NewServeMux()
 
+	// Middleware chains: the public chain wraps every request, the protected
+	// chain additionally caps anonymous namespaces, authenticates API requests
+	// and tracks the activity of their users.
+	publicChain := middleware.NewChain().
+		Use(middleware.StageRecovery, middleware.Recovery).
+		Use(middleware.StageLogging, cs.dashboardMiddleware)
+	protectedChain := middleware.NewChain().
+		Use(middleware.StageRateLimit, cs.limitNamespaces).
+		Use(middleware.StageAuth, cs.jwtAuth.Middleware).
+		Use(middleware.StageTracking, cs.trackActivity, labelRequest)
+
 	// Authentication routes (public)
 	mux.HandleFunc("/login", cs.authAPI.HandleLoginPage)
 	mux.HandleFunc("/register", cs.authAPI.HandleRegisterPage)
 	mux.HandleFunc("/api/auth/login", cs.authAPI.HandleLogin)
 	mux.HandleFunc("/api/auth/register", cs.authAPI.HandleRegister)
-	mux.HandleFunc("/api/auth/refresh", cs.authAPI.HandleRefresh)
-	mux.HandleFunc("/api/auth/logout", cs.authAPI.HandleLogout)
+	mux.HandleFunc("POST /api/auth/refresh", cs.authAPI.HandleRefresh)
+	mux.HandleFunc("POST /api/auth/logout", cs.authAPI.HandleLogout)
+	mux.HandleFunc("GET /api/auth/verify", cs.authAPI.HandleVerifyEmail)
 
 	// Public endpoints
-	mux.HandleFunc("/health", cs.HandleHealth)
-	mux.HandleFunc("/ready", cs.HandleReady)
-	mux.HandleFunc("/info", cs.HandleInfo)
-	mux.HandleFunc("/api/config", cs.HandleConfig)
+	mux.HandleFunc("GET /health", cs.HandleHealth)
+	mux.HandleFunc("GET /ready", cs.HandleReady)
+	mux.HandleFunc("GET /info", cs.HandleInfo)
+	mux.HandleFunc("GET /api/config", cs.HandleConfig)
 
-	// Main app route v2 - serve index2.html
-	uiV2Handler := func(w http.ResponseWriter, r *http.Request) {
-		// Check if user is authenticated
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			// Check for token in cookie
-			cookie, err := r.Cookie("access_token")
-			if err == nil {
-				token = "Bearer " + cookie.Value
-			}
-		}
-
-		if token != "" {
-			if strings.HasPrefix(token, "Bearer ") {
-				tokenStr := strings.TrimPrefix(token, "Bearer ")
-				if _, err := cs.jwtAuth.ValidateToken(tokenStr); err == nil {
-					cs.HandleIndex2(w, r, staticFS)
-					return
-				}
-			}
-		}
+	// Static assets are fingerprinted before the pages, which refer to their versioned paths
+	assets, err := loadAssetManifest(staticFS)
+	if err != nil {
+		return nil, err
+	}
+	cs.assets = assets
+	mux.HandleFunc("GET /assets.json", cs.HandleAssetManifest)
+	mux.HandleFunc("GET /manifest.webmanifest", cs.HandleWebAppManifest)
+	mux.HandleFunc("GET /sw.js", cs.HandleServiceWorker)
 
-		http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+	// Pages of the web UI; browsers that are not signed in are sent to the login page
+	pages, err := loadStaticPages(staticFS, assets)
+	if err != nil {
+		return nil, err
 	}
-	mux.HandleFunc("/ui/v2", uiV2Handler)
-	mux.HandleFunc("/ui/v2/", uiV2Handler)
+	cs.pages = pages
+	pageChain := middleware.NewChain().
+		Use(middleware.StageAuth, cs.jwtAuth.RedirectToLogin("/login")).
+		Use(middleware.StageTracking, labelRequest)
 
-	// Main app route - authenticate first, then serve original index.html
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// Check if this is a route that needs authentication (root or session routes)
-		if r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/sessions/") {
-			// Check if user is authenticated
-			token := r.Header.Get("Authorization")
-			if token == "" {
-				// Check for token in cookie (for browser access)
-				cookie, err := r.Cookie("access_token")
-				if err == nil {
-					token = "Bearer " + cookie.Value
-				}
-			}
+	// Main app route v2 - serve index2.html
+	uiV2Handler := pageChain.Then(http.HandlerFunc(cs.HandleIndex2))
+	mux.Handle("/ui/v2", uiV2Handler)
+	mux.Handle("/ui/v2/", uiV2Handler)
 
-			if token != "" {
-				// Validate token
-				if after, ok := strings.CutPrefix(token, "Bearer "); ok {
-					tokenStr := after
-					if _, err := cs.jwtAuth.ValidateToken(tokenStr); err == nil {
-						// User is authenticated, serve original index.html
-						cs.HandleIndex(w, r, staticFS)
-						return
-					}
-				}
-			}
+	// Built-in dashboard page; the data comes from /api/admin/dashboard
+	mux.Handle("GET /admin", pageChain.Then(cs.jwtAuth.RequireRole("admin")(http.HandlerFunc(cs.HandleAdminPage))))
 
-			// User is not authenticated, redirect to login page
-			http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
-			return
-		}
-		// For other paths, try to serve index.html (SPA support)
-		cs.HandleIndex(w, r, staticFS)
-	})
+	// Main app route - authenticate first, then serve original index.html
+	mux.Handle("/", pageChain.Then(http.HandlerFunc(cs.HandleIndex)))
 
 	// Protected routes (require authentication)
 	protectedMux := http.NewServeMux()
-	protectedMux.HandleFunc("/api/user-id", cs.HandleGetClientID)
-	protectedMux.HandleFunc("/api/auth/me", cs.authAPI.HandleGetCurrentUser)
-	protectedMux.HandleFunc("/api/sessions/new", cs.HandleNewSession)
-	protectedMux.HandleFunc("/api/sessions", cs.HandleListSessions)
-	protectedMux.HandleFunc("/api/sessions/", func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		if strings.HasSuffix(path, "/history") {
-			cs.HandleGetHistory(w, r)
-		} else if r.Method == http.MethodDelete {
-			cs.HandleDeleteSession(w, r)
-		} else {
-			http.NotFound(w, r)
-		}
-	})
-	protectedMux.HandleFunc("/api/chat", cs.HandleChat)
-	protectedMux.HandleFunc("/api/feedback", cs.HandleFeedback)
-	protectedMux.HandleFunc("/api/mcp/tools", cs.HandleMCPTools)
-	protectedMux.HandleFunc("/api/tools/hierarchical", cs.HandleToolsHierarchical)
-	protectedMux.HandleFunc("/metrics", cs.HandleMetrics)
+	protectedMux.HandleFunc("GET /api/user-id", cs.HandleGetClientID)
+	protectedMux.HandleFunc("GET /api/auth/me", cs.authAPI.HandleGetCurrentUser)
+	protectedMux.HandleFunc("POST /api/auth/verify/resend", cs.authAPI.HandleResendVerification)
+	protectedMux.HandleFunc("POST /api/sessions/new", cs.HandleNewSession)
+	protectedMux.HandleFunc("GET /api/sessions", cs.HandleListSessions)
+	protectedMux.HandleFunc("DELETE /api/sessions/{id}", cs.HandleDeleteSession)
+	protectedMux.HandleFunc("PATCH /api/sessions/{id}", cs.HandleUpdateSession)
+	protectedMux.HandleFunc("PATCH /api/sessions/{id}/pin", cs.HandlePinSession)
+	protectedMux.HandleFunc("POST /api/sessions/{id}/tags", cs.HandleAddSessionTag)
+	protectedMux.HandleFunc("DELETE /api/sessions/{id}/tags/{tag}", cs.HandleRemoveSessionTag)
+	protectedMux.HandleFunc("POST /api/sessions/{id}/archive", cs.HandleArchiveSession)
+	protectedMux.HandleFunc("POST /api/sessions/{id}/unarchive", cs.HandleUnarchiveSession)
+	protectedMux.HandleFunc("GET /api/sessions/events", cs.HandleSessionEvents)
+	protectedMux.HandleFunc("GET /api/sessions/search", cs.HandleSearchSessions)
+	protectedMux.HandleFunc("POST /api/sessions/import", cs.HandleImportSessions)
+	protectedMux.HandleFunc("GET /api/sessions/{id}/history", cs.HandleGetHistory)
+	protectedMux.HandleFunc("DELETE /api/sessions/{id}/messages/{messageID}", cs.HandleDeleteMessage)
+	protectedMux.HandleFunc("POST /api/sessions/{id}/messages/{messageID}/edit", cs.HandleEditMessage)
+	protectedMux.HandleFunc("POST /api/sessions/{id}/regenerate", cs.HandleRegenerate)
+	protectedMux.HandleFunc("POST /api/sessions/{id}/fork", cs.HandleForkSession)
+	protectedMux.HandleFunc("GET /api/sessions/{id}/export", cs.HandleExportSession)
+	protectedMux.HandleFunc("POST /api/chat", cs.HandleChat)
+	protectedMux.HandleFunc("POST /api/feedback", cs.HandleFeedback)
+	protectedMux.HandleFunc("GET /api/folders", cs.HandleListFolders)
+	protectedMux.HandleFunc("POST /api/folders", cs.HandleCreateFolder)
+	protectedMux.HandleFunc("PATCH /api/folders/{id}", cs.HandleUpdateFolder)
+	protectedMux.HandleFunc("DELETE /api/folders/{id}", cs.HandleDeleteFolder)
+	protectedMux.HandleFunc("GET /api/preferences", cs.HandleGetPreferences)
+	protectedMux.HandleFunc("PATCH /api/preferences", cs.HandleUpdatePreferences)
+	protectedMux.HandleFunc("GET /api/me/memories", cs.HandleListMemories)
+	protectedMux.HandleFunc("POST /api/me/memories", cs.HandleAddMemory)
+	protectedMux.HandleFunc("DELETE /api/me/memories/{id}", cs.HandleDeleteMemory)
+	protectedMux.HandleFunc("GET /api/me/secrets", cs.HandleListSecrets)
+	protectedMux.HandleFunc("PUT /api/me/secrets/{name}", cs.HandleSetSecret)
+	protectedMux.HandleFunc("DELETE /api/me/secrets/{name}", cs.HandleDeleteSecret)
+	protectedMux.HandleFunc("GET /api/mcp/tools", cs.HandleMCPTools)
+	protectedMux.HandleFunc("GET /api/tools/hierarchical", cs.HandleToolsHierarchical)
+	protectedMux.HandleFunc("GET /api/tools/events", cs.HandleToolsEvents)
+	protectedMux.HandleFunc("GET /metrics", cs.HandleMetrics)
+
+	// Admin routes
+	requireAdmin := cs.jwtAuth.RequireRole("admin")
+	protectedMux.Handle("GET /api/admin/maintenance", requireAdmin(http.HandlerFunc(cs.HandleGetMaintenance)))
+	protectedMux.Handle("POST /api/admin/maintenance", requireAdmin(http.HandlerFunc(cs.HandleSetMaintenance)))
+	protectedMux.Handle("GET /api/admin/events", requireAdmin(http.HandlerFunc(cs.HandleAdminEvents)))
+	protectedMux.Handle("POST /api/admin/sessions/migrate", requireAdmin(http.HandlerFunc(cs.HandleMigrateSessions)))
+	protectedMux.Handle("POST /api/admin/prompts/preview", requireAdmin(http.HandlerFunc(cs.HandlePreviewPrompt)))
+	protectedMux.Handle("GET /api/admin/security-check", requireAdmin(http.HandlerFunc(cs.HandleSecurityCheck)))
+	protectedMux.Handle("GET /api/admin/dataset", requireAdmin(http.HandlerFunc(cs.HandleExportDataset)))
+	protectedMux.Handle("GET /api/admin/export", requireAdmin(http.HandlerFunc(cs.HandleAdminExport)))
+	protectedMux.Handle("GET /api/admin/experiments", requireAdmin(http.HandlerFunc(cs.HandleListExperiments)))
+	protectedMux.Handle("GET /api/admin/selections", requireAdmin(http.HandlerFunc(cs.HandleSelectionStats)))
+	protectedMux.Handle("GET /api/admin/dashboard", requireAdmin(http.HandlerFunc(cs.HandleDashboard)))
+	protectedMux.Handle("POST /api/admin/invites", requireAdmin(http.HandlerFunc(cs.HandleCreateInvite)))
+	protectedMux.Handle("GET /api/admin/invites", requireAdmin(http.HandlerFunc(cs.HandleListInvites)))
+	protectedMux.Handle("GET /api/admin/agents", requireAdmin(http.HandlerFunc(cs.HandleListAgents)))
+	protectedMux.Handle("GET /api/admin/agents/{sessionID}/events", requireAdmin(http.HandlerFunc(cs.HandleAgentEvents)))
+	protectedMux.Handle("GET /api/admin/activity", requireAdmin(http.HandlerFunc(cs.HandleActivity)))
+	protectedMux.Handle("GET /api/admin/users/{id}/activity", requireAdmin(http.HandlerFunc(cs.HandleUserActivity)))
+	protectedMux.Handle("PUT /api/admin/users/{id}/workspace", requireAdmin(http.HandlerFunc(cs.HandleAssignWorkspace)))
+	protectedMux.Handle("GET /api/admin/workspaces", requireAdmin(http.HandlerFunc(cs.HandleListWorkspaces)))
+	protectedMux.Handle("POST /api/admin/workspaces", requireAdmin(http.HandlerFunc(cs.HandleCreateWorkspace)))
+	protectedMux.Handle("GET /api/admin/workspaces/{id}", requireAdmin(http.HandlerFunc(cs.HandleGetWorkspace)))
+	protectedMux.Handle("PATCH /api/admin/workspaces/{id}", requireAdmin(http.HandlerFunc(cs.HandleUpdateWorkspace)))
+	protectedMux.Handle("DELETE /api/admin/workspaces/{id}", requireAdmin(http.HandlerFunc(cs.HandleDeleteWorkspace)))
+	protectedMux.Handle("GET /api/admin/budget", requireAdmin(http.HandlerFunc(cs.HandleGetBudget)))
+	protectedMux.Handle("POST /api/admin/budget/extensions", requireAdmin(http.HandlerFunc(cs.HandleGrantBudgetExtension)))
+	protectedMux.Handle("GET /api/admin/tool-quotas", requireAdmin(http.HandlerFunc(cs.HandleGetToolQuotas)))
+	protectedMux.Handle("POST /api/admin/skills/install", requireAdmin(http.HandlerFunc(cs.HandleInstallSkill)))
+	protectedMux.Handle("POST /api/admin/skills/reload", requireAdmin(http.HandlerFunc(cs.HandleReloadSkills)))
+	protectedMux.Handle("DELETE /api/admin/skills/{name}", requireAdmin(http.HandlerFunc(cs.HandleDeleteSkill)))
+	protectedMux.Handle("POST /api/admin/skills/{name}/rollback", requireAdmin(http.HandlerFunc(cs.HandleRollbackSkill)))
 
 	// Apply authentication middleware to protected routes
-	mux.Handle("/api/", cs.jwtAuth.Middleware(protectedMux))
+	mux.Handle("/api/", protectedChain.Then(protectedMux))
 
 	// Serve static files from embedded filesystem
-	staticSubFS, err := fs.Sub(staticFS, "static")
-	if err != nil {
-		return fmt.Errorf("failed to create sub filesystem: %w", err)
+	mux.Handle("/static/", assets.handler(http.StripPrefix("/static/", http.FileServer(http.FS(assets.staticSubFS)))))
+
+	// The base path is stripped first, so routes and metrics see the paths of the mux
+	serverConfig := cs.GetConfig().Server
+	return middleware.BasePath(serverConfig.BasePath, serverConfig.TrustedProxies)(publicChain.Then(mux)), nil
+}
+
+// stopHTTPServer stops accepting requests and waits for the active ones to
+// finish until ctx is done, then closes the remaining connections
+func (cs *ChatServer) stopHTTPServer(ctx context.Context) error {
+	cs.httpServerMu.Lock()
+	server := cs.httpServer
+	cs.httpServer = nil
+	cs.httpServerMu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		return err
 	}
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticSubFS))))
+	return nil
+}
 
-	addr := ":" + cs.port
-	log.Printf("🌐 HTTP server listening on http://localhost%s", addr)
-	log.Printf("🔐 Authentication enabled - visit /login to sign in")
-	return http.ListenAndServe(addr, mux)
+// skillItems returns the available skills as prompt items (name and
+// description only). The caller must hold a.mu.
+func (a *SimpleChatAgent) skillItems() []prompts.Item {
+	items := make([]prompts.Item, 0, len(a.skills))
+	for _, skill := range a.skills {
+		items = append(items, prompts.Item{Name: skill.Name, Description: skill.Description})
+	}
+	return items
 }
 
-// getSkillsOverview returns a formatted string of available skills (name and description only)
-func (a *SimpleChatAgent) getSkillsOverview() string {
-	if len(a.skills) == 0 {
-		return ""
+// toolItems returns tools as prompt items
+func toolItems(availableTools []tools.Tool) []prompts.Item {
+	items := make([]prompts.Item, 0, len(availableTools))
+	for _, tool := range availableTools {
+		items = append(items, prompts.Item{Name: tool.Name(), Description: tool.Description()})
 	}
+	return items
+}
 
-	var info strings.Builder
-	info.WriteString("Available Skills:\n\n")
+// selectionMessages renders a system and user selection prompt into LLM messages
+func (a *SimpleChatAgent) selectionMessages(systemName, promptName string, data prompts.SelectionData) ([]llms.MessageContent, error) {
+	system, err := a.prompts.Render(systemName, data)
+	if err != nil {
+		return nil, err
+	}
+	prompt, err := a.prompts.Render(promptName, data)
+	if err != nil {
+		return nil, err
+	}
+	return []llms.MessageContent{
+		{Role: llms.ChatMessageTypeSystem, Parts: []llms.ContentPart{llms.TextPart(system)}},
+		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextPart(prompt)}},
+	}, nil
+}
 
-	for _, skill := range a.skills {
-		info.WriteString(fmt.Sprintf("- %s: %s\n", skill.Name, skill.Description))
+// skillSelectionMessages builds the LLM messages used to select a skill
+func (a *SimpleChatAgent) skillSelectionMessages(message string) ([]llms.MessageContent, error) {
+	return a.selectionMessages(prompts.SkillSelectionSystem, prompts.SkillSelection, prompts.SelectionData{
+		Message:      message,
+		Items:        a.skillItems(),
+		OutputSchema: prompts.SkillSelectionSchema,
+	})
+}
+
+// toolSelectionMessages builds the LLM messages used to select a tool
+func (a *SimpleChatAgent) toolSelectionMessages(message string, availableTools []tools.Tool) ([]llms.MessageContent, error) {
+	return a.selectionMessages(prompts.ToolSelectionSystem, prompts.ToolSelection, prompts.SelectionData{
+		Message:      message,
+		Items:        toolItems(availableTools),
+		OutputSchema: prompts.ToolSelectionSchema,
+	})
+}
+
+// setToolSchemas records tool parameter schemas. The caller must hold a.mu.
+func (a *SimpleChatAgent) setToolSchemas(schemas map[string]any) {
+	if a.toolSchemas == nil {
+		a.toolSchemas = make(map[string]any, len(schemas))
 	}
+	maps.Copy(a.toolSchemas, schemas)
+	for name := range schemas {
+		delete(a.compiledSchemas, name)
+	}
+}
 
-	return info.String()
+// skillTools loads and caches the tools of a skill, see loadSkillTools
+func (a *SimpleChatAgent) skillTools(skillName string) ([]tools.Tool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.loadSkillTools(skillName)
 }
 
-// loadSkillTools loads and caches tools for a specific skill
+// loadSkillTools loads and caches tools for a specific skill. The caller must
+// hold a.mu for writing.
 func (a *SimpleChatAgent) loadSkillTools(skillName string) ([]tools.Tool, error) {
 	// Find the skill
 	for i := range a.skills {
@@ -1726,6 +2638,17 @@ func (a *SimpleChatAgent) loadSkillTools(skillName string) ([]tools.Tool, error)
 				if err != nil {
 					return nil, fmt.Errorf("failed to convert skill '%s' to tools: %w", skillName, err)
 				}
+				if a.sandbox.Enabled() && a.sessionID != "" {
+					skillTools = a.sandbox.WrapSkillTools(a.sessionID, a.skills[i].Package, skillTools)
+				}
+				defs, _ := goskills.GenerateToolDefinitions(a.skills[i].Package)
+				schemas := make(map[string]any, len(defs))
+				for _, def := range defs {
+					if def.Function != nil {
+						schemas[def.Function.Name] = def.Function.Parameters
+					}
+				}
+				a.setToolSchemas(schemas)
 				a.skills[i].Tools = skillTools
 				a.skills[i].Loaded = true
 				log.Printf("Loaded %d tools from skill '%s'", len(skillTools), skillName)
@@ -1736,59 +2659,38 @@ func (a *SimpleChatAgent) loadSkillTools(skillName string) ([]tools.Tool, error)
 	return nil, fmt.Errorf("skill '%s' not found", skillName)
 }
 
-// selectSkillForTask uses LLM to determine which skill (if any) should be used for the task
-func (a *SimpleChatAgent) selectSkillForTask(ctx context.Context, message string) (string, error) {
+// selectSkillForTask uses LLM to determine which skill (if any) should be used
+// for the task. The decision records the choice whether or not it failed.
+func (a *SimpleChatAgent) selectSkillForTask(ctx context.Context, message string) (string, sessionpkg.SelectionDecision, error) {
+	decision := sessionpkg.SelectionDecision{Stage: sessionpkg.SelectionStageSkill}
 	if len(a.skills) == 0 {
-		return "", nil // No skills available
+		return "", decision, nil // No skills available
+	}
+	for _, skill := range a.skills {
+		decision.Candidates = append(decision.Candidates, skill.Name)
+	}
+	fail := func(err error) (string, sessionpkg.SelectionDecision, error) {
+		decision.Error = err.Error()
+		return "", decision.Bounded(), err
 	}
-
-	skillsOverview := a.getSkillsOverview()
-
-	skillPrompt := fmt.Sprintf(`Based on the user's message, determine if any of the available skills should be used to help with this task.
-
-%s
-
-User message: %s
-
-Respond with a JSON object:
-- If no skill is needed: {"use_skill": false, "reason": "reason why no skill is needed"}
-- If a skill is needed: {"use_skill": true, "skill_name": "exact skill name", "reason": "why this skill is appropriate"}
-
-IMPORTANT:
-- Return ONLY valid JSON
-- Do NOT use markdown code fences
-- Do NOT use `+"```json"+` wrapper
-- Choose the skill that best matches the user's needs`, skillsOverview, message)
 
 	// Create LLM call for skill selection
-	skillMsg := []llms.MessageContent{
-		{Role: llms.ChatMessageTypeSystem, Parts: []llms.ContentPart{llms.TextPart("You are a helpful assistant that selects appropriate skills for tasks. Respond only with valid JSON.")}},
-		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextPart(skillPrompt)}},
+	skillMsg, err := a.skillSelectionMessages(message)
+	if err != nil {
+		return fail(fmt.Errorf("failed to build skill selection prompt: %w", err))
 	}
 
-	response, err := a.llm.GenerateContent(ctx, skillMsg)
+	response, err := a.auxLLM.GenerateContent(ctx, skillMsg)
 	if err != nil {
-		return "", fmt.Errorf("LLM call failed for skill selection: %w", err)
+		return fail(fmt.Errorf("LLM call failed for skill selection: %w", err))
 	}
 
 	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("no response from LLM")
+		return fail(fmt.Errorf("no response from LLM"))
 	}
 
-	decision := response.Choices[0].Content
-	log.Printf("Skill selection decision: %s", decision)
-
-	// Clean up the decision
-	cleanDecision := strings.TrimSpace(decision)
-	if after, ok := strings.CutPrefix(cleanDecision, "```json"); ok {
-		cleanDecision = after
-		cleanDecision = strings.TrimSuffix(cleanDecision, "```")
-		cleanDecision = strings.TrimSpace(cleanDecision)
-	} else if after, ok := strings.CutPrefix(cleanDecision, "```"); ok {
-		cleanDecision = after
-		cleanDecision = strings.TrimSuffix(cleanDecision, "```")
-		cleanDecision = strings.TrimSpace(cleanDecision)
-	}
+	content := response.Choices[0].Content
+	log.Printf("Skill selection decision: %s", redact.LogContent(content))
 
 	// Parse the decision
 	var skillDecision struct {
@@ -1797,152 +2699,127 @@ IMPORTANT:
 		Reason    string `json:"reason"`
 	}
 
-	if err := json.Unmarshal([]byte(cleanDecision), &skillDecision); err != nil {
-		return "", fmt.Errorf("failed to parse skill decision: %w", err)
+	if err := json.Unmarshal([]byte(cleanSelectionDecision(content)), &skillDecision); err != nil {
+		return fail(fmt.Errorf("failed to parse skill decision: %w", err))
 	}
+	decision.Reason = skillDecision.Reason
 
 	if skillDecision.UseSkill {
-		log.Printf("Selected skill '%s' because: %s", skillDecision.SkillName, skillDecision.Reason)
-		return skillDecision.SkillName, nil
+		log.Printf("Selected skill '%s' because: %s", skillDecision.SkillName, redact.LogContent(skillDecision.Reason))
+		// Only offered skills are recorded as chosen, loading reports the others
+		if i := slices.IndexFunc(decision.Candidates, func(name string) bool { return strings.EqualFold(name, skillDecision.SkillName) }); i >= 0 {
+			decision.Selected = decision.Candidates[i]
+		} else {
+			decision.Error = fmt.Sprintf("skill '%s' not found", skillDecision.SkillName)
+		}
+		return skillDecision.SkillName, decision.Bounded(), nil
 	}
 
-	log.Printf("No skill selected: %s", skillDecision.Reason)
-	return "", nil
+	log.Printf("No skill selected: %s", redact.LogContent(skillDecision.Reason))
+	return "", decision.Bounded(), nil
 }
 
-// selectToolForTask uses LLM to determine which tool should be used
-func (a *SimpleChatAgent) selectToolForTask(ctx context.Context, message string, availableTools []tools.Tool) (*tools.Tool, map[string]any, error) {
+// selectToolForTask uses LLM to determine which tool should be used. The
+// decision records the choice whether or not it failed; its stage is left to
+// the caller.
+func (a *SimpleChatAgent) selectToolForTask(ctx context.Context, message string, availableTools []tools.Tool) (*tools.Tool, map[string]any, sessionpkg.SelectionDecision, error) {
+	var decision sessionpkg.SelectionDecision
+	availableTools = allowedTools(ctx, availableTools)
 	if len(availableTools) == 0 {
-		return nil, nil, nil // No tools available
+		return nil, nil, decision, nil // No tools available
 	}
-
-	// Build tools info
-	var toolsInfo strings.Builder
 	for _, tool := range availableTools {
-		toolsInfo.WriteString(fmt.Sprintf("- %s: %s\n", tool.Name(), tool.Description()))
+		decision.Candidates = append(decision.Candidates, tool.Name())
+	}
+	fail := func(err error) (*tools.Tool, map[string]any, sessionpkg.SelectionDecision, error) {
+		decision.Error = err.Error()
+		return nil, nil, decision.Bounded(), err
 	}
-
-	toolPrompt := fmt.Sprintf(`Based on the user's message, determine which tool should be used.
-
-Available tools:
-%s
-
-User message: %s
-
-Respond with a JSON object:
-- If no tool is needed: {"use_tool": false, "reason": "reason why no tool is needed"}
-- If a tool is needed: {"use_tool": true, "tool_name": "exact tool name", "args": {parameter: "value"}, "reason": "why this tool is appropriate"}
-
-IMPORTANT:
-- Return ONLY valid JSON
-- Do NOT use markdown code fences
-- Do NOT use `+"```json"+` wrapper
-- Select the tool that can best accomplish the user's request`, toolsInfo.String(), message)
 
 	// Create LLM call for tool selection
-	toolMsg := []llms.MessageContent{
-		{Role: llms.ChatMessageTypeSystem, Parts: []llms.ContentPart{llms.TextPart("You are a helpful assistant that selects appropriate tools for tasks. Respond only with valid JSON.")}},
-		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextPart(toolPrompt)}},
+	toolMsg, err := a.toolSelectionMessages(message, availableTools)
+	if err != nil {
+		return fail(fmt.Errorf("failed to build tool selection prompt: %w", err))
 	}
 
-	response, err := a.llm.GenerateContent(ctx, toolMsg)
+	response, err := a.auxLLM.GenerateContent(ctx, toolMsg)
 	if err != nil {
-		return nil, nil, fmt.Errorf("LLM call failed for tool selection: %w", err)
+		return fail(fmt.Errorf("LLM call failed for tool selection: %w", err))
 	}
 
 	if len(response.Choices) == 0 {
-		return nil, nil, fmt.Errorf("no response from LLM")
+		return fail(fmt.Errorf("no response from LLM"))
 	}
 
-	decision := response.Choices[0].Content
-	log.Printf("Tool selection decision: %s", decision)
-
-	// Clean up the decision
-	cleanDecision := strings.TrimSpace(decision)
-	if after, ok := strings.CutPrefix(cleanDecision, "```json"); ok {
-		cleanDecision = after
-		cleanDecision = strings.TrimSuffix(cleanDecision, "```")
-		cleanDecision = strings.TrimSpace(cleanDecision)
-	} else if after, ok := strings.CutPrefix(cleanDecision, "```"); ok {
-		cleanDecision = after
-		cleanDecision = strings.TrimSuffix(cleanDecision, "```")
-		cleanDecision = strings.TrimSpace(cleanDecision)
-	}
+	content := response.Choices[0].Content
+	log.Printf("Tool selection decision: %s", redact.LogContent(content))
 
 	// Parse the decision
 	var toolDecision struct {
-		UseTool  bool           `json:"use_tool"`
-		ToolName string         `json:"tool_name"`
-		Args     map[string]any `json:"args"`
-		Reason   string         `json:"reason"`
+		UseTool  bool            `json:"use_tool"`
+		ToolName string          `json:"tool_name"`
+		Args     json.RawMessage `json:"args"`
+		Reason   string          `json:"reason"`
 	}
 
-	if err := json.Unmarshal([]byte(cleanDecision), &toolDecision); err != nil {
-		return nil, nil, fmt.Errorf("failed to parse tool decision: %w", err)
+	if err := json.Unmarshal([]byte(cleanSelectionDecision(content)), &toolDecision); err != nil {
+		return fail(fmt.Errorf("failed to parse tool decision: %w", err))
 	}
+	decision.Reason = toolDecision.Reason
 
 	if toolDecision.UseTool {
 		// Find the selected tool
 		for _, tool := range availableTools {
 			if strings.EqualFold(tool.Name(), toolDecision.ToolName) {
-				log.Printf("Selected tool '%s' because: %s", toolDecision.ToolName, toolDecision.Reason)
-				return &tool, toolDecision.Args, nil
+				log.Printf("Selected tool '%s' because: %s", toolDecision.ToolName, redact.LogContent(toolDecision.Reason))
+				decision.Selected = tool.Name()
+				return &tool, decodeToolArgs(toolDecision.Args), decision.Bounded(), nil
 			}
 		}
-		return nil, nil, fmt.Errorf("tool '%s' not found in available tools", toolDecision.ToolName)
+		return fail(fmt.Errorf("tool '%s' not found in available tools", toolDecision.ToolName))
 	}
 
-	log.Printf("No tool selected: %s", toolDecision.Reason)
-	return nil, nil, nil
+	log.Printf("No tool selected: %s", redact.LogContent(toolDecision.Reason))
+	return nil, nil, decision.Bounded(), nil
+}
+
+// cleanSelectionDecision strips the code fence a model may wrap a selection
+// decision in
+func cleanSelectionDecision(decision string) string {
+	cleanDecision := strings.TrimSpace(decision)
+	if after, ok := strings.CutPrefix(cleanDecision, "```json"); ok {
+		cleanDecision = after
+		cleanDecision = strings.TrimSuffix(cleanDecision, "```")
+		cleanDecision = strings.TrimSpace(cleanDecision)
+	} else if after, ok := strings.CutPrefix(cleanDecision, "```"); ok {
+		cleanDecision = after
+		cleanDecision = strings.TrimSuffix(cleanDecision, "```")
+		cleanDecision = strings.TrimSpace(cleanDecision)
+	}
+	return cleanDecision
 }
 
 // HandleHealth handles health check requests
 func (s *ChatServer) HandleHealth(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	// Perform health checks using the health checker
-	if s.healthChecker != nil {
-		results := s.healthChecker.CheckHealth(ctx)
-
-		// Check if any check failed
-		allHealthy := true
-		for _, status := range results {
-			if status.Status == "unhealthy" {
-				allHealthy = false
-				break
-			}
-		}
+	healthy, results := s.checkHealth(r.Context())
 
-		w.Header().Set("Content-Type", "application/json")
-		if allHealthy {
-			w.WriteHeader(http.StatusOK)
-			if err := json.NewEncoder(w).Encode(map[string]any{
-				"status":    "healthy",
-				"timestamp": time.Now().UTC(),
-				"checks":    results,
-			}); err != nil {
-				log.Printf("Warning: Failed to encode healthy status response: %v", err)
-			}
-		} else {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			if err := json.NewEncoder(w).Encode(map[string]any{
-				"status":    "unhealthy",
-				"timestamp": time.Now().UTC(),
-				"checks":    results,
-			}); err != nil {
-				log.Printf("Warning: Failed to encode unhealthy status response: %v", err)
-			}
-		}
-	} else {
-		// Fallback health check
-		w.Header().Set("Content-Type", "application/json")
+	response := map[string]any{
+		"status":    "healthy",
+		"timestamp": time.Now().UTC(),
+	}
+	if results != nil {
+		response["checks"] = results
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if healthy {
 		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(map[string]any{
-			"status":    "healthy",
-			"timestamp": time.Now().UTC(),
-		}); err != nil {
-			log.Printf("Warning: Failed to encode fallback healthy response: %v", err)
-		}
+	} else {
+		response["status"] = "unhealthy"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode health status response: %v", err)
 	}
 }
 
@@ -1952,8 +2829,8 @@ func (s *ChatServer) HandleMetrics(w http.ResponseWriter, r *http.Request) {
 		s.metricsCollector.UpdateSystemMetrics()
 
 		// Redirect to the actual metrics server
-		if s.config.Monitoring.Enabled {
-			http.Redirect(w, r, fmt.Sprintf("http://localhost:%d/metrics", s.config.Monitoring.MetricsPort), http.StatusTemporaryRedirect)
+		if monitoring := s.GetConfig().Monitoring; monitoring.Enabled {
+			http.Redirect(w, r, fmt.Sprintf("http://localhost:%d/metrics", monitoring.MetricsPort), http.StatusTemporaryRedirect)
 			return
 		}
 	}
@@ -1969,58 +2846,34 @@ func (s *ChatServer) HandleMetrics(w http.ResponseWriter, r *http.Request) {
 
 // HandleReady handles readiness probe requests
 func (s *ChatServer) HandleReady(w http.ResponseWriter, r *http.Request) {
-	// Check if the server is ready to handle requests
-	ctx := r.Context()
-
-	// Perform basic readiness checks
-	if s.healthChecker != nil {
-		results := s.healthChecker.CheckHealth(ctx)
-
-		// Consider the service ready if at least one health check passes
-		ready := false
-		for _, status := range results {
-			if status.Status == "healthy" {
-				ready = true
-				break
-			}
-		}
+	status, message := s.checkReady(r.Context())
 
-		w.Header().Set("Content-Type", "application/json")
-		if ready {
-			w.WriteHeader(http.StatusOK)
-			if err := json.NewEncoder(w).Encode(map[string]any{
-				"status":    "ready",
-				"timestamp": time.Now().UTC(),
-			}); err != nil {
-				log.Printf("Warning: Failed to encode ready response: %v", err)
-			}
-		} else {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			if err := json.NewEncoder(w).Encode(map[string]any{
-				"status":    "not ready",
-				"timestamp": time.Now().UTC(),
-			}); err != nil {
-				log.Printf("Warning: Failed to encode not ready response: %v", err)
-			}
-		}
-	} else {
-		// Default to ready if no health checker is configured
-		w.Header().Set("Content-Type", "application/json")
+	response := map[string]any{
+		"status":    status,
+		"timestamp": time.Now().UTC(),
+	}
+	if message != "" {
+		response["message"] = message
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status == readyStatus {
 		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(map[string]any{
-			"status":    "ready",
-			"timestamp": time.Now().UTC(),
-		}); err != nil {
-			log.Printf("Warning: Failed to encode default ready response: %v", err)
-		}
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode ready response: %v", err)
 	}
 }
 
 // HandleInfo handles server info requests
 func (s *ChatServer) HandleInfo(w http.ResponseWriter, r *http.Request) {
+	buildInfo := version.Get()
 	info := map[string]any{
 		"service":     "LangChat Agent",
-		"version":     "1.0.0",
+		"version":     buildInfo.Version,
+		"build":       buildInfo,
 		"environment": "development", // TODO: Get from config manager
 		"timestamp":   time.Now().UTC(),
 		"features": map[string]any{
@@ -2039,18 +2892,19 @@ func (s *ChatServer) HandleInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add configuration summary
+	config := s.GetConfig()
 	info["config"] = map[string]any{
 		"server": map[string]any{
-			"host": s.config.Server.Host,
-			"port": s.config.Server.Port,
+			"host": config.Server.Host,
+			"port": config.Server.Port,
 		},
 		"agent": map[string]any{
-			"max_concurrent": s.config.Agent.MaxConcurrent,
-			"max_idle_time":  s.config.Agent.MaxIdleTime,
+			"max_concurrent": config.Agent.MaxConcurrent,
+			"max_idle_time":  config.Agent.MaxIdleTime,
 		},
 		"monitoring": map[string]any{
-			"enabled":      s.config.Monitoring.Enabled,
-			"metrics_port": s.config.Monitoring.MetricsPort,
+			"enabled":      config.Monitoring.Enabled,
+			"metrics_port": config.Monitoring.MetricsPort,
 		},
 	}
 
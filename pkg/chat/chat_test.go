@@ -0,0 +1,462 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/smallnest/langchat/pkg/audit"
+	"github.com/smallnest/langchat/pkg/auth"
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/httpclient"
+	"github.com/smallnest/langchat/pkg/middleware"
+	monitoringpkg "github.com/smallnest/langchat/pkg/monitoring"
+	"github.com/smallnest/langchat/pkg/prompts"
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// testMetrics is shared by the test servers, as metrics register globally
+var testMetrics = sync.OnceValue(monitoringpkg.NewMetricsCollector)
+
+// newTestServer returns a server with the default configuration and its
+// sessions in a temporary directory, without an LLM or background components
+func newTestServer(t *testing.T) *ChatServer {
+	t.Helper()
+	t.Setenv("LLM_API_KEY", "test-key")
+	manager := configpkg.NewManager(configpkg.Testing)
+	if err := manager.Load(""); err != nil {
+		t.Fatalf("Load config: %v", err)
+	}
+	cs := &ChatServer{
+		maxHistory:       100,
+		sessionDir:       t.TempDir(),
+		agents:           make(map[string]ChatAgent),
+		sessionManagers:  make(map[string]*sessionpkg.SessionManager),
+		smLastUsed:       make(map[string]time.Time),
+		requestSem:       make(chan struct{}, 10),
+		taggingSem:       make(chan struct{}, 2),
+		memorySem:        make(chan struct{}, 2),
+		maxConcurrent:    10,
+		metricsCollector: testMetrics(),
+		configManager:    manager,
+		loadShedder:      &loadShedder{},
+		shutdown:         make(chan struct{}),
+		listening:        make(chan struct{}),
+	}
+	cs.config.Store(manager.Get())
+	cs.chatPipeline = cs.newChatPipeline()
+	cs.editPipeline = cs.newEditPipeline()
+	cs.regenPipeline = cs.newRegeneratePipeline()
+	t.Cleanup(func() {
+		cs.agentMu.Lock()
+		for _, agent := range cs.agents {
+			if closer, ok := agent.(interface{ Close() error }); ok {
+				_ = closer.Close()
+			}
+		}
+		cs.agentMu.Unlock()
+		cs.smMu.Lock()
+		defer cs.smMu.Unlock()
+		for _, sm := range cs.sessionManagers {
+			sm.Close()
+		}
+	})
+	return cs
+}
+
+// counterValue returns the value of the counter with the given name and
+// labels, or 0 before it was first incremented
+func counterValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if want, ok := labels[label.GetName()]; ok && want != label.GetValue() {
+					continue metrics
+				}
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+// testRequest returns a request and the session manager of its user
+func testRequest(cs *ChatServer, method, target string) (*http.Request, *sessionpkg.SessionManager) {
+	r := httptest.NewRequest(method, target, nil)
+	return r, cs.GetSessionManager(cs.getClientID(r))
+}
+
+func TestConfigReloadDuringRequests(t *testing.T) {
+	cs := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(title string, feedback bool) {
+		data := fmt.Sprintf("llm:\n  model: model-%s\nui:\n  chat_title: %s\nfeatures:\n  feedback_enabled: %v\n", title, title, feedback)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	writeConfig("first", true)
+	manager := configpkg.NewManager(configpkg.Testing)
+	if err := manager.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	t.Cleanup(manager.StopWatching)
+	cs.configManager = manager
+	cs.config.Store(manager.Get())
+	cs.egress = httpclient.NewEgressGuard(nil, nil)
+	cs.authService = auth.NewAuthService("test-secret", time.Hour, time.Hour)
+	cs.auditLogger, _ = audit.NewLogger("")
+	cs.prompts = prompts.Default()
+	manager.OnReload(cs.handleConfigReload)
+
+	// Reloads swap the config while requests read it
+	stop := make(chan struct{})
+	var reloads sync.WaitGroup
+	reloads.Go(func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if i%2 == 0 {
+				writeConfig("second", false)
+			} else {
+				writeConfig("first", true)
+			}
+			if err := manager.Reload(); err != nil {
+				t.Errorf("Reload: %v", err)
+				return
+			}
+		}
+	})
+
+	var readers sync.WaitGroup
+	for range 8 {
+		readers.Go(func() {
+			for range 200 {
+				w := httptest.NewRecorder()
+				cs.HandleConfig(w, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+				var response struct {
+					ChatTitle      string `json:"chatTitle"`
+					EnableFeedback bool   `json:"enableFeedback"`
+					LLMModel       string `json:"llmModel"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Errorf("decode config response %s: %v", w.Body, err)
+					return
+				}
+				// A response comes from a single snapshot, and the LLM keeps its startup settings
+				if response.EnableFeedback != (response.ChatTitle == "first") || response.LLMModel != "model-first" {
+					t.Errorf("config response mixes snapshots: %+v", response)
+					return
+				}
+				_ = cs.configFor(httptest.NewRequest(http.MethodPost, "/api/chat", nil)).Agent.MaxHistory
+			}
+		})
+	}
+	readers.Wait()
+	close(stop)
+	reloads.Wait()
+}
+
+func TestHandlersRejectInvalidSessionIDs(t *testing.T) {
+	cs := newTestServer(t)
+	cs.SetWarmupAgent(cs.newAgent())
+
+	// Each handler gets the ID where its route carries it
+	inPath := func(name string) func(method, id string) *http.Request {
+		return func(method, id string) *http.Request {
+			r := httptest.NewRequest(method, "/api/sessions/x", strings.NewReader(`{"content":"edited","message":"hi","title":"t"}`))
+			r.SetPathValue(name, id)
+			r.SetPathValue("messageID", "7d444840-9dc0-11d1-b245-5ffdce74fad2")
+			r.SetPathValue("tag", "go")
+			return r
+		}
+	}
+	inQuery := func(method, id string) *http.Request {
+		return httptest.NewRequest(method, "/api/tools?session_id="+url.QueryEscape(id), nil)
+	}
+	inBody := func(method, id string) *http.Request {
+		body, _ := json.Marshal(map[string]string{"session_id": id, "message": "hi", "message_id": "m1", "feedback": "like"})
+		return httptest.NewRequest(method, "/api/chat", bytes.NewReader(body))
+	}
+	handlers := []struct {
+		name    string
+		method  string
+		handler http.HandlerFunc
+		request func(method, id string) *http.Request
+	}{
+		{"chat", http.MethodPost, cs.HandleChat, inBody},
+		{"feedback", http.MethodPost, cs.HandleFeedback, inBody},
+		{"delete session", http.MethodDelete, cs.HandleDeleteSession, inPath("id")},
+		{"update session", http.MethodPatch, cs.HandleUpdateSession, inPath("id")},
+		{"pin session", http.MethodPatch, cs.HandlePinSession, inPath("id")},
+		{"add tag", http.MethodPost, cs.HandleAddSessionTag, inPath("id")},
+		{"remove tag", http.MethodDelete, cs.HandleRemoveSessionTag, inPath("id")},
+		{"archive", http.MethodPost, cs.HandleArchiveSession, inPath("id")},
+		{"unarchive", http.MethodPost, cs.HandleUnarchiveSession, inPath("id")},
+		{"history", http.MethodGet, cs.HandleGetHistory, inPath("id")},
+		{"delete message", http.MethodDelete, cs.HandleDeleteMessage, inPath("id")},
+		{"edit message", http.MethodPost, cs.HandleEditMessage, inPath("id")},
+		{"regenerate", http.MethodPost, cs.HandleRegenerate, inPath("id")},
+		{"fork", http.MethodPost, cs.HandleForkSession, inPath("id")},
+		{"export", http.MethodGet, cs.HandleExportSession, inPath("id")},
+		{"agent events", http.MethodGet, cs.HandleAgentEvents, inPath("sessionID")},
+		{"MCP tools", http.MethodGet, cs.HandleMCPTools, inQuery},
+		{"hierarchical tools", http.MethodGet, cs.HandleToolsHierarchical, inQuery},
+		{"tools events", http.MethodGet, cs.HandleToolsEvents, inQuery},
+	}
+	for _, h := range handlers {
+		for _, id := range []string{"__warmup__", "../../x"} {
+			t.Run(h.name+" "+id, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				h.handler(w, h.request(h.method, id))
+				if w.Code != http.StatusBadRequest || w.Body.String() != "Invalid session ID\n" {
+					t.Fatalf("%s with session %q = %d %q, want 400 Invalid session ID", h.name, id, w.Code, w.Body)
+				}
+			})
+		}
+	}
+
+	// The warmup agent is kept apart from the session agents
+	cs.agentMu.RLock()
+	defer cs.agentMu.RUnlock()
+	if len(cs.agents) != 0 {
+		t.Fatalf("session agents = %v, want none", cs.agents)
+	}
+}
+
+func TestSessionStoreFallsBackToFiles(t *testing.T) {
+	tests := []struct {
+		name, storeType string
+		wantWarning     bool
+	}{
+		{"file", "file", false},
+		{"unavailable backend", "postgres", true},
+		{"unknown backend", "mongodb", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := newTestServer(t)
+			config := *cs.GetConfig()
+			config.Database.Type = tt.storeType
+			cs.config.Store(&config)
+			logs := captureLog(t, redact.NewLogPolicy(configpkg.LoggingConfig{}))
+
+			sm := cs.GetSessionManager("alice")
+			session := sm.CreateSession()
+			if _, err := sm.AddMessage(session.ID, "user", "hello"); err != nil {
+				t.Fatalf("AddMessage: %v", err)
+			}
+			sm.Flush()
+			if _, err := os.Stat(filepath.Join(cs.sessionDir, "users", "alice", session.ID+".json")); err != nil {
+				t.Fatalf("session file: %v", err)
+			}
+			if warned := strings.Contains(logs.String(), "falling back to files"); warned != tt.wantWarning {
+				t.Fatalf("fallback warning logged = %v, want %v:\n%s", warned, tt.wantWarning, logs)
+			}
+		})
+	}
+}
+
+func TestListToolsWhileLoading(t *testing.T) {
+	dir := t.TempDir()
+	const skillCount = 8
+	for i := range skillCount {
+		skill := filepath.Join(dir, fmt.Sprintf("skill%d", i))
+		if err := os.Mkdir(skill, 0o755); err != nil {
+			t.Fatalf("Mkdir: %v", err)
+		}
+		manifest := fmt.Sprintf("---\nname: skill%d\ndescription: Test skill %d\n---\n\n# Skill %d\n", i, i, i)
+		if err := os.WriteFile(filepath.Join(skill, "SKILL.md"), []byte(manifest), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	t.Setenv("SKILLS_DIR", dir)
+	t.Setenv("MCP_CONFIG_PATH", filepath.Join(dir, "missing-mcp.json"))
+
+	cs := newTestServer(t)
+	sessionID := sessionpkg.UUIDGenerator.NewID()
+	agent := cs.newAgent()
+	cs.agents[sessionID] = agent
+	agent.InitializeToolsAsync()
+
+	// List the tools through every path until loading has finished
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	loaded := make(chan struct{})
+	for _, handler := range []http.HandlerFunc{cs.HandleMCPTools, cs.HandleToolsHierarchical} {
+		wg.Go(func() {
+			for {
+				w := httptest.NewRecorder()
+				handler(w, httptest.NewRequest(http.MethodGet, "/api/tools?session_id="+sessionID, nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("listing tools = %d %s", w.Code, w.Body)
+					return
+				}
+				select {
+				case <-loaded:
+					return
+				default:
+				}
+			}
+		})
+	}
+	wg.Go(func() {
+		for {
+			_ = agent.GetAvailableTools()
+			select {
+			case <-loaded:
+				return
+			default:
+			}
+		}
+	})
+	err := agent.WaitReady(ctx)
+	close(loaded)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("WaitReady: %v", err)
+	}
+
+	var skills int
+	for _, tool := range agent.GetAvailableTools() {
+		if tool["type"] == "skill" {
+			skills++
+		}
+	}
+	if skills != skillCount {
+		t.Fatalf("GetAvailableTools lists %d skills, want %d", skills, skillCount)
+	}
+}
+
+func TestHandleFeedback(t *testing.T) {
+	cs := newTestServer(t)
+	cs.jwtAuth = middleware.NewAuthMiddleware("test-secret", time.Hour, time.Hour)
+	bearer := func(user string) string {
+		token, err := cs.jwtAuth.GenerateToken(user, user, []string{"user"})
+		if err != nil {
+			t.Fatalf("GenerateToken: %v", err)
+		}
+		return "Bearer " + token
+	}
+	alice, bob := bearer("alice"), bearer("bob")
+
+	sm := cs.GetSessionManager("alice")
+	session := sm.CreateSession()
+	messageID, err := sm.AddMessage(session.ID, "assistant", "an answer")
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	// bob owns another session, which does not hold alice's message
+	bobSession := cs.GetSessionManager("bob").CreateSession()
+
+	tests := []struct {
+		name          string
+		authorization string
+		sessionID     string
+		messageID     string
+		feedback      string
+		wantCode      int
+		wantFeedback  string
+	}{
+		{"like", alice, session.ID, messageID, "like", http.StatusOK, "like"},
+		{"dislike", alice, session.ID, messageID, "dislike", http.StatusOK, "dislike"},
+		{"invalid value", alice, session.ID, messageID, "love", http.StatusBadRequest, "dislike"},
+		{"value in capitals", alice, session.ID, messageID, "LIKE", http.StatusBadRequest, "dislike"},
+		{"no message ID", alice, session.ID, "", "like", http.StatusBadRequest, "dislike"},
+		{"unknown message", alice, session.ID, "missing", "like", http.StatusNotFound, "dislike"},
+		{"unknown session", alice, sessionpkg.UUIDGenerator.NewID(), messageID, "like", http.StatusNotFound, "dislike"},
+		{"session of another user", bob, session.ID, messageID, "like", http.StatusNotFound, "dislike"},
+		{"message of another user's session", bob, bobSession.ID, messageID, "like", http.StatusNotFound, "dislike"},
+		{"clear", alice, session.ID, messageID, "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric := tt.feedback
+			if metric == "" {
+				metric = "cleared"
+			}
+			before := counterValue(t, "message_feedback_total", map[string]string{"feedback": metric})
+
+			body, _ := json.Marshal(map[string]string{"session_id": tt.sessionID, "message_id": tt.messageID, "feedback": tt.feedback})
+			r := httptest.NewRequest(http.MethodPost, "/api/feedback", bytes.NewReader(body))
+			r.Header.Set("Authorization", tt.authorization)
+			w := httptest.NewRecorder()
+			cs.HandleFeedback(w, r)
+			if w.Code != tt.wantCode {
+				t.Fatalf("feedback = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+
+			message, err := sm.GetMessage(session.ID, messageID)
+			if err != nil || message.Feedback != tt.wantFeedback {
+				t.Fatalf("alice's message feedback = %q, %v, want %q", message.Feedback, err, tt.wantFeedback)
+			}
+			wantCounted := 0.0
+			if tt.wantCode == http.StatusOK {
+				wantCounted = 1
+			}
+			if got := counterValue(t, "message_feedback_total", map[string]string{"feedback": metric}) - before; got != wantCounted {
+				t.Fatalf("message_feedback_total{feedback=%q} grew by %v, want %v", metric, got, wantCounted)
+			}
+		})
+	}
+}
+
+func TestHandleMigrateSessionsRequiresMaintenance(t *testing.T) {
+	cs := newTestServer(t)
+	sm := cs.GetSessionManager("alice")
+	session := sm.CreateSession()
+	if _, err := sm.AddMessage(session.ID, "user", "move me"); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	target := filepath.Join(t.TempDir(), "migrated")
+	migrate := func() *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"to": "file", "to_dir": %q}`, target)
+		w := httptest.NewRecorder()
+		cs.HandleMigrateSessions(w, httptest.NewRequest(http.MethodPost, "/api/admin/sessions/migrate", strings.NewReader(body)))
+		return w
+	}
+
+	if w := migrate(); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "maintenance mode") {
+		t.Fatalf("migration outside maintenance = %d %s, want 409", w.Code, w.Body)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("target of the refused migration: %v, want it untouched", err)
+	}
+
+	cs.maintenance.enable("migrating sessions", time.Hour)
+	defer cs.maintenance.disable()
+	w := migrate()
+	var report sessionpkg.MigrateReport
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&report) != nil || report.Migrated != 1 {
+		t.Fatalf("migration in maintenance = %d %+v", w.Code, report)
+	}
+	if _, err := sessionpkg.NewFileSessionStore(filepath.Join(target, "users", "alice")).Load(session.ID); err != nil {
+		t.Fatalf("migrated session: %v", err)
+	}
+}
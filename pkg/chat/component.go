@@ -0,0 +1,286 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	monitoringpkg "github.com/smallnest/langchat/pkg/monitoring"
+)
+
+// componentCloseTimeout bounds the Close of a single component, so one stuck
+// component cannot keep the others from shutting down
+const componentCloseTimeout = 5 * time.Second
+
+// Component is a part of the server that owns background work, such as
+// goroutines, listeners or open files, and must be stopped on shutdown.
+// Close must be safe to call more than once.
+type Component interface {
+	Start(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// componentFuncs adapts a pair of functions to a Component; either may be
+// nil. Close only runs the close function once.
+type componentFuncs struct {
+	start     func(ctx context.Context) error
+	close     func(ctx context.Context) error
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (c *componentFuncs) Start(ctx context.Context) error {
+	if c.start == nil {
+		return nil
+	}
+	return c.start(ctx)
+}
+
+func (c *componentFuncs) Close(ctx context.Context) error {
+	c.closeOnce.Do(func() {
+		if c.close != nil {
+			c.closeErr = c.close(ctx)
+		}
+	})
+	return c.closeErr
+}
+
+// namedComponent is a registered component with the name used in logs
+type namedComponent struct {
+	name      string
+	component Component
+}
+
+// registerComponent adds a component to the server. Components are started
+// in registration order and closed in reverse, so a component must be
+// registered after the components it depends on.
+func (cs *ChatServer) registerComponent(name string, component Component) {
+	cs.componentsMu.Lock()
+	defer cs.componentsMu.Unlock()
+	cs.components = append(cs.components, namedComponent{name: name, component: component})
+}
+
+// startComponents starts the registered components in order. If one fails
+// to start, the ones already started are closed again.
+func (cs *ChatServer) startComponents(ctx context.Context) error {
+	cs.componentsMu.Lock()
+	components := cs.components
+	cs.componentsMu.Unlock()
+
+	for i, c := range components {
+		if err := c.component.Start(ctx); err != nil {
+			closeComponents(components[:i])
+			return fmt.Errorf("failed to start %s: %w", c.name, err)
+		}
+	}
+	return nil
+}
+
+// closeComponents closes components in reverse order, each with its own
+// timeout, and returns the errors of all of them
+func closeComponents(components []namedComponent) error {
+	var errs []error
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		if err := closeComponent(c); err != nil {
+			log.Printf("Error closing %s: %v", c.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closeComponent closes a component, giving up on it after componentCloseTimeout
+func closeComponent(c namedComponent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), componentCloseTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic during close: %v", r)
+			}
+		}()
+		done <- c.component.Close(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("close timed out after %v", componentCloseTimeout)
+	}
+}
+
+// registerComponents registers the components of the server in dependency
+// order: shared infrastructure first, request handling last, so shutdown
+// stops taking requests before it closes what requests use
+func (cs *ChatServer) registerComponents() {
+	cs.registerComponent("config watcher", &componentFuncs{
+		// Started by the config manager when the file was loaded
+		close: func(context.Context) error {
+			cs.configManager.StopWatching()
+			return nil
+		},
+	})
+	cs.registerComponent("audit log", &componentFuncs{
+		close: func(context.Context) error { return cs.auditLogger.Close() },
+	})
+	cs.registerComponent("dataset log", &componentFuncs{
+		close: func(context.Context) error { return cs.dataset.Close() },
+	})
+	cs.registerComponent("lifecycle manager", &componentFuncs{
+		close: func(context.Context) error {
+			cs.lifecycleManager.Stop()
+			return nil
+		},
+	})
+
+	if cfg := cs.GetConfig().Monitoring; cfg.Enabled {
+		metricsServer := monitoringpkg.NewMetricsServer(cs.metricsCollector, cfg.MetricsPort)
+		cs.registerComponent("metrics server", &componentFuncs{
+			start: func(context.Context) error {
+				log.Printf("🔧 Starting metrics server on port %d", cfg.MetricsPort)
+				go func() {
+					if err := metricsServer.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+						log.Printf("Failed to start metrics server: %v", err)
+					}
+				}()
+				return nil
+			},
+			close: metricsServer.Stop,
+		})
+	}
+
+	if cs.llmProbe != nil {
+		stopProbe := func() {}
+		cs.registerComponent("LLM probe", &componentFuncs{
+			start: func(context.Context) error {
+				var ctx context.Context
+				ctx, stopProbe = context.WithCancel(context.Background())
+				cs.llmProbe.start(ctx)
+				return nil
+			},
+			close: func(context.Context) error {
+				stopProbe()
+				return nil
+			},
+		})
+	}
+
+	cs.registerComponent("session store", &componentFuncs{
+		close: func(context.Context) error { return cs.closeSessionManagers() },
+	})
+	cs.registerComponent("background jobs", &componentFuncs{
+		close: cs.waitBackgroundJobs,
+	})
+	cs.registerComponent("agents", &componentFuncs{
+		close: func(context.Context) error { return cs.closeAgents() },
+	})
+	stopSweeper := func() {}
+	cs.registerComponent("agent sweeper", &componentFuncs{
+		start: func(context.Context) error {
+			var ctx context.Context
+			ctx, stopSweeper = context.WithCancel(context.Background())
+			cs.startAgentSweeper(ctx)
+			return nil
+		},
+		close: func(context.Context) error {
+			stopSweeper()
+			return nil
+		},
+	})
+	if retention := cs.GetConfig().Database.Retention; retention.MaxAge > 0 {
+		stopJanitor := func() {}
+		cs.registerComponent("session janitor", &componentFuncs{
+			start: func(context.Context) error {
+				var ctx context.Context
+				ctx, stopJanitor = context.WithCancel(context.Background())
+				cs.startSessionJanitor(ctx, retention)
+				return nil
+			},
+			close: func(context.Context) error {
+				stopJanitor()
+				return nil
+			},
+		})
+	}
+	if cs.activity != nil {
+		stopFlusher := func() {}
+		interval := cs.GetConfig().Activity.FlushInterval
+		cs.registerComponent("activity tracker", &componentFuncs{
+			start: func(context.Context) error {
+				var ctx context.Context
+				ctx, stopFlusher = context.WithCancel(context.Background())
+				cs.startActivityFlusher(ctx, interval)
+				return nil
+			},
+			close: func(context.Context) error {
+				stopFlusher()
+				return cs.activity.Flush()
+			},
+		})
+	}
+	if cs.budget != nil {
+		stopFlusher := func() {}
+		interval := cs.GetConfig().Budget.FlushInterval
+		cs.registerComponent("token budget", &componentFuncs{
+			start: func(context.Context) error {
+				var ctx context.Context
+				ctx, stopFlusher = context.WithCancel(context.Background())
+				cs.startBudgetFlusher(ctx, interval)
+				return nil
+			},
+			close: func(context.Context) error {
+				stopFlusher()
+				return cs.budget.Flush()
+			},
+		})
+	}
+	if cs.agentPool != nil {
+		cs.registerComponent("agent pool", &componentFuncs{
+			start: func(context.Context) error {
+				cs.agentPool.start()
+				return nil
+			},
+			close: func(context.Context) error {
+				cs.agentPool.close()
+				return nil
+			},
+		})
+	}
+
+	// The listeners are started by Start
+	cs.registerComponent("HTTP server", &componentFuncs{
+		close: func(ctx context.Context) error {
+			// End the event streams, which would otherwise keep Shutdown waiting
+			close(cs.shutdown)
+			return cs.stopHTTPServer(ctx)
+		},
+	})
+	cs.registerComponent("health probe server", &componentFuncs{
+		// Closed first so load balancers drain this instance
+		close: cs.stopHealthServer,
+	})
+}
+
+// waitBackgroundJobs waits for the running tagging and memory extraction
+// calls by taking every slot of their semaphores, which also keeps new ones
+// from starting
+func (cs *ChatServer) waitBackgroundJobs(ctx context.Context) error {
+	for _, sem := range []chan struct{}{cs.taggingSem, cs.memorySem} {
+		for range cap(sem) {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package chat
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+const (
+	// maxHintScanBytes bounds the work done on very large responses
+	maxHintScanBytes = 1 << 20
+	// maxCodeLanguages bounds the number of distinct languages reported
+	maxCodeLanguages = 16
+	// maxLanguageLength bounds the length of a reported language name
+	maxLanguageLength = 32
+)
+
+var (
+	// tableDelimiterRe matches a GFM table delimiter row such as "| --- | :-: |"
+	tableDelimiterRe = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	// inlineMathRe matches $...$ spans that look like math rather than prices
+	inlineMathRe = regexp.MustCompile(`(^|[^\\$\w])\$([^\s$](?:[^$\n]*[^\s$\\])?)\$($|[^$\w])`)
+	// inlineCodeRe matches inline code spans, whose content is never rendered
+	inlineCodeRe = regexp.MustCompile("`[^`\n]*`")
+)
+
+// ScanContentHints inspects markdown and reports which renderers it needs.
+// It works line by line in linear time and tolerates unterminated fences,
+// partial tables and arbitrary input.
+func ScanContentHints(text string) sessionpkg.ContentHints {
+	hints := sessionpkg.ContentHints{CodeLanguages: []string{}}
+	if len(text) > maxHintScanBytes {
+		text = text[:maxHintScanBytes]
+	}
+
+	var fence string // opening fence of the current code block, empty outside blocks
+	var inDisplayMath bool
+	var previous string
+
+	for line := range strings.SplitSeq(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if fence != "" {
+			// Closing fence: same character, at least as long, nothing after it
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+
+		if marker, info, ok := openingFence(line); ok {
+			fence = marker
+			addFenceLanguage(&hints, info)
+			previous = ""
+			continue
+		}
+
+		// Strip inline code so `$x$` or `| a |` inside it is not mistaken for content
+		prose := inlineCodeRe.ReplaceAllString(trimmed, "")
+
+		if !hints.HasLatex {
+			switch {
+			case inDisplayMath:
+				hints.HasLatex = true
+			case strings.Contains(prose, "$$"):
+				// A lone $$ opens a display block; a matched pair on one line is a formula
+				if strings.Count(prose, "$$") >= 2 {
+					hints.HasLatex = true
+				} else {
+					inDisplayMath = true
+				}
+			case containsDelimited(prose, `\[`, `\]`), containsDelimited(prose, `\(`, `\)`),
+				strings.Contains(prose, `\begin{`), inlineMathRe.MatchString(prose):
+				hints.HasLatex = true
+			}
+		}
+
+		// A table is a header row followed by a delimiter row
+		if !hints.HasTable && strings.Contains(previous, "|") && strings.Contains(prose, "|") && tableDelimiterRe.MatchString(prose) {
+			hints.HasTable = true
+		}
+
+		previous = prose
+	}
+
+	return hints
+}
+
+// openingFence reports whether line opens a fenced code block and returns the
+// fence marker and info string
+func openingFence(line string) (marker, info string, ok bool) {
+	// Up to three spaces of indentation are allowed
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	if indent > 3 {
+		return "", "", false
+	}
+	rest := line[indent:]
+
+	for _, ch := range []byte{'`', '~'} {
+		n := 0
+		for n < len(rest) && rest[n] == ch {
+			n++
+		}
+		if n < 3 {
+			continue
+		}
+		info = strings.TrimSpace(rest[n:])
+		// Backtick fences may not have backticks in the info string
+		if ch == '`' && strings.Contains(info, "`") {
+			return "", "", false
+		}
+		return rest[:n], info, true
+	}
+	return "", "", false
+}
+
+// addFenceLanguage records the language of a fenced block
+func addFenceLanguage(hints *sessionpkg.ContentHints, info string) {
+	lang, _, _ := strings.Cut(info, " ")
+	lang = strings.ToLower(strings.Trim(lang, "{}."))
+	// Keep only a leading run of plausible language-name characters
+	if i := strings.IndexFunc(lang, func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9') && !strings.ContainsRune("+#-_.", r)
+	}); i >= 0 {
+		lang = lang[:i]
+	}
+	if len(lang) > maxLanguageLength {
+		lang = lang[:maxLanguageLength]
+	}
+
+	switch lang {
+	case "":
+		return
+	case "mermaid":
+		hints.HasMermaid = true
+		return
+	case "math", "latex", "tex", "katex":
+		hints.HasLatex = true
+		return
+	}
+
+	if len(hints.CodeLanguages) < maxCodeLanguages && !slices.Contains(hints.CodeLanguages, lang) {
+		hints.CodeLanguages = append(hints.CodeLanguages, lang)
+	}
+}
+
+// containsDelimited reports whether s contains open followed later by close
+func containsDelimited(s, open, close string) bool {
+	i := strings.Index(s, open)
+	return i >= 0 && strings.Contains(s[i+len(open):], close)
+}
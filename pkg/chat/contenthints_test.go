@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+func TestScanContentHints(t *testing.T) {
+	manyFences := ""
+	for i := range maxCodeLanguages + 4 {
+		manyFences += fmt.Sprintf("```lang%d\n```\n", i)
+	}
+	manyLanguages := make([]string, maxCodeLanguages)
+	for i := range manyLanguages {
+		manyLanguages[i] = fmt.Sprintf("lang%d", i)
+	}
+
+	for _, tc := range []struct {
+		name string
+		text string
+		want sessionpkg.ContentHints
+	}{
+		{"empty", "", sessionpkg.ContentHints{}},
+		{"plain text", "Just an answer.\nWith two lines.", sessionpkg.ContentHints{}},
+		{"code languages in order", "```go\nx := 1\n```\n```Python {linenos=true}\n```\n```go\n```", sessionpkg.ContentHints{CodeLanguages: []string{"go", "python"}}},
+		{"braced info string", "```{r}\nplot(x)\n```", sessionpkg.ContentHints{CodeLanguages: []string{"r"}}},
+		{"fence without language", "```\ncode\n```", sessionpkg.ContentHints{}},
+		{"tilde fence", "~~~ruby\nputs 1\n~~~", sessionpkg.ContentHints{CodeLanguages: []string{"ruby"}}},
+		{"indented fence", "   ```sh\nls\n```", sessionpkg.ContentHints{CodeLanguages: []string{"sh"}}},
+		{"indented code is no fence", "    ```sh\n    ls", sessionpkg.ContentHints{}},
+		{"backtick in info string", "``` a`b\n$x$", sessionpkg.ContentHints{HasLatex: true}},
+		{"mermaid", "```mermaid\ngraph TD; A-->B\n```", sessionpkg.ContentHints{HasMermaid: true}},
+		{"math fence", "```math\nx^2\n```", sessionpkg.ContentHints{HasLatex: true}},
+		{"unterminated fence hides content", "```js\n$x$\n| a | b |\n|---|---|", sessionpkg.ContentHints{CodeLanguages: []string{"js"}}},
+		{"other fence character does not close", "~~~ruby\n```\n$x$\n~~~\n", sessionpkg.ContentHints{CodeLanguages: []string{"ruby"}}},
+		{"fence with text after it does not close", "```go\n``` not closing\n$x$\n````", sessionpkg.ContentHints{CodeLanguages: []string{"go"}}},
+		{"hostile language name", "```" + strings.Repeat("a", 100) + "<script>\n```", sessionpkg.ContentHints{CodeLanguages: []string{strings.Repeat("a", maxLanguageLength)}}},
+		{"language count is capped", manyFences, sessionpkg.ContentHints{CodeLanguages: manyLanguages}},
+		{"inline math", "The area is $\\pi r^2$.", sessionpkg.ContentHints{HasLatex: true}},
+		{"prices are no math", "It costs $5 and $10, or $ 3 $.", sessionpkg.ContentHints{}},
+		{"escaped dollars", `Pay \$5 or \$6`, sessionpkg.ContentHints{}},
+		{"math in inline code", "Write `$x$` for math", sessionpkg.ContentHints{}},
+		{"display math on one line", "$$E = mc^2$$", sessionpkg.ContentHints{HasLatex: true}},
+		{"display math block", "$$\nE = mc^2\n$$", sessionpkg.ContentHints{HasLatex: true}},
+		{"unterminated display math", "$$", sessionpkg.ContentHints{}},
+		{"bracket delimiters", `\[ x \]`, sessionpkg.ContentHints{HasLatex: true}},
+		{"parenthesis delimiters", `where \(a > 0\)`, sessionpkg.ContentHints{HasLatex: true}},
+		{"environment", `\begin{align} x \end{align}`, sessionpkg.ContentHints{HasLatex: true}},
+		{"table", "| a | b |\n|---|:-:|\n| 1 | 2 |", sessionpkg.ContentHints{HasTable: true}},
+		{"table without outer pipes", "a | b\n--- | ---", sessionpkg.ContentHints{HasTable: true}},
+		{"delimiter row without header", "|---|---|", sessionpkg.ContentHints{}},
+		{"horizontal rule after pipes", "a | b\n---", sessionpkg.ContentHints{}},
+		{"pipes in inline code", "`a | b`\n|---|", sessionpkg.ContentHints{}},
+		{"table in code", "```\n| a | b |\n|---|---|\n```", sessionpkg.ContentHints{}},
+		{"everything", "```mermaid\n```\n$x$\n| a |\n|---|\n```go\n", sessionpkg.ContentHints{CodeLanguages: []string{"go"}, HasLatex: true, HasMermaid: true, HasTable: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.want.CodeLanguages == nil {
+				tc.want.CodeLanguages = []string{}
+			}
+			if got := ScanContentHints(tc.text); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ScanContentHints(%q) = %+v, want %+v", tc.text, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScanContentHintsLargeInput(t *testing.T) {
+	// Content past the scan limit is not inspected
+	beyond := strings.Repeat("x", maxHintScanBytes) + "\n| a |\n|---|\n$x$"
+	if got := ScanContentHints(beyond); got.HasTable || got.HasLatex {
+		t.Fatalf("hints beyond the scan limit = %+v", got)
+	}
+
+	// Pathological inputs finish and stay within the language cap
+	for name, text := range map[string]string{
+		"pipes":   strings.Repeat("|", 4*maxHintScanBytes),
+		"dollars": strings.Repeat("$a", maxHintScanBytes),
+		"lines":   strings.Repeat("|-|\n", maxHintScanBytes/16),
+		"fences":  strings.Repeat("```x\n```y\n", maxHintScanBytes/16),
+	} {
+		if got := ScanContentHints(text); len(got.CodeLanguages) > maxCodeLanguages {
+			t.Errorf("scanning %s reported %d languages", name, len(got.CodeLanguages))
+		}
+	}
+}
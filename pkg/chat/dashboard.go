@@ -0,0 +1,204 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	agentpkg "github.com/smallnest/langchat/pkg/agent"
+	"github.com/smallnest/langchat/pkg/middleware"
+	monitoringpkg "github.com/smallnest/langchat/pkg/monitoring"
+	"github.com/smallnest/langchat/pkg/workspace"
+)
+
+// requestLabels carries what inner handlers learn about a request, such as
+// the matched route and the user, back to the dashboard middleware
+type requestLabels struct {
+	route     string
+	userID    string
+	sessionID string
+}
+
+// requestLabelsKey is the context key of the request labels
+type requestLabelsKey struct{}
+
+// labelsFromRequest returns the labels of a request, or nil outside the dashboard middleware
+func labelsFromRequest(r *http.Request) *requestLabels {
+	labels, _ := r.Context().Value(requestLabelsKey{}).(*requestLabels)
+	return labels
+}
+
+// setRequestSession attributes a request to a session for the active session count
+func setRequestSession(r *http.Request, sessionID string) {
+	if labels := labelsFromRequest(r); labels != nil {
+		labels.sessionID = sessionID
+	}
+}
+
+// statusRecorder captures the response status while passing writes and
+// flushes through, so streaming responses keep working
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records an implicit 200 status
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush flushes the underlying writer if it supports flushing
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// dashboardMiddleware records every request for the built-in dashboard. It
+// runs outermost; labelRequest fills in the route and user once they are known.
+func (cs *ChatServer) dashboardMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		labels := &requestLabels{}
+		r = r.WithContext(context.WithValue(r.Context(), requestLabelsKey{}, labels))
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		route := labels.route
+		if route == "" {
+			// Routes of the public mux; r.Pattern is set on the request it served
+			route = r.Pattern
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		cs.metricsCollector.RecordDashboardRequest(route, labels.userID, labels.sessionID, status, time.Since(start))
+	})
+}
+
+// labelRequest records the authenticated user and the matched API route. It
+// must run after authentication, directly in front of the protected mux.
+func labelRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		labels := labelsFromRequest(r)
+		if labels == nil {
+			return
+		}
+		labels.route = r.Pattern
+		if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
+			labels.userID = workspace.UserKey(claims.Workspace, claims.UserID)
+		}
+		if labels.sessionID == "" && strings.Contains(r.Pattern, "/api/sessions/{id}") {
+			labels.sessionID = r.PathValue("id")
+		}
+	})
+}
+
+// recordToolCalls records the tools used for a turn. Calls skipped by a dry
+// run are left out, as they say nothing about the tools.
+func (cs *ChatServer) recordToolCalls(toolCalls []ToolCallRecord) {
+	for _, call := range toolCalls {
+		if call.DryRun {
+			continue
+		}
+		status := "success"
+		if call.Failed() {
+			status = string(call.ErrorClass)
+		}
+		cs.metricsCollector.RecordToolCall(call.Tool, call.Skill, call.SkillVersion, status, call.Duration)
+	}
+}
+
+// recordTokenSpend records the provider-reported usage of a turn. The cost is
+// only known when usage reporting (and with it the pricing table) is enabled.
+func (cs *ChatServer) recordTokenSpend(result *StreamResult) {
+	if result == nil || result.Usage.PromptTokens+result.Usage.CompletionTokens == 0 {
+		return
+	}
+	var cost float64
+	if cs.pricing != nil {
+		cost = cs.pricing.Cost(cs.GetConfig().LLM.Model, result.Usage.PromptTokens, result.Usage.CompletionTokens)
+	}
+	cs.metricsCollector.RecordTokenSpend(int64(result.Usage.PromptTokens), int64(result.Usage.CachedTokens), int64(result.Usage.CompletionTokens), cost)
+}
+
+// HandleDashboard returns the built-in dashboard: request rates, latency,
+// errors, token spend and top routes, users and tools from in-memory counters,
+// and the recent lifecycle of the server.
+// The optional minutes parameter limits the time series (default and maximum 24h).
+func (cs *ChatServer) HandleDashboard(w http.ResponseWriter, r *http.Request) {
+	minutes := 0
+	if v := r.URL.Query().Get("minutes"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "minutes must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		minutes = n
+	}
+
+	type agentInfo struct {
+		Total  int `json:"total"`
+		Active int `json:"active"` // answering a request right now
+		Pooled int `json:"pooled"` // warm agents waiting in the pool
+	}
+	type dashboardResponse struct {
+		monitoringpkg.DashboardSnapshot
+		Agents    agentInfo              `json:"agents"`
+		Lifecycle *agentpkg.StateHistory `json:"lifecycle,omitempty"` // of the server's lifecycle manager
+	}
+
+	cs.agentMu.RLock()
+	total := len(cs.agents)
+	cs.agentMu.RUnlock()
+
+	response := dashboardResponse{
+		DashboardSnapshot: cs.metricsCollector.DashboardSnapshot(minutes),
+		Agents:            agentInfo{Total: total, Active: len(cs.requestSem)},
+	}
+	if cs.agentPool != nil {
+		response.Agents.Pooled = len(cs.agentPool.agents)
+	}
+	if cs.lifecycleManager != nil {
+		history := cs.lifecycleManager.History()
+		response.Lifecycle = &history
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode dashboard response: %v", err)
+	}
+}
+
+// HandleAdminPage serves the built-in dashboard page to administrators
+func (cs *ChatServer) HandleAdminPage(w http.ResponseWriter, r *http.Request) {
+	cs.pages.admin.serve(w, r)
+}
@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/dataset"
+	"github.com/smallnest/langchat/pkg/experiment"
+)
+
+// maxDatasetExportDays bounds the date range of a single dataset download
+const maxDatasetExportDays = 366
+
+// recordDatasetSample adds a finished chat turn to the evaluation dataset,
+// unless the turn is not sampled or the user opted out
+func (cs *ChatServer) recordDatasetSample(userID string, record dataset.Record, toolCalls []ToolCallRecord, assignment *experiment.Assignment) {
+	if !cs.dataset.Sampled(record.MessageID) {
+		return
+	}
+	if cs.GetSessionManager(userID).Preferences().DatasetOptOut {
+		return
+	}
+
+	record.UserID = userID
+	llmConfig := cs.GetConfig().LLM
+	record.Model = llmConfig.Model
+	if record.Parameters == nil {
+		record.Parameters = make(map[string]any)
+	}
+	record.Parameters["temperature"] = llmConfig.Temperature
+	record.Parameters["max_tokens"] = llmConfig.MaxTokens
+	if assignment != nil {
+		record.Experiment, record.Variant = assignment.Experiment, assignment.Variant
+		if v := assignment.Settings; v.Model != "" {
+			record.Model = v.Model
+		}
+		if v := assignment.Settings; v.Temperature != nil {
+			record.Parameters["temperature"] = *v.Temperature
+		}
+		if v := assignment.Settings; v.MaxTokens > 0 {
+			record.Parameters["max_tokens"] = v.MaxTokens
+		}
+	}
+
+	for _, call := range toolCalls {
+		record.Tools = append(record.Tools, dataset.ToolUse{
+			Name:       call.Tool,
+			Source:     call.Source,
+			Success:    !call.Failed(),
+			ErrorClass: string(call.ErrorClass),
+			Attempts:   call.Attempts,
+			DurationMs: call.Duration.Milliseconds(),
+		})
+	}
+
+	cs.dataset.Log(record)
+}
+
+// parseExportRange parses the from and to query parameters of an export as
+// inclusive UTC days (YYYY-MM-DD), both defaulting to today, spanning at most maxDays
+func parseExportRange(r *http.Request, maxDays int) (from, to time.Time, err error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to = today, today
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse(time.DateOnly, v); err != nil {
+			return from, to, fmt.Errorf("invalid from date, expected YYYY-MM-DD")
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse(time.DateOnly, v); err != nil {
+			return from, to, fmt.Errorf("invalid to date, expected YYYY-MM-DD")
+		}
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("to must not be before from")
+	}
+	if to.Sub(from) > time.Duration(maxDays)*24*time.Hour {
+		return from, to, fmt.Errorf("date range must not exceed %d days", maxDays)
+	}
+	return from, to, nil
+}
+
+// HandleExportDataset downloads the dataset samples of a date range as a single
+// JSONL file. from and to are inclusive UTC days (YYYY-MM-DD) and default to today.
+func (cs *ChatServer) HandleExportDataset(w http.ResponseWriter, r *http.Request) {
+	if cs.dataset == nil {
+		http.Error(w, "Dataset logging is disabled", http.StatusNotFound)
+		return
+	}
+
+	from, to, err := parseExportRange(r, maxDatasetExportDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	private, err := cs.exportPrivacy(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cs.watermarkExport(w, r, "dataset", private, map[string]any{
+		"from": from.Format(time.DateOnly),
+		"to":   to.Format(time.DateOnly),
+	})
+
+	var transform func(*dataset.Record)
+	if private {
+		transform = func(record *dataset.Record) {
+			record.UserID = cs.privacy.ID(record.UserID)
+			record.SessionID = cs.privacy.ID(record.SessionID)
+			record.Prompt = cs.privacy.Text(record.Prompt)
+			record.Response = cs.privacy.Text(record.Response)
+		}
+	}
+
+	filename := fmt.Sprintf("dataset-%s-%s.jsonl", from.Format(time.DateOnly), to.Format(time.DateOnly))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := cs.dataset.Export(w, from, to, transform); err != nil {
+		// Headers are already sent, so the download is cut short
+		log.Printf("Warning: Dataset export failed: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package chat
+
+import (
+	"cmp"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// selectionKey identifies a choice of a selection stage; selected is empty
+// when nothing was chosen
+type selectionKey struct {
+	stage    string
+	selected string
+}
+
+// selectionCounters are the raw counters behind SelectionStats
+type selectionCounters struct {
+	decisions  int64
+	failures   int64
+	likes      int64
+	dislikes   int64
+	lastReason string
+}
+
+// SelectionStats summarizes how often a skill or tool was chosen, or none
+// was, and how users rated the answers, since the server started. A choice
+// with a high dislike rate is a candidate for a wrong selection.
+type SelectionStats struct {
+	Stage       string  `json:"stage"`
+	Selected    string  `json:"selected"` // empty when nothing was chosen
+	Decisions   int64   `json:"decisions"`
+	Failures    int64   `json:"failures"` // selections that failed, counted under an empty Selected
+	Likes       int64   `json:"likes"`
+	Dislikes    int64   `json:"dislikes"`
+	DislikeRate float64 `json:"dislike_rate"` // dislikes / (likes + dislikes); 0 without feedback
+	LastReason  string  `json:"last_reason,omitempty"`
+}
+
+// selectionStats collects selection decisions and the feedback on the
+// answers they led to in memory. Choices are skills and tools offered to the
+// model, so the number of keys is bounded by the configured tools.
+type selectionStats struct {
+	mu       sync.Mutex
+	counters map[selectionKey]*selectionCounters
+}
+
+// newSelectionStats creates an empty selection statistics collector
+func newSelectionStats() *selectionStats {
+	return &selectionStats{counters: make(map[selectionKey]*selectionCounters)}
+}
+
+// get returns the counters of a choice. The caller must hold s.mu.
+func (s *selectionStats) get(decision sessionpkg.SelectionDecision) *selectionCounters {
+	key := selectionKey{stage: decision.Stage, selected: decision.Selected}
+	c := s.counters[key]
+	if c == nil {
+		c = &selectionCounters{}
+		s.counters[key] = c
+	}
+	return c
+}
+
+// record counts a decision
+func (s *selectionStats) record(decision sessionpkg.SelectionDecision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.get(decision)
+	c.decisions++
+	if decision.Error != "" {
+		c.failures++
+	}
+	if decision.Reason != "" {
+		c.lastReason = decision.Reason
+	}
+}
+
+// recordFeedback counts feedback on an answer a decision led to; previous is
+// the feedback it replaces, so changing a vote is not counted twice
+func (s *selectionStats) recordFeedback(decision sessionpkg.SelectionDecision, previous, feedback string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.get(decision)
+	switch previous {
+	case "like":
+		c.likes--
+	case "dislike":
+		c.dislikes--
+	}
+	switch feedback {
+	case "like":
+		c.likes++
+	case "dislike":
+		c.dislikes++
+	}
+}
+
+// summary returns the statistics of all choices, the most disliked first
+func (s *selectionStats) summary() []SelectionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := make([]SelectionStats, 0, len(s.counters))
+	for key, c := range s.counters {
+		stats := SelectionStats{
+			Stage:      key.stage,
+			Selected:   key.selected,
+			Decisions:  c.decisions,
+			Failures:   c.failures,
+			Likes:      c.likes,
+			Dislikes:   c.dislikes,
+			LastReason: c.lastReason,
+		}
+		if votes := c.likes + c.dislikes; votes > 0 {
+			stats.DislikeRate = float64(c.dislikes) / float64(votes)
+		}
+		summary = append(summary, stats)
+	}
+	slices.SortFunc(summary, func(a, b SelectionStats) int {
+		return cmp.Or(
+			cmp.Compare(b.Dislikes, a.Dislikes),
+			cmp.Compare(b.Decisions, a.Decisions),
+			cmp.Compare(a.Stage, b.Stage),
+			cmp.Compare(a.Selected, b.Selected),
+		)
+	})
+	return summary
+}
+
+// recordSelections records the selection decisions of a turn
+func (cs *ChatServer) recordSelections(decisions []sessionpkg.SelectionDecision) {
+	for _, decision := range decisions {
+		cs.selectionStats.record(decision)
+		selected := decision.Selected
+		switch {
+		case decision.Error != "":
+			selected = "error"
+		case selected == "":
+			selected = "none"
+		}
+		cs.metricsCollector.RecordSelectionDecision(decision.Stage, selected)
+	}
+}
+
+// recordSelectionFeedback counts feedback on a message against the selection
+// decisions that led to it; previous is the message before the feedback was updated
+func (cs *ChatServer) recordSelectionFeedback(previous sessionpkg.Message, feedback string) {
+	if previous.Feedback == feedback {
+		return
+	}
+	for _, decision := range previous.Decisions {
+		cs.selectionStats.recordFeedback(decision, previous.Feedback, feedback)
+	}
+}
+
+// HandleSelectionStats lists the skill and tool selection choices with their
+// counts and feedback collected since the server started, the most disliked first
+func (cs *ChatServer) HandleSelectionStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"selections": cs.selectionStats.summary(),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode selection stats response: %v", err)
+	}
+}
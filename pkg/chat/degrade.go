@@ -0,0 +1,121 @@
+package chat
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// loadWindow is the number of recent chat turns the p95 latency is computed over
+const loadWindow = 100
+
+// Pressures that degrade chat turns
+const (
+	pressureUtilization = "utilization"
+	pressureLatency     = "latency"
+)
+
+// loadShedder decides when chat turns are degraded to shed load. It keeps the
+// latencies of recent turns; the thresholds are read from the config on each
+// check, so they follow config reloads.
+type loadShedder struct {
+	mu        sync.Mutex
+	latencies [loadWindow]time.Duration
+	count     int    // latencies recorded, up to loadWindow
+	next      int    // index of the next latency
+	pressure  string // why turns are degraded, empty when they are not
+}
+
+// observe records the latency of a finished chat turn
+func (s *loadShedder) observe(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latencies[s.next] = d
+	s.next = (s.next + 1) % loadWindow
+	s.count = min(s.count+1, loadWindow)
+}
+
+// p95Locked returns the p95 latency of the recent turns. The caller must hold s.mu.
+func (s *loadShedder) p95Locked() time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	latencies := slices.Clone(s.latencies[:s.count])
+	slices.Sort(latencies)
+	return latencies[(s.count*95+99)/100-1]
+}
+
+// check returns the pressure a new turn is degraded for, or an empty string
+// when it is not; busy and slots are the used and total request slots. It
+// reports whether degraded mode was entered or left.
+func (s *loadShedder) check(config configpkg.DegradationConfig, busy, slots int) (pressure string, changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if config.Enabled && slots > 0 {
+		utilization := float64(busy) / float64(slots)
+		slow := config.P95Latency > 0 && s.p95Locked() >= config.P95Latency
+		switch {
+		case utilization >= config.Utilization:
+			pressure = pressureUtilization
+		case slow:
+			pressure = pressureLatency
+		case s.pressure != "" && utilization >= config.RecoverUtilization:
+			pressure = s.pressure // not recovered yet
+		}
+	}
+
+	changed = (pressure == "") != (s.pressure == "")
+	s.pressure = pressure
+	return pressure, changed
+}
+
+// chatShedLoad degrades the turn while the server is saturated: the skill and
+// MCP tool selection calls are skipped and the answer may be capped, so the
+// turn costs a single LLM call
+func (cs *ChatServer) chatShedLoad(t *chatTurn) bool {
+	config := cs.GetConfig().Agent.Degradation
+	pressure, changed := cs.loadShedder.check(config, len(cs.requestSem), cap(cs.requestSem))
+	if changed {
+		cs.metricsCollector.SetDegradationActive(pressure != "")
+		if pressure != "" {
+			log.Printf("⚠️  Degrading chat turns to shed load (%s)", pressure)
+		} else {
+			log.Printf("Load dropped, chat turns are no longer degraded")
+		}
+	}
+	if pressure == "" {
+		return true
+	}
+
+	t.degraded = true
+	if config.SkipTools {
+		t.req.UserSettings.EnableSkills = false
+		t.req.UserSettings.EnableMCP = false
+	}
+	t.maxTokens = config.MaxTokens
+	cs.metricsCollector.RecordDegradedTurn(pressure)
+	return true
+}
+
+// maxTokensKey is the context key of the answer length cap of a degraded turn
+type maxTokensKey struct{}
+
+// withMaxTokens returns a context in which the answer is capped at maxTokens; 0 keeps the limit
+func withMaxTokens(ctx context.Context, maxTokens int) context.Context {
+	if maxTokens <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, maxTokensKey{}, maxTokens)
+}
+
+// maxTokensFrom returns the answer length cap of the turn of ctx, or 0
+func maxTokensFrom(ctx context.Context) int {
+	maxTokens, _ := ctx.Value(maxTokensKey{}).(int)
+	return maxTokens
+}
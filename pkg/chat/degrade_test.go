@@ -0,0 +1,271 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/tools"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// degradation returns an enabled degradation config with the given thresholds
+func degradation(utilization, recoverUtilization float64, p95 time.Duration) configpkg.DegradationConfig {
+	return configpkg.DegradationConfig{
+		Enabled:            true,
+		Utilization:        utilization,
+		RecoverUtilization: recoverUtilization,
+		P95Latency:         p95,
+		SkipTools:          true,
+	}
+}
+
+func TestLoadShedderCheck(t *testing.T) {
+	type step struct {
+		busy         int
+		wantPressure string
+		wantChanged  bool
+	}
+	tests := []struct {
+		name   string
+		config configpkg.DegradationConfig
+		steps  []step
+	}{
+		{"disabled", configpkg.DegradationConfig{Utilization: 0.8}, []step{{10, "", false}}},
+		{"below the threshold", degradation(0.8, 0.6, 0), []step{{7, "", false}}},
+		{"saturated", degradation(0.8, 0.6, 0), []step{
+			{8, pressureUtilization, true},
+			{10, pressureUtilization, false},
+		}},
+		{"recovers below the recover threshold", degradation(0.8, 0.6, 0), []step{
+			{9, pressureUtilization, true},
+			{7, pressureUtilization, false},
+			{6, pressureUtilization, false},
+			{5, "", true},
+			{7, "", false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &loadShedder{}
+			for i, step := range tt.steps {
+				pressure, changed := s.check(tt.config, step.busy, 10)
+				if pressure != step.wantPressure || changed != step.wantChanged {
+					t.Fatalf("step %d: check with %d/10 busy = %q, %v, want %q, %v",
+						i, step.busy, pressure, changed, step.wantPressure, step.wantChanged)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadShedderLatency(t *testing.T) {
+	s := &loadShedder{}
+	config := degradation(0.8, 0.6, 50*time.Millisecond)
+	if pressure, _ := s.check(config, 0, 10); pressure != "" {
+		t.Fatalf("check without latencies = %q, want no pressure", pressure)
+	}
+
+	// 94 fast turns keep the p95 fast, the 95th slow one makes it slow
+	for range 94 {
+		s.observe(10 * time.Millisecond)
+	}
+	for range 6 {
+		s.observe(time.Second)
+	}
+	s.mu.Lock()
+	p95 := s.p95Locked()
+	s.mu.Unlock()
+	if p95 != time.Second {
+		t.Fatalf("p95 = %v, want 1s", p95)
+	}
+	if pressure, changed := s.check(config, 0, 10); pressure != pressureLatency || !changed {
+		t.Fatalf("check with a slow p95 = %q, %v, want %q entered", pressure, changed, pressureLatency)
+	}
+
+	// The window keeps the recent turns only
+	for range loadWindow {
+		s.observe(10 * time.Millisecond)
+	}
+	if pressure, changed := s.check(config, 0, 10); pressure != "" || !changed {
+		t.Fatalf("check after fast turns = %q, %v, want degradation left", pressure, changed)
+	}
+}
+
+func TestChatShedLoad(t *testing.T) {
+	cs := newTestServer(t)
+	config := *cs.GetConfig()
+	config.Agent.Degradation = degradation(0.8, 0.6, 0)
+	config.Agent.Degradation.MaxTokens = 256
+	cs.config.Store(&config)
+	t.Cleanup(func() { cs.metricsCollector.SetDegradationActive(false) })
+
+	newTurn := func() *chatTurn {
+		turn := &chatTurn{}
+		turn.req.UserSettings.EnableSkills = true
+		turn.req.UserSettings.EnableMCP = true
+		return turn
+	}
+
+	turn := newTurn()
+	if !cs.chatShedLoad(turn) || turn.degraded || !turn.req.UserSettings.EnableMCP || turn.maxTokens != 0 {
+		t.Fatalf("idle server degraded the turn: %+v", turn)
+	}
+
+	for range 8 {
+		cs.requestSem <- struct{}{}
+	}
+	before := counterValue(t, "chat_degraded_turns_total", map[string]string{"reason": pressureUtilization})
+	turn = newTurn()
+	if !cs.chatShedLoad(turn) {
+		t.Fatal("chatShedLoad stopped a degraded turn")
+	}
+	if !turn.degraded || turn.req.UserSettings.EnableSkills || turn.req.UserSettings.EnableMCP || turn.maxTokens != 256 {
+		t.Fatalf("saturated server did not degrade the turn: %+v", turn)
+	}
+	if got := counterValue(t, "chat_degraded_turns_total", map[string]string{"reason": pressureUtilization}); got != before+1 {
+		t.Fatalf("degraded turns = %v, want %v", got, before+1)
+	}
+}
+
+// saturatedLLM is a provider serving a few requests at a time, each taking
+// delay; the others queue for a slot
+type saturatedLLM struct {
+	slots     chan struct{}
+	delay     time.Duration
+	maxTokens atomic.Int32 // of the last call
+}
+
+func newSaturatedLLM(concurrency int, delay time.Duration) *saturatedLLM {
+	return &saturatedLLM{slots: make(chan struct{}, concurrency), delay: delay}
+}
+
+func (m *saturatedLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	m.maxTokens.Store(int32(opts.MaxTokens))
+
+	select {
+	case m.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-m.slots }()
+	time.Sleep(m.delay)
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "an answer"}}}, nil
+}
+
+func (m *saturatedLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// saturate sends turns asking for MCP tools from concurrent clients to a
+// server whose provider serves fewer at a time, and returns the p95
+// latency of the turns and how many were degraded
+func saturate(t *testing.T, degrade bool) (p95 time.Duration, degraded int) {
+	t.Helper()
+	const (
+		clients = 10
+		turns   = 8
+	)
+	cs := newTestServer(t)
+	model := newSaturatedLLM(4, 40*time.Millisecond)
+	cs.llm, cs.auxLLM = model, model
+	if degrade {
+		config := *cs.GetConfig()
+		config.Agent.Degradation = degradation(0.5, 0.3, 0)
+		cs.config.Store(&config)
+		t.Cleanup(func() { cs.metricsCollector.SetDegradationActive(false) })
+	}
+
+	// Agents whose tools are loaded, so each normal turn selects an MCP tool first
+	_, sm := testRequest(cs, http.MethodPost, "/api/chat")
+	sessions := make([]string, clients)
+	for i := range sessions {
+		sessions[i] = sm.CreateSession().ID
+		agent := cs.newAgent()
+		agent.toolsEnabled = true
+		agent.mcpTools = []tools.Tool{&faultTool{}}
+		cs.agents[sessions[i]] = agent
+	}
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		wg        sync.WaitGroup
+	)
+	for _, sessionID := range sessions {
+		wg.Go(func() {
+			for range turns {
+				body := chatRequest{SessionID: sessionID, Message: "search the web"}
+				body.UserSettings.EnableMCP = true
+				start := time.Now()
+				w := postChat(t, cs, body)
+				elapsed := time.Since(start)
+				if w.Code != http.StatusOK {
+					t.Errorf("chat = %d %s", w.Code, w.Body)
+					return
+				}
+				mu.Lock()
+				latencies = append(latencies, elapsed)
+				if strings.Contains(w.Body.String(), `"degraded":true`) {
+					degraded++
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	if len(latencies) == 0 {
+		t.FailNow()
+	}
+	slices.Sort(latencies)
+	return latencies[(len(latencies)*95+99)/100-1], degraded
+}
+
+func TestDegradationImprovesP95UnderSaturation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+	normal, degraded := saturate(t, false)
+	if degraded != 0 {
+		t.Fatalf("%d turns degraded with degradation disabled", degraded)
+	}
+	shed, degraded := saturate(t, true)
+	t.Logf("p95 under saturation: %v normal, %v shedding load (%d turns degraded)", normal, shed, degraded)
+	if degraded == 0 {
+		t.Fatal("no turn degraded under saturation")
+	}
+	if shed > normal*85/100 {
+		t.Fatalf("p95 shedding load = %v, want it well below the normal %v", shed, normal)
+	}
+}
+
+func TestDegradedTurnCapsTheAnswer(t *testing.T) {
+	cs := newTestServer(t)
+	model := newSaturatedLLM(1, 0)
+	cs.llm, cs.auxLLM = model, model
+	config := *cs.GetConfig()
+	config.Agent.Degradation = degradation(0.1, 0.05, 0)
+	config.Agent.Degradation.MaxTokens = 64
+	cs.config.Store(&config)
+	t.Cleanup(func() { cs.metricsCollector.SetDegradationActive(false) })
+
+	_, sm := testRequest(cs, http.MethodPost, "/api/chat")
+	w := postChat(t, cs, chatRequest{SessionID: sm.CreateSession().ID, Message: "hello"})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"degraded":true`) {
+		t.Fatalf("chat = %d %s, want a degraded answer", w.Code, w.Body)
+	}
+	if got := model.maxTokens.Load(); got != 64 {
+		t.Fatalf("answer called with MaxTokens %d, want 64", got)
+	}
+}
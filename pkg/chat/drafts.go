@@ -0,0 +1,74 @@
+package chat
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// draftCheckpointer periodically saves the answer streamed so far, so it can be
+// recovered if the server stops before the stream ends
+type draftCheckpointer struct {
+	sm        *sessionpkg.SessionManager
+	sessionID string
+	interval  time.Duration
+	bytes     int
+
+	content   strings.Builder
+	startedAt time.Time
+	savedAt   time.Time
+	savedLen  int
+	saved     bool // a checkpoint exists on disk
+}
+
+// newDraftCheckpointer returns a checkpointer for a stream, or nil when checkpoints are disabled
+func (cs *ChatServer) newDraftCheckpointer(sm *sessionpkg.SessionManager, sessionID string) *draftCheckpointer {
+	cfg := cs.GetConfig().Agent
+	if cfg.DraftInterval <= 0 && cfg.DraftBytes <= 0 {
+		return nil
+	}
+	now := time.Now()
+	return &draftCheckpointer{
+		sm:        sm,
+		sessionID: sessionID,
+		interval:  cfg.DraftInterval,
+		bytes:     cfg.DraftBytes,
+		startedAt: now,
+		savedAt:   now,
+	}
+}
+
+// add appends a streamed chunk and writes a checkpoint when one is due
+func (d *draftCheckpointer) add(chunk string) {
+	if d == nil {
+		return
+	}
+	d.content.WriteString(chunk)
+
+	dueByTime := d.interval > 0 && time.Since(d.savedAt) >= d.interval
+	dueBySize := d.bytes > 0 && d.content.Len()-d.savedLen >= d.bytes
+	if !dueByTime && !dueBySize {
+		return
+	}
+
+	now := time.Now()
+	draft := &sessionpkg.Draft{Content: d.content.String(), StartedAt: d.startedAt, UpdatedAt: now}
+	if err := d.sm.SaveDraft(d.sessionID, draft); err != nil {
+		log.Printf("Warning: Failed to checkpoint draft of session %s: %v", redact.LogID(d.sessionID), err)
+	}
+	d.savedAt, d.savedLen, d.saved = now, d.content.Len(), true
+}
+
+// clear removes the checkpoint once the stream has ended. It is safe to call more than once.
+func (d *draftCheckpointer) clear() {
+	if d == nil || !d.saved {
+		return
+	}
+	if err := d.sm.ClearDraft(d.sessionID); err != nil {
+		log.Printf("Warning: Failed to clear draft of session %s: %v", redact.LogID(d.sessionID), err)
+	}
+	d.saved = false
+}
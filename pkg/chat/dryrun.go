@@ -0,0 +1,28 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+)
+
+// dryRunKey is the context key marking chat turns whose tools are not executed
+type dryRunKey struct{}
+
+// withDryRun returns a context in which tools are selected but not called
+func withDryRun(ctx context.Context, dryRun bool) context.Context {
+	if !dryRun {
+		return ctx
+	}
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// isDryRun reports whether the tools of the turn of ctx must not be executed
+func isDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
+
+// dryRunSummary describes the call a dry run skipped
+func dryRunSummary(record ToolCallRecord) string {
+	return fmt.Sprintf("dry run — would have called %s with args %s", record.Tool, record.Args)
+}
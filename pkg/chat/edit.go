@@ -0,0 +1,145 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// newEditPipeline composes the stages of HandleEditMessage: a chat turn
+// whose message replaces an earlier user message, always streamed
+func (cs *ChatServer) newEditPipeline() *ChatPipeline {
+	p := cs.newChatPipeline()
+	stages := make([]chatStage, 0, len(p.stages)+1)
+	for _, stage := range p.stages {
+		switch stage.name {
+		case "validate":
+			stage.run = cs.editValidate
+		case "authorize":
+			stages = append(stages, stage)
+			stage = chatStage{name: "edit_target", run: cs.editTarget}
+		}
+		stages = append(stages, stage)
+	}
+	p.stages = stages
+	p.nonStream = nil
+	return p
+}
+
+// HandleEditMessage replaces the content of a user message, removes the
+// messages after it and streams a new answer, as if the conversation had
+// gone on from the edited message
+func (cs *ChatServer) HandleEditMessage(w http.ResponseWriter, r *http.Request) {
+	cs.editPipeline.Serve(w, r)
+}
+
+// editValidate decodes the body of an edit, which takes the new content and
+// the settings of a chat request, and targets the message in the path
+func (cs *ChatServer) editValidate(t *chatTurn) bool {
+	var body struct {
+		chatRequest
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(t.r.Body).Decode(&body); err != nil {
+		log.Printf("Failed to decode request: %v", err)
+		http.Error(t.w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	if body.Content == "" {
+		http.Error(t.w, "content is required", http.StatusBadRequest)
+		return false
+	}
+
+	t.req = body.chatRequest
+	t.req.SessionID = t.r.PathValue("id")
+	t.req.Message = body.Content
+	t.req.Stream = true
+	t.editID = t.r.PathValue("messageID")
+	if rejectInvalidSessionID(t.w, t.req.SessionID) {
+		return false
+	}
+	return cs.checkChatRequest(t)
+}
+
+// editTarget checks that the edited message is a user message of the session
+func (cs *ChatServer) editTarget(t *chatTurn) bool {
+	msg, err := t.sm.GetMessage(t.req.SessionID, t.editID)
+	if err != nil {
+		http.Error(t.w, err.Error(), messageErrorStatus(err))
+		return false
+	}
+	if msg.Role != "user" {
+		http.Error(t.w, "only user messages can be edited", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// persistEdit replaces the edited message and rebuilds the context of the
+// session's agent from the messages before it, so the stale turns after it
+// are no longer sent to the model
+func (cs *ChatServer) persistEdit(t *chatTurn, userMsg sessionpkg.Message) bool {
+	sessionID := t.req.SessionID
+	userMsg.ID = t.editID
+	history, err := t.sm.EditMessage(sessionID, userMsg)
+	switch {
+	case errors.Is(err, sessionpkg.ErrMessageNotFound), errors.Is(err, sessionpkg.ErrNotUserMessage):
+		http.Error(t.w, err.Error(), http.StatusConflict)
+		return false
+	case err != nil && history == nil:
+		http.Error(t.w, err.Error(), messageErrorStatus(err))
+		return false
+	case err != nil:
+		log.Printf("Warning: Failed to save edited message of session %s: %v", redact.LogID(sessionID), err)
+	}
+
+	cs.agentMu.RLock()
+	agent := cs.agents[sessionID]
+	cs.agentMu.RUnlock()
+	if simpleAgent, ok := agent.(*SimpleChatAgent); ok {
+		simpleAgent.RebuildHistory(history)
+	}
+	if t.replaced != "" {
+		cs.sessionEvents.publish(t.userID, SessionEvent{Type: "message_deleted", SessionID: sessionID, Data: t.replaced})
+	} else {
+		cs.sessionEvents.publish(t.userID, SessionEvent{Type: "message_edited", SessionID: sessionID, Data: t.editID})
+	}
+	return true
+}
+
+// RebuildHistory replaces the conversation in the context of the agent with
+// the messages of a session, keeping the system prompt and memories.
+// Synthetic messages are left out, as they are never sent to the model.
+func (a *SimpleChatAgent) RebuildHistory(messages []sessionpkg.Message) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	head := 0
+	if len(a.messages) > 0 && a.messages[0].Role == llms.ChatMessageTypeSystem {
+		head = 1
+		if a.hasMemories {
+			head = 2
+		}
+	}
+	a.messages = slices.Clip(a.messages[:head])
+	for _, msg := range messages {
+		if msg.Synthetic {
+			continue
+		}
+		role := llms.ChatMessageTypeAI
+		if msg.Role == "user" {
+			role = llms.ChatMessageTypeHuman
+		}
+		a.messages = append(a.messages, llms.MessageContent{
+			Role:  role,
+			Parts: []llms.ContentPart{llms.TextPart(msg.Content)},
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// representationETag returns the entity tag of a response built from state
+// at version for the user. The path and the sorted query are part of it, so
+// the pages and formats of the same state have different tags.
+func representationETag(r *http.Request, userID string, version sessionpkg.Version) string {
+	h := sha256.New()
+	for _, part := range []string{version.Tag, userID, r.URL.Path, r.URL.Query().Encode()} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the
+// weak comparison of RFC 9110
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNotModified sets the validators of a response built from state at
+// version and answers 304 Not Modified when the request's conditional headers
+// show the client already has it. If-None-Match takes precedence over
+// If-Modified-Since. It reports whether the response was written.
+func checkNotModified(w http.ResponseWriter, r *http.Request, userID string, version sessionpkg.Version) bool {
+	etag := representationETag(r, userID, version)
+	modified := version.ModifiedAt.UTC().Truncate(time.Second)
+
+	headers := w.Header()
+	headers.Set("ETag", etag)
+	headers.Set("Last-Modified", modified.Format(http.TimeFormat))
+	// Responses are per user; clients may keep them but must revalidate
+	headers.Set("Cache-Control", "private, no-cache")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	notModified := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		notModified = etagMatches(inm, etag)
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if since, err := http.ParseTime(ims); err == nil {
+			notModified = !modified.After(since)
+		}
+	}
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return notModified
+}
@@ -0,0 +1,219 @@
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `"abc"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"old", "abc"`, true},
+		{`*`, true},
+		{`"old"`, false},
+		{`abc`, false},
+		{`"abcd"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%s, %s) = %v, want %v", tt.header, etag, got, tt.want)
+		}
+	}
+}
+
+func TestCheckNotModified(t *testing.T) {
+	modified := time.Date(2026, 3, 1, 12, 30, 15, 500_000_000, time.UTC)
+	version := sessionpkg.Version{Tag: "v1", ModifiedAt: modified}
+	lastModified := "Sun, 01 Mar 2026 12:30:15 GMT"
+	etag := representationETag(httptest.NewRequest(http.MethodGet, "/api/sessions", nil), "alice", version)
+	tests := []struct {
+		name            string
+		method          string
+		ifNoneMatch     string
+		ifModifiedSince string
+		want            bool
+	}{
+		{"unconditional", http.MethodGet, "", "", false},
+		{"current etag", http.MethodGet, etag, "", true},
+		{"head", http.MethodHead, etag, "", true},
+		{"stale etag", http.MethodGet, `"stale"`, "", false},
+		{"last modified", http.MethodGet, "", lastModified, true},
+		{"later", http.MethodGet, "", "Sun, 01 Mar 2026 13:00:00 GMT", true},
+		{"a second before", http.MethodGet, "", "Sun, 01 Mar 2026 12:30:14 GMT", false},
+		{"invalid date", http.MethodGet, "", "yesterday", false},
+		// If-None-Match takes precedence, either way
+		{"stale etag and last modified", http.MethodGet, `"stale"`, lastModified, false},
+		{"current etag and a second before", http.MethodGet, etag, "Sun, 01 Mar 2026 12:30:14 GMT", true},
+		{"post", http.MethodPost, etag, lastModified, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/sessions", nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			if tt.ifModifiedSince != "" {
+				r.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+			w := httptest.NewRecorder()
+			if got := checkNotModified(w, r, "alice", version); got != tt.want {
+				t.Fatalf("checkNotModified = %v, want %v", got, tt.want)
+			}
+			if tt.want && w.Code != http.StatusNotModified {
+				t.Fatalf("status = %d, want 304", w.Code)
+			}
+			// The validators are sent either way
+			headers := w.Header()
+			if headers.Get("ETag") != etag || headers.Get("Last-Modified") != lastModified || headers.Get("Cache-Control") != "private, no-cache" {
+				t.Fatalf("validators = %v", headers)
+			}
+		})
+	}
+}
+
+func TestRepresentationETag(t *testing.T) {
+	version := sessionpkg.Version{Tag: "v1", ModifiedAt: time.Now()}
+	etag := func(target, userID string, version sessionpkg.Version) string {
+		return representationETag(httptest.NewRequest(http.MethodGet, target, nil), userID, version)
+	}
+	base := etag("/api/sessions?limit=10&offset=20", "alice", version)
+	if other := etag("/api/sessions?offset=20&limit=10", "alice", version); other != base {
+		t.Errorf("reordered query %s, want the etag %s", other, base)
+	}
+	for name, other := range map[string]string{
+		"other page":    etag("/api/sessions?limit=10&offset=30", "alice", version),
+		"other limit":   etag("/api/sessions?limit=20&offset=20", "alice", version),
+		"cursor":        etag("/api/sessions?limit=10&cursor=abc", "alice", version),
+		"unpaginated":   etag("/api/sessions", "alice", version),
+		"other path":    etag("/api/sessions/search?limit=10&offset=20", "alice", version),
+		"other user":    etag("/api/sessions?limit=10&offset=20", "bob", version),
+		"other version": etag("/api/sessions?limit=10&offset=20", "alice", sessionpkg.Version{Tag: "v2"}),
+	} {
+		if other == base {
+			t.Errorf("%s has the same etag %s", name, base)
+		}
+	}
+}
+
+func TestSessionListNotModified(t *testing.T) {
+	cs := newTestServer(t)
+	_, sm := testRequest(cs, http.MethodGet, "/api/sessions")
+	first := sm.CreateSession()
+	sm.CreateSession()
+	list := func(query string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/sessions"+query, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		cs.HandleListSessions(w, r)
+		return w
+	}
+
+	w := list("")
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if w.Code != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("list = %d with ETag %q and Last-Modified %q", w.Code, etag, lastModified)
+	}
+	if w := list("", "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("list with the current etag = %d %s, want 304", w.Code, w.Body)
+	}
+	if w := list("", "If-Modified-Since", lastModified); w.Code != http.StatusNotModified {
+		t.Fatalf("list modified since its Last-Modified = %d, want 304", w.Code)
+	}
+
+	// Each page has its own etag
+	pages := map[string]string{"": etag}
+	for _, query := range []string{"?limit=1", "?limit=1&offset=1", "?limit=2", "?limit=1&archived=true", "?tag=work"} {
+		w := list(query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list%s = %d", query, w.Code)
+		}
+		pageETag := w.Header().Get("ETag")
+		for other, otherETag := range pages {
+			if pageETag == otherETag {
+				t.Fatalf("list%s has the etag of list%s", query, other)
+			}
+		}
+		pages[query] = pageETag
+		if w := list(query, "If-None-Match", etag); w.Code != http.StatusOK {
+			t.Fatalf("list%s with the etag of the whole list = %d, want 200", query, w.Code)
+		}
+		if w := list(query, "If-None-Match", pageETag); w.Code != http.StatusNotModified {
+			t.Fatalf("list%s with its etag = %d, want 304", query, w.Code)
+		}
+	}
+
+	// A change makes the validator stale: the list is sent again with a new etag
+	if _, err := sm.AddMessage(first.ID, "user", "hello"); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	w = list("", "If-None-Match", etag)
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Fatalf("list with a stale etag = %d, want 200 with the list", w.Code)
+	}
+	newETag := w.Header().Get("ETag")
+	if newETag == "" || newETag == etag {
+		t.Fatalf("etag after a change = %q, want a new one", newETag)
+	}
+	if w := list("", "If-None-Match", newETag); w.Code != http.StatusNotModified {
+		t.Fatalf("list with the new etag = %d, want 304", w.Code)
+	}
+	if w := list("", "If-None-Match", etag+", "+newETag); w.Code != http.StatusNotModified {
+		t.Fatalf("list with the old and new etags = %d, want 304", w.Code)
+	}
+
+	// Another user does not share the validators
+	r := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	r.Header.Set("User-Agent", "another browser")
+	r.Header.Set("If-None-Match", newETag)
+	w = httptest.NewRecorder()
+	cs.HandleListSessions(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == newETag {
+		t.Fatalf("list of another user = %d with ETag %s, want 200 with its own", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestHistoryStaleValidator(t *testing.T) {
+	cs := newTestServer(t)
+	_, sm := testRequest(cs, http.MethodGet, "/")
+	sessionID, _ := seedHistory(t, sm, 0)
+	conditional := func(query, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/sessions/"+sessionID+"/history"+query, nil)
+		r.SetPathValue("id", sessionID)
+		r.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		cs.HandleGetHistory(w, r)
+		return w
+	}
+
+	etag := getHistory(t, cs, sessionID, "", nil).Header().Get("ETag")
+	pageETag := getHistory(t, cs, sessionID, "?limit=1", nil).Header().Get("ETag")
+	legacyETag := getHistory(t, cs, sessionID, "?format=legacy", nil).Header().Get("ETag")
+	if pageETag == etag || legacyETag == etag || pageETag == legacyETag {
+		t.Fatalf("etags of the history %s, a page %s and the legacy format %s, want them distinct", etag, pageETag, legacyETag)
+	}
+	if w := conditional("?limit=1", etag); w.Code != http.StatusOK {
+		t.Fatalf("page with the etag of the whole history = %d, want 200", w.Code)
+	}
+
+	if _, err := sm.AddMessage(sessionID, "user", "new"); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	w := conditional("", etag)
+	if newETag := w.Header().Get("ETag"); w.Code != http.StatusOK || newETag == "" || newETag == etag {
+		t.Fatalf("stale validator = %d with ETag %q, want 200 with a new etag", w.Code, newETag)
+	}
+	if w := conditional("", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Fatalf("new validator = %d, want 304", w.Code)
+	}
+}
@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/experiment"
+	"github.com/smallnest/langchat/pkg/middleware"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// VariantSetter is implemented by agents that can answer with an experiment variant
+type VariantSetter interface {
+	SetVariant(variant *configpkg.VariantConfig)
+}
+
+// assignExperiment returns the experiment variant of the current user's turn, or nil.
+// Experiments are read from the live configuration so a kill switch applies immediately.
+func (cs *ChatServer) assignExperiment(r *http.Request, userID string) *experiment.Assignment {
+	experiments := cs.configManager.Get().Experiments
+	if len(experiments) == 0 {
+		return nil
+	}
+
+	var roles []string
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok {
+		roles = user.Roles
+	}
+	return experiment.Assign(experiments, userID, roles)
+}
+
+// applyVariant configures the agent for the settings of a turn, or restores
+// its defaults for nil settings
+func (cs *ChatServer) applyVariant(agent ChatAgent, variant *configpkg.VariantConfig) {
+	if setter, ok := agent.(VariantSetter); ok {
+		setter.SetVariant(variant)
+	}
+}
+
+// turnVariant returns the settings a turn is answered with: those of the
+// assigned variant, if any, with the model replaced when it is not one of the
+// allowed models. A disallowed variant model falls back to the default model,
+// and a disallowed default model to the first allowed one. It returns nil for
+// the defaults of the agent.
+func turnVariant(assignment *experiment.Assignment, llm configpkg.LLMConfig) *configpkg.VariantConfig {
+	var variant *configpkg.VariantConfig
+	if assignment != nil {
+		settings := assignment.Settings
+		variant = &settings
+	}
+	allowed := llm.AllowedModels
+	if len(allowed) == 0 {
+		return variant
+	}
+	if variant != nil && variant.Model != "" && !slices.Contains(allowed, variant.Model) {
+		variant.Model = ""
+	}
+	if (variant == nil || variant.Model == "") && !slices.Contains(allowed, llm.Model) {
+		if variant == nil {
+			variant = &configpkg.VariantConfig{}
+		}
+		variant.Model = allowed[0]
+	}
+	return variant
+}
+
+// stampExperiment records the assigned variant on a message
+func stampExperiment(msg *sessionpkg.Message, assignment *experiment.Assignment) {
+	if assignment != nil {
+		msg.Experiment, msg.Variant = assignment.Experiment, assignment.Variant
+	}
+}
+
+// recordExperimentMessage counts an answer of a variant and its latency
+func (cs *ChatServer) recordExperimentMessage(assignment *experiment.Assignment, latency time.Duration) {
+	if assignment == nil {
+		return
+	}
+	cs.experimentStats.RecordMessage(assignment.Experiment, assignment.Variant, latency)
+	cs.metricsCollector.RecordExperimentMessage(assignment.Experiment, assignment.Variant, latency)
+}
+
+// recordExperimentFeedback counts feedback on a message answered by a variant;
+// previous is the message before the feedback was updated
+func (cs *ChatServer) recordExperimentFeedback(previous sessionpkg.Message, feedback string) {
+	if previous.Experiment == "" || previous.Feedback == feedback {
+		return
+	}
+	cs.experimentStats.RecordFeedback(previous.Experiment, previous.Variant, previous.Feedback, feedback)
+	if feedback != "" {
+		cs.metricsCollector.RecordExperimentFeedback(previous.Experiment, previous.Variant, feedback)
+	}
+}
+
+// HandleListExperiments lists the configured experiments with per-variant statistics
+// collected since the server started
+func (cs *ChatServer) HandleListExperiments(w http.ResponseWriter, r *http.Request) {
+	type variantInfo struct {
+		experiment.VariantStats
+		Weight int    `json:"weight"`
+		Model  string `json:"model,omitempty"`
+	}
+	type experimentInfo struct {
+		Name     string                 `json:"name"`
+		Running  bool                   `json:"running"`
+		Cohort   configpkg.CohortConfig `json:"cohort"`
+		Variants []variantInfo          `json:"variants"`
+	}
+
+	experiments := cs.configManager.Get().Experiments
+	result := make([]experimentInfo, 0, len(experiments))
+	for _, exp := range experiments {
+		names := make([]string, len(exp.Variants))
+		for i, v := range exp.Variants {
+			names[i] = v.Name
+		}
+
+		info := experimentInfo{Name: exp.Name, Running: !exp.Disabled, Cohort: exp.Cohort}
+		for i, stats := range cs.experimentStats.Summary(exp.Name, names) {
+			info.Variants = append(info.Variants, variantInfo{
+				VariantStats: stats,
+				Weight:       exp.Variants[i].Weight,
+				Model:        exp.Variants[i].Model,
+			})
+		}
+		result = append(result, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"experiments": result}); err != nil {
+		log.Printf("Warning: Failed to encode experiments response: %v", err)
+	}
+}
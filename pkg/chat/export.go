@@ -0,0 +1,281 @@
+package chat
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// maxSessionExportDays bounds the date range of a single session export
+const maxSessionExportDays = 366
+
+// sessionExportFlushEvery is the number of exported messages after which the
+// response is flushed to the client
+const sessionExportFlushEvery = 500
+
+// sessionExportColumns is the header row of CSV session exports
+var sessionExportColumns = []string{"user_id", "session_id", "message_id", "role", "timestamp", "feedback", "tools", "tool_errors", "settings", "content"}
+
+// sessionExportRecord is one exported message, a JSONL line or a CSV row
+type sessionExportRecord struct {
+	UserID    string                `json:"user_id"`
+	SessionID string                `json:"session_id"`
+	MessageID string                `json:"message_id"`
+	Role      string                `json:"role"`
+	Content   string                `json:"content"`
+	Timestamp time.Time             `json:"timestamp"`
+	Feedback  string                `json:"feedback,omitempty"`
+	ToolCalls []sessionpkg.ToolCall `json:"tool_calls,omitempty"`
+	Settings  *sessionpkg.Settings  `json:"settings,omitempty"` // user messages only
+}
+
+// sessionExportWriter writes exported messages in one of the export formats
+type sessionExportWriter interface {
+	Write(record sessionExportRecord) error
+	Flush() error
+}
+
+// jsonlExportWriter writes one JSON object per message
+type jsonlExportWriter struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlExportWriter) Write(record sessionExportRecord) error {
+	return e.enc.Encode(record)
+}
+
+func (e *jsonlExportWriter) Flush() error {
+	return nil
+}
+
+// csvExportWriter writes a header row and one row per message; tools are
+// listed by name, separated by semicolons, with the number of failed calls in
+// tool_errors, and the settings of user messages are a JSON object
+type csvExportWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (e *csvExportWriter) writeHeader() error {
+	if e.wroteHeader {
+		return nil
+	}
+	e.wroteHeader = true
+	return e.w.Write(sessionExportColumns)
+}
+
+func (e *csvExportWriter) Write(record sessionExportRecord) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	tools := make([]string, 0, len(record.ToolCalls))
+	var toolErrors int
+	for _, call := range record.ToolCalls {
+		tools = append(tools, call.Tool)
+		if call.Error != "" {
+			toolErrors++
+		}
+	}
+	var settings string
+	if record.Settings != nil {
+		data, err := json.Marshal(record.Settings)
+		if err != nil {
+			return err
+		}
+		settings = string(data)
+	}
+	return e.w.Write([]string{
+		record.UserID,
+		record.SessionID,
+		record.MessageID,
+		record.Role,
+		record.Timestamp.UTC().Format(time.RFC3339),
+		record.Feedback,
+		strings.Join(tools, ";"),
+		strconv.Itoa(toolErrors),
+		settings,
+		record.Content,
+	})
+}
+
+func (e *csvExportWriter) Flush() error {
+	// An empty export still gets its header
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// newSessionExportWriter returns the writer of an export format and its
+// content type and file extension
+func newSessionExportWriter(format string, w io.Writer) (sessionExportWriter, string, string, error) {
+	switch format {
+	case "", "jsonl":
+		return &jsonlExportWriter{enc: json.NewEncoder(w)}, "application/x-ndjson", "jsonl", nil
+	case "csv":
+		return &csvExportWriter{w: csv.NewWriter(w)}, "text/csv; charset=utf-8", "csv", nil
+	default:
+		return nil, "", "", fmt.Errorf("invalid format %q, expected jsonl or csv", format)
+	}
+}
+
+// HandleAdminExport streams the messages of all users' sessions sent in a
+// date range as JSONL or CSV. from and to are inclusive UTC days (YYYY-MM-DD)
+// and default to today. Sessions are read from disk one at a time, so the
+// export never holds more than a single session in memory.
+func (cs *ChatServer) HandleAdminExport(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseExportRange(r, maxSessionExportDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	end := to.Add(24 * time.Hour)
+
+	format := r.URL.Query().Get("format")
+	exporter, contentType, ext, err := newSessionExportWriter(format, w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	private, err := cs.exportPrivacy(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The export reads the session files, so write what is still queued
+	cs.smMu.Lock()
+	for _, sm := range cs.sessionManagers {
+		sm.Flush()
+	}
+	cs.smMu.Unlock()
+
+	cs.watermarkExport(w, r, "sessions", private, map[string]any{
+		"from":   from.Format(time.DateOnly),
+		"to":     to.Format(time.DateOnly),
+		"format": ext,
+	})
+
+	filename := fmt.Sprintf("sessions-%s-%s.%s", from.Format(time.DateOnly), to.Format(time.DateOnly), ext)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	flusher, _ := w.(http.Flusher)
+	var written int
+	err = sessionpkg.WalkUsers(cs.sessionDir, func(userID string, session *sessionpkg.Session) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		// Sessions entirely outside the range have no message to export
+		if session.UpdatedAt.Before(from) || !session.CreatedAt.Before(end) {
+			return nil
+		}
+
+		defaults := sessionpkg.DefaultSettings(session.Persona)
+		for _, msg := range session.Messages {
+			if msg.Synthetic || msg.Timestamp.Before(from) || !msg.Timestamp.Before(end) {
+				continue
+			}
+			record := sessionExportRecord{
+				UserID:    userID,
+				SessionID: session.ID,
+				MessageID: msg.ID,
+				Role:      msg.Role,
+				Content:   msg.Content,
+				Timestamp: msg.Timestamp,
+				Feedback:  msg.Feedback,
+				ToolCalls: msg.ToolCalls,
+				Settings:  msg.Settings,
+			}
+			if msg.Role == "user" && record.Settings == nil {
+				record.Settings = &defaults
+			}
+			if private {
+				record.UserID = cs.privacy.ID(record.UserID)
+				record.SessionID = cs.privacy.ID(record.SessionID)
+				record.Content = cs.privacy.Text(record.Content)
+				record.ToolCalls = make([]sessionpkg.ToolCall, len(msg.ToolCalls))
+				for i, call := range msg.ToolCalls {
+					if call.Error != "" {
+						call.Error = cs.privacy.Text(call.Error)
+					}
+					record.ToolCalls[i] = call
+				}
+			}
+			if err := exporter.Write(record); err != nil {
+				return err
+			}
+
+			if written++; written%sessionExportFlushEvery == 0 {
+				if err := exporter.Flush(); err != nil {
+					return err
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = exporter.Flush()
+	}
+	if err != nil {
+		// Headers are already sent, so the download is cut short
+		log.Printf("Warning: Session export failed after %d messages: %v", written, err)
+	}
+}
+
+// HandleExportSession downloads the conversation of a session of the current
+// user, as Markdown (format=markdown, the default) or as the JSON array of
+// its messages (format=json)
+func (cs *ChatServer) HandleExportSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
+
+	var export func(*sessionpkg.Session) ([]byte, error)
+	var contentType, ext string
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "markdown", "md":
+		export, contentType, ext = sessionpkg.ExportMarkdown, "text/markdown; charset=utf-8", "md"
+	case "json":
+		export, contentType, ext = sessionpkg.ExportJSON, "application/json", "json"
+	default:
+		http.Error(w, fmt.Sprintf("invalid format %q, expected markdown or json", format), http.StatusBadRequest)
+		return
+	}
+
+	session, err := cs.GetSessionManager(cs.getClientID(r)).GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), sessionLoadStatus(err))
+		return
+	}
+	data, err := export(session)
+	if err != nil {
+		log.Printf("Failed to export session %s: %v", redact.LogID(sessionID), err)
+		http.Error(w, "Failed to export session", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": sessionpkg.ExportFilename(session, ext),
+	}))
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Warning: Failed to write session export: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/faults"
+)
+
+// injectedFaults returns the number of faults of a kind injected so far
+func injectedFaults(t *testing.T, target string, fault faults.Fault) float64 {
+	t.Helper()
+	return counterValue(t, "faults_injected_total", map[string]string{"target": target, "fault": string(fault)})
+}
+
+// withFaults enables fault injection on a test server as NewChatServer does
+func withFaults(cs *ChatServer, model *stubLLM, config configpkg.FaultInjectionConfig) {
+	config.Enabled = true
+	config.Header = "X-Fault-Injection"
+	cs.faults = faults.New(config, func(target string, fault faults.Fault) {
+		cs.metricsCollector.RecordInjectedFault(target, string(fault))
+	})
+	cs.llm = cs.faults.WrapModel(model)
+}
+
+// postFaultyChat posts a chat turn to a new session asking for the faults in header
+func postFaultyChat(t *testing.T, cs *ChatServer, header, message string) *httptest.ResponseRecorder {
+	t.Helper()
+	_, sm := testRequest(cs, http.MethodPost, "/api/chat")
+	data, err := json.Marshal(chatRequest{SessionID: sm.CreateSession().ID, Message: message})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/chat", bytes.NewReader(data))
+	r.Header.Set("X-Fault-Injection", header)
+	w := httptest.NewRecorder()
+	cs.HandleChat(w, r)
+	return w
+}
+
+// faultTool is a tool answering "result"
+type faultTool struct{ calls int }
+
+func (t *faultTool) Name() string        { return "search" }
+func (t *faultTool) Description() string { return "Searches the web" }
+func (t *faultTool) Call(ctx context.Context, input string) (string, error) {
+	t.calls++
+	return "result", nil
+}
+
+func TestChatWithInjectedLLMError(t *testing.T) {
+	cs := newTestServer(t)
+	model := &stubLLM{answer: "a real answer"}
+	withFaults(cs, model, configpkg.FaultInjectionConfig{})
+	before := injectedFaults(t, faults.TargetLLM, faults.LLMError)
+
+	w := postFaultyChat(t, cs, "llm_error", "hello")
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "injected fault") {
+		t.Fatalf("chat = %d %s, want a failed chat with the injected fault", w.Code, w.Body)
+	}
+	if model.calls.Load() != 0 {
+		t.Fatalf("model called %d times despite the fault", model.calls.Load())
+	}
+	if got := injectedFaults(t, faults.TargetLLM, faults.LLMError) - before; got != 1 {
+		t.Fatalf("%v LLM errors counted, want 1", got)
+	}
+
+	// Requests without the header are served normally
+	w = postFaultyChat(t, cs, "", "hello")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "a real answer") {
+		t.Fatalf("chat without faults = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestChatWithInjectedSlowLLM(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	cs := newTestServer(t)
+	model := &stubLLM{answer: "a slow answer"}
+	withFaults(cs, model, configpkg.FaultInjectionConfig{LLMDelay: delay})
+
+	start := time.Now()
+	w := postFaultyChat(t, cs, "llm_slow", "hello")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "a slow answer") {
+		t.Fatalf("chat = %d %s, want the delayed answer", w.Code, w.Body)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Fatalf("chat took %v, want at least %v", elapsed, delay)
+	}
+}
+
+func TestToolCallWithInjectedFaults(t *testing.T) {
+	cs := newTestServer(t)
+	withFaults(cs, &stubLLM{}, configpkg.FaultInjectionConfig{})
+	agent := &SimpleChatAgent{llm: cs.llm}
+
+	tests := []struct {
+		header     string
+		wantClass  ToolErrorClass
+		wantResult string
+	}{
+		{"tool_timeout=search", ToolErrorTimeout, ""},
+		{"tool_garbage", "", "\x00"},
+		{"tool_timeout=fetch", "", "result"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+			r.Header.Set("X-Fault-Injection", tt.header)
+			tool := &faultTool{}
+			record := agent.callTool(cs.faults.WithRequest(context.Background(), r), "find it", tool, map[string]any{"query": "q"}, toolHooks{})
+			if record.ErrorClass != tt.wantClass {
+				t.Fatalf("ErrorClass = %q (%s), want %q", record.ErrorClass, record.Error, tt.wantClass)
+			}
+			if !strings.Contains(record.Result, tt.wantResult) {
+				t.Fatalf("Result = %q, want it to contain %q", record.Result, tt.wantResult)
+			}
+			if faulty := tt.wantResult != "result"; faulty == (tool.calls > 0) {
+				t.Fatalf("tool called %d times with faults %q", tool.calls, tt.header)
+			}
+		})
+	}
+}
+
+func TestFaultInjectionRefusedInProduction(t *testing.T) {
+	t.Setenv("LLM_API_KEY", "test-key")
+	t.Setenv("FAULT_INJECTION_ENABLED", "true")
+	for _, environment := range []configpkg.Environment{configpkg.Production, configpkg.Testing} {
+		manager := configpkg.NewManager(environment)
+		err := manager.Load("")
+		if refused := err != nil && strings.Contains(err.Error(), "fault injection"); refused != (environment == configpkg.Production) {
+			t.Fatalf("Load in %s = %v", environment, err)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// SessionEvent notifies a user's other devices about changes to their sessions
+type SessionEvent struct {
+	Type      string    `json:"type"` // folder_created, folder_updated, folder_deleted, session_moved, session_renamed, session_tagged, session_variables, session_archived, session_unarchived, session_pinned, session_unpinned, session_forked, message_deleted, message_edited, generation_started, streaming_progress, generation_finished
+	Time      time.Time `json:"time"`
+	FolderID  string    `json:"folder_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Data      any       `json:"data,omitempty"`
+}
+
+// sessionEventHub fans out session events to the SSE clients of each user
+type sessionEventHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan SessionEvent]struct{} // userID -> subscribers
+}
+
+// subscribe registers a new subscriber for a user
+func (h *sessionEventHub) subscribe(userID string) chan SessionEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers == nil {
+		h.subscribers = make(map[string]map[chan SessionEvent]struct{})
+	}
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan SessionEvent]struct{})
+	}
+	ch := make(chan SessionEvent, 16)
+	h.subscribers[userID][ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe removes a subscriber
+func (h *sessionEventHub) unsubscribe(userID string, ch chan SessionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subscribers[userID], ch)
+	if len(h.subscribers[userID]) == 0 {
+		delete(h.subscribers, userID)
+	}
+}
+
+// publish sends an event to all subscribers of a user without blocking on slow clients
+func (h *sessionEventHub) publish(userID string, event SessionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for ch := range h.subscribers[userID] {
+		select {
+		case ch <- event:
+		default:
+			// Subscriber is not keeping up, drop the event
+		}
+	}
+}
+
+// HandleSessionEvents streams session and folder changes of the current user using SSE
+func (cs *ChatServer) HandleSessionEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	userID := cs.getClientID(r)
+	events := cs.sessionEvents.subscribe(userID)
+	defer cs.sessionEvents.unsubscribe(userID, events)
+
+	fmt.Fprintf(w, "event: start\ndata: {\"type\": \"start\"}\n\n")
+	flusher.Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-cs.shutdown:
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Warning: Failed to encode session event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// HandleListFolders returns the folders of the current user
+func (cs *ChatServer) HandleListFolders(w http.ResponseWriter, r *http.Request) {
+	sm := cs.GetSessionManager(cs.getClientID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sm.ListFolders()); err != nil {
+		log.Printf("Warning: Failed to encode folders response: %v", err)
+	}
+}
+
+// HandleCreateFolder creates a folder for the current user
+func (cs *ChatServer) HandleCreateFolder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID := cs.getClientID(r)
+	folder, err := cs.GetSessionManager(userID).CreateFolder(req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cs.sessionEvents.publish(userID, SessionEvent{Type: "folder_created", FolderID: folder.ID, Data: folder})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(folder); err != nil {
+		log.Printf("Warning: Failed to encode folder response: %v", err)
+	}
+}
+
+// HandleUpdateFolder renames a folder
+func (cs *ChatServer) HandleUpdateFolder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID := cs.getClientID(r)
+	folder, err := cs.GetSessionManager(userID).RenameFolder(r.PathValue("id"), req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), folderErrorStatus(err))
+		return
+	}
+	cs.sessionEvents.publish(userID, SessionEvent{Type: "folder_updated", FolderID: folder.ID, Data: folder})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(folder); err != nil {
+		log.Printf("Warning: Failed to encode folder response: %v", err)
+	}
+}
+
+// HandleDeleteFolder deletes a folder; its sessions are moved to the root
+func (cs *ChatServer) HandleDeleteFolder(w http.ResponseWriter, r *http.Request) {
+	userID := cs.getClientID(r)
+	folderID := r.PathValue("id")
+
+	moved, err := cs.GetSessionManager(userID).DeleteFolder(folderID)
+	for _, sessionID := range moved {
+		cs.sessionEvents.publish(userID, SessionEvent{Type: "session_moved", SessionID: sessionID})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), folderErrorStatus(err))
+		return
+	}
+	cs.sessionEvents.publish(userID, SessionEvent{Type: "folder_deleted", FolderID: folderID})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"status":         "deleted",
+		"moved_sessions": moved,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode folder delete response: %v", err)
+	}
+}
+
+// HandleUpdateSession updates session metadata such as its folder and tags
+func (cs *ChatServer) HandleUpdateSession(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfMaintenance(w) {
+		return
+	}
+
+	var req struct {
+		Title     *string            `json:"title"`     // "" reverts to the title from the first message
+		FolderID  *string            `json:"folder_id"` // "" moves the session to the root
+		Tags      *[]string          `json:"tags"`      // replaces all tags; [] removes them
+		Variables *map[string]string `json:"variables"` // replaces all variables; {} removes them
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	// Reject invalid titles and variables before anything else is changed
+	if req.Title != nil {
+		if _, err := sessionpkg.NormalizeTitle(*req.Title); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Variables != nil {
+		if err := sessionpkg.ValidateVariables(*req.Variables); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	userID := cs.getClientID(r)
+	sm := cs.GetSessionManager(userID)
+	sessionID := r.PathValue("id")
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
+
+	if req.Title != nil {
+		title, err := sm.RenameSession(sessionID, *req.Title)
+		if err != nil {
+			http.Error(w, err.Error(), titleErrorStatus(err))
+			return
+		}
+		cs.sessionEvents.publish(userID, SessionEvent{Type: "session_renamed", SessionID: sessionID, Data: title})
+	}
+
+	if req.FolderID != nil {
+		if err := sm.SetSessionFolder(sessionID, *req.FolderID); err != nil {
+			http.Error(w, err.Error(), folderErrorStatus(err))
+			return
+		}
+		cs.sessionEvents.publish(userID, SessionEvent{Type: "session_moved", SessionID: sessionID, FolderID: *req.FolderID})
+	}
+
+	if req.Tags != nil {
+		tags, err := sm.SetSessionTags(sessionID, *req.Tags)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		cs.sessionEvents.publish(userID, SessionEvent{Type: "session_tagged", SessionID: sessionID, Data: tags})
+	}
+
+	if req.Variables != nil {
+		variables, err := sm.SetSessionVariables(sessionID, *req.Variables)
+		if err != nil {
+			http.Error(w, err.Error(), variableErrorStatus(err))
+			return
+		}
+		cs.sessionEvents.publish(userID, SessionEvent{Type: "session_variables", SessionID: sessionID, Data: variables})
+	}
+
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), sessionLoadStatus(err))
+		return
+	}
+
+	summary := session.Summary()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"id":         summary.ID,
+		"title":      session.DisplayTitle(),
+		"folder_id":  summary.FolderID,
+		"tags":       summary.Tags,
+		"variables":  session.GetVariables(),
+		"updated_at": summary.UpdatedAt,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode session update response: %v", err)
+	}
+}
+
+// titleErrorStatus maps errors of renaming a session to HTTP status codes
+func titleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sessionpkg.ErrInvalidTitle):
+		return http.StatusBadRequest
+	case errors.Is(err, sessionpkg.ErrNotPersisted):
+		return http.StatusInternalServerError
+	default:
+		return sessionLoadStatus(err)
+	}
+}
+
+// folderErrorStatus maps folder errors to HTTP status codes
+func folderErrorStatus(err error) int {
+	if errors.Is(err, sessionpkg.ErrFolderNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// HandleForkSession copies a session up to an optional message_id, or all of
+// it, into a new session and binds an agent to the copy whose context holds
+// the copied conversation, so the fork goes on from there. The source
+// session is left as it is.
+func (cs *ChatServer) HandleForkSession(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfMaintenance(w) {
+		return
+	}
+
+	var req struct {
+		MessageID string `json:"message_id"` // last message to copy; empty for all
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	sessionID := r.PathValue("id")
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
+
+	userID := cs.getClientID(r)
+	sm := cs.GetSessionManager(userID)
+	fork, err := sm.ForkSession(sessionID, req.MessageID)
+	switch {
+	case errors.Is(err, sessionpkg.ErrEmptyFork):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil && fork == nil:
+		http.Error(w, err.Error(), messageErrorStatus(err))
+		return
+	case err != nil:
+		log.Printf("Warning: Failed to save fork of session %s: %v", redact.LogID(sessionID), err)
+	}
+
+	messages, err := sm.GetMessages(fork.ID)
+	if err != nil {
+		http.Error(w, err.Error(), messageErrorStatus(err))
+		return
+	}
+	if agent, err := cs.GetOrCreateAgent(fork.ID); err != nil {
+		log.Printf("Warning: Failed to create agent of fork %s: %v", redact.LogID(fork.ID), err)
+	} else if simpleAgent, ok := agent.(*SimpleChatAgent); ok {
+		simpleAgent.RebuildHistory(messages)
+	}
+	cs.sessionEvents.publish(userID, SessionEvent{Type: "session_forked", SessionID: fork.ID, Data: sessionID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"session_id":    fork.ID,
+		"message_count": len(messages),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode fork response: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	monitoringpkg "github.com/smallnest/langchat/pkg/monitoring"
+)
+
+// Readiness statuses reported by /ready
+const (
+	readyStatus       = "ready"
+	notReadyStatus    = "not ready"
+	maintenanceStatus = "maintenance"
+)
+
+// checkHealth runs the health checks; the server is healthy unless a check
+// failed. results is nil when no health checker is configured.
+func (cs *ChatServer) checkHealth(ctx context.Context) (healthy bool, results map[string]monitoringpkg.HealthStatus) {
+	if cs.healthChecker == nil {
+		return true, nil
+	}
+	results = cs.healthChecker.CheckHealth(ctx)
+	for _, status := range results {
+		if status.Status == "unhealthy" {
+			return false, results
+		}
+	}
+	return true, results
+}
+
+// checkReady returns the readiness status. The server stops receiving traffic
+// while draining for maintenance, while /health stays healthy, and until the
+// LLM endpoint was reachable; otherwise it is ready if at least one health
+// check passes.
+func (cs *ChatServer) checkReady(ctx context.Context) (status, message string) {
+	if enabled, message := cs.maintenance.active(); enabled {
+		return maintenanceStatus, message
+	}
+	if err := cs.llmProbe.Err(); err != nil {
+		return notReadyStatus, err.Error()
+	}
+	if cs.healthChecker == nil {
+		return readyStatus, ""
+	}
+	for _, result := range cs.healthChecker.CheckHealth(ctx) {
+		if result.Status == "healthy" {
+			return readyStatus, ""
+		}
+	}
+	return notReadyStatus, ""
+}
+
+// WaitLLMProbe waits for the first probe of the LLM endpoint and returns why
+// the endpoint was unreachable, or nil when it was reachable or probing is
+// disabled. The server is not ready while it returns an error.
+func (cs *ChatServer) WaitLLMProbe(ctx context.Context) error {
+	return cs.llmProbe.wait(ctx)
+}
+
+// healthProbeHandler serves /health and /ready for load balancers: no
+// authentication, no check details, just the status code and a one-word body
+func (cs *ChatServer) healthProbeHandler() http.Handler {
+	writeProbe := func(w http.ResponseWriter, ok bool, body string) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprintln(w, body)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		if healthy, _ := cs.checkHealth(r.Context()); healthy {
+			writeProbe(w, true, "healthy")
+		} else {
+			writeProbe(w, false, "unhealthy")
+		}
+	})
+	mux.HandleFunc("GET /ready", func(w http.ResponseWriter, r *http.Request) {
+		status, _ := cs.checkReady(r.Context())
+		writeProbe(w, status == readyStatus, status)
+	})
+	return mux
+}
+
+// startHealthServer starts the plain-HTTP health probe server on the
+// configured health port, if any. Binding happens before it returns, so a
+// port conflict fails the startup of the main server.
+func (cs *ChatServer) startHealthServer() error {
+	port := cs.GetConfig().Monitoring.HealthPort
+	if port == 0 {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on health port %d: %w", port, err)
+	}
+	server := &http.Server{
+		Handler:           cs.healthProbeHandler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	cs.healthServerMu.Lock()
+	cs.healthServer = server
+	cs.healthServerMu.Unlock()
+
+	log.Printf("🩺 Health probes listening on http://localhost:%d (/health, /ready)", port)
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Health probe server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// stopHealthServer shuts the health probe server down
+func (cs *ChatServer) stopHealthServer(ctx context.Context) error {
+	cs.healthServerMu.Lock()
+	server := cs.healthServer
+	cs.healthServer = nil
+	cs.healthServerMu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
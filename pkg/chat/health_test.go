@@ -0,0 +1,136 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	monitoringpkg "github.com/smallnest/langchat/pkg/monitoring"
+)
+
+// freePort returns a TCP port that was free a moment ago
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// probe returns the status code and body of a GET request
+func probe(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+// startHealthPort starts the health probe server of cs on a free port and
+// returns its base URL
+func startHealthPort(t *testing.T, cs *ChatServer) string {
+	t.Helper()
+	config := *cs.GetConfig()
+	config.Monitoring.HealthPort = freePort(t)
+	cs.config.Store(&config)
+	if err := cs.startHealthServer(); err != nil {
+		t.Fatalf("startHealthServer: %v", err)
+	}
+	t.Cleanup(func() { _ = cs.stopHealthServer(context.Background()) })
+	return fmt.Sprintf("http://127.0.0.1:%d", config.Monitoring.HealthPort)
+}
+
+func TestHealthPortMatchesMainPort(t *testing.T) {
+	cs := newTestServer(t)
+	cs.healthChecker = monitoringpkg.NewHealthChecker()
+	var failing atomic.Bool
+	cs.healthChecker.RegisterCheck("storage", func(ctx context.Context) error {
+		if failing.Load() {
+			return errors.New("disk full")
+		}
+		return nil
+	})
+
+	mainMux := http.NewServeMux()
+	mainMux.HandleFunc("GET /health", cs.HandleHealth)
+	mainMux.HandleFunc("GET /ready", cs.HandleReady)
+	mainPort := httptest.NewServer(mainMux)
+	defer mainPort.Close()
+	healthPort := startHealthPort(t, cs)
+
+	for _, tc := range []struct {
+		name             string
+		setup            func()
+		health, ready    int
+		healthBody, body string
+	}{
+		{"healthy", func() {}, http.StatusOK, http.StatusOK, "healthy", "ready"},
+		{"failing check", func() { failing.Store(true) }, http.StatusServiceUnavailable, http.StatusServiceUnavailable, "unhealthy", "not ready"},
+		{"maintenance", func() {
+			failing.Store(false)
+			cs.maintenance.enable("upgrading", time.Hour)
+		}, http.StatusOK, http.StatusServiceUnavailable, "healthy", "maintenance"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setup()
+			for _, base := range []string{mainPort.URL, healthPort} {
+				if code, _ := probe(t, base+"/health"); code != tc.health {
+					t.Errorf("%s/health = %d, want %d", base, code, tc.health)
+				}
+				if code, _ := probe(t, base+"/ready"); code != tc.ready {
+					t.Errorf("%s/ready = %d, want %d", base, code, tc.ready)
+				}
+			}
+			// The probe port answers with a minimal body
+			if _, body := probe(t, healthPort+"/health"); strings.TrimSpace(body) != tc.healthBody {
+				t.Errorf("health port /health body = %q, want %q", body, tc.healthBody)
+			}
+			if _, body := probe(t, healthPort+"/ready"); strings.TrimSpace(body) != tc.body {
+				t.Errorf("health port /ready body = %q, want %q", body, tc.body)
+			}
+		})
+	}
+	cs.maintenance.disable()
+
+	// Only the probes are served there
+	if code, _ := probe(t, healthPort+"/api/sessions"); code != http.StatusNotFound {
+		t.Errorf("health port /api/sessions = %d, want 404", code)
+	}
+}
+
+func TestHealthPortStartAndStop(t *testing.T) {
+	cs := newTestServer(t)
+	if err := cs.startHealthServer(); err != nil || cs.healthServer != nil {
+		t.Fatalf("startHealthServer without a health port = %v, server %v", err, cs.healthServer)
+	}
+
+	healthPort := startHealthPort(t, cs)
+	if code, _ := probe(t, healthPort+"/health"); code != http.StatusOK {
+		t.Fatalf("/health = %d before stopping", code)
+	}
+
+	// A second server cannot bind the same port, which fails the startup
+	if err := cs.startHealthServer(); err == nil {
+		t.Fatal("startHealthServer bound a port in use")
+	}
+
+	if err := cs.stopHealthServer(context.Background()); err != nil {
+		t.Fatalf("stopHealthServer: %v", err)
+	}
+	if _, err := http.Get(healthPort + "/health"); err == nil {
+		t.Fatal("health port still answers after stopping")
+	}
+}
@@ -0,0 +1,340 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// historySchemaVersion is the version of the history envelope. Bump it when
+// fields of the envelope or its messages change meaning.
+const historySchemaVersion = 2
+
+// History page sizes
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 500
+)
+
+// Message statuses of the history envelope
+const (
+	MessageStatusComplete  = "complete"
+	MessageStatusTruncated = "truncated" // see Message.Truncated for the reason
+	MessageStatusRefused   = "refused"   // see Message.Refusal for the reason
+)
+
+// historySettings are the per-session settings of the history envelope
+type historySettings struct {
+	FolderID  string            `json:"folder_id,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	Persona   string            `json:"persona,omitempty"`
+	Archived  bool              `json:"archived"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// historySession describes the session of the history envelope
+type historySession struct {
+	ID       string          `json:"id"`
+	Title    string          `json:"title"`
+	Settings historySettings `json:"settings"`
+}
+
+// historyMessage is a stored message with the fields derived for clients
+type historyMessage struct {
+	sessionpkg.Message
+	Status string `json:"status"`
+}
+
+// historyResponse is a page of the history, newest messages first, with each
+// page in chronological order. NextCursor is empty on the oldest page.
+// LastSeq is the sequence number of the session's last message, so clients
+// can tell whether they have missed any.
+type historyResponse struct {
+	SchemaVersion int              `json:"schema_version"`
+	Session       historySession   `json:"session"`
+	Messages      []historyMessage `json:"messages"`
+	NextCursor    string           `json:"next_cursor"`
+	LastSeq       uint64           `json:"last_seq"`
+}
+
+// HandleGetHistory retrieves chat history for a session. It returns the
+// newest limit messages; pass next_cursor as cursor to get the page before.
+// since_seq returns the oldest limit messages after that sequence number
+// instead, for clients catching up on missed events; they fetch again while
+// the last message is before last_seq. format=legacy returns the bare message
+// array of schema version 1. Each page has its own ETag, and conditional
+// requests get 304 Not Modified.
+func (cs *ChatServer) HandleGetHistory(w http.ResponseWriter, r *http.Request) {
+	userID := cs.getClientID(r)
+	sm := cs.GetSessionManager(userID)
+
+	sessionID := r.PathValue("id")
+	if sessionID == "" {
+		http.Error(w, "Session ID required", http.StatusBadRequest)
+		return
+	}
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
+
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), sessionLoadStatus(err))
+		return
+	}
+	// Read before the messages, so a concurrent change gets a new tag
+	version := session.Version()
+	messages, lastSeq, err := sm.GetMessagesSince(sessionID, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "legacy" {
+		if checkNotModified(w, r, userID, version) {
+			return
+		}
+		cs.writeLegacyHistory(w, messages)
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxHistoryLimit)
+	}
+
+	cursor, sinceSeq := r.URL.Query().Get("cursor"), r.URL.Query().Get("since_seq")
+	if cursor != "" && sinceSeq != "" {
+		http.Error(w, "cursor and since_seq cannot be combined", http.StatusBadRequest)
+		return
+	}
+	start, end := 0, len(messages)
+	switch {
+	case sinceSeq != "":
+		seq, err := strconv.ParseUint(sinceSeq, 10, 64)
+		if err != nil {
+			http.Error(w, "since_seq must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		start = sort.Search(len(messages), func(i int) bool { return messages[i].Seq > seq })
+		end = min(start+limit, len(messages))
+	case cursor != "":
+		end = slices.IndexFunc(messages, func(m sessionpkg.Message) bool { return m.ID == cursor })
+		if end < 0 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		fallthrough
+	default:
+		start = max(end-limit, 0)
+	}
+
+	if checkNotModified(w, r, userID, version) {
+		return
+	}
+
+	summary := session.Summary()
+	response := historyResponse{
+		SchemaVersion: historySchemaVersion,
+		Session: historySession{
+			ID:    sessionID,
+			Title: session.DisplayTitle(),
+			Settings: historySettings{
+				FolderID:  summary.FolderID,
+				Tags:      summary.Tags,
+				Persona:   session.GetPersona(),
+				Archived:  summary.Archived,
+				Variables: session.GetVariables(),
+			},
+		},
+		Messages: make([]historyMessage, 0, end-start),
+		LastSeq:  lastSeq,
+	}
+	defaults := sessionpkg.DefaultSettings(response.Session.Settings.Persona)
+	for _, msg := range messages[start:end] {
+		if msg.Role == "user" && msg.Settings == nil {
+			msg.Settings = &defaults
+		}
+		status := MessageStatusComplete
+		switch {
+		case msg.Truncated != "":
+			status = MessageStatusTruncated
+		case msg.Refusal != "":
+			status = MessageStatusRefused
+		}
+		response.Messages = append(response.Messages, historyMessage{Message: msg, Status: status})
+	}
+	if start > 0 && sinceSeq == "" {
+		response.NextCursor = messages[start].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Warning: Failed to encode session history response: %v", err)
+	}
+}
+
+// writeLegacyHistory writes all messages in the bare array shape of schema
+// version 1, without the fields added by later versions. It is kept for one
+// release so clients can migrate.
+func (cs *ChatServer) writeLegacyHistory(w http.ResponseWriter, messages []sessionpkg.Message) {
+	for i := range messages {
+		messages[i].Seq = 0
+		messages[i].ToolCalls = nil
+		messages[i].Usage = nil
+		messages[i].Decisions = nil
+		messages[i].Settings = nil
+		messages[i].Refusal = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Deprecation", "true")
+	if err := json.NewEncoder(w).Encode(messages); err != nil {
+		log.Printf("Warning: Failed to encode session messages response: %v", err)
+	}
+}
+
+// sessionToolCalls summarizes the tool calls of a turn for the stored message
+func sessionToolCalls(records []ToolCallRecord) []sessionpkg.ToolCall {
+	if len(records) == 0 {
+		return nil
+	}
+	calls := make([]sessionpkg.ToolCall, len(records))
+	for i, record := range records {
+		calls[i] = sessionpkg.ToolCall{
+			Tool:       record.Tool,
+			Source:     record.Source,
+			Error:      record.Error,
+			DryRun:     record.DryRun,
+			Attempts:   record.Attempts,
+			DurationMs: record.Duration.Milliseconds(),
+		}
+	}
+	return calls
+}
+
+// sessionUsage returns the provider-reported usage of a turn, or nil when the
+// provider reported none
+func sessionUsage(result *StreamResult) *sessionpkg.Usage {
+	if result == nil || result.Usage.PromptTokens+result.Usage.CompletionTokens == 0 {
+		return nil
+	}
+	return &sessionpkg.Usage{
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		CachedTokens:     result.Usage.CachedTokens,
+	}
+}
+
+// HandleDeleteMessage removes a message from a session of the current user,
+// e.g. one with a pasted secret, and from the context of the session's agent
+func (cs *ChatServer) HandleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfMaintenance(w) {
+		return
+	}
+
+	userID := cs.getClientID(r)
+	sm := cs.GetSessionManager(userID)
+	sessionID, messageID := r.PathValue("id"), r.PathValue("messageID")
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
+
+	// The messages before the deletion locate the message in the agent's context
+	messages, err := sm.GetMessages(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), messageErrorStatus(err))
+		return
+	}
+	if err := sm.DeleteMessage(sessionID, messageID); err != nil {
+		log.Printf("Failed to delete message of session %s: %v", redact.LogID(sessionID), err)
+		http.Error(w, err.Error(), messageErrorStatus(err))
+		return
+	}
+
+	cs.agentMu.RLock()
+	agent := cs.agents[sessionID]
+	cs.agentMu.RUnlock()
+	if simpleAgent, ok := agent.(*SimpleChatAgent); ok {
+		simpleAgent.ForgetMessage(messages, messageID)
+	}
+	cs.sessionEvents.publish(userID, SessionEvent{Type: "message_deleted", SessionID: sessionID, Data: messageID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgetMessage removes the message with messageID among the messages of
+// the session from the context of the agent, so the model no longer sees it.
+// The context holds the latest non-synthetic messages of the session in
+// order, so the message is found by its position from the end; its role and
+// content must match there, so duplicates never remove another entry.
+// Removing a user message also removes the tool results that followed it. It
+// reports whether the message was found; messages of earlier agents of the
+// session are not.
+func (a *SimpleChatAgent) ForgetMessage(messages []sessionpkg.Message, messageID string) bool {
+	i := slices.IndexFunc(messages, func(m sessionpkg.Message) bool { return m.ID == messageID })
+	if i < 0 || messages[i].Synthetic {
+		return false
+	}
+	var msgRole llms.ChatMessageType
+	switch messages[i].Role {
+	case "user":
+		msgRole = llms.ChatMessageTypeHuman
+	case "assistant":
+		msgRole = llms.ChatMessageTypeAI
+	default:
+		return false
+	}
+	later := 0
+	for _, msg := range messages[i+1:] {
+		if !msg.Synthetic {
+			later++
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// System messages are the prompt, memories and tool results, which the
+	// session does not store
+	j := len(a.messages) - 1
+	for ; j >= 0; j-- {
+		if a.messages[j].Role == llms.ChatMessageTypeSystem {
+			continue
+		}
+		if later == 0 {
+			break
+		}
+		later--
+	}
+	if j < 0 {
+		return false
+	}
+	msg := a.messages[j]
+	if msg.Role != msgRole || len(msg.Parts) != 1 {
+		return false
+	}
+	if text, ok := msg.Parts[0].(llms.TextContent); !ok || text.Text != messages[i].Content {
+		return false
+	}
+	end := j + 1
+	if msgRole == llms.ChatMessageTypeHuman {
+		for end < len(a.messages) && a.messages[end].Role == llms.ChatMessageTypeSystem {
+			end++
+		}
+	}
+	a.messages = slices.Delete(a.messages, j, end)
+	return true
+}
@@ -0,0 +1,268 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+func textMessage(role llms.ChatMessageType, text string) llms.MessageContent {
+	return llms.MessageContent{Role: role, Parts: []llms.ContentPart{llms.TextPart(text)}}
+}
+
+// contextTexts returns the role and text of each message in the agent's context
+func contextTexts(a *SimpleChatAgent) []string {
+	var texts []string
+	for _, msg := range a.messages {
+		texts = append(texts, string(msg.Role)+": "+msg.Parts[0].(llms.TextContent).Text)
+	}
+	return texts
+}
+
+func TestForgetMessageWithDuplicateContents(t *testing.T) {
+	session := []sessionpkg.Message{
+		{ID: "m1", Role: "user", Content: "yes"},
+		{ID: "m2", Role: "assistant", Content: "ok"},
+		{ID: "m3", Role: "assistant", Content: "Synthetic notice", Synthetic: true},
+		{ID: "m4", Role: "user", Content: "yes"},
+		{ID: "m5", Role: "assistant", Content: "ok"},
+	}
+	newAgent := func() *SimpleChatAgent {
+		return &SimpleChatAgent{messages: []llms.MessageContent{
+			textMessage(llms.ChatMessageTypeSystem, "prompt"),
+			textMessage(llms.ChatMessageTypeHuman, "yes"),
+			textMessage(llms.ChatMessageTypeSystem, "tool result"),
+			textMessage(llms.ChatMessageTypeAI, "ok"),
+			textMessage(llms.ChatMessageTypeHuman, "yes"),
+			textMessage(llms.ChatMessageTypeAI, "ok"),
+		}}
+	}
+
+	for _, tc := range []struct {
+		messageID string
+		want      []string
+	}{
+		{"m1", []string{"system: prompt", "ai: ok", "human: yes", "ai: ok"}},
+		{"m2", []string{"system: prompt", "human: yes", "system: tool result", "human: yes", "ai: ok"}},
+		{"m4", []string{"system: prompt", "human: yes", "system: tool result", "ai: ok", "ai: ok"}},
+		{"m5", []string{"system: prompt", "human: yes", "system: tool result", "ai: ok", "human: yes"}},
+	} {
+		agent := newAgent()
+		if !agent.ForgetMessage(session, tc.messageID) {
+			t.Fatalf("ForgetMessage(%s) did not find the message", tc.messageID)
+		}
+		if got := contextTexts(agent); !slices.Equal(got, tc.want) {
+			t.Errorf("ForgetMessage(%s) left %q, want %q", tc.messageID, got, tc.want)
+		}
+	}
+
+	agent := newAgent()
+	for _, id := range []string{"m3", "unknown"} {
+		if agent.ForgetMessage(session, id) {
+			t.Errorf("ForgetMessage(%s) reported a removal", id)
+		}
+	}
+	if got := contextTexts(agent); len(got) != 6 {
+		t.Errorf("context changed to %q", got)
+	}
+}
+
+func TestForgetMessageOutsideTheContext(t *testing.T) {
+	session := []sessionpkg.Message{
+		{ID: "m1", Role: "user", Content: "yes"},
+		{ID: "m2", Role: "assistant", Content: "ok"},
+		{ID: "m3", Role: "user", Content: "yes"},
+		{ID: "m4", Role: "assistant", Content: "ok"},
+	}
+	// An agent created after the first turn only holds the second one
+	agent := &SimpleChatAgent{messages: []llms.MessageContent{
+		textMessage(llms.ChatMessageTypeSystem, "prompt"),
+		textMessage(llms.ChatMessageTypeHuman, "yes"),
+		textMessage(llms.ChatMessageTypeAI, "ok"),
+	}}
+	if agent.ForgetMessage(session, "m1") {
+		t.Error("ForgetMessage removed a message of an earlier agent")
+	}
+
+	// A turn in progress added a message the session does not hold yet
+	agent.messages = append(agent.messages, textMessage(llms.ChatMessageTypeHuman, "next"))
+	if agent.ForgetMessage(session, "m4") {
+		t.Error("ForgetMessage removed a message at a shifted position")
+	}
+	if got := contextTexts(agent); len(got) != 4 {
+		t.Errorf("context changed to %q", got)
+	}
+}
+
+// seedHistory seeds a session with a user question and a truncated answer
+// with tool calls and usage, followed by user messages numbered 1 to n
+func seedHistory(t *testing.T, sm *sessionpkg.SessionManager, n int) (string, []string) {
+	t.Helper()
+	sessionID := sm.CreateSession().ID
+	var ids []string
+	for _, msg := range []sessionpkg.Message{
+		{Role: "user", Content: "What is the weather?"},
+		{
+			Role: "assistant", Content: "It is sunny", Truncated: "max_tokens",
+			ToolCalls: []sessionpkg.ToolCall{{Tool: "weather", Source: "skill", Attempts: 1, DurationMs: 12}},
+			Usage:     &sessionpkg.Usage{PromptTokens: 10, CompletionTokens: 3},
+		},
+	} {
+		id, err := sm.AppendMessage(sessionID, msg)
+		if err != nil {
+			t.Fatalf("AppendMessage: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	for i := range n {
+		id, err := sm.AddMessage(sessionID, "user", fmt.Sprint(i+1))
+		if err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return sessionID, ids
+}
+
+// getHistory serves a history request for a session and decodes its JSON body into v
+func getHistory(t *testing.T, cs *ChatServer, sessionID, query string, v any) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/api/sessions/"+sessionID+"/history"+query, nil)
+	r.SetPathValue("id", sessionID)
+	w := httptest.NewRecorder()
+	cs.HandleGetHistory(w, r)
+	if v != nil && w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("decode history %s: %v", w.Body, err)
+		}
+	}
+	return w
+}
+
+func TestHistoryEnvelope(t *testing.T) {
+	cs := newTestServer(t)
+	_, sm := testRequest(cs, http.MethodGet, "/")
+	sessionID, ids := seedHistory(t, sm, 0)
+
+	var raw map[string]json.RawMessage
+	getHistory(t, cs, sessionID, "", &raw)
+	for _, key := range []string{"schema_version", "session", "messages", "next_cursor", "last_seq"} {
+		if _, ok := raw[key]; !ok {
+			t.Errorf("envelope has no %s: %s", key, raw)
+		}
+	}
+
+	var history historyResponse
+	getHistory(t, cs, sessionID, "", &history)
+	if history.SchemaVersion != historySchemaVersion || history.Session.ID != sessionID || history.NextCursor != "" || history.LastSeq != 2 {
+		t.Fatalf("envelope = version %d, session %q, cursor %q, last seq %d",
+			history.SchemaVersion, history.Session.ID, history.NextCursor, history.LastSeq)
+	}
+	if len(history.Messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(history.Messages))
+	}
+	question, answer := history.Messages[0], history.Messages[1]
+	if question.ID != ids[0] || question.Seq != 1 || question.Status != MessageStatusComplete || question.Settings == nil {
+		t.Errorf("question = %+v, want seq 1, complete and the default settings", question)
+	}
+	if answer.Status != MessageStatusTruncated || len(answer.ToolCalls) != 1 || answer.Usage == nil || answer.Usage.PromptTokens != 10 {
+		t.Errorf("answer = %+v, want truncated with its tool call and usage", answer)
+	}
+}
+
+func TestHistoryPagination(t *testing.T) {
+	cs := newTestServer(t)
+	_, sm := testRequest(cs, http.MethodGet, "/")
+	sessionID, ids := seedHistory(t, sm, 3)
+
+	var pages [][]string
+	cursor := ""
+	for range len(ids) {
+		query := "?limit=2"
+		if cursor != "" {
+			query += "&cursor=" + cursor
+		}
+		var history historyResponse
+		if w := getHistory(t, cs, sessionID, query, &history); w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d", query, w.Code)
+		}
+		var page []string
+		for _, msg := range history.Messages {
+			page = append(page, msg.ID)
+		}
+		pages = append(pages, page)
+		if cursor = history.NextCursor; cursor == "" {
+			break
+		}
+	}
+	want := [][]string{ids[3:5], ids[1:3], ids[0:1]}
+	if !slices.EqualFunc(pages, want, slices.Equal) {
+		t.Fatalf("pages = %v, want %v", pages, want)
+	}
+
+	var since historyResponse
+	getHistory(t, cs, sessionID, "?since_seq=2&limit=2", &since)
+	if len(since.Messages) != 2 || since.Messages[0].ID != ids[2] || since.NextCursor != "" || since.LastSeq != 5 {
+		t.Fatalf("since_seq page = %+v", since)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=x", "?cursor=unknown", "?since_seq=-1", "?cursor=" + ids[1] + "&since_seq=1"} {
+		if w := getHistory(t, cs, sessionID, query, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestHistoryLegacyFormat(t *testing.T) {
+	cs := newTestServer(t)
+	_, sm := testRequest(cs, http.MethodGet, "/")
+	sessionID, ids := seedHistory(t, sm, 0)
+
+	var messages []map[string]any
+	w := getHistory(t, cs, sessionID, "?format=legacy&limit=1", &messages)
+	if w.Header().Get("Deprecation") != "true" {
+		t.Error("legacy shape is not marked deprecated")
+	}
+	if len(messages) != 2 || messages[0]["id"] != ids[0] || messages[1]["truncated"] != "max_tokens" {
+		t.Fatalf("legacy messages = %v, want both messages", messages)
+	}
+	for _, msg := range messages {
+		for _, key := range []string{"seq", "tool_calls", "usage", "settings", "status"} {
+			if _, ok := msg[key]; ok {
+				t.Errorf("legacy message has %s: %v", key, msg)
+			}
+		}
+	}
+}
+
+func TestHistoryNotModified(t *testing.T) {
+	cs := newTestServer(t)
+	_, sm := testRequest(cs, http.MethodGet, "/")
+	sessionID, _ := seedHistory(t, sm, 0)
+
+	etag := getHistory(t, cs, sessionID, "", nil).Header().Get("ETag")
+	r := httptest.NewRequest(http.MethodGet, "/api/sessions/"+sessionID+"/history", nil)
+	r.SetPathValue("id", sessionID)
+	r.Header.Set("If-None-Match", etag)
+	w := httptest.NewRecorder()
+	cs.HandleGetHistory(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("conditional request = %d, want 304", w.Code)
+	}
+
+	if _, err := sm.AddMessage(sessionID, "user", "new"); err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+	w = httptest.NewRecorder()
+	cs.HandleGetHistory(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("conditional request after a change = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/smallnest/langchat/pkg/audit"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// HandleImportSessions adds the sessions of a JSON payload to the sessions
+// of the current user: a session, an array of sessions, or the message array
+// of a JSON export. The sessions are saved under new IDs, which are returned
+// in the order of the payload.
+func (cs *ChatServer) HandleImportSessions(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfMaintenance(w) {
+		return
+	}
+
+	maxBytes := cs.GetConfig().Database.ImportMaxBytes
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Import is larger than "+strconv.FormatInt(maxBytes, 10)+" bytes", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := sessionpkg.ParseImport(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID := cs.getClientID(r)
+	ids, err := cs.GetSessionManager(userID).ImportSessions(sessions)
+	if err != nil && len(ids) == 0 {
+		http.Error(w, err.Error(), importErrorStatus(err))
+		return
+	}
+	if err != nil {
+		log.Printf("Warning: Imported sessions of user %s were not all persisted: %v", userID, err)
+	}
+
+	cs.auditLogger.Log(audit.Event{
+		Action:  "sessions.import",
+		Actor:   userID,
+		Result:  "success",
+		Details: map[string]any{"session_ids": ids},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"session_ids": ids,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode session import response: %v", err)
+	}
+}
+
+// importErrorStatus maps errors of importing sessions to HTTP status codes
+func importErrorStatus(err error) int {
+	if errors.Is(err, sessionpkg.ErrInvalidImport) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/audit"
+	"github.com/smallnest/langchat/pkg/auth"
+)
+
+// HandleCreateInvite creates a single-use invite code for registering while
+// registration is by invite, with optional roles of the new account and expiry
+func (cs *ChatServer) HandleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Roles            []string `json:"roles"`              // default: the user role
+		ExpiresInSeconds int      `json:"expires_in_seconds"` // default: never expires
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInSeconds < 0 {
+		http.Error(w, "expires_in_seconds cannot be negative", http.StatusBadRequest)
+		return
+	}
+	for _, role := range req.Roles {
+		if role == "" {
+			http.Error(w, "roles cannot be empty strings", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresInSeconds > 0 {
+		expiresAt = time.Now().Add(time.Duration(req.ExpiresInSeconds) * time.Second)
+	}
+
+	actor := cs.getClientID(r)
+	invite, err := cs.authService.CreateInvite(actor, req.Roles, expiresAt)
+	if err != nil {
+		cs.auditLogger.Log(audit.Event{Action: "invite.create", Actor: actor, Result: "failure"})
+		log.Printf("Failed to create invite: %v", err)
+		http.Error(w, "Failed to create invite", http.StatusInternalServerError)
+		return
+	}
+	cs.auditLogger.Log(audit.Event{
+		Action:   "invite.create",
+		Actor:    actor,
+		Resource: auth.InviteID(invite.Code),
+		Result:   "success",
+		Details:  map[string]any{"roles": invite.Roles, "expires_at": invite.ExpiresAt},
+	})
+	if mode := cs.authService.RegistrationMode(); mode != auth.RegistrationInvite {
+		log.Printf("Warning: Invite created while registration mode is %s; it can only be redeemed in invite mode", mode)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(invite); err != nil {
+		log.Printf("Warning: Failed to encode invite: %v", err)
+	}
+}
+
+// HandleListInvites returns all invite codes, newest first, with whether and
+// by whom they were redeemed
+func (cs *ChatServer) HandleListInvites(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"registration_mode": cs.authService.RegistrationMode(),
+		"invites":           cs.authService.Invites(),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode invite list: %v", err)
+	}
+}
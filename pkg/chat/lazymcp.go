@@ -0,0 +1,324 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	mcpclient "github.com/smallnest/goskills/mcp"
+	"github.com/tmc/langchaingo/tools"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// errMCPServerLimit is returned by a lazy MCP tool when its server cannot be
+// started because the maximum number of servers is busy answering calls
+var errMCPServerLimit = errors.New("too many MCP servers running, try again later")
+
+// mcpToolManifest describes a tool of an MCP server in the MCP config, so
+// the tool can be selected before the server is running:
+//
+//	"github": {"command": "...", "tools": [{"name": "search_issues", "description": "...", "parameters": {...}}]}
+type mcpToolManifest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Parameters  any    `json:"parameters"` // JSON schema of the arguments
+}
+
+// lazyMCPTool is a tool of an MCP server that is started when one of its
+// tools is first called. Its name and description come from the manifest.
+type lazyMCPTool struct {
+	agent       *SimpleChatAgent
+	server      string
+	config      mcpclient.MCPServer
+	maxRetries  int
+	name        string // serverName__toolName, as named by the MCP client
+	description string
+	cached      bool // from the manifest cache of a server that was not reached; unverified
+}
+
+var _ tools.Tool = (*lazyMCPTool)(nil)
+
+func (t *lazyMCPTool) Name() string {
+	return t.name
+}
+
+func (t *lazyMCPTool) Description() string {
+	return t.description
+}
+
+// Call starts the tool's server if it is not running and calls the tool. A
+// cached tool of a server that just failed to connect fails fast.
+func (t *lazyMCPTool) Call(ctx context.Context, input string) (string, error) {
+	var args map[string]any
+	if input != "" {
+		if err := json.Unmarshal([]byte(input), &args); err != nil {
+			return "", fmt.Errorf("failed to unmarshal MCP tool arguments: %w", err)
+		}
+	}
+
+	manifests := t.agent.mcpServers.manifestCache()
+	if t.cached && !manifests.available(t.server) {
+		return "", fmt.Errorf("%w: %s could not be reached, try again later", errMCPServerUnavailable, t.server)
+	}
+	client, release, err := t.agent.mcpServers.acquire(ctx, t)
+	if err != nil {
+		if t.cached && !errors.Is(err, errMCPServerLimit) && ctx.Err() == nil {
+			manifests.failed(t.server)
+			return "", fmt.Errorf("%w: %s: %v", errMCPServerUnavailable, t.server, err)
+		}
+		return "", fmt.Errorf("failed to start MCP server %s: %w", t.server, err)
+	}
+	defer release()
+
+	result, err := client.CallTool(ctx, t.name, args)
+	if err != nil {
+		return "", fmt.Errorf("failed to call MCP tool %s: %w", t.name, err)
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal MCP tool result: %w", err)
+	}
+	return string(resultJSON), nil
+}
+
+// lazyMCPTools returns the tools of an MCP server from its manifest, with
+// their parameter schemas; cached tells the manifest came from the cache
+func (a *SimpleChatAgent) lazyMCPTools(server string, config mcpclient.MCPServer, maxRetries int, manifest []mcpToolManifest, cached bool) ([]tools.Tool, map[string]any) {
+	lazyTools := make([]tools.Tool, 0, len(manifest))
+	schemas := make(map[string]any, len(manifest))
+	for _, m := range manifest {
+		name := server + "__" + m.Name
+		lazyTools = append(lazyTools, &lazyMCPTool{
+			agent:       a,
+			server:      server,
+			config:      config,
+			maxRetries:  maxRetries,
+			name:        name,
+			description: m.Description,
+			cached:      cached,
+		})
+		if m.Parameters != nil {
+			schemas[name] = m.Parameters
+		}
+	}
+	return lazyTools, schemas
+}
+
+// startLazyMCP starts the server of a lazy MCP tool, in the session sandbox
+// if enabled, and checks that it serves tools
+func (a *SimpleChatAgent) startLazyMCP(ctx context.Context, t *lazyMCPTool) (*mcpclient.Client, error) {
+	config := &mcpclient.Config{
+		MCPServers: map[string]mcpclient.MCPServer{t.server: t.config},
+		MaxRetries: t.maxRetries,
+	}
+
+	a.mu.RLock()
+	sb, sessionID := a.sandbox, a.sessionID
+	a.mu.RUnlock()
+	if sb.Enabled() && sessionID != "" {
+		if err := sb.ApplyMCP(sessionID, config); err != nil {
+			return nil, fmt.Errorf("failed to apply sandbox to MCP config: %w", err)
+		}
+	}
+
+	client, err := mcpclient.NewClient(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MCP client: %w", err)
+	}
+	// The client only logs servers it could not connect to
+	defs, err := client.GetTools(ctx)
+	if err == nil && len(defs) == 0 {
+		err = errors.New("server did not start or has no tools")
+	}
+	if err != nil {
+		if closeErr := a.closeMCPClient(client); closeErr != nil {
+			log.Printf("Failed to close MCP client after error: %v", closeErr)
+		}
+		return nil, err
+	}
+	log.Printf("Started MCP server %s for session %s", t.server, redact.LogID(sessionID))
+	return client, nil
+}
+
+// mcpServerPool runs the lazily started MCP servers of all agents. A started
+// server is kept for later calls of the agent until the agent is closed or,
+// when the maximum number of servers is running, the least recently used
+// idle server is stopped to start another.
+type mcpServerPool struct {
+	lazy      bool
+	timeout   time.Duration
+	max       int // 0 for no limit
+	manifests *mcpManifestCache
+
+	mu      sync.Mutex
+	servers map[lazyMCPKey]*lazyMCPServer
+}
+
+// lazyMCPKey identifies a lazily started server of an agent
+type lazyMCPKey struct {
+	agent  *SimpleChatAgent
+	server string
+}
+
+// lazyMCPServer is a lazily started server, or one being started
+type lazyMCPServer struct {
+	ready    chan struct{} // closed once started, or failed to
+	client   *mcpclient.Client
+	err      error
+	calls    int // calls in progress or waiting for the start
+	lastUsed time.Time
+}
+
+// newMCPServerPool creates the pool of lazily started MCP servers
+func newMCPServerPool(config configpkg.MCPConfig) *mcpServerPool {
+	return &mcpServerPool{
+		lazy:      config.Lazy,
+		timeout:   config.StartupTimeout,
+		max:       config.MaxServers,
+		manifests: loadMCPManifestCache(config.ManifestCache),
+		servers:   make(map[lazyMCPKey]*lazyMCPServer),
+	}
+}
+
+// manifestCache returns the cache of the tool manifests of reached servers; p may be nil
+func (p *mcpServerPool) manifestCache() *mcpManifestCache {
+	if p == nil {
+		return nil
+	}
+	return p.manifests
+}
+
+// enabled reports whether servers with a tool manifest are started lazily; p may be nil
+func (p *mcpServerPool) enabled() bool {
+	return p != nil && p.lazy
+}
+
+// acquire returns the client of the running server of a lazy tool, starting
+// the server if needed. The returned function must be called once the call
+// of the tool is done.
+func (p *mcpServerPool) acquire(ctx context.Context, t *lazyMCPTool) (*mcpclient.Client, func(), error) {
+	key := lazyMCPKey{agent: t.agent, server: t.server}
+
+	p.mu.Lock()
+	server, ok := p.servers[key]
+	if !ok {
+		if p.max > 0 && len(p.servers) >= p.max && !p.evictLocked() {
+			p.mu.Unlock()
+			return nil, nil, errMCPServerLimit
+		}
+		server = &lazyMCPServer{ready: make(chan struct{})}
+		p.servers[key] = server
+		go p.start(key, server, t)
+	}
+	server.calls++
+	p.mu.Unlock()
+
+	release := func() {
+		p.mu.Lock()
+		server.calls--
+		server.lastUsed = time.Now()
+		p.mu.Unlock()
+	}
+
+	select {
+	case <-server.ready:
+	case <-ctx.Done():
+		release()
+		return nil, nil, ctx.Err()
+	}
+	if server.err != nil {
+		release()
+		return nil, nil, server.err
+	}
+	return server.client, release, nil
+}
+
+// start starts a lazily started server. The start is not bound to the call
+// that triggered it, so a canceled call does not waste a slow npx download.
+func (p *mcpServerPool) start(key lazyMCPKey, server *lazyMCPServer, t *lazyMCPTool) {
+	var client *mcpclient.Client
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic during MCP server start: %v", r)
+			log.Printf("Recovered from MCP server start panic: %v", r)
+		}
+		p.mu.Lock()
+		server.client, server.err = client, err
+		if err != nil && p.servers[key] == server {
+			// The next call tries again
+			delete(p.servers, key)
+		}
+		p.mu.Unlock()
+		close(server.ready)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	client, err = key.agent.startLazyMCP(ctx, t)
+	if err != nil {
+		log.Printf("Lazy MCP server %s failed to start: %v", t.server, err)
+	}
+}
+
+// evictLocked stops the least recently used running server without calls in
+// progress and reports whether there was one. The caller must hold p.mu.
+func (p *mcpServerPool) evictLocked() bool {
+	var oldestKey lazyMCPKey
+	var oldest *lazyMCPServer
+	for key, server := range p.servers {
+		if server.calls > 0 || server.client == nil {
+			continue
+		}
+		if oldest == nil || server.lastUsed.Before(oldest.lastUsed) {
+			oldestKey, oldest = key, server
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	delete(p.servers, oldestKey)
+	log.Printf("Stopping idle MCP server %s to start another", oldestKey.server)
+	go func() {
+		if err := oldestKey.agent.closeMCPClient(oldest.client); err != nil {
+			log.Printf("Failed to close MCP client: %v", err)
+		}
+	}()
+	return true
+}
+
+// closeAgent stops the lazily started servers of an agent; p may be nil
+func (p *mcpServerPool) closeAgent(agent *SimpleChatAgent) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	var servers []*lazyMCPServer
+	for key, server := range p.servers {
+		if key.agent == agent {
+			servers = append(servers, server)
+			delete(p.servers, key)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, server := range servers {
+		go func() {
+			// A server still starting is closed once it is up
+			<-server.ready
+			if server.client == nil {
+				return
+			}
+			if err := agent.closeMCPClient(server.client); err != nil {
+				log.Printf("Failed to close MCP client: %v", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,82 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/smallnest/langchat/pkg/breaker"
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	monitoringpkg "github.com/smallnest/langchat/pkg/monitoring"
+)
+
+// ErrLLMUnavailable is returned without calling the provider while its
+// circuit breaker is open
+var ErrLLMUnavailable = errors.New("llm_unavailable: the LLM provider is unavailable, try again later")
+
+// breakerModel guards an LLM with a circuit breaker. It is shared by every
+// agent using the provider instance, so one outage is detected once.
+type breakerModel struct {
+	llms.Model
+	breaker *breaker.Breaker
+}
+
+// newBreakerModel wraps llm with a circuit breaker that reports its state
+// transitions to the logs and metrics under name, the provider label
+func newBreakerModel(llm llms.Model, name string, config configpkg.LLMConfig, metrics *monitoringpkg.MetricsCollector) *breakerModel {
+	onStateChange := func(from, to breaker.State) {
+		log.Printf("⚡ LLM circuit breaker for %s: %s → %s", name, from, to)
+		metrics.RecordLLMBreakerTransition(name, from.String(), to.String(), int(to))
+	}
+	return &breakerModel{
+		Model:   llm,
+		breaker: breaker.New(config.Breaker, onStateChange),
+	}
+}
+
+// GenerateContent calls the provider unless the breaker is open
+func (m *breakerModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	done, err := m.breaker.Allow()
+	if err != nil {
+		return nil, ErrLLMUnavailable
+	}
+	response, err := m.Model.GenerateContent(ctx, messages, options...)
+	done(err)
+	return response, err
+}
+
+// Call implements the deprecated single-prompt API on top of GenerateContent,
+// so it goes through the breaker as well
+func (m *breakerModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// rejectIfLLMUnavailable fails a chat request fast with 503 while the LLM
+// circuit breaker is open, before anything is saved to the session
+func (cs *ChatServer) rejectIfLLMUnavailable(w http.ResponseWriter) bool {
+	if cs.llmBreaker == nil || cs.llmBreaker.State() != breaker.StateOpen {
+		return false
+	}
+	if retryAfter := cs.llmBreaker.RetryAfter(); retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	http.Error(w, ErrLLMUnavailable.Error(), http.StatusServiceUnavailable)
+	return true
+}
+
+// llmBreakerCheck returns a health check that fails while the breaker is open
+func llmBreakerCheck(b *breaker.Breaker) monitoringpkg.HealthCheck {
+	return func(ctx context.Context) error {
+		if state := b.State(); state == breaker.StateOpen {
+			return fmt.Errorf("LLM circuit breaker is %s, retrying in %s", state, b.RetryAfter().Round(time.Second))
+		}
+		return nil
+	}
+}
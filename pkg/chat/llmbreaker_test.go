@@ -0,0 +1,98 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/smallnest/langchat/pkg/breaker"
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+var errProviderDown = errors.New("provider is down")
+
+// stubLLM answers every call with answer, or fails with errProviderDown while down
+type stubLLM struct {
+	answer string
+	down   atomic.Bool
+	calls  atomic.Int32
+}
+
+func (m *stubLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.calls.Add(1)
+	if m.down.Load() {
+		return nil, errProviderDown
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: m.answer}}}, nil
+}
+
+func (m *stubLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestBreakerModelDuringOutage(t *testing.T) {
+	provider := &stubLLM{answer: "hello"}
+	provider.down.Store(true)
+	const coolDown = 50 * time.Millisecond
+	model := &breakerModel{Model: provider, breaker: breaker.New(configpkg.BreakerConfig{
+		FailureRate: 0.5, MinRequests: 3, Window: time.Minute, CoolDown: coolDown, HalfOpenProbes: 1,
+	}, nil)}
+	server := &ChatServer{llmBreaker: model.breaker}
+	check := llmBreakerCheck(model.breaker)
+	agent := &SimpleChatAgent{llm: model}
+
+	for range 3 {
+		if _, err := agent.Chat(context.Background(), "hi", false, false); !errors.Is(err, errProviderDown) {
+			t.Fatalf("Chat = %v, want the provider error", err)
+		}
+	}
+	if err := check(context.Background()); err == nil {
+		t.Fatal("health check passed with an open breaker")
+	}
+	// Open: calls fail fast without reaching the provider
+	if _, err := agent.Chat(context.Background(), "hi", false, false); !errors.Is(err, ErrLLMUnavailable) {
+		t.Fatalf("Chat = %v, want ErrLLMUnavailable", err)
+	}
+	if _, err := model.Call(context.Background(), "hi"); !errors.Is(err, ErrLLMUnavailable) {
+		t.Fatalf("Call = %v, want ErrLLMUnavailable", err)
+	}
+	if calls := provider.calls.Load(); calls != 3 {
+		t.Fatalf("provider called %d times, want 3", calls)
+	}
+	w := httptest.NewRecorder()
+	if !server.rejectIfLLMUnavailable(w) || w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("chat request not rejected with 503 while open, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("rejection has no Retry-After header")
+	}
+
+	// The provider recovers; the probe after the cool-down closes the breaker
+	provider.down.Store(false)
+	time.Sleep(coolDown + 10*time.Millisecond)
+	answer, err := agent.Chat(context.Background(), "hi", false, false)
+	if err != nil || answer != "hello" {
+		t.Fatalf("Chat = %q, %v after recovery", answer, err)
+	}
+	if state := model.breaker.State(); state != breaker.StateClosed {
+		t.Fatalf("state = %s after a successful probe, want closed", state)
+	}
+	if err := check(context.Background()); err != nil {
+		t.Fatalf("health check = %v once closed", err)
+	}
+	if server.rejectIfLLMUnavailable(httptest.NewRecorder()) {
+		t.Fatal("chat request rejected once closed")
+	}
+}
+
+func TestRejectIfLLMUnavailableWithoutBreaker(t *testing.T) {
+	if (&ChatServer{}).rejectIfLLMUnavailable(httptest.NewRecorder()) {
+		t.Fatal("rejected a request without a breaker")
+	}
+}
@@ -0,0 +1,115 @@
+package chat
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	monitoringpkg "github.com/smallnest/langchat/pkg/monitoring"
+)
+
+// Purposes of LLM calls, the purpose label of the LLM metrics
+const (
+	llmPurposeChat = "chat" // answers
+	llmPurposeAux  = "aux"  // selection, tags, memories and suggestions
+)
+
+// auxConfigured reports whether auxiliary calls have a model or endpoint of
+// their own; otherwise they share the chat model
+func auxConfigured(config configpkg.LLMConfig) bool {
+	return config.AuxModel != "" || config.AuxBaseURL != "" || config.AuxAPIKey != ""
+}
+
+// auxModelName returns the model answering auxiliary calls
+func auxModelName(config configpkg.LLMConfig) string {
+	return cmp.Or(config.AuxModel, config.Model)
+}
+
+// newModels builds the chat model and the model of the auxiliary calls of an
+// OpenAI-compatible provider, both sending requests with client. The
+// auxiliary model is the chat model unless auxConfigured.
+func newModels(config configpkg.LLMConfig, client *http.Client) (llm, auxLLM llms.Model, err error) {
+	options := []openai.Option{
+		openai.WithModel(config.Model),
+		openai.WithToken(config.APIKey),
+		openai.WithHTTPClient(client),
+	}
+	if config.BaseURL != "" {
+		options = append(options, openai.WithBaseURL(config.BaseURL))
+	}
+	if llm, err = openai.New(options...); err != nil {
+		return nil, nil, fmt.Errorf("failed to create LLM: %w", err)
+	}
+	if !auxConfigured(config) {
+		return llm, llm, nil
+	}
+
+	auxOptions := []openai.Option{
+		openai.WithModel(auxModelName(config)),
+		openai.WithToken(cmp.Or(config.AuxAPIKey, config.APIKey)),
+		openai.WithHTTPClient(client),
+	}
+	if baseURL := cmp.Or(config.AuxBaseURL, config.BaseURL); baseURL != "" {
+		auxOptions = append(auxOptions, openai.WithBaseURL(baseURL))
+	}
+	if auxLLM, err = openai.New(auxOptions...); err != nil {
+		return nil, nil, fmt.Errorf("failed to create auxiliary LLM: %w", err)
+	}
+	return llm, auxLLM, nil
+}
+
+// meteredModel records the requests, errors and provider-reported token usage
+// of an LLM in the metrics, labeled with the purpose of its calls
+type meteredModel struct {
+	llms.Model
+	provider, model, purpose string
+	metrics                  *monitoringpkg.MetricsCollector
+}
+
+// newMeteredModel wraps llm so its calls are recorded for a purpose
+func newMeteredModel(llm llms.Model, provider, model, purpose string, metrics *monitoringpkg.MetricsCollector) *meteredModel {
+	return &meteredModel{Model: llm, provider: provider, model: model, purpose: purpose, metrics: metrics}
+}
+
+// GenerateContent calls the wrapped model and records the call
+func (m *meteredModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	start := time.Now()
+	response, err := m.Model.GenerateContent(ctx, messages, options...)
+	if err != nil {
+		m.metrics.RecordLLMRequest(m.provider, m.model, m.purpose, "error", time.Since(start))
+		errorType := "provider"
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			errorType = "canceled"
+		}
+		m.metrics.RecordLLMError(m.provider, m.model, m.purpose, errorType)
+		return response, err
+	}
+	m.metrics.RecordLLMRequest(m.provider, m.model, m.purpose, "success", time.Since(start))
+
+	if len(response.Choices) > 0 {
+		info := response.Choices[0].GenerationInfo
+		if prompt, _ := info["PromptTokens"].(int); prompt > 0 {
+			m.metrics.RecordLLMTokenUsage(m.provider, m.model, m.purpose, "prompt", int64(prompt))
+		}
+		if completion, _ := info["CompletionTokens"].(int); completion > 0 {
+			m.metrics.RecordLLMTokenUsage(m.provider, m.model, m.purpose, "completion", int64(completion))
+		}
+		if cached := cachedPromptTokens(info); cached > 0 {
+			m.metrics.RecordLLMTokenUsage(m.provider, m.model, m.purpose, "cached_prompt", int64(cached))
+		}
+	}
+	return response, nil
+}
+
+// Call implements the deprecated single-prompt API on top of GenerateContent,
+// so it is recorded as well
+func (m *meteredModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
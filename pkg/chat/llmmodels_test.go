@@ -0,0 +1,234 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/tools"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// providerCall is a completion request received by a mock provider
+type providerCall struct {
+	model, authorization string
+}
+
+// mockProvider is an OpenAI-compatible endpoint recording the completion requests it answers
+type mockProvider struct {
+	*httptest.Server
+	mu    sync.Mutex
+	calls []providerCall
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	p := &mockProvider{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p.mu.Lock()
+		p.calls = append(p.calls, providerCall{body.Model, r.Header.Get("Authorization")})
+		p.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-test",
+			"object":  "chat.completion",
+			"model":   body.Model,
+			"choices": []map[string]any{{"index": 0, "message": map[string]string{"role": "assistant", "content": "ok"}, "finish_reason": "stop"}},
+			"usage":   map[string]int{"prompt_tokens": 3, "completion_tokens": 1, "total_tokens": 4},
+		})
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+// takeCalls returns the requests received since the last call
+func (p *mockProvider) takeCalls() []providerCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	calls := p.calls
+	p.calls = nil
+	return calls
+}
+
+func TestNewModels(t *testing.T) {
+	main, aux := newMockProvider(t), newMockProvider(t)
+	tests := []struct {
+		name            string
+		config          configpkg.LLMConfig
+		wantShared      bool
+		wantAuxEndpoint *mockProvider
+		wantAuxCall     providerCall
+		wantChatCall    providerCall
+	}{
+		{
+			name:            "no auxiliary model",
+			config:          configpkg.LLMConfig{Model: "big", APIKey: "main-key", BaseURL: main.URL},
+			wantShared:      true,
+			wantAuxEndpoint: main,
+			wantAuxCall:     providerCall{"big", "Bearer main-key"},
+			wantChatCall:    providerCall{"big", "Bearer main-key"},
+		},
+		{
+			name:            "auxiliary model",
+			config:          configpkg.LLMConfig{Model: "big", AuxModel: "small", APIKey: "main-key", BaseURL: main.URL},
+			wantAuxEndpoint: main,
+			wantAuxCall:     providerCall{"small", "Bearer main-key"},
+			wantChatCall:    providerCall{"big", "Bearer main-key"},
+		},
+		{
+			name: "auxiliary endpoint",
+			config: configpkg.LLMConfig{Model: "big", APIKey: "main-key", BaseURL: main.URL,
+				AuxBaseURL: aux.URL, AuxAPIKey: "aux-key"},
+			wantAuxEndpoint: aux,
+			wantAuxCall:     providerCall{"big", "Bearer aux-key"},
+			wantChatCall:    providerCall{"big", "Bearer main-key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm, auxLLM, err := newModels(tt.config, http.DefaultClient)
+			if err != nil {
+				t.Fatalf("newModels: %v", err)
+			}
+			if shared := llm == auxLLM; shared != tt.wantShared {
+				t.Fatalf("auxiliary model shared with chat = %v, want %v", shared, tt.wantShared)
+			}
+
+			ctx := context.Background()
+			if _, err := llms.GenerateFromSinglePrompt(ctx, auxLLM, "pick a tool"); err != nil {
+				t.Fatalf("auxiliary call: %v", err)
+			}
+			if calls := tt.wantAuxEndpoint.takeCalls(); len(calls) != 1 || calls[0] != tt.wantAuxCall {
+				t.Fatalf("auxiliary call sent %+v, want %+v", calls, tt.wantAuxCall)
+			}
+			if _, err := llms.GenerateFromSinglePrompt(ctx, llm, "answer me"); err != nil {
+				t.Fatalf("chat call: %v", err)
+			}
+			if calls := main.takeCalls(); len(calls) != 1 || calls[0] != tt.wantChatCall {
+				t.Fatalf("chat call sent %+v, want %+v", calls, tt.wantChatCall)
+			}
+			if calls := aux.takeCalls(); len(calls) != 0 {
+				t.Fatalf("auxiliary endpoint received %+v", calls)
+			}
+		})
+	}
+}
+
+func TestCallPathsUseTheirModel(t *testing.T) {
+	cs := newTestServer(t)
+	chatModel, auxModel := &stubLLM{answer: "an answer"}, &stubLLM{answer: `["go"]`}
+	cs.llm, cs.auxLLM = chatModel, auxModel
+	ctx := context.Background()
+	messages := []sessionpkg.Message{
+		{Role: "user", Content: "How do I test Go code?"},
+		{Role: "assistant", Content: "Use the testing package."},
+	}
+
+	tests := []struct {
+		name string
+		call func()
+	}{
+		{"skill selection", func() {
+			agent := cs.newAgent()
+			agent.skills = []SkillInfo{{Name: "golang", Description: "Go programming"}}
+			_, _, _ = agent.selectSkillForTask(ctx, "write a test")
+		}},
+		{"tool selection", func() {
+			_, _, _, _ = cs.newAgent().selectToolForTask(ctx, "search the web", []tools.Tool{&faultTool{}})
+		}},
+		{"tags", func() { _, _ = cs.generateTags(ctx, messages) }},
+		{"memories", func() { _, _ = cs.extractMemories(ctx, messages, nil) }},
+		{"suggestions", func() { _, _ = cs.generateSuggestions(ctx, messages[0].Content, messages[1].Content) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chatBefore, auxBefore := chatModel.calls.Load(), auxModel.calls.Load()
+			tt.call()
+			if got := auxModel.calls.Load() - auxBefore; got != 1 {
+				t.Fatalf("auxiliary model called %d times, want 1", got)
+			}
+			if got := chatModel.calls.Load() - chatBefore; got != 0 {
+				t.Fatalf("chat model called %d times, want 0", got)
+			}
+		})
+	}
+
+	t.Run("answer", func(t *testing.T) {
+		chatBefore := chatModel.calls.Load()
+		_, sm := testRequest(cs, http.MethodPost, "/api/chat")
+		if w := postChat(t, cs, chatRequest{SessionID: sm.CreateSession().ID, Message: "hello"}); w.Code != http.StatusOK {
+			t.Fatalf("chat = %d %s", w.Code, w.Body)
+		}
+		if got := chatModel.calls.Load() - chatBefore; got != 1 {
+			t.Fatalf("chat model called %d times for the answer, want 1", got)
+		}
+	})
+}
+
+// usageLLM answers with the token usage the provider reported, or fails
+type usageLLM struct{ err error }
+
+func (m *usageLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content:        "ok",
+		GenerationInfo: map[string]any{"PromptTokens": 12, "CompletionTokens": 3},
+	}}}, nil
+}
+
+func (m *usageLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestMeteredModelRecordsPurpose(t *testing.T) {
+	const provider = "metered-test"
+	labels := func(model, purpose string, extra ...string) map[string]string {
+		l := map[string]string{"provider": provider, "model": model, "purpose": purpose}
+		for i := 0; i < len(extra); i += 2 {
+			l[extra[i]] = extra[i+1]
+		}
+		return l
+	}
+	chatModel := newMeteredModel(&usageLLM{}, provider, "big", llmPurposeChat, testMetrics())
+	auxModel := newMeteredModel(&usageLLM{}, provider, "small", llmPurposeAux, testMetrics())
+	failing := newMeteredModel(&usageLLM{err: errProviderDown}, provider, "small", llmPurposeAux, testMetrics())
+
+	ctx := context.Background()
+	for _, model := range []llms.Model{chatModel, auxModel, auxModel, failing} {
+		_, _ = model.Call(ctx, "hi")
+	}
+
+	tests := []struct {
+		metric string
+		labels map[string]string
+		want   float64
+	}{
+		{"llm_requests_total", labels("big", llmPurposeChat, "status", "success"), 1},
+		{"llm_requests_total", labels("small", llmPurposeAux, "status", "success"), 2},
+		{"llm_requests_total", labels("small", llmPurposeAux, "status", "error"), 1},
+		{"llm_errors_total", labels("small", llmPurposeAux, "error_type", "provider"), 1},
+		{"llm_token_usage_total", labels("big", llmPurposeChat, "type", "prompt"), 12},
+		{"llm_token_usage_total", labels("small", llmPurposeAux, "type", "prompt"), 24},
+		{"llm_token_usage_total", labels("small", llmPurposeAux, "type", "completion"), 6},
+	}
+	for _, tt := range tests {
+		if got := counterValue(t, tt.metric, tt.labels); got != tt.want {
+			t.Errorf("%s%v = %v, want %v", tt.metric, tt.labels, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package chat
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLLMBaseURL is the endpoint of the OpenAI client when no BaseURL is set
+const defaultLLMBaseURL = "https://api.openai.com/v1"
+
+// Probing of the LLM endpoint: each attempt is bounded by llmProbeTimeout and
+// repeated every llmProbeInterval until the endpoint is reachable
+const (
+	llmProbeTimeout  = 10 * time.Second
+	llmProbeInterval = 30 * time.Second
+)
+
+// errLLMNotProbed is the probe result before the first probe finished
+var errLLMNotProbed = errors.New("LLM endpoint has not been probed yet")
+
+// llmProbe checks that the LLM endpoint can be reached, so a wrong BaseURL,
+// proxy or CA bundle shows up at startup instead of on the first chat. Any
+// HTTP response below 500 counts as reachable, including 401 and 404.
+type llmProbe struct {
+	url     *url.URL
+	client  *http.Client
+	mu      sync.Mutex
+	lastErr error         // nil once the endpoint was reachable
+	probed  chan struct{} // closed once the first probe finished
+	once    sync.Once
+}
+
+// newLLMProbe returns a probe of the endpoint at baseURL using the client of the LLM
+func newLLMProbe(baseURL string, client *http.Client) (*llmProbe, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LLM base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid LLM base URL %s: scheme must be http or https", u.Redacted())
+	}
+	return &llmProbe{url: u, client: client, lastErr: errLLMNotProbed, probed: make(chan struct{})}, nil
+}
+
+// Err returns why the endpoint was unreachable at the last probe, or nil
+// once it was reachable. A nil probe never fails.
+func (p *llmProbe) Err() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastErr
+}
+
+// wait waits for the first probe to finish and returns Err, or the error of
+// ctx when it is done first. A nil probe never fails.
+func (p *llmProbe) wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	select {
+	case <-p.probed:
+		return p.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// start probes the endpoint in the background until it is reachable or ctx is done
+func (p *llmProbe) start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(llmProbeInterval)
+		defer ticker.Stop()
+		for failures := 0; ; failures++ {
+			err := p.probe(ctx)
+			switch {
+			case err == nil && failures == 0:
+				return
+			case err == nil:
+				log.Printf("✅ LLM endpoint %s is reachable again", p.url.Redacted())
+				return
+			case ctx.Err() != nil:
+				return
+			case failures == 0:
+				log.Printf("LLM endpoint %s is unreachable, not ready until it is (LLM_SKIP_STARTUP_PROBE skips this check): %v", p.url.Redacted(), err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// probe sends one request to the endpoint and records the result
+func (p *llmProbe) probe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, llmProbeTimeout)
+	defer cancel()
+
+	err := probeEndpoint(ctx, p.client, p.url)
+	p.mu.Lock()
+	p.lastErr = err
+	p.mu.Unlock()
+	p.once.Do(func() { close(p.probed) })
+	return err
+}
+
+// probeEndpoint requests the model list of an OpenAI-compatible endpoint and
+// describes a failure as a DNS, connection, TLS or HTTP error
+func probeEndpoint(ctx context.Context, client *http.Client, u *url.URL) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(u.String(), "/")+"/models", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return describeProbeError(u, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("HTTP error: %s answered %s", u.Host, resp.Status)
+	}
+	return nil
+}
+
+// describeProbeError names the stage of the connection a probe failed in
+func describeProbeError(u *url.URL, err error) error {
+	var (
+		dnsErr       *net.DNSError
+		verifyErr    *tls.CertificateVerificationError
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		opErr        *net.OpError
+	)
+	switch {
+	case errors.As(err, &dnsErr):
+		return fmt.Errorf("DNS error: cannot resolve %s: %w", dnsErr.Name, err)
+	case errors.As(err, &verifyErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr),
+		strings.Contains(err.Error(), "tls: "):
+		return fmt.Errorf("TLS error: handshake with %s failed (check LLM_CA_BUNDLE and the proxy): %w", u.Host, err)
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return fmt.Errorf("connection error: cannot connect to %s: %w", u.Host, err)
+	default:
+		return fmt.Errorf("HTTP error: request to %s failed: %w", u.Host, err)
+	}
+}
@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLLMProbeClassifiesFailures(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			t.Errorf("probed %s, want /v1/models", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	untrusted := httptest.NewTLSServer(http.NotFoundHandler())
+	defer untrusted.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	closed := "http://" + listener.Addr().String() + "/v1"
+	listener.Close()
+
+	for _, tc := range []struct {
+		name, url, want string
+	}{
+		{"reachable", ok.URL + "/v1", ""},
+		{"server error", failing.URL + "/v1", "HTTP error"},
+		{"refused", closed, "connection error"},
+		{"untrusted certificate", untrusted.URL + "/v1", "TLS error"},
+		{"unknown host", "http://langchat-probe.invalid/v1", "DNS error"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			probe, err := newLLMProbe(tc.url, &http.Client{})
+			if err != nil {
+				t.Fatalf("newLLMProbe: %v", err)
+			}
+			err = probe.probe(context.Background())
+			switch {
+			case tc.want == "" && err != nil:
+				t.Fatalf("probe = %v, want reachable", err)
+			case tc.want != "" && (err == nil || !strings.HasPrefix(err.Error(), tc.want)):
+				t.Fatalf("probe = %v, want %s", err, tc.want)
+			}
+			if got := probe.Err(); got != err {
+				t.Fatalf("Err = %v, want %v", got, err)
+			}
+		})
+	}
+}
+
+func TestLLMProbeWait(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	probe, err := newLLMProbe(server.URL, &http.Client{})
+	if err != nil {
+		t.Fatalf("newLLMProbe: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := probe.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait before the first probe = %v, want the context error", err)
+	}
+	if !errors.Is(probe.Err(), errLLMNotProbed) {
+		t.Fatalf("Err before the first probe = %v", probe.Err())
+	}
+
+	probeCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	probe.start(probeCtx)
+	if err := probe.wait(context.Background()); err != nil {
+		t.Fatalf("wait = %v, want reachable", err)
+	}
+
+	var disabled *llmProbe
+	if err := disabled.wait(context.Background()); err != nil {
+		t.Fatalf("wait of a disabled probe = %v", err)
+	}
+}
+
+func TestNewLLMProbeRejectsInvalidURLs(t *testing.T) {
+	for _, url := range []string{"localhost:8080/v1", "ftp://example.com", "http://"} {
+		if _, err := newLLMProbe(url, http.DefaultClient); err == nil {
+			t.Errorf("newLLMProbe(%q) succeeded", url)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/audit"
+)
+
+// defaultMaintenanceMessage is returned to clients when no message was provided
+const defaultMaintenanceMessage = "The service is undergoing maintenance. Please try again later."
+
+// maintenanceState tracks maintenance mode and the chat requests still in flight.
+// It lives on the ChatServer rather than in the config, so it survives config
+// hot-reloads but not restarts.
+type maintenanceState struct {
+	mu         sync.Mutex
+	enabled    bool
+	message    string
+	since      time.Time
+	deadline   time.Time
+	graceTimer *time.Timer
+	streams    map[int64]context.CancelFunc
+	nextID     int64
+}
+
+// MaintenanceStatus describes the current maintenance mode state
+type MaintenanceStatus struct {
+	Enabled       bool      `json:"enabled"`
+	Message       string    `json:"message,omitempty"`
+	Since         time.Time `json:"since,omitzero"`
+	GraceDeadline time.Time `json:"grace_deadline,omitzero"`
+	ActiveStreams int       `json:"active_streams"`
+}
+
+// status returns a snapshot of the maintenance state
+func (m *maintenanceState) status() MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return MaintenanceStatus{
+		Enabled:       m.enabled,
+		Message:       m.message,
+		Since:         m.since,
+		GraceDeadline: m.deadline,
+		ActiveStreams: len(m.streams),
+	}
+}
+
+// active reports whether maintenance mode is on and the message to show clients
+func (m *maintenanceState) active() (bool, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.enabled, m.message
+}
+
+// enable turns on maintenance mode. In-flight chat requests are cancelled once
+// the grace period elapses.
+func (m *maintenanceState) enable(message string, grace time.Duration) {
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.enabled {
+		m.since = time.Now().UTC()
+	}
+	m.enabled = true
+	m.message = message
+	m.deadline = time.Now().UTC().Add(grace)
+
+	if m.graceTimer != nil {
+		m.graceTimer.Stop()
+	}
+	m.graceTimer = time.AfterFunc(grace, m.cancelStreams)
+}
+
+// disable turns off maintenance mode
+func (m *maintenanceState) disable() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enabled = false
+	m.message = ""
+	m.since = time.Time{}
+	m.deadline = time.Time{}
+	if m.graceTimer != nil {
+		m.graceTimer.Stop()
+		m.graceTimer = nil
+	}
+}
+
+// track registers an in-flight chat request and returns a function to unregister it
+func (m *maintenanceState) track(cancel context.CancelFunc) func() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.streams == nil {
+		m.streams = make(map[int64]context.CancelFunc)
+	}
+	id := m.nextID
+	m.nextID++
+	m.streams[id] = cancel
+
+	return func() {
+		m.mu.Lock()
+		delete(m.streams, id)
+		m.mu.Unlock()
+	}
+}
+
+// cancelStreams cancels all chat requests still running after the grace period
+func (m *maintenanceState) cancelStreams() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.enabled {
+		return
+	}
+	if len(m.streams) > 0 {
+		log.Printf("Maintenance grace period elapsed, cancelling %d in-flight chat requests", len(m.streams))
+	}
+	for _, cancel := range m.streams {
+		cancel()
+	}
+}
+
+// rejectIfMaintenance writes a 503 response and returns true when maintenance mode is on
+func (cs *ChatServer) rejectIfMaintenance(w http.ResponseWriter) bool {
+	enabled, message := cs.maintenance.active()
+	if !enabled {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "60")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"error":       "maintenance",
+		"message":     message,
+		"maintenance": true,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode maintenance response: %v", err)
+	}
+	return true
+}
+
+// HandleGetMaintenance reports the maintenance mode state
+func (cs *ChatServer) HandleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(cs.maintenance.status()); err != nil {
+		log.Printf("Warning: Failed to encode maintenance status: %v", err)
+	}
+}
+
+// HandleSetMaintenance enables or disables maintenance mode
+func (cs *ChatServer) HandleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled      bool   `json:"enabled"`
+		Message      string `json:"message"`
+		GraceSeconds *int   `json:"grace_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Enabled {
+		grace := cs.GetConfig().Server.MaintenanceGrace
+		if req.GraceSeconds != nil {
+			grace = time.Duration(*req.GraceSeconds) * time.Second
+		}
+		cs.maintenance.enable(req.Message, grace)
+		log.Printf("🚧 Maintenance mode enabled (grace %s)", grace)
+	} else {
+		cs.maintenance.disable()
+		log.Println("✅ Maintenance mode disabled")
+	}
+
+	cs.auditLogger.Log(audit.Event{
+		Action:  "server.maintenance",
+		Actor:   cs.getClientID(r),
+		Result:  "success",
+		Details: map[string]any{"enabled": req.Enabled, "message": req.Message},
+	})
+
+	cs.HandleGetMaintenance(w, r)
+}
@@ -0,0 +1,216 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	mcpclient "github.com/smallnest/goskills/mcp"
+	"github.com/tmc/langchaingo/tools"
+)
+
+// errMCPServerUnavailable is returned by a tool from the cached manifest of an
+// MCP server that could not be reached
+var errMCPServerUnavailable = errors.New("MCP server unavailable")
+
+// mcpRetryInterval is how long the tools of an unreachable MCP server fail
+// fast before a call tries to connect to it again
+const mcpRetryInterval = 30 * time.Second
+
+// mcpManifestCache keeps the tool manifests of the MCP servers that were last
+// reached, on disk, so their tools can be offered while the servers connect,
+// or while they are down, instead of vanishing from selection. An entry is
+// only used for the server config it was recorded with.
+type mcpManifestCache struct {
+	path string // empty keeps the cache in memory only
+
+	mu          sync.Mutex
+	entries     map[string]mcpManifestEntry // server name -> manifest
+	unavailable map[string]time.Time        // server name -> when calls may try it again
+}
+
+// mcpManifestEntry is the cached manifest of an MCP server
+type mcpManifestEntry struct {
+	ConfigHash string            `json:"config_hash"` // hash of the server config, see mcpServerHash
+	Tools      []mcpToolManifest `json:"tools"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// loadMCPManifestCache reads the manifest cache at path; an empty path keeps
+// manifests in memory only. An unreadable cache is started empty.
+func loadMCPManifestCache(path string) *mcpManifestCache {
+	c := &mcpManifestCache{
+		path:        path,
+		entries:     make(map[string]mcpManifestEntry),
+		unavailable: make(map[string]time.Time),
+	}
+	if path == "" {
+		return c
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &c.entries)
+	}
+	if err != nil {
+		log.Printf("Warning: Ignoring MCP manifest cache %s: %v", path, err)
+		c.entries = make(map[string]mcpManifestEntry)
+	}
+	return c
+}
+
+// mcpServerHash identifies the config of an MCP server, so a cached manifest
+// is dropped when the server's command, arguments, URL or environment change
+func mcpServerHash(server mcpclient.MCPServer) string {
+	data, _ := json.Marshal(server)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:12])
+}
+
+// lookup returns the cached manifest of a server with config hash; an entry
+// of another config is invalidated. c may be nil.
+func (c *mcpManifestCache) lookup(server, hash string) ([]mcpToolManifest, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[server]
+	if !ok {
+		return nil, false
+	}
+	if entry.ConfigHash != hash {
+		log.Printf("MCP server %s changed, dropping its cached tool manifest", server)
+		delete(c.entries, server)
+		c.saveLocked()
+		return nil, false
+	}
+	return entry.Tools, true
+}
+
+// prune drops the manifests of servers that are no longer configured; c may be nil
+func (c *mcpManifestCache) prune(servers map[string]string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	maps.DeleteFunc(c.entries, func(server string, _ mcpManifestEntry) bool {
+		_, ok := servers[server]
+		return !ok
+	})
+	if len(c.entries) != n {
+		c.saveLocked()
+	}
+}
+
+// connected records the tools of a server that was reached; c may be nil
+func (c *mcpManifestCache) connected(server, hash string, manifest []mcpToolManifest) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.unavailable, server)
+	if entry, ok := c.entries[server]; ok && entry.ConfigHash == hash && manifestsEqual(entry.Tools, manifest) {
+		return
+	}
+	c.entries[server] = mcpManifestEntry{ConfigHash: hash, Tools: manifest, UpdatedAt: time.Now()}
+	c.saveLocked()
+}
+
+// failed records that a server could not be reached, so its tools fail fast
+// for a while; c may be nil
+func (c *mcpManifestCache) failed(server string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unavailable[server] = time.Now().Add(mcpRetryInterval)
+}
+
+// available reports whether calls may try to reach a server; c may be nil
+func (c *mcpManifestCache) available(server string) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().After(c.unavailable[server])
+}
+
+// saveLocked writes the cache atomically. The caller must hold c.mu.
+func (c *mcpManifestCache) saveLocked() {
+	if c.path == "" {
+		return
+	}
+	if err := writeMCPManifestCache(c.path, c.entries); err != nil {
+		log.Printf("Warning: Failed to save MCP manifest cache: %v", err)
+	}
+}
+
+// writeMCPManifestCache writes the manifests to path atomically
+func writeMCPManifestCache(path string, entries map[string]mcpManifestEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal MCP manifests: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create MCP manifest cache directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write MCP manifest cache: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write MCP manifest cache: %w", err)
+	}
+	return nil
+}
+
+// manifestsEqual reports whether two manifests describe the same tools
+func manifestsEqual(a, b []mcpToolManifest) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(dataA) == string(dataB)
+}
+
+// mcpManifests builds the manifests of the connected servers from their
+// tools, named server__tool, and parameter schemas
+func mcpManifests(serverTools []tools.Tool, schemas map[string]any) map[string][]mcpToolManifest {
+	manifests := make(map[string][]mcpToolManifest)
+	for _, tool := range serverTools {
+		server, name, ok := strings.Cut(tool.Name(), "__")
+		if !ok {
+			continue
+		}
+		manifests[server] = append(manifests[server], mcpToolManifest{
+			Name:        name,
+			Description: tool.Description(),
+			Parameters:  schemas[tool.Name()],
+		})
+	}
+	for _, manifest := range manifests {
+		slices.SortFunc(manifest, func(a, b mcpToolManifest) int { return strings.Compare(a.Name, b.Name) })
+	}
+	return manifests
+}
@@ -0,0 +1,246 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// memoryExtractionTimeout bounds a single memory extraction call
+const memoryExtractionTimeout = 20 * time.Second
+
+// maxExtractedMemories is the number of memories kept from one extraction run
+const maxExtractedMemories = 5
+
+// memoryPromptHeader introduces the user's memories in the prompt
+const memoryPromptHeader = "What you know about the user from earlier conversations. Use it when relevant and do not mention it otherwise:\n"
+
+// SetMemories sets the memories of the user added to the prompt, in a system
+// message right after the system prompt; empty memories remove the message
+func (a *SimpleChatAgent) SetMemories(memories string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.hasMemories {
+		if memories != "" {
+			a.messages[1].Parts = []llms.ContentPart{llms.TextPart(memoryPromptHeader + memories)}
+			return
+		}
+		a.messages = slices.Delete(a.messages, 1, 2)
+		a.hasMemories = false
+		return
+	}
+	if memories == "" || len(a.messages) == 0 || a.messages[0].Role != llms.ChatMessageTypeSystem {
+		return
+	}
+	a.messages = slices.Insert(a.messages, 1, llms.MessageContent{
+		Role:  llms.ChatMessageTypeSystem,
+		Parts: []llms.ContentPart{llms.TextPart(memoryPromptHeader + memories)},
+	})
+	a.hasMemories = true
+}
+
+// applyMemories brings the memories in the prompt of an agent up to date
+// with the user's, so added and deleted memories apply from the next turn
+func (cs *ChatServer) applyMemories(agent ChatAgent, userID string) {
+	simpleAgent, ok := agent.(*SimpleChatAgent)
+	if !ok {
+		return
+	}
+	simpleAgent.SetMemories(cs.GetSessionManager(userID).MemoryPrompt(cs.GetConfig().Memories.MaxPromptChars))
+}
+
+// maybeExtractMemories asks the LLM in the background for durable facts about
+// the user every config.Memories.Every messages of a session. Like tagging,
+// it never blocks the caller and skips the run when the server is busy.
+func (cs *ChatServer) maybeExtractMemories(userID, sessionID string) {
+	cfg := cs.GetConfig().Memories
+	if !cfg.Extract || cfg.Every <= 0 {
+		return
+	}
+
+	sm := cs.GetSessionManager(userID)
+	messages, err := sm.GetMessages(sessionID)
+	if err != nil {
+		return
+	}
+	messages = slices.DeleteFunc(messages, func(msg sessionpkg.Message) bool { return msg.Synthetic })
+	if len(messages) == 0 || len(messages)%cfg.Every != 0 {
+		return
+	}
+
+	if len(cs.requestSem) > cap(cs.requestSem)/2 {
+		log.Printf("Skipping memory extraction of session %s: server busy", redact.LogID(sessionID))
+		return
+	}
+	select {
+	case cs.memorySem <- struct{}{}:
+	default:
+		log.Printf("Skipping memory extraction of session %s: extraction already in progress", redact.LogID(sessionID))
+		return
+	}
+
+	go func() {
+		defer func() { <-cs.memorySem }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), memoryExtractionTimeout)
+		defer cancel()
+
+		candidates, err := cs.extractMemories(ctx, messages, sm.ListMemories())
+		if err != nil {
+			log.Printf("Memory extraction of session %s failed: %v", redact.LogID(sessionID), err)
+			return
+		}
+		var added int
+		for _, content := range candidates {
+			if _, err := sm.AddMemory(content, sessionpkg.MemorySourceChat, sessionID); err != nil {
+				log.Printf("Warning: Failed to save memory from session %s: %v", redact.LogID(sessionID), err)
+				break
+			}
+			added++
+		}
+		if added > 0 {
+			log.Printf("Extracted %d memories from session %s", added, redact.LogID(sessionID))
+		}
+	}()
+}
+
+// extractMemories asks the LLM for durable facts about the user stated in
+// the user's messages of a conversation, leaving out those already known
+func (cs *ChatServer) extractMemories(ctx context.Context, messages []sessionpkg.Message, known []sessionpkg.Memory) ([]string, error) {
+	cfg := cs.GetConfig().Memories
+
+	var transcript strings.Builder
+	for _, msg := range messages[max(0, len(messages)-cfg.Every):] {
+		if msg.Role != "user" {
+			continue
+		}
+		content := []rune(msg.Content)
+		if len(content) > 500 {
+			content = content[:500]
+		}
+		fmt.Fprintf(&transcript, "- %s\n", string(content))
+	}
+	var knownList strings.Builder
+	for _, memory := range known {
+		fmt.Fprintf(&knownList, "- %s\n", memory.Content)
+	}
+	if knownList.Len() == 0 {
+		knownList.WriteString("(none)\n")
+	}
+
+	prompt := fmt.Sprintf(`Extract up to %d durable facts about the user from their messages below, such as their profession, skills or lasting preferences.
+Only include facts the user stated about themselves that will still be true in future conversations. Skip requests, questions, temporary situations and anything sensitive such as health, finances or credentials.
+Write each fact as a short sentence in the user's language, e.g. "Is a Go developer" or "Prefers metric units". Leave out facts already known.
+
+Already known:
+%s
+User messages:
+%s
+Respond with a JSON array of strings only, e.g. ["Prefers metric units"], or [] if there are none. Do NOT use markdown code fences.`, maxExtractedMemories, knownList.String(), transcript.String())
+
+	options := []llms.CallOption{llms.WithMaxTokens(256), llms.WithTemperature(0)}
+	if cfg.Model != "" {
+		options = append(options, llms.WithModel(cfg.Model))
+	}
+
+	response, err := cs.auxLLM.GenerateContent(ctx, []llms.MessageContent{
+		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextPart(prompt)}},
+	}, options...)
+	if err != nil {
+		return nil, fmt.Errorf("LLM call failed for memory extraction: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("no response from LLM")
+	}
+
+	content := strings.TrimSpace(response.Choices[0].Content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.Trim(content, "`\n ")
+
+	var candidates []string
+	if err := json.Unmarshal([]byte(content), &candidates); err != nil {
+		return nil, fmt.Errorf("failed to parse memories: %w", err)
+	}
+
+	memories := make([]string, 0, maxExtractedMemories)
+	for _, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "" || len([]rune(candidate)) > sessionpkg.MaxMemoryLength {
+			continue
+		}
+		memories = append(memories, candidate)
+		if len(memories) == maxExtractedMemories {
+			break
+		}
+	}
+	return memories, nil
+}
+
+// memoryErrorStatus maps memory errors to HTTP status codes
+func memoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sessionpkg.ErrMemoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, sessionpkg.ErrInvalidMemory):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HandleListMemories returns the memories of the current user
+func (cs *ChatServer) HandleListMemories(w http.ResponseWriter, r *http.Request) {
+	sm := cs.GetSessionManager(cs.getClientID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sm.ListMemories()); err != nil {
+		log.Printf("Warning: Failed to encode memories response: %v", err)
+	}
+}
+
+// HandleAddMemory adds a memory for the current user
+func (cs *ChatServer) HandleAddMemory(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectUnverified(w, r, featureMemories) {
+		return
+	}
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	memory, err := cs.GetSessionManager(cs.getClientID(r)).AddMemory(req.Content, sessionpkg.MemorySourceUser, "")
+	if err != nil {
+		http.Error(w, err.Error(), memoryErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(memory); err != nil {
+		log.Printf("Warning: Failed to encode memory response: %v", err)
+	}
+}
+
+// HandleDeleteMemory deletes a memory of the current user
+func (cs *ChatServer) HandleDeleteMemory(w http.ResponseWriter, r *http.Request) {
+	if err := cs.GetSessionManager(cs.getClientID(r)).DeleteMemory(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), memoryErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
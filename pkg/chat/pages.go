@@ -0,0 +1,113 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/smallnest/langchat/pkg/middleware"
+)
+
+// maxPageVariants bounds the number of path prefixes a page is kept
+// rewritten for; pages for further prefixes are rewritten on every request
+const maxPageVariants = 8
+
+// staticPage is an HTML page read once at startup, served from memory
+type staticPage struct {
+	name string
+	data []byte
+	etag string // hash of data, so the tag changes with every build of the page
+
+	variantsMu sync.Mutex
+	variants   map[string]*staticPage // base path -> page rewritten for it
+}
+
+// loadStaticPage reads a page of the static filesystem, referring to the
+// versioned paths of assets
+func loadStaticPage(staticFS fs.FS, assets *assetManifest, name string) (*staticPage, error) {
+	data, err := fs.ReadFile(staticFS, "static/"+name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return newStaticPage(name, assets.rewrite(data)), nil
+}
+
+// newStaticPage returns the page with the content data
+func newStaticPage(name string, data []byte) *staticPage {
+	sum := sha256.Sum256(data)
+	return &staticPage{
+		name: name,
+		data: data,
+		etag: `"` + hex.EncodeToString(sum[:12]) + `"`,
+	}
+}
+
+// under returns the page with its references to the server below a base
+// path, see middleware.PrefixPaths
+func (p *staticPage) under(basePath string) *staticPage {
+	if basePath == "" {
+		return p
+	}
+	p.variantsMu.Lock()
+	defer p.variantsMu.Unlock()
+	if variant, ok := p.variants[basePath]; ok {
+		return variant
+	}
+	variant := newStaticPage(p.name, middleware.PrefixPaths(p.data, basePath))
+	if len(p.variants) < maxPageVariants {
+		if p.variants == nil {
+			p.variants = make(map[string]*staticPage)
+		}
+		p.variants[basePath] = variant
+	}
+	return variant
+}
+
+// serve writes the page for the base path of the request, or 304 Not
+// Modified when the client already has it
+func (p *staticPage) serve(w http.ResponseWriter, r *http.Request) {
+	p = p.under(middleware.BasePathFrom(r.Context()))
+	headers := w.Header()
+	headers.Set("ETag", p.etag)
+	// Pages are only served to signed-in users; clients must revalidate
+	headers.Set("Cache-Control", "private, no-cache")
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, p.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	headers.Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := w.Write(p.data); err != nil {
+		log.Printf("Warning: Failed to write %s: %v", p.name, err)
+	}
+}
+
+// staticPages are the HTML pages of the web UI
+type staticPages struct {
+	index  *staticPage
+	index2 *staticPage
+	admin  *staticPage
+}
+
+// loadStaticPages reads the pages of the web UI
+func loadStaticPages(staticFS fs.FS, assets *assetManifest) (*staticPages, error) {
+	var pages staticPages
+	for name, page := range map[string]**staticPage{
+		"index.html":  &pages.index,
+		"index2.html": &pages.index2,
+		"admin.html":  &pages.admin,
+	} {
+		var err error
+		if *page, err = loadStaticPage(staticFS, assets, name); err != nil {
+			return nil, err
+		}
+	}
+	return &pages, nil
+}
@@ -0,0 +1,38 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// persistenceWarning tells the client that the answer was given but the
+// history is only kept in memory until the session store accepts it again
+const persistenceWarning = "The conversation could not be saved and is kept in memory; it will be saved once storage is available again"
+
+// persistenceWarningFor returns the warning to include in a chat response
+// when the session has changes that could not be saved, or ""
+func persistenceWarningFor(sm *sessionpkg.SessionManager, sessionID string) string {
+	if sm.SaveError(sessionID) != nil {
+		return persistenceWarning
+	}
+	return ""
+}
+
+// sessionStorageCheck fails while any user has sessions waiting to be saved
+func (cs *ChatServer) sessionStorageCheck(ctx context.Context) error {
+	cs.smMu.Lock()
+	managers := make(map[string]*sessionpkg.SessionManager, len(cs.sessionManagers))
+	for userID, sm := range cs.sessionManagers {
+		managers[userID] = sm
+	}
+	cs.smMu.Unlock()
+
+	for _, sm := range managers {
+		if err := sm.PersistenceError(); err != nil {
+			return fmt.Errorf("session storage is failing: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// saveFailures returns the number of failed session saves counted so far
+func saveFailures(t *testing.T) float64 {
+	t.Helper()
+	return counterValue(t, "session_save_failures_total", nil)
+}
+
+// userSessionDir returns the session directory of the user of a request
+func userSessionDir(cs *ChatServer, r *http.Request) string {
+	return fmt.Sprintf("%s/users/%s", cs.sessionDir, cs.getClientID(r))
+}
+
+// breakSessionDir replaces the session directory of a user with a file, so
+// saves fail as on a read-only or full disk, and returns a function
+// restoring the directory
+func breakSessionDir(t *testing.T, cs *ChatServer, r *http.Request) (restore func()) {
+	t.Helper()
+	dir := userSessionDir(cs, r)
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if err := os.WriteFile(dir, nil, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return func() {
+		if err := os.Remove(dir); err != nil {
+			t.Fatalf("Remove: %v", err)
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+	}
+}
+
+// chatResponse is the body of a non-streamed chat response
+type chatResponse struct {
+	Response           string `json:"response"`
+	MessageID          string `json:"message_id"`
+	PersistenceWarning string `json:"persistence_warning"`
+}
+
+func chat(t *testing.T, cs *ChatServer, sessionID, message string) chatResponse {
+	t.Helper()
+	w := postChat(t, cs, chatRequest{SessionID: sessionID, Message: message})
+	if w.Code != http.StatusOK {
+		t.Fatalf("chat = %d %s", w.Code, w.Body)
+	}
+	var response chatResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode chat response %s: %v", w.Body, err)
+	}
+	return response
+}
+
+func TestChatAnswersWhenSavesFail(t *testing.T) {
+	cs := newTestServer(t)
+	config := *cs.GetConfig()
+	config.Database.WriteQueueSize = 0
+	cs.config.Store(&config)
+	cs.llm = &stubLLM{answer: "still answering"}
+	r, sm := testRequest(cs, http.MethodPost, "/api/chat")
+	session := sm.CreateSession()
+	failures := saveFailures(t)
+
+	restore := breakSessionDir(t, cs, r)
+	response := chat(t, cs, session.ID, "hello")
+	if response.Response != "still answering" || response.PersistenceWarning != persistenceWarning {
+		t.Fatalf("chat with failing saves = %+v, want the answer and a persistence warning", response)
+	}
+	if saveFailures(t) <= failures {
+		t.Fatal("failed saves were not counted")
+	}
+	if err := cs.sessionStorageCheck(context.Background()); err == nil {
+		t.Fatal("storage check passed while saves fail")
+	}
+	if messages, _ := sm.GetMessages(session.ID); len(messages) != 2 {
+		t.Fatalf("session holds %d messages in memory, want 2", len(messages))
+	}
+
+	// Once the directory is writable again the retry saves the history
+	restore()
+	deadline := time.Now().Add(5 * time.Second)
+	for cs.sessionStorageCheck(context.Background()) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("unsaved session was not retried")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if response := chat(t, cs, session.ID, "again"); response.PersistenceWarning != "" {
+		t.Fatalf("chat after recovery warns: %q", response.PersistenceWarning)
+	}
+	sm.Flush()
+	reloaded := sessionpkg.NewSessionManager(sessionpkg.NewFileSessionStore(userSessionDir(cs, r)), 0)
+	if messages, err := reloaded.GetMessages(session.ID); err != nil || len(messages) != 4 {
+		t.Fatalf("stored session has %d messages, %v; want 4", len(messages), err)
+	}
+}
+
+func TestChatWarnsOnceQueuedSavesFail(t *testing.T) {
+	cs := newTestServer(t)
+	cs.llm = &stubLLM{answer: "still answering"}
+	r, sm := testRequest(cs, http.MethodPost, "/api/chat")
+	session := sm.CreateSession()
+
+	breakSessionDir(t, cs, r)
+	chat(t, cs, session.ID, "hello")
+	// The failure of the queued save is known once it was written
+	sm.Flush()
+	if response := chat(t, cs, session.ID, "again"); response.PersistenceWarning != persistenceWarning {
+		t.Fatalf("chat after a failed queued save = %+v, want a persistence warning", response)
+	}
+}
@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// HandlePinSession pins or unpins a session and notifies the user's other
+// devices. The optional body {"pinned": bool} sets the state; without it the
+// pin is toggled.
+func (cs *ChatServer) HandlePinSession(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfMaintenance(w) {
+		return
+	}
+
+	var req struct {
+		Pinned *bool `json:"pinned"` // nil toggles the pin
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	sessionID := r.PathValue("id")
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
+
+	userID := cs.getClientID(r)
+	sm := cs.GetSessionManager(userID)
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), sessionLoadStatus(err))
+		return
+	}
+	pinned := !session.IsPinned()
+	if req.Pinned != nil {
+		pinned = *req.Pinned
+	}
+	if err := sm.SetSessionPinned(sessionID, pinned); err != nil {
+		status := http.StatusInternalServerError
+		if !errors.Is(err, sessionpkg.ErrNotPersisted) {
+			status = sessionLoadStatus(err)
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	eventType := "session_unpinned"
+	if pinned {
+		eventType = "session_pinned"
+	}
+	cs.sessionEvents.publish(userID, SessionEvent{Type: eventType, SessionID: sessionID})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"id":     sessionID,
+		"pinned": pinned,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode session pin response: %v", err)
+	}
+}
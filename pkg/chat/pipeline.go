@@ -0,0 +1,669 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	agentpkg "github.com/smallnest/langchat/pkg/agent"
+	"github.com/smallnest/langchat/pkg/dataset"
+	"github.com/smallnest/langchat/pkg/events"
+	"github.com/smallnest/langchat/pkg/experiment"
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+	"github.com/smallnest/langchat/pkg/usage"
+)
+
+// chatRequest is the body of a chat request
+type chatRequest struct {
+	SessionID    string `json:"session_id"`
+	Message      string `json:"message"`
+	UserSettings struct {
+		EnableSkills bool `json:"enable_skills"`
+		EnableMCP    bool `json:"enable_mcp"`
+	} `json:"user_settings"`
+	Stream bool `json:"stream"`  // New field for streaming request
+	DryRun bool `json:"dry_run"` // select tools and their arguments without calling them
+	Debug  bool `json:"debug"`   // include the skill and tool selection decisions in the end event
+
+	// ResponseFormat constrains the answer, e.g. to a JSON object
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// chatTurn carries a chat request through the stages of a ChatPipeline.
+// Each stage fills in the fields the later ones need.
+type chatTurn struct {
+	w         http.ResponseWriter
+	r         *http.Request
+	startTime time.Time
+
+	req        chatRequest // set by validate; Message is expanded by prepare
+	editID     string      // user message replaced by the turn, see HandleEditMessage
+	replaced   string      // answer deleted by the turn, see HandleRegenerate
+	userID     string      // set by authorize
+	sm         *sessionpkg.SessionManager
+	session    *sessionpkg.Session
+	agent      ChatAgent // set by bindAgent
+	assignment *experiment.Assignment
+	settings   sessionpkg.Settings // requested by the client; set by validate and bind_agent
+	format     *responseFormat     // set by validate; nil for unconstrained answers
+	degraded   bool                // set by shed_load; tool selection may be skipped
+	maxTokens  int                 // answer cap of a degraded turn, 0 for none
+
+	// Set by the execute stage of the transport for its respond stage
+	ctx       context.Context
+	execStart time.Time
+	typing    *generationBroadcast
+	response  string
+	reasoning string
+	result    *StreamResult
+	sse       *sseTurn // streaming transport only
+	execErr   error    // failure of the answer, recorded in the agent's lifecycle
+
+	cleanups []func()
+}
+
+// onDone registers a function run when the request ends; functions run in
+// reverse order of registration, like deferred calls
+func (t *chatTurn) onDone(fn func()) {
+	t.cleanups = append(t.cleanups, fn)
+}
+
+// finish runs the functions registered with onDone since the first n
+func (t *chatTurn) finish(n int) {
+	for _, fn := range slices.Backward(t.cleanups[n:]) {
+		fn()
+	}
+	t.cleanups = t.cleanups[:n]
+}
+
+// chatStage is a step of a chat request. It returns false when it has
+// written the response, which ends the request.
+type chatStage struct {
+	name string
+	run  func(t *chatTurn) bool
+}
+
+// ChatPipeline handles chat requests in stages: the shared stages admit,
+// validate and authorize the request, bind the session's agent and persist
+// the user message; then the execute and respond stages of the transport
+// the client asked for produce and deliver the answer.
+type ChatPipeline struct {
+	stages    []chatStage
+	stream    []chatStage       // answer streamed with SSE
+	nonStream []chatStage       // answer in a single JSON response
+	finished  func(t *chatTurn) // after the transport stages, ended or not
+}
+
+// Serve runs a chat request through the pipeline
+func (p *ChatPipeline) Serve(w http.ResponseWriter, r *http.Request) {
+	t := &chatTurn{w: w, r: r, startTime: time.Now()}
+	defer t.finish(0)
+
+	if !runChatStages(p.stages, t) {
+		return
+	}
+	transport := p.nonStream
+	if t.req.Stream {
+		transport = p.stream
+	}
+	// The transport cleans up before the request is recorded as finished,
+	// even when it ended the request
+	n := len(t.cleanups)
+	runChatStages(transport, t)
+	t.finish(n)
+	if p.finished != nil {
+		p.finished(t)
+	}
+}
+
+// runChatStages runs stages in order until one ends the request, and
+// reports whether all of them ran
+func runChatStages(stages []chatStage, t *chatTurn) bool {
+	for _, stage := range stages {
+		if !stage.run(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// newChatPipeline composes the chat request stages of the server
+func (cs *ChatServer) newChatPipeline() *ChatPipeline {
+	return &ChatPipeline{
+		stages: []chatStage{
+			{name: "rate_limit", run: cs.chatRateLimit},
+			{name: "validate", run: cs.chatValidate},
+			{name: "authorize", run: cs.chatAuthorize},
+			{name: "prepare", run: cs.chatPrepare},
+			{name: "budget", run: cs.chatBudget},
+			{name: "shed_load", run: cs.chatShedLoad},
+			{name: "topic_scope", run: cs.chatTopicScope},
+			{name: "bind_agent", run: cs.chatBindAgent},
+			{name: "persist", run: cs.chatPersist},
+		},
+		nonStream: []chatStage{
+			{name: "execute", run: cs.chatExecute},
+			{name: "respond", run: cs.chatRespond},
+		},
+		stream: []chatStage{
+			{name: "execute", run: cs.chatStreamExecute},
+			{name: "respond", run: cs.chatStreamRespond},
+		},
+		finished: func(t *chatTurn) {
+			cs.loadShedder.observe(time.Since(t.startTime))
+			// Record agent session event
+			cs.metricsCollector.RecordAgentSession("chat_request")
+		},
+	}
+}
+
+// HandleChat handles chat message requests
+func (cs *ChatServer) HandleChat(w http.ResponseWriter, r *http.Request) {
+	cs.chatPipeline.Serve(w, r)
+}
+
+// chatRateLimit admits the request: not while draining for maintenance or
+// while the LLM provider is down, and only with a free request slot
+func (cs *ChatServer) chatRateLimit(t *chatTurn) bool {
+	w, r := t.w, t.r
+
+	// Reject new chats while draining for maintenance
+	if cs.rejectIfMaintenance(w) {
+		cs.metricsCollector.RecordHTTPRequest(r.Method, r.URL.Path, "503", 0, 0, 0)
+		return false
+	}
+
+	// Fail fast while the LLM provider is down
+	if cs.rejectIfLLMUnavailable(w) {
+		cs.metricsCollector.RecordHTTPRequest(r.Method, r.URL.Path, "503", 0, 0, 0)
+		return false
+	}
+
+	// Acquire request slot for concurrency control
+	if err := cs.acquireRequest(); err != nil {
+		cs.metricsCollector.RecordHTTPRequest(r.Method, r.URL.Path, "429", 0, 0, 0)
+		log.Printf("Request rejected: %v", err)
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return false
+	}
+	t.onDone(cs.releaseRequest)
+	return true
+}
+
+// chatValidate decodes the request body and checks the required fields
+func (cs *ChatServer) chatValidate(t *chatTurn) bool {
+	if err := json.NewDecoder(t.r.Body).Decode(&t.req); err != nil {
+		log.Printf("Failed to decode request: %v", err)
+		http.Error(t.w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+
+	if t.req.SessionID == "" || t.req.Message == "" {
+		http.Error(t.w, "session_id and message are required", http.StatusBadRequest)
+		return false
+	}
+	if rejectInvalidSessionID(t.w, t.req.SessionID) {
+		return false
+	}
+	return cs.checkChatRequest(t)
+}
+
+// checkChatRequest compiles the response format of a decoded request and
+// records the settings it asks for
+func (cs *ChatServer) checkChatRequest(t *chatTurn) bool {
+	format, err := compileResponseFormat(t.req.ResponseFormat, cs.GetConfig().LLM.Provider)
+	if err != nil {
+		http.Error(t.w, fmt.Sprintf("Invalid response_format: %v", err), http.StatusBadRequest)
+		return false
+	}
+	t.format = format
+	// Recorded before shed_load may turn the tools off for this turn only
+	t.settings.EnableSkills = t.req.UserSettings.EnableSkills
+	t.settings.EnableMCP = t.req.UserSettings.EnableMCP
+	return true
+}
+
+// chatAuthorize identifies the user and checks that the session is theirs
+// and may be continued
+func (cs *ChatServer) chatAuthorize(t *chatTurn) bool {
+	t.userID = cs.getClientID(t.r)
+	t.sm = cs.GetSessionManager(t.userID)
+	setRequestSession(t.r, t.req.SessionID)
+
+	log.Printf("Chat request for session %s: %s (stream: %v)", redact.LogID(t.req.SessionID), redact.LogContent(t.req.Message), t.req.Stream)
+
+	// Verify session exists and may be continued
+	session, err := t.sm.GetSession(t.req.SessionID)
+	if errors.Is(err, sessionpkg.ErrCorruptSession) {
+		log.Printf("Session %s is damaged: %v", redact.LogID(t.req.SessionID), err)
+		http.Error(t.w, "Session is damaged and cannot be continued", http.StatusInternalServerError)
+		return false
+	}
+	if err != nil {
+		log.Printf("Session not found: %s", redact.LogID(t.req.SessionID))
+		http.Error(t.w, "Session not found", http.StatusNotFound)
+		return false
+	}
+	if rejectIfArchived(t.w, session) {
+		return false
+	}
+	if cs.rejectIfSessionDeleted(t) {
+		return false
+	}
+	t.session = session
+	return true
+}
+
+// rejectIfSessionDeleted fails the turn with 410 and the code
+// session_deleted when the session was deleted from the store behind the
+// server's back, after closing its agent; continuing would save a session
+// with only the messages from now on
+func (cs *ChatServer) rejectIfSessionDeleted(t *chatTurn) bool {
+	err := t.sm.CheckStored(t.req.SessionID)
+	if err == nil {
+		return false
+	}
+	if !errors.Is(err, sessionpkg.ErrSessionDeleted) {
+		log.Printf("Warning: Failed to check that session %s is stored: %v", redact.LogID(t.req.SessionID), err)
+		return false
+	}
+
+	log.Printf("Session %s was deleted from the store, dropping its agent", redact.LogID(t.req.SessionID))
+	cs.forgetDeletedSession(t.req.SessionID)
+	t.w.Header().Set("Content-Type", "application/json")
+	t.w.WriteHeader(http.StatusGone)
+	if err := json.NewEncoder(t.w).Encode(map[string]any{
+		"error":   "session_deleted",
+		"message": "the session was deleted, start a new session",
+	}); err != nil {
+		log.Printf("Warning: Failed to encode chat error: %v", err)
+	}
+	return true
+}
+
+// chatPrepare substitutes the session variables in the message and attaches
+// the per-request settings to the request context
+func (cs *ChatServer) chatPrepare(t *chatTurn) bool {
+	// Substitute session variables; the expanded message is what is saved and answered
+	variables := t.session.GetVariables()
+	message, ok := expandSessionVariables(t.w, t.req.Message, variables)
+	if !ok {
+		return false
+	}
+	t.req.Message = message
+	t.r = t.r.WithContext(withSessionVariables(t.r.Context(), variables))
+	t.r = t.r.WithContext(cs.faults.WithRequest(t.r.Context(), t.r))
+	t.r = t.r.WithContext(withDryRun(t.r.Context(), t.req.DryRun))
+	t.r = t.r.WithContext(withResponseFormat(t.r.Context(), t.format))
+	t.r = t.r.WithContext(withToolPolicy(t.r.Context(), cs.configFor(t.r).Tools.Allow))
+	return true
+}
+
+// chatBudget rejects the turn when it would exceed the user's token budget
+func (cs *ChatServer) chatBudget(t *chatTurn) bool {
+	if cs.rejectIfOverBudget(t.w, t.r, t.userID, t.req.Message) {
+		cs.metricsCollector.RecordHTTPRequest(t.r.Method, t.r.URL.Path, "429", 0, 0, 0)
+		return false
+	}
+	return true
+}
+
+// chatBindAgent gets the session's agent and brings it up to date with the
+// turn's experiment variant and the user's memories and MCP servers
+func (cs *ChatServer) chatBindAgent(t *chatTurn) bool {
+	// Get or create agent for this session
+	agent, err := cs.GetOrCreateAgent(t.req.SessionID)
+	if err != nil {
+		log.Printf("Failed to create agent: %v", err)
+		http.Error(t.w, fmt.Sprintf("Failed to create agent: %v", err), http.StatusInternalServerError)
+		return false
+	}
+
+	// Assign the turn to an experiment variant, if any
+	t.assignment = cs.assignExperiment(t.r, t.userID)
+	variant := turnVariant(t.assignment, cs.configFor(t.r).LLM)
+	cs.applyVariant(agent, variant)
+	cs.applyTopicScope(agent)
+	cs.applyMemories(agent, t.userID)
+	cs.applyUserMCP(agent, t.userID)
+	t.agent = agent
+	t.settings.Persona = t.session.GetPersona()
+	if variant != nil {
+		t.settings.Model = variant.Model
+		t.settings.Temperature = variant.Temperature
+		t.settings.MaxTokens = variant.MaxTokens
+	}
+	return true
+}
+
+// chatPersist adds the user message to the history, or replaces the edited
+// one. It only ends the request when the edited message is gone.
+func (cs *ChatServer) chatPersist(t *chatTurn) bool {
+	settings := t.settings
+	userMsg := sessionpkg.Message{Role: "user", Content: t.req.Message, DryRun: t.req.DryRun, Settings: &settings}
+	stampExperiment(&userMsg, t.assignment)
+	if t.editID != "" {
+		if !cs.persistEdit(t, userMsg) {
+			return false
+		}
+	} else if _, err := t.sm.AppendMessage(t.req.SessionID, userMsg); err != nil {
+		log.Printf("Warning: Failed to save message of session %s: %v", redact.LogID(t.req.SessionID), err)
+	}
+	if !t.req.DryRun {
+		cs.activity.RecordMessage(t.userID)
+	}
+
+	log.Printf("Tool settings for session %s - Skills: %v, MCP: %v",
+		redact.LogID(t.req.SessionID), t.req.UserSettings.EnableSkills, t.req.UserSettings.EnableMCP)
+
+	// Record metrics
+	duration := time.Since(t.startTime)
+	requestSize := int64(t.r.ContentLength)
+	cs.metricsCollector.RecordHTTPRequest(t.r.Method, t.r.URL.Path, "200", duration, requestSize, 0)
+	return true
+}
+
+// startTurnGeneration bounds the answer of a turn in time, lets maintenance
+// cancel it and announces it to the user's other clients
+func (cs *ChatServer) startTurnGeneration(t *chatTurn) {
+	ctx, cancel := context.WithTimeout(t.r.Context(), 60*time.Second)
+	t.onDone(cancel)
+	t.onDone(cs.maintenance.track(cancel))
+	t.execStart = time.Now()
+	t.ctx = withMaxTokens(cs.withToolQuota(ctx, t.userID, t.req.SessionID), t.maxTokens)
+
+	typing := cs.startGeneration(t.userID, t.req.SessionID)
+	t.onDone(func() { typing.finish(generationOutcome(t.ctx), "") })
+	t.typing = typing
+
+	if simpleAgent, ok := t.agent.(*SimpleChatAgent); ok {
+		simpleAgent.recordState(agentpkg.StateRunning, "answering a turn", nil)
+		t.onDone(func() {
+			if t.execErr != nil {
+				simpleAgent.recordState(agentpkg.StateError, "turn failed", t.execErr)
+			} else {
+				simpleAgent.recordState(agentpkg.StateReady, "turn finished", nil)
+			}
+		})
+	}
+}
+
+// chatExecute asks the agent for the whole answer
+func (cs *ChatServer) chatExecute(t *chatTurn) bool {
+	sessionID := t.req.SessionID
+	cs.startTurnGeneration(t)
+
+	response, err := t.agent.Chat(t.ctx, t.req.Message, t.req.UserSettings.EnableSkills, t.req.UserSettings.EnableMCP)
+	if err != nil {
+		t.execErr = err
+		log.Printf("Chat error for session %s: %v", redact.LogID(sessionID), err)
+		cs.metricsCollector.RecordAgentError(sessionID, "chat_error")
+		if errors.Is(err, ErrLLMUnavailable) {
+			http.Error(t.w, ErrLLMUnavailable.Error(), http.StatusServiceUnavailable)
+			return false
+		}
+		var formatErr *ResponseFormatError
+		if errors.As(err, &formatErr) {
+			writeInvalidResponseFormat(t.w, formatErr)
+			return false
+		}
+		http.Error(t.w, fmt.Sprintf("Chat failed: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	t.response = response
+	return true
+}
+
+// chatRespond saves the answer and sends it as JSON
+func (cs *ChatServer) chatRespond(t *chatTurn) bool {
+	ctx, sessionID, userID, response := t.ctx, t.req.SessionID, t.userID, t.response
+	log.Printf("Chat response for session %s: %s", redact.LogID(sessionID), redact.LogContent(response))
+
+	// Record agent metrics
+	cs.metricsCollector.RecordAgentMessage(sessionID, "assistant")
+	cs.metricsCollector.RecordAgentTokenUsage(sessionID, "response", int64(len(response)))
+
+	// Add assistant response to history
+	hints := ScanContentHints(response)
+	assistantMsg := sessionpkg.Message{Role: "assistant", Content: response, ContentHints: &hints, DryRun: isDryRun(ctx)}
+	stampExperiment(&assistantMsg, t.assignment)
+	msgID, err := t.sm.AppendMessage(sessionID, assistantMsg)
+	if err != nil {
+		log.Printf("Warning: Failed to save answer of session %s: %v", redact.LogID(sessionID), err)
+	}
+	t.typing.finish(generationCompleted, msgID)
+	cs.maybeTagSession(userID, sessionID)
+	cs.maybeExtractMemories(userID, sessionID)
+	cs.recordExperimentMessage(t.assignment, time.Since(t.execStart))
+	cs.chargeBudget(t.r, userID, t.req.Message, response, nil)
+	cs.recordDatasetSample(userID, dataset.Record{
+		MessageID:  msgID,
+		SessionID:  sessionID,
+		Parameters: map[string]any{"enable_skills": t.req.UserSettings.EnableSkills, "enable_mcp": t.req.UserSettings.EnableMCP, "stream": false, "dry_run": isDryRun(ctx)},
+		Prompt:     t.req.Message,
+		Response:   response,
+		LatencyMs:  time.Since(t.execStart).Milliseconds(),
+	}, nil, t.assignment)
+
+	// Send response
+	responseData := map[string]any{
+		"response":      response,
+		"message_id":    msgID,
+		"seq":           t.sm.MessageSeq(sessionID, msgID),
+		"content_hints": hints,
+	}
+	if warning := persistenceWarningFor(t.sm, sessionID); warning != "" {
+		responseData["persistence_warning"] = warning
+	}
+	if t.degraded {
+		responseData["degraded"] = true
+	}
+	t.w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(t.w).Encode(responseData); err != nil {
+		log.Printf("Warning: Failed to encode chat response: %v", err)
+	}
+	return true
+}
+
+// sseTurn is the state of a turn streamed with SSE
+type sseTurn struct {
+	events        *events.Writer
+	usageReporter *usageReporter // nil when usage reporting is disabled
+	draft         *draftCheckpointer
+}
+
+// chatStreamExecute streams the answer of the agent as chunk events, with
+// its reasoning, tool and usage events
+func (cs *ChatServer) chatStreamExecute(t *chatTurn) bool {
+	w, r, sessionID, userID := t.w, t.r, t.req.SessionID, t.userID
+	enableSkills, enableMCP := t.req.UserSettings.EnableSkills, t.req.UserSettings.EnableMCP
+
+	setSSEHeaders(w)
+
+	// Events are flushed as they are written
+	if _, ok := w.(http.Flusher); !ok {
+		log.Printf("Streaming not supported")
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return false
+	}
+
+	// Let the user's other clients show that an answer is on its way
+	cs.startTurnGeneration(t)
+	ctx, typing := t.ctx, t.typing
+
+	// Send initial event
+	sse := events.NewWriter(w)
+	_ = sse.Write(events.Start{})
+
+	// Live token/cost estimates; nil when usage reporting is disabled
+	usageReporter := cs.newUsageReporter()
+
+	// Checkpoint the partial answer so it survives a server crash; dropped if the stream fails
+	draft := cs.newDraftCheckpointer(t.sm, sessionID)
+	t.onDone(draft.clear)
+	t.sse = &sseTurn{events: sse, usageReporter: usageReporter, draft: draft}
+
+	// Define streaming callback
+	streamFunc := func(ctx context.Context, chunk []byte) error {
+		// A failed write means the client is gone; the error cancels the turn
+		if err := sse.Write(events.Chunk{Chunk: string(chunk)}); err != nil {
+			return err
+		}
+		draft.add(string(chunk))
+		typing.progress(string(chunk))
+
+		if usageReporter != nil && usageReporter.add(string(chunk), true) {
+			return sse.Write(events.Usage{Usage: usageReporter.live()})
+		}
+		return nil
+	}
+
+	eventFunc := func(ctx context.Context, event events.Event) error {
+		// Reasoning tokens are billed as completion tokens
+		if reasoning, ok := event.(events.Reasoning); ok && usageReporter != nil {
+			usageReporter.add(reasoning.Chunk, false)
+		}
+		return sse.Write(event)
+	}
+
+	// Get the full response from agent while streaming
+	var response, reasoning string
+	var result *StreamResult
+	var err error
+	if es, ok := t.agent.(EventStreamer); ok {
+		if result, err = es.ChatStreamWithEvents(ctx, t.req.Message, enableSkills, enableMCP, streamFunc, eventFunc); result != nil {
+			response, reasoning = result.Response, result.Reasoning
+		}
+	} else {
+		response, err = t.agent.ChatStream(ctx, t.req.Message, enableSkills, enableMCP, streamFunc)
+	}
+	if err != nil && (errors.Is(err, ErrClientDisconnected) || r.Context().Err() != nil) {
+		cs.clientDisconnected(userID, sessionID, response, result, t.assignment, typing)
+		draft.clear()
+		cs.chargeBudget(r, userID, t.req.Message, response, result)
+		return false
+	}
+	if err != nil {
+		t.execErr = err
+		if errors.Is(err, ErrLLMUnavailable) {
+			// A stable code lets the client tell an outage from other failures
+			_ = sse.Write(events.Error{Error: err.Error(), Code: events.CodeLLMUnavailable})
+			return false
+		}
+		var formatErr *ResponseFormatError
+		if errors.As(err, &formatErr) {
+			_ = sse.Write(events.Error{
+				Error:            err.Error(),
+				Code:             events.CodeInvalidResponseFormat,
+				Raw:              formatErr.Raw,
+				ValidationErrors: formatErr.Errors,
+			})
+			return false
+		}
+		_ = sse.Write(events.Error{Error: err.Error()})
+		return false
+	}
+
+	t.response, t.reasoning, t.result = response, reasoning, result
+	return true
+}
+
+// setSSEHeaders sets the headers of a response streamed with SSE
+func setSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+}
+
+// chatStreamRespond saves the streamed answer, sends the end event and
+// streams follow-up suggestions
+func (cs *ChatServer) chatStreamRespond(t *chatTurn) bool {
+	ctx, r, sessionID, userID := t.ctx, t.r, t.req.SessionID, t.userID
+	response, reasoning, result := t.response, t.reasoning, t.result
+	usageReporter := t.sse.usageReporter
+
+	// Save the complete response to history; reasoning is kept only when configured
+	if cs.GetConfig().LLM.ReasoningMode != ReasoningStore {
+		reasoning = ""
+	}
+	var toolCalls []ToolCallRecord
+	var decisions []sessionpkg.SelectionDecision
+	if result != nil {
+		toolCalls, decisions = result.ToolCalls, result.Decisions
+	}
+	hints := ScanContentHints(response)
+	assistantMsg := sessionpkg.Message{
+		Role:         "assistant",
+		Content:      response,
+		Reasoning:    reasoning,
+		ContentHints: &hints,
+		ToolCalls:    sessionToolCalls(toolCalls),
+		Decisions:    decisions,
+		Usage:        sessionUsage(result),
+		DryRun:       isDryRun(ctx),
+	}
+	stampExperiment(&assistantMsg, t.assignment)
+	msgID, err := t.sm.AppendMessage(sessionID, assistantMsg)
+	if err != nil {
+		log.Printf("Warning: Failed to save answer of session %s: %v", redact.LogID(sessionID), err)
+	}
+	t.sse.draft.clear()
+	t.typing.finish(generationCompleted, msgID)
+	cs.maybeTagSession(userID, sessionID)
+	cs.maybeExtractMemories(userID, sessionID)
+	cs.recordExperimentMessage(t.assignment, time.Since(t.execStart))
+	cs.recordToolCalls(toolCalls)
+	cs.recordSelections(decisions)
+	cs.recordTokenSpend(result)
+	cs.chargeBudget(r, userID, t.req.Message, response, result)
+	cs.recordDatasetSample(userID, dataset.Record{
+		MessageID:  msgID,
+		SessionID:  sessionID,
+		Parameters: map[string]any{"enable_skills": t.req.UserSettings.EnableSkills, "enable_mcp": t.req.UserSettings.EnableMCP, "stream": true, "dry_run": isDryRun(ctx)},
+		Prompt:     t.req.Message,
+		Response:   response,
+		LatencyMs:  time.Since(t.execStart).Milliseconds(),
+	}, toolCalls, t.assignment)
+
+	// Send end event; content hints let the client load only the renderers it needs
+	end := events.End{
+		Message:            response,
+		MessageID:          msgID,
+		Seq:                t.sm.MessageSeq(sessionID, msgID),
+		ContentHints:       hints,
+		PersistenceWarning: persistenceWarningFor(t.sm, sessionID),
+		Degraded:           t.degraded,
+		Replaced:           t.replaced,
+	}
+	if t.req.Debug {
+		end.Decisions = decisions
+		if end.Decisions == nil {
+			end.Decisions = []sessionpkg.SelectionDecision{}
+		}
+	}
+	if usageReporter != nil {
+		// Final numbers come from the provider when it reports them
+		var turnUsage usage.Usage
+		if result != nil {
+			turnUsage = result.Usage
+		} else {
+			turnUsage = usage.Usage{CompletionTokens: usageReporter.counter.Tokens(), Estimated: true}
+			turnUsage.TotalTokens = turnUsage.CompletionTokens
+		}
+		turnUsage = usageReporter.final(turnUsage)
+		end.Usage = &turnUsage
+	}
+	_ = t.sse.events.Write(end)
+
+	// Follow-up suggestions come after the end event so they never delay the answer
+	cs.streamSuggestions(r.Context(), userID, sessionID, msgID, t.req.Message, response, t.sse.events)
+	return true
+}
@@ -0,0 +1,404 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// syncBuffer is a buffer the logger and the test may use concurrently
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLog sends the standard logger through the log policy into a buffer
+// until the test ends
+func captureLog(t *testing.T, policy *redact.LogPolicy) *syncBuffer {
+	t.Helper()
+	var buf syncBuffer
+	writer, flags := log.Writer(), log.Flags()
+	redact.SetLogPolicy(policy)
+	log.SetOutput(policy.Writer(&buf))
+	t.Cleanup(func() {
+		log.SetOutput(writer)
+		log.SetFlags(flags)
+		redact.SetLogPolicy(nil)
+	})
+	return &buf
+}
+
+// postChat sends a chat request to the server and returns the response
+func postChat(t *testing.T, cs *ChatServer, body chatRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/chat", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	cs.HandleChat(w, r)
+	return w
+}
+
+func TestChatLogsNoContentWhenRedacted(t *testing.T) {
+	const (
+		message = "my password is hunter2-swordfish"
+		answer  = "noted the confidential-answer"
+		apiKey  = "sk-test-0123456789abcdef"
+	)
+	cs := newTestServer(t)
+	cs.llm = &stubLLM{answer: answer}
+	_, sm := testRequest(cs, http.MethodPost, "/api/chat")
+	session := sm.CreateSession()
+
+	logs := captureLog(t, redact.NewLogPolicy(configpkg.LoggingConfig{
+		Level: "info", ContentDebugOnly: true, HashSessionIDs: true,
+	}, apiKey))
+	for _, stream := range []bool{false, true} {
+		w := postChat(t, cs, chatRequest{SessionID: session.ID, Message: message, Stream: stream})
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "confidential-answer") {
+			t.Fatalf("chat (stream %v) = %d %s", stream, w.Code, w.Body)
+		}
+	}
+	log.Printf("Calling the provider with Authorization: Bearer %s", apiKey)
+
+	output := logs.String()
+	if !strings.Contains(output, "Chat request for session") || !strings.Contains(output, "Chat response for session") {
+		t.Fatalf("chat was not logged:\n%s", output)
+	}
+	for _, secret := range []string{"hunter2", "swordfish", "confidential-answer", session.ID, apiKey} {
+		if strings.Contains(output, secret) {
+			t.Errorf("log contains %q:\n%s", secret, output)
+		}
+	}
+	if !strings.Contains(output, redact.LogID(session.ID)) {
+		t.Errorf("log does not contain the hashed session ID:\n%s", output)
+	}
+}
+
+func TestChatLogsContentAtDebugLevel(t *testing.T) {
+	cs := newTestServer(t)
+	cs.llm = &stubLLM{answer: "a short answer"}
+	_, sm := testRequest(cs, http.MethodPost, "/api/chat")
+	session := sm.CreateSession()
+
+	logs := captureLog(t, redact.NewLogPolicy(configpkg.LoggingConfig{
+		Level: "debug", ContentDebugOnly: true, MaxContentLength: 10,
+	}))
+	if w := postChat(t, cs, chatRequest{SessionID: session.ID, Message: "a rather long question"}); w.Code != http.StatusOK {
+		t.Fatalf("chat = %d %s", w.Code, w.Body)
+	}
+
+	output := logs.String()
+	if !strings.Contains(output, "a rather l... [22 chars]") || strings.Contains(output, "long question") {
+		t.Errorf("message is not logged truncated:\n%s", output)
+	}
+	if !strings.Contains(output, session.ID) {
+		t.Errorf("log does not contain the session ID:\n%s", output)
+	}
+}
+
+// update rewrites the golden files of the chat responses
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with the golden file testdata/name, or rewrites it with -update
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the golden file:\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// pipelineStage returns a stage recording its name in order, which ends the
+// request when it is the name of end
+func pipelineStage(order *[]string, name, end string) chatStage {
+	return chatStage{name: name, run: func(t *chatTurn) bool {
+		*order = append(*order, name)
+		t.onDone(func() { *order = append(*order, "done "+name) })
+		return name != end
+	}}
+}
+
+func TestChatPipelineServe(t *testing.T) {
+	tests := []struct {
+		name, body, end string
+		want            []string
+	}{
+		{"non-streamed", `{}`, "", []string{
+			"validate", "execute", "respond", "done respond", "done execute", "finished", "done validate",
+		}},
+		{"streamed", `{"stream":true}`, "", []string{
+			"validate", "stream execute", "stream respond", "done stream respond", "done stream execute", "finished", "done validate",
+		}},
+		{"ended by a shared stage", `{}`, "validate", []string{"validate", "done validate"}},
+		{"ended by the transport", `{}`, "execute", []string{
+			"validate", "execute", "done execute", "finished", "done validate",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var order []string
+			p := &ChatPipeline{
+				stages: []chatStage{{name: "validate", run: func(turn *chatTurn) bool {
+					order = append(order, "validate")
+					turn.onDone(func() { order = append(order, "done validate") })
+					if err := json.NewDecoder(turn.r.Body).Decode(&turn.req); err != nil {
+						t.Fatalf("Decode: %v", err)
+					}
+					return tt.end != "validate"
+				}}},
+				nonStream: []chatStage{pipelineStage(&order, "execute", tt.end), pipelineStage(&order, "respond", tt.end)},
+				stream:    []chatStage{pipelineStage(&order, "stream execute", tt.end), pipelineStage(&order, "stream respond", tt.end)},
+				finished:  func(*chatTurn) { order = append(order, "finished") },
+			}
+			p.Serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(tt.body)))
+			if !slices.Equal(order, tt.want) {
+				t.Fatalf("order = %q, want %q", order, tt.want)
+			}
+		})
+	}
+}
+
+// runStage runs a stage of the pipeline of cs on a request with body and
+// returns whether the request went on, with the response so far
+func runStage(t *testing.T, cs *ChatServer, stage func(*chatTurn) bool, turn *chatTurn, body string) (bool, *httptest.ResponseRecorder) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	turn.w = w
+	if turn.r == nil {
+		turn.r = httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(body))
+	}
+	ok := stage(turn)
+	turn.finish(0)
+	return ok, w
+}
+
+func TestChatValidate(t *testing.T) {
+	const sessionID = "7d444840-9dc0-11d1-b245-5ffdce74fad2"
+	cs := newTestServer(t)
+	tests := []struct {
+		name, body string
+		wantCode   int
+		wantBody   string
+	}{
+		{"invalid JSON", `{"session_id":`, http.StatusBadRequest, "Invalid request body\n"},
+		{"missing message", `{"session_id":"s1"}`, http.StatusBadRequest, "session_id and message are required\n"},
+		{"missing session", `{"message":"hi"}`, http.StatusBadRequest, "session_id and message are required\n"},
+		{"invalid session ID", `{"session_id":"../etc","message":"hi"}`, http.StatusBadRequest, "Invalid session ID\n"},
+		{"invalid response format", `{"session_id":"` + sessionID + `","message":"hi","response_format":{"type":"xml"}}`, http.StatusBadRequest, "Invalid response_format"},
+		{"valid", `{"session_id":"` + sessionID + `","message":"hi","user_settings":{"enable_skills":true}}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			turn := &chatTurn{}
+			ok, w := runStage(t, cs, cs.chatValidate, turn, tt.body)
+			if ok != (tt.wantCode == http.StatusOK) || w.Code != tt.wantCode || !strings.HasPrefix(w.Body.String(), tt.wantBody) {
+				t.Fatalf("chatValidate = %v, %d %q, want %d %q", ok, w.Code, w.Body, tt.wantCode, tt.wantBody)
+			}
+			if ok && (turn.req.Message != "hi" || !turn.settings.EnableSkills) {
+				t.Fatalf("turn = %+v, want the decoded request and its settings", turn)
+			}
+		})
+	}
+}
+
+func TestChatRateLimit(t *testing.T) {
+	cs := newTestServer(t)
+
+	// A request takes a slot until it ends
+	turn := &chatTurn{r: httptest.NewRequest(http.MethodPost, "/api/chat", nil), w: httptest.NewRecorder()}
+	if !cs.chatRateLimit(turn) || len(cs.requestSem) != 1 {
+		t.Fatalf("chatRateLimit did not take a slot, %d taken", len(cs.requestSem))
+	}
+	turn.finish(0)
+	if len(cs.requestSem) != 0 {
+		t.Fatalf("%d slots taken after the request ended", len(cs.requestSem))
+	}
+
+	for range cap(cs.requestSem) {
+		cs.requestSem <- struct{}{}
+	}
+	if ok, w := runStage(t, cs, cs.chatRateLimit, &chatTurn{}, ""); ok || w.Code != http.StatusTooManyRequests {
+		t.Fatalf("chatRateLimit without a free slot = %v, %d", ok, w.Code)
+	}
+	for range cap(cs.requestSem) {
+		<-cs.requestSem
+	}
+
+	cs.maintenance.enable("upgrading", time.Hour)
+	defer cs.maintenance.disable()
+	if ok, w := runStage(t, cs, cs.chatRateLimit, &chatTurn{}, ""); ok || w.Code != http.StatusServiceUnavailable || len(cs.requestSem) != 0 {
+		t.Fatalf("chatRateLimit in maintenance = %v, %d with %d slots taken", ok, w.Code, len(cs.requestSem))
+	}
+}
+
+func TestChatAuthorize(t *testing.T) {
+	cs := newTestServer(t)
+	r, sm := testRequest(cs, http.MethodPost, "/api/chat")
+	session := sm.CreateSession()
+	archived := sm.CreateSession()
+	if err := sm.SetSessionArchived(archived.ID, true); err != nil {
+		t.Fatalf("SetSessionArchived: %v", err)
+	}
+
+	tests := []struct {
+		name, sessionID string
+		wantCode        int
+	}{
+		{"own session", session.ID, http.StatusOK},
+		{"unknown session", "7d444840-9dc0-11d1-b245-5ffdce74fad2", http.StatusNotFound},
+		{"archived session", archived.ID, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			turn := &chatTurn{r: r.Clone(r.Context()), req: chatRequest{SessionID: tt.sessionID, Message: "hi"}}
+			ok, w := runStage(t, cs, cs.chatAuthorize, turn, "")
+			if ok != (tt.wantCode == http.StatusOK) || w.Code != tt.wantCode {
+				t.Fatalf("chatAuthorize = %v, %d %s, want %d", ok, w.Code, w.Body, tt.wantCode)
+			}
+			if ok && (turn.session.ID != session.ID || turn.sm != sm) {
+				t.Fatalf("turn has session %+v, want %s of the user", turn.session, session.ID)
+			}
+		})
+	}
+
+	// Another user does not see the session
+	other := httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+	other.Header.Set("X-Forwarded-For", "203.0.113.9")
+	turn := &chatTurn{r: other, req: chatRequest{SessionID: session.ID, Message: "hi"}}
+	if ok, w := runStage(t, cs, cs.chatAuthorize, turn, ""); ok || w.Code != http.StatusNotFound {
+		t.Fatalf("chatAuthorize of another user = %v, %d", ok, w.Code)
+	}
+}
+
+func TestChatPersist(t *testing.T) {
+	cs := newTestServer(t)
+	r, sm := testRequest(cs, http.MethodPost, "/api/chat")
+	session := sm.CreateSession()
+
+	turn := &chatTurn{
+		r: r, sm: sm, userID: cs.getClientID(r), startTime: time.Now(),
+		req:      chatRequest{SessionID: session.ID, Message: "remember this"},
+		settings: sessionpkg.Settings{EnableMCP: true},
+	}
+	if ok, w := runStage(t, cs, cs.chatPersist, turn, ""); !ok {
+		t.Fatalf("chatPersist ended the request: %d %s", w.Code, w.Body)
+	}
+	messages, err := sm.GetMessages(session.ID)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Role != "user" || messages[0].Content != "remember this" ||
+		messages[0].Settings == nil || !messages[0].Settings.EnableMCP {
+		t.Fatalf("messages = %+v, want the user message with its settings", messages)
+	}
+}
+
+// chunkedLLM streams its answer in chunks, after a reasoning chunk
+type chunkedLLM struct {
+	reasoning string
+	chunks    []string
+}
+
+func (m *chunkedLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.StreamingReasoningFunc != nil {
+		if err := opts.StreamingReasoningFunc(ctx, []byte(m.reasoning), nil); err != nil {
+			return nil, err
+		}
+		for _, chunk := range m.chunks {
+			if err := opts.StreamingReasoningFunc(ctx, nil, []byte(chunk)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content: strings.Join(m.chunks, ""), ReasoningContent: m.reasoning,
+	}}}, nil
+}
+
+func (m *chunkedLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// goldenChat chats with a stubbed LLM and returns the response, with the
+// message ID replaced so it matches a golden file
+func goldenChat(t *testing.T, stream bool) string {
+	t.Helper()
+	cs := newTestServer(t)
+	cs.llm = &chunkedLLM{
+		reasoning: "The user greets me.",
+		chunks:    []string{"Hello! ", "Here is `code`", " and a [link](https://example.com)."},
+	}
+	_, sm := testRequest(cs, http.MethodPost, "/api/chat")
+	session := sm.CreateSession()
+
+	w := postChat(t, cs, chatRequest{SessionID: session.ID, Message: "hello", Stream: stream})
+	if w.Code != http.StatusOK {
+		t.Fatalf("chat = %d %s", w.Code, w.Body)
+	}
+	messages, err := sm.GetMessages(session.ID)
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("GetMessages = %d messages, %v", len(messages), err)
+	}
+	header := ""
+	for _, name := range []string{"Content-Type", "Cache-Control"} {
+		header += name + ": " + w.Header().Get(name) + "\n"
+	}
+	return header + "\n" + strings.ReplaceAll(w.Body.String(), messages[1].ID, "MESSAGE_ID")
+}
+
+func TestChatResponseGolden(t *testing.T) {
+	golden(t, "chat_response.golden", goldenChat(t, false))
+}
+
+func TestChatStreamGolden(t *testing.T) {
+	golden(t, "chat_stream.golden", goldenChat(t, true))
+}
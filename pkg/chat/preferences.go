@@ -0,0 +1,44 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// HandleGetPreferences returns the preferences of the current user
+func (cs *ChatServer) HandleGetPreferences(w http.ResponseWriter, r *http.Request) {
+	sm := cs.GetSessionManager(cs.getClientID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sm.Preferences()); err != nil {
+		log.Printf("Warning: Failed to encode preferences response: %v", err)
+	}
+}
+
+// HandleUpdatePreferences updates the preferences of the current user; omitted fields are kept
+func (cs *ChatServer) HandleUpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DatasetOptOut *bool `json:"dataset_opt_out"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sm := cs.GetSessionManager(cs.getClientID(r))
+	preferences := sm.Preferences()
+	if req.DatasetOptOut != nil {
+		preferences.DatasetOptOut = *req.DatasetOptOut
+	}
+	if err := sm.SetPreferences(preferences); err != nil {
+		log.Printf("Failed to save preferences: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(preferences); err != nil {
+		log.Printf("Warning: Failed to encode preferences response: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/smallnest/langchat/pkg/audit"
+	"github.com/smallnest/langchat/pkg/middleware"
+)
+
+// exportPrivacy reports whether an admin export runs in privacy mode. The
+// request may choose with ?privacy=true|false unless the mode is forced by config.
+func (cs *ChatServer) exportPrivacy(r *http.Request) (bool, error) {
+	cfg := cs.GetConfig().Privacy
+	if cfg.Forced {
+		return true, nil
+	}
+
+	v := r.URL.Query().Get("privacy")
+	if v == "" {
+		return cfg.ExportPrivacy, nil
+	}
+	private, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid privacy value %q", v)
+	}
+	return private, nil
+}
+
+// watermarkExport records the requesting admin, time and parameters of an
+// export in the audit log and tags the response with the export ID, so a
+// leaked file can be traced back to its audit entry
+func (cs *ChatServer) watermarkExport(w http.ResponseWriter, r *http.Request, kind string, private bool, details map[string]any) {
+	exportID := uuid.NewString()
+
+	actor := ""
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok {
+		actor = user.Username
+	}
+
+	if details == nil {
+		details = make(map[string]any)
+	}
+	details["export_id"] = exportID
+	details["privacy"] = private
+
+	cs.auditLogger.Log(audit.Event{
+		Timestamp: time.Now().UTC(),
+		Action:    kind + ".export",
+		Actor:     actor,
+		Resource:  kind,
+		Result:    "success",
+		Details:   details,
+	})
+
+	w.Header().Set("X-Export-ID", exportID)
+	w.Header().Set("X-Export-Privacy", strconv.FormatBool(private))
+}
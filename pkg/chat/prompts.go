@@ -0,0 +1,109 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/tmc/langchaingo/tools"
+
+	"github.com/smallnest/langchat/pkg/prompts"
+)
+
+// previewAgent returns an agent whose skills and tools are used to preview prompts
+func (cs *ChatServer) previewAgent() *SimpleChatAgent {
+	cs.agentMu.RLock()
+	defer cs.agentMu.RUnlock()
+
+	if cs.warmupAgent != nil {
+		return cs.warmupAgent
+	}
+	for _, agent := range cs.agents {
+		if simpleAgent, ok := agent.(*SimpleChatAgent); ok {
+			return simpleAgent
+		}
+	}
+	return nil
+}
+
+// reloadPrompts re-reads the prompt templates after a configuration change
+func (cs *ChatServer) reloadPrompts() {
+	dir := cs.configManager.Get().Agent.PromptsDir
+	if err := cs.prompts.Reload(dir); err != nil {
+		log.Printf("Warning: Failed to reload prompt templates, keeping previous ones: %v", err)
+		return
+	}
+	log.Printf("Prompt templates reloaded (dir: %q)", dir)
+}
+
+// HandlePreviewPrompt renders a skill or tool selection prompt without calling the LLM
+func (cs *ChatServer) HandlePreviewPrompt(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Prompt  string `json:"prompt"` // "skill_selection" or "tool_selection"
+		Message string `json:"message"`
+		Skill   string `json:"skill"` // optional: preview tool selection for this skill's tools
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Render with the skills and tools of a live agent, or none
+	data := prompts.SelectionData{Message: req.Message}
+	agent := cs.previewAgent()
+
+	var systemName string
+	switch req.Prompt {
+	case prompts.SkillSelection:
+		systemName = prompts.SkillSelectionSystem
+		data.OutputSchema = prompts.SkillSelectionSchema
+		if agent != nil {
+			agent.mu.RLock()
+			data.Items = agent.skillItems()
+			agent.mu.RUnlock()
+		}
+	case prompts.ToolSelection:
+		systemName = prompts.ToolSelectionSystem
+		data.OutputSchema = prompts.ToolSelectionSchema
+		if agent != nil {
+			var availableTools []tools.Tool
+			if req.Skill != "" {
+				skillTools, err := agent.skillTools(req.Skill)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+				availableTools = skillTools
+			} else {
+				agent.mu.RLock()
+				availableTools = agent.mcpTools
+				agent.mu.RUnlock()
+			}
+			data.Items = toolItems(availableTools)
+		}
+	default:
+		http.Error(w, "prompt must be skill_selection or tool_selection", http.StatusBadRequest)
+		return
+	}
+
+	system, err := cs.prompts.Render(systemName, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user, err := cs.prompts.Render(req.Prompt, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"prompt":      req.Prompt,
+		"prompts_dir": cs.prompts.Dir(),
+		"system":      system,
+		"user":        user,
+	}); err != nil {
+		log.Printf("Failed to encode prompt preview: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"strings"
+)
+
+// Reasoning modes (config.LLM.ReasoningMode)
+const (
+	// ReasoningStream streams reasoning as separate SSE events but does not persist it
+	ReasoningStream = "stream"
+	// ReasoningStore streams reasoning and stores it alongside the assistant message
+	ReasoningStore = "store"
+	// ReasoningDiscard drops reasoning entirely
+	ReasoningDiscard = "discard"
+)
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// thinkSplitter separates inline <think>...</think> blocks from the answer in
+// a stream of chunks. Tags may be split across chunk boundaries, so a possible
+// partial tag at the end of a chunk is held back until the next one arrives.
+type thinkSplitter struct {
+	inThink bool
+	pending string
+}
+
+// Write consumes a chunk and returns the answer and reasoning text it contains
+func (s *thinkSplitter) Write(chunk string) (content, reasoning string) {
+	text := s.pending + chunk
+	s.pending = ""
+
+	var contentBuf, reasoningBuf strings.Builder
+	for text != "" {
+		tag := thinkOpenTag
+		if s.inThink {
+			tag = thinkCloseTag
+		}
+
+		out := &contentBuf
+		if s.inThink {
+			out = &reasoningBuf
+		}
+
+		if i := strings.Index(text, tag); i >= 0 {
+			out.WriteString(text[:i])
+			text = text[i+len(tag):]
+			s.inThink = !s.inThink
+			continue
+		}
+
+		// Hold back a suffix that could be the start of the tag
+		keep := partialTagSuffix(text, tag)
+		out.WriteString(text[:len(text)-keep])
+		s.pending = text[len(text)-keep:]
+		break
+	}
+
+	return contentBuf.String(), reasoningBuf.String()
+}
+
+// Flush returns any text still held back at the end of the stream
+func (s *thinkSplitter) Flush() (content, reasoning string) {
+	pending := s.pending
+	s.pending = ""
+	if s.inThink {
+		return "", pending
+	}
+	return pending, ""
+}
+
+// splitThinking separates inline <think> blocks from a complete response
+func splitThinking(text string) (content, reasoning string) {
+	var s thinkSplitter
+	content, reasoning = s.Write(text)
+	c, r := s.Flush()
+	return strings.TrimSpace(content + c), strings.TrimSpace(reasoning + r)
+}
+
+// partialTagSuffix returns the length of the longest suffix of text that is a prefix of tag
+func partialTagSuffix(text, tag string) int {
+	for n := min(len(tag)-1, len(text)); n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
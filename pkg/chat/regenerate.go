@@ -0,0 +1,75 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+)
+
+// newRegeneratePipeline composes the stages of HandleRegenerate: the edit of
+// the last user message with its own content
+func (cs *ChatServer) newRegeneratePipeline() *ChatPipeline {
+	p := cs.newEditPipeline()
+	for i, stage := range p.stages {
+		switch stage.name {
+		case "validate":
+			p.stages[i].run = cs.regenerateValidate
+		case "edit_target":
+			p.stages[i] = chatStage{name: "regenerate_target", run: cs.regenerateTarget}
+		}
+	}
+	return p
+}
+
+// HandleRegenerate deletes the last answer of a session and streams a new
+// answer to the user message before it. The end event names the deleted
+// answer in replaced.
+func (cs *ChatServer) HandleRegenerate(w http.ResponseWriter, r *http.Request) {
+	cs.regenPipeline.Serve(w, r)
+}
+
+// regenerateValidate decodes the optional body of a regeneration, which takes
+// the settings of a chat request
+func (cs *ChatServer) regenerateValidate(t *chatTurn) bool {
+	var req chatRequest
+	if err := json.NewDecoder(t.r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("Failed to decode request: %v", err)
+		http.Error(t.w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+
+	t.req = req
+	t.req.SessionID = t.r.PathValue("id")
+	t.req.Stream = true
+	if rejectInvalidSessionID(t.w, t.req.SessionID) {
+		return false
+	}
+	return cs.checkChatRequest(t)
+}
+
+// regenerateTarget finds the last user message of the session and the answer
+// after it, which must be the last message
+func (cs *ChatServer) regenerateTarget(t *chatTurn) bool {
+	messages, err := t.sm.GetMessages(t.req.SessionID)
+	if err != nil {
+		http.Error(t.w, err.Error(), messageErrorStatus(err))
+		return false
+	}
+	if len(messages) == 0 || messages[len(messages)-1].Role == "user" {
+		http.Error(t.w, "the last message has no answer to regenerate", http.StatusConflict)
+		return false
+	}
+
+	for i := len(messages) - 2; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			t.editID = messages[i].ID
+			t.req.Message = messages[i].Content
+			t.replaced = messages[len(messages)-1].ID
+			return true
+		}
+	}
+	http.Error(t.w, "the session has no user message to answer", http.StatusConflict)
+	return false
+}
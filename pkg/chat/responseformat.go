@@ -0,0 +1,232 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Types of the response_format of a chat request
+const (
+	ResponseFormatText       = "text"        // no constraint, the default
+	ResponseFormatJSONObject = "json_object" // the answer is a single JSON object
+)
+
+// jsonModeProviders constrain answers to JSON themselves when asked to; for
+// other providers the formatting instruction and validation alone apply
+var jsonModeProviders = map[string]bool{
+	"openai": true,
+	"azure":  true,
+	"ollama": true,
+}
+
+// ResponseFormat constrains the answer of a chat turn
+type ResponseFormat struct {
+	Type   string         `json:"type"`             // ResponseFormatText or ResponseFormatJSONObject
+	Schema map[string]any `json:"schema,omitempty"` // optional JSON Schema the answer must validate against
+}
+
+// ResponseFormatError is returned for an answer that does not conform to the
+// response format of its turn, even after the repair retry
+type ResponseFormatError struct {
+	Raw    string   // the final answer of the model
+	Errors []string // why it does not conform
+}
+
+func (e *ResponseFormatError) Error() string {
+	return "answer does not conform to the response format: " + strings.Join(e.Errors, "; ")
+}
+
+// responseFormat is the compiled response format of a turn
+type responseFormat struct {
+	schema     *jsonschema.Schema // nil without a schema
+	schemaText string             // the schema as JSON, for the formatting instruction
+	native     bool               // the provider's JSON mode is used
+}
+
+// compileResponseFormat checks the response format of a chat request for a
+// provider. It returns nil for unconstrained answers.
+func compileResponseFormat(format *ResponseFormat, provider string) (*responseFormat, error) {
+	if format == nil {
+		return nil, nil
+	}
+	switch format.Type {
+	case "", ResponseFormatText:
+		if format.Schema != nil {
+			return nil, fmt.Errorf("schema requires type %q", ResponseFormatJSONObject)
+		}
+		return nil, nil
+	case ResponseFormatJSONObject:
+	default:
+		return nil, fmt.Errorf("unknown type %q, expected %q or %q", format.Type, ResponseFormatText, ResponseFormatJSONObject)
+	}
+
+	compiled := &responseFormat{native: jsonModeProviders[strings.ToLower(provider)]}
+	if format.Schema == nil {
+		return compiled, nil
+	}
+
+	data, err := json.Marshal(format.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	schemaDoc, err := jsonschema.UnmarshalJSON(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	const url = "response://format.json"
+	if err := compiler.AddResource(url, schemaDoc); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if compiled.schema, err = compiler.Compile(url); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	compiled.schemaText = string(data)
+	return compiled, nil
+}
+
+// responseFormatKey is the context key of the response format of a chat turn
+type responseFormatKey struct{}
+
+// withResponseFormat returns a context in which answers must conform to format; nil adds no constraint
+func withResponseFormat(ctx context.Context, format *responseFormat) context.Context {
+	if format == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, responseFormatKey{}, format)
+}
+
+// responseFormatFrom returns the response format of a chat turn, or nil
+func responseFormatFrom(ctx context.Context) *responseFormat {
+	format, _ := ctx.Value(responseFormatKey{}).(*responseFormat)
+	return format
+}
+
+// instruction is the system message asking the model for a JSON answer. It is
+// sent in native JSON mode as well, which requires the prompt to ask for JSON.
+func (f *responseFormat) instruction() llms.MessageContent {
+	text := "Respond with a single valid JSON object and nothing else: no explanation, no Markdown and no code fences."
+	if f.schemaText != "" {
+		text += " The object must validate against this JSON Schema:\n" + f.schemaText
+	}
+	return llms.MessageContent{
+		Role:  llms.ChatMessageTypeSystem,
+		Parts: []llms.ContentPart{llms.TextPart(text)},
+	}
+}
+
+// conform returns the JSON object of an answer, without surrounding space or
+// a code fence, and why the answer does not conform to the format, if it does not
+func (f *responseFormat) conform(answer string) (string, []string) {
+	text := strings.TrimSpace(answer)
+	if fenced, ok := strings.CutPrefix(text, "```"); ok {
+		if body, ok := strings.CutSuffix(fenced, "```"); ok {
+			// Drop the language of the fence, e.g. ```json
+			if _, rest, ok := strings.Cut(body, "\n"); ok {
+				text = strings.TrimSpace(rest)
+			}
+		}
+	}
+
+	instance, err := jsonschema.UnmarshalJSON(strings.NewReader(text))
+	if err != nil {
+		return text, []string{"not valid JSON: " + err.Error()}
+	}
+	if _, ok := instance.(map[string]any); !ok {
+		return text, []string{"not a JSON object"}
+	}
+	if f.schema == nil {
+		return text, nil
+	}
+
+	err = f.schema.Validate(instance)
+	if err == nil {
+		return text, nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return text, []string{err.Error()}
+	}
+	return text, validationMessages(validationErr.BasicOutput())
+}
+
+// answerMessages returns the messages the answer of a turn is generated
+// from: the history and, for a constrained answer, the formatting
+// instruction. The caller must hold a.mu.
+//
+// The history starts with the system prompt and the memories, which only
+// change with the config and the user's memories, and per-turn instructions
+// such as the formatting one go after it, so the prefix of the prompt stays
+// byte-identical across turns and providers that cache prompt prefixes, like
+// OpenAI, serve it from their cache. The OpenAI client of langchaingo sends
+// no cache-control hints, so the prefix is not marked; the cached tokens the
+// provider reports are recorded in the usage of the turn.
+func (a *SimpleChatAgent) answerMessages(ctx context.Context) []llms.MessageContent {
+	format := responseFormatFrom(ctx)
+	if format == nil {
+		return a.messages
+	}
+	return append(slices.Clip(a.messages), format.instruction())
+}
+
+// conformAnswer checks the answer generated from messages against the
+// response format of the turn. A non-conforming answer is sent back to the
+// model once to be repaired; if that fails too, a *ResponseFormatError is
+// returned. The caller must hold a.mu.
+func (a *SimpleChatAgent) conformAnswer(ctx context.Context, format *responseFormat, messages []llms.MessageContent, answer string) (string, error) {
+	text, problems := format.conform(answer)
+	if len(problems) == 0 {
+		return text, nil
+	}
+	log.Printf("Answer does not conform to the response format, asking for a repair: %s", strings.Join(problems, "; "))
+
+	repair := append(slices.Clip(messages),
+		llms.MessageContent{
+			Role:  llms.ChatMessageTypeAI,
+			Parts: []llms.ContentPart{llms.TextPart(answer)},
+		},
+		llms.MessageContent{
+			Role: llms.ChatMessageTypeHuman,
+			Parts: []llms.ContentPart{llms.TextPart("Your answer does not conform to the required format:\n- " +
+				strings.Join(problems, "\n- ") + "\nReply with only the corrected JSON object.")},
+		},
+	)
+	response, err := a.llm.GenerateContent(ctx, repair, a.answerOptions(ctx)...)
+	if err != nil {
+		return "", fmt.Errorf("LLM call failed: %w", err)
+	}
+	var repaired string
+	if len(response.Choices) > 0 {
+		repaired, _ = splitThinking(response.Choices[0].Content)
+	}
+
+	text, problems = format.conform(repaired)
+	if len(problems) > 0 {
+		return "", &ResponseFormatError{Raw: repaired, Errors: problems}
+	}
+	return text, nil
+}
+
+// writeInvalidResponseFormat fails a chat request whose answer does not
+// conform to its response format, attaching the raw answer
+func writeInvalidResponseFormat(w http.ResponseWriter, formatErr *ResponseFormatError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"error":             "invalid_response_format",
+		"message":           formatErr.Error(),
+		"raw":               formatErr.Raw,
+		"validation_errors": formatErr.Errors,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode response format error: %v", err)
+	}
+}
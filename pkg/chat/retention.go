@@ -0,0 +1,114 @@
+package chat
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/audit"
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// startSessionJanitor deletes stale sessions every retention interval until
+// ctx is done
+func (cs *ChatServer) startSessionJanitor(ctx context.Context, retention configpkg.RetentionConfig) {
+	go func() {
+		ticker := time.NewTicker(retention.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cs.sweepStaleSessions(retention)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// sweepStaleSessions deletes the sessions of all users last updated longer
+// than the retention ago, with their agents, sandboxes and tool counters, or
+// only logs them in a dry run. Users are those with a session manager and
+// those with a stale session in the file store tree, so users who have not
+// signed in since the server started are swept without loading everyone.
+func (cs *ChatServer) sweepStaleSessions(retention configpkg.RetentionConfig) {
+	cutoff := time.Now().Add(-retention.MaxAge)
+
+	cs.smMu.Lock()
+	userIDs := make([]string, 0, len(cs.sessionManagers))
+	for userID := range cs.sessionManagers {
+		userIDs = append(userIDs, userID)
+	}
+	cs.smMu.Unlock()
+	err := sessionpkg.WalkUsers(cs.sessionDir, func(userID string, session *sessionpkg.Session) error {
+		if session.UpdatedAt.Before(cutoff) && !slices.Contains(userIDs, userID) {
+			userIDs = append(userIDs, userID)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to look for stale sessions on disk: %v", err)
+	}
+
+	var deleted, users int
+	for _, userID := range userIDs {
+		sm := cs.GetSessionManager(userID)
+		if retention.DryRun {
+			ids := sm.StaleSessions(cutoff)
+			for _, id := range ids {
+				log.Printf("Retention dry run: would delete session %s of user %s", redact.LogID(id), userID)
+			}
+			deleted += len(ids)
+			users += min(len(ids), 1)
+			continue
+		}
+
+		ids, err := sm.DeleteStaleSessions(cutoff)
+		if err != nil {
+			log.Printf("Warning: Failed to delete stale sessions of user %s: %v", userID, err)
+		}
+		for _, id := range ids {
+			cs.forgetDeletedSession(id)
+		}
+		deleted += len(ids)
+		users += min(len(ids), 1)
+	}
+
+	if retention.DryRun {
+		log.Printf("Retention dry run: would delete %d sessions of %d users last updated before %s", deleted, users, cutoff.Format(time.RFC3339))
+		return
+	}
+	log.Printf("Retention: deleted %d sessions of %d users last updated before %s", deleted, users, cutoff.Format(time.RFC3339))
+	if deleted > 0 {
+		cs.auditLogger.Log(audit.Event{
+			Action:  "sessions.retention",
+			Actor:   "system",
+			Result:  "success",
+			Details: map[string]any{"deleted": deleted, "users": users, "cutoff": cutoff},
+		})
+	}
+}
+
+// forgetDeletedSession closes the agent of a deleted session and removes its
+// sandbox working directory and tool counters
+func (cs *ChatServer) forgetDeletedSession(sessionID string) {
+	cs.agentMu.Lock()
+	agent, ok := cs.agents[sessionID]
+	delete(cs.agents, sessionID)
+	cs.agentMu.Unlock()
+	if simpleAgent, isSimple := agent.(*SimpleChatAgent); ok && isSimple {
+		go func() {
+			if err := simpleAgent.Close(); err != nil {
+				log.Printf("Error closing agent of deleted session %s: %v", redact.LogID(sessionID), err)
+			}
+		}()
+	}
+
+	if err := cs.sandbox.RemoveSession(sessionID); err != nil {
+		log.Printf("Warning: Failed to remove sandbox directory for session %s: %v", redact.LogID(sessionID), err)
+	}
+	cs.forgetToolQuota(sessionID)
+}
@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// Number of sessions returned by a search when the request sets no limit,
+// and the most it may ask for
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// HandleSearchSessions searches the messages of the sessions of the current
+// user for the q query parameter and returns the matching sessions, most
+// recently updated first: at most the limit query parameter, 20 by default
+func (cs *ChatServer) HandleSearchSessions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultSearchLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxSearchLimit {
+			http.Error(w, "limit must be an integer between 1 and "+strconv.Itoa(maxSearchLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	results, err := cs.GetSessionManager(cs.getClientID(r)).Search(query.Get("q"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if results == nil {
+		results = []sessionpkg.SearchResult{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"query":   query.Get("q"),
+		"results": results,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode session search response: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// checkStartupSecurity logs the security checks and, in production, refuses
+// to start when any of them fail unless security.insecure_ok is set
+func checkStartupSecurity(config *configpkg.Config, env configpkg.Environment) error {
+	checks := configpkg.CheckSecurity(config, env)
+	for _, check := range checks {
+		if check.Status != configpkg.CheckPass {
+			log.Printf("Warning: security check %s: %s", check.Name, check.Message)
+		}
+	}
+
+	failed := configpkg.SecurityFailures(checks)
+	if len(failed) == 0 {
+		return nil
+	}
+	if config.Security.InsecureOK {
+		log.Printf("⚠️  Starting in %s with %d failed security checks (insecure_ok is set)", env, len(failed))
+		return nil
+	}
+
+	problems := make([]string, 0, len(failed))
+	for _, check := range failed {
+		problems = append(problems, check.Name+": "+check.Message)
+	}
+	return fmt.Errorf("refusing to start in %s with unsafe settings (use --insecure-ok to override):\n  %s",
+		env, strings.Join(problems, "\n  "))
+}
+
+// HandleSecurityCheck reports the production-hardening checks against the current configuration
+func (cs *ChatServer) HandleSecurityCheck(w http.ResponseWriter, r *http.Request) {
+	config := cs.configManager.Get()
+	// Demo users are only created at startup, so report what actually happened
+	config.Security.DemoUsers = cs.demoUsers
+
+	checks := configpkg.CheckSecurity(config, cs.environment)
+	summary := map[configpkg.CheckStatus]int{}
+	for _, check := range checks {
+		summary[check.Status]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"environment": cs.environment,
+		"passed":      summary[configpkg.CheckFail] == 0,
+		"summary":     summary,
+		"checks":      checks,
+	}); err != nil {
+		log.Printf("Failed to encode security check: %v", err)
+	}
+}
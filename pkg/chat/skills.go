@@ -0,0 +1,364 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/smallnest/langchat/pkg/audit"
+	"github.com/smallnest/langchat/pkg/skills"
+)
+
+// skillsDir returns the directory skills are loaded from and installed into
+func skillsDir() string {
+	if dir := os.Getenv("SKILLS_DIR"); dir != "" {
+		return dir
+	}
+	return "../../testdata/skills"
+}
+
+// hasSkill reports whether the agent knows a skill. The caller must hold a.mu.
+func (a *SimpleChatAgent) hasSkill(name string) bool {
+	for _, skill := range a.skills {
+		if strings.EqualFold(skill.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// skillNames returns the names of the agent's skills
+func (a *SimpleChatAgent) skillNames() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	names := make([]string, 0, len(a.skills))
+	for _, skill := range a.skills {
+		names = append(names, skill.Name)
+	}
+	return names
+}
+
+// AddSkill makes an installed skill version available to the agent. A skill
+// of the same name is swapped for it in one step, leaving the other skills
+// alone; its tools are loaded when the skill is next used.
+func (a *SimpleChatAgent) AddSkill(skill *skills.Skill) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	info := SkillInfo{
+		Name:        skill.Package.Meta.Name,
+		Description: skill.Package.Meta.Description,
+		Version:     skill.Version,
+		Package:     skill.Package,
+	}
+	for i := range a.skills {
+		if strings.EqualFold(a.skills[i].Name, info.Name) {
+			a.skills[i] = info
+			return
+		}
+	}
+	a.skills = append(a.skills, info)
+	a.toolsEnabled = true
+}
+
+// skillVersion returns the active version of a skill. The caller must hold a.mu.
+func (a *SimpleChatAgent) skillVersion(name string) string {
+	for _, skill := range a.skills {
+		if strings.EqualFold(skill.Name, name) {
+			return skill.Version
+		}
+	}
+	return ""
+}
+
+// RemoveSkill unloads a skill and reports whether the agent had it
+func (a *SimpleChatAgent) RemoveSkill(name string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := range a.skills {
+		if strings.EqualFold(a.skills[i].Name, name) {
+			a.skills = append(a.skills[:i], a.skills[i+1:]...)
+			if strings.EqualFold(a.selectedSkill, name) {
+				a.selectedSkill = ""
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// BrokenSkills returns the skill packages of the skills directory that failed
+// to load when the agent last loaded them
+func (a *SimpleChatAgent) BrokenSkills() []skills.BrokenSkill {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return slices.Clone(a.brokenSkills)
+}
+
+// reloadSkills applies a fresh load of the skills directory: loaded skills
+// are added or swapped in and skills that are gone are removed. A skill that
+// is now broken keeps the version the agent already has.
+func (a *SimpleChatAgent) reloadSkills(loaded []*skills.Skill, broken []skills.BrokenSkill) {
+	for _, skill := range loaded {
+		a.AddSkill(skill)
+	}
+	for _, name := range a.skillNames() {
+		gone := !slices.ContainsFunc(loaded, func(skill *skills.Skill) bool {
+			return strings.EqualFold(skill.Package.Meta.Name, name)
+		}) && !slices.ContainsFunc(broken, func(skill skills.BrokenSkill) bool {
+			return strings.EqualFold(skill.Name, name)
+		})
+		if gone {
+			a.RemoveSkill(name)
+		}
+	}
+
+	a.mu.Lock()
+	a.brokenSkills = broken
+	a.mu.Unlock()
+}
+
+// eachAgent calls fn for every live, warmup and pooled agent
+func (cs *ChatServer) eachAgent(fn func(*SimpleChatAgent)) {
+	cs.agentMu.RLock()
+	if cs.warmupAgent != nil {
+		fn(cs.warmupAgent)
+	}
+	for _, agent := range cs.agents {
+		if simpleAgent, ok := agent.(*SimpleChatAgent); ok {
+			fn(simpleAgent)
+		}
+	}
+	cs.agentMu.RUnlock()
+
+	if cs.agentPool != nil {
+		cs.agentPool.each(fn)
+	}
+}
+
+// skillErrorStatus maps skill installation errors to HTTP status codes
+func skillErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, skills.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, skills.ErrExists):
+		return http.StatusConflict
+	case errors.Is(err, skills.ErrNotFound), errors.Is(err, skills.ErrNoVersion):
+		return http.StatusNotFound
+	case errors.Is(err, skills.ErrInvalidPackage), errors.Is(err, skills.ErrChecksumMismatch), errors.Is(err, skills.ErrBadSignature):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HandleInstallSkill installs a skill package and loads it into every agent.
+// The package is a zip archive, either downloaded from the URL of a JSON body
+// {url, sha256, signature} or uploaded as the multipart field "package" with
+// the fields "sha256" and "signature".
+func (cs *ChatServer) HandleInstallSkill(w http.ResponseWriter, r *http.Request) {
+	installer := cs.skillInstaller
+
+	var data []byte
+	var source, checksum, signature string
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = http.MaxBytesReader(w, r.Body, installer.MaxSize()+1<<20)
+		file, _, formErr := r.FormFile("package")
+		if formErr != nil {
+			http.Error(w, "A zip file in the package field is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		source, checksum, signature = "upload", r.FormValue("sha256"), r.FormValue("signature")
+		data, err = installer.ReadPackage(file)
+	} else {
+		var req struct {
+			URL       string `json:"url"`
+			SHA256    string `json:"sha256"`
+			Signature string `json:"signature"` // base64 Ed25519 signature of the package
+		}
+		if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil || req.URL == "" {
+			http.Error(w, "url and sha256 are required", http.StatusBadRequest)
+			return
+		}
+		source, checksum, signature = req.URL, req.SHA256, req.Signature
+		data, err = installer.Download(r.Context(), req.URL)
+	}
+
+	var signed bool
+	var skill *skills.Skill
+	if err == nil {
+		signed, err = installer.Verify(data, checksum, signature)
+	}
+	if err == nil {
+		skill, err = installer.Install(data, checksum)
+	}
+
+	actor := cs.getClientID(r)
+	event := audit.Event{
+		Action:  "skill.install",
+		Actor:   actor,
+		Result:  "success",
+		Details: map[string]any{"source": source, "sha256": checksum, "signed": signed, "size": len(data)},
+	}
+	if skill != nil {
+		event.Resource = skill.Package.Meta.Name
+		event.Details["version"] = skill.Version
+	}
+	if err != nil {
+		event.Result = "failure"
+		event.Details["error"] = err.Error()
+	}
+	cs.auditLogger.Log(event)
+	if err != nil {
+		log.Printf("Skill installation from %s failed: %v", source, err)
+		http.Error(w, err.Error(), skillErrorStatus(err))
+		return
+	}
+
+	cs.eachAgent(func(agent *SimpleChatAgent) { agent.AddSkill(skill) })
+	log.Printf("🧩 Skill '%s' version %s installed from %s by %s", skill.Package.Meta.Name, skill.Version, source, actor)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"name":        skill.Package.Meta.Name,
+		"description": skill.Package.Meta.Description,
+		"version":     skill.Version,
+		"signed":      signed,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode skill install response: %v", err)
+	}
+}
+
+// HandleReloadSkills loads the skills directory again into every agent, for
+// skills copied into it or edited by hand, and reports the skills that were
+// loaded and the ones that are broken, with why
+func (cs *ChatServer) HandleReloadSkills(w http.ResponseWriter, r *http.Request) {
+	loaded, broken, err := skills.Load(skillsDir())
+	event := audit.Event{
+		Action: "skill.reload",
+		Actor:  cs.getClientID(r),
+		Result: "success",
+	}
+	if err != nil {
+		event.Result = "failure"
+		event.Details = map[string]any{"error": err.Error()}
+	} else {
+		event.Details = map[string]any{"loaded": len(loaded), "broken": len(broken)}
+	}
+	cs.auditLogger.Log(event)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	cs.eachAgent(func(agent *SimpleChatAgent) { agent.reloadSkills(loaded, broken) })
+	log.Printf("🧩 Skills reloaded: %d loaded, %d broken", len(loaded), len(broken))
+
+	type loadedSkill struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	report := struct {
+		Loaded []loadedSkill        `json:"loaded"`
+		Broken []skills.BrokenSkill `json:"broken"`
+	}{Loaded: make([]loadedSkill, 0, len(loaded)), Broken: broken}
+	for _, skill := range loaded {
+		report.Loaded = append(report.Loaded, loadedSkill{Name: skill.Package.Meta.Name, Version: skill.Version})
+	}
+	if report.Broken == nil {
+		report.Broken = []skills.BrokenSkill{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Warning: Failed to encode skill reload response: %v", err)
+	}
+}
+
+// HandleDeleteSkill unloads a skill from every agent and removes it from the
+// skills directory
+func (cs *ChatServer) HandleDeleteSkill(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	err := cs.skillInstaller.Remove(name)
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	cs.auditLogger.Log(audit.Event{
+		Action:   "skill.delete",
+		Actor:    cs.getClientID(r),
+		Resource: name,
+		Result:   result,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), skillErrorStatus(err))
+		return
+	}
+
+	cs.eachAgent(func(agent *SimpleChatAgent) { agent.RemoveSkill(name) })
+	log.Printf("🧩 Skill '%s' removed", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRollbackSkill makes another installed version of a skill active in
+// every agent: the version of the optional JSON body {version} or, without
+// one, the version installed before the active one
+func (cs *ChatServer) HandleRollbackSkill(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var req struct {
+		Version string `json:"version"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	skill, previous, err := cs.skillInstaller.Rollback(name, req.Version)
+	event := audit.Event{
+		Action:   "skill.rollback",
+		Actor:    cs.getClientID(r),
+		Resource: name,
+		Result:   "success",
+		Details:  map[string]any{"from": previous},
+	}
+	if skill != nil {
+		event.Details["to"] = skill.Version
+	}
+	if err != nil {
+		event.Result = "failure"
+		event.Details["error"] = err.Error()
+	}
+	cs.auditLogger.Log(event)
+	if err != nil {
+		http.Error(w, err.Error(), skillErrorStatus(err))
+		return
+	}
+
+	cs.eachAgent(func(agent *SimpleChatAgent) { agent.AddSkill(skill) })
+	log.Printf("🧩 Skill '%s' rolled back from version %s to %s", name, previous, skill.Version)
+
+	versions, _, err := cs.skillInstaller.Versions(name)
+	if err != nil {
+		log.Printf("Warning: Failed to list versions of skill %s: %v", name, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"name":     skill.Package.Meta.Name,
+		"version":  skill.Version,
+		"previous": previous,
+		"versions": versions,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode skill rollback response: %v", err)
+	}
+}
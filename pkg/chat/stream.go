@@ -0,0 +1,113 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/smallnest/langchat/pkg/events"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+	"github.com/smallnest/langchat/pkg/usage"
+)
+
+// StreamEventFunc receives structured stream events other than answer chunks,
+// e.g. events.Reasoning or events.ToolError. The handler forwards them as SSE events.
+type StreamEventFunc func(ctx context.Context, event events.Event) error
+
+// StreamResult is the outcome of a streamed chat turn
+type StreamResult struct {
+	Response  string                         // final answer, including tool notices
+	Reasoning string                         // reasoning trace, never part of the history
+	ToolCalls []ToolCallRecord               // tools invoked while answering
+	Decisions []sessionpkg.SelectionDecision // skill and tool selections made while answering
+	Usage     usage.Usage                    // token counts of the final LLM call; cost is left to the caller
+}
+
+// ErrClientDisconnected is returned when a chunk or event of a streamed turn
+// could not be written because the client went away. It wraps
+// context.Canceled, so the aborted LLM call does not count as a provider failure.
+var ErrClientDisconnected = fmt.Errorf("client_disconnect: the client stopped reading the stream: %w", context.Canceled)
+
+// streamSink forwards the chunks and events of a streamed turn. The first
+// write that fails cancels the turn through abort, and every later write
+// fails right away, so generation stops once nobody reads the answer.
+type streamSink struct {
+	onChunk func(context.Context, []byte) error
+	onEvent StreamEventFunc
+	abort   context.CancelCauseFunc
+	err     error // set once the sink is broken
+}
+
+// chunk sends a chunk of the answer
+func (s *streamSink) chunk(ctx context.Context, text string) error {
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.onChunk(ctx, []byte(text)); err != nil {
+		return s.fail(err)
+	}
+	return nil
+}
+
+// event sends a structured event; without an event callback it does nothing
+func (s *streamSink) event(ctx context.Context, event events.Event) error {
+	if s.onEvent == nil {
+		return nil
+	}
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.onEvent(ctx, event); err != nil {
+		return s.fail(err)
+	}
+	return nil
+}
+
+// fail marks the sink as broken and cancels the turn
+func (s *streamSink) fail(err error) error {
+	s.err = fmt.Errorf("%w: %v", ErrClientDisconnected, err)
+	s.abort(s.err)
+	return s.err
+}
+
+// EventStreamer is implemented by agents that report structured events while streaming
+type EventStreamer interface {
+	ChatStreamWithEvents(ctx context.Context, message string, enableSkills bool, enableMCP bool, onChunk func(context.Context, []byte) error, onEvent StreamEventFunc) (*StreamResult, error)
+}
+
+// cachedPromptTokens returns the prompt tokens a provider reports as read
+// from its prompt cache: PromptCachedTokens for OpenAI-compatible APIs,
+// CacheReadInputTokens for Anthropic
+func cachedPromptTokens(info map[string]any) int {
+	if cached, _ := info["PromptCachedTokens"].(int); cached > 0 {
+		return cached
+	}
+	cached, _ := info["CacheReadInputTokens"].(int)
+	return cached
+}
+
+// responseUsage returns the token usage reported by the provider, or an
+// estimate of it when the provider reports none
+func responseUsage(response *llms.ContentResponse, messages []llms.MessageContent, completion string) usage.Usage {
+	if response != nil && len(response.Choices) > 0 {
+		info := response.Choices[0].GenerationInfo
+		prompt, _ := info["PromptTokens"].(int)
+		completionTokens, _ := info["CompletionTokens"].(int)
+		if prompt > 0 || completionTokens > 0 {
+			return usage.Usage{PromptTokens: prompt, CompletionTokens: completionTokens, TotalTokens: prompt + completionTokens, CachedTokens: cachedPromptTokens(info)}
+		}
+	}
+
+	var counter usage.Counter
+	for _, msg := range messages {
+		for _, part := range msg.Parts {
+			if text, ok := part.(llms.TextContent); ok {
+				counter.Add(text.Text)
+			}
+		}
+	}
+	prompt := counter.Tokens()
+	completionTokens := usage.EstimateTokens(completion)
+	return usage.Usage{PromptTokens: prompt, CompletionTokens: completionTokens, TotalTokens: prompt + completionTokens, Estimated: true}
+}
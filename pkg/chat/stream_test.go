@@ -0,0 +1,162 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/smallnest/langchat/pkg/events"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// streamingLLM streams chunk every few milliseconds until the stream function
+// fails or the context is done, then reports the cause of the cancellation
+// of the context on cancelled. Calls without a stream function get chunk as
+// the answer.
+type streamingLLM struct {
+	chunk     string
+	cancelled chan error
+}
+
+func (m *streamingLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.StreamingReasoningFunc == nil {
+		return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: m.chunk}}}, nil
+	}
+
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := opts.StreamingReasoningFunc(ctx, nil, []byte(m.chunk)); err != nil {
+				m.cancelled <- context.Cause(ctx)
+				return nil, err
+			}
+		case <-ctx.Done():
+			m.cancelled <- context.Cause(ctx)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (m *streamingLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// llmCancellation waits for the streaming LLM to be cancelled
+func llmCancellation(t *testing.T, model *streamingLLM) error {
+	t.Helper()
+	select {
+	case cause := <-model.cancelled:
+		return cause
+	case <-time.After(10 * time.Second):
+		t.Fatal("the LLM call went on after the client was gone")
+		return nil
+	}
+}
+
+func TestChatStreamStopsWhenWritesFail(t *testing.T) {
+	model := &streamingLLM{chunk: "word ", cancelled: make(chan error, 1)}
+	agent := &SimpleChatAgent{llm: model}
+
+	written := 0
+	onChunk := func(ctx context.Context, chunk []byte) error {
+		if written == 3 {
+			return errors.New("write: broken pipe")
+		}
+		written++
+		return nil
+	}
+	result, err := agent.ChatStreamWithEvents(context.Background(), "tell me a story", false, false, onChunk, nil)
+	if !errors.Is(err, ErrClientDisconnected) {
+		t.Fatalf("ChatStreamWithEvents = %v, want ErrClientDisconnected", err)
+	}
+	if cause := llmCancellation(t, model); !errors.Is(cause, ErrClientDisconnected) {
+		t.Fatalf("LLM context cancelled with %v, want ErrClientDisconnected", cause)
+	}
+	if result == nil || result.Response != "word word word " {
+		t.Fatalf("partial answer = %+v, want the chunks sent", result)
+	}
+	// The partial answer stays in the context of the conversation
+	last := agent.messages[len(agent.messages)-1]
+	if last.Role != llms.ChatMessageTypeAI || last.Parts[0] != llms.TextPart("word word word ") {
+		t.Fatalf("last agent message = %+v, want the partial answer", last)
+	}
+}
+
+func TestChatStreamClientGoesAway(t *testing.T) {
+	cs := newTestServer(t)
+	model := &streamingLLM{chunk: "word ", cancelled: make(chan error, 1)}
+	cs.llm = model
+	server := httptest.NewServer(http.HandlerFunc(cs.HandleChat))
+	defer server.Close()
+
+	// The requests share the fallback client ID of the same address and agent
+	r := httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	r.Header.Set("User-Agent", "stream-test")
+	sm := cs.GetSessionManager(cs.getClientID(r))
+	session := sm.CreateSession()
+	disconnects := counterValue(t, "agent_errors_total", map[string]string{
+		"session_id": session.ID, "error_type": sessionpkg.TruncatedClientDisconnect,
+	})
+
+	body, err := json.Marshal(chatRequest{SessionID: session.ID, Message: "tell me a story", Stream: true})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header = r.Header.Clone()
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	// Stop reading after the first chunk
+	stream := events.NewReader(resp.Body)
+	for {
+		_, event, err := stream.Next()
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		if _, ok := event.(events.Chunk); ok {
+			break
+		}
+	}
+	resp.Body.Close()
+
+	if cause := llmCancellation(t, model); !errors.Is(cause, context.Canceled) {
+		t.Fatalf("LLM context cancelled with %v, want a cancellation", cause)
+	}
+	// Close waits for the handler, which stores the partial answer
+	server.Close()
+
+	messages, err := sm.GetMessages(session.ID)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	last := messages[len(messages)-1]
+	if last.Role != "assistant" || last.Truncated != sessionpkg.TruncatedClientDisconnect || !strings.HasPrefix(last.Content, "word ") {
+		t.Fatalf("last message = %+v, want the partial answer marked as truncated", last)
+	}
+	if got := counterValue(t, "agent_errors_total", map[string]string{
+		"session_id": session.ID, "error_type": sessionpkg.TruncatedClientDisconnect,
+	}) - disconnects; got != 1 {
+		t.Fatalf("%v client disconnects counted, want 1", got)
+	}
+}
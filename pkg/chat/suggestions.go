@@ -0,0 +1,109 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/smallnest/langchat/pkg/events"
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// suggestionsTimeout bounds the suggestion call after the end event
+const suggestionsTimeout = 10 * time.Second
+
+// maxSuggestionLength is the length in characters above which a suggestion is dropped
+const maxSuggestionLength = 120
+
+// streamSuggestions generates follow-up questions for the last exchange,
+// sends them as a suggestions event and stores them on the answer. It runs
+// after the end event so the answer is never delayed; failures are only logged.
+func (cs *ChatServer) streamSuggestions(ctx context.Context, userID, sessionID, messageID, question, answer string, sse *events.Writer) {
+	if !cs.GetConfig().Suggestions.Enabled || messageID == "" || strings.TrimSpace(answer) == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, suggestionsTimeout)
+	defer cancel()
+
+	suggestions, err := cs.generateSuggestions(ctx, question, answer)
+	if err != nil {
+		log.Printf("Suggestions for session %s failed: %v", redact.LogID(sessionID), err)
+		return
+	}
+	if len(suggestions) == 0 {
+		return
+	}
+
+	if err := sse.Write(events.Suggestions{MessageID: messageID, Suggestions: suggestions}); err != nil {
+		log.Printf("Warning: Failed to send suggestions event: %v", err)
+	}
+	if err := cs.GetSessionManager(userID).SetMessageSuggestions(sessionID, messageID, suggestions); err != nil {
+		log.Printf("Warning: Failed to save suggestions of session %s: %v", redact.LogID(sessionID), err)
+	}
+}
+
+// generateSuggestions asks the LLM for short follow-up questions a user may
+// ask after an exchange
+func (cs *ChatServer) generateSuggestions(ctx context.Context, question, answer string) ([]string, error) {
+	cfg := cs.GetConfig().Suggestions
+	maxSuggestions := cfg.Max
+	if maxSuggestions <= 0 {
+		maxSuggestions = 3
+	}
+
+	// The start of the answer is enough to know what it is about
+	if runes := []rune(answer); len(runes) > 1500 {
+		answer = string(runes[:1500])
+	}
+
+	prompt := fmt.Sprintf(`Suggest up to %d short follow-up questions the user might ask next, based on this exchange.
+Write them in the user's language, from the user's point of view, each under 80 characters.
+
+User: %s
+Assistant: %s
+
+Respond with a JSON array of question strings only, e.g. ["How do I test it?"]. Do NOT use markdown code fences.`, maxSuggestions, question, answer)
+
+	options := []llms.CallOption{llms.WithMaxTokens(128), llms.WithTemperature(0.3)}
+	if cfg.Model != "" {
+		options = append(options, llms.WithModel(cfg.Model))
+	}
+
+	response, err := cs.auxLLM.GenerateContent(ctx, []llms.MessageContent{
+		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextPart(prompt)}},
+	}, options...)
+	if err != nil {
+		return nil, fmt.Errorf("LLM call failed for suggestions: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("no response from LLM")
+	}
+
+	content := strings.TrimSpace(response.Choices[0].Content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.Trim(content, "`\n ")
+
+	var candidates []string
+	if err := json.Unmarshal([]byte(content), &candidates); err != nil {
+		return nil, fmt.Errorf("failed to parse suggestions: %w", err)
+	}
+
+	suggestions := make([]string, 0, maxSuggestions)
+	for _, suggestion := range candidates {
+		suggestion = strings.TrimSpace(suggestion)
+		if suggestion == "" || len([]rune(suggestion)) > maxSuggestionLength {
+			continue
+		}
+		suggestions = append(suggestions, suggestion)
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,140 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// taggingTimeout bounds a single tagging call
+const taggingTimeout = 20 * time.Second
+
+// maybeTagSession tags a session in the background every config.Tagging.Every
+// messages. It never blocks the caller and skips the run when the server is busy.
+func (cs *ChatServer) maybeTagSession(userID, sessionID string) {
+	cfg := cs.GetConfig().Tagging
+	if !cfg.Enabled || cfg.Every <= 0 {
+		return
+	}
+
+	sm := cs.GetSessionManager(userID)
+	messages, err := sm.GetMessages(sessionID)
+	if err != nil {
+		return
+	}
+	// Synthetic messages such as the greeting are not part of the conversation
+	messages = slices.DeleteFunc(messages, func(msg sessionpkg.Message) bool { return msg.Synthetic })
+	if len(messages) == 0 || len(messages)%cfg.Every != 0 {
+		return
+	}
+
+	// Skip under load: tagging is optional, chat requests are not
+	if len(cs.requestSem) > cap(cs.requestSem)/2 {
+		log.Printf("Skipping auto-tagging of session %s: server busy", redact.LogID(sessionID))
+		return
+	}
+	select {
+	case cs.taggingSem <- struct{}{}:
+	default:
+		log.Printf("Skipping auto-tagging of session %s: tagging already in progress", redact.LogID(sessionID))
+		return
+	}
+
+	go func() {
+		defer func() { <-cs.taggingSem }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), taggingTimeout)
+		defer cancel()
+
+		tags, err := cs.generateTags(ctx, messages)
+		if err != nil {
+			log.Printf("Auto-tagging of session %s failed: %v", redact.LogID(sessionID), err)
+			return
+		}
+		if len(tags) == 0 {
+			return
+		}
+
+		tags, err = sm.SetSessionTags(sessionID, tags)
+		if err != nil {
+			log.Printf("Failed to save tags of session %s: %v", redact.LogID(sessionID), err)
+			return
+		}
+		log.Printf("Session %s tagged: %s", redact.LogID(sessionID), strings.Join(tags, ", "))
+		cs.sessionEvents.publish(userID, SessionEvent{Type: "session_tagged", SessionID: sessionID, Data: tags})
+	}()
+}
+
+// generateTags asks the LLM for topic tags describing a conversation
+func (cs *ChatServer) generateTags(ctx context.Context, messages []sessionpkg.Message) ([]string, error) {
+	cfg := cs.GetConfig().Tagging
+	maxTags := cfg.MaxTags
+	if maxTags <= 0 {
+		maxTags = 3
+	}
+
+	// Only the recent part of the conversation is needed to find its topic
+	var transcript strings.Builder
+	for _, msg := range messages[max(0, len(messages)-cfg.Every):] {
+		content := []rune(msg.Content)
+		if len(content) > 500 {
+			content = content[:500]
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, string(content))
+	}
+
+	vocabulary := "Use short free-form topic tags of one or two words."
+	if len(cfg.Taxonomy) > 0 {
+		vocabulary = "Choose only from these tags: " + strings.Join(cfg.Taxonomy, ", ")
+	}
+
+	prompt := fmt.Sprintf(`Assign up to %d topic tags to the following conversation.
+%s
+
+Conversation:
+%s
+Respond with a JSON array of tag strings only, e.g. ["golang", "testing"]. Do NOT use markdown code fences.`, maxTags, vocabulary, transcript.String())
+
+	options := []llms.CallOption{llms.WithMaxTokens(64), llms.WithTemperature(0)}
+	if cfg.Model != "" {
+		options = append(options, llms.WithModel(cfg.Model))
+	}
+
+	response, err := cs.auxLLM.GenerateContent(ctx, []llms.MessageContent{
+		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextPart(prompt)}},
+	}, options...)
+	if err != nil {
+		return nil, fmt.Errorf("LLM call failed for tagging: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("no response from LLM")
+	}
+
+	content := strings.TrimSpace(response.Choices[0].Content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.Trim(content, "`\n ")
+
+	var tags []string
+	if err := json.Unmarshal([]byte(content), &tags); err != nil {
+		return nil, fmt.Errorf("failed to parse tags: %w", err)
+	}
+
+	tags = sessionpkg.NormalizeTags(tags, 0)
+	if len(cfg.Taxonomy) > 0 {
+		allowed := sessionpkg.NormalizeTags(cfg.Taxonomy, 0)
+		tags = slices.DeleteFunc(tags, func(tag string) bool { return !slices.Contains(allowed, tag) })
+	}
+	if len(tags) > maxTags {
+		tags = tags[:maxTags]
+	}
+	return tags, nil
+}
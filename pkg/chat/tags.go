@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// HandleAddSessionTag adds the tag of the request body to a session. Adding a
+// tag the session already carries changes nothing.
+func (cs *ChatServer) HandleAddSessionTag(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfMaintenance(w) {
+		return
+	}
+
+	var req struct {
+		Tag string `json:"tag"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	sessionID := r.PathValue("id")
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
+
+	userID := cs.getClientID(r)
+	tags, err := cs.GetSessionManager(userID).AddTag(sessionID, req.Tag)
+	if err != nil {
+		http.Error(w, err.Error(), tagErrorStatus(err))
+		return
+	}
+	cs.sessionEvents.publish(userID, SessionEvent{Type: "session_tagged", SessionID: sessionID, Data: tags})
+	writeSessionTags(w, sessionID, tags)
+}
+
+// HandleRemoveSessionTag removes a tag from a session
+func (cs *ChatServer) HandleRemoveSessionTag(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfMaintenance(w) {
+		return
+	}
+
+	sessionID := r.PathValue("id")
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
+
+	userID := cs.getClientID(r)
+	tags, err := cs.GetSessionManager(userID).RemoveTag(sessionID, r.PathValue("tag"))
+	if err != nil {
+		http.Error(w, err.Error(), tagErrorStatus(err))
+		return
+	}
+	cs.sessionEvents.publish(userID, SessionEvent{Type: "session_tagged", SessionID: sessionID, Data: tags})
+	writeSessionTags(w, sessionID, tags)
+}
+
+// writeSessionTags sends the tags of a session after a change
+func writeSessionTags(w http.ResponseWriter, sessionID string, tags []string) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"id":   sessionID,
+		"tags": tags,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode session tags response: %v", err)
+	}
+}
+
+// tagErrorStatus maps errors of adding and removing tags to HTTP status codes
+func tagErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sessionpkg.ErrInvalidTag):
+		return http.StatusBadRequest
+	case errors.Is(err, sessionpkg.ErrTooManyTags):
+		return http.StatusConflict
+	case errors.Is(err, sessionpkg.ErrTagNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, sessionpkg.ErrNotPersisted):
+		return http.StatusInternalServerError
+	default:
+		return sessionLoadStatus(err)
+	}
+}
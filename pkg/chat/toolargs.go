@@ -0,0 +1,281 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// errInvalidToolArgs marks tool arguments rejected by schema validation
+var errInvalidToolArgs = errors.New("invalid arguments")
+
+// compileToolSchema returns the compiled parameter schema of a tool, or nil if
+// the tool has no usable schema. The caller must hold a.mu.
+func (a *SimpleChatAgent) compileToolSchema(name string) (*jsonschema.Schema, map[string]any) {
+	raw, ok := a.toolSchemas[name]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	// Schemas come from skills and MCP servers in various Go types; normalize via JSON
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil || len(doc) == 0 {
+		return nil, nil
+	}
+
+	if compiled, ok := a.compiledSchemas[name]; ok {
+		return compiled, doc
+	}
+
+	schemaDoc, err := jsonschema.UnmarshalJSON(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, nil
+	}
+	compiler := jsonschema.NewCompiler()
+	url := "tool://" + name + ".json"
+	if err := compiler.AddResource(url, schemaDoc); err != nil {
+		log.Printf("Warning: Invalid parameter schema for tool %s: %v", name, err)
+		return nil, nil
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		log.Printf("Warning: Invalid parameter schema for tool %s: %v", name, err)
+		compiled = nil
+	}
+
+	if a.compiledSchemas == nil {
+		a.compiledSchemas = make(map[string]*jsonschema.Schema)
+	}
+	a.compiledSchemas[name] = compiled
+	return compiled, doc
+}
+
+// bareArgKey holds tool arguments that are not a JSON object, such as the
+// bare string taken by a tool whose schema is a string
+const bareArgKey = "input"
+
+// decodeToolArgs decodes the args of a tool selection decision. They are
+// normally an object; null, an empty value or a missing key give no
+// arguments, and an array or scalar is kept under bareArgKey.
+func decodeToolArgs(raw json.RawMessage) map[string]any {
+	// raw was decoded as part of the decision, so it is valid JSON if set
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]any:
+		return v
+	default:
+		return map[string]any{bareArgKey: v}
+	}
+}
+
+// takesString reports whether a tool's parameter schema is a string rather
+// than an object, so the tool is called with a bare string
+func takesString(doc map[string]any) bool {
+	kind, _ := doc["type"].(string)
+	return kind == "string"
+}
+
+// bareToolArg returns the bare string input of a tool that takes a string:
+// the only argument, whatever the model named it, as text, "" for none, or
+// the JSON of several arguments
+func bareToolArg(args map[string]any) string {
+	switch len(args) {
+	case 0:
+		return ""
+	case 1:
+		for _, value := range args {
+			if s, ok := value.(string); ok {
+				return s
+			}
+			data, _ := json.Marshal(value)
+			return string(data)
+		}
+	}
+	data, _ := json.Marshal(args)
+	return string(data)
+}
+
+// toolInput returns the input a tool is called with for args: their JSON
+// object, "{}" without arguments, or the bare string for a tool that takes
+// one. The caller must hold a.mu.
+func (a *SimpleChatAgent) toolInput(name string, args map[string]any) string {
+	if _, doc := a.compileToolSchema(name); takesString(doc) {
+		return bareToolArg(args)
+	}
+	if len(args) == 0 {
+		return "{}"
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// validateToolArgs coerces obvious type mismatches in args and validates them
+// against the tool's parameter schema. It returns the (possibly coerced)
+// arguments, a description of each coercion and any validation errors.
+func (a *SimpleChatAgent) validateToolArgs(name string, args map[string]any) (map[string]any, []string, []string) {
+	compiled, doc := a.compileToolSchema(name)
+	if compiled == nil {
+		return args, nil, nil
+	}
+
+	if takesString(doc) {
+		// The tool is called with the bare string, see toolInput
+		if err := compiled.Validate(bareToolArg(args)); err != nil {
+			return args, nil, schemaErrors(err)
+		}
+		return args, nil, nil
+	}
+
+	if args == nil {
+		args = map[string]any{}
+	}
+
+	var coercions []string
+	coerced, _ := coerceValue("", args, doc, &coercions).(map[string]any)
+	if coerced == nil {
+		coerced = args
+	}
+
+	// Round-trip through JSON so the validator sees the same values the tool will
+	data, err := json.Marshal(coerced)
+	if err != nil {
+		return coerced, coercions, []string{err.Error()}
+	}
+	instance, err := jsonschema.UnmarshalJSON(strings.NewReader(string(data)))
+	if err != nil {
+		return coerced, coercions, []string{err.Error()}
+	}
+
+	if err := compiled.Validate(instance); err != nil {
+		return coerced, coercions, schemaErrors(err)
+	}
+	return coerced, coercions, nil
+}
+
+// schemaErrors returns the messages of a schema validation error
+func schemaErrors(err error) []string {
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []string{err.Error()}
+	}
+	return validationMessages(validationErr.BasicOutput())
+}
+
+// validationMessages flattens validator output into "location: message" strings
+func validationMessages(output *jsonschema.OutputUnit) []string {
+	var messages []string
+	for _, unit := range output.Errors {
+		if unit.Error == nil {
+			continue
+		}
+		location := unit.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		messages = append(messages, fmt.Sprintf("%s: %s", location, unit.Error.String()))
+	}
+	if len(messages) == 0 && output.Error != nil {
+		messages = append(messages, output.Error.String())
+	}
+	return messages
+}
+
+// coerceValue converts value to the type required by schema when the
+// conversion is unambiguous, e.g. the string "5" for an integer parameter.
+func coerceValue(path string, value any, schema map[string]any, coercions *[]string) any {
+	if schema == nil {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		for key, item := range v {
+			propSchema, _ := properties[key].(map[string]any)
+			v[key] = coerceValue(joinArgPath(path, key), item, propSchema, coercions)
+		}
+		return v
+	case []any:
+		itemSchema, _ := schema["items"].(map[string]any)
+		for i, item := range v {
+			v[i] = coerceValue(fmt.Sprintf("%s[%d]", path, i), item, itemSchema, coercions)
+		}
+		return v
+	}
+
+	// Only coerce when the schema names exactly one type
+	want, ok := schema["type"].(string)
+	if !ok {
+		return value
+	}
+
+	converted, ok := convertScalar(value, want)
+	if !ok {
+		return value
+	}
+	*coercions = append(*coercions, fmt.Sprintf("%s: %T -> %s", path, value, want))
+	return converted
+}
+
+// convertScalar converts a scalar JSON value to the wanted JSON type
+func convertScalar(value any, want string) (any, bool) {
+	switch v := value.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		switch want {
+		case "integer":
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return n, true
+			}
+			if f, err := strconv.ParseFloat(s, 64); err == nil && f == math.Trunc(f) {
+				return int64(f), true
+			}
+		case "number":
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f, true
+			}
+		case "boolean":
+			switch strings.ToLower(s) {
+			case "true":
+				return true, true
+			case "false":
+				return false, true
+			}
+		}
+	case float64:
+		if want == "string" {
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		}
+	case bool:
+		if want == "string" {
+			return strconv.FormatBool(v), true
+		}
+	}
+	return value, false
+}
+
+// joinArgPath appends a property name to an argument path
+func joinArgPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,134 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/tmc/langchaingo/tools"
+)
+
+// Parameter schemas of a tool taking an object and of one taking a bare string
+var (
+	objectSchema = map[string]any{"type": "object", "properties": map[string]any{"query": map[string]any{"type": "string"}}}
+	stringSchema = map[string]any{"type": "string"}
+)
+
+// recordingTool records the input it is called with
+type recordingTool struct {
+	name  string
+	input string
+}
+
+func (t *recordingTool) Name() string        { return t.name }
+func (t *recordingTool) Description() string { return "Records its input" }
+func (t *recordingTool) Call(ctx context.Context, input string) (string, error) {
+	t.input = input
+	return "done", nil
+}
+
+func TestDecodeToolArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision string
+		want     map[string]any
+	}{
+		{"missing", `{"use_tool": true}`, nil},
+		{"null", `{"args": null}`, nil},
+		{"null with whitespace", "{\"args\": null\n}", nil},
+		{"empty object", `{"args": {}}`, map[string]any{}},
+		{"empty string", `{"args": ""}`, map[string]any{bareArgKey: ""}},
+		{"string", `{"args": "weather in Paris"}`, map[string]any{bareArgKey: "weather in Paris"}},
+		{"number", `{"args": 42}`, map[string]any{bareArgKey: 42.0}},
+		{"boolean", `{"args": true}`, map[string]any{bareArgKey: true}},
+		{"array", `{"args": ["a", 1]}`, map[string]any{bareArgKey: []any{"a", 1.0}}},
+		{"object", `{"args": {"query": "go"}}`, map[string]any{"query": "go"}},
+		{"nested object", `{"args": {"filter": {"tags": ["go"], "limit": 5}}}`,
+			map[string]any{"filter": map[string]any{"tags": []any{"go"}, "limit": 5.0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decision struct {
+				Args json.RawMessage `json:"args"`
+			}
+			if err := json.Unmarshal([]byte(tt.decision), &decision); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if got := decodeToolArgs(decision.Args); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("decodeToolArgs(%s) = %#v, want %#v", decision.Args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolInput(t *testing.T) {
+	agent := &SimpleChatAgent{toolSchemas: map[string]any{"search": objectSchema, "shell": stringSchema}}
+	tests := []struct {
+		name       string
+		args       map[string]any
+		wantObject string // input of the tool taking an object, and of a tool without schema
+		wantString string // input of the tool taking a string
+	}{
+		{"none", nil, "{}", ""},
+		{"empty", map[string]any{}, "{}", ""},
+		{"scalar", map[string]any{bareArgKey: "ls -l"}, `{"input":"ls -l"}`, "ls -l"},
+		{"named string", map[string]any{"command": "ls -l"}, `{"command":"ls -l"}`, "ls -l"},
+		{"number", map[string]any{bareArgKey: 42.0}, `{"input":42}`, "42"},
+		{"array", map[string]any{bareArgKey: []any{"a", "b"}}, `{"input":["a","b"]}`, `["a","b"]`},
+		{"object", map[string]any{"query": "go"}, `{"query":"go"}`, "go"},
+		{"several", map[string]any{"a": 1.0, "b": "x"}, `{"a":1,"b":"x"}`, `{"a":1,"b":"x"}`},
+		{"nested object", map[string]any{"filter": map[string]any{"tags": []any{"go"}}}, `{"filter":{"tags":["go"]}}`, `{"tags":["go"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent.mu.Lock()
+			defer agent.mu.Unlock()
+			for tool, want := range map[string]string{"search": tt.wantObject, "unknown": tt.wantObject, "shell": tt.wantString} {
+				if got := agent.toolInput(tool, tt.args); got != want {
+					t.Errorf("toolInput(%s, %v) = %q, want %q", tool, tt.args, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectedArgsReachTheTool(t *testing.T) {
+	cs := newTestServer(t)
+	tests := []struct {
+		name      string
+		schema    map[string]any
+		args      string
+		wantInput string
+	}{
+		{"null for an object", objectSchema, "null", "{}"},
+		{"object", objectSchema, `{"query": "go"}`, `{"query":"go"}`},
+		{"nested object", objectSchema, `{"query": "go", "page": {"size": 10}}`, `{"page":{"size":10},"query":"go"}`},
+		{"null for a string", stringSchema, "null", ""},
+		{"bare string", stringSchema, `"ls -l"`, "ls -l"},
+		{"named string", stringSchema, `{"command": "ls -l"}`, "ls -l"},
+		{"array for a string", stringSchema, `["ls", "-l"]`, `["ls","-l"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs.auxLLM = &stubLLM{answer: `{"use_tool": true, "tool_name": "probe", "args": ` + tt.args + `, "reason": "needed"}`}
+			agent := cs.newAgent()
+			agent.toolSchemas = map[string]any{"probe": tt.schema}
+			tool := &recordingTool{name: "probe"}
+
+			agent.mu.Lock()
+			defer agent.mu.Unlock()
+			selected, args, _, err := agent.selectToolForTask(context.Background(), "run it", []tools.Tool{tool})
+			if err != nil || selected == nil {
+				t.Fatalf("selectToolForTask = %v, %v", selected, err)
+			}
+			record := agent.callTool(context.Background(), "run it", *selected, args, toolHooks{})
+			if record.Failed() || record.Attempts != 1 {
+				t.Fatalf("call failed after %d attempts: %s %v", record.Attempts, record.Error, record.ValidationErrors)
+			}
+			if tool.input != tt.wantInput || record.Args != tt.wantInput {
+				t.Fatalf("tool called with %q, recorded %q, want %q", tool.input, record.Args, tt.wantInput)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/tools"
+
+	"github.com/smallnest/langchat/pkg/faults"
+	"github.com/smallnest/langchat/pkg/sandbox"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// ToolErrorClass classifies why a tool call failed
+type ToolErrorClass string
+
+const (
+	ToolErrorTimeout     ToolErrorClass = "timeout"
+	ToolErrorInvalidArgs ToolErrorClass = "invalid_args"
+	ToolErrorNotFound    ToolErrorClass = "not_found"
+	ToolErrorPermission  ToolErrorClass = "permission"
+	ToolErrorInternal    ToolErrorClass = "internal"
+	ToolErrorQuota       ToolErrorClass = "quota_exceeded"
+	ToolErrorUnavailable ToolErrorClass = "server_unavailable"
+)
+
+// ToolCallRecord describes a single tool invocation made while answering a message
+type ToolCallRecord struct {
+	Tool         string         `json:"tool"`
+	Source       string         `json:"source"`                  // "skill" or "mcp"
+	Skill        string         `json:"skill,omitempty"`         // skill the tool belongs to
+	SkillVersion string         `json:"skill_version,omitempty"` // version of the skill that was active
+	Args         string         `json:"args"`
+	Result       string         `json:"result,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	ErrorClass   ToolErrorClass `json:"error_class,omitempty"`
+	DryRun       bool           `json:"dry_run,omitempty"` // the tool was not executed
+	// Argument schema validation of the last attempt
+	Coercions        []string      `json:"coercions,omitempty"`         // type coercions applied to the args
+	ValidationErrors []string      `json:"validation_errors,omitempty"` // schema violations; the tool was not called
+	Attempts         int           `json:"attempts"`
+	Duration         time.Duration `json:"duration"`
+}
+
+// Failed reports whether the tool call ended in an error
+func (r *ToolCallRecord) Failed() bool {
+	return r.ErrorClass != ""
+}
+
+// ClassifyToolError maps a tool error to a ToolErrorClass
+func ClassifyToolError(err error) ToolErrorClass {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, errToolQuotaExceeded) {
+		return ToolErrorQuota
+	}
+	if errors.Is(err, errMCPServerUnavailable) {
+		return ToolErrorUnavailable
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return ToolErrorTimeout
+	}
+	if errors.Is(err, sandbox.ErrViolation) || errors.Is(err, os.ErrPermission) {
+		return ToolErrorPermission
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.Is(err, errInvalidToolArgs) || errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return ToolErrorInvalidArgs
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return ToolErrorNotFound
+	}
+
+	// Tools from skills and MCP servers often only report plain error strings
+	msg := strings.ToLower(err.Error())
+	switch {
+	case containsAny(msg, "timeout", "timed out", "deadline exceeded"):
+		return ToolErrorTimeout
+	case containsAny(msg, "permission denied", "forbidden", "unauthorized", "access denied", "not allowed"):
+		return ToolErrorPermission
+	case containsAny(msg, "unmarshal", "invalid argument", "invalid param", "missing required", "is required", "required parameter"):
+		return ToolErrorInvalidArgs
+	case containsAny(msg, "not found", "no such file", "does not exist", "unknown tool"):
+		return ToolErrorNotFound
+	default:
+		return ToolErrorInternal
+	}
+}
+
+// containsAny reports whether s contains any of the substrings
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// toolHooks lets the streaming path report tool progress to the client
+type toolHooks struct {
+	decided func(decision sessionpkg.SelectionDecision)
+	start   func(name string)
+	retry   func(name string, err error)
+	done    func(record ToolCallRecord)
+}
+
+// decide reports a skill or tool selection decision of a stage
+func (h toolHooks) decide(stage string, decision sessionpkg.SelectionDecision) {
+	if h.decided == nil || decision.CandidateCount == 0 {
+		return
+	}
+	decision.Stage = stage
+	h.decided(decision)
+}
+
+// useTools selects and calls a skill tool or, failing that, an MCP tool for the
+// message. It returns nil when no tool was selected.
+func (a *SimpleChatAgent) useTools(ctx context.Context, message string, enableSkills, enableMCP bool, hooks toolHooks) *ToolCallRecord {
+	var record *ToolCallRecord
+
+	// Stage 1: Select skill if needed (only if user enables Skills)
+	if enableSkills && len(a.skills) > 0 {
+		selectedSkill, decision, err := a.selectSkillForTask(ctx, message)
+		hooks.decide(sessionpkg.SelectionStageSkill, decision)
+		if err != nil {
+			log.Printf("Skill selection error: %v", err)
+		} else if selectedSkill != "" {
+			// Load tools for the selected skill
+			skillTools, err := a.loadSkillTools(selectedSkill)
+			if err != nil {
+				log.Printf("Failed to load skill tools: %v", err)
+			} else {
+				a.selectedSkill = selectedSkill
+
+				// Stage 2: Select specific tool from the skill
+				tool, args, decision, err := a.selectToolForTask(ctx, message, skillTools)
+				hooks.decide(sessionpkg.SelectionStageSkillTool, decision)
+				if err != nil {
+					log.Printf("Tool selection error: %v", err)
+				} else if tool != nil {
+					rec := a.callTool(ctx, message, *tool, args, hooks)
+					rec.Source = "skill"
+					rec.Skill = selectedSkill
+					rec.SkillVersion = a.skillVersion(selectedSkill)
+					if hooks.done != nil {
+						hooks.done(rec)
+					}
+					if !rec.Failed() {
+						log.Printf("Successfully used tool '%s' from skill '%s'", rec.Tool, selectedSkill)
+						return &rec
+					}
+					record = &rec
+				}
+			}
+		}
+	}
+
+	// If no skill tool succeeded, try MCP tools (only if user enables MCP)
+	if enableMCP && len(a.mcpTools) > 0 {
+		tool, args, decision, err := a.selectToolForTask(ctx, message, a.mcpTools)
+		hooks.decide(sessionpkg.SelectionStageMCPTool, decision)
+		if err != nil {
+			log.Printf("MCP tool selection error: %v", err)
+		} else if tool != nil {
+			rec := a.callTool(ctx, message, *tool, args, hooks)
+			rec.Source = "mcp"
+			if hooks.done != nil {
+				hooks.done(rec)
+			}
+			if !rec.Failed() {
+				log.Printf("Successfully used MCP tool '%s'", rec.Tool)
+			}
+			record = &rec
+		}
+	}
+
+	return record
+}
+
+// callTool validates the arguments against the tool schema, calls the tool and
+// classifies any error. Arguments rejected by validation or by the tool are
+// re-selected once with the errors and schema attached.
+func (a *SimpleChatAgent) callTool(ctx context.Context, message string, tool tools.Tool, args map[string]any, hooks toolHooks) (record ToolCallRecord) {
+	record.Tool = tool.Name()
+	if hooks.start != nil {
+		hooks.start(record.Tool)
+	}
+
+	start := time.Now()
+	defer func() { record.Duration = time.Since(start) }()
+
+	// Corrected retries of a call count as one use of the tool; dry runs do not count
+	dryRun := isDryRun(ctx)
+	if dryRun {
+		record.DryRun = true
+	} else if err := useToolQuota(ctx, record.Tool); err != nil {
+		record.Attempts = 1
+		record.Args = a.toolInput(record.Tool, args)
+		record.Error = err.Error()
+		record.ErrorClass = ToolErrorQuota
+		return record
+	}
+
+	for {
+		record.Attempts++
+
+		args = a.applySessionVariables(ctx, record.Tool, args)
+		var validationErrors []string
+		args, record.Coercions, validationErrors = a.validateToolArgs(record.Tool, args)
+		record.ValidationErrors = validationErrors
+		record.Args = a.toolInput(record.Tool, args)
+		if len(record.Coercions) > 0 {
+			log.Printf("Tool %s arguments coerced: %s", record.Tool, strings.Join(record.Coercions, "; "))
+		}
+
+		var result string
+		var err error
+		if len(validationErrors) > 0 {
+			log.Printf("Tool %s argument validation failed (attempt %d): %s", record.Tool, record.Attempts, strings.Join(validationErrors, "; "))
+			err = fmt.Errorf("%w: %s", errInvalidToolArgs, strings.Join(validationErrors, "; "))
+		} else if dryRun {
+			log.Printf("Tool %s not called (dry run) with args %s", record.Tool, record.Args)
+			record.ErrorClass = ""
+			record.Error = ""
+			return record
+		} else {
+			result, err = faults.CallTool(ctx, tool, record.Args)
+		}
+		if err == nil {
+			record.Result = result
+			record.Error = ""
+			record.ErrorClass = ""
+			return record
+		}
+
+		record.Error = err.Error()
+		record.ErrorClass = ClassifyToolError(err)
+		log.Printf("Tool %s call failed (%s, attempt %d): %v", record.Tool, record.ErrorClass, record.Attempts, err)
+
+		if record.ErrorClass != ToolErrorInvalidArgs || record.Attempts > 1 {
+			return record
+		}
+
+		// Ask the model to correct its arguments, with the schema attached
+		retryMessage := fmt.Sprintf("%s\n\nA previous call to the tool '%s' with arguments %s failed because the arguments were invalid: %v",
+			message, record.Tool, record.Args, err)
+		if schema := a.toolSchema(record.Tool); schema != "" {
+			retryMessage += "\nThe tool expects arguments matching this JSON schema:\n" + schema
+		}
+		retryTool, retryArgs, _, selErr := a.selectToolForTask(ctx, retryMessage, []tools.Tool{tool})
+		if selErr != nil || retryTool == nil {
+			return record
+		}
+
+		if hooks.retry != nil {
+			hooks.retry(record.Tool, err)
+		}
+		args = retryArgs
+	}
+}
+
+// toolSchema returns the JSON schema of a tool's parameters, if known
+func (a *SimpleChatAgent) toolSchema(name string) string {
+	schema, ok := a.toolSchemas[name]
+	if !ok || schema == nil {
+		return ""
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// toolResultMessage builds the system message that feeds a tool outcome back to the model
+func (a *SimpleChatAgent) toolResultMessage(record ToolCallRecord) llms.MessageContent {
+	var text string
+	if record.DryRun && !record.Failed() {
+		text = fmt.Sprintf("The '%s' tool was selected with the arguments %s but not executed, because this is a dry run. "+
+			"Answer without its result, state clearly that the tool was not executed and do not invent what it would have returned.",
+			record.Tool, record.Args)
+	} else if !record.Failed() {
+		text = fmt.Sprintf("I used the '%s' tool to help with your request. Here's the result:\n\n%s", record.Tool, record.Result)
+	} else {
+		text = fmt.Sprintf("The '%s' tool failed and returned no result.\nError class: %s\nError: %s\n\n%s",
+			record.Tool, record.ErrorClass, record.Error, toolErrorGuidance(record.ErrorClass))
+		if record.ErrorClass == ToolErrorInvalidArgs {
+			if schema := a.toolSchema(record.Tool); schema != "" {
+				text += "\nThe tool's parameter schema is:\n" + schema
+			}
+		}
+	}
+
+	return llms.MessageContent{
+		Role:  llms.ChatMessageTypeSystem,
+		Parts: []llms.ContentPart{llms.TextPart(text)},
+	}
+}
+
+// toolErrorGuidance tells the model how to proceed after a failed tool call
+func toolErrorGuidance(class ToolErrorClass) string {
+	switch class {
+	case ToolErrorTimeout:
+		return "The tool did not respond in time. Do not guess what it would have returned; tell the user the tool is currently unavailable."
+	case ToolErrorInvalidArgs:
+		return "The tool rejected its arguments. Do not invent a result; if information needed for the arguments is missing, ask the user for it."
+	case ToolErrorNotFound:
+		return "The requested resource does not exist. Tell the user instead of inventing its content."
+	case ToolErrorPermission:
+		return "The tool is not allowed to perform this action. Explain the restriction to the user."
+	case ToolErrorQuota:
+		return "Quota exceeded, answer without the tool. Do not retry it; if the answer needs its result, tell the user the tool's usage limit was reached."
+	case ToolErrorUnavailable:
+		return "The tool's server is down, so the tool did not run. Do not guess what it would have returned; tell the user the tool is temporarily unavailable."
+	default:
+		return "The tool failed internally. Do not fabricate a result; tell the user the tool failed."
+	}
+}
@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/smallnest/langchat/pkg/sandbox"
+)
+
+// failingTool fails every call with err
+type failingTool struct {
+	err   error
+	calls int
+}
+
+func (t *failingTool) Name() string        { return "fetch" }
+func (t *failingTool) Description() string { return "Fetches a page" }
+func (t *failingTool) Call(ctx context.Context, input string) (string, error) {
+	t.calls++
+	return "", t.err
+}
+
+func TestToolErrorClasses(t *testing.T) {
+	cs := newTestServer(t)
+	// Re-selecting the tool after invalid arguments picks it again
+	cs.auxLLM = &stubLLM{answer: `{"use_tool": true, "tool_name": "fetch", "args": {"url": "https://example.com"}, "reason": "retry"}`}
+	tests := []struct {
+		name         string
+		err          error
+		wantClass    ToolErrorClass
+		wantAttempts int
+		wantGuidance string
+	}{
+		{"deadline", context.DeadlineExceeded, ToolErrorTimeout, 1, "did not respond in time"},
+		{"timeout message", errors.New("request timed out after 30s"), ToolErrorTimeout, 1, "did not respond in time"},
+		{"invalid arguments", fmt.Errorf("%w: url is required", errInvalidToolArgs), ToolErrorInvalidArgs, 2, "rejected its arguments"},
+		{"missing parameter message", errors.New("missing required parameter url"), ToolErrorInvalidArgs, 2, "rejected its arguments"},
+		{"missing file", fmt.Errorf("open page.html: %w", os.ErrNotExist), ToolErrorNotFound, 1, "does not exist"},
+		{"not found message", errors.New("404 page not found"), ToolErrorNotFound, 1, "does not exist"},
+		{"permission", fmt.Errorf("open /etc/shadow: %w", os.ErrPermission), ToolErrorPermission, 1, "not allowed"},
+		{"sandbox violation", fmt.Errorf("%w: path outside the sandbox", sandbox.ErrViolation), ToolErrorPermission, 1, "not allowed"},
+		{"quota", fmt.Errorf("fetch: %w", errToolQuotaExceeded), ToolErrorQuota, 1, "Quota exceeded"},
+		{"server down", fmt.Errorf("fetch: %w", errMCPServerUnavailable), ToolErrorUnavailable, 1, "server is down"},
+		{"internal", errors.New("unexpected EOF"), ToolErrorInternal, 1, "failed internally"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyToolError(tt.err); got != tt.wantClass {
+				t.Fatalf("ClassifyToolError(%v) = %q, want %q", tt.err, got, tt.wantClass)
+			}
+
+			agent := cs.newAgent()
+			tool := &failingTool{err: tt.err}
+			var retried int
+			agent.mu.Lock()
+			record := agent.callTool(context.Background(), "fetch the page", tool, map[string]any{"url": "https://example.com"},
+				toolHooks{retry: func(string, error) { retried++ }})
+			message := agent.toolResultMessage(record)
+			agent.mu.Unlock()
+
+			if record.ErrorClass != tt.wantClass {
+				t.Fatalf("ErrorClass = %q (%s), want %q", record.ErrorClass, record.Error, tt.wantClass)
+			}
+			// Only invalid arguments are re-selected, once
+			if record.Attempts != tt.wantAttempts || tool.calls != tt.wantAttempts || retried != tt.wantAttempts-1 {
+				t.Fatalf("%d attempts, %d calls, %d retries, want %d attempts", record.Attempts, tool.calls, retried, tt.wantAttempts)
+			}
+			text := message.Parts[0].(llms.TextContent).Text
+			if guidance := toolErrorGuidance(tt.wantClass); !strings.Contains(guidance, tt.wantGuidance) || !strings.Contains(text, guidance) {
+				t.Fatalf("tool result message %q, want the guidance %q", text, tt.wantGuidance)
+			}
+		})
+	}
+}
+
+// The guidance of each class is distinct, so the model learns what happened
+func TestToolErrorGuidanceIsDistinct(t *testing.T) {
+	seen := map[string]ToolErrorClass{}
+	for _, class := range []ToolErrorClass{ToolErrorTimeout, ToolErrorInvalidArgs, ToolErrorNotFound, ToolErrorPermission,
+		ToolErrorInternal, ToolErrorQuota, ToolErrorUnavailable} {
+		guidance := toolErrorGuidance(class)
+		if other, ok := seen[guidance]; ok {
+			t.Errorf("%s has the guidance of %s: %q", class, other, guidance)
+		}
+		seen[guidance] = class
+	}
+}
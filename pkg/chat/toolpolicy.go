@@ -0,0 +1,31 @@
+package chat
+
+import (
+	"context"
+	"slices"
+
+	"github.com/tmc/langchaingo/tools"
+)
+
+// toolPolicyKey is the context key of the tools a chat turn may call
+type toolPolicyKey struct{}
+
+// withToolPolicy returns a context in which only the allowed tools are
+// offered to the model; ctx is returned as is when every tool is allowed
+func withToolPolicy(ctx context.Context, allow []string) context.Context {
+	if len(allow) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, toolPolicyKey{}, allow)
+}
+
+// allowedTools returns the tools the turn of ctx may call
+func allowedTools(ctx context.Context, available []tools.Tool) []tools.Tool {
+	allow, _ := ctx.Value(toolPolicyKey{}).([]string)
+	if allow == nil {
+		return available
+	}
+	return slices.DeleteFunc(slices.Clone(available), func(tool tools.Tool) bool {
+		return !slices.Contains(allow, tool.Name())
+	})
+}
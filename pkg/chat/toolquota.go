@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/budget"
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// errToolQuotaExceeded marks a tool call refused by a tool quota
+var errToolQuotaExceeded = errors.New("tool quota exceeded")
+
+// toolQuotaScope is the user, session and tracker the tool calls of a chat
+// turn are counted against
+type toolQuotaScope struct {
+	tracker   *budget.ToolTracker
+	userID    string
+	sessionID string
+}
+
+// toolQuotaKey is the context key of the tool quota scope
+type toolQuotaKey struct{}
+
+// withToolQuota returns a context whose tool calls are counted against the
+// quotas of the user and session; ctx is returned as is when quotas are disabled
+func (cs *ChatServer) withToolQuota(ctx context.Context, userID, sessionID string) context.Context {
+	if cs.toolQuotas == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, toolQuotaKey{}, &toolQuotaScope{tracker: cs.toolQuotas, userID: userID, sessionID: sessionID})
+}
+
+// useToolQuota counts a call of a tool against the quotas of the context and
+// returns an error wrapping errToolQuotaExceeded when a quota is used up
+func useToolQuota(ctx context.Context, tool string) error {
+	scope, _ := ctx.Value(toolQuotaKey{}).(*toolQuotaScope)
+	if scope == nil {
+		return nil
+	}
+
+	decision, err := scope.tracker.Use(scope.userID, scope.sessionID, tool)
+	if err != nil {
+		log.Printf("Warning: Failed to save tool quotas: %v", err)
+	}
+	if decision.Allowed {
+		return nil
+	}
+
+	log.Printf("Tool %s refused for session %s: %s quota of %d calls used up", tool, redact.LogID(scope.sessionID), decision.Scope, decision.Limit)
+	if decision.Scope == budget.ScopeDay {
+		return fmt.Errorf("%w: %s may be called %d times per day, resets at %s", errToolQuotaExceeded, tool, decision.Limit, decision.ResetAt.Format(time.RFC3339))
+	}
+	return fmt.Errorf("%w: %s may be called %d times per session", errToolQuotaExceeded, tool, decision.Limit)
+}
+
+// forgetToolQuota drops the per-session tool counters of a deleted session
+func (cs *ChatServer) forgetToolQuota(sessionID string) {
+	if err := cs.toolQuotas.ForgetSession(sessionID); err != nil {
+		log.Printf("Warning: Failed to save tool quotas: %v", err)
+	}
+}
+
+// HandleGetToolQuotas returns the tool calls per tool and user
+func (cs *ChatServer) HandleGetToolQuotas(w http.ResponseWriter, r *http.Request) {
+	if cs.toolQuotas == nil {
+		http.Error(w, "Tool quotas are disabled", http.StatusNotFound)
+		return
+	}
+
+	quotas := cs.GetConfig().Tools.Quotas
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"timezone": quotas.Timezone,
+		"reset_at": cs.toolQuotas.ResetAt(),
+		"limits":   quotas.Limits,
+		"usage":    cs.toolQuotas.Usage(),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode tool quotas: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of tool loading progress events
+const (
+	toolsEventSkillsParsed     = "skills_parsed"
+	toolsEventSkillToolsLoaded = "skill_tools_loaded"
+	toolsEventMCPConnected     = "mcp_connected"
+	toolsEventMCPDeferred      = "mcp_deferred" // tools offered from the manifest of a lazily started server
+	toolsEventMCPCached        = "mcp_cached"   // tools offered from the cached manifest while the server connects
+	toolsEventDone             = "done"
+	toolsEventError            = "error"
+)
+
+// ToolsEvent reports the progress of loading the tools of an agent
+type ToolsEvent struct {
+	Type   string `json:"type"`             // one of the toolsEvent types
+	Name   string `json:"name,omitempty"`   // skill of skill_tools_loaded
+	Server string `json:"server,omitempty"` // MCP server of mcp_connected, mcp_deferred and mcp_cached
+	Count  int    `json:"count"`            // skills parsed, tools loaded, or all tools when done
+	Error  string `json:"error,omitempty"`
+}
+
+// ToolsProgressFunc receives tool loading progress. It is called from the
+// loading goroutine and must not block.
+type ToolsProgressFunc func(ToolsEvent)
+
+// toolsProgressHub records the progress events of an agent's tool loading
+// and wakes up the streams following it. Streams read the recorded events at
+// their own pace, so a slow client neither blocks loading nor misses events.
+type toolsProgressHub struct {
+	mu      sync.Mutex
+	events  []ToolsEvent
+	waiters map[chan struct{}]struct{}
+}
+
+// reset forgets the events of a previous loading
+func (h *toolsProgressHub) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = nil
+}
+
+// publish records an event and wakes up the waiting streams
+func (h *toolsProgressHub) publish(event ToolsEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.events = append(h.events, event)
+	for ch := range h.waiters {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// Already woken up, the stream reads every new event anyway
+		}
+	}
+}
+
+// subscribe registers a stream to be woken up on new events
+func (h *toolsProgressHub) subscribe() chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.waiters == nil {
+		h.waiters = make(map[chan struct{}]struct{})
+	}
+	ch := make(chan struct{}, 1)
+	h.waiters[ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe removes a stream
+func (h *toolsProgressHub) unsubscribe(ch chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.waiters, ch)
+}
+
+// since returns the events recorded after the first n
+func (h *toolsProgressHub) since(n int) []ToolsEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if n > len(h.events) {
+		// The loading was restarted
+		n = 0
+	}
+	return append([]ToolsEvent(nil), h.events[n:]...)
+}
+
+// mcpServerCounts counts MCP tools by server; tools are named server__tool
+func mcpServerCounts(names []string) map[string]int {
+	counts := make(map[string]int)
+	for _, name := range names {
+		server, _, ok := strings.Cut(name, "__")
+		if !ok {
+			server = ""
+		}
+		counts[server]++
+	}
+	return counts
+}
+
+// HandleToolsEvents streams the tool loading progress of a session's agent
+// using SSE. Events recorded before the client connected are replayed first,
+// and the stream ends after the done event.
+func (cs *ChatServer) HandleToolsEvents(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID == "" {
+		http.Error(w, "session_id is required", http.StatusBadRequest)
+		return
+	}
+	if rejectInvalidSessionID(w, sessionID) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	agent, err := cs.GetOrCreateAgent(sessionID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get agent: %v", err), http.StatusInternalServerError)
+		return
+	}
+	simpleAgent, ok := agent.(*SimpleChatAgent)
+	if !ok {
+		http.Error(w, "Agent does not support tools", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	wake := simpleAgent.toolsProgress.subscribe()
+	defer simpleAgent.toolsProgress.unsubscribe(wake)
+
+	send := func(event ToolsEvent) {
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Warning: Failed to encode tools event: %v", err)
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	}
+
+	// Tools loaded without progress reporting, or never loaded, are done already
+	simpleAgent.mu.RLock()
+	loading := simpleAgent.toolsLoading
+	simpleAgent.mu.RUnlock()
+	if !loading && len(simpleAgent.toolsProgress.since(0)) == 0 {
+		send(ToolsEvent{Type: toolsEventDone, Count: simpleAgent.toolCount()})
+		flusher.Flush()
+		return
+	}
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	var sent int
+	for {
+		events := simpleAgent.toolsProgress.since(sent)
+		if len(events) > 0 {
+			for _, event := range events {
+				send(event)
+				if event.Type == toolsEventDone {
+					flusher.Flush()
+					return
+				}
+			}
+			flusher.Flush()
+			sent += len(events)
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-cs.shutdown:
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-wake:
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package chat
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/events"
+	"github.com/smallnest/langchat/pkg/redact"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// topicScopeInstruction scopes the assistant to the configured topic; it is
+// put before the system prompt
+const topicScopeInstruction = `You only help with the following scope: %s
+Politely decline requests outside this scope, without answering them even partially.`
+
+// maxClassifiedMessage is the length in characters of the part of a message
+// the topic classifier sees
+const maxClassifiedMessage = 2000
+
+// Verdicts of the topic classifier
+const (
+	topicInScope    = "IN"
+	topicOutOfScope = "OUT"
+	topicUnsure     = "UNSURE"
+)
+
+// SetTopicScope puts the instruction to stay within a topic before the
+// system prompt of the following turns; an empty description removes it
+func (a *SimpleChatAgent) SetTopicScope(description string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.topicScope = ""
+	if description = strings.TrimSpace(description); description != "" {
+		a.topicScope = fmt.Sprintf(topicScopeInstruction, description)
+	}
+	a.updateSystemPrompt()
+}
+
+// updateSystemPrompt writes the system prompt of the variant, after the
+// topic scope instruction, to the system message. The caller must hold a.mu.
+func (a *SimpleChatAgent) updateSystemPrompt() {
+	if len(a.messages) == 0 || a.messages[0].Role != llms.ChatMessageTypeSystem {
+		return
+	}
+	prompt := cmp.Or(a.systemPrompt, defaultSystemPrompt)
+	if a.topicScope != "" {
+		prompt = a.topicScope + "\n\n" + prompt
+	}
+	a.messages[0].Parts = []llms.ContentPart{llms.TextPart(prompt)}
+}
+
+// applyTopicScope brings the topic scope in the prompt of an agent up to date
+// with the config, so a reload applies from the next turn
+func (cs *ChatServer) applyTopicScope(agent ChatAgent) {
+	if simpleAgent, ok := agent.(*SimpleChatAgent); ok {
+		simpleAgent.SetTopicScope(cs.GetConfig().Policy.TopicScope.Description)
+	}
+}
+
+// chatTopicScope asks the auxiliary model whether the message is within the
+// topic scope when classification is on. A message clearly out of scope is
+// saved with the refusal as its answer, which ends the turn before an agent
+// generates anything; when the verdict is unsure or the call fails, the turn
+// goes on and the scope instruction of the system prompt applies. Degraded
+// turns are not classified, to spare the extra call.
+func (cs *ChatServer) chatTopicScope(t *chatTurn) bool {
+	scope := cs.GetConfig().Policy.TopicScope
+	if !scope.Classify || strings.TrimSpace(scope.Description) == "" || t.degraded {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(t.r.Context(), scope.ClassifyTimeout)
+	defer cancel()
+	verdict, err := cs.classifyTopic(ctx, scope, t.req.Message)
+	if err != nil {
+		log.Printf("Warning: Topic classification of session %s failed: %v", redact.LogID(t.req.SessionID), err)
+		cs.metricsCollector.RecordTopicCheck("error")
+		return true
+	}
+	if verdict != topicOutOfScope {
+		cs.metricsCollector.RecordTopicCheck("in_scope")
+		return true
+	}
+
+	log.Printf("Refused off-topic message in session %s", redact.LogID(t.req.SessionID))
+	cs.metricsCollector.RecordTopicCheck("refused")
+	if !cs.chatPersist(t) {
+		return false
+	}
+	cs.respondRefusal(t, cmp.Or(scope.Refusal, configpkg.DefaultTopicRefusal))
+	return false
+}
+
+// classifyTopic asks the auxiliary model whether a message is within the
+// scope and returns topicInScope, topicOutOfScope or topicUnsure
+func (cs *ChatServer) classifyTopic(ctx context.Context, scope configpkg.TopicScopeConfig, message string) (string, error) {
+	var examples strings.Builder
+	for _, example := range scope.InScopeExamples {
+		fmt.Fprintf(&examples, "- %s -> %s\n", oneLineExample(example), topicInScope)
+	}
+	for _, example := range scope.OutOfScopeExamples {
+		fmt.Fprintf(&examples, "- %s -> %s\n", oneLineExample(example), topicOutOfScope)
+	}
+	if examples.Len() > 0 {
+		examples.WriteString("\n")
+	}
+
+	if content := []rune(message); len(content) > maxClassifiedMessage {
+		message = string(content[:maxClassifiedMessage])
+	}
+	prompt := fmt.Sprintf(`An assistant only helps with this scope: %s
+
+Decide whether the user message below is within the scope. Answer %s only when it clearly is not, %s when it is, and %s when in doubt, including for greetings and follow-ups.
+
+%sUser message:
+%s
+
+Respond with one word only: %s, %s or %s.`, scope.Description, topicOutOfScope, topicInScope, topicUnsure, examples.String(), message, topicInScope, topicOutOfScope, topicUnsure)
+
+	response, err := cs.auxLLM.GenerateContent(ctx, []llms.MessageContent{
+		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextPart(prompt)}},
+	}, llms.WithMaxTokens(8), llms.WithTemperature(0))
+	if err != nil {
+		return "", fmt.Errorf("LLM call failed for topic classification: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("no response from LLM")
+	}
+
+	verdict := strings.ToUpper(strings.Trim(strings.TrimSpace(response.Choices[0].Content), "`\"'.* "))
+	switch verdict {
+	case topicInScope, topicOutOfScope, topicUnsure:
+		return verdict, nil
+	}
+	return "", fmt.Errorf("unexpected verdict %q", verdict)
+}
+
+// oneLineExample keeps a classifier example on one line of the prompt
+func oneLineExample(example string) string {
+	return strings.Join(strings.Fields(example), " ")
+}
+
+// respondRefusal saves the refusal as the answer of the turn and sends it in
+// the shape of the transport the client asked for
+func (cs *ChatServer) respondRefusal(t *chatTurn, refusal string) {
+	sessionID := t.req.SessionID
+	hints := ScanContentHints(refusal)
+	msgID, err := t.sm.AppendMessage(sessionID, sessionpkg.Message{
+		Role:         "assistant",
+		Content:      refusal,
+		ContentHints: &hints,
+		Refusal:      sessionpkg.RefusalOffTopic,
+		DryRun:       t.req.DryRun,
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to save refusal of session %s: %v", redact.LogID(sessionID), err)
+	}
+	seq := t.sm.MessageSeq(sessionID, msgID)
+	warning := persistenceWarningFor(t.sm, sessionID)
+
+	if t.req.Stream {
+		setSSEHeaders(t.w)
+		sse := events.NewWriter(t.w)
+		_ = sse.Write(events.Start{})
+		_ = sse.Write(events.Chunk{Chunk: refusal})
+		_ = sse.Write(events.End{
+			Message:            refusal,
+			MessageID:          msgID,
+			Seq:                seq,
+			ContentHints:       hints,
+			PersistenceWarning: warning,
+			Refusal:            sessionpkg.RefusalOffTopic,
+			Replaced:           t.replaced,
+		})
+		return
+	}
+
+	responseData := map[string]any{
+		"response":      refusal,
+		"message_id":    msgID,
+		"seq":           seq,
+		"content_hints": hints,
+		"refusal":       sessionpkg.RefusalOffTopic,
+	}
+	if warning != "" {
+		responseData["persistence_warning"] = warning
+	}
+	t.w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(t.w).Encode(responseData); err != nil {
+		log.Printf("Warning: Failed to encode chat response: %v", err)
+	}
+}
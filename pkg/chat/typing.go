@@ -0,0 +1,121 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of a generation reported by generation_finished
+const (
+	generationCompleted = "completed"
+	generationCancelled = "cancelled"
+	generationFailed    = "error"
+)
+
+// generationOutcome returns the outcome of a generation that ended without
+// completing: cancelled if the client went away or the server stopped it, an
+// error otherwise, including timeouts
+func generationOutcome(ctx context.Context) string {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return generationCancelled
+	}
+	return generationFailed
+}
+
+// generationBroadcast publishes the lifecycle of an answer being generated on
+// the session events stream of its user: generation_started, throttled
+// streaming_progress events with the byte count and, if configured, the new
+// text, and a final generation_finished. A nil broadcast publishes nothing.
+type generationBroadcast struct {
+	cs        *ChatServer
+	userID    string
+	sessionID string
+	liveText  bool
+	interval  time.Duration
+
+	mu       sync.Mutex
+	bytes    int
+	pending  strings.Builder // text streamed since the last progress event
+	lastSent time.Time
+	finished bool
+}
+
+// startGeneration announces that an answer is being generated for a session;
+// it returns nil when typing events are disabled
+func (cs *ChatServer) startGeneration(userID, sessionID string) *generationBroadcast {
+	cfg := cs.GetConfig().Typing
+	if !cfg.Enabled {
+		return nil
+	}
+	g := &generationBroadcast{
+		cs:        cs,
+		userID:    userID,
+		sessionID: sessionID,
+		liveText:  cfg.LiveText,
+		interval:  cfg.Interval,
+		lastSent:  time.Now(),
+	}
+	cs.sessionEvents.publish(userID, SessionEvent{Type: "generation_started", SessionID: sessionID})
+	return g
+}
+
+// progress records a streamed chunk and publishes a progress event once the
+// interval since the last one has passed
+func (g *generationBroadcast) progress(chunk string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.finished {
+		return
+	}
+	g.bytes += len(chunk)
+	if g.liveText {
+		g.pending.WriteString(chunk)
+	}
+	if time.Since(g.lastSent) >= g.interval {
+		g.publishProgress()
+	}
+}
+
+// publishProgress publishes the progress so far. The caller must hold g.mu.
+func (g *generationBroadcast) publishProgress() {
+	data := map[string]any{"bytes": g.bytes}
+	if g.liveText {
+		data["text"] = g.pending.String()
+		g.pending.Reset()
+	}
+	g.lastSent = time.Now()
+	g.cs.sessionEvents.publish(g.userID, SessionEvent{Type: "streaming_progress", SessionID: g.sessionID, Data: data})
+}
+
+// finish publishes the outcome of the generation and the stored message, if
+// any. Only the first call has an effect, so it can be deferred as teardown.
+func (g *generationBroadcast) finish(outcome, messageID string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.finished {
+		return
+	}
+	g.finished = true
+	// Viewers showing live text get the rest of it before the end
+	if g.liveText && g.pending.Len() > 0 {
+		g.publishProgress()
+	}
+
+	data := map[string]any{"outcome": outcome, "bytes": g.bytes}
+	if messageID != "" {
+		data["message_id"] = messageID
+		data["seq"] = g.cs.GetSessionManager(g.userID).MessageSeq(g.sessionID, messageID)
+	}
+	g.cs.sessionEvents.publish(g.userID, SessionEvent{Type: "generation_finished", SessionID: g.sessionID, Data: data})
+}
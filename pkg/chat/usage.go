@@ -0,0 +1,56 @@
+package chat
+
+import (
+	"github.com/smallnest/langchat/pkg/usage"
+)
+
+// usageReporter estimates completion tokens and cost while a response streams
+type usageReporter struct {
+	pricing  *usage.Pricing
+	model    string
+	interval int
+	counter  usage.Counter
+	chunks   int
+}
+
+// newUsageReporter returns a reporter for one stream, or nil when usage reporting is disabled
+func (cs *ChatServer) newUsageReporter() *usageReporter {
+	if cs.pricing == nil {
+		return nil
+	}
+	config := cs.GetConfig()
+	interval := config.Usage.EventInterval
+	if interval <= 0 {
+		interval = 10
+	}
+	return &usageReporter{pricing: cs.pricing, model: config.LLM.Model, interval: interval}
+}
+
+// add counts streamed text and reports whether a usage event is due
+func (u *usageReporter) add(text string, chunk bool) bool {
+	u.counter.Add(text)
+	if !chunk {
+		return false
+	}
+	u.chunks++
+	return u.chunks%u.interval == 0
+}
+
+// live returns the running estimate for the usage event
+func (u *usageReporter) live() usage.Usage {
+	tokens := u.counter.Tokens()
+	return usage.Usage{
+		CompletionTokens: tokens,
+		TotalTokens:      tokens,
+		Cost:             u.pricing.Cost(u.model, 0, tokens),
+		Estimated:        true,
+		Model:            u.model,
+	}
+}
+
+// final prices the usage of the finished turn
+func (u *usageReporter) final(result usage.Usage) usage.Usage {
+	result.Model = u.model
+	result.Cost = u.pricing.Cost(u.model, result.PromptTokens, result.CompletionTokens)
+	return result
+}
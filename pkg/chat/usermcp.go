@@ -0,0 +1,367 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	mcpclient "github.com/smallnest/goskills/mcp"
+	"github.com/tmc/langchaingo/tools"
+
+	"github.com/smallnest/langchat/pkg/redact"
+	"github.com/smallnest/langchat/pkg/secrets"
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// mcpServerOptions are the langchat settings of a server in the MCP config,
+// next to the fields read by the MCP client:
+//
+//	"github": {"command": "...", "perUser": true, "secrets": ["GITHUB_TOKEN"]}
+//
+// A per-user server is not shared by the sessions of different users: it is
+// launched for each user with the listed secrets of that user in its
+// environment, and only once the user has set all of them.
+//
+// With lazy MCP startup enabled, a shared server with tools listed in the
+// config is only started when one of them is first called; see lazyMCPTool.
+type mcpServerOptions struct {
+	PerUser bool              `json:"perUser"`
+	Secrets []string          `json:"secrets"`
+	Tools   []mcpToolManifest `json:"tools"`
+}
+
+// mcpConfigFile returns the path of the MCP config
+func mcpConfigFile() string {
+	if path := os.Getenv("MCP_CONFIG_PATH"); path != "" {
+		return path
+	}
+	return "../../testdata/mcp/mcp.json"
+}
+
+// loadMCPConfig loads the MCP config and the langchat options of its servers
+func loadMCPConfig(path string) (*mcpclient.Config, map[string]mcpServerOptions, error) {
+	config, err := mcpclient.LoadConfig(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load MCP config: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load MCP config: %w", err)
+	}
+	var file struct {
+		MCPServers map[string]mcpServerOptions `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("failed to load MCP server options: %w", err)
+	}
+	return config, file.MCPServers, nil
+}
+
+// userMCPClient is the client of the per-user MCP servers of an agent,
+// launched with the secrets of the user owning the agent's session
+type userMCPClient struct {
+	userID string
+	digest string // identifies the servers and sealed secrets launched
+	client *mcpclient.Client
+	tools  []tools.Tool // nil until the servers are connected
+}
+
+// toolList returns the tools of the per-user servers; u may be nil
+func (u *userMCPClient) toolList() []tools.Tool {
+	if u == nil {
+		return nil
+	}
+	return u.tools
+}
+
+// startUserMCP replaces the per-user MCP servers of the agent with those of
+// config, launched for userID. The servers are connected in the background
+// and their tools added once ready; a digest equal to the current one keeps
+// the running servers. An empty config only stops them.
+func (a *SimpleChatAgent) startUserMCP(userID, digest string, config *mcpclient.Config) {
+	a.mu.Lock()
+	if a.userMCP != nil && a.userMCP.digest == digest {
+		a.mu.Unlock()
+		return
+	}
+	previous := a.detachUserMCP()
+	var current *userMCPClient
+	if len(config.MCPServers) > 0 {
+		current = &userMCPClient{userID: userID, digest: digest}
+		a.userMCP = current
+	}
+	a.mu.Unlock()
+
+	if previous != nil {
+		go a.closeUserMCP(previous)
+	}
+	if current == nil {
+		return
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Recovered from per-user MCP initialization panic: %v", r)
+			}
+		}()
+
+		client, tools, schemas, err := a.connectMCP(config)
+		if err != nil || client == nil {
+			if err != nil {
+				log.Printf("Per-user MCP initialization failed for session %s: %v", redact.LogID(a.sessionID), err)
+			}
+			// Try again on the next turn
+			a.mu.Lock()
+			if a.userMCP == current {
+				a.userMCP = nil
+			}
+			a.mu.Unlock()
+			return
+		}
+
+		a.mu.Lock()
+		if a.userMCP != current {
+			// Replaced or stopped while connecting
+			a.mu.Unlock()
+			if err := a.closeMCPClient(client); err != nil {
+				log.Printf("Failed to close per-user MCP client: %v", err)
+			}
+			return
+		}
+		current.client = client
+		current.tools = tools
+		a.mcpTools = append(a.mcpTools, tools...)
+		a.setToolSchemas(schemas)
+		a.toolsEnabled = true
+		a.mu.Unlock()
+		log.Printf("Loaded %d per-user MCP tools for session %s", len(tools), redact.LogID(a.sessionID))
+	}()
+}
+
+// stopUserMCP stops the per-user MCP servers of the agent if they were
+// launched for userID. It reports whether there were any.
+func (a *SimpleChatAgent) stopUserMCP(userID string) bool {
+	a.mu.Lock()
+	if a.userMCP == nil || a.userMCP.userID != userID {
+		a.mu.Unlock()
+		return false
+	}
+	previous := a.detachUserMCP()
+	a.mu.Unlock()
+
+	a.closeUserMCP(previous)
+	return true
+}
+
+// detachUserMCP removes the per-user MCP servers and their tools from the
+// agent and returns them for closing. The caller must hold a.mu.
+func (a *SimpleChatAgent) detachUserMCP() *userMCPClient {
+	previous := a.userMCP
+	if previous == nil {
+		return nil
+	}
+	a.userMCP = nil
+	if len(previous.tools) > 0 {
+		names := make(map[string]bool, len(previous.tools))
+		for _, tool := range previous.tools {
+			names[tool.Name()] = true
+		}
+		a.mcpTools = slices.DeleteFunc(slices.Clone(a.mcpTools), func(tool tools.Tool) bool {
+			return names[tool.Name()]
+		})
+	}
+	return previous
+}
+
+// closeUserMCP closes a detached per-user MCP client
+func (a *SimpleChatAgent) closeUserMCP(u *userMCPClient) {
+	if u.client == nil {
+		return
+	}
+	if err := a.closeMCPClient(u.client); err != nil {
+		log.Printf("Failed to close per-user MCP client: %v", err)
+	}
+}
+
+// applyUserMCP brings the per-user MCP servers of an agent up to date with
+// the secrets of userID, the owner of the agent's session: they are launched
+// on the first turn and relaunched after the user changed a secret they use.
+// Agents without a user, such as warm pool agents, never run them.
+func (cs *ChatServer) applyUserMCP(agent ChatAgent, userID string) {
+	simpleAgent, ok := agent.(*SimpleChatAgent)
+	if !ok {
+		return
+	}
+	config, options, err := loadMCPConfig(mcpConfigFile())
+	if err != nil {
+		// Reported by the agent's own tool loading
+		return
+	}
+
+	sealed := cs.GetSessionManager(userID).SealedSecrets()
+	servers := make(map[string]mcpclient.MCPServer)
+	digest := sha256.New()
+	for _, name := range slices.Sorted(maps.Keys(config.MCPServers)) {
+		opts := options[name]
+		if !opts.PerUser || !hasSecrets(sealed, opts.Secrets) {
+			continue
+		}
+		servers[name] = config.MCPServers[name]
+		fmt.Fprintf(digest, "%s\x00", name)
+		for _, secret := range opts.Secrets {
+			fmt.Fprintf(digest, "%s=%s\x00", secret, sealed[secret])
+		}
+	}
+	sum := hex.EncodeToString(digest.Sum(nil))
+
+	simpleAgent.mu.RLock()
+	current := simpleAgent.userMCP
+	simpleAgent.mu.RUnlock()
+	if (current == nil && len(servers) == 0) || (current != nil && current.digest == sum) {
+		return
+	}
+
+	// Secrets are only opened to launch the servers
+	for name, server := range servers {
+		env := maps.Clone(server.Env)
+		if env == nil {
+			env = make(map[string]string)
+		}
+		for _, secret := range options[name].Secrets {
+			value, err := cs.secrets.Open(secret, sealed[secret])
+			if err != nil {
+				log.Printf("Warning: Not launching MCP server %s for user %s: secret %s: %v", name, redact.LogID(userID), secret, err)
+				env = nil
+				break
+			}
+			env[secret] = value
+		}
+		if env == nil {
+			delete(servers, name)
+			continue
+		}
+		server.Env = env
+		servers[name] = server
+	}
+
+	simpleAgent.startUserMCP(userID, sum, &mcpclient.Config{MCPServers: servers, MaxRetries: config.MaxRetries})
+}
+
+// hasSecrets reports whether all named secrets are set
+func hasSecrets(sealed map[string]string, names []string) bool {
+	for _, name := range names {
+		if _, ok := sealed[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// stopUserMCP stops the per-user MCP servers launched for a user in all
+// agents, so no process keeps running with a secret the user deleted
+func (cs *ChatServer) stopUserMCP(userID string) {
+	cs.agentMu.RLock()
+	agents := slices.Collect(maps.Values(cs.agents))
+	cs.agentMu.RUnlock()
+
+	var stopped int
+	for _, agent := range agents {
+		if simpleAgent, ok := agent.(*SimpleChatAgent); ok && simpleAgent.stopUserMCP(userID) {
+			stopped++
+		}
+	}
+	if stopped > 0 {
+		log.Printf("Stopped per-user MCP servers of %d sessions of user %s", stopped, redact.LogID(userID))
+	}
+}
+
+// secretErrorStatus maps secret errors to HTTP status codes
+func secretErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sessionpkg.ErrSecretNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, sessionpkg.ErrInvalidSecret):
+		return http.StatusBadRequest
+	case errors.Is(err, secrets.ErrDisabled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HandleListSecrets returns the names of the current user's secrets; values
+// are never returned
+func (cs *ChatServer) HandleListSecrets(w http.ResponseWriter, r *http.Request) {
+	names := cs.GetSessionManager(cs.getClientID(r)).SecretNames()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"secrets": names,
+		"enabled": cs.secrets.Enabled(),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode secrets response: %v", err)
+	}
+}
+
+// HandleSetSecret stores a secret of the current user, encrypted with the
+// server's encryption key. The value is the raw request body.
+func (cs *ChatServer) HandleSetSecret(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectUnverified(w, r, featureSecrets) {
+		return
+	}
+	name := r.PathValue("name")
+	if err := sessionpkg.ValidateSecretName(name); err != nil {
+		http.Error(w, err.Error(), secretErrorStatus(err))
+		return
+	}
+
+	value, err := io.ReadAll(io.LimitReader(r.Body, sessionpkg.MaxSecretValueLength+1))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(value) > sessionpkg.MaxSecretValueLength {
+		http.Error(w, fmt.Sprintf("secret is longer than %d bytes", sessionpkg.MaxSecretValueLength), http.StatusRequestEntityTooLarge)
+		return
+	}
+	trimmed := strings.TrimRight(string(value), "\r\n")
+	if trimmed == "" {
+		http.Error(w, "secret value is required", http.StatusBadRequest)
+		return
+	}
+
+	sealed, err := cs.secrets.Seal(name, trimmed)
+	if err != nil {
+		http.Error(w, err.Error(), secretErrorStatus(err))
+		return
+	}
+	if err := cs.GetSessionManager(cs.getClientID(r)).SetSecret(name, sealed); err != nil {
+		http.Error(w, err.Error(), secretErrorStatus(err))
+		return
+	}
+	// Running per-user servers pick up the new value on the next turn
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDeleteSecret wipes a secret of the current user and stops the
+// per-user MCP servers launched with it
+func (cs *ChatServer) HandleDeleteSecret(w http.ResponseWriter, r *http.Request) {
+	userID := cs.getClientID(r)
+	if err := cs.GetSessionManager(userID).DeleteSecret(r.PathValue("name")); err != nil {
+		http.Error(w, err.Error(), secretErrorStatus(err))
+		return
+	}
+	cs.stopUserMCP(userID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,100 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+)
+
+// sessionVariablesKey is the context key of the variables of the session a
+// chat turn belongs to
+type sessionVariablesKey struct{}
+
+// withSessionVariables returns a context carrying session variables for tool calls
+func withSessionVariables(ctx context.Context, variables map[string]string) context.Context {
+	if len(variables) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, sessionVariablesKey{}, variables)
+}
+
+// variableErrorStatus maps variable errors to HTTP status codes
+func variableErrorStatus(err error) int {
+	if errors.Is(err, sessionpkg.ErrInvalidVariable) {
+		return http.StatusBadRequest
+	}
+	return http.StatusNotFound
+}
+
+// expandSessionVariables substitutes the variables of a session in text.
+// Sessions without variables are left alone, so pasted templates using the
+// same syntax do not fail. It writes a 400 response and returns false when
+// text refers to unset variables.
+func expandSessionVariables(w http.ResponseWriter, text string, variables map[string]string) (string, bool) {
+	if len(variables) == 0 {
+		return text, true
+	}
+
+	expanded, err := sessionpkg.ExpandVariables(text, variables)
+	var missing *sessionpkg.MissingVariablesError
+	if errors.As(err, &missing) {
+		writeMissingVariables(w, missing)
+		return "", false
+	}
+	return expanded, true
+}
+
+// writeMissingVariables fails a request referring to unset variables
+func writeMissingVariables(w http.ResponseWriter, missing *sessionpkg.MissingVariablesError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"error":   "missing_variable",
+		"message": missing.Error() + "; set them with PATCH /api/sessions/{id} or escape the placeholder as \\{{name}}",
+		"missing": missing.Names,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode missing variable response: %v", err)
+	}
+}
+
+// applySessionVariables fills the parameters of a tool call that the model
+// left out with the session variables of the same name, if the tool's schema
+// declares them. The caller must hold a.mu.
+func (a *SimpleChatAgent) applySessionVariables(ctx context.Context, name string, args map[string]any) map[string]any {
+	variables, _ := ctx.Value(sessionVariablesKey{}).(map[string]string)
+	if len(variables) == 0 {
+		return args
+	}
+	_, doc := a.compileToolSchema(name)
+	properties, _ := doc["properties"].(map[string]any)
+	if len(properties) == 0 {
+		return args
+	}
+
+	var applied []string
+	for variable, value := range variables {
+		if _, declared := properties[variable]; !declared {
+			continue
+		}
+		if _, set := args[variable]; set {
+			continue
+		}
+		if args == nil {
+			args = map[string]any{}
+		}
+		// Strings are coerced to the declared type by the argument validation
+		args[variable] = value
+		applied = append(applied, variable)
+	}
+	if len(applied) > 0 {
+		slices.Sort(applied)
+		log.Printf("Tool %s arguments defaulted from session variables: %s", name, strings.Join(applied, ", "))
+	}
+	return args
+}
@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Features that can require a verified email, see VerificationConfig.Gate
+const (
+	featureBudget   = "budget"
+	featureSecrets  = "secrets"
+	featureMemories = "memories"
+)
+
+// unverified reports whether a feature requires a verified email and the
+// user of a request has not verified theirs
+func (cs *ChatServer) unverified(r *http.Request, feature string) bool {
+	if !cs.GetConfig().Security.Verification.Gated(feature) {
+		return false
+	}
+	return !cs.authService.EmailVerified(cs.getUserID(r))
+}
+
+// rejectUnverified fails a request with 403 when its feature requires a
+// verified email the user does not have
+func (cs *ChatServer) rejectUnverified(w http.ResponseWriter, r *http.Request, feature string) bool {
+	if !cs.unverified(r, feature) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"error":   "email_not_verified",
+		"message": "verify your email address to use " + feature,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode verification response: %v", err)
+	}
+	return true
+}
+
+// budgetRoles returns the roles the token budget of a request is looked up
+// by: none for an unverified user while budgets are gated, who then gets
+// the default budget
+func (cs *ChatServer) budgetRoles(r *http.Request) []string {
+	if cs.unverified(r, featureBudget) {
+		return nil
+	}
+	return userRoles(r)
+}
@@ -0,0 +1,290 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/smallnest/langchat/pkg/audit"
+	"github.com/smallnest/langchat/pkg/auth"
+	"github.com/smallnest/langchat/pkg/budget"
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/workspace"
+)
+
+// workspaceStats summarizes the use of a workspace for the admin view
+type workspaceStats struct {
+	Members     int   `json:"members"`
+	Sessions    int   `json:"sessions"`     // sessions of the current members
+	TokensToday int64 `json:"tokens_today"` // zero when token budgets are disabled
+	Messages    int64 `json:"messages"`     // over the activity retention period
+}
+
+// requestWorkspace returns the workspace of the user of a request, if they
+// belong to one that exists
+func (cs *ChatServer) requestWorkspace(r *http.Request) (workspace.Workspace, bool) {
+	claims := cs.requestClaims(r)
+	if claims == nil || claims.Workspace == "" {
+		return workspace.Workspace{}, false
+	}
+	return cs.workspaces.Get(claims.Workspace)
+}
+
+// configFor returns the config seen by the user of a request: the active
+// config with the overrides of their workspace applied
+func (cs *ChatServer) configFor(r *http.Request) *configpkg.Config {
+	config := cs.GetConfig()
+	if ws, ok := cs.requestWorkspace(r); ok {
+		return config.WithWorkspace(ws.Overrides)
+	}
+	return config
+}
+
+// budgetLimits returns the token budgets of the user of a request when their
+// workspace overrides them, nil for the configured ones
+func (cs *ChatServer) budgetLimits(r *http.Request) *budget.Limits {
+	ws, ok := cs.requestWorkspace(r)
+	if !ok || ws.Overrides.Budget == nil {
+		return nil
+	}
+	config := cs.GetConfig().WithWorkspace(ws.Overrides).Budget
+	return &budget.Limits{Roles: config.Roles, Default: config.Default}
+}
+
+// rejectIfWorkspacesDisabled answers 404 when workspaces are disabled
+func (cs *ChatServer) rejectIfWorkspacesDisabled(w http.ResponseWriter) bool {
+	if cs.workspaces == nil {
+		http.Error(w, "Workspaces are disabled", http.StatusNotFound)
+		return true
+	}
+	return false
+}
+
+// workspaceErrorStatus maps a workspace store error to an HTTP status
+func workspaceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, workspace.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, workspace.ErrExists):
+		return http.StatusConflict
+	case errors.Is(err, workspace.ErrInvalidID):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// HandleListWorkspaces returns all workspaces with their overrides
+func (cs *ChatServer) HandleListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfWorkspacesDisabled(w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"workspaces": cs.workspaces.List(),
+	}); err != nil {
+		log.Printf("Warning: Failed to encode workspace list: %v", err)
+	}
+}
+
+// HandleCreateWorkspace creates a workspace with an ID, a display name and
+// optional config overrides
+func (cs *ChatServer) HandleCreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfWorkspacesDisabled(w) {
+		return
+	}
+
+	var req struct {
+		ID        string                       `json:"id"`
+		Name      string                       `json:"name"`
+		Overrides configpkg.WorkspaceOverrides `json:"overrides"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		req.Name = req.ID
+	}
+	if err := configpkg.ValidateWorkspaceOverrides(req.Overrides); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	actor := cs.getClientID(r)
+	ws, err := cs.workspaces.Create(req.ID, req.Name, req.Overrides)
+	if err != nil {
+		cs.auditLogger.Log(audit.Event{Action: "workspace.create", Actor: actor, Resource: req.ID, Result: "failure"})
+		http.Error(w, err.Error(), workspaceErrorStatus(err))
+		return
+	}
+	cs.auditLogger.Log(audit.Event{Action: "workspace.create", Actor: actor, Resource: ws.ID, Result: "success"})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(ws); err != nil {
+		log.Printf("Warning: Failed to encode workspace: %v", err)
+	}
+}
+
+// HandleGetWorkspace returns a workspace with its members and usage
+func (cs *ChatServer) HandleGetWorkspace(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfWorkspacesDisabled(w) {
+		return
+	}
+	ws, ok := cs.workspaces.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, workspace.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	members := cs.authService.WorkspaceMembers(ws.ID)
+	infos := make([]*auth.UserInfo, 0, len(members))
+	stats := workspaceStats{Members: len(members)}
+	for _, member := range members {
+		infos = append(infos, member.Info())
+		stats.Sessions += len(cs.GetSessionManager(workspace.UserKey(ws.ID, member.ID)).ListSessions())
+	}
+	// Budgets and activity are counted under the user keys of the workspace,
+	// including those of former members
+	inWorkspace := func(key string) bool {
+		id, _ := workspace.SplitUserKey(key)
+		return id == ws.ID
+	}
+	for _, u := range cs.budget.Users() {
+		if inWorkspace(u.UserID) {
+			stats.TokensToday += u.Used
+		}
+	}
+	for _, u := range cs.activity.Users() {
+		if inWorkspace(u.UserID) {
+			stats.Messages += u.Messages
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"workspace": ws,
+		"members":   infos,
+		"stats":     stats,
+	}); err != nil {
+		log.Printf("Warning: Failed to encode workspace: %v", err)
+	}
+}
+
+// HandleUpdateWorkspace renames a workspace or replaces its overrides; the
+// fields left out of the body are kept
+func (cs *ChatServer) HandleUpdateWorkspace(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfWorkspacesDisabled(w) {
+		return
+	}
+
+	var req struct {
+		Name      *string                       `json:"name"`
+		Overrides *configpkg.WorkspaceOverrides `json:"overrides"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		http.Error(w, "name cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if req.Overrides != nil {
+		if err := configpkg.ValidateWorkspaceOverrides(*req.Overrides); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	id := r.PathValue("id")
+	actor := cs.getClientID(r)
+	ws, err := cs.workspaces.Update(id, req.Name, req.Overrides)
+	if err != nil {
+		cs.auditLogger.Log(audit.Event{Action: "workspace.update", Actor: actor, Resource: id, Result: "failure"})
+		http.Error(w, err.Error(), workspaceErrorStatus(err))
+		return
+	}
+	cs.auditLogger.Log(audit.Event{
+		Action:   "workspace.update",
+		Actor:    actor,
+		Resource: id,
+		Result:   "success",
+		Details:  map[string]any{"name": req.Name != nil, "overrides": req.Overrides != nil},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ws); err != nil {
+		log.Printf("Warning: Failed to encode workspace: %v", err)
+	}
+}
+
+// HandleDeleteWorkspace deletes a workspace without members. The sessions
+// and other state of its former members are kept.
+func (cs *ChatServer) HandleDeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfWorkspacesDisabled(w) {
+		return
+	}
+
+	id := r.PathValue("id")
+	if members := cs.authService.WorkspaceMembers(id); len(members) > 0 {
+		http.Error(w, "workspace still has members", http.StatusConflict)
+		return
+	}
+	actor := cs.getClientID(r)
+	if err := cs.workspaces.Delete(id); err != nil {
+		cs.auditLogger.Log(audit.Event{Action: "workspace.delete", Actor: actor, Resource: id, Result: "failure"})
+		http.Error(w, err.Error(), workspaceErrorStatus(err))
+		return
+	}
+	cs.auditLogger.Log(audit.Event{Action: "workspace.delete", Actor: actor, Resource: id, Result: "success"})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAssignWorkspace moves a user to a workspace, or out of any with an
+// empty workspace. The user's tokens carry their workspace, so the move
+// applies from their next login or token refresh; the state they had before
+// stays under their previous user key.
+func (cs *ChatServer) HandleAssignWorkspace(w http.ResponseWriter, r *http.Request) {
+	if cs.rejectIfWorkspacesDisabled(w) {
+		return
+	}
+
+	var req struct {
+		Workspace string `json:"workspace"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Workspace != "" {
+		if _, ok := cs.workspaces.Get(req.Workspace); !ok {
+			http.Error(w, workspace.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	userID := r.PathValue("id")
+	actor := cs.getClientID(r)
+	user, err := cs.authService.SetUserWorkspace(userID, req.Workspace)
+	if err != nil {
+		cs.auditLogger.Log(audit.Event{Action: "workspace.assign", Actor: actor, Resource: userID, Result: "failure"})
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	cs.auditLogger.Log(audit.Event{
+		Action:   "workspace.assign",
+		Actor:    actor,
+		Resource: userID,
+		Result:   "success",
+		Details:  map[string]any{"workspace": req.Workspace},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(user.Info()); err != nil {
+		log.Printf("Warning: Failed to encode user: %v", err)
+	}
+}
@@ -1,12 +1,19 @@
 package config
 
 import (
+	"cmp"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -54,6 +61,57 @@ type Config struct {
 
 	// Features configuration
 	Features FeaturesConfig `json:"features" yaml:"features"`
+
+	// Tools configuration
+	Tools ToolsConfig `json:"tools" yaml:"tools"`
+
+	// Token usage and cost reporting
+	Usage UsageConfig `json:"usage" yaml:"usage"`
+
+	// Automatic session tagging
+	Tagging TaggingConfig `json:"tagging" yaml:"tagging"`
+
+	// Follow-up question suggestions after each answer
+	Suggestions SuggestionsConfig `json:"suggestions" yaml:"suggestions"`
+
+	// Durable facts about users carried across sessions
+	Memories MemoriesConfig `json:"memories" yaml:"memories"`
+
+	// Generation events for the user's other clients watching a session
+	Typing TypingConfig `json:"typing" yaml:"typing"`
+
+	// Remote skill installation
+	Skills SkillsConfig `json:"skills" yaml:"skills"`
+
+	// Hooks for resilience testing; never enabled in production
+	Testing TestingConfig `json:"testing" yaml:"testing"`
+
+	// Sampled prompt/response logging for offline evaluation
+	Dataset DatasetConfig `json:"dataset" yaml:"dataset"`
+
+	// A/B experiments of prompts and models
+	Experiments []ExperimentConfig `json:"experiments" yaml:"experiments"`
+
+	// Privacy of admin data exports
+	Privacy PrivacyConfig `json:"privacy" yaml:"privacy"`
+
+	// Chat UI content
+	UI UIConfig `json:"ui" yaml:"ui"`
+
+	// Daily token budgets
+	Budget BudgetConfig `json:"budget" yaml:"budget"`
+
+	// Outgoing mail, e.g. email verification links
+	SMTP SMTPConfig `json:"smtp" yaml:"smtp"`
+
+	// Last-seen times and hourly message counts of users
+	Activity ActivityConfig `json:"activity" yaml:"activity"`
+
+	// Limits on what the assistant answers
+	Policy PolicyConfig `json:"policy" yaml:"policy"`
+
+	// Workspaces configuration
+	Workspaces WorkspacesConfig `json:"workspaces" yaml:"workspaces"`
 }
 
 // ServerConfig holds server-related configuration
@@ -64,8 +122,26 @@ type ServerConfig struct {
 	WriteTimeout time.Duration `json:"write_timeout" yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" default:"30s"`
 	IdleTimeout  time.Duration `json:"idle_timeout" yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" default:"120s"`
 	MaxConns     int           `json:"max_conns" yaml:"max_conns" env:"SERVER_MAX_CONNS" default:"1000"`
+	// MaintenanceGrace is how long in-flight chat streams may keep running after maintenance mode is enabled
+	MaintenanceGrace time.Duration `json:"maintenance_grace" yaml:"maintenance_grace" env:"SERVER_MAINTENANCE_GRACE" default:"30s"`
+	// TLS certificate and key; when both are set the server listens with HTTPS
+	TLSCertFile string `json:"tls_cert_file" yaml:"tls_cert_file" env:"SERVER_TLS_CERT_FILE"`
+	TLSKeyFile  string `json:"tls_key_file" yaml:"tls_key_file" env:"SERVER_TLS_KEY_FILE"`
+	// TrustedProxies declares reverse proxies that terminate TLS in front of the server, as IP
+	// addresses or CIDR ranges; only their X-Forwarded-Prefix header sets the "auto" base path
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies" env:"SERVER_TRUSTED_PROXIES"`
+	// PublicURL is the URL users reach the web UI at, including any path prefix, e.g.
+	// https://example.com/chat, for links in emails
+	PublicURL string `json:"public_url" yaml:"public_url" env:"SERVER_PUBLIC_URL"`
+	// BasePath is the path prefix the server is reached under behind a reverse proxy, e.g. /chat;
+	// "auto" takes it from the X-Forwarded-Prefix header of each request of a trusted proxy. Empty
+	// serves at the root
+	BasePath string `json:"base_path" yaml:"base_path" env:"SERVER_BASE_PATH"`
 }
 
+// BasePathAuto is the base path that follows the X-Forwarded-Prefix header
+const BasePathAuto = "auto"
+
 // AgentConfig holds agent-related configuration
 type AgentConfig struct {
 	MaxConcurrent       int           `json:"max_concurrent" yaml:"max_concurrent" env:"AGENT_MAX_CONCURRENT" default:"50"`
@@ -75,6 +151,40 @@ type AgentConfig struct {
 	RetryDelay          time.Duration `json:"retry_delay" yaml:"retry_delay" env:"AGENT_RETRY_DELAY" default:"5s"`
 	SessionTimeout      time.Duration `json:"session_timeout" yaml:"session_timeout" env:"AGENT_SESSION_TIMEOUT" default:"60m"`
 	MaxHistory          int           `json:"max_history" yaml:"max_history" env:"AGENT_MAX_HISTORY" default:"100"`
+	// DraftInterval and DraftBytes control how often a streamed answer is checkpointed so it
+	// survives a server crash; a checkpoint is written when either is reached, 0 disables both
+	DraftInterval time.Duration `json:"draft_interval" yaml:"draft_interval" env:"AGENT_DRAFT_INTERVAL" default:"5s"`
+	DraftBytes    int           `json:"draft_bytes" yaml:"draft_bytes" env:"AGENT_DRAFT_BYTES" default:"4096"`
+	// Session agents idle longer than SessionTimeout are evicted; while their estimated memory
+	// exceeds MemoryBudget bytes, idle agents are evicted early, largest first. 0 disables either
+	MemoryBudget int64 `json:"memory_budget" yaml:"memory_budget" env:"AGENT_MEMORY_BUDGET" default:"0"`
+	// PoolSize is the number of pre-constructed agents kept ready for new sessions; 0 disables the pool
+	PoolSize int `json:"pool_size" yaml:"pool_size" env:"AGENT_POOL_SIZE" default:"2"`
+	// MaxSessionManagers caps the users whose sessions are held in memory and MaxAgents the
+	// session agents; at a cap the least recently used idle ones are evicted. 0 disables either
+	MaxSessionManagers int `json:"max_session_managers" yaml:"max_session_managers" env:"AGENT_MAX_SESSION_MANAGERS" default:"5000"`
+	MaxAgents          int `json:"max_agents" yaml:"max_agents" env:"AGENT_MAX_AGENTS" default:"1000"`
+	// EventHistory is the number of lifecycle events kept per agent and for the server
+	EventHistory int `json:"event_history" yaml:"event_history" env:"AGENT_EVENT_HISTORY" default:"50"`
+	// PromptsDir holds <name>.tmpl files overriding the embedded skill/tool selection prompts
+	PromptsDir string `json:"prompts_dir" yaml:"prompts_dir" env:"AGENT_PROMPTS_DIR"`
+	// Degradation sheds load by answering with the base model only while the server is saturated
+	Degradation DegradationConfig `json:"degradation" yaml:"degradation"`
+}
+
+// DegradationConfig controls the degraded mode of chat turns. A turn is
+// degraded when the share of busy request slots reaches Utilization or the
+// p95 latency of recent turns reaches P95Latency, and turns stay degraded
+// until the share drops below RecoverUtilization and the latency below P95Latency.
+type DegradationConfig struct {
+	Enabled            bool          `json:"enabled" yaml:"enabled" env:"AGENT_DEGRADATION_ENABLED" default:"false"`
+	Utilization        float64       `json:"utilization" yaml:"utilization" env:"AGENT_DEGRADATION_UTILIZATION" default:"0.8"`
+	RecoverUtilization float64       `json:"recover_utilization" yaml:"recover_utilization" env:"AGENT_DEGRADATION_RECOVER_UTILIZATION" default:"0.6"`
+	P95Latency         time.Duration `json:"p95_latency" yaml:"p95_latency" env:"AGENT_DEGRADATION_P95_LATENCY" default:"0"` // 0 ignores latency
+	// SkipTools skips the skill and MCP tool selection calls of degraded turns
+	SkipTools bool `json:"skip_tools" yaml:"skip_tools" env:"AGENT_DEGRADATION_SKIP_TOOLS" default:"true"`
+	// MaxTokens caps the answer of degraded turns; 0 keeps the configured limit
+	MaxTokens int `json:"max_tokens" yaml:"max_tokens" env:"AGENT_DEGRADATION_MAX_TOKENS" default:"0"`
 }
 
 // LLMConfig holds LLM provider configuration
@@ -87,11 +197,52 @@ type LLMConfig struct {
 	MaxTokens     int           `json:"max_tokens" yaml:"max_tokens" env:"LLM_MAX_TOKENS" default:"4096"`
 	Timeout       time.Duration `json:"timeout" yaml:"timeout" env:"LLM_TIMEOUT" default:"60s"`
 	RetryAttempts int           `json:"retry_attempts" yaml:"retry_attempts" env:"LLM_RETRY_ATTEMPTS" default:"3"`
+	// ReasoningMode controls reasoning traces of reasoning models: "stream" sends them as
+	// separate events without persisting them, "store" also saves them, "discard" drops them
+	ReasoningMode string `json:"reasoning_mode" yaml:"reasoning_mode" env:"LLM_REASONING_MODE" default:"stream"`
+	// AllowedModels limits the models answering chats, including those of
+	// experiment variants; empty allows any. When Model is not allowed, the
+	// first allowed model answers instead.
+	AllowedModels []string `json:"allowed_models" yaml:"allowed_models" env:"LLM_ALLOWED_MODELS"`
+	// AuxModel answers the auxiliary calls: skill and tool selection, session
+	// tags, memory extraction and follow-up suggestions. Empty uses Model; the
+	// endpoint and key default to BaseURL and APIKey.
+	AuxModel   string `json:"aux_model" yaml:"aux_model" env:"LLM_AUX_MODEL"`
+	AuxBaseURL string `json:"aux_base_url" yaml:"aux_base_url" env:"LLM_AUX_BASE_URL"`
+	AuxAPIKey  string `json:"aux_api_key" yaml:"aux_api_key" env:"LLM_AUX_API_KEY"`
+	// Breaker makes chat requests fail fast while the provider is down
+	Breaker BreakerConfig `json:"breaker" yaml:"breaker"`
+	// Outbound HTTP settings, also applied to the built-in web tools and MCP SSE servers.
+	// ProxyURL overrides the HTTP(S)_PROXY environment variables.
+	ProxyURL string `json:"proxy_url" yaml:"proxy_url" env:"LLM_PROXY_URL"`
+	// CABundle is a PEM file of extra root certificates, e.g. of a TLS-inspecting proxy
+	CABundle string `json:"ca_bundle" yaml:"ca_bundle" env:"LLM_CA_BUNDLE"`
+	// InsecureSkipVerify disables TLS certificate verification; for debugging only
+	InsecureSkipVerify bool `json:"insecure_skip_verify" yaml:"insecure_skip_verify" env:"LLM_INSECURE_SKIP_VERIFY" default:"false"`
+	// SkipStartupProbe keeps the server ready when the endpoint cannot be reached at
+	// startup; otherwise /ready fails until a probe of BaseURL succeeds
+	SkipStartupProbe bool `json:"skip_startup_probe" yaml:"skip_startup_probe" env:"LLM_SKIP_STARTUP_PROBE" default:"false"`
+}
+
+// BreakerConfig holds the circuit breaker settings for the LLM provider
+type BreakerConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled" env:"LLM_BREAKER_ENABLED" default:"true"`
+	// FailureRate opens the breaker once this fraction of calls in the window failed
+	FailureRate float64 `json:"failure_rate" yaml:"failure_rate" env:"LLM_BREAKER_FAILURE_RATE" default:"0.5"`
+	// MinRequests is the number of calls in the window needed before the rate is considered
+	MinRequests int           `json:"min_requests" yaml:"min_requests" env:"LLM_BREAKER_MIN_REQUESTS" default:"5"`
+	Window      time.Duration `json:"window" yaml:"window" env:"LLM_BREAKER_WINDOW" default:"60s"`
+	// CoolDown is how long the breaker stays open before probing the provider again
+	CoolDown time.Duration `json:"cool_down" yaml:"cool_down" env:"LLM_BREAKER_COOL_DOWN" default:"30s"`
+	// HalfOpenProbes is the number of successful probe calls needed to close the breaker
+	HalfOpenProbes int `json:"half_open_probes" yaml:"half_open_probes" env:"LLM_BREAKER_HALF_OPEN_PROBES" default:"1"`
 }
 
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
-	Type     string `json:"type" yaml:"type" env:"DB_TYPE" default:"sqlite"`
+	// Type selects the session store backend: "file", or "redis" at
+	// Cache.RedisURL with the expiry Cache.TTL
+	Type     string `json:"type" yaml:"type" env:"DB_TYPE" default:"file"`
 	Host     string `json:"host" yaml:"host" env:"DB_HOST" default:"localhost"`
 	Port     int    `json:"port" yaml:"port" env:"DB_PORT" default:"5432"`
 	Name     string `json:"name" yaml:"name" env:"DB_NAME" default:"chatbot"`
@@ -99,6 +250,26 @@ type DatabaseConfig struct {
 	Password string `json:"password" yaml:"password" env:"DB_PASSWORD" default:""`
 	SSLMode  string `json:"ssl_mode" yaml:"ssl_mode" env:"DB_SSL_MODE" default:"disable"`
 	FilePath string `json:"file_path" yaml:"file_path" env:"DB_FILE_PATH" default:"./data/chat.db"`
+	// WriteQueueSize is the number of sessions per user whose saves may wait in
+	// the write-behind queue; 0 saves synchronously on every change
+	WriteQueueSize int `json:"write_queue_size" yaml:"write_queue_size" env:"DB_WRITE_QUEUE_SIZE" default:"256"`
+	// ImportMaxBytes is the largest session import payload accepted, in bytes
+	ImportMaxBytes int64 `json:"import_max_bytes" yaml:"import_max_bytes" env:"DB_IMPORT_MAX_BYTES" default:"10485760"`
+	// Compression writes session files as gzip-compressed compact JSON
+	// (<id>.json.gz); uncompressed files are still read
+	Compression bool `json:"compression" yaml:"compression" env:"SESSION_COMPRESSION" default:"false"`
+	// Retention deletes sessions nobody has updated for a while
+	Retention RetentionConfig `json:"retention" yaml:"retention"`
+}
+
+// RetentionConfig controls the deletion of stale sessions. Every Interval,
+// sessions last updated longer than MaxAge ago are deleted with their agents;
+// with DryRun they are only logged. MaxAge is unrelated to
+// Agent.SessionTimeout, which only evicts idle agents from memory.
+type RetentionConfig struct {
+	MaxAge   time.Duration `json:"max_age" yaml:"max_age" env:"DB_RETENTION" default:"0"` // 0 keeps sessions forever
+	Interval time.Duration `json:"interval" yaml:"interval" env:"DB_RETENTION_INTERVAL" default:"1h"`
+	DryRun   bool          `json:"dry_run" yaml:"dry_run" env:"DB_RETENTION_DRY_RUN" default:"false"`
 }
 
 // SecurityConfig holds security-related configuration
@@ -111,6 +282,60 @@ type SecurityConfig struct {
 	AllowedOrigins    []string      `json:"allowed_origins" yaml:"allowed_origins" env:"ALLOWED_ORIGINS"`
 	EncryptionEnabled bool          `json:"encryption_enabled" yaml:"encryption_enabled" env:"ENCRYPTION_ENABLED" default:"false"`
 	EncryptionKey     string        `json:"encryption_key" yaml:"encryption_key" env:"ENCRYPTION_KEY"`
+	DemoUsers         bool          `json:"demo_users" yaml:"demo_users" env:"SECURITY_DEMO_USERS" default:"true"`
+	// RegistrationMode is who may register an account: "open" for anyone, "invite" for holders
+	// of an invite code created by an admin, "closed" for nobody
+	RegistrationMode string `json:"registration_mode" yaml:"registration_mode" env:"SECURITY_REGISTRATION_MODE" default:"open"`
+	// Verification controls the verification of the email addresses of new accounts
+	Verification VerificationConfig `json:"verification" yaml:"verification"`
+	// InsecureOK allows starting in production even though security checks fail
+	InsecureOK bool `json:"insecure_ok" yaml:"insecure_ok" env:"SECURITY_INSECURE_OK" default:"false"`
+	// Egress restricts where the built-in tools and MCP servers may connect
+	Egress EgressConfig `json:"egress" yaml:"egress"`
+}
+
+// VerificationConfig controls email verification. New accounts are sent a
+// verification link when SMTP is configured; without SMTP, accounts are
+// treated as verified.
+type VerificationConfig struct {
+	// TokenTTL is how long a verification link stays valid
+	TokenTTL time.Duration `json:"token_ttl" yaml:"token_ttl" env:"VERIFICATION_TOKEN_TTL" default:"24h"`
+	// ResendInterval is how long a user must wait before another verification email is sent
+	ResendInterval time.Duration `json:"resend_interval" yaml:"resend_interval" env:"VERIFICATION_RESEND_INTERVAL" default:"1m"`
+	// Gate lists the features that require a verified email: "budget" (role budgets; unverified
+	// users get the default budget), "secrets" (storing secrets) and "memories" (adding memories)
+	Gate []string `json:"gate" yaml:"gate" env:"VERIFICATION_GATE"`
+}
+
+// VerificationFeatures are the features a verified email can be required for
+var VerificationFeatures = []string{"budget", "secrets", "memories"}
+
+// Gated reports whether a feature requires a verified email
+func (c VerificationConfig) Gated(feature string) bool {
+	return slices.Contains(c.Gate, feature)
+}
+
+// SMTPConfig is the mail server emails are sent through; without a host no email is sent
+type SMTPConfig struct {
+	Host     string `json:"host" yaml:"host" env:"SMTP_HOST"`
+	Port     int    `json:"port" yaml:"port" env:"SMTP_PORT" default:"587"`
+	Username string `json:"username" yaml:"username" env:"SMTP_USERNAME"`
+	Password string `json:"password" yaml:"password" env:"SMTP_PASSWORD"`
+	// From is the sender address of the emails
+	From string `json:"from" yaml:"from" env:"SMTP_FROM"`
+}
+
+// EgressConfig is the policy for outbound connections of the built-in tools
+// and MCP SSE servers. Entries are CIDRs, IP addresses, host names or
+// "*.example.com" for all subdomains of a host. Allow entries take precedence
+// over deny entries and BlockPrivate, so denying 0.0.0.0/0 and ::/0 reaches
+// nothing but the allow list.
+type EgressConfig struct {
+	// BlockPrivate blocks private, loopback, link-local (e.g. the cloud
+	// metadata service 169.254.169.254) and other non-public addresses
+	BlockPrivate bool     `json:"block_private" yaml:"block_private" env:"EGRESS_BLOCK_PRIVATE" default:"false"`
+	Allow        []string `json:"allow" yaml:"allow" env:"EGRESS_ALLOW"`
+	Deny         []string `json:"deny" yaml:"deny" env:"EGRESS_DENY"`
 }
 
 // MonitoringConfig holds monitoring configuration
@@ -121,6 +346,9 @@ type MonitoringConfig struct {
 	JaegerEndpoint      string        `json:"jaeger_endpoint" yaml:"jaeger_endpoint" env:"JAEGER_ENDPOINT"`
 	HealthCheckEnabled  bool          `json:"health_check_enabled" yaml:"health_check_enabled" env:"HEALTH_CHECK_ENABLED" default:"true"`
 	HealthCheckInterval time.Duration `json:"health_check_interval" yaml:"health_check_interval" env:"HEALTH_CHECK_INTERVAL" default:"30s"`
+	// HealthPort serves unauthenticated /health and /ready on a separate
+	// plain-HTTP port for load balancer probes; 0 disables it
+	HealthPort int `json:"health_port" yaml:"health_port" env:"HEALTH_PORT" default:"0"`
 }
 
 // LoggingConfig holds logging configuration
@@ -133,6 +361,14 @@ type LoggingConfig struct {
 	MaxBackups int    `json:"max_backups" yaml:"max_backups" env:"LOG_MAX_BACKUPS" default:"3"`
 	MaxAge     int    `json:"max_age" yaml:"max_age" env:"LOG_MAX_AGE" default:"28"`
 	Compress   bool   `json:"compress" yaml:"compress" env:"LOG_COMPRESS" default:"true"`
+	AuditFile  string `json:"audit_file" yaml:"audit_file" env:"AUDIT_LOG_FILE" default:"./logs/audit.log"`
+	// ContentDebugOnly logs user messages and answers only at debug level;
+	// otherwise only their length is logged
+	ContentDebugOnly bool `json:"content_debug_only" yaml:"content_debug_only" env:"LOG_CONTENT_DEBUG_ONLY" default:"true"`
+	// MaxContentLength truncates logged content to this many characters; 0 disables truncation
+	MaxContentLength int `json:"max_content_length" yaml:"max_content_length" env:"LOG_MAX_CONTENT_LENGTH" default:"200"`
+	// HashSessionIDs logs a hash of session IDs instead of the IDs
+	HashSessionIDs bool `json:"hash_session_ids" yaml:"hash_session_ids" env:"LOG_HASH_SESSION_IDS" default:"false"`
 }
 
 // CacheConfig holds cache configuration
@@ -154,6 +390,697 @@ type FeaturesConfig struct {
 	FeedbackEnabled   bool `json:"feedback_enabled" yaml:"feedback_enabled" env:"FEATURES_FEEDBACK" default:"true"`
 }
 
+// UsageConfig controls token counting and cost estimates in chat streams
+type UsageConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled" env:"USAGE_ENABLED" default:"false"`
+	// EventInterval is the number of streamed chunks between usage events
+	EventInterval int `json:"event_interval" yaml:"event_interval" env:"USAGE_EVENT_INTERVAL" default:"10"`
+	// Pricing overrides or extends the built-in pricing table, keyed by model name
+	Pricing map[string]ModelPrice `json:"pricing" yaml:"pricing"`
+}
+
+// TaggingConfig controls automatic topic tagging of sessions
+type TaggingConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled" env:"TAGGING_ENABLED" default:"false"`
+	// Every is the number of session messages between tagging runs
+	Every   int `json:"every" yaml:"every" env:"TAGGING_EVERY" default:"6"`
+	MaxTags int `json:"max_tags" yaml:"max_tags" env:"TAGGING_MAX_TAGS" default:"3"`
+	// Taxonomy restricts tags to a fixed list; empty allows free-form tags
+	Taxonomy []string `json:"taxonomy" yaml:"taxonomy" env:"TAGGING_TAXONOMY"`
+	// Model overrides the LLM model used for tagging, e.g. a cheaper one
+	Model string `json:"model" yaml:"model" env:"TAGGING_MODEL"`
+}
+
+// SuggestionsConfig controls the follow-up questions suggested after each
+// streamed answer, generated by an extra LLM call after the end event
+type SuggestionsConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled" env:"SUGGESTIONS_ENABLED" default:"false"`
+	// Max is the maximum number of suggested questions
+	Max int `json:"max" yaml:"max" env:"SUGGESTIONS_MAX" default:"3"`
+	// Model overrides the LLM model used for suggestions, e.g. a cheaper one
+	Model string `json:"model" yaml:"model" env:"SUGGESTIONS_MODEL"`
+}
+
+// TypingConfig controls the generation lifecycle events published on the
+// session events stream, so other clients can show a typing indicator
+type TypingConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled" env:"TYPING_ENABLED" default:"true"`
+	// LiveText adds the streamed text to progress events; it doubles the fan-out of every answer
+	LiveText bool `json:"live_text" yaml:"live_text" env:"TYPING_LIVE_TEXT" default:"false"`
+	// Interval is the minimum time between progress events of a generation
+	Interval time.Duration `json:"interval" yaml:"interval" env:"TYPING_INTERVAL" default:"500ms"`
+}
+
+// MemoriesConfig controls the per-user memories added to the prompt of new
+// sessions and their extraction from conversations by an extra LLM call
+type MemoriesConfig struct {
+	// Extract lets the LLM propose memories from conversations
+	Extract bool `json:"extract" yaml:"extract" env:"MEMORIES_EXTRACT" default:"false"`
+	// Every is the number of session messages between extraction runs
+	Every int `json:"every" yaml:"every" env:"MEMORIES_EVERY" default:"10"`
+	// MaxPromptChars bounds the memories added to the prompt of a new session
+	MaxPromptChars int `json:"max_prompt_chars" yaml:"max_prompt_chars" env:"MEMORIES_MAX_PROMPT_CHARS" default:"1500"`
+	// Model overrides the LLM model used for extraction, e.g. a cheaper one
+	Model string `json:"model" yaml:"model" env:"MEMORIES_MODEL"`
+}
+
+// SkillsConfig controls skill packages installed through the admin API
+type SkillsConfig struct {
+	// MaxPackageSize is the maximum size of a skill package in MB, compressed and unpacked
+	MaxPackageSize int `json:"max_package_size" yaml:"max_package_size" env:"SKILLS_MAX_PACKAGE_SIZE" default:"10"`
+	// TrustedKeys are base64 Ed25519 public keys whose signatures are accepted
+	TrustedKeys []string `json:"trusted_keys" yaml:"trusted_keys" env:"SKILLS_TRUSTED_KEYS"`
+	// RequireSignature rejects packages not signed by one of TrustedKeys
+	RequireSignature bool `json:"require_signature" yaml:"require_signature" env:"SKILLS_REQUIRE_SIGNATURE" default:"false"`
+	// KeepVersions is the number of previous versions of a skill kept for rollback
+	KeepVersions int `json:"keep_versions" yaml:"keep_versions" env:"SKILLS_KEEP_VERSIONS" default:"3"`
+}
+
+// TestingConfig holds hooks for end-to-end resilience testing
+type TestingConfig struct {
+	FaultInjection FaultInjectionConfig `json:"fault_injection" yaml:"fault_injection"`
+}
+
+// FaultInjectionConfig makes the LLM and tools fail on purpose, to exercise
+// retries, the circuit breaker and fallbacks. Faults are injected at random
+// with the configured rates (0 to 1) or per request through Header, e.g.
+// "llm_error" or "tool_timeout=search". It cannot be enabled in production.
+type FaultInjectionConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled" env:"FAULT_INJECTION_ENABLED" default:"false"`
+	// Header is the request header choosing faults; empty ignores headers
+	Header string `json:"header" yaml:"header" env:"FAULT_INJECTION_HEADER" default:"X-Fault-Injection"`
+	// LLMErrorRate is the share of LLM calls failing with an error
+	LLMErrorRate float64 `json:"llm_error_rate" yaml:"llm_error_rate" env:"FAULT_INJECTION_LLM_ERROR_RATE" default:"0"`
+	// LLMSlowRate is the share of LLM calls delayed by LLMDelay
+	LLMSlowRate float64       `json:"llm_slow_rate" yaml:"llm_slow_rate" env:"FAULT_INJECTION_LLM_SLOW_RATE" default:"0"`
+	LLMDelay    time.Duration `json:"llm_delay" yaml:"llm_delay" env:"FAULT_INJECTION_LLM_DELAY" default:"10s"`
+	// ToolTimeoutRate is the share of tool calls failing with a timeout
+	ToolTimeoutRate float64 `json:"tool_timeout_rate" yaml:"tool_timeout_rate" env:"FAULT_INJECTION_TOOL_TIMEOUT_RATE" default:"0"`
+	// ToolGarbageRate is the share of tool calls returning garbage instead of calling the tool
+	ToolGarbageRate float64 `json:"tool_garbage_rate" yaml:"tool_garbage_rate" env:"FAULT_INJECTION_TOOL_GARBAGE_RATE" default:"0"`
+	// Tools restricts the random tool faults to these tools; empty means all tools
+	Tools []string `json:"tools" yaml:"tools" env:"FAULT_INJECTION_TOOLS"`
+}
+
+// DatasetConfig controls the sampled prompt/response dataset used for offline evaluation
+type DatasetConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled" env:"DATASET_ENABLED" default:"false"`
+	Dir     string `json:"dir" yaml:"dir" env:"DATASET_DIR" default:"./data/dataset"`
+	// SampleRate is the fraction of chat turns recorded, between 0 and 1
+	SampleRate float64 `json:"sample_rate" yaml:"sample_rate" env:"DATASET_SAMPLE_RATE" default:"0.05"`
+	// MaxFileSize is the size in MB after which the current day's file is rotated
+	MaxFileSize int `json:"max_file_size" yaml:"max_file_size" env:"DATASET_MAX_FILE_SIZE" default:"100"`
+	// RetentionDays is how long dataset files are kept; 0 keeps them forever
+	RetentionDays int `json:"retention_days" yaml:"retention_days" env:"DATASET_RETENTION_DAYS" default:"30"`
+	// RedactPatterns are extra regular expressions scrubbed from prompts and responses
+	RedactPatterns []string `json:"redact_patterns" yaml:"redact_patterns" env:"DATASET_REDACT_PATTERNS"`
+}
+
+// BudgetConfig holds soft daily token budgets per user. A user's budget is the
+// largest budget of their roles; a chat is rejected once the tokens used today
+// plus the estimated prompt would exceed it, so an answer may still overshoot.
+type BudgetConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled" env:"BUDGET_ENABLED" default:"false"`
+	// Roles maps a role to its daily token budget; 0 means unlimited
+	Roles map[string]int64 `json:"roles" yaml:"roles"`
+	// Default is the budget of users without a role listed in Roles; 0 means unlimited
+	Default int64 `json:"default" yaml:"default" env:"BUDGET_DEFAULT" default:"0"`
+	// Timezone is the IANA time zone whose midnight starts a new budget day
+	Timezone string `json:"timezone" yaml:"timezone" env:"BUDGET_TIMEZONE" default:"UTC"`
+	// StatePath is the file the counters of the current day are persisted in
+	StatePath string `json:"state_path" yaml:"state_path" env:"BUDGET_STATE_PATH" default:"./data/budget.json"`
+	// FlushInterval is how often changed counters are written to StatePath
+	FlushInterval time.Duration `json:"flush_interval" yaml:"flush_interval" env:"BUDGET_FLUSH_INTERVAL" default:"10s"`
+}
+
+// ActivityConfig controls the tracking of user engagement for admins: when
+// each user was last seen and how many messages they sent per hour
+type ActivityConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled" env:"ACTIVITY_ENABLED" default:"true"`
+	// Timezone is the IANA time zone of the days and hours of the counts
+	Timezone string `json:"timezone" yaml:"timezone" env:"ACTIVITY_TIMEZONE" default:"UTC"`
+	// RetentionDays is how many days of hourly counts are kept
+	RetentionDays int `json:"retention_days" yaml:"retention_days" env:"ACTIVITY_RETENTION_DAYS" default:"90"`
+	// FlushInterval is how often changed activity is written to StatePath
+	FlushInterval time.Duration `json:"flush_interval" yaml:"flush_interval" env:"ACTIVITY_FLUSH_INTERVAL" default:"1m"`
+	StatePath     string        `json:"state_path" yaml:"state_path" env:"ACTIVITY_STATE_PATH" default:"./data/activity.json"`
+}
+
+// WorkspacesConfig controls workspaces, which host several teams on one
+// server with their own sessions and part of the config, see WorkspaceOverrides
+type WorkspacesConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled" env:"WORKSPACES_ENABLED" default:"false"`
+	// StatePath is the file the workspaces are persisted in
+	StatePath string `json:"state_path" yaml:"state_path" env:"WORKSPACES_STATE_PATH" default:"./data/workspaces.json"`
+}
+
+// WorkspaceOverrides are the settings a workspace changes over the global
+// config for its members. Unset fields keep the global value; set ones
+// replace it as a whole.
+type WorkspaceOverrides struct {
+	UI            *WorkspaceUI     `json:"ui,omitempty"`
+	Tools         *WorkspaceTools  `json:"tools,omitempty"`
+	Budget        *WorkspaceBudget `json:"budget,omitempty"`
+	AllowedModels []string         `json:"allowed_models,omitempty"`
+}
+
+// WorkspaceUI is the branding and the personas of a workspace
+type WorkspaceUI struct {
+	ChatTitle       string          `json:"chat_title,omitempty"`
+	AppLogo         string          `json:"app_logo,omitempty"`
+	GreetingMessage *string         `json:"greeting_message,omitempty"` // empty disables the greeting
+	Personas        []PersonaConfig `json:"personas,omitempty"`
+}
+
+// WorkspaceTools is the tool policy of a workspace
+type WorkspaceTools struct {
+	Allow []string `json:"allow"`
+}
+
+// WorkspaceBudget are the daily token budgets of the members of a workspace;
+// budgets must be enabled globally
+type WorkspaceBudget struct {
+	Roles   map[string]int64 `json:"roles,omitempty"`
+	Default *int64           `json:"default,omitempty"`
+}
+
+// WithWorkspace returns a copy of the config with the overrides of a
+// workspace applied
+func (c *Config) WithWorkspace(overrides WorkspaceOverrides) *Config {
+	layered := *c
+	if ui := overrides.UI; ui != nil {
+		layered.UI.ChatTitle = cmp.Or(ui.ChatTitle, layered.UI.ChatTitle)
+		layered.UI.AppLogo = cmp.Or(ui.AppLogo, layered.UI.AppLogo)
+		if ui.GreetingMessage != nil {
+			layered.UI.GreetingMessage = *ui.GreetingMessage
+		}
+		if ui.Personas != nil {
+			layered.UI.Personas = ui.Personas
+		}
+	}
+	if tools := overrides.Tools; tools != nil {
+		layered.Tools.Allow = tools.Allow
+	}
+	if budget := overrides.Budget; budget != nil {
+		if budget.Roles != nil {
+			layered.Budget.Roles = budget.Roles
+		}
+		if budget.Default != nil {
+			layered.Budget.Default = *budget.Default
+		}
+	}
+	if len(overrides.AllowedModels) > 0 {
+		layered.LLM.AllowedModels = overrides.AllowedModels
+	}
+	return &layered
+}
+
+// ValidateWorkspaceOverrides checks the overrides of a workspace like the
+// global settings they replace
+func ValidateWorkspaceOverrides(overrides WorkspaceOverrides) error {
+	if ui := overrides.UI; ui != nil {
+		if err := validatePersonas(ui.Personas); err != nil {
+			return err
+		}
+	}
+	if budget := overrides.Budget; budget != nil {
+		if budget.Default != nil && *budget.Default < 0 {
+			return fmt.Errorf("budget default cannot be negative")
+		}
+		for role, limit := range budget.Roles {
+			if limit < 0 {
+				return fmt.Errorf("budget of role %s cannot be negative", role)
+			}
+		}
+	}
+	if tools := overrides.Tools; tools != nil && slices.Contains(tools.Allow, "") {
+		return fmt.Errorf("allowed tool names cannot be empty")
+	}
+	if slices.Contains(overrides.AllowedModels, "") {
+		return fmt.Errorf("allowed model names cannot be empty")
+	}
+	return nil
+}
+
+// PolicyConfig holds the limits on what the assistant answers
+type PolicyConfig struct {
+	TopicScope TopicScopeConfig `json:"topic_scope" yaml:"topic_scope"`
+}
+
+// DefaultTopicRefusal is the answer to messages outside the topic scope
+const DefaultTopicRefusal = "Sorry, I can only help with questions within the scope of this assistant."
+
+// TopicScopeConfig restricts the assistant to a topic, e.g. for an HR
+// assistant. The description is added to the system prompt; with Classify,
+// the auxiliary model also checks each message first, and messages clearly
+// out of scope are answered with Refusal without generating an answer.
+type TopicScopeConfig struct {
+	// Description is what the assistant may help with; empty allows any topic
+	Description string `json:"description" yaml:"description" env:"POLICY_TOPIC_SCOPE"`
+	Classify    bool   `json:"classify" yaml:"classify" env:"POLICY_TOPIC_CLASSIFY" default:"false"`
+	// Examples of messages in and out of scope, given to the classifier
+	InScopeExamples    []string      `json:"in_scope_examples" yaml:"in_scope_examples"`
+	OutOfScopeExamples []string      `json:"out_of_scope_examples" yaml:"out_of_scope_examples"`
+	Refusal            string        `json:"refusal" yaml:"refusal" env:"POLICY_TOPIC_REFUSAL"`
+	ClassifyTimeout    time.Duration `json:"classify_timeout" yaml:"classify_timeout" env:"POLICY_TOPIC_CLASSIFY_TIMEOUT" default:"5s"`
+}
+
+// PrivacyConfig controls the privacy mode of admin exports, which hashes user
+// identifiers and redacts or strips long prompt text
+type PrivacyConfig struct {
+	// ExportPrivacy is the default mode of exports; a request may choose otherwise unless Forced is set
+	ExportPrivacy bool `json:"export_privacy" yaml:"export_privacy" env:"PRIVACY_EXPORT" default:"false"`
+	// Forced turns the privacy mode on for every export, for strict deployments; it requires HashSecret
+	Forced bool `json:"forced" yaml:"forced" env:"PRIVACY_FORCED" default:"false"`
+	// MaxTextLength is the length in characters above which text is summarized or stripped
+	MaxTextLength int `json:"max_text_length" yaml:"max_text_length" env:"PRIVACY_MAX_TEXT_LENGTH" default:"200"`
+	// LongText is "summarize" (redact and truncate) or "strip" (remove) for text over MaxTextLength
+	LongText string `json:"long_text" yaml:"long_text" env:"PRIVACY_LONG_TEXT" default:"summarize"`
+	// HashSecret keys the hashes of user identifiers so they cannot be reversed by guessing
+	HashSecret string `json:"hash_secret" yaml:"hash_secret" env:"PRIVACY_HASH_SECRET"`
+	// RedactPatterns are extra regular expressions scrubbed from exported text
+	RedactPatterns []string `json:"redact_patterns" yaml:"redact_patterns" env:"PRIVACY_REDACT_PATTERNS"`
+}
+
+// UIConfig holds content shown in the chat UI
+type UIConfig struct {
+	// ChatTitle and AppLogo brand the chat UI; the logo path is below the base path
+	ChatTitle string `json:"chat_title" yaml:"chat_title" env:"UI_CHAT_TITLE" default:"聊天智能体"`
+	AppLogo   string `json:"app_logo" yaml:"app_logo" env:"UI_APP_LOGO" default:"/static/images/logo.png"`
+	// GreetingMessage is saved as the first assistant message of every new session; empty disables it
+	GreetingMessage string `json:"greeting_message" yaml:"greeting_message" env:"UI_GREETING_MESSAGE"`
+	// RedactPreviews scrubs personal data and credentials, and the privacy redact
+	// patterns, from the titles and snippets of the session list
+	RedactPreviews bool `json:"redact_previews" yaml:"redact_previews" env:"UI_REDACT_PREVIEWS" default:"true"`
+	// Personas can be chosen when a session is created; a persona's greeting replaces GreetingMessage
+	Personas []PersonaConfig `json:"personas" yaml:"personas"`
+}
+
+// PersonaConfig is an assistant persona offered at session creation
+type PersonaConfig struct {
+	Name     string `json:"name" yaml:"name"`
+	Greeting string `json:"greeting" yaml:"greeting"`
+}
+
+// Persona returns the persona with the given name
+func (c UIConfig) Persona(name string) (PersonaConfig, bool) {
+	for _, persona := range c.Personas {
+		if persona.Name == name {
+			return persona, true
+		}
+	}
+	return PersonaConfig{}, false
+}
+
+// validateBudget checks the budget time zone and limits
+func validateBudget(budget BudgetConfig) error {
+	if !budget.Enabled {
+		return nil
+	}
+	if _, err := time.LoadLocation(budget.Timezone); err != nil {
+		return fmt.Errorf("invalid budget timezone %q: %w", budget.Timezone, err)
+	}
+	if budget.Default < 0 {
+		return fmt.Errorf("budget default cannot be negative")
+	}
+	for role, limit := range budget.Roles {
+		if limit < 0 {
+			return fmt.Errorf("budget of role %s cannot be negative", role)
+		}
+	}
+	if budget.FlushInterval <= 0 {
+		return fmt.Errorf("budget flush interval must be positive")
+	}
+	return nil
+}
+
+// validateActivity checks the time zone and periods of activity tracking
+func validateActivity(activity ActivityConfig) error {
+	if !activity.Enabled {
+		return nil
+	}
+	if _, err := time.LoadLocation(activity.Timezone); err != nil {
+		return fmt.Errorf("invalid activity timezone %q: %w", activity.Timezone, err)
+	}
+	if activity.RetentionDays <= 0 {
+		return fmt.Errorf("activity retention days must be positive")
+	}
+	if activity.FlushInterval <= 0 {
+		return fmt.Errorf("activity flush interval must be positive")
+	}
+	return nil
+}
+
+// validateWorkspaces checks that enabled workspaces have a state file
+func validateWorkspaces(workspaces WorkspacesConfig) error {
+	if workspaces.Enabled && workspaces.StatePath == "" {
+		return fmt.Errorf("workspaces state path cannot be empty")
+	}
+	return nil
+}
+
+// validateTopicScope checks that messages are only classified against a
+// described scope
+func validateTopicScope(scope TopicScopeConfig) error {
+	if !scope.Classify {
+		return nil
+	}
+	if strings.TrimSpace(scope.Description) == "" {
+		return fmt.Errorf("topic scope classification needs a scope description")
+	}
+	if scope.ClassifyTimeout <= 0 {
+		return fmt.Errorf("topic scope classify timeout must be positive")
+	}
+	return nil
+}
+
+// validateMCP checks the startup timeout and cap of lazily started MCP servers
+func validateMCP(mcp MCPConfig) error {
+	if !mcp.Lazy {
+		return nil
+	}
+	if mcp.StartupTimeout <= 0 {
+		return fmt.Errorf("MCP startup timeout must be positive")
+	}
+	if mcp.MaxServers < 0 {
+		return fmt.Errorf("MCP max servers cannot be negative")
+	}
+	return nil
+}
+
+// validateEgress checks that the egress allow and deny entries are CIDRs,
+// IP addresses or host names
+func validateEgress(egress EgressConfig) error {
+	for _, entry := range slices.Concat(egress.Allow, egress.Deny) {
+		if !ValidEgressEntry(entry) {
+			return fmt.Errorf("invalid egress entry %q: must be a CIDR, IP address or host name", entry)
+		}
+	}
+	return nil
+}
+
+// basePathPattern matches a path prefix: slash-separated segments of URL-safe
+// characters. Anything else in a forwarded prefix is ignored, as the prefix
+// is written into pages.
+var basePathPattern = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// NormalizeBasePath returns a path prefix with a leading and without a
+// trailing slash, "" for the root, and whether it is a valid prefix
+func NormalizeBasePath(basePath string) (string, bool) {
+	basePath = strings.TrimRight(strings.TrimSpace(basePath), "/")
+	if basePath == "" {
+		return "", true
+	}
+	if !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+	if !basePathPattern.MatchString(basePath) {
+		return "", false
+	}
+	for _, segment := range strings.Split(basePath[1:], "/") {
+		if segment == "." || segment == ".." {
+			return "", false
+		}
+	}
+	return basePath, true
+}
+
+// validateBasePath checks that the base path is a path prefix or "auto"
+func validateBasePath(basePath string) error {
+	if basePath == BasePathAuto {
+		return nil
+	}
+	if _, ok := NormalizeBasePath(basePath); !ok {
+		return fmt.Errorf("invalid base path %q: must be \"auto\" or a path of letters, digits, '.', '_', '~' and '-' segments such as /chat", basePath)
+	}
+	return nil
+}
+
+// validateImportMaxBytes checks that session imports are allowed a size
+func validateImportMaxBytes(maxBytes int64) error {
+	if maxBytes <= 0 {
+		return fmt.Errorf("invalid import max bytes %d: must be positive", maxBytes)
+	}
+	return nil
+}
+
+// validateRetention checks that stale sessions are looked for regularly
+// when they are deleted
+func validateRetention(retention RetentionConfig) error {
+	if retention.MaxAge < 0 {
+		return fmt.Errorf("invalid retention %v: must not be negative", retention.MaxAge)
+	}
+	if retention.MaxAge > 0 && retention.Interval <= 0 {
+		return fmt.Errorf("invalid retention interval %v: must be positive", retention.Interval)
+	}
+	return nil
+}
+
+// validatePrivacy checks that forced export privacy has a key for the hashes
+// of identifiers: unkeyed, they are reversed by hashing candidate IDs
+func validatePrivacy(privacy PrivacyConfig) error {
+	if privacy.Forced && privacy.HashSecret == "" {
+		return fmt.Errorf("invalid privacy config: forced without a hash secret; set PRIVACY_HASH_SECRET")
+	}
+	return nil
+}
+
+// validateRegistrationMode checks that the registration mode is known
+func validateRegistrationMode(mode string) error {
+	switch mode {
+	case "open", "invite", "closed":
+		return nil
+	}
+	return fmt.Errorf("invalid registration mode %q: must be open, invite or closed", mode)
+}
+
+// validateVerification checks the gated features and, when emails are sent,
+// the sender and the URL of the verification links
+func validateVerification(verification VerificationConfig, smtp SMTPConfig, publicURL string) error {
+	for _, feature := range verification.Gate {
+		if !slices.Contains(VerificationFeatures, feature) {
+			return fmt.Errorf("unknown verification gate %q: must be one of %s", feature, strings.Join(VerificationFeatures, ", "))
+		}
+	}
+	if smtp.Host == "" {
+		return nil
+	}
+	if smtp.From == "" {
+		return fmt.Errorf("SMTP from address is required when SMTP is configured")
+	}
+	if u, err := url.Parse(publicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		// Links must not be built from the Host header, which the client controls
+		return fmt.Errorf("server public URL is required for verification links when SMTP is configured")
+	}
+	if verification.TokenTTL <= 0 {
+		return fmt.Errorf("verification token TTL must be positive")
+	}
+	return nil
+}
+
+// ValidEgressEntry reports whether an egress allow or deny entry is a CIDR,
+// an IP address, a host name or "*." followed by a host name
+func ValidEgressEntry(entry string) bool {
+	if _, err := netip.ParsePrefix(entry); err == nil {
+		return true
+	}
+	if _, err := netip.ParseAddr(entry); err == nil {
+		return true
+	}
+	return egressHostPattern.MatchString(strings.TrimPrefix(entry, "*."))
+}
+
+// egressHostPattern matches the host names of egress entries
+var egressHostPattern = regexp.MustCompile(`(?i)^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// validateToolQuotas checks the tool quota time zone and limits
+func validateToolQuotas(quotas ToolQuotaConfig) error {
+	if !quotas.Enabled {
+		return nil
+	}
+	if _, err := time.LoadLocation(quotas.Timezone); err != nil {
+		return fmt.Errorf("invalid tool quota timezone %q: %w", quotas.Timezone, err)
+	}
+	for tool, quota := range quotas.Limits {
+		if quota.PerSession < 0 || quota.PerUserPerDay < 0 {
+			return fmt.Errorf("quota of tool %s cannot be negative", tool)
+		}
+	}
+	return nil
+}
+
+// validateFaultInjection keeps fault injection out of production and checks its rates
+func validateFaultInjection(faults FaultInjectionConfig, environment Environment) error {
+	if !faults.Enabled {
+		return nil
+	}
+	if environment == Production {
+		return fmt.Errorf("fault injection cannot be enabled in the production environment")
+	}
+	for name, rate := range map[string]float64{
+		"llm_error_rate":    faults.LLMErrorRate,
+		"llm_slow_rate":     faults.LLMSlowRate,
+		"tool_timeout_rate": faults.ToolTimeoutRate,
+		"tool_garbage_rate": faults.ToolGarbageRate,
+	} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("fault injection %s must be between 0 and 1", name)
+		}
+	}
+	if faults.LLMDelay < 0 {
+		return fmt.Errorf("fault injection llm_delay cannot be negative")
+	}
+	return nil
+}
+
+// validateAgentCaps checks the caps of the session managers, agents and
+// lifecycle event history
+func validateAgentCaps(agent AgentConfig) error {
+	if agent.MaxSessionManagers < 0 {
+		return fmt.Errorf("agent max_session_managers cannot be negative")
+	}
+	if agent.MaxAgents < 0 {
+		return fmt.Errorf("agent max_agents cannot be negative")
+	}
+	if agent.EventHistory < 0 {
+		return fmt.Errorf("agent event_history cannot be negative")
+	}
+	return nil
+}
+
+// validateDegradation checks the load shedding thresholds
+func validateDegradation(degradation DegradationConfig) error {
+	if !degradation.Enabled {
+		return nil
+	}
+	if degradation.Utilization <= 0 || degradation.Utilization > 1 {
+		return fmt.Errorf("degradation utilization must be in (0, 1]")
+	}
+	if degradation.RecoverUtilization < 0 || degradation.RecoverUtilization > degradation.Utilization {
+		return fmt.Errorf("degradation recover_utilization must be between 0 and utilization")
+	}
+	if degradation.P95Latency < 0 {
+		return fmt.Errorf("degradation p95_latency cannot be negative")
+	}
+	if degradation.MaxTokens < 0 {
+		return fmt.Errorf("degradation max_tokens cannot be negative")
+	}
+	return nil
+}
+
+// validateTyping checks the progress event interval
+func validateTyping(typing TypingConfig) error {
+	if typing.Interval < 0 {
+		return fmt.Errorf("typing interval cannot be negative")
+	}
+	return nil
+}
+
+// validateMemories checks the extraction interval and the prompt size
+func validateMemories(memories MemoriesConfig) error {
+	if memories.Extract && memories.Every <= 0 {
+		return fmt.Errorf("memories every must be positive when extraction is enabled")
+	}
+	if memories.MaxPromptChars < 0 {
+		return fmt.Errorf("memories max_prompt_chars cannot be negative")
+	}
+	return nil
+}
+
+// validateSkills checks the package limits and the trusted keys
+func validateSkills(skills SkillsConfig) error {
+	if skills.MaxPackageSize <= 0 {
+		return fmt.Errorf("skills max package size must be positive")
+	}
+	if skills.KeepVersions < 0 {
+		return fmt.Errorf("skills keep_versions cannot be negative")
+	}
+	for _, key := range skills.TrustedKeys {
+		if raw, err := base64.StdEncoding.DecodeString(key); err != nil || len(raw) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid trusted skill key %q: expected a base64 Ed25519 public key", key)
+		}
+	}
+	if skills.RequireSignature && len(skills.TrustedKeys) == 0 {
+		return fmt.Errorf("skills require_signature needs at least one trusted key")
+	}
+	return nil
+}
+
+// validatePersonas checks that persona names are set and unique
+func validatePersonas(personas []PersonaConfig) error {
+	names := make(map[string]bool)
+	for _, persona := range personas {
+		if persona.Name == "" {
+			return fmt.Errorf("persona name cannot be empty")
+		}
+		if names[persona.Name] {
+			return fmt.Errorf("duplicate persona: %s", persona.Name)
+		}
+		names[persona.Name] = true
+	}
+	return nil
+}
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Input  float64 `json:"input" yaml:"input"`
+	Output float64 `json:"output" yaml:"output"`
+}
+
+// ToolsConfig holds configuration for skill and MCP tool execution
+type ToolsConfig struct {
+	// Allow lists the tools that may be called; empty allows all. A call of
+	// another tool is reported to the model as a permission error.
+	Allow   []string        `json:"allow" yaml:"allow" env:"TOOLS_ALLOW"`
+	Sandbox SandboxConfig   `json:"sandbox" yaml:"sandbox"`
+	Quotas  ToolQuotaConfig `json:"quotas" yaml:"quotas"`
+	MCP     MCPConfig       `json:"mcp" yaml:"mcp"`
+}
+
+// MCPConfig controls when MCP server subprocesses run
+type MCPConfig struct {
+	// Lazy starts a server with a tool manifest in the MCP config only when
+	// one of its tools is first called, instead of when the agent loads tools
+	Lazy bool `json:"lazy" yaml:"lazy" env:"MCP_LAZY" default:"false"`
+	// StartupTimeout bounds how long a lazily started server may take to connect
+	StartupTimeout time.Duration `json:"startup_timeout" yaml:"startup_timeout" env:"MCP_STARTUP_TIMEOUT" default:"60s"`
+	// MaxServers caps the lazily started servers running at once, across all
+	// sessions; the least recently used idle one is stopped to make room.
+	// 0 means unlimited.
+	MaxServers int `json:"max_servers" yaml:"max_servers" env:"MCP_MAX_SERVERS" default:"0"`
+	// ManifestCache is the file the tool manifests of reached servers are
+	// kept in, so their tools stay selectable while a server is down; empty
+	// keeps them in memory only
+	ManifestCache string `json:"manifest_cache" yaml:"manifest_cache" env:"MCP_MANIFEST_CACHE" default:"./data/mcp_manifests.json"`
+}
+
+// ToolQuotaConfig limits how often tools may be called. A refused call is
+// reported to the model as a tool error so it answers without the tool.
+type ToolQuotaConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled" env:"TOOL_QUOTA_ENABLED" default:"false"`
+	// Limits maps a tool name to its quota; "*" applies to tools not listed
+	Limits map[string]ToolQuota `json:"limits" yaml:"limits"`
+	// Timezone is the IANA time zone whose midnight resets the daily counters
+	Timezone string `json:"timezone" yaml:"timezone" env:"TOOL_QUOTA_TIMEZONE" default:"UTC"`
+	// StatePath is the file the counters are persisted in
+	StatePath string `json:"state_path" yaml:"state_path" env:"TOOL_QUOTA_STATE_PATH" default:"./data/tool_quotas.json"`
+}
+
+// ToolQuota is the number of calls allowed of a tool; 0 means unlimited
+type ToolQuota struct {
+	PerSession    int `json:"per_session" yaml:"per_session"`
+	PerUserPerDay int `json:"per_user_per_day" yaml:"per_user_per_day"`
+}
+
+// SandboxConfig controls the environment and working directory of tool subprocesses
+type SandboxConfig struct {
+	Enabled    bool     `json:"enabled" yaml:"enabled" env:"TOOLS_SANDBOX_ENABLED" default:"false"`
+	Root       string   `json:"root" yaml:"root" env:"TOOLS_SANDBOX_ROOT" default:"./sandbox"`
+	AllowedEnv []string `json:"allowed_env" yaml:"allowed_env" env:"TOOLS_SANDBOX_ALLOWED_ENV"`
+	// ReadOnly refuses file writes and every script and code execution of skill tools
+	ReadOnly bool `json:"read_only" yaml:"read_only" env:"TOOLS_SANDBOX_READ_ONLY" default:"false"`
+}
+
 // Manager manages configuration with hot reload capability
 type Manager struct {
 	mu          sync.RWMutex
@@ -161,8 +1088,10 @@ type Manager struct {
 	environment Environment
 	watchers    []chan *Config
 	configPath  string
+	watchMu     sync.Mutex // guards watcher and watchDone
 	watcher     *fsnotify.Watcher
-	watching    bool
+	watchDone   chan struct{} // closed when the watch loop exits
+	listeners   []func(ReloadEvent)
 }
 
 // NewManager creates a new configuration manager
@@ -237,9 +1166,44 @@ func (m *Manager) Watch() chan *Config {
 	return watcher
 }
 
+// OnReload registers a function called after every reload attempt, successful or not
+func (m *Manager) OnReload(fn func(ReloadEvent)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
 // Reload reloads configuration from the original sources
 func (m *Manager) Reload() error {
-	return m.Load(m.configPath)
+	oldConfig := m.Get()
+	m.mu.RLock()
+	configPath := m.configPath
+	m.mu.RUnlock()
+	err := m.Load(configPath)
+	m.emitReload(oldConfig, err)
+	return err
+}
+
+// emitReload reports a reload attempt to the registered listeners
+func (m *Manager) emitReload(oldConfig *Config, err error) {
+	event := ReloadEvent{Time: time.Now().UTC(), Result: "success"}
+	current := m.Get()
+	event.Hash = Hash(current)
+	if err != nil {
+		event.Result = "failure"
+		event.Error = err.Error()
+	} else {
+		event.Changes = Diff(oldConfig, current)
+	}
+
+	m.mu.RLock()
+	listeners := make([]func(ReloadEvent), len(m.listeners))
+	copy(listeners, m.listeners)
+	m.mu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(event)
+	}
 }
 
 // loadDefaults sets default values
@@ -252,6 +1216,8 @@ func (m *Manager) loadDefaults() {
 			WriteTimeout: 30 * time.Second,
 			IdleTimeout:  120 * time.Second,
 			MaxConns:     1000,
+
+			MaintenanceGrace: 30 * time.Second,
 		},
 		Agent: AgentConfig{
 			MaxConcurrent:       50,
@@ -261,6 +1227,17 @@ func (m *Manager) loadDefaults() {
 			RetryDelay:          5 * time.Second,
 			SessionTimeout:      60 * time.Minute,
 			MaxHistory:          100,
+			PoolSize:            2,
+			MaxSessionManagers:  5000,
+			MaxAgents:           1000,
+			EventHistory:        50,
+			DraftInterval:       5 * time.Second,
+			DraftBytes:          4096,
+			Degradation: DegradationConfig{
+				Utilization:        0.8,
+				RecoverUtilization: 0.6,
+				SkipTools:          true,
+			},
 		},
 		LLM: LLMConfig{
 			Provider:      "openai",
@@ -269,18 +1246,38 @@ func (m *Manager) loadDefaults() {
 			MaxTokens:     4096,
 			Timeout:       60 * time.Second,
 			RetryAttempts: 3,
+			ReasoningMode: "stream",
+			Breaker: BreakerConfig{
+				Enabled:        true,
+				FailureRate:    0.5,
+				MinRequests:    5,
+				Window:         60 * time.Second,
+				CoolDown:       30 * time.Second,
+				HalfOpenProbes: 1,
+			},
 		},
 		Database: DatabaseConfig{
-			Type:     "sqlite",
-			FilePath: "./data/chat.db",
+			Type:           "file",
+			FilePath:       "./data/chat.db",
+			WriteQueueSize: 256,
+			ImportMaxBytes: 10 << 20,
+			Retention: RetentionConfig{
+				Interval: time.Hour,
+			},
 		},
 		Security: SecurityConfig{
-			JWTSecret:         "your-secret-key",
+			JWTSecret:         DefaultJWTSecret,
 			SessionTimeout:    24 * time.Hour,
 			RateLimitEnabled:  true,
 			RateLimitRPS:      10,
 			CorsEnabled:       true,
 			EncryptionEnabled: false,
+			DemoUsers:         true,
+			RegistrationMode:  "open",
+			Verification: VerificationConfig{
+				TokenTTL:       24 * time.Hour,
+				ResendInterval: time.Minute,
+			},
 		},
 		Monitoring: MonitoringConfig{
 			Enabled:             true,
@@ -288,6 +1285,7 @@ func (m *Manager) loadDefaults() {
 			TracingEnabled:      false,
 			HealthCheckEnabled:  true,
 			HealthCheckInterval: 30 * time.Second,
+			HealthPort:          0,
 		},
 		Logging: LoggingConfig{
 			Level:      "info",
@@ -297,6 +1295,11 @@ func (m *Manager) loadDefaults() {
 			MaxBackups: 3,
 			MaxAge:     28,
 			Compress:   true,
+			AuditFile:  "./logs/audit.log",
+
+			ContentDebugOnly: true,
+			MaxContentLength: 200,
+			HashSessionIDs:   false,
 		},
 		Cache: CacheConfig{
 			Type:    "memory",
@@ -312,6 +1315,102 @@ func (m *Manager) loadDefaults() {
 			VoiceEnabled:      false,
 			FeedbackEnabled:   true,
 		},
+		Usage: UsageConfig{
+			Enabled:       false,
+			EventInterval: 10,
+		},
+		Tagging: TaggingConfig{
+			Enabled: false,
+			Every:   6,
+			MaxTags: 3,
+		},
+		Suggestions: SuggestionsConfig{
+			Enabled: false,
+			Max:     3,
+		},
+		Typing: TypingConfig{
+			Enabled:  true,
+			LiveText: false,
+			Interval: 500 * time.Millisecond,
+		},
+		Memories: MemoriesConfig{
+			Extract:        false,
+			Every:          10,
+			MaxPromptChars: 1500,
+		},
+		Skills: SkillsConfig{
+			MaxPackageSize:   10,
+			RequireSignature: false,
+			KeepVersions:     3,
+		},
+		Testing: TestingConfig{
+			FaultInjection: FaultInjectionConfig{
+				Enabled:  false,
+				Header:   "X-Fault-Injection",
+				LLMDelay: 10 * time.Second,
+			},
+		},
+		Dataset: DatasetConfig{
+			Enabled:       false,
+			Dir:           "./data/dataset",
+			SampleRate:    0.05,
+			MaxFileSize:   100,
+			RetentionDays: 30,
+		},
+		Budget: BudgetConfig{
+			Enabled:   false,
+			Timezone:  "UTC",
+			StatePath: "./data/budget.json",
+		},
+		SMTP: SMTPConfig{
+			Port: 587,
+		},
+		Policy: PolicyConfig{
+			TopicScope: TopicScopeConfig{
+				Refusal:         DefaultTopicRefusal,
+				ClassifyTimeout: 5 * time.Second,
+			},
+		},
+		Activity: ActivityConfig{
+			Enabled:       true,
+			Timezone:      "UTC",
+			RetentionDays: 90,
+			FlushInterval: time.Minute,
+			StatePath:     "./data/activity.json",
+		},
+		Workspaces: WorkspacesConfig{
+			StatePath: "./data/workspaces.json",
+		},
+		Privacy: PrivacyConfig{
+			ExportPrivacy: false,
+			Forced:        false,
+			MaxTextLength: 200,
+			LongText:      "summarize",
+		},
+		UI: UIConfig{
+			ChatTitle:      "聊天智能体",
+			AppLogo:        "/static/images/logo.png",
+			RedactPreviews: true,
+		},
+		Tools: ToolsConfig{
+			Sandbox: SandboxConfig{
+				Enabled:    false,
+				Root:       "./sandbox",
+				AllowedEnv: []string{"PATH", "HOME", "LANG", "LC_ALL", "TZ"},
+				ReadOnly:   false,
+			},
+			Quotas: ToolQuotaConfig{
+				Enabled:   false,
+				Timezone:  "UTC",
+				StatePath: "./data/tool_quotas.json",
+			},
+			MCP: MCPConfig{
+				Lazy:           false,
+				StartupTimeout: 60 * time.Second,
+				MaxServers:     0,
+				ManifestCache:  "./data/mcp_manifests.json",
+			},
+		},
 	}
 }
 
@@ -432,6 +1531,9 @@ func (m *Manager) validate() error {
 	if m.config.Server.Port <= 0 || m.config.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port: %d", m.config.Server.Port)
 	}
+	if hp := m.config.Monitoring.HealthPort; hp < 0 || hp > 65535 || hp == m.config.Server.Port {
+		return fmt.Errorf("invalid health port: %d", hp)
+	}
 
 	// Validate LLM configuration
 	if m.config.LLM.APIKey == "" {
@@ -443,12 +1545,100 @@ func (m *Manager) validate() error {
 		return fmt.Errorf("max concurrent must be positive")
 	}
 
+	if err := validateAgentCaps(m.config.Agent); err != nil {
+		return err
+	}
+
+	if err := validateBreaker(m.config.LLM.Breaker); err != nil {
+		return err
+	}
+
+	if err := validateExperiments(m.config.Experiments); err != nil {
+		return err
+	}
+
+	if err := validatePersonas(m.config.UI.Personas); err != nil {
+		return err
+	}
+
+	if err := validateBudget(m.config.Budget); err != nil {
+		return err
+	}
+	if err := validateActivity(m.config.Activity); err != nil {
+		return err
+	}
+	if err := validateWorkspaces(m.config.Workspaces); err != nil {
+		return err
+	}
+	if err := validateTopicScope(m.config.Policy.TopicScope); err != nil {
+		return err
+	}
+	if err := validateToolQuotas(m.config.Tools.Quotas); err != nil {
+		return err
+	}
+	if err := validateMCP(m.config.Tools.MCP); err != nil {
+		return err
+	}
+	if err := validateEgress(m.config.Security.Egress); err != nil {
+		return err
+	}
+	if err := validateRegistrationMode(m.config.Security.RegistrationMode); err != nil {
+		return err
+	}
+	if err := validatePrivacy(m.config.Privacy); err != nil {
+		return err
+	}
+	if err := validateBasePath(m.config.Server.BasePath); err != nil {
+		return err
+	}
+	if err := validateImportMaxBytes(m.config.Database.ImportMaxBytes); err != nil {
+		return err
+	}
+	if err := validateRetention(m.config.Database.Retention); err != nil {
+		return err
+	}
+	if err := validateVerification(m.config.Security.Verification, m.config.SMTP, m.config.Server.PublicURL); err != nil {
+		return err
+	}
+	if err := validateFaultInjection(m.config.Testing.FaultInjection, m.environment); err != nil {
+		return err
+	}
+	if err := validateSkills(m.config.Skills); err != nil {
+		return err
+	}
+	if err := validateMemories(m.config.Memories); err != nil {
+		return err
+	}
+	if err := validateTyping(m.config.Typing); err != nil {
+		return err
+	}
+	if err := validateDegradation(m.config.Agent.Degradation); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateBreaker validates the LLM circuit breaker settings
+func validateBreaker(breaker BreakerConfig) error {
+	if !breaker.Enabled {
+		return nil
+	}
+	if breaker.FailureRate <= 0 || breaker.FailureRate > 1 {
+		return fmt.Errorf("LLM breaker failure rate must be in (0, 1], got %v", breaker.FailureRate)
+	}
+	if breaker.Window <= 0 || breaker.CoolDown <= 0 {
+		return fmt.Errorf("LLM breaker window and cool-down must be positive")
+	}
 	return nil
 }
 
 // notifyWatchers notifies all watchers of configuration changes
 func (m *Manager) notifyWatchers() {
 	configCopy := m.Get()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	for _, watcher := range m.watchers {
 		select {
 		case watcher <- configCopy:
@@ -460,7 +1650,10 @@ func (m *Manager) notifyWatchers() {
 
 // StartWatching starts watching the configuration file for changes
 func (m *Manager) StartWatching() error {
-	if m.watching || m.configPath == "" {
+	m.watchMu.Lock()
+	defer m.watchMu.Unlock()
+
+	if m.watcher != nil || m.configPath == "" {
 		return nil
 	}
 
@@ -469,45 +1662,52 @@ func (m *Manager) StartWatching() error {
 		return fmt.Errorf("failed to create file watcher: %w", err)
 	}
 
-	m.watcher = watcher
-	m.watching = true
-
 	// Watch the config file
 	configDir := filepath.Dir(m.configPath)
-	if err := m.watcher.Add(configDir); err != nil {
-		m.watcher.Close()
-		m.watching = false
+	if err := watcher.Add(configDir); err != nil {
+		watcher.Close()
 		return fmt.Errorf("failed to watch config directory: %w", err)
 	}
 
-	// Start watching in background
-	go m.watchConfigFile()
+	m.watcher = watcher
+	m.watchDone = make(chan struct{})
+
+	// Start watching in background; Load sets configPath while the watcher runs
+	go m.watchConfigFile(watcher, m.configPath, m.watchDone)
 
 	return nil
 }
 
-// StopWatching stops watching the configuration file
+// StopWatching stops watching the configuration file and waits for a reload
+// in progress to finish. It can be called more than once.
 func (m *Manager) StopWatching() {
-	if !m.watching || m.watcher == nil {
+	m.watchMu.Lock()
+	defer m.watchMu.Unlock()
+
+	if m.watcher == nil {
 		return
 	}
 
-	m.watching = false
 	m.watcher.Close()
+	<-m.watchDone
 	m.watcher = nil
+	m.watchDone = nil
 }
 
-// watchConfigFile watches for configuration file changes
-func (m *Manager) watchConfigFile() {
-	for m.watching {
+// watchConfigFile watches for changes of the configuration file at
+// configPath until the watcher is closed
+func (m *Manager) watchConfigFile(watcher *fsnotify.Watcher, configPath string, done chan struct{}) {
+	defer close(done)
+
+	for {
 		select {
-		case event, ok := <-m.watcher.Events:
+		case event, ok := <-watcher.Events:
 			if !ok {
 				return
 			}
 
 			// Check if the event is for our config file
-			if filepath.Clean(event.Name) != filepath.Clean(m.configPath) {
+			if filepath.Clean(event.Name) != filepath.Clean(configPath) {
 				continue
 			}
 
@@ -517,39 +1717,39 @@ func (m *Manager) watchConfigFile() {
 				// Debounce rapid file changes
 				time.Sleep(100 * time.Millisecond)
 
-				if err := m.reloadConfig(); err != nil {
+				oldConfig := m.Get()
+				err := m.reloadConfig(configPath)
+				if err != nil {
 					// Log error but continue watching
-					fmt.Printf("Error reloading config: %v\n", err)
+					log.Printf("Warning: Failed to reload config from %s: %v", configPath, err)
 				} else {
-					fmt.Println("Configuration reloaded successfully")
+					log.Printf("Configuration reloaded from %s", configPath)
 				}
+				m.emitReload(oldConfig, err)
 			}
 
-		case err, ok := <-m.watcher.Errors:
+		case err, ok := <-watcher.Errors:
 			if !ok {
 				return
 			}
-			fmt.Printf("Config watcher error: %v\n", err)
+			log.Printf("Warning: Config watcher error: %v", err)
 		}
 	}
 }
 
-// reloadConfig reloads the configuration from file
-func (m *Manager) reloadConfig() error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
+// reloadConfig reloads the configuration from the file at configPath
+func (m *Manager) reloadConfig(configPath string) error {
 	// Create new config instance
 	newConfig := &Config{}
 
 	// Load from file
-	data, err := os.ReadFile(m.configPath)
+	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	// Parse based on file extension
-	ext := strings.ToLower(filepath.Ext(m.configPath))
+	ext := strings.ToLower(filepath.Ext(configPath))
 	if ext == ".json" {
 		if err := json.Unmarshal(data, newConfig); err != nil {
 			return fmt.Errorf("failed to parse JSON config: %w", err)
@@ -574,9 +1774,11 @@ func (m *Manager) reloadConfig() error {
 	}
 
 	// Apply new configuration
+	m.mu.Lock()
 	m.config = newConfig
+	m.mu.Unlock()
 
-	// Notify watchers of changes
+	// Notify watchers of changes; Get takes the read lock, so this must run unlocked
 	m.notifyWatchers()
 
 	return nil
@@ -587,14 +1789,88 @@ func (m *Manager) validateConfig(config *Config) error {
 	if config.Server.Port <= 0 || config.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port: %d", config.Server.Port)
 	}
+	if hp := config.Monitoring.HealthPort; hp < 0 || hp > 65535 || hp == config.Server.Port {
+		return fmt.Errorf("invalid health port: %d", hp)
+	}
 
 	if config.Agent.MaxConcurrent <= 0 {
 		return fmt.Errorf("invalid max concurrent agents: %d", config.Agent.MaxConcurrent)
 	}
 
+	if err := validateAgentCaps(config.Agent); err != nil {
+		return err
+	}
+
 	if config.LLM.Model == "" {
 		return fmt.Errorf("LLM model cannot be empty")
 	}
 
+	if err := validateBreaker(config.LLM.Breaker); err != nil {
+		return err
+	}
+
+	if err := validateExperiments(config.Experiments); err != nil {
+		return err
+	}
+
+	if err := validatePersonas(config.UI.Personas); err != nil {
+		return err
+	}
+
+	if err := validateBudget(config.Budget); err != nil {
+		return err
+	}
+	if err := validateActivity(config.Activity); err != nil {
+		return err
+	}
+	if err := validateWorkspaces(config.Workspaces); err != nil {
+		return err
+	}
+	if err := validateTopicScope(config.Policy.TopicScope); err != nil {
+		return err
+	}
+	if err := validateToolQuotas(config.Tools.Quotas); err != nil {
+		return err
+	}
+	if err := validateMCP(config.Tools.MCP); err != nil {
+		return err
+	}
+	if err := validateEgress(config.Security.Egress); err != nil {
+		return err
+	}
+	if err := validateRegistrationMode(config.Security.RegistrationMode); err != nil {
+		return err
+	}
+	if err := validatePrivacy(config.Privacy); err != nil {
+		return err
+	}
+	if err := validateBasePath(config.Server.BasePath); err != nil {
+		return err
+	}
+	if err := validateImportMaxBytes(config.Database.ImportMaxBytes); err != nil {
+		return err
+	}
+	if err := validateRetention(config.Database.Retention); err != nil {
+		return err
+	}
+	if err := validateVerification(config.Security.Verification, config.SMTP, config.Server.PublicURL); err != nil {
+		return err
+	}
+	if err := validateFaultInjection(config.Testing.FaultInjection, m.environment); err != nil {
+		return err
+	}
+	if err := validateSkills(config.Skills); err != nil {
+		return err
+	}
+	if err := validateMemories(config.Memories); err != nil {
+		return err
+	}
+	if err := validateTyping(config.Typing); err != nil {
+		return err
+	}
+	if err := validateDegradation(config.Agent.Degradation); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// redacted replaces secret values in diffs and logs
+const redacted = "[REDACTED]"
+
+// secretFields are config fields (by json name) whose values must never be logged
+var secretFields = map[string]bool{
+	"api_key":        true,
+	"aux_api_key":    true,
+	"jwt_secret":     true,
+	"password":       true,
+	"encryption_key": true,
+	"redis_url":      true, // may embed credentials
+}
+
+// FieldChange describes a single changed configuration value
+type FieldChange struct {
+	Path string `json:"path"` // dotted json path, e.g. "llm.model"
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// ReloadEvent describes the outcome of a configuration hot-reload
+type ReloadEvent struct {
+	Time    time.Time     `json:"time"`
+	Result  string        `json:"result"` // "success" or "failure"
+	Error   string        `json:"error,omitempty"`
+	Hash    string        `json:"hash,omitempty"` // content hash of the active config
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// Hash returns a short content hash of the configuration
+func Hash(config *Config) string {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// Diff returns the paths of all fields that differ between two configurations.
+// Secret values are redacted.
+func Diff(oldConfig, newConfig *Config) []FieldChange {
+	var changes []FieldChange
+	diffValue("", reflect.ValueOf(*oldConfig), reflect.ValueOf(*newConfig), false, &changes)
+	return changes
+}
+
+// diffValue recursively compares two values of the same type
+func diffValue(path string, oldVal, newVal reflect.Value, secret bool, changes *[]FieldChange) {
+	if oldVal.Kind() == reflect.Struct && oldVal.Type() != reflect.TypeOf(time.Time{}) {
+		t := oldVal.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := fieldName(field)
+			diffValue(joinPath(path, name), oldVal.Field(i), newVal.Field(i), secret || isSecretField(name), changes)
+		}
+		return
+	}
+
+	// Slices and maps are compared as a whole; nil and empty are treated the same
+	if (oldVal.Kind() == reflect.Slice || oldVal.Kind() == reflect.Map) && oldVal.Len() == 0 && newVal.Len() == 0 {
+		return
+	}
+	if reflect.DeepEqual(oldVal.Interface(), newVal.Interface()) {
+		return
+	}
+
+	change := FieldChange{Path: path, Old: formatValue(oldVal), New: formatValue(newVal)}
+	if secret {
+		change.Old, change.New = redacted, redacted
+	}
+	*changes = append(*changes, change)
+}
+
+// formatValue renders a config value for a diff
+func formatValue(v reflect.Value) string {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		if v.Len() == 0 {
+			if v.Kind() == reflect.Map {
+				return "{}"
+			}
+			return "[]"
+		}
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return fmt.Sprintf("%v", v.Interface())
+		}
+		return string(data)
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	default:
+		return fmt.Sprintf("%v", v.Interface())
+	}
+}
+
+// fieldName returns the json name of a struct field
+func fieldName(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		if name, _, _ := strings.Cut(tag, ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// isSecretField reports whether a field holds a credential
+func isSecretField(name string) bool {
+	return secretFields[name] || strings.HasSuffix(name, "_secret") || strings.HasSuffix(name, "_password") || strings.HasSuffix(name, "_token")
+}
+
+// joinPath appends a field name to a dotted path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,66 @@
+package config
+
+import "fmt"
+
+// ExperimentConfig defines an A/B test of system prompts, models or LLM parameters
+type ExperimentConfig struct {
+	Name string `json:"name" yaml:"name"`
+	// Disabled is the kill switch; after a hot-reload no new turns are assigned to the experiment
+	Disabled bool            `json:"disabled" yaml:"disabled"`
+	Cohort   CohortConfig    `json:"cohort" yaml:"cohort"`
+	Variants []VariantConfig `json:"variants" yaml:"variants"`
+}
+
+// CohortConfig selects the users enrolled in an experiment
+type CohortConfig struct {
+	Roles   []string `json:"roles" yaml:"roles"`     // users with any of these roles; empty matches everyone
+	Users   []string `json:"users" yaml:"users"`     // user IDs; empty matches everyone
+	Percent int      `json:"percent" yaml:"percent"` // share of matching users enrolled, 1-100; 0 enrolls all
+}
+
+// VariantConfig is one arm of an experiment. Empty fields keep the server defaults.
+type VariantConfig struct {
+	Name string `json:"name" yaml:"name"`
+	// Weight is the relative share of traffic; variants without weights split traffic evenly
+	Weight       int      `json:"weight" yaml:"weight"`
+	SystemPrompt string   `json:"system_prompt" yaml:"system_prompt"`
+	Model        string   `json:"model" yaml:"model"`
+	Temperature  *float64 `json:"temperature" yaml:"temperature"`
+	MaxTokens    int      `json:"max_tokens" yaml:"max_tokens"`
+}
+
+// validateExperiments checks that experiments and their variants are well-formed
+func validateExperiments(experiments []ExperimentConfig) error {
+	names := make(map[string]bool)
+	for _, exp := range experiments {
+		if exp.Name == "" {
+			return fmt.Errorf("experiment name cannot be empty")
+		}
+		if names[exp.Name] {
+			return fmt.Errorf("duplicate experiment: %s", exp.Name)
+		}
+		names[exp.Name] = true
+
+		if len(exp.Variants) == 0 {
+			return fmt.Errorf("experiment %s has no variants", exp.Name)
+		}
+		if exp.Cohort.Percent < 0 || exp.Cohort.Percent > 100 {
+			return fmt.Errorf("experiment %s: cohort percent must be between 0 and 100", exp.Name)
+		}
+
+		variants := make(map[string]bool)
+		for _, v := range exp.Variants {
+			if v.Name == "" {
+				return fmt.Errorf("experiment %s: variant name cannot be empty", exp.Name)
+			}
+			if variants[v.Name] {
+				return fmt.Errorf("experiment %s: duplicate variant %s", exp.Name, v.Name)
+			}
+			variants[v.Name] = true
+			if v.Weight < 0 {
+				return fmt.Errorf("experiment %s: variant %s has a negative weight", exp.Name, v.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// DefaultJWTSecret is the placeholder secret shipped in the default configuration
+const DefaultJWTSecret = "your-secret-key"
+
+// minJWTSecretLength is the shortest JWT secret accepted in production
+const minJWTSecretLength = 32
+
+// CheckStatus is the outcome of a security check
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "fail"
+)
+
+// SecurityCheck is a single production-hardening check
+type SecurityCheck struct {
+	Name    string      `json:"name"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+}
+
+// EnvironmentFromEnv returns the deployment environment named by the
+// ENVIRONMENT variable, defaulting to Development
+func EnvironmentFromEnv() Environment {
+	switch env := Environment(strings.ToLower(strings.TrimSpace(os.Getenv("ENVIRONMENT")))); env {
+	case Testing, Staging, Production:
+		return env
+	case "prod":
+		return Production
+	default:
+		return Development
+	}
+}
+
+// Environment returns the deployment environment of the manager
+func (m *Manager) Environment() Environment {
+	return m.environment
+}
+
+// CheckSecurity runs the production-hardening checks against a configuration.
+// Problems that block a production start are reported as failures in
+// production and as warnings in every other environment.
+func CheckSecurity(config *Config, env Environment) []SecurityCheck {
+	severe := CheckFail
+	if env != Production {
+		severe = CheckWarn
+	}
+
+	var checks []SecurityCheck
+	add := func(name string, ok bool, status CheckStatus, problem, fine string) {
+		if ok {
+			checks = append(checks, SecurityCheck{Name: name, Status: CheckPass, Message: fine})
+		} else {
+			checks = append(checks, SecurityCheck{Name: name, Status: status, Message: problem})
+		}
+	}
+
+	secret := config.Security.JWTSecret
+	switch {
+	case secret == "" || secret == DefaultJWTSecret:
+		add("jwt_secret", false, severe, "JWT secret is empty or the default placeholder; set JWT_SECRET", "")
+	default:
+		add("jwt_secret", len(secret) >= minJWTSecretLength, severe,
+			fmt.Sprintf("JWT secret is only %d characters; use at least %d", len(secret), minJWTSecretLength),
+			"JWT secret is set")
+	}
+
+	add("demo_users", !config.Security.DemoUsers, severe,
+		"demo users with well-known passwords are enabled; set SECURITY_DEMO_USERS=false",
+		"demo users are disabled")
+
+	tlsEnabled := config.Server.TLSCertFile != "" && config.Server.TLSKeyFile != ""
+	switch {
+	case tlsEnabled:
+		add("tls", true, "", "", "TLS is enabled")
+	case len(config.Server.TrustedProxies) > 0:
+		add("tls", true, "", "", "TLS is terminated by a trusted proxy")
+	default:
+		add("tls", false, severe,
+			"TLS is off and no trusted proxy is declared; set SERVER_TLS_CERT_FILE/SERVER_TLS_KEY_FILE or SERVER_TRUSTED_PROXIES", "")
+	}
+
+	if config.Security.EncryptionEnabled {
+		add("encryption_key", config.Security.EncryptionKey != "", severe,
+			"encryption is enabled but no encryption key is set", "encryption key is set")
+	}
+
+	openCORS := len(config.Security.AllowedOrigins) == 0 || slices.Contains(config.Security.AllowedOrigins, "*")
+	if config.Security.CorsEnabled {
+		add("cors", !openCORS, CheckWarn, "CORS allows any origin; restrict ALLOWED_ORIGINS", "CORS is restricted to allowed origins")
+	}
+
+	add("registration", config.Security.RegistrationMode != "open", CheckWarn,
+		"anyone who finds the server can register; set SECURITY_REGISTRATION_MODE=invite or closed",
+		"registration is restricted")
+
+	add("rate_limit", config.Security.RateLimitEnabled, CheckWarn, "rate limiting is disabled", "rate limiting is enabled")
+
+	// Unkeyed hashes of user IDs can be reversed by hashing candidate IDs;
+	// forced privacy does not validate without a secret
+	if config.Privacy.Forced || config.Privacy.ExportPrivacy {
+		add("export_privacy", config.Privacy.HashSecret != "", CheckWarn, "export privacy is on but PRIVACY_HASH_SECRET is empty", "exported identifiers are hashed with a secret key")
+	}
+
+	add("egress_private", config.Security.Egress.BlockPrivate, CheckWarn,
+		"tools and MCP servers can connect to private networks and the cloud metadata service; set EGRESS_BLOCK_PRIVATE=true",
+		"outbound connections of tools to private networks are blocked")
+
+	add("llm_tls_verify", !config.LLM.InsecureSkipVerify, severe,
+		"TLS certificate verification of outbound requests is disabled; set llm.ca_bundle instead of llm.insecure_skip_verify",
+		"outbound TLS certificates are verified")
+
+	// Passwords are stored with a reversible encoding until a real KDF is in place
+	add("password_storage", false, CheckWarn, "user passwords are stored with reversible encoding, not a password hash", "")
+
+	return checks
+}
+
+// SecurityFailures returns the checks that failed
+func SecurityFailures(checks []SecurityCheck) []SecurityCheck {
+	var failed []SecurityCheck
+	for _, check := range checks {
+		if check.Status == CheckFail {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,418 @@
+package dataset
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+const (
+	// dayLayout names the daily dataset files
+	dayLayout = "2006-01-02"
+	// maxLineSize bounds a single record when reading files back
+	maxLineSize = 16 << 20
+)
+
+// Record types
+const (
+	TypeSample   = "sample"
+	TypeFeedback = "feedback"
+)
+
+// ToolUse summarizes a tool call made while answering; arguments are not
+// recorded because they often contain user data
+type ToolUse struct {
+	Name       string `json:"name"`
+	Source     string `json:"source,omitempty"`
+	Success    bool   `json:"success"`
+	ErrorClass string `json:"error_class,omitempty"`
+	Attempts   int    `json:"attempts,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Record is a line of a dataset file. Feedback arrives after the sample and is
+// written as a separate record; Export joins it into the sample.
+type Record struct {
+	Type       string         `json:"type"` // "sample" or "feedback"
+	Timestamp  time.Time      `json:"timestamp"`
+	MessageID  string         `json:"message_id"`
+	SessionID  string         `json:"session_id,omitempty"`
+	UserID     string         `json:"user,omitempty"` // pseudonymized before writing
+	Model      string         `json:"model,omitempty"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+	Prompt     string         `json:"prompt,omitempty"`
+	Response   string         `json:"response,omitempty"`
+	Tools      []ToolUse      `json:"tools,omitempty"`
+	LatencyMs  int64          `json:"latency_ms,omitempty"`
+	Experiment string         `json:"experiment,omitempty"`
+	Variant    string         `json:"variant,omitempty"`
+	Feedback   string         `json:"feedback,omitempty"`
+}
+
+// Logger appends sampled chat turns as JSON lines to daily files, rotating them
+// by size and deleting them after the retention period
+type Logger struct {
+	mu         sync.Mutex
+	dir        string
+	sampleRate float64
+	maxSize    int64
+	retention  time.Duration
+	redactor   *redact.Redactor
+
+	file *os.File
+	day  string
+	seq  int
+	size int64
+}
+
+// NewLogger creates a dataset logger. A disabled configuration returns a nil
+// Logger, on which all methods are no-ops.
+func NewLogger(config configpkg.DatasetConfig) (*Logger, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return nil, fmt.Errorf("dataset sample rate must be between 0 and 1, got %v", config.SampleRate)
+	}
+
+	redactor, err := redact.New(config.RedactPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create dataset directory: %w", err)
+	}
+
+	l := &Logger{
+		dir:        config.Dir,
+		sampleRate: config.SampleRate,
+		maxSize:    int64(config.MaxFileSize) << 20,
+		retention:  time.Duration(config.RetentionDays) * 24 * time.Hour,
+		redactor:   redactor,
+	}
+	l.cleanup(time.Now().UTC())
+	return l, nil
+}
+
+// Sampled reports whether a message belongs to the sample. The decision is a
+// hash of the message ID, so later feedback for the message is sampled the same way.
+func (l *Logger) Sampled(messageID string) bool {
+	if l == nil || messageID == "" {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(messageID))
+	return float64(h.Sum32()%10000) < l.sampleRate*10000
+}
+
+// Log records a chat turn if it is sampled. Prompt and response are scrubbed
+// of personal data and the user ID is pseudonymized.
+func (l *Logger) Log(record Record) {
+	if !l.Sampled(record.MessageID) {
+		return
+	}
+
+	record.Type = TypeSample
+	record.Prompt = l.redactor.Redact(record.Prompt)
+	record.Response = l.redactor.Redact(record.Response)
+	if record.UserID != "" {
+		record.UserID = pseudonym(record.UserID)
+	}
+	record.Feedback = ""
+	l.write(record)
+}
+
+// LogFeedback records feedback for a sampled message
+func (l *Logger) LogFeedback(messageID, feedback string) {
+	if !l.Sampled(messageID) {
+		return
+	}
+	l.write(Record{Type: TypeFeedback, MessageID: messageID, Feedback: feedback})
+}
+
+// write appends a record to the current file, rotating it when needed
+func (l *Logger) write(record Record) {
+	now := time.Now().UTC()
+	if record.Timestamp.IsZero() {
+		record.Timestamp = now
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Warning: Failed to marshal dataset record: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.rotate(now); err != nil {
+		log.Printf("Warning: Failed to open dataset file: %v", err)
+		return
+	}
+
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("Warning: Failed to write dataset record: %v", err)
+	}
+}
+
+// rotate opens a new file on a new day or when the current one is full.
+// The caller must hold l.mu.
+func (l *Logger) rotate(now time.Time) error {
+	day := now.Format(dayLayout)
+	full := l.maxSize > 0 && l.size >= l.maxSize
+	if l.file != nil && day == l.day && !full {
+		return nil
+	}
+
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			log.Printf("Warning: Failed to close dataset file: %v", err)
+		}
+		l.file = nil
+	}
+
+	if day != l.day {
+		l.day, l.seq = day, 0
+		l.cleanup(now)
+	}
+
+	// Continue the last file of the day unless it is full, e.g. after a restart
+	for ; ; l.seq++ {
+		path := filepath.Join(l.dir, fileName(day, l.seq))
+		info, err := os.Stat(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil && l.maxSize > 0 && info.Size() >= l.maxSize {
+			continue
+		}
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		l.file = file
+		l.size = 0
+		if info != nil {
+			l.size = info.Size()
+		}
+		return nil
+	}
+}
+
+// cleanup deletes files older than the retention period
+func (l *Logger) cleanup(now time.Time) {
+	if l.retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-l.retention).Format(dayLayout)
+
+	files, err := l.files()
+	if err != nil {
+		log.Printf("Warning: Failed to list dataset files: %v", err)
+		return
+	}
+	for _, f := range files {
+		if f.day >= cutoff {
+			continue
+		}
+		if err := os.Remove(filepath.Join(l.dir, f.name)); err != nil {
+			log.Printf("Warning: Failed to delete expired dataset file %s: %v", f.name, err)
+		}
+	}
+}
+
+// Export writes the samples of the given days (inclusive, UTC) as JSON lines,
+// with feedback that arrived later joined in. transform, if not nil, may
+// rewrite each sample before it is written.
+func (l *Logger) Export(w io.Writer, from, to time.Time, transform func(*Record)) error {
+	if l == nil {
+		return fmt.Errorf("dataset logging is disabled")
+	}
+	first, last := from.UTC().Format(dayLayout), to.UTC().Format(dayLayout)
+
+	files, err := l.files()
+	if err != nil {
+		return fmt.Errorf("failed to list dataset files: %w", err)
+	}
+
+	// Feedback may be given days after the answer, so look at every later file
+	feedback := make(map[string]string)
+	for _, f := range files {
+		if f.day < first {
+			continue
+		}
+		err := l.scan(f.name, func(record Record) error {
+			if record.Type == TypeFeedback {
+				feedback[record.MessageID] = record.Feedback
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, f := range files {
+		if f.day < first || f.day > last {
+			continue
+		}
+		err := l.scan(f.name, func(record Record) error {
+			if record.Type != TypeSample {
+				return nil
+			}
+			record.Feedback = feedback[record.MessageID]
+			if transform != nil {
+				transform(&record)
+			}
+			return encoder.Encode(record)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scan calls fn for every record of a file, skipping lines that cannot be parsed
+func (l *Logger) scan(name string, fn func(Record) error) error {
+	file, err := os.Open(filepath.Join(l.dir, name))
+	if os.IsNotExist(err) {
+		// Deleted by retention since it was listed
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open dataset file %s: %w", name, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A partially written last line or a corrupt record
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read dataset file %s: %w", name, err)
+	}
+	return nil
+}
+
+// datasetFile is a dataset file name split into its day and rotation sequence
+type datasetFile struct {
+	name string
+	day  string
+	seq  int
+}
+
+// files lists the dataset files in chronological order
+func (l *Logger) files() ([]datasetFile, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []datasetFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if f, ok := parseFileName(entry.Name()); ok {
+			files = append(files, f)
+		}
+	}
+	slices.SortFunc(files, func(a, b datasetFile) int {
+		if c := strings.Compare(a.day, b.day); c != 0 {
+			return c
+		}
+		return a.seq - b.seq
+	})
+	return files, nil
+}
+
+// Close closes the current dataset file
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// fileName returns the name of a dataset file: dataset-<day>.jsonl, then
+// dataset-<day>-<seq>.jsonl for files rotated by size
+func fileName(day string, seq int) string {
+	if seq == 0 {
+		return "dataset-" + day + ".jsonl"
+	}
+	return fmt.Sprintf("dataset-%s-%d.jsonl", day, seq)
+}
+
+// parseFileName is the inverse of fileName
+func parseFileName(name string) (datasetFile, bool) {
+	rest, ok := strings.CutPrefix(name, "dataset-")
+	if !ok {
+		return datasetFile{}, false
+	}
+	rest, ok = strings.CutSuffix(rest, ".jsonl")
+	if !ok || len(rest) < len(dayLayout) {
+		return datasetFile{}, false
+	}
+
+	day, suffix := rest[:len(dayLayout)], rest[len(dayLayout):]
+	if _, err := time.Parse(dayLayout, day); err != nil {
+		return datasetFile{}, false
+	}
+
+	seq := 0
+	if suffix != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(suffix, "-"))
+		if err != nil || !strings.HasPrefix(suffix, "-") || n <= 0 {
+			return datasetFile{}, false
+		}
+		seq = n
+	}
+	return datasetFile{name: name, day: day, seq: seq}, true
+}
+
+// pseudonym replaces a user ID with a stable hash so samples of a user can be
+// grouped without identifying them
+func pseudonym(userID string) string {
+	sum := sha256.Sum256([]byte("langchat-dataset:" + userID))
+	return hex.EncodeToString(sum[:8])
+}
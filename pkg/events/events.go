@@ -0,0 +1,140 @@
+// Package events defines the server-sent events of a streamed chat turn. The
+// server writes them with Writer and Go clients read them with Reader, so
+// both sides share one definition of every payload.
+package events
+
+import (
+	"encoding/json"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+	"github.com/smallnest/langchat/pkg/usage"
+)
+
+// Event types, sent as the SSE event name and as the "type" field of the data
+const (
+	TypeStart       = "start"
+	TypeChunk       = "chunk"
+	TypeReasoning   = "reasoning"
+	TypeToolError   = "tool_error"
+	TypeToolResult  = "tool_result"
+	TypeUsage       = "usage"
+	TypeEnd         = "end"
+	TypeSuggestions = "suggestions"
+	TypeError       = "error"
+)
+
+// Error codes of the error event
+const (
+	CodeLLMUnavailable        = "llm_unavailable"
+	CodeInvalidResponseFormat = "invalid_response_format" // Raw holds the non-conforming answer
+)
+
+// Event is the payload of a server-sent event
+type Event interface {
+	EventType() string
+}
+
+// Start is sent when the answer starts, before any other event
+type Start struct{}
+
+// Chunk is a piece of the answer, including tool notices
+type Chunk struct {
+	Chunk string `json:"chunk"`
+}
+
+// Reasoning is a piece of the model's reasoning trace, never part of the answer
+type Reasoning struct {
+	Chunk string `json:"chunk"`
+}
+
+// ToolError reports a failed tool call
+type ToolError struct {
+	Tool             string   `json:"tool"`
+	Source           string   `json:"source"` // "skill" or "mcp"
+	Error            string   `json:"error"`
+	ErrorClass       string   `json:"error_class"`
+	ValidationErrors []string `json:"validation_errors,omitempty"` // schema violations; the tool was not called
+	Attempts         int      `json:"attempts"`
+}
+
+// ToolResult reports a tool call that was not executed in a dry run
+type ToolResult struct {
+	Tool   string `json:"tool"`
+	Source string `json:"source"`
+	Args   string `json:"args"`
+	DryRun bool   `json:"dry_run"`
+	Result string `json:"result"`
+}
+
+// Usage is the live estimate of the tokens and cost of the answer so far
+type Usage struct {
+	usage.Usage
+}
+
+// End is sent once the answer is complete and saved
+type End struct {
+	Message            string                         `json:"message"`
+	MessageID          string                         `json:"message_id"`
+	Seq                uint64                         `json:"seq,omitempty"` // sequence number of the message in the session
+	ContentHints       sessionpkg.ContentHints        `json:"content_hints"` // lets the client load only the renderers it needs
+	PersistenceWarning string                         `json:"persistence_warning,omitempty"`
+	Degraded           bool                           `json:"degraded,omitempty"` // answered without tools to shed load
+	Refusal            string                         `json:"refusal,omitempty"`  // why the turn was refused without generating an answer
+	Replaced           string                         `json:"replaced,omitempty"` // ID of the answer deleted to regenerate it
+	Decisions          []sessionpkg.SelectionDecision `json:"decisions,omitzero"` // only in debug mode
+	Usage              *usage.Usage                   `json:"usage,omitempty"`    // nil when usage reporting is disabled
+}
+
+// Suggestions are follow-up questions for an answer, sent after its end event
+type Suggestions struct {
+	MessageID   string   `json:"message_id"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// Error ends a turn that failed; Code is set for failures a client may handle
+type Error struct {
+	Error            string   `json:"error"`
+	Code             string   `json:"code,omitempty"`
+	Raw              string   `json:"raw,omitempty"`               // answer of an invalid_response_format error
+	ValidationErrors []string `json:"validation_errors,omitempty"` // why the answer does not conform
+}
+
+func (Start) EventType() string       { return TypeStart }
+func (Chunk) EventType() string       { return TypeChunk }
+func (Reasoning) EventType() string   { return TypeReasoning }
+func (ToolError) EventType() string   { return TypeToolError }
+func (ToolResult) EventType() string  { return TypeToolResult }
+func (Usage) EventType() string       { return TypeUsage }
+func (End) EventType() string         { return TypeEnd }
+func (Suggestions) EventType() string { return TypeSuggestions }
+func (Error) EventType() string       { return TypeError }
+
+// decoders decode the JSON data of each event type
+var decoders = map[string]func([]byte) (Event, error){
+	TypeStart:       decode[Start],
+	TypeChunk:       decode[Chunk],
+	TypeReasoning:   decode[Reasoning],
+	TypeToolError:   decode[ToolError],
+	TypeToolResult:  decode[ToolResult],
+	TypeUsage:       decode[Usage],
+	TypeEnd:         decode[End],
+	TypeSuggestions: decode[Suggestions],
+	TypeError:       decode[Error],
+}
+
+// decode decodes the JSON data of an event of type T
+func decode[T Event](data []byte) (Event, error) {
+	var event T
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Unknown is an event of a type this version does not know, e.g. from a newer server
+type Unknown struct {
+	Type string
+	Data []byte // JSON data of the event
+}
+
+func (u Unknown) EventType() string { return u.Type }
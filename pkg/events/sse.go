@@ -0,0 +1,135 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Marshal returns the JSON data of an event, with its type in the "type" field
+func Marshal(event Event) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s event: %w", event.EventType(), err)
+	}
+	typ, _ := json.Marshal(event.EventType())
+
+	// Splice the type in as the first field of the object
+	var b bytes.Buffer
+	b.WriteString(`{"type":`)
+	b.Write(typ)
+	if body := data[1 : len(data)-1]; len(body) > 0 {
+		b.WriteByte(',')
+		b.Write(body)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// Unmarshal decodes the JSON data of an event of a type; unknown types are
+// returned as Unknown
+func Unmarshal(eventType string, data []byte) (Event, error) {
+	decode, ok := decoders[eventType]
+	if !ok {
+		return Unknown{Type: eventType, Data: data}, nil
+	}
+	event, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s event: %w", eventType, err)
+	}
+	return event, nil
+}
+
+// Writer writes events to an SSE stream. Every event gets the next ID and is
+// flushed right away when the underlying writer is an http.Flusher. It is
+// safe for concurrent use.
+type Writer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	flusher http.Flusher // nil if w does not flush
+	id      int
+}
+
+// NewWriter creates a writer of an SSE stream
+func NewWriter(w io.Writer) *Writer {
+	flusher, _ := w.(http.Flusher)
+	return &Writer{w: w, flusher: flusher}
+}
+
+// Write writes and flushes an event. A failed write means the client is gone.
+func (w *Writer) Write(event Event) error {
+	data, err := Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.id++
+	if _, err := fmt.Fprintf(w.w, "id: %d\nevent: %s\ndata: %s\n\n", w.id, event.EventType(), data); err != nil {
+		return err
+	}
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return nil
+}
+
+// Reader reads the events of an SSE stream written by Writer
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader creates a reader of an SSE stream
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the ID and the event of the next frame; it returns io.EOF at
+// the end of the stream. Comments and fields other than id, event and data
+// are skipped; frames without an event name are of type "message".
+func (r *Reader) Next() (id string, event Event, err error) {
+	var eventType string
+	var data []string
+	for {
+		line, err := r.r.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && (line != "" || eventType != "" || data != nil) {
+				return "", nil, io.ErrUnexpectedEOF // the stream broke off within a frame
+			}
+			return "", nil, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			if eventType == "" && data == nil {
+				continue // blank lines between frames
+			}
+			if eventType == "" {
+				eventType = "message"
+			}
+			event, err := Unmarshal(eventType, []byte(strings.Join(data, "\n")))
+			return id, event, err
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			eventType = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+}
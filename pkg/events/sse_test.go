@@ -0,0 +1,142 @@
+package events
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	sessionpkg "github.com/smallnest/langchat/pkg/session"
+	"github.com/smallnest/langchat/pkg/usage"
+)
+
+// update rewrites the golden files of the wire format
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// stream has an event of every type, with the optional fields set
+var stream = []Event{
+	Start{},
+	Reasoning{Chunk: "The user wants a table."},
+	Chunk{Chunk: "Here is "},
+	Chunk{Chunk: "a table:\n\n| a | b |"},
+	ToolError{Tool: "search", Source: "mcp", Error: "invalid arguments", ErrorClass: "invalid_args",
+		ValidationErrors: []string{"query: required"}, Attempts: 2},
+	ToolResult{Tool: "fetch", Source: "skill", Args: `{"url":"https://example.com"}`, DryRun: true, Result: "would fetch https://example.com"},
+	Usage{Usage: usage.Usage{CompletionTokens: 12, TotalTokens: 12, Estimated: true}},
+	End{
+		Message: "Here is a table:\n\n| a | b |", MessageID: "m1", Seq: 4,
+		ContentHints:       sessionpkg.ContentHints{CodeLanguages: []string{}, HasTable: true},
+		PersistenceWarning: "not saved yet", Degraded: true, Replaced: "m0",
+		Decisions: []sessionpkg.SelectionDecision{{Stage: "tool", Selected: "search", Candidates: []string{"search"}, CandidateCount: 1}},
+		Usage:     &usage.Usage{PromptTokens: 30, CompletionTokens: 12, TotalTokens: 42, Cost: 0.0021, Model: "gpt-4o-mini", CachedTokens: 10},
+	},
+	Suggestions{MessageID: "m1", Suggestions: []string{"Add a column?", "Sort it?"}},
+	Error{Error: "answer is not valid JSON", Code: CodeInvalidResponseFormat, Raw: "{", ValidationErrors: []string{"unexpected end"}},
+}
+
+// writeStream writes events with a Writer and returns the stream
+func writeStream(t *testing.T, events []Event) string {
+	t.Helper()
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	for _, event := range events {
+		if err := w.Write(event); err != nil {
+			t.Fatalf("Write(%T): %v", event, err)
+		}
+	}
+	return b.String()
+}
+
+func TestWriterGolden(t *testing.T) {
+	got := writeStream(t, stream)
+	path := filepath.Join("testdata", "stream.golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("stream differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestReaderReadsWrittenEvents(t *testing.T) {
+	r := NewReader(strings.NewReader(writeStream(t, stream)))
+	for i, want := range stream {
+		id, event, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next %d: %v", i, err)
+		}
+		if wantID := strconv.Itoa(i + 1); id != wantID {
+			t.Errorf("event %d has ID %q, want %q", i, id, wantID)
+		}
+		if !reflect.DeepEqual(event, want) {
+			t.Errorf("event %d = %#v, want %#v", i, event, want)
+		}
+	}
+	if _, _, err := r.Next(); err != io.EOF {
+		t.Fatalf("Next at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestReaderFrames(t *testing.T) {
+	tests := []struct {
+		name, stream string
+		want         Event
+		wantID       string
+	}{
+		{"comments and other fields", ": heartbeat\n\nretry: 1000\nid: 7\nevent: chunk\ndata: {\"chunk\":\"hi\"}\n\n", Chunk{Chunk: "hi"}, "7"},
+		{"CRLF line endings", "event: chunk\r\ndata: {\"chunk\":\"hi\"}\r\n\r\n", Chunk{Chunk: "hi"}, ""},
+		{"data over several lines", "event: chunk\ndata: {\"chunk\":\ndata: \"hi\"}\n\n", Chunk{Chunk: "hi"}, ""},
+		{"unknown type", "event: heartbeat\ndata: {\"at\":1}\n\n", Unknown{Type: "heartbeat", Data: []byte(`{"at":1}`)}, ""},
+		{"without an event name", "data: {}\n\n", Unknown{Type: "message", Data: []byte(`{}`)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, event, err := NewReader(strings.NewReader(tt.stream)).Next()
+			if err != nil {
+				t.Fatalf("Next: %v", err)
+			}
+			if id != tt.wantID || !reflect.DeepEqual(event, tt.want) {
+				t.Fatalf("Next = %q, %#v, want %q, %#v", id, event, tt.wantID, tt.want)
+			}
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	if _, _, err := NewReader(strings.NewReader("event: chunk\ndata: {\"chunk\":")).Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Next of a broken off frame = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if _, _, err := NewReader(strings.NewReader("event: chunk\ndata: {\n\n")).Next(); err == nil || !strings.Contains(err.Error(), "chunk event") {
+		t.Errorf("Next of invalid data = %v, want an unmarshal error", err)
+	}
+	if _, _, err := NewReader(strings.NewReader("\n\n")).Next(); err != io.EOF {
+		t.Errorf("Next of an empty stream = %v, want io.EOF", err)
+	}
+}
+
+// failingWriter fails every write, like the connection of a client that is gone
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+
+func TestWriterReportsFailedWrites(t *testing.T) {
+	if err := NewWriter(failingWriter{}).Write(Chunk{Chunk: "hi"}); err == nil {
+		t.Fatal("Write to a broken connection succeeded")
+	}
+}
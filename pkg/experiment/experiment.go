@@ -0,0 +1,170 @@
+package experiment
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+	"sync"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// Assignment is the experiment variant a user's turn is answered with
+type Assignment struct {
+	Experiment string                  `json:"experiment"`
+	Variant    string                  `json:"variant"`
+	Settings   configpkg.VariantConfig `json:"-"`
+}
+
+// Assign returns the variant of the first running experiment whose cohort the
+// user belongs to, or nil. Assignment is sticky: it only depends on the user ID
+// and the experiment definition.
+func Assign(experiments []configpkg.ExperimentConfig, userID string, roles []string) *Assignment {
+	for _, exp := range experiments {
+		if exp.Disabled || len(exp.Variants) == 0 || !inCohort(exp, userID, roles) {
+			continue
+		}
+		variant := pickVariant(exp, userID)
+		return &Assignment{Experiment: exp.Name, Variant: variant.Name, Settings: variant}
+	}
+	return nil
+}
+
+// inCohort reports whether a user is enrolled in an experiment
+func inCohort(exp configpkg.ExperimentConfig, userID string, roles []string) bool {
+	cohort := exp.Cohort
+	if len(cohort.Users) > 0 && !slices.Contains(cohort.Users, userID) {
+		return false
+	}
+	if len(cohort.Roles) > 0 && !slices.ContainsFunc(roles, func(role string) bool { return slices.Contains(cohort.Roles, role) }) {
+		return false
+	}
+	if cohort.Percent > 0 && cohort.Percent < 100 {
+		return bucket("cohort:"+exp.Name+":"+userID, 100) < uint64(cohort.Percent)
+	}
+	return true
+}
+
+// pickVariant chooses a variant by weight using a hash of the user ID
+func pickVariant(exp configpkg.ExperimentConfig, userID string) configpkg.VariantConfig {
+	total := 0
+	for _, v := range exp.Variants {
+		total += v.Weight
+	}
+	if total == 0 {
+		return exp.Variants[bucket("variant:"+exp.Name+":"+userID, uint64(len(exp.Variants)))]
+	}
+
+	n := int(bucket("variant:"+exp.Name+":"+userID, uint64(total)))
+	for _, v := range exp.Variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return exp.Variants[len(exp.Variants)-1]
+}
+
+// bucket hashes key into [0, n)
+func bucket(key string, n uint64) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8]) % n
+}
+
+// VariantStats summarizes the results of a variant since the server started
+type VariantStats struct {
+	Variant      string  `json:"variant"`
+	Messages     int64   `json:"messages"`
+	Likes        int64   `json:"likes"`
+	Dislikes     int64   `json:"dislikes"`
+	WinRate      float64 `json:"win_rate"` // likes / (likes + dislikes); 0 without feedback
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// variantCounters are the raw counters behind VariantStats
+type variantCounters struct {
+	messages  int64
+	likes     int64
+	dislikes  int64
+	latencyMs int64
+}
+
+// Stats collects per-variant message, latency and feedback counts in memory
+type Stats struct {
+	mu       sync.Mutex
+	counters map[string]map[string]*variantCounters // experiment -> variant -> counters
+}
+
+// NewStats creates an empty statistics collector
+func NewStats() *Stats {
+	return &Stats{counters: make(map[string]map[string]*variantCounters)}
+}
+
+// get returns the counters of a variant. The caller must hold s.mu.
+func (s *Stats) get(experiment, variant string) *variantCounters {
+	variants := s.counters[experiment]
+	if variants == nil {
+		variants = make(map[string]*variantCounters)
+		s.counters[experiment] = variants
+	}
+	c := variants[variant]
+	if c == nil {
+		c = &variantCounters{}
+		variants[variant] = c
+	}
+	return c
+}
+
+// RecordMessage counts an assistant message answered by a variant
+func (s *Stats) RecordMessage(experiment, variant string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.get(experiment, variant)
+	c.messages++
+	c.latencyMs += latency.Milliseconds()
+}
+
+// RecordFeedback counts feedback on a message; previous is the feedback it
+// replaces, so changing a vote is not counted twice
+func (s *Stats) RecordFeedback(experiment, variant, previous, feedback string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.get(experiment, variant)
+	switch previous {
+	case "like":
+		c.likes--
+	case "dislike":
+		c.dislikes--
+	}
+	switch feedback {
+	case "like":
+		c.likes++
+	case "dislike":
+		c.dislikes++
+	}
+}
+
+// Summary returns the statistics of the given variants of an experiment, in order
+func (s *Stats) Summary(experiment string, variants []string) []VariantStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := make([]VariantStats, 0, len(variants))
+	for _, name := range variants {
+		stats := VariantStats{Variant: name}
+		if c := s.counters[experiment][name]; c != nil {
+			stats.Messages, stats.Likes, stats.Dislikes = c.messages, c.likes, c.dislikes
+			if votes := c.likes + c.dislikes; votes > 0 {
+				stats.WinRate = float64(c.likes) / float64(votes)
+			}
+			if c.messages > 0 {
+				stats.AvgLatencyMs = float64(c.latencyMs) / float64(c.messages)
+			}
+		}
+		summary = append(summary, stats)
+	}
+	return summary
+}
@@ -0,0 +1,204 @@
+// Package faults injects failures into LLM and tool calls for end-to-end
+// resilience testing. Faults are chosen at random with configured rates or
+// per request through a header; the injector is nil unless enabled.
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/tools"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// Fault is a kind of injected failure
+type Fault string
+
+const (
+	LLMError    Fault = "llm_error"    // the LLM call fails
+	LLMSlow     Fault = "llm_slow"     // the LLM call is delayed
+	ToolTimeout Fault = "tool_timeout" // the tool call times out
+	ToolGarbage Fault = "tool_garbage" // the tool returns garbage
+)
+
+// Targets of injected faults, as reported to the hook
+const (
+	TargetLLM  = "llm"
+	TargetTool = "tool"
+)
+
+// ErrInjected marks errors produced by fault injection
+var ErrInjected = errors.New("injected fault")
+
+// garbage is returned by tools instead of their result
+const garbage = "\x00\x1b[?1049h<<<%%GARBAGE%%>>> {\"unterminated\": [1, 2,"
+
+// Injector decides which calls fail
+type Injector struct {
+	config   configpkg.FaultInjectionConfig
+	onInject func(target string, fault Fault)
+	random   func() float64
+}
+
+// New creates an injector. It returns nil when fault injection is disabled;
+// a nil injector injects nothing. onInject, if set, is called for every
+// injected fault, e.g. to count it.
+func New(config configpkg.FaultInjectionConfig, onInject func(target string, fault Fault)) *Injector {
+	if !config.Enabled {
+		return nil
+	}
+	return &Injector{config: config, onInject: onInject, random: rand.Float64}
+}
+
+// requestFaults are the faults a request asked for. Tool faults map to the
+// tools they apply to; an empty list applies them to every tool.
+type requestFaults map[Fault][]string
+
+// requestScope is what a request context carries: the injector tool calls
+// go through and the faults chosen by the request header
+type requestScope struct {
+	injector *Injector
+	faults   requestFaults
+}
+
+// requestScopeKey is the context key of the request scope
+type requestScopeKey struct{}
+
+// WithRequest returns a context whose LLM and tool calls are subject to fault
+// injection, including the faults requested by the fault injection header of
+// r, e.g. "llm_error, tool_timeout=search"
+func (i *Injector) WithRequest(ctx context.Context, r *http.Request) context.Context {
+	if i == nil {
+		return ctx
+	}
+	scope := &requestScope{injector: i, faults: make(requestFaults)}
+
+	var header string
+	if i.config.Header != "" {
+		header = r.Header.Get(i.config.Header)
+	}
+	for _, item := range strings.Split(header, ",") {
+		name, tool, _ := strings.Cut(strings.TrimSpace(item), "=")
+		fault := Fault(strings.TrimSpace(name))
+		switch fault {
+		case "":
+			continue
+		case LLMError, LLMSlow, ToolTimeout, ToolGarbage:
+		default:
+			log.Printf("Warning: Unknown fault %q in %s header", fault, i.config.Header)
+			continue
+		}
+		if _, ok := scope.faults[fault]; !ok {
+			scope.faults[fault] = nil
+		}
+		if tool = strings.TrimSpace(tool); tool != "" {
+			scope.faults[fault] = append(scope.faults[fault], tool)
+		}
+	}
+	return context.WithValue(ctx, requestScopeKey{}, scope)
+}
+
+// requested reports whether the request of ctx asked for a fault of a tool;
+// tool is empty for LLM faults
+func requested(ctx context.Context, fault Fault, tool string) bool {
+	scope, _ := ctx.Value(requestScopeKey{}).(*requestScope)
+	if scope == nil {
+		return false
+	}
+	tools, ok := scope.faults[fault]
+	if !ok {
+		return false
+	}
+	return len(tools) == 0 || slices.Contains(tools, tool)
+}
+
+// pick reports whether to inject a fault, requested or drawn with rate
+func (i *Injector) pick(ctx context.Context, fault Fault, tool string, rate float64) bool {
+	if requested(ctx, fault, tool) {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	if tool != "" && len(i.config.Tools) > 0 && !slices.Contains(i.config.Tools, tool) {
+		return false
+	}
+	return i.random() < rate
+}
+
+// inject logs and reports an injected fault
+func (i *Injector) inject(target string, fault Fault, name string) {
+	log.Printf("🧪 Injected fault %s into %s %s", fault, target, name)
+	if i.onInject != nil {
+		i.onInject(target, fault)
+	}
+}
+
+// WrapModel returns llm with faults injected into its calls
+func (i *Injector) WrapModel(llm llms.Model) llms.Model {
+	if i == nil {
+		return llm
+	}
+	return &faultyModel{Model: llm, injector: i}
+}
+
+// faultyModel injects LLM faults before calling the wrapped model
+type faultyModel struct {
+	llms.Model
+	injector *Injector
+}
+
+// GenerateContent fails or delays the call when a fault is picked
+func (m *faultyModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	i := m.injector
+	if i.pick(ctx, LLMError, "", i.config.LLMErrorRate) {
+		i.inject(TargetLLM, LLMError, "call")
+		return nil, fmt.Errorf("%w: LLM provider returned an error", ErrInjected)
+	}
+	if i.pick(ctx, LLMSlow, "", i.config.LLMSlowRate) {
+		i.inject(TargetLLM, LLMSlow, "call")
+		select {
+		case <-time.After(i.config.LLMDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return m.Model.GenerateContent(ctx, messages, options...)
+}
+
+// Call implements the deprecated single-prompt API on top of GenerateContent,
+// so faults apply to it as well
+func (m *faultyModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// CallTool calls a tool unless a fault is picked for it: a timeout fails the
+// call with an error wrapping context.DeadlineExceeded, garbage is returned
+// without calling the tool. Outside a context from WithRequest the tool is
+// always called.
+func CallTool(ctx context.Context, tool tools.Tool, input string) (string, error) {
+	scope, _ := ctx.Value(requestScopeKey{}).(*requestScope)
+	if scope == nil {
+		return tool.Call(ctx, input)
+	}
+
+	i, name := scope.injector, tool.Name()
+	if i.pick(ctx, ToolTimeout, name, i.config.ToolTimeoutRate) {
+		i.inject(TargetTool, ToolTimeout, name)
+		return "", fmt.Errorf("%w: tool %s timed out: %w", ErrInjected, name, context.DeadlineExceeded)
+	}
+	if i.pick(ctx, ToolGarbage, name, i.config.ToolGarbageRate) {
+		i.inject(TargetTool, ToolGarbage, name)
+		return garbage, nil
+	}
+	return tool.Call(ctx, input)
+}
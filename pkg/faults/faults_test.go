@@ -0,0 +1,200 @@
+package faults
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// stubModel answers every call with "answer" and counts the calls
+type stubModel struct {
+	calls int
+}
+
+func (m *stubModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.calls++
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "answer"}}}, nil
+}
+
+func (m *stubModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// stubTool is a tool returning "result" and counting its calls
+type stubTool struct {
+	name  string
+	calls int
+}
+
+func (t *stubTool) Name() string        { return t.name }
+func (t *stubTool) Description() string { return "stub" }
+func (t *stubTool) Call(ctx context.Context, input string) (string, error) {
+	t.calls++
+	return "result", nil
+}
+
+// newInjector returns an injector recording the faults it injects
+func newInjector(config configpkg.FaultInjectionConfig) (*Injector, *[]string) {
+	config.Enabled = true
+	if config.Header == "" {
+		config.Header = "X-Fault-Injection"
+	}
+	var injected []string
+	i := New(config, func(target string, fault Fault) {
+		injected = append(injected, target+":"+string(fault))
+	})
+	return i, &injected
+}
+
+// requestContext returns the context of a request with the fault header
+func requestContext(i *Injector, header string) context.Context {
+	r := httptest.NewRequest("POST", "/api/chat", nil)
+	if header != "" {
+		r.Header.Set("X-Fault-Injection", header)
+	}
+	return i.WithRequest(context.Background(), r)
+}
+
+func TestDisabledInjectorInjectsNothing(t *testing.T) {
+	i := New(configpkg.FaultInjectionConfig{LLMErrorRate: 1, ToolTimeoutRate: 1}, nil)
+	if i != nil {
+		t.Fatal("New returned an injector while disabled")
+	}
+	model := &stubModel{}
+	if i.WrapModel(model) != llms.Model(model) {
+		t.Fatal("a nil injector wrapped the model")
+	}
+	ctx := i.WithRequest(context.Background(), httptest.NewRequest("GET", "/", nil))
+	tool := &stubTool{name: "search"}
+	if result, err := CallTool(ctx, tool, "q"); err != nil || result != "result" || tool.calls != 1 {
+		t.Fatalf("CallTool = %q, %v without injection", result, err)
+	}
+}
+
+func TestLLMErrorFault(t *testing.T) {
+	i, injected := newInjector(configpkg.FaultInjectionConfig{})
+	model := &stubModel{}
+	llm := i.WrapModel(model)
+
+	if _, err := llm.GenerateContent(requestContext(i, "llm_error"), nil); !errors.Is(err, ErrInjected) {
+		t.Fatalf("GenerateContent = %v, want an injected error", err)
+	}
+	if _, err := llm.Call(requestContext(i, "llm_error"), "hi"); !errors.Is(err, ErrInjected) {
+		t.Fatalf("Call = %v, want an injected error", err)
+	}
+	if model.calls != 0 {
+		t.Fatalf("model called %d times despite the fault", model.calls)
+	}
+	if _, err := llm.GenerateContent(requestContext(i, ""), nil); err != nil || model.calls != 1 {
+		t.Fatalf("GenerateContent without a fault = %v, %d calls", err, model.calls)
+	}
+	if want := []string{"llm:llm_error", "llm:llm_error"}; !slices.Equal(*injected, want) {
+		t.Fatalf("injected %v, want %v", *injected, want)
+	}
+}
+
+func TestLLMSlowFault(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	i, injected := newInjector(configpkg.FaultInjectionConfig{LLMDelay: delay})
+	model := &stubModel{}
+	llm := i.WrapModel(model)
+
+	start := time.Now()
+	if _, err := llm.GenerateContent(requestContext(i, "llm_slow"), nil); err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < delay || model.calls != 1 {
+		t.Fatalf("slow call took %v with %d model calls, want at least %v and 1", elapsed, model.calls, delay)
+	}
+
+	// The delay ends with the caller's context
+	i.config.LLMDelay = time.Hour
+	ctx, cancel := context.WithTimeout(requestContext(i, "llm_slow"), 20*time.Millisecond)
+	defer cancel()
+	if _, err := llm.GenerateContent(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GenerateContent = %v, want the context error", err)
+	}
+	if want := []string{"llm:llm_slow", "llm:llm_slow"}; !slices.Equal(*injected, want) {
+		t.Fatalf("injected %v, want %v", *injected, want)
+	}
+}
+
+func TestToolFaults(t *testing.T) {
+	i, injected := newInjector(configpkg.FaultInjectionConfig{})
+	search, fetch := &stubTool{name: "search"}, &stubTool{name: "fetch"}
+
+	ctx := requestContext(i, "tool_timeout=search, tool_garbage=fetch")
+	if _, err := CallTool(ctx, search, "q"); !errors.Is(err, ErrInjected) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CallTool(search) = %v, want an injected timeout", err)
+	}
+	if result, err := CallTool(ctx, fetch, "url"); err != nil || result != garbage {
+		t.Fatalf("CallTool(fetch) = %q, %v, want garbage", result, err)
+	}
+	if search.calls != 0 || fetch.calls != 0 {
+		t.Fatalf("tools called despite their faults: search %d, fetch %d", search.calls, fetch.calls)
+	}
+
+	// Without a tool name the fault applies to every tool
+	if _, err := CallTool(requestContext(i, "tool_timeout"), fetch, "url"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CallTool(fetch) = %v, want an injected timeout", err)
+	}
+	// Faults of other tools and unknown faults are ignored
+	if result, err := CallTool(requestContext(i, "tool_timeout=search, bogus"), fetch, "url"); err != nil || result != "result" {
+		t.Fatalf("CallTool(fetch) = %q, %v, want the result", result, err)
+	}
+
+	want := []string{"tool:tool_timeout", "tool:tool_garbage", "tool:tool_timeout"}
+	if !slices.Equal(*injected, want) {
+		t.Fatalf("injected %v, want %v", *injected, want)
+	}
+}
+
+func TestRandomFaults(t *testing.T) {
+	i, injected := newInjector(configpkg.FaultInjectionConfig{
+		LLMErrorRate: 0.3, ToolGarbageRate: 0.3, Tools: []string{"search"},
+	})
+	draw := 0.5
+	i.random = func() float64 { return draw }
+	llm := i.WrapModel(&stubModel{})
+	search, fetch := &stubTool{name: "search"}, &stubTool{name: "fetch"}
+	ctx := requestContext(i, "")
+
+	// Draws above the rate inject nothing
+	if _, err := llm.GenerateContent(ctx, nil); err != nil {
+		t.Fatalf("GenerateContent = %v above the rate", err)
+	}
+	if result, _ := CallTool(ctx, search, "q"); result != "result" {
+		t.Fatalf("CallTool = %q above the rate", result)
+	}
+
+	draw = 0.1
+	if _, err := llm.GenerateContent(ctx, nil); !errors.Is(err, ErrInjected) {
+		t.Fatalf("GenerateContent = %v below the rate", err)
+	}
+	if result, _ := CallTool(ctx, search, "q"); result != garbage {
+		t.Fatalf("CallTool(search) = %q below the rate, want garbage", result)
+	}
+	// Random tool faults are limited to the configured tools
+	if result, _ := CallTool(ctx, fetch, "url"); result != "result" {
+		t.Fatalf("CallTool(fetch) = %q, want the result of a tool not configured", result)
+	}
+
+	if want := []string{"llm:llm_error", "tool:tool_garbage"}; !slices.Equal(*injected, want) {
+		t.Fatalf("injected %v, want %v", *injected, want)
+	}
+}
+
+func TestHeaderIgnoredWithoutHeaderName(t *testing.T) {
+	i, _ := newInjector(configpkg.FaultInjectionConfig{})
+	i.config.Header = ""
+	if _, err := i.WrapModel(&stubModel{}).GenerateContent(requestContext(i, "llm_error"), nil); err != nil {
+		t.Fatalf("GenerateContent = %v, want the header ignored", err)
+	}
+}
@@ -0,0 +1,263 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// ErrEgressBlocked is returned when the egress policy blocks an outbound connection
+var ErrEgressBlocked = errors.New("egress blocked by policy")
+
+// nonPublicPrefixes are the special-purpose ranges blocked with the private
+// ones that netip does not classify as private or non-global
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+}
+
+// EgressViolation describes an outbound connection blocked by the egress policy
+type EgressViolation struct {
+	Host   string // host name or address of the destination
+	IP     string // blocked address of the host; empty when the host name is denied
+	Reason string
+}
+
+// EgressPolicy decides which destinations outbound connections may reach
+type EgressPolicy struct {
+	blockPrivate bool
+	allow, deny  egressRules
+}
+
+// egressRules are the parsed entries of an allow or deny list
+type egressRules struct {
+	prefixes []netip.Prefix
+	hosts    []string // lower case; ".example.com" for "*.example.com"
+}
+
+// NewEgressPolicy parses the egress configuration
+func NewEgressPolicy(config configpkg.EgressConfig) (*EgressPolicy, error) {
+	allow, err := parseEgressRules(config.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseEgressRules(config.Deny)
+	if err != nil {
+		return nil, err
+	}
+	return &EgressPolicy{blockPrivate: config.BlockPrivate, allow: allow, deny: deny}, nil
+}
+
+// parseEgressRules parses CIDRs, addresses and host names
+func parseEgressRules(entries []string) (egressRules, error) {
+	var rules egressRules
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if !configpkg.ValidEgressEntry(entry) {
+			return egressRules{}, fmt.Errorf("invalid egress entry %q", entry)
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			rules.prefixes = append(rules.prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			rules.prefixes = append(rules.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else {
+			rules.hosts = append(rules.hosts, strings.TrimPrefix(entry, "*"))
+		}
+	}
+	return rules, nil
+}
+
+// match reports whether a host name or its address is on the list
+func (r egressRules) match(host string, ip netip.Addr) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range r.hosts {
+		if host == h || strings.HasPrefix(h, ".") && strings.HasSuffix(host, h) {
+			return true
+		}
+	}
+	for _, prefix := range r.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the policy blocks anything; p may be nil
+func (p *EgressPolicy) Active() bool {
+	return p != nil && (p.blockPrivate || len(p.deny.hosts)+len(p.deny.prefixes) > 0)
+}
+
+// decide returns why a connection to an address of a host is blocked, or an
+// empty string when it is allowed; without an address only the host name is checked
+func (p *EgressPolicy) decide(host string, ip netip.Addr) string {
+	ip = ip.Unmap()
+	switch {
+	case p.allow.match(host, ip):
+		return ""
+	case p.deny.match(host, ip):
+		return "destination is on the egress deny list"
+	case p.blockPrivate && ip.IsValid() && !publicAddr(ip):
+		return "private network destinations are blocked"
+	}
+	return ""
+}
+
+// publicAddr reports whether an address is a public unicast address
+func publicAddr(ip netip.Addr) bool {
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// EgressGuard enforces the egress policy on the connections of a transport.
+// A host name is resolved once and the checked address is dialed, so a DNS
+// answer that changes after the check (DNS rebinding) cannot reach a blocked
+// address.
+type EgressGuard struct {
+	policy    atomic.Pointer[EgressPolicy]
+	dialer    *net.Dialer
+	resolver  *net.Resolver
+	onBlocked func(EgressViolation)
+	proxies   sync.Map // proxy host:port -> struct{}; dialed without a check
+}
+
+// NewEgressGuard creates a guard enforcing a policy; onBlocked, if not nil,
+// is called for every blocked connection
+func NewEgressGuard(policy *EgressPolicy, onBlocked func(EgressViolation)) *EgressGuard {
+	g := &EgressGuard{
+		dialer:    &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		resolver:  net.DefaultResolver,
+		onBlocked: onBlocked,
+	}
+	g.policy.Store(policy)
+	return g
+}
+
+// SetPolicy replaces the enforced policy, e.g. after a config reload
+func (g *EgressGuard) SetPolicy(policy *EgressPolicy) {
+	g.policy.Store(policy)
+}
+
+// Transport returns a clone of a transport whose connections are checked
+// against the policy. With a proxy, which the operator configured and is
+// therefore not checked, the destination host is checked before the request
+// is handed to the proxy.
+func (g *EgressGuard) Transport(base *http.Transport) *http.Transport {
+	transport := base.Clone()
+	transport.DialContext = g.DialContext
+	transport.DialTLSContext = nil
+	if proxy := base.Proxy; proxy != nil {
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			proxyURL, err := proxy(req)
+			if err != nil || proxyURL == nil {
+				return proxyURL, err
+			}
+			if !g.policy.Load().Active() {
+				return proxyURL, nil
+			}
+			if _, err := g.resolve(req.Context(), req.URL.Hostname()); err != nil {
+				return nil, err
+			}
+			g.proxies.Store(canonicalProxyAddr(proxyURL), struct{}{})
+			return proxyURL, nil
+		}
+	}
+	return transport
+}
+
+// canonicalProxyAddr returns the host:port dialed for a proxy
+func canonicalProxyAddr(proxyURL *url.URL) string {
+	if port := proxyURL.Port(); port != "" {
+		return proxyURL.Host
+	}
+	port := "80"
+	if proxyURL.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// DialContext connects to an address allowed by the policy
+func (g *EgressGuard) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if !g.policy.Load().Active() {
+		return g.dialer.DialContext(ctx, network, address)
+	}
+	if _, ok := g.proxies.Load(address); ok {
+		return g.dialer.DialContext(ctx, network, address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := g.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialErr error
+	for _, ip := range ips {
+		conn, err := g.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		dialErr = err
+	}
+	return nil, dialErr
+}
+
+// resolve returns the addresses of a host, or an error if the active policy
+// blocks any of them, so mixing an allowed address into the answer does not help
+func (g *EgressGuard) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	policy := g.policy.Load()
+	var ips []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = []netip.Addr{ip}
+	} else {
+		// A denied host name is not even looked up
+		if reason := policy.decide(host, netip.Addr{}); reason != "" {
+			return nil, g.blocked(EgressViolation{Host: host, Reason: reason})
+		}
+		ips, err = g.resolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ip := range ips {
+		if reason := policy.decide(host, ip); reason != "" {
+			return nil, g.blocked(EgressViolation{Host: host, IP: ip.Unmap().String(), Reason: reason})
+		}
+	}
+	return ips, nil
+}
+
+// blocked reports a blocked connection and returns its error
+func (g *EgressGuard) blocked(violation EgressViolation) error {
+	if g.onBlocked != nil {
+		g.onBlocked(violation)
+	}
+	if violation.IP == "" {
+		return fmt.Errorf("%w: %s: %s", ErrEgressBlocked, violation.Host, violation.Reason)
+	}
+	return fmt.Errorf("%w: %s (%s): %s", ErrEgressBlocked, violation.Host, violation.IP, violation.Reason)
+}
@@ -0,0 +1,86 @@
+// Package httpclient builds the HTTP client used for outbound requests, e.g.
+// to route them through a corporate proxy that re-signs TLS with a private CA.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// Configured reports whether the configuration changes anything from the
+// default transport
+func Configured(config configpkg.LLMConfig) bool {
+	return config.ProxyURL != "" || config.CABundle != "" || config.InsecureSkipVerify
+}
+
+// NewTransport returns a clone of the default transport with the proxy, CA
+// bundle and certificate verification settings applied. Without a proxy URL
+// the standard HTTP(S)_PROXY environment variables still apply.
+func NewTransport(config configpkg.LLMConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", config.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if config.CABundle != "" || config.InsecureSkipVerify {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if transport.TLSClientConfig != nil {
+			tlsConfig = transport.TLSClientConfig.Clone()
+		}
+
+		if config.CABundle != "" {
+			pool, err := certPool(config.CABundle)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		if config.InsecureSkipVerify {
+			log.Printf("⚠️  WARNING: TLS certificate verification is DISABLED for outbound requests (llm.insecure_skip_verify)")
+			log.Printf("⚠️  WARNING: Any server can impersonate the LLM provider; use llm.ca_bundle instead")
+			tlsConfig.InsecureSkipVerify = true
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return transport, nil
+}
+
+// New returns an HTTP client using NewTransport
+func New(config configpkg.LLMConfig) (*http.Client, error) {
+	transport, err := NewTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// certPool returns the system roots extended with the certificates of a PEM bundle
+func certPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", path)
+	}
+	return pool, nil
+}
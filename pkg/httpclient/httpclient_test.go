@@ -0,0 +1,123 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// writeCABundle writes the certificate of a TLS test server as a PEM bundle
+func writeCABundle(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func get(client *http.Client, url string) (int, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestCustomCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+
+	plain, err := New(configpkg.LLMConfig{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := get(plain, server.URL); err == nil {
+		t.Fatal("request to a server with a private CA succeeded without the bundle")
+	}
+
+	client, err := New(configpkg.LLMConfig{CABundle: writeCABundle(t, server)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if status, err := get(client, server.URL); err != nil || status != http.StatusTeapot {
+		t.Fatalf("request with the CA bundle = %d, %v", status, err)
+	}
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := New(configpkg.LLMConfig{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if status, err := get(client, server.URL); err != nil || status != http.StatusOK {
+		t.Fatalf("request without verification = %d, %v", status, err)
+	}
+}
+
+func TestInvalidCABundle(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	for _, path := range []string{notPEM, filepath.Join(dir, "missing.pem")} {
+		if _, err := New(configpkg.LLMConfig{CABundle: path}); err == nil {
+			t.Errorf("New accepted the CA bundle %s", path)
+		}
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	client, err := New(configpkg.LLMConfig{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := get(client, "http://llm.invalid/v1/models"); err != nil {
+		t.Fatalf("request through the proxy: %v", err)
+	}
+	if proxied != "http://llm.invalid/v1/models" {
+		t.Fatalf("proxy received %q", proxied)
+	}
+
+	for _, url := range []string{"proxy:3128", "http://", "://bad"} {
+		if _, err := New(configpkg.LLMConfig{ProxyURL: url}); err == nil {
+			t.Errorf("New accepted the proxy URL %q", url)
+		}
+	}
+}
+
+func TestConfigured(t *testing.T) {
+	for _, tc := range []struct {
+		config configpkg.LLMConfig
+		want   bool
+	}{
+		{configpkg.LLMConfig{}, false},
+		{configpkg.LLMConfig{BaseURL: "http://llm"}, false},
+		{configpkg.LLMConfig{ProxyURL: "http://proxy"}, true},
+		{configpkg.LLMConfig{CABundle: "ca.pem"}, true},
+		{configpkg.LLMConfig{InsecureSkipVerify: true}, true},
+	} {
+		if got := Configured(tc.config); got != tc.want {
+			t.Errorf("Configured(%+v) = %v, want %v", tc.config, got, tc.want)
+		}
+	}
+}
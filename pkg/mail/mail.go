@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// Sender sends plain-text emails through an SMTP server. The connection uses
+// STARTTLS when the server offers it.
+type Sender struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+}
+
+// New returns the sender of the SMTP configuration, or nil when no SMTP host
+// is configured
+func New(config configpkg.SMTPConfig) *Sender {
+	if config.Host == "" {
+		return nil
+	}
+	sender := &Sender{
+		addr: net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		host: config.Host,
+		from: config.From,
+	}
+	if config.Username != "" {
+		sender.auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+	return sender
+}
+
+// Send sends an email with a subject and a plain-text body to one address
+func (s *Sender) Send(to, subject, body string) error {
+	recipient, err := netmail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %w", err)
+	}
+	sender, err := netmail.ParseAddress(s.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", sender)
+	fmt.Fprintf(&msg, "To: %s\r\n", recipient)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(s.addr, s.auth, sender.Address, []string{recipient.Address}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send email via %s: %w", s.host, err)
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"slices"
 	"strings"
@@ -11,11 +14,34 @@ import (
 	"github.com/smallnest/langchat/pkg/auth"
 )
 
+// Names of the cookies the web UI keeps its tokens in
+const (
+	accessTokenCookie  = "access_token"
+	refreshTokenCookie = "refresh_token"
+)
+
+var (
+	// ErrNoToken is returned by Authenticate for a request without a token
+	ErrNoToken = errors.New("authorization header or cookie required")
+	// ErrInvalidAuthHeader is returned by Authenticate for an Authorization
+	// header that is not a bearer token
+	ErrInvalidAuthHeader = errors.New("invalid authorization header format")
+	// ErrInvalidToken is returned by Authenticate for a token that does not
+	// validate; it wraps the validation error
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// TokenRefresher exchanges a refresh token for a new pair of tokens
+type TokenRefresher interface {
+	RefreshToken(ctx context.Context, refreshToken string) (*auth.LoginResponse, error)
+}
+
 // AuthMiddleware provides JWT authentication middleware
 type AuthMiddleware struct {
 	secretKey     string
 	tokenExpiry   time.Duration
 	refreshExpiry time.Duration
+	refresher     TokenRefresher // nil disables the silent refresh of page loads
 }
 
 // NewAuthMiddleware creates a new authentication middleware
@@ -27,6 +53,13 @@ func NewAuthMiddleware(secretKey string, tokenExpiry, refreshExpiry time.Duratio
 	}
 }
 
+// SetRefresher enables the silent refresh of browser navigations: a page load
+// whose access token expired is signed in again with its refresh cookie. It
+// must be called before the middleware serves requests.
+func (a *AuthMiddleware) SetRefresher(refresher TokenRefresher) {
+	a.refresher = refresher
+}
+
 // GenerateToken generates a new JWT token for the given user
 func (a *AuthMiddleware) GenerateToken(userID, username string, roles []string) (string, error) {
 	claims := auth.JWTClaims{
@@ -68,6 +101,49 @@ func (a *AuthMiddleware) ValidateToken(tokenString string) (*auth.JWTClaims, err
 
 // Middleware returns an HTTP middleware function for authentication
 func (a *AuthMiddleware) Middleware(next http.Handler) http.Handler {
+	return a.authenticate(next, "")
+}
+
+// RedirectToLogin returns the authentication middleware of pages: browser
+// navigations without a valid token are silently refreshed, see SetRefresher,
+// or else redirected to loginPath below the base path of the request, see
+// BasePath, instead of getting a 401, while other requests are rejected as
+// by Middleware
+func (a *AuthMiddleware) RedirectToLogin(loginPath string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return a.authenticate(next, loginPath)
+	}
+}
+
+// Authenticate returns the claims of the access token of a request, taken
+// from its bearer Authorization header or, without one, its access_token
+// cookie. Expired tokens fail with an error wrapping jwt.ErrTokenExpired.
+func (a *AuthMiddleware) Authenticate(r *http.Request) (*auth.JWTClaims, error) {
+	var tokenString string
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		// Check if the token has the Bearer prefix
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return nil, ErrInvalidAuthHeader
+		}
+		tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+	} else {
+		cookie, err := r.Cookie(accessTokenCookie)
+		if err != nil {
+			return nil, ErrNoToken
+		}
+		tokenString = cookie.Value
+	}
+
+	claims, err := a.ValidateToken(tokenString)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// authenticate wraps a handler with token validation; unauthenticated browser
+// navigations are redirected to loginPath unless it is empty
+func (a *AuthMiddleware) authenticate(next http.Handler, loginPath string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Skip authentication for health checks and public endpoints
 		if a.isPublicEndpoint(r.URL.Path) {
@@ -75,30 +151,27 @@ func (a *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Extract token from Authorization header
-		authHeader := r.Header.Get("Authorization")
-		var tokenString string
-
-		if authHeader != "" {
-			// Check if the token has the Bearer prefix
-			if !strings.HasPrefix(authHeader, "Bearer ") {
-				http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
-				return
-			}
-			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
-		} else {
-			// Check for token in cookie
-			cookie, err := r.Cookie("access_token")
-			if err != nil {
-				http.Error(w, "Authorization header or cookie required", http.StatusUnauthorized)
-				return
+		claims, err := a.Authenticate(r)
+		if err != nil && loginPath != "" && isBrowserNavigation(r) {
+			// A page load with an expired or dropped access token is signed in
+			// again with the refresh cookie rather than sent to the login page
+			if refreshed, ok := a.refreshNavigation(w, r, err); ok {
+				claims, err = refreshed, nil
 			}
-			tokenString = cookie.Value
 		}
-
-		claims, err := a.ValidateToken(tokenString)
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			if loginPath != "" && isBrowserNavigation(r) {
+				http.Redirect(w, r, BasePathFrom(r.Context())+loginPath, http.StatusTemporaryRedirect)
+				return
+			}
+			message := "Invalid token"
+			switch {
+			case errors.Is(err, ErrNoToken):
+				message = "Authorization header or cookie required"
+			case errors.Is(err, ErrInvalidAuthHeader):
+				message = "Invalid authorization header format"
+			}
+			http.Error(w, message, http.StatusUnauthorized)
 			return
 		}
 
@@ -108,6 +181,61 @@ func (a *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// refreshNavigation exchanges the refresh cookie of a browser navigation for
+// new tokens when its access token cookie expired or is gone, and sets them as
+// the new cookies. Bearer tokens are never refreshed this way.
+func (a *AuthMiddleware) refreshNavigation(w http.ResponseWriter, r *http.Request, err error) (*auth.JWTClaims, bool) {
+	if a.refresher == nil || r.Header.Get("Authorization") != "" {
+		return nil, false
+	}
+	if !errors.Is(err, ErrNoToken) && !errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, false
+	}
+	cookie, cookieErr := r.Cookie(refreshTokenCookie)
+	if cookieErr != nil || cookie.Value == "" {
+		return nil, false
+	}
+
+	response, err := a.refresher.RefreshToken(r.Context(), cookie.Value)
+	if err != nil {
+		log.Printf("Silent token refresh failed: %v", err)
+		return nil, false
+	}
+	claims, err := a.ValidateToken(response.AccessToken)
+	if err != nil {
+		log.Printf("Warning: Refreshed access token is invalid: %v", err)
+		return nil, false
+	}
+
+	secure, path := r.TLS != nil, CookiePath(r)
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessTokenCookie,
+		Value:    response.AccessToken,
+		Path:     path,
+		MaxAge:   int(a.tokenExpiry.Seconds()),
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    response.RefreshToken,
+		Path:     path,
+		MaxAge:   int(a.refreshExpiry.Seconds()),
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return claims, true
+}
+
+// isBrowserNavigation reports whether a request is a browser loading a page,
+// as opposed to an API call made by a script
+func isBrowserNavigation(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
 // isPublicEndpoint checks if the endpoint is public and doesn't require authentication
 func (a *AuthMiddleware) isPublicEndpoint(path string) bool {
 	publicPaths := []string{
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/smallnest/langchat/pkg/auth"
+)
+
+const testSecret = "test-secret"
+
+// token returns an access token of user that expires after expiry, signed with secret
+func token(t *testing.T, secret, user string, expiry time.Duration) string {
+	t.Helper()
+	signed, err := NewAuthMiddleware(secret, expiry, time.Hour).GenerateToken(user, user, []string{"user"})
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return signed
+}
+
+// fakeRefresher hands out tokens of a new session for the refresh token "valid-refresh"
+type fakeRefresher struct {
+	t     *testing.T
+	calls []string
+}
+
+func (f *fakeRefresher) RefreshToken(ctx context.Context, refreshToken string) (*auth.LoginResponse, error) {
+	f.calls = append(f.calls, refreshToken)
+	if refreshToken != "valid-refresh" {
+		return nil, errors.New("refresh token revoked")
+	}
+	return &auth.LoginResponse{AccessToken: token(f.t, testSecret, "alice", time.Hour), RefreshToken: "rotated-refresh"}, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := NewAuthMiddleware(testSecret, time.Hour, time.Hour)
+	valid := token(t, testSecret, "alice", time.Hour)
+	tests := []struct {
+		name     string
+		header   string
+		cookie   string
+		wantUser string
+		wantErr  []error
+	}{
+		{"bearer token", "Bearer " + valid, "", "alice", nil},
+		{"cookie", "", valid, "alice", nil},
+		{"bearer token before the cookie", "Bearer " + token(t, testSecret, "bob", time.Hour), valid, "bob", nil},
+		{"no token", "", "", "", []error{ErrNoToken}},
+		{"not a bearer token", "Basic dXNlcjpwdw==", valid, "", []error{ErrInvalidAuthHeader}},
+		{"expired", "Bearer " + token(t, testSecret, "alice", -time.Minute), "", "", []error{ErrInvalidToken, jwt.ErrTokenExpired}},
+		{"wrong signature", "", token(t, "other-secret", "alice", time.Hour), "", []error{ErrInvalidToken, jwt.ErrTokenSignatureInvalid}},
+		{"garbage", "Bearer not-a-jwt", "", "", []error{ErrInvalidToken}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: tt.cookie})
+			}
+			claims, err := a.Authenticate(r)
+			for _, want := range tt.wantErr {
+				if !errors.Is(err, want) {
+					t.Fatalf("Authenticate = %v, want %v", err, want)
+				}
+			}
+			if tt.wantErr == nil && (err != nil || claims.UserID != tt.wantUser) {
+				t.Fatalf("Authenticate = %+v, %v, want user %s", claims, err, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestRedirectToLoginRefreshesNavigation(t *testing.T) {
+	expired := token(t, testSecret, "alice", -time.Minute)
+	tests := []struct {
+		name          string
+		noRefresher   bool
+		api           bool   // a script call instead of a page load
+		header        string // Authorization header
+		access        string // access_token cookie
+		refresh       string // refresh_token cookie
+		wantCode      int
+		wantRefreshed bool
+	}{
+		{name: "expired access cookie", access: expired, refresh: "valid-refresh", wantCode: http.StatusOK, wantRefreshed: true},
+		{name: "no access cookie", refresh: "valid-refresh", wantCode: http.StatusOK, wantRefreshed: true},
+		{name: "no refresh cookie", access: expired, wantCode: http.StatusTemporaryRedirect},
+		{name: "revoked refresh cookie", access: expired, refresh: "revoked", wantCode: http.StatusTemporaryRedirect},
+		{name: "refresh disabled", noRefresher: true, access: expired, refresh: "valid-refresh", wantCode: http.StatusTemporaryRedirect},
+		{name: "API call", api: true, access: expired, refresh: "valid-refresh", wantCode: http.StatusUnauthorized},
+		{name: "expired bearer token", header: "Bearer " + expired, refresh: "valid-refresh", wantCode: http.StatusTemporaryRedirect},
+		{name: "forged access cookie", access: token(t, "other-secret", "mallory", time.Hour), refresh: "valid-refresh", wantCode: http.StatusTemporaryRedirect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAuthMiddleware(testSecret, time.Hour, 24*time.Hour)
+			refresher := &fakeRefresher{t: t}
+			if !tt.noRefresher {
+				a.SetRefresher(refresher)
+			}
+			var user string
+			handler := a.RedirectToLogin("/login")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, _ := GetUserFromContext(r.Context())
+				user = claims.UserID
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if !tt.api {
+				r.Header.Set("Accept", "text/html,application/xhtml+xml")
+			}
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.access != "" {
+				r.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: tt.access})
+			}
+			if tt.refresh != "" {
+				r.AddCookie(&http.Cookie{Name: refreshTokenCookie, Value: tt.refresh})
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("page load = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusTemporaryRedirect && w.Header().Get("Location") != "/login" {
+				t.Fatalf("redirected to %q, want /login", w.Header().Get("Location"))
+			}
+			cookies := map[string]*http.Cookie{}
+			for _, cookie := range w.Result().Cookies() {
+				cookies[cookie.Name] = cookie
+			}
+			if !tt.wantRefreshed {
+				if len(cookies) != 0 || user != "" {
+					t.Fatalf("not refreshed page load set cookies %v and served user %q", cookies, user)
+				}
+				return
+			}
+
+			if len(refresher.calls) != 1 || refresher.calls[0] != "valid-refresh" {
+				t.Fatalf("refresher called with %q, want the refresh cookie", refresher.calls)
+			}
+			if user != "alice" {
+				t.Fatalf("page served to %q, want the refreshed user", user)
+			}
+			access, refresh := cookies[accessTokenCookie], cookies[refreshTokenCookie]
+			if access == nil || refresh == nil || refresh.Value != "rotated-refresh" {
+				t.Fatalf("cookies = %v, want new access and refresh cookies", cookies)
+			}
+			if claims, err := a.ValidateToken(access.Value); err != nil || claims.UserID != "alice" {
+				t.Fatalf("new access cookie = %+v, %v", claims, err)
+			}
+			if access.MaxAge != int(time.Hour.Seconds()) || refresh.MaxAge != int((24*time.Hour).Seconds()) || access.Path != "/" {
+				t.Fatalf("cookie lifetimes %d/%d, path %q", access.MaxAge, refresh.MaxAge, access.Path)
+			}
+		})
+	}
+}
+
+func TestMiddlewareNeverRefreshes(t *testing.T) {
+	a := NewAuthMiddleware(testSecret, time.Hour, time.Hour)
+	refresher := &fakeRefresher{t: t}
+	a.SetRefresher(refresher)
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	r.Header.Set("Accept", "text/html")
+	r.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: token(t, testSecret, "alice", -time.Minute)})
+	r.AddCookie(&http.Cookie{Name: refreshTokenCookie, Value: "valid-refresh"})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || len(refresher.calls) != 0 {
+		t.Fatalf("API middleware = %d with %d refreshes, want 401 without refreshing", w.Code, len(refresher.calls))
+	}
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// basePathKey is the context key of the path prefix of a request
+type basePathKey struct{}
+
+// withBasePath returns a copy of ctx carrying the path prefix of a request
+func withBasePath(ctx context.Context, basePath string) context.Context {
+	return context.WithValue(ctx, basePathKey{}, basePath)
+}
+
+// BasePathFrom returns the path prefix the server is reached under, without
+// a trailing slash: "" at the root, e.g. "/chat" behind a proxy subpath
+func BasePathFrom(ctx context.Context) string {
+	basePath, _ := ctx.Value(basePathKey{}).(string)
+	return basePath
+}
+
+// BasePath returns the middleware serving the handler under a path prefix:
+// requests must start with the prefix, which is stripped before next sees
+// the path, and "/prefix" redirects to "/prefix/". With config.BasePathAuto the
+// prefix is the X-Forwarded-Prefix header of each request from one of the
+// trustedProxies, IP addresses or CIDR ranges; the proxy usually strips it
+// already, and other requests are served at the root. Handlers find the
+// prefix with BasePathFrom.
+func BasePath(basePath string, trustedProxies []string) Middleware {
+	auto := basePath == configpkg.BasePathAuto
+	if !auto {
+		basePath, _ = configpkg.NormalizeBasePath(basePath)
+	}
+	proxies := parseProxies(trustedProxies)
+	return func(next http.Handler) http.Handler {
+		if !auto && basePath == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			prefix := basePath
+			if auto {
+				prefix = forwardedPrefix(r, proxies)
+			}
+			if prefix == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			switch {
+			case r.URL.Path == prefix && !auto:
+				target := prefix + "/"
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+				return
+			case strings.HasPrefix(r.URL.Path, prefix+"/"):
+				r = stripBasePath(r, prefix)
+			case !auto:
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withBasePath(r.Context(), prefix)))
+		})
+	}
+}
+
+// parseProxies returns the address ranges of trusted proxies, given as IP
+// addresses or CIDR ranges; invalid entries are skipped
+func parseProxies(entries []string) []netip.Prefix {
+	var proxies []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			proxies = append(proxies, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		}
+	}
+	return proxies
+}
+
+// forwardedPrefix returns the valid path prefix of the X-Forwarded-Prefix
+// header of a request sent by one of proxies, or ""
+func forwardedPrefix(r *http.Request, proxies []netip.Prefix) string {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	addr := addrPort.Addr().Unmap()
+	if !slices.ContainsFunc(proxies, func(proxy netip.Prefix) bool { return proxy.Contains(addr) }) {
+		return ""
+	}
+	value, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Prefix"), ",")
+	prefix, ok := configpkg.NormalizeBasePath(value)
+	if !ok {
+		return ""
+	}
+	return prefix
+}
+
+// stripBasePath returns a shallow copy of r with the prefix removed from its
+// path, as http.StripPrefix does
+func stripBasePath(r *http.Request, prefix string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	r2.URL = &u
+	r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+	if r.URL.RawPath != "" {
+		r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+	}
+	return r2
+}
+
+// Quoted or parenthesized references to a path of the server in a page: the
+// routes of the web UI and its API, and the root itself, which is only
+// matched quoted so the /.../ regular expressions of scripts are left alone
+var (
+	routeRef = regexp.MustCompile("([\"'`(])/((?:api|static|sessions|ui)/|(?:login|register|admin|health)\\b|manifest\\.webmanifest|sw\\.js|assets\\.json)")
+	rootRef  = regexp.MustCompile("([\"'`])/([\"'`])")
+)
+
+// PrefixPaths rewrites the absolute references of an HTML page to the server,
+// such as "/api/...", "/static/...", '/login' or '/', and the path of the
+// cookies it sets, to point below basePath. The page is returned as is for
+// the root.
+func PrefixPaths(page []byte, basePath string) []byte {
+	if basePath == "" {
+		return page
+	}
+	page = routeRef.ReplaceAll(page, []byte("${1}"+basePath+"/${2}"))
+	page = rootRef.ReplaceAll(page, []byte("${1}"+basePath+"/${2}"))
+	return bytes.ReplaceAll(page, []byte("; path=/;"), []byte("; path="+basePath+"/;"))
+}
+
+// CookiePath returns the path of the cookies of a request: the path prefix
+// the server is reached under, or the root
+func CookiePath(r *http.Request) string {
+	return BasePathFrom(r.Context()) + "/"
+}
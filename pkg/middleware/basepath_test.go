@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// seen is what the handler behind BasePath saw of a request
+type seen struct {
+	path, basePath, cookiePath string
+}
+
+// serveBasePath sends a request from remoteAddr through BasePath and returns
+// the response and what the handler saw, if it was reached
+func serveBasePath(middleware Middleware, target, remoteAddr, forwardedPrefix string) (*httptest.ResponseRecorder, *seen) {
+	var got *seen
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = &seen{r.URL.Path, BasePathFrom(r.Context()), CookiePath(r)}
+	}))
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if remoteAddr != "" {
+		r.RemoteAddr = remoteAddr
+	}
+	if forwardedPrefix != "" {
+		r.Header.Set("X-Forwarded-Prefix", forwardedPrefix)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, got
+}
+
+func TestBasePathConfigured(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		header       string
+		wantCode     int
+		wantLocation string
+		want         *seen
+	}{
+		{"route", "/chat/api/sessions", "", http.StatusOK, "", &seen{"/api/sessions", "/chat", "/chat/"}},
+		{"root", "/chat/", "", http.StatusOK, "", &seen{"/", "/chat", "/chat/"}},
+		{"prefix without slash", "/chat", "", http.StatusMovedPermanently, "/chat/", nil},
+		{"prefix with query", "/chat?lang=en", "", http.StatusMovedPermanently, "/chat/?lang=en", nil},
+		{"outside the prefix", "/api/sessions", "", http.StatusNotFound, "", nil},
+		{"longer segment", "/chatroom/", "", http.StatusNotFound, "", nil},
+		// A configured prefix is not replaced by the header
+		{"forwarded prefix", "/chat/login", "/other", http.StatusOK, "", &seen{"/login", "/chat", "/chat/"}},
+	}
+	for _, basePath := range []string{"/chat", "chat/", "/chat/"} {
+		for _, tt := range tests {
+			t.Run(basePath+" "+tt.name, func(t *testing.T) {
+				w, got := serveBasePath(BasePath(basePath, nil), tt.target, "", tt.header)
+				if w.Code != tt.wantCode || w.Header().Get("Location") != tt.wantLocation {
+					t.Fatalf("%s = %d to %q, want %d to %q", tt.target, w.Code, w.Header().Get("Location"), tt.wantCode, tt.wantLocation)
+				}
+				if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+					t.Fatalf("handler saw %+v, want %+v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestBasePathRoot(t *testing.T) {
+	w, got := serveBasePath(BasePath("", []string{"192.0.2.1"}), "/api/sessions", "", "/chat")
+	if w.Code != http.StatusOK || got == nil || *got != (seen{"/api/sessions", "", "/"}) {
+		t.Fatalf("request at the root = %d, handler saw %+v", w.Code, got)
+	}
+}
+
+func TestBasePathAutoFromTrustedProxy(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", " 192.0.2.7 ", "::1", "not-an-address"}
+	tests := []struct {
+		name       string
+		target     string
+		remoteAddr string
+		header     string
+		want       seen
+	}{
+		{"stripped by the proxy", "/api/sessions", "10.1.2.3:4321", "/chat", seen{"/api/sessions", "/chat", "/chat/"}},
+		{"kept by the proxy", "/chat/api/sessions", "10.1.2.3:4321", "/chat", seen{"/api/sessions", "/chat", "/chat/"}},
+		{"nested prefix", "/", "10.1.2.3:4321", "/apps/chat/", seen{"/", "/apps/chat", "/apps/chat/"}},
+		{"first of several", "/login", "10.1.2.3:4321", "/chat, /outer", seen{"/login", "/chat", "/chat/"}},
+		{"single address", "/login", "192.0.2.7:80", "/chat", seen{"/login", "/chat", "/chat/"}},
+		{"IPv6", "/login", "[::1]:80", "/chat", seen{"/login", "/chat", "/chat/"}},
+		{"IPv4-mapped", "/login", "[::ffff:10.0.0.1]:80", "/chat", seen{"/login", "/chat", "/chat/"}},
+		{"without the header", "/login", "10.1.2.3:4321", "", seen{"/login", "", "/"}},
+		{"invalid prefix", "/login", "10.1.2.3:4321", "/chat/../admin", seen{"/login", "", "/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, got := serveBasePath(BasePath("auto", trusted), tt.target, tt.remoteAddr, tt.header)
+			if w.Code != http.StatusOK || got == nil || *got != tt.want {
+				t.Fatalf("%s = %d, handler saw %+v, want %+v", tt.target, w.Code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasePathAutoIgnoresUntrustedHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+	}{
+		{"no trusted proxies", nil, "10.1.2.3:4321"},
+		{"outside the range", []string{"10.0.0.0/8"}, "192.0.2.1:4321"},
+		{"other address", []string{"192.0.2.7"}, "192.0.2.8:4321"},
+		{"unparsable remote address", []string{"10.0.0.0/8"}, "proxy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, got := serveBasePath(BasePath("auto", tt.trusted), "/login", tt.remoteAddr, "/evil")
+			if w.Code != http.StatusOK || got == nil || *got != (seen{"/login", "", "/"}) {
+				t.Fatalf("request from %s = %d, handler saw %+v, want it served at the root", tt.remoteAddr, w.Code, got)
+			}
+		})
+	}
+}
+
+func TestPrefixPaths(t *testing.T) {
+	page := `<a href="/login">Sign in</a><script src="/static/app.js"></script>` +
+		`<script>fetch('/api/chat'); location.href = '/'; const re = /ui/g;` +
+		`document.cookie = 'access_token=x; path=/; max-age=60';</script>`
+	want := `<a href="/chat/login">Sign in</a><script src="/chat/static/app.js"></script>` +
+		`<script>fetch('/chat/api/chat'); location.href = '/chat/'; const re = /ui/g;` +
+		`document.cookie = 'access_token=x; path=/chat/; max-age=60';</script>`
+	if got := string(PrefixPaths([]byte(page), "/chat")); got != want {
+		t.Fatalf("PrefixPaths =\n%s\nwant\n%s", got, want)
+	}
+	if got := string(PrefixPaths([]byte(page), "")); got != page {
+		t.Fatalf("PrefixPaths at the root =\n%s", got)
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sort"
+)
+
+// Middleware wraps an http.Handler with additional behavior
+type Middleware func(http.Handler) http.Handler
+
+// Stage determines where a middleware runs in a chain. Lower stages run first
+// (outermost), so the effective request order is:
+//
+//	recovery → request ID → logging → CORS → rate limit → auth → tracking → handler
+//
+// Tracking middlewares run after auth, so they see the authenticated user.
+// Middlewares registered for the same stage run in the order they were added.
+type Stage int
+
+const (
+	StageRecovery Stage = iota * 10
+	StageRequestID
+	StageLogging
+	StageCORS
+	StageRateLimit
+	StageAuth
+	StageTracking
+)
+
+// String returns the name of the stage
+func (s Stage) String() string {
+	switch s {
+	case StageRecovery:
+		return "recovery"
+	case StageRequestID:
+		return "request_id"
+	case StageLogging:
+		return "logging"
+	case StageCORS:
+		return "cors"
+	case StageRateLimit:
+		return "rate_limit"
+	case StageAuth:
+		return "auth"
+	case StageTracking:
+		return "tracking"
+	default:
+		return "custom"
+	}
+}
+
+// stagedMiddleware is a middleware bound to its stage
+type stagedMiddleware struct {
+	stage      Stage
+	middleware Middleware
+}
+
+// Chain composes middlewares in stage order regardless of registration order
+type Chain struct {
+	middlewares []stagedMiddleware
+}
+
+// NewChain creates an empty middleware chain
+func NewChain() *Chain {
+	return &Chain{}
+}
+
+// Use adds middlewares at the given stage and returns the chain for chaining calls
+func (c *Chain) Use(stage Stage, middlewares ...Middleware) *Chain {
+	for _, m := range middlewares {
+		c.middlewares = append(c.middlewares, stagedMiddleware{stage: stage, middleware: m})
+	}
+	return c
+}
+
+// Clone returns a copy of the chain that can be extended independently
+func (c *Chain) Clone() *Chain {
+	clone := &Chain{middlewares: make([]stagedMiddleware, len(c.middlewares))}
+	copy(clone.middlewares, c.middlewares)
+	return clone
+}
+
+// Then wraps the handler with all middlewares of the chain
+func (c *Chain) Then(handler http.Handler) http.Handler {
+	ordered := make([]stagedMiddleware, len(c.middlewares))
+	copy(ordered, c.middlewares)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].stage < ordered[j].stage
+	})
+
+	// Wrap from the innermost middleware outwards
+	for i := len(ordered) - 1; i >= 0; i-- {
+		handler = ordered[i].middleware(handler)
+	}
+	return handler
+}
+
+// ThenFunc wraps the handler function with all middlewares of the chain
+func (c *Chain) ThenFunc(handler http.HandlerFunc) http.Handler {
+	return c.Then(handler)
+}
+
+// Recovery converts panics in downstream handlers into 500 responses
+func Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				log.Printf("Panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rec, debug.Stack())
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
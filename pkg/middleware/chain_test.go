@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// recorder returns a middleware appending name to order when a request passes it
+func recorder(order *[]string, name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*order = append(*order, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func serve(handler http.Handler) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w
+}
+
+func TestChainOrdersByStage(t *testing.T) {
+	var order []string
+	chain := NewChain().
+		Use(StageTracking, recorder(&order, "tracking")).
+		Use(StageAuth, recorder(&order, "auth")).
+		Use(StageCORS, recorder(&order, "cors")).
+		Use(StageRecovery, recorder(&order, "recovery")).
+		Use(StageRateLimit, recorder(&order, "rate_limit")).
+		Use(StageLogging, recorder(&order, "logging"), recorder(&order, "logging 2")).
+		Use(StageRequestID, recorder(&order, "request_id"))
+
+	serve(chain.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}))
+
+	want := []string{"recovery", "request_id", "logging", "logging 2", "cors", "rate_limit", "auth", "tracking", "handler"}
+	if !slices.Equal(order, want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+}
+
+func TestChainStopsAtRejectingMiddleware(t *testing.T) {
+	var order []string
+	reject := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, "rate_limit")
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+	}
+	chain := NewChain().
+		Use(StageAuth, recorder(&order, "auth")).
+		Use(StageRateLimit, reject).
+		Use(StageLogging, recorder(&order, "logging"))
+
+	w := serve(chain.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}))
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if want := []string{"logging", "rate_limit"}; !slices.Equal(order, want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+}
+
+func TestChainClone(t *testing.T) {
+	var order []string
+	public := NewChain().Use(StageLogging, recorder(&order, "logging"))
+	protected := public.Clone().Use(StageAuth, recorder(&order, "auth"))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	serve(public.Then(handler))
+	if want := []string{"logging"}; !slices.Equal(order, want) {
+		t.Fatalf("public order = %v, want %v", order, want)
+	}
+	order = nil
+	serve(protected.Then(handler))
+	if want := []string{"logging", "auth"}; !slices.Equal(order, want) {
+		t.Fatalf("protected order = %v, want %v", order, want)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	w := serve(Recovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Fatalf("recovered %v, want http.ErrAbortHandler", rec)
+		}
+	}()
+	serve(Recovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})))
+}
+
+func TestStageString(t *testing.T) {
+	for stage, want := range map[Stage]string{
+		StageRecovery: "recovery", StageRequestID: "request_id", StageLogging: "logging",
+		StageCORS: "cors", StageRateLimit: "rate_limit", StageAuth: "auth", StageTracking: "tracking", StageAuth + 1: "custom",
+	} {
+		if got := stage.String(); got != want {
+			t.Errorf("Stage(%d).String() = %q, want %q", int(stage), got, want)
+		}
+	}
+}
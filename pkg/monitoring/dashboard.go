@@ -0,0 +1,445 @@
+package monitoring
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// dashboardMinutes is the window of the dashboard at minute resolution
+	dashboardMinutes = 24 * 60
+	// dashboardHours is the window of the per-route, per-user and per-tool breakdowns
+	dashboardHours = 24
+	// maxDashboardKeys bounds the distinct routes, users or tools tracked per hour;
+	// the rest are counted under otherKey
+	maxDashboardKeys = 200
+	// otherKey collects the keys over maxDashboardKeys
+	otherKey = "other"
+	// activeSessionWindow is how long a session counts as active after its last request
+	activeSessionWindow = 15 * time.Minute
+	// maxActiveSessions bounds the sessions tracked for the active count
+	maxActiveSessions = 10000
+	// dashboardTopN is the length of the top routes, users and tools lists
+	dashboardTopN = 10
+)
+
+// latencyBucketsMs are the upper bounds of the latency histogram used to
+// estimate percentiles; the last bucket is unbounded
+var latencyBucketsMs = [...]int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 120000}
+
+// latencyHistogram counts durations per latency bucket
+type latencyHistogram [len(latencyBucketsMs) + 1]int64
+
+// observe adds a duration to the histogram
+func (h *latencyHistogram) observe(d time.Duration) {
+	ms := d.Milliseconds()
+	i, _ := slices.BinarySearch(latencyBucketsMs[:], ms)
+	h[i]++
+}
+
+// add merges another histogram into h
+func (h *latencyHistogram) add(other *latencyHistogram) {
+	for i := range h {
+		h[i] += other[i]
+	}
+}
+
+// percentile returns the upper bound of the bucket containing the p-th
+// percentile, in milliseconds. Durations over the last bound report that bound.
+func (h *latencyHistogram) percentile(p float64) int64 {
+	var total int64
+	for _, n := range h {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := max(int64(math.Ceil(float64(total)*p)), 1)
+	var seen int64
+	for i, n := range h {
+		seen += n
+		if seen >= rank {
+			if i >= len(latencyBucketsMs) {
+				break
+			}
+			return latencyBucketsMs[i]
+		}
+	}
+	return latencyBucketsMs[len(latencyBucketsMs)-1]
+}
+
+// minuteBucket holds the counters of one minute
+type minuteBucket struct {
+	minute           int64 // Unix minute the bucket belongs to
+	requests         int64
+	clientErrors     int64 // 4xx responses
+	serverErrors     int64 // 5xx responses
+	latency          latencyHistogram
+	promptTokens     int64
+	cachedTokens     int64
+	completionTokens int64
+	cost             float64
+	toolCalls        int64
+	toolErrors       int64
+}
+
+// keyCounter counts requests or calls for a route, user or tool
+type keyCounter struct {
+	count      int64
+	errors     int64
+	durationMs int64
+}
+
+// hourBucket holds the breakdowns of one hour
+type hourBucket struct {
+	hour   int64 // Unix hour the bucket belongs to
+	routes map[string]*keyCounter
+	users  map[string]*keyCounter
+	tools  map[string]*keyCounter
+}
+
+// Dashboard keeps the last 24 hours of request, token and tool statistics in
+// fixed-size ring buffers, so a built-in dashboard works without Prometheus.
+// Memory is bounded: one bucket per minute for the time series and one per
+// hour, with a capped number of keys, for the breakdowns.
+type Dashboard struct {
+	mu       sync.Mutex
+	minutes  [dashboardMinutes]minuteBucket
+	hours    [dashboardHours]hourBucket
+	sessions map[string]time.Time // session ID -> last request
+	now      func() time.Time
+}
+
+// NewDashboard creates an empty dashboard
+func NewDashboard() *Dashboard {
+	return &Dashboard{
+		sessions: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// minute returns the bucket of the current minute, resetting it if it still
+// holds data from a previous day. The caller must hold d.mu.
+func (d *Dashboard) minute(now time.Time) *minuteBucket {
+	m := now.Unix() / 60
+	b := &d.minutes[m%dashboardMinutes]
+	if b.minute != m {
+		*b = minuteBucket{minute: m}
+	}
+	return b
+}
+
+// hour returns the bucket of the current hour, resetting it if it still holds
+// data from a previous day. The caller must hold d.mu.
+func (d *Dashboard) hour(now time.Time) *hourBucket {
+	h := now.Unix() / 3600
+	b := &d.hours[h%dashboardHours]
+	if b.hour != h {
+		*b = hourBucket{
+			hour:   h,
+			routes: make(map[string]*keyCounter),
+			users:  make(map[string]*keyCounter),
+			tools:  make(map[string]*keyCounter),
+		}
+	}
+	return b
+}
+
+// counter returns the counter of key, falling back to otherKey once the map is full
+func counter(counters map[string]*keyCounter, key string) *keyCounter {
+	c, ok := counters[key]
+	if ok {
+		return c
+	}
+	if len(counters) >= maxDashboardKeys {
+		key = otherKey
+		if c, ok := counters[key]; ok {
+			return c
+		}
+	}
+	c = &keyCounter{}
+	counters[key] = c
+	return c
+}
+
+// RecordRequest records a finished HTTP request. route should be the matched
+// route pattern rather than the raw path so the number of routes stays small;
+// userID and sessionID may be empty.
+func (d *Dashboard) RecordRequest(route, userID, sessionID string, status int, duration time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	failed := status >= 500
+
+	b := d.minute(now)
+	b.requests++
+	switch {
+	case status >= 500:
+		b.serverErrors++
+	case status >= 400:
+		b.clientErrors++
+	}
+	b.latency.observe(duration)
+
+	h := d.hour(now)
+	for _, entry := range []struct {
+		counters map[string]*keyCounter
+		key      string
+	}{{h.routes, route}, {h.users, userID}} {
+		if entry.key == "" {
+			continue
+		}
+		c := counter(entry.counters, entry.key)
+		c.count++
+		c.durationMs += duration.Milliseconds()
+		if failed {
+			c.errors++
+		}
+	}
+
+	if sessionID != "" {
+		if _, ok := d.sessions[sessionID]; ok || len(d.sessions) < maxActiveSessions {
+			d.sessions[sessionID] = now
+		}
+	}
+}
+
+// RecordTokens records the tokens and cost (USD) of an LLM call
+func (d *Dashboard) RecordTokens(promptTokens, cachedTokens, completionTokens int64, cost float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b := d.minute(d.now())
+	b.promptTokens += promptTokens
+	b.cachedTokens += cachedTokens
+	b.completionTokens += completionTokens
+	b.cost += cost
+}
+
+// RecordToolCall records a tool invocation
+func (d *Dashboard) RecordToolCall(tool string, failed bool, duration time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	b := d.minute(now)
+	b.toolCalls++
+	if failed {
+		b.toolErrors++
+	}
+
+	c := counter(d.hour(now).tools, tool)
+	c.count++
+	c.durationMs += duration.Milliseconds()
+	if failed {
+		c.errors++
+	}
+}
+
+// DashboardPoint is one minute of the time series
+type DashboardPoint struct {
+	Time         time.Time `json:"time"`
+	Requests     int64     `json:"requests"`
+	ClientErrors int64     `json:"client_errors"`
+	ServerErrors int64     `json:"server_errors"`
+	P95Ms        int64     `json:"p95_ms"`
+	Tokens       int64     `json:"tokens"`
+	ToolCalls    int64     `json:"tool_calls"`
+}
+
+// DashboardSummary aggregates the requests of a time window
+type DashboardSummary struct {
+	Requests          int64   `json:"requests"`
+	RequestsPerMinute float64 `json:"requests_per_minute"`
+	ClientErrors      int64   `json:"client_errors"`
+	ServerErrors      int64   `json:"server_errors"`
+	ErrorRate         float64 `json:"error_rate"` // 5xx responses / requests
+	P50Ms             int64   `json:"p50_ms"`
+	P95Ms             int64   `json:"p95_ms"`
+	P99Ms             int64   `json:"p99_ms"`
+	ToolCalls         int64   `json:"tool_calls"`
+	ToolErrors        int64   `json:"tool_errors"`
+}
+
+// DashboardTokens is the token usage and spend of a period
+type DashboardTokens struct {
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CachedTokens     int64   `json:"cached_tokens"` // prompt tokens read from the provider's prompt cache
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"` // USD, only for models with a known price
+}
+
+// DashboardEntry is a route, user or tool in a top list
+type DashboardEntry struct {
+	Name         string  `json:"name"`
+	Count        int64   `json:"count"`
+	Errors       int64   `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// DashboardSnapshot is the dashboard at a point in time
+type DashboardSnapshot struct {
+	GeneratedAt    time.Time        `json:"generated_at"`
+	LastHour       DashboardSummary `json:"last_hour"`
+	LastDay        DashboardSummary `json:"last_day"`
+	ActiveSessions int              `json:"active_sessions"` // sessions with a request in the last 15 minutes
+	TokensToday    DashboardTokens  `json:"tokens_today"`    // since local midnight
+	TopRoutes      []DashboardEntry `json:"top_routes"`
+	TopUsers       []DashboardEntry `json:"top_users"`
+	TopTools       []DashboardEntry `json:"top_tools"`
+	Series         []DashboardPoint `json:"series"` // oldest first
+}
+
+// Snapshot summarizes the dashboard. The time series covers the last minutes
+// minutes, at most 24 hours.
+func (d *Dashboard) Snapshot(minutes int) DashboardSnapshot {
+	if minutes <= 0 || minutes > dashboardMinutes {
+		minutes = dashboardMinutes
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	current := now.Unix() / 60
+	y, mo, day := now.Date()
+	midnight := time.Date(y, mo, day, 0, 0, 0, 0, now.Location()).Unix() / 60
+
+	snapshot := DashboardSnapshot{
+		GeneratedAt: now,
+		Series:      make([]DashboardPoint, 0, minutes),
+	}
+
+	var hourStats, dayStats summaryBuilder
+	for m := current - dashboardMinutes + 1; m <= current; m++ {
+		b := &d.minutes[m%dashboardMinutes]
+		if b.minute != m {
+			b = &minuteBucket{minute: m}
+		}
+
+		dayStats.add(b)
+		if m > current-60 {
+			hourStats.add(b)
+		}
+		if m >= midnight {
+			snapshot.TokensToday.PromptTokens += b.promptTokens
+			snapshot.TokensToday.CachedTokens += b.cachedTokens
+			snapshot.TokensToday.CompletionTokens += b.completionTokens
+			snapshot.TokensToday.Cost += b.cost
+		}
+		if m > current-int64(minutes) {
+			snapshot.Series = append(snapshot.Series, DashboardPoint{
+				Time:         time.Unix(m*60, 0),
+				Requests:     b.requests,
+				ClientErrors: b.clientErrors,
+				ServerErrors: b.serverErrors,
+				P95Ms:        b.latency.percentile(0.95),
+				Tokens:       b.promptTokens + b.completionTokens,
+				ToolCalls:    b.toolCalls,
+			})
+		}
+	}
+	snapshot.LastHour = hourStats.summary(60)
+	snapshot.LastDay = dayStats.summary(dashboardMinutes)
+	snapshot.TokensToday.TotalTokens = snapshot.TokensToday.PromptTokens + snapshot.TokensToday.CompletionTokens
+
+	routes := make(map[string]*keyCounter)
+	users := make(map[string]*keyCounter)
+	tools := make(map[string]*keyCounter)
+	currentHour := now.Unix() / 3600
+	for _, h := range d.hours {
+		if h.hour <= currentHour-dashboardHours {
+			continue
+		}
+		merge(routes, h.routes)
+		merge(users, h.users)
+		merge(tools, h.tools)
+	}
+	snapshot.TopRoutes = top(routes)
+	snapshot.TopUsers = top(users)
+	snapshot.TopTools = top(tools)
+
+	for id, last := range d.sessions {
+		if now.Sub(last) > activeSessionWindow {
+			delete(d.sessions, id)
+			continue
+		}
+		snapshot.ActiveSessions++
+	}
+
+	return snapshot
+}
+
+// summaryBuilder accumulates minute buckets into a DashboardSummary
+type summaryBuilder struct {
+	totals  DashboardSummary
+	latency latencyHistogram
+}
+
+// add adds a minute bucket
+func (s *summaryBuilder) add(b *minuteBucket) {
+	s.totals.Requests += b.requests
+	s.totals.ClientErrors += b.clientErrors
+	s.totals.ServerErrors += b.serverErrors
+	s.totals.ToolCalls += b.toolCalls
+	s.totals.ToolErrors += b.toolErrors
+	s.latency.add(&b.latency)
+}
+
+// summary returns the summary of a window of the given number of minutes
+func (s *summaryBuilder) summary(minutes int) DashboardSummary {
+	summary := s.totals
+	summary.RequestsPerMinute = float64(summary.Requests) / float64(minutes)
+	if summary.Requests > 0 {
+		summary.ErrorRate = float64(summary.ServerErrors) / float64(summary.Requests)
+	}
+	summary.P50Ms = s.latency.percentile(0.50)
+	summary.P95Ms = s.latency.percentile(0.95)
+	summary.P99Ms = s.latency.percentile(0.99)
+	return summary
+}
+
+// merge adds the counters of src to dst
+func merge(dst, src map[string]*keyCounter) {
+	for key, c := range src {
+		total := dst[key]
+		if total == nil {
+			total = &keyCounter{}
+			dst[key] = total
+		}
+		total.count += c.count
+		total.errors += c.errors
+		total.durationMs += c.durationMs
+	}
+}
+
+// top returns the dashboardTopN keys with the highest counts
+func top(counters map[string]*keyCounter) []DashboardEntry {
+	entries := make([]DashboardEntry, 0, len(counters))
+	for key, c := range counters {
+		entry := DashboardEntry{Name: key, Count: c.count, Errors: c.errors}
+		if c.count > 0 {
+			entry.ErrorRate = float64(c.errors) / float64(c.count)
+			entry.AvgLatencyMs = float64(c.durationMs) / float64(c.count)
+		}
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b DashboardEntry) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	if len(entries) > dashboardTopN {
+		entries = entries[:dashboardTopN]
+	}
+	return entries
+}
@@ -28,17 +28,74 @@ type MetricsCollector struct {
 	agentErrorTotal   *prometheus.CounterVec
 	agentSessionTotal *prometheus.CounterVec
 	agentTokenUsage   *prometheus.CounterVec
+	agentPoolRequests *prometheus.CounterVec
+	agentPoolSaved    prometheus.Counter
+	agentPoolSize     prometheus.Gauge
+	agentMemory       prometheus.Gauge
 
 	// LLM metrics
 	llmRequestsTotal   *prometheus.CounterVec
 	llmRequestDuration *prometheus.HistogramVec
 	llmTokenUsage      *prometheus.CounterVec
 	llmErrorsTotal     *prometheus.CounterVec
+	llmBreakerState    *prometheus.GaugeVec
+	llmBreakerChanges  *prometheus.CounterVec
+
+	// Token budget metrics
+	budgetUsedTokens  *prometheus.GaugeVec
+	budgetUtilization *prometheus.GaugeVec
+
+	// Auth metrics
+	authLoginsTotal         *prometheus.CounterVec
+	authRegistrationsTotal  prometheus.Counter
+	authTokenRefreshTotal   *prometheus.CounterVec
+	authActiveRefreshTokens prometheus.Gauge
+	authPasswordVerify      prometheus.Histogram
+
+	// Storage metrics
+	sessionSaveFailures prometheus.Counter
+
+	// Capacity metrics
+	capacityInUse *prometheus.GaugeVec
+	capacityLimit *prometheus.GaugeVec
+
+	// Tool metrics
+	toolCallsTotal   *prometheus.CounterVec
+	toolCallDuration *prometheus.HistogramVec
+
+	// Fault injection metrics
+	faultsInjectedTotal *prometheus.CounterVec
+
+	// Config metrics
+	configReloadsTotal *prometheus.CounterVec
+	configHash         *prometheus.GaugeVec
+
+	// Feedback metrics
+	feedbackTotal *prometheus.CounterVec
+
+	// Experiment metrics
+	experimentMessagesTotal *prometheus.CounterVec
+	experimentLatency       *prometheus.HistogramVec
+	experimentFeedbackTotal *prometheus.CounterVec
+
+	// Skill and tool selection metrics
+	selectionDecisionsTotal *prometheus.CounterVec
+
+	// Load shedding metrics
+	degradedTurnsTotal *prometheus.CounterVec
+	degradationActive  prometheus.Gauge
+
+	// Topic scope metrics
+	topicChecksTotal *prometheus.CounterVec
 
 	// System metrics
 	systemMemoryUsage    prometheus.Gauge
 	systemCPUUsage       prometheus.Gauge
 	systemGoroutineCount prometheus.Gauge
+	buildInfo            *prometheus.GaugeVec
+
+	// Built-in dashboard, kept in memory even when the metrics server is disabled
+	dashboard *Dashboard
 
 	// Custom metrics
 	customMetrics map[string]prometheus.Metric
@@ -47,6 +104,7 @@ type MetricsCollector struct {
 // NewMetricsCollector creates a new metrics collector
 func NewMetricsCollector() *MetricsCollector {
 	collector := &MetricsCollector{
+		dashboard:     NewDashboard(),
 		customMetrics: make(map[string]prometheus.Metric),
 	}
 
@@ -139,13 +197,42 @@ func (m *MetricsCollector) initMetrics() {
 		[]string{"session_id", "type"},
 	)
 
+	m.agentPoolRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "agent_pool_requests_total",
+			Help: "Total number of new session agents requested from the warm pool",
+		},
+		[]string{"result"},
+	)
+
+	m.agentPoolSaved = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "agent_pool_time_saved_seconds_total",
+			Help: "Agent construction and tool loading time saved by the warm pool in seconds",
+		},
+	)
+
+	m.agentPoolSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "agent_pool_size",
+			Help: "Number of warm agents ready in the pool",
+		},
+	)
+
+	m.agentMemory = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "agent_memory_estimated_bytes",
+			Help: "Estimated memory held by the session agents in bytes",
+		},
+	)
+
 	// LLM metrics
 	m.llmRequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "llm_requests_total",
 			Help: "Total number of LLM requests",
 		},
-		[]string{"provider", "model", "status"},
+		[]string{"provider", "model", "purpose", "status"},
 	)
 
 	m.llmRequestDuration = prometheus.NewHistogramVec(
@@ -154,7 +241,7 @@ func (m *MetricsCollector) initMetrics() {
 			Help:    "LLM request duration in seconds",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"provider", "model"},
+		[]string{"provider", "model", "purpose"},
 	)
 
 	m.llmTokenUsage = prometheus.NewCounterVec(
@@ -162,7 +249,7 @@ func (m *MetricsCollector) initMetrics() {
 			Name: "llm_token_usage_total",
 			Help: "Total LLM token usage",
 		},
-		[]string{"provider", "model", "type"},
+		[]string{"provider", "model", "purpose", "type"},
 	)
 
 	m.llmErrorsTotal = prometheus.NewCounterVec(
@@ -170,7 +257,217 @@ func (m *MetricsCollector) initMetrics() {
 			Name: "llm_errors_total",
 			Help: "Total number of LLM errors",
 		},
-		[]string{"provider", "model", "error_type"},
+		[]string{"provider", "model", "purpose", "error_type"},
+	)
+
+	m.llmBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_circuit_breaker_state",
+			Help: "State of the LLM circuit breaker (0 = closed, 1 = half-open, 2 = open)",
+		},
+		[]string{"provider"},
+	)
+
+	m.llmBreakerChanges = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_circuit_breaker_transitions_total",
+			Help: "Total number of LLM circuit breaker state transitions",
+		},
+		[]string{"provider", "from", "to"},
+	)
+
+	// Token budget metrics
+	m.budgetUsedTokens = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "token_budget_used_tokens",
+			Help: "Tokens spent today by the users of a budget role",
+		},
+		[]string{"role"},
+	)
+
+	m.budgetUtilization = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "token_budget_utilization",
+			Help: "Tokens spent today as a fraction of the budgets of the active users of a role",
+		},
+		[]string{"role"},
+	)
+
+	// Capacity metrics
+	m.capacityInUse = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "capacity_in_use",
+			Help: "Number of session managers or session agents held in memory",
+		},
+		[]string{"resource"},
+	)
+
+	m.capacityLimit = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "capacity_limit",
+			Help: "Configured maximum of session managers or session agents; 0 is unlimited",
+		},
+		[]string{"resource"},
+	)
+
+	// Auth metrics
+	m.authLoginsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_logins_total",
+			Help: "Total number of login attempts",
+		},
+		[]string{"result"},
+	)
+
+	m.authRegistrationsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "auth_registrations_total",
+			Help: "Total number of successful user registrations",
+		},
+	)
+
+	m.authTokenRefreshTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_token_refresh_total",
+			Help: "Total number of token refresh attempts",
+		},
+		[]string{"result"},
+	)
+
+	m.authActiveRefreshTokens = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "auth_active_refresh_tokens",
+			Help: "Number of active refresh tokens",
+		},
+	)
+
+	m.authPasswordVerify = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "auth_password_verify_duration_seconds",
+			Help:    "Password hash verification duration in seconds",
+			Buckets: []float64{0.0001, 0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1},
+		},
+	)
+
+	// Storage metrics
+	m.sessionSaveFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "session_save_failures_total",
+			Help: "Total number of failed session saves, including background retries",
+		},
+	)
+
+	// Tool metrics
+	m.toolCallsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tool_calls_total",
+			Help: "Total number of tool calls by skill version and status",
+		},
+		[]string{"tool", "skill", "skill_version", "status"},
+	)
+
+	m.toolCallDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "tool_call_duration_seconds",
+			Help:    "Tool call duration in seconds by skill version",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"tool", "skill", "skill_version"},
+	)
+
+	// Fault injection metrics
+	m.faultsInjectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "faults_injected_total",
+			Help: "Total number of faults injected for resilience testing",
+		},
+		[]string{"target", "fault"},
+	)
+
+	// Config metrics
+	m.configReloadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_reloads_total",
+			Help: "Total number of configuration hot-reload attempts",
+		},
+		[]string{"result"},
+	)
+
+	m.configHash = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "config_hash_info",
+			Help: "Content hash of the active configuration; the value is always 1",
+		},
+		[]string{"hash"},
+	)
+
+	// Feedback metrics
+	m.feedbackTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "message_feedback_total",
+			Help: "Total number of message feedback updates by feedback value",
+		},
+		[]string{"feedback"},
+	)
+
+	// Experiment metrics
+	m.experimentMessagesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "experiment_messages_total",
+			Help: "Total number of assistant messages by experiment variant",
+		},
+		[]string{"experiment", "variant"},
+	)
+
+	m.experimentLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "experiment_response_duration_seconds",
+			Help:    "Chat response duration in seconds by experiment variant",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"experiment", "variant"},
+	)
+
+	m.experimentFeedbackTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "experiment_feedback_total",
+			Help: "Total number of message feedback by experiment variant",
+		},
+		[]string{"experiment", "variant", "feedback"},
+	)
+
+	// Skill and tool selection metrics
+	m.selectionDecisionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "selection_decisions_total",
+			Help: "Total number of skill and tool selection decisions by stage and choice",
+		},
+		[]string{"stage", "selected"},
+	)
+
+	// Load shedding metrics
+	m.degradedTurnsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chat_degraded_turns_total",
+			Help: "Total number of chat turns answered in degraded mode by the pressure that caused it",
+		},
+		[]string{"reason"},
+	)
+
+	m.degradationActive = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "chat_degradation_active",
+			Help: "Whether chat turns are degraded to shed load (1) or not (0)",
+		},
+	)
+
+	// Topic scope metrics
+	m.topicChecksTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chat_topic_checks_total",
+			Help: "Total number of chat messages checked against the topic scope by result: in_scope, refused or error",
+		},
+		[]string{"result"},
 	)
 
 	// System metrics
@@ -195,6 +492,14 @@ func (m *MetricsCollector) initMetrics() {
 		},
 	)
 
+	m.buildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "langchat_build_info",
+			Help: "Build information of the running binary; the value is always 1",
+		},
+		[]string{"version", "commit", "go_version", "langchaingo", "goskills"},
+	)
+
 	// Register all metrics with Prometheus
 	prometheus.MustRegister(
 		m.httpRequestsTotal,
@@ -207,13 +512,43 @@ func (m *MetricsCollector) initMetrics() {
 		m.agentErrorTotal,
 		m.agentSessionTotal,
 		m.agentTokenUsage,
+		m.agentPoolRequests,
+		m.agentPoolSaved,
+		m.agentPoolSize,
+		m.agentMemory,
 		m.llmRequestsTotal,
 		m.llmRequestDuration,
 		m.llmTokenUsage,
 		m.llmErrorsTotal,
+		m.llmBreakerState,
+		m.llmBreakerChanges,
+		m.budgetUsedTokens,
+		m.budgetUtilization,
+		m.capacityInUse,
+		m.capacityLimit,
+		m.authLoginsTotal,
+		m.authRegistrationsTotal,
+		m.authTokenRefreshTotal,
+		m.authActiveRefreshTokens,
+		m.authPasswordVerify,
+		m.sessionSaveFailures,
+		m.toolCallsTotal,
+		m.toolCallDuration,
+		m.faultsInjectedTotal,
+		m.configReloadsTotal,
+		m.configHash,
+		m.feedbackTotal,
+		m.experimentMessagesTotal,
+		m.experimentLatency,
+		m.experimentFeedbackTotal,
+		m.selectionDecisionsTotal,
+		m.degradedTurnsTotal,
+		m.degradationActive,
+		m.topicChecksTotal,
 		m.systemMemoryUsage,
 		m.systemCPUUsage,
 		m.systemGoroutineCount,
+		m.buildInfo,
 	)
 }
 
@@ -235,6 +570,25 @@ func (m *MetricsCollector) SetAgentCount(total, active int) {
 	m.agentActive.Set(float64(active))
 }
 
+// RecordAgentPoolRequest records whether a new session got a warm agent ("hit") or not ("miss")
+// and the construction time the warm agent saved
+func (m *MetricsCollector) RecordAgentPoolRequest(result string, saved time.Duration) {
+	m.agentPoolRequests.WithLabelValues(result).Inc()
+	if saved > 0 {
+		m.agentPoolSaved.Add(saved.Seconds())
+	}
+}
+
+// SetAgentMemoryEstimate sets the estimated memory held by the session agents
+func (m *MetricsCollector) SetAgentMemoryEstimate(bytes int64) {
+	m.agentMemory.Set(float64(bytes))
+}
+
+// SetAgentPoolSize sets the number of warm agents ready in the pool
+func (m *MetricsCollector) SetAgentPoolSize(size int) {
+	m.agentPoolSize.Set(float64(size))
+}
+
 // RecordAgentMessage records an agent message
 func (m *MetricsCollector) RecordAgentMessage(sessionID, role string) {
 	m.agentMessageTotal.WithLabelValues(sessionID, role).Inc()
@@ -257,24 +611,197 @@ func (m *MetricsCollector) RecordAgentTokenUsage(sessionID, tokenType string, co
 
 // LLM Metrics Methods
 
-// RecordLLMRequest records an LLM request
-func (m *MetricsCollector) RecordLLMRequest(provider, model, status string, duration time.Duration) {
-	m.llmRequestsTotal.WithLabelValues(provider, model, status).Inc()
-	m.llmRequestDuration.WithLabelValues(provider, model).Observe(duration.Seconds())
+// RecordLLMRequest records an LLM request; purpose is "chat" for answers and
+// "aux" for auxiliary calls such as tool selection
+func (m *MetricsCollector) RecordLLMRequest(provider, model, purpose, status string, duration time.Duration) {
+	m.llmRequestsTotal.WithLabelValues(provider, model, purpose, status).Inc()
+	m.llmRequestDuration.WithLabelValues(provider, model, purpose).Observe(duration.Seconds())
 }
 
 // RecordLLMTokenUsage records LLM token usage
-func (m *MetricsCollector) RecordLLMTokenUsage(provider, model, tokenType string, count int64) {
-	m.llmTokenUsage.WithLabelValues(provider, model, tokenType).Add(float64(count))
+func (m *MetricsCollector) RecordLLMTokenUsage(provider, model, purpose, tokenType string, count int64) {
+	m.llmTokenUsage.WithLabelValues(provider, model, purpose, tokenType).Add(float64(count))
 }
 
 // RecordLLMError records an LLM error
-func (m *MetricsCollector) RecordLLMError(provider, model, errorType string) {
-	m.llmErrorsTotal.WithLabelValues(provider, model, errorType).Inc()
+func (m *MetricsCollector) RecordLLMError(provider, model, purpose, errorType string) {
+	m.llmErrorsTotal.WithLabelValues(provider, model, purpose, errorType).Inc()
+}
+
+// RecordLLMBreakerTransition records a state change of the LLM circuit breaker;
+// state is the numeric value of the new state
+func (m *MetricsCollector) RecordLLMBreakerTransition(provider, from, to string, state int) {
+	m.llmBreakerChanges.WithLabelValues(provider, from, to).Inc()
+	m.llmBreakerState.WithLabelValues(provider).Set(float64(state))
+}
+
+// Token Budget Metrics Methods
+
+// SetTokenBudget publishes the tokens spent today by the users of a role and
+// their combined budget; a limit of 0 (unlimited) reports no utilization
+func (m *MetricsCollector) SetTokenBudget(role string, used, limit int64) {
+	m.budgetUsedTokens.WithLabelValues(role).Set(float64(used))
+	utilization := 0.0
+	if limit > 0 {
+		utilization = float64(used) / float64(limit)
+	}
+	m.budgetUtilization.WithLabelValues(role).Set(utilization)
+}
+
+// Capacity Metrics Methods
+
+// SetCapacity publishes how many of a resource, "session_managers" or
+// "agents", are held in memory and its configured limit
+func (m *MetricsCollector) SetCapacity(resource string, inUse, limit int) {
+	m.capacityInUse.WithLabelValues(resource).Set(float64(inUse))
+	m.capacityLimit.WithLabelValues(resource).Set(float64(limit))
+}
+
+// Auth Metrics Methods
+
+// RecordAuthLogin records a login attempt with its result
+func (m *MetricsCollector) RecordAuthLogin(result string) {
+	m.authLoginsTotal.WithLabelValues(result).Inc()
+}
+
+// RecordAuthRegistration records a successful registration
+func (m *MetricsCollector) RecordAuthRegistration() {
+	m.authRegistrationsTotal.Inc()
+}
+
+// RecordAuthTokenRefresh records a token refresh attempt with its result
+func (m *MetricsCollector) RecordAuthTokenRefresh(result string) {
+	m.authTokenRefreshTotal.WithLabelValues(result).Inc()
+}
+
+// SetAuthActiveRefreshTokens sets the number of active refresh tokens
+func (m *MetricsCollector) SetAuthActiveRefreshTokens(count int) {
+	m.authActiveRefreshTokens.Set(float64(count))
+}
+
+// RecordPasswordVerify records the duration of a password hash verification
+func (m *MetricsCollector) RecordPasswordVerify(duration time.Duration) {
+	m.authPasswordVerify.Observe(duration.Seconds())
+}
+
+// Storage Metrics Methods
+
+// RecordSessionSaveFailure records a failed session save
+func (m *MetricsCollector) RecordSessionSaveFailure() {
+	m.sessionSaveFailures.Inc()
+}
+
+// Fault Injection Metrics Methods
+
+// RecordInjectedFault records a fault injected into the LLM or a tool
+func (m *MetricsCollector) RecordInjectedFault(target, fault string) {
+	m.faultsInjectedTotal.WithLabelValues(target, fault).Inc()
+}
+
+// Config Metrics Methods
+
+// RecordConfigReload records a configuration reload attempt
+func (m *MetricsCollector) RecordConfigReload(result string) {
+	m.configReloadsTotal.WithLabelValues(result).Inc()
+}
+
+// SetConfigHash publishes the content hash of the active configuration
+func (m *MetricsCollector) SetConfigHash(hash string) {
+	m.configHash.Reset()
+	m.configHash.WithLabelValues(hash).Set(1)
+}
+
+// Feedback Metrics Methods
+
+// RecordFeedback records a feedback update of a message; clearing the
+// feedback is recorded as "cleared"
+func (m *MetricsCollector) RecordFeedback(feedback string) {
+	if feedback == "" {
+		feedback = "cleared"
+	}
+	m.feedbackTotal.WithLabelValues(feedback).Inc()
+}
+
+// Experiment Metrics Methods
+
+// RecordExperimentMessage records an assistant message answered by an experiment variant
+func (m *MetricsCollector) RecordExperimentMessage(experiment, variant string, duration time.Duration) {
+	m.experimentMessagesTotal.WithLabelValues(experiment, variant).Inc()
+	m.experimentLatency.WithLabelValues(experiment, variant).Observe(duration.Seconds())
+}
+
+// RecordExperimentFeedback records feedback on a message answered by an experiment variant
+func (m *MetricsCollector) RecordExperimentFeedback(experiment, variant, feedback string) {
+	m.experimentFeedbackTotal.WithLabelValues(experiment, variant, feedback).Inc()
+}
+
+// Selection Metrics Methods
+
+// RecordSelectionDecision records a skill or tool selection decision;
+// selected is the chosen skill or tool, "none" or "error"
+func (m *MetricsCollector) RecordSelectionDecision(stage, selected string) {
+	m.selectionDecisionsTotal.WithLabelValues(stage, selected).Inc()
+}
+
+// Load Shedding Metrics Methods
+
+// RecordDegradedTurn records a chat turn answered in degraded mode; reason is
+// "utilization" or "latency"
+func (m *MetricsCollector) RecordDegradedTurn(reason string) {
+	m.degradedTurnsTotal.WithLabelValues(reason).Inc()
+}
+
+// SetDegradationActive records whether chat turns are degraded
+func (m *MetricsCollector) SetDegradationActive(active bool) {
+	value := 0.0
+	if active {
+		value = 1
+	}
+	m.degradationActive.Set(value)
+}
+
+// RecordTopicCheck records the topic scope check of a chat message; result
+// is "in_scope", "refused" for a message answered with the refusal, or
+// "error" when the classification failed and the message was answered
+func (m *MetricsCollector) RecordTopicCheck(result string) {
+	m.topicChecksTotal.WithLabelValues(result).Inc()
+}
+
+// Dashboard Metrics Methods
+
+// RecordDashboardRequest records a finished HTTP request for the built-in dashboard
+func (m *MetricsCollector) RecordDashboardRequest(route, userID, sessionID string, status int, duration time.Duration) {
+	m.dashboard.RecordRequest(route, userID, sessionID, status, duration)
+}
+
+// RecordTokenSpend records the tokens and cost (USD) of a chat turn for the
+// built-in dashboard; cachedTokens are the prompt tokens read from the
+// provider's prompt cache
+func (m *MetricsCollector) RecordTokenSpend(promptTokens, cachedTokens, completionTokens int64, cost float64) {
+	m.dashboard.RecordTokens(promptTokens, cachedTokens, completionTokens, cost)
+}
+
+// RecordToolCall records a tool invocation. The skill and its version are
+// empty for MCP tools; status is "success" or the error class.
+func (m *MetricsCollector) RecordToolCall(tool, skill, skillVersion, status string, duration time.Duration) {
+	m.toolCallsTotal.WithLabelValues(tool, skill, skillVersion, status).Inc()
+	m.toolCallDuration.WithLabelValues(tool, skill, skillVersion).Observe(duration.Seconds())
+	m.dashboard.RecordToolCall(tool, status != "success", duration)
+}
+
+// DashboardSnapshot returns the built-in dashboard with a time series of the last minutes minutes
+func (m *MetricsCollector) DashboardSnapshot(minutes int) DashboardSnapshot {
+	return m.dashboard.Snapshot(minutes)
 }
 
 // System Metrics Methods
 
+// SetBuildInfo publishes the build information gauge
+func (m *MetricsCollector) SetBuildInfo(version, commit, goVersion, langchaingo, goskills string) {
+	m.buildInfo.Reset()
+	m.buildInfo.WithLabelValues(version, commit, goVersion, langchaingo, goskills).Set(1)
+}
+
 // UpdateSystemMetrics updates system-level metrics
 func (m *MetricsCollector) UpdateSystemMetrics() {
 	// This would typically collect actual system metrics
@@ -0,0 +1,85 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// Handling of text over the length limit
+const (
+	LongTextSummarize = "summarize"
+	LongTextStrip     = "strip"
+)
+
+// Filter applies the export privacy mode to identifiers and free text
+type Filter struct {
+	secret    []byte
+	maxLength int
+	longText  string
+	redactor  *redact.Redactor
+}
+
+// New creates a privacy filter from the configuration. Forced privacy
+// without a hash secret is refused, as unkeyed hashes of identifiers can be
+// reversed by hashing candidate IDs.
+func New(config configpkg.PrivacyConfig) (*Filter, error) {
+	if config.Forced && config.HashSecret == "" {
+		return nil, fmt.Errorf("privacy is forced but no hash secret is set; set PRIVACY_HASH_SECRET")
+	}
+
+	longText := config.LongText
+	if longText == "" {
+		longText = LongTextSummarize
+	}
+	if longText != LongTextSummarize && longText != LongTextStrip {
+		return nil, fmt.Errorf("invalid privacy long_text mode %q, expected %q or %q", longText, LongTextSummarize, LongTextStrip)
+	}
+
+	redactor, err := redact.New(config.RedactPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Filter{
+		secret:    []byte(config.HashSecret),
+		maxLength: config.MaxTextLength,
+		longText:  longText,
+		redactor:  redactor,
+	}, nil
+}
+
+// ID replaces an identifier with a keyed hash. The same identifier always maps
+// to the same hash, so records can still be grouped by user or session.
+func (f *Filter) ID(id string) string {
+	if id == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Text redacts personal data from text. Text over the length limit is
+// truncated after redaction, or removed entirely in strip mode.
+func (f *Filter) Text(text string) string {
+	runes := []rune(text)
+	if f.maxLength <= 0 || len(runes) <= f.maxLength {
+		return f.redactor.Redact(text)
+	}
+
+	if f.longText == LongTextStrip {
+		return fmt.Sprintf("[removed: %d characters]", len(runes))
+	}
+
+	// Redact before truncating so a cut never leaves part of a match behind
+	redacted := []rune(f.redactor.Redact(text))
+	if len(redacted) <= f.maxLength {
+		return string(redacted)
+	}
+	return fmt.Sprintf("%s… [%d characters omitted]", string(redacted[:f.maxLength]), len(redacted)-f.maxLength)
+}
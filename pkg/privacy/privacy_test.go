@@ -0,0 +1,42 @@
+package privacy
+
+import (
+	"testing"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+func TestNewRefusesForcedPrivacyWithoutSecret(t *testing.T) {
+	if _, err := New(configpkg.PrivacyConfig{Forced: true}); err == nil {
+		t.Fatal("New with forced privacy and no hash secret succeeded")
+	}
+	for _, config := range []configpkg.PrivacyConfig{
+		{Forced: true, HashSecret: "secret"},
+		{ExportPrivacy: true},
+		{},
+	} {
+		if _, err := New(config); err != nil {
+			t.Fatalf("New(%+v) = %v", config, err)
+		}
+	}
+}
+
+func TestIDIsKeyed(t *testing.T) {
+	filter := func(secret string) *Filter {
+		f, err := New(configpkg.PrivacyConfig{HashSecret: secret})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		return f
+	}
+	a, b := filter("secret-a"), filter("secret-b")
+	if a.ID("alice") != a.ID("alice") || a.ID("alice") == a.ID("bob") {
+		t.Fatalf("hashes of alice %s, %s and bob %s, want stable and distinct", a.ID("alice"), a.ID("alice"), a.ID("bob"))
+	}
+	if a.ID("alice") == b.ID("alice") {
+		t.Fatal("hashes with different secrets are equal")
+	}
+	if a.ID("") != "" {
+		t.Fatalf("hash of the empty ID = %q", a.ID(""))
+	}
+}
@@ -0,0 +1,164 @@
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var embedded embed.FS
+
+// Prompt template names. A file named <name>.tmpl in the prompts directory
+// overrides the embedded default.
+const (
+	SkillSelection       = "skill_selection"
+	SkillSelectionSystem = "skill_selection_system"
+	ToolSelection        = "tool_selection"
+	ToolSelectionSystem  = "tool_selection_system"
+)
+
+// names lists all templates that must be present
+var names = []string{SkillSelection, SkillSelectionSystem, ToolSelection, ToolSelectionSystem}
+
+// Output schemas describing the JSON the model must return
+const (
+	SkillSelectionSchema = `- If no skill is needed: {"use_skill": false, "reason": "reason why no skill is needed"}
+- If a skill is needed: {"use_skill": true, "skill_name": "exact skill name", "reason": "why this skill is appropriate"}`
+
+	ToolSelectionSchema = `- If no tool is needed: {"use_tool": false, "reason": "reason why no tool is needed"}
+- If a tool is needed: {"use_tool": true, "tool_name": "exact tool name", "args": {parameter: "value"}, "reason": "why this tool is appropriate"}`
+)
+
+// Item is a skill or tool offered to the model
+type Item struct {
+	Name        string
+	Description string
+}
+
+// SelectionData holds the variables available to selection templates
+type SelectionData struct {
+	Message      string // the user message
+	Items        []Item // available skills or tools
+	OutputSchema string // description of the expected JSON response
+}
+
+// Set holds parsed prompt templates and can be reloaded at runtime
+type Set struct {
+	mu        sync.RWMutex
+	dir       string
+	templates map[string]*template.Template
+}
+
+var (
+	defaultOnce sync.Once
+	defaultSet  *Set
+)
+
+// Default returns a Set containing only the embedded templates
+func Default() *Set {
+	defaultOnce.Do(func() {
+		set, err := Load("")
+		if err != nil {
+			// The embedded templates ship with the binary, so this is a programming error
+			panic(fmt.Sprintf("invalid embedded prompt templates: %v", err))
+		}
+		defaultSet = set
+	})
+	return defaultSet
+}
+
+// Load parses the embedded templates and overrides them with any templates in dir
+func Load(dir string) (*Set, error) {
+	templates, err := parse(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Set{dir: dir, templates: templates}, nil
+}
+
+// Reload re-reads the templates from dir. On error the current templates are kept.
+func (s *Set) Reload(dir string) error {
+	templates, err := parse(dir)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.dir = dir
+	s.templates = templates
+	s.mu.Unlock()
+	return nil
+}
+
+// Dir returns the directory overriding the embedded templates
+func (s *Set) Dir() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dir
+}
+
+// Render executes the named template with data
+func (s *Set) Render(name string, data any) (string, error) {
+	s.mu.RLock()
+	tmpl, ok := s.templates[name]
+	s.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("prompt template not found: %s", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// parse loads and validates all templates
+func parse(dir string) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template, len(names))
+
+	for _, name := range names {
+		file := name + ".tmpl"
+
+		text, err := embedded.ReadFile("templates/" + file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedded prompt %s: %w", file, err)
+		}
+
+		if dir != "" {
+			override, err := os.ReadFile(filepath.Join(dir, file))
+			if err == nil {
+				log.Printf("Using prompt override %s", filepath.Join(dir, file))
+				text = override
+			} else if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to read prompt %s: %w", file, err)
+			}
+		}
+
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt %s: %w", file, err)
+		}
+
+		// Render against sample data so references to unknown variables fail now, not mid-chat
+		sample := SelectionData{
+			Message:      "sample message",
+			Items:        []Item{{Name: "sample", Description: "sample description"}},
+			OutputSchema: SkillSelectionSchema,
+		}
+		if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+			return nil, fmt.Errorf("invalid prompt %s: %w", file, err)
+		}
+
+		templates[name] = tmpl
+	}
+
+	return templates, nil
+}
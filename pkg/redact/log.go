@@ -0,0 +1,135 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// secretRules are the default rules matching credentials; they are applied to
+// every log line regardless of the log policy
+var secretRules = func() []Rule {
+	var rules []Rule
+	for _, rule := range DefaultRules {
+		switch rule.Name {
+		case "jwt", "bearer", "api_key":
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}()
+
+// authHeaderPattern matches credentials logged as headers, e.g. a dumped
+// request, including the credentials after an authorization scheme
+var authHeaderPattern = regexp.MustCompile(`(?i)\b(authorization|x-api-key|api[_-]?key|cookie)(["']?\s*[:=]\s*["']?\[?)(?:(?:basic|bearer|digest|negotiate|token)\s+)?[^\s"',}]+`)
+
+// LogPolicy decides how much of user content and session identifiers reaches
+// the logs. A nil policy logs content unchanged.
+type LogPolicy struct {
+	logContent bool
+	maxLength  int
+	hashIDs    bool
+	secrets    []string
+}
+
+// NewLogPolicy creates the log policy of the logging configuration. secrets
+// are configured values, such as API keys, that must never appear in logs.
+func NewLogPolicy(config configpkg.LoggingConfig, secrets ...string) *LogPolicy {
+	policy := &LogPolicy{
+		logContent: !config.ContentDebugOnly || strings.EqualFold(config.Level, "debug"),
+		maxLength:  config.MaxContentLength,
+		hashIDs:    config.HashSessionIDs,
+	}
+	for _, secret := range secrets {
+		// Short values would redact unrelated text
+		if len(secret) >= 8 {
+			policy.secrets = append(policy.secrets, secret)
+		}
+	}
+	return policy
+}
+
+// Content returns user content, such as a message or an answer, as it may be
+// logged: omitted unless content logging is enabled, else truncated
+func (p *LogPolicy) Content(text string) string {
+	if p == nil {
+		return text
+	}
+	if !p.logContent {
+		return fmt.Sprintf("[%d chars]", len([]rune(text)))
+	}
+	if runes := []rune(text); p.maxLength > 0 && len(runes) > p.maxLength {
+		return string(runes[:p.maxLength]) + fmt.Sprintf("... [%d chars]", len(runes))
+	}
+	return text
+}
+
+// ID returns a session ID as it may be logged: a stable hash when hashing is
+// enabled, so log lines of one session can still be correlated
+func (p *LogPolicy) ID(id string) string {
+	if p == nil || !p.hashIDs || id == "" {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return "h:" + hex.EncodeToString(sum[:6])
+}
+
+// Scrub removes credentials from a log line: tokens, API keys, credential
+// headers and the configured secrets
+func (p *LogPolicy) Scrub(line string) string {
+	for _, rule := range secretRules {
+		line = rule.Pattern.ReplaceAllString(line, rule.Replacement)
+	}
+	line = authHeaderPattern.ReplaceAllString(line, "$1$2[REDACTED]")
+	if p != nil {
+		for _, secret := range p.secrets {
+			line = strings.ReplaceAll(line, secret, "[REDACTED]")
+		}
+	}
+	return line
+}
+
+// Writer returns a writer scrubbing every write before passing it to w. The
+// standard logger writes each entry with one call, so entries are scrubbed whole.
+func (p *LogPolicy) Writer(w io.Writer) io.Writer {
+	return &scrubWriter{policy: p, w: w}
+}
+
+// scrubWriter scrubs credentials from the writes to an underlying writer
+type scrubWriter struct {
+	policy *LogPolicy
+	w      io.Writer
+}
+
+// Write writes the scrubbed data and reports the length of the original data
+func (s *scrubWriter) Write(data []byte) (int, error) {
+	if _, err := io.WriteString(s.w, s.policy.Scrub(string(data))); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// logPolicy is the policy used by the package-level helpers
+var logPolicy atomic.Pointer[LogPolicy]
+
+// SetLogPolicy sets the policy used by LogContent and LogID
+func SetLogPolicy(policy *LogPolicy) {
+	logPolicy.Store(policy)
+}
+
+// LogContent returns user content as it may be logged under the current policy.
+// Every log line including messages, answers or LLM output must use it.
+func LogContent(text string) string {
+	return logPolicy.Load().Content(text)
+}
+
+// LogID returns a session ID as it may be logged under the current policy
+func LogID(id string) string {
+	return logPolicy.Load().ID(id)
+}
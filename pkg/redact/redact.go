@@ -0,0 +1,59 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Rule replaces every match of a pattern with a placeholder
+type Rule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// DefaultRules scrub common personal data and credentials. Order matters:
+// more specific patterns run first so e.g. a card number is not reported as a phone number.
+var DefaultRules = []Rule{
+	{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), Replacement: "[TOKEN]"},
+	{Name: "bearer", Pattern: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]{8,}`), Replacement: "Bearer [TOKEN]"},
+	{Name: "api_key", Pattern: regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}|\bAKIA[0-9A-Z]{16}\b|\bgh[pousr]_[A-Za-z0-9]{20,}`), Replacement: "[API_KEY]"},
+	{Name: "email", Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), Replacement: "[EMAIL]"},
+	{Name: "card", Pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), Replacement: "[CARD]"},
+	{Name: "ipv4", Pattern: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`), Replacement: "[IP]"},
+	{Name: "phone", Pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{2,4}\)[ .-]?|\b\d{2,4}[ .-])\d{3,4}[ .-]?\d{3,4}\b`), Replacement: "[PHONE]"},
+}
+
+// Redactor scrubs personal data from text
+type Redactor struct {
+	rules []Rule
+}
+
+// New creates a redactor using the default rules plus extra regular expressions,
+// whose matches are replaced with [REDACTED]
+func New(extra []string) (*Redactor, error) {
+	rules := make([]Rule, len(DefaultRules), len(DefaultRules)+len(extra))
+	copy(rules, DefaultRules)
+
+	for i, expr := range extra {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", expr, err)
+		}
+		rules = append(rules, Rule{Name: fmt.Sprintf("custom_%d", i), Pattern: pattern, Replacement: "[REDACTED]"})
+	}
+
+	return &Redactor{rules: rules}, nil
+}
+
+// Redact returns text with every rule applied. It is safe to call on a nil Redactor,
+// which returns the text unchanged.
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, rule := range r.rules {
+		text = rule.Pattern.ReplaceAllString(text, rule.Replacement)
+	}
+	return text
+}
@@ -0,0 +1,444 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/smallnest/goskills"
+	mcpclient "github.com/smallnest/goskills/mcp"
+	"github.com/tmc/langchaingo/tools"
+
+	"github.com/smallnest/langchat/pkg/audit"
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// ErrViolation is returned when a tool call tries to escape the sandbox
+var ErrViolation = errors.New("sandbox violation")
+
+// sessionIDPattern restricts session IDs used as directory names
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Sandbox isolates tool subprocesses: it restricts their environment to an
+// allow-list and runs them inside a per-session working directory.
+type Sandbox struct {
+	config configpkg.SandboxConfig
+	audit  *audit.Logger
+}
+
+// New creates a new Sandbox from configuration
+func New(config configpkg.SandboxConfig, auditLogger *audit.Logger) *Sandbox {
+	return &Sandbox{
+		config: config,
+		audit:  auditLogger,
+	}
+}
+
+// Enabled reports whether sandboxing is active. It is safe to call on a nil Sandbox.
+func (s *Sandbox) Enabled() bool {
+	return s != nil && s.config.Enabled
+}
+
+// SessionDir returns (and creates) the working directory for a session
+func (s *Sandbox) SessionDir(sessionID string) (string, error) {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return "", fmt.Errorf("invalid session id for sandbox: %q", sessionID)
+	}
+
+	root, err := filepath.Abs(s.config.Root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve sandbox root: %w", err)
+	}
+
+	dir := filepath.Join(root, sessionID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+	return dir, nil
+}
+
+// RemoveSession deletes the working directory of a session
+func (s *Sandbox) RemoveSession(sessionID string) error {
+	if !s.Enabled() {
+		return nil
+	}
+	if !sessionIDPattern.MatchString(sessionID) {
+		return fmt.Errorf("invalid session id for sandbox: %q", sessionID)
+	}
+
+	root, err := filepath.Abs(s.config.Root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve sandbox root: %w", err)
+	}
+	return os.RemoveAll(filepath.Join(root, sessionID))
+}
+
+// Env returns the allow-listed subset of the server environment plus the given extras
+func (s *Sandbox) Env(dir string, extra map[string]string) []string {
+	allowed := make(map[string]bool, len(s.config.AllowedEnv))
+	for _, name := range s.config.AllowedEnv {
+		allowed[name] = true
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if allowed[name] {
+			env = append(env, kv)
+		}
+	}
+
+	// Keep temporary files inside the session directory
+	env = append(env, "TMPDIR="+dir, "SANDBOX_DIR="+dir)
+
+	for k, v := range extra {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// ApplyMCP rewrites stdio MCP server commands so they start with a clean
+// environment inside the session's sandbox directory. The environment,
+// which may hold the user's secrets, is passed as the server's process
+// environment and never on its command line, where other local users could
+// read it.
+func (s *Sandbox) ApplyMCP(sessionID string, config *mcpclient.Config) error {
+	if !s.Enabled() || config == nil {
+		return nil
+	}
+
+	dir, err := s.SessionDir(sessionID)
+	if err != nil {
+		return err
+	}
+
+	for name, server := range config.MCPServers {
+		if server.Type == "sse" || server.Command == "" {
+			continue
+		}
+
+		env := make(map[string]string)
+		for _, kv := range s.Env(dir, server.Env) {
+			k, v, _ := strings.Cut(kv, "=")
+			env[k] = v
+		}
+
+		// The MCP client starts the server with the inherited environment
+		// plus env, so env -u drops each inherited variable not in env by
+		// name; sh changes into the sandbox directory before exec'ing the
+		// real server command.
+		var args []string
+		for _, kv := range os.Environ() {
+			if k, _, _ := strings.Cut(kv, "="); k != "" {
+				if _, ok := env[k]; !ok {
+					args = append(args, "-u", k)
+				}
+			}
+		}
+		args = append(args, "sh", "-c", `cd "$1" && shift && exec "$@"`, "sh", dir, server.Command)
+		args = append(args, server.Args...)
+
+		server.Command = "env"
+		server.Args = args
+		server.Env = env
+		config.MCPServers[name] = server
+	}
+
+	return nil
+}
+
+// WrapSkillTools wraps the tools of a skill package so they execute inside the sandbox
+func (s *Sandbox) WrapSkillTools(sessionID string, skill *goskills.SkillPackage, skillTools []tools.Tool) []tools.Tool {
+	if !s.Enabled() {
+		return skillTools
+	}
+
+	_, scriptMap := goskills.GenerateToolDefinitions(skill)
+
+	wrapped := make([]tools.Tool, 0, len(skillTools))
+	for _, tool := range skillTools {
+		wrapped = append(wrapped, &sandboxedTool{
+			Tool:      tool,
+			sandbox:   s,
+			sessionID: sessionID,
+			skillPath: skill.Path,
+			scriptMap: scriptMap,
+		})
+	}
+	return wrapped
+}
+
+// violation records an attempt to escape the sandbox
+func (s *Sandbox) violation(sessionID, toolName, path, reason string) error {
+	s.audit.Log(audit.Event{
+		Action:   "sandbox.violation",
+		Actor:    sessionID,
+		Resource: toolName,
+		Result:   "denied",
+		Details: map[string]any{
+			"path":   path,
+			"reason": reason,
+		},
+	})
+	return fmt.Errorf("%w: %s", ErrViolation, reason)
+}
+
+// sandboxedTool executes a goskills tool with a restricted environment and working directory
+type sandboxedTool struct {
+	tools.Tool
+	sandbox   *Sandbox
+	sessionID string
+	skillPath string
+	scriptMap map[string]string
+}
+
+// Call runs the tool inside the sandbox
+func (t *sandboxedTool) Call(ctx context.Context, input string) (string, error) {
+	dir, err := t.sandbox.SessionDir(t.sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	readOnly := t.sandbox.config.ReadOnly
+	name := t.Name()
+
+	switch name {
+	case "run_shell_code", "run_python_code":
+		if readOnly {
+			return "", t.sandbox.violation(t.sessionID, name, "", "ad hoc code execution is disabled in read-only mode")
+		}
+		var params struct {
+			Code string         `json:"code"`
+			Args map[string]any `json:"args"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal %s arguments: %w", name, err)
+		}
+		ext := ".sh"
+		if name == "run_python_code" {
+			ext = ".py"
+		}
+		script, err := t.renderScript(dir, ext, params.Code, params.Args)
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(script)
+		return t.runScript(ctx, dir, script, nil)
+
+	case "run_shell_script", "run_python_script":
+		// Scripts could write anywhere the server can, so they are not run at all
+		if readOnly {
+			return "", t.sandbox.violation(t.sessionID, name, "", "script execution is disabled in read-only mode")
+		}
+		var params struct {
+			ScriptPath string   `json:"scriptPath"`
+			Args       []string `json:"args"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal %s arguments: %w", name, err)
+		}
+		script, err := t.resolvePath(dir, params.ScriptPath, true)
+		if err != nil {
+			return "", err
+		}
+		return t.runScript(ctx, dir, script, params.Args)
+
+	case "read_file":
+		var params struct {
+			FilePath string `json:"filePath"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal read_file arguments: %w", err)
+		}
+		path, err := t.resolvePath(dir, params.FilePath, true)
+		if err != nil {
+			return "", err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file '%s': %w", params.FilePath, err)
+		}
+		return string(content), nil
+
+	case "write_file":
+		var params struct {
+			FilePath string `json:"filePath"`
+			Content  string `json:"content"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal write_file arguments: %w", err)
+		}
+		if readOnly {
+			return "", t.sandbox.violation(t.sessionID, name, params.FilePath, "file writes are disabled in read-only mode")
+		}
+		path, err := t.resolvePath(dir, params.FilePath, false)
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, []byte(params.Content), 0644); err != nil {
+			return "", fmt.Errorf("failed to write to file '%s': %w", params.FilePath, err)
+		}
+		return fmt.Sprintf("Successfully wrote to file: %s", params.FilePath), nil
+	}
+
+	if scriptPath, ok := t.scriptMap[name]; ok {
+		if readOnly {
+			return "", t.sandbox.violation(t.sessionID, name, scriptPath, "script execution is disabled in read-only mode")
+		}
+		var params struct {
+			Args []string `json:"args"`
+		}
+		if input != "" {
+			if err := json.Unmarshal([]byte(input), &params); err != nil {
+				return "", fmt.Errorf("failed to unmarshal script arguments: %w", err)
+			}
+		}
+		return t.runScript(ctx, dir, scriptPath, params.Args)
+	}
+
+	// Tools without local side effects (web search, fetch) run unchanged
+	return t.Tool.Call(ctx, input)
+}
+
+// resolvePath resolves a tool-provided path against the session directory and
+// rejects paths outside of it. Reads are additionally allowed inside the skill package.
+// Symbolic links are resolved before the check, so a link inside the directory
+// cannot point out of it.
+func (t *sandboxedTool) resolvePath(dir, path string, allowSkillDir bool) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	resolved := path
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(dir, resolved)
+		if allowSkillDir && t.skillPath != "" {
+			if _, err := os.Stat(resolved); err != nil {
+				candidate := filepath.Join(t.skillPath, path)
+				if _, err := os.Stat(candidate); err == nil {
+					resolved = candidate
+				}
+			}
+		}
+	}
+	resolved, err := filepath.Abs(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+	if resolved, err = evalSymlinks(resolved); err != nil {
+		return "", t.sandbox.violation(t.sessionID, t.Name(), path, err.Error())
+	}
+
+	if realDir, err := evalSymlinks(dir); err == nil && within(realDir, resolved) {
+		return resolved, nil
+	}
+	if allowSkillDir && t.skillPath != "" {
+		if skillDir, err := filepath.Abs(t.skillPath); err == nil {
+			if skillDir, err = evalSymlinks(skillDir); err == nil && within(skillDir, resolved) {
+				return resolved, nil
+			}
+		}
+	}
+
+	return "", t.sandbox.violation(t.sessionID, t.Name(), path, "path escapes the sandbox directory")
+}
+
+// evalSymlinks resolves the symbolic links of an absolute path. The part of
+// the path that does not exist yet, e.g. a file about to be written, is kept
+// as it is; a link to a missing target is refused, as writing through it
+// would create the target wherever it points.
+func evalSymlinks(path string) (string, error) {
+	existing, rest := path, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to resolve path: %w", err)
+		}
+		if _, err := os.Lstat(existing); err == nil {
+			return "", fmt.Errorf("path is a link to a missing target")
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path, nil
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// renderScript renders a code template into a temporary file in the session directory
+func (t *sandboxedTool) renderScript(dir, ext, code string, args map[string]any) (string, error) {
+	tmpl, err := template.New("script").Parse(code)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse script template: %w", err)
+	}
+
+	var script bytes.Buffer
+	if err := tmpl.Execute(&script, args); err != nil {
+		return "", fmt.Errorf("failed to execute script template: %w", err)
+	}
+
+	file, err := os.CreateTemp(dir, "script-*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(script.Bytes()); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write to temp file: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// runScript executes a shell or Python script with the sandboxed environment
+func (t *sandboxedTool) runScript(ctx context.Context, dir, scriptPath string, args []string) (string, error) {
+	// The working directory changes, so relative skill paths must be absolute
+	if abs, err := filepath.Abs(scriptPath); err == nil {
+		scriptPath = abs
+	}
+
+	interpreter := "bash"
+	if strings.HasSuffix(scriptPath, ".py") {
+		var err error
+		if interpreter, err = exec.LookPath("python3"); err != nil {
+			if interpreter, err = exec.LookPath("python"); err != nil {
+				return "", fmt.Errorf("failed to find python3 or python in PATH: %w", err)
+			}
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, interpreter, append([]string{scriptPath}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = t.sandbox.Env(dir, nil)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to run script '%s': %w\nStdout: %s\nStderr: %s", filepath.Base(scriptPath), err, stdout.String(), stderr.String())
+	}
+
+	return stdout.String() + stderr.String(), nil
+}
+
+// within reports whether path is inside dir
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
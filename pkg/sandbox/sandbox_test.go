@@ -0,0 +1,206 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mcpclient "github.com/smallnest/goskills/mcp"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+const testSessionID = "session-1"
+
+// stubTool is a skill tool that only has a name; the sandbox runs it itself
+type stubTool struct{ name string }
+
+func (t stubTool) Name() string        { return t.name }
+func (t stubTool) Description() string { return t.name }
+func (t stubTool) Call(context.Context, string) (string, error) {
+	return "", errors.New("not sandboxed")
+}
+
+// newTestTool returns the sandboxed tool name of a sandbox rooted in a
+// temporary directory, with the session directory it runs in
+func newTestTool(t *testing.T, name string, readOnly bool, scriptMap map[string]string) (*sandboxedTool, string) {
+	t.Helper()
+	sb := New(configpkg.SandboxConfig{Enabled: true, Root: t.TempDir(), ReadOnly: readOnly}, nil)
+	dir, err := sb.SessionDir(testSessionID)
+	if err != nil {
+		t.Fatalf("SessionDir: %v", err)
+	}
+	return &sandboxedTool{Tool: stubTool{name}, sandbox: sb, sessionID: testSessionID, scriptMap: scriptMap}, dir
+}
+
+// writeScript writes a shell script creating the file marker to dir
+func writeScript(t *testing.T, dir, marker string) string {
+	t.Helper()
+	path := filepath.Join(dir, "script.sh")
+	if err := os.WriteFile(path, []byte("touch "+marker+"\n"), 0755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestReadOnlyRefusesScripts(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input func(script string) string
+		skill bool
+	}{
+		{name: "run_shell_code", input: func(string) string { return `{"code": "touch marker"}` }},
+		{name: "run_shell_script", input: func(script string) string { return `{"scriptPath": "` + script + `"}` }},
+		{name: "skill_script", input: func(string) string { return `{}` }, skill: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			marker := filepath.Join(t.TempDir(), "marker")
+			tool, dir := newTestTool(t, tc.name, true, nil)
+			script := writeScript(t, dir, marker)
+			if tc.skill {
+				tool.scriptMap = map[string]string{tc.name: script}
+			}
+
+			if _, err := tool.Call(context.Background(), tc.input(script)); !errors.Is(err, ErrViolation) {
+				t.Fatalf("Call = %v, want ErrViolation", err)
+			}
+			if _, err := os.Stat(marker); err == nil {
+				t.Fatal("script ran in read-only mode")
+			}
+		})
+	}
+}
+
+func TestReadOnlyAllowsReads(t *testing.T) {
+	tool, dir := newTestTool(t, "read_file", true, nil)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	got, err := tool.Call(context.Background(), `{"filePath": "notes.txt"}`)
+	if err != nil || got != "hello" {
+		t.Fatalf("read_file = %q, %v", got, err)
+	}
+
+	writer := &sandboxedTool{Tool: stubTool{"write_file"}, sandbox: tool.sandbox, sessionID: testSessionID}
+	if _, err := writer.Call(context.Background(), `{"filePath": "new.txt", "content": "x"}`); !errors.Is(err, ErrViolation) {
+		t.Fatalf("write_file = %v, want ErrViolation", err)
+	}
+}
+
+func TestScriptsRunWhenWritable(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	tool, dir := newTestTool(t, "run_shell_script", false, nil)
+	script := writeScript(t, dir, marker)
+
+	if _, err := tool.Call(context.Background(), `{"scriptPath": "`+filepath.Base(script)+`"}`); err != nil {
+		t.Fatalf("run_shell_script: %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("script did not run: %v", err)
+	}
+}
+
+func TestSymlinksCannotEscape(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	reader, dir := newTestTool(t, "read_file", false, nil)
+	writer := &sandboxedTool{Tool: stubTool{"write_file"}, sandbox: reader.sandbox, sessionID: testSessionID}
+
+	links := map[string]string{
+		"outdir":   outside,
+		"secret":   filepath.Join(outside, "secret.txt"),
+		"dangling": filepath.Join(outside, "missing.txt"),
+		"inside":   filepath.Join(dir, "notes.txt"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatalf("Symlink: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	for _, path := range []string{"outdir/secret.txt", "secret", filepath.Join(dir, "secret")} {
+		if got, err := reader.Call(context.Background(), `{"filePath": "`+path+`"}`); !errors.Is(err, ErrViolation) {
+			t.Errorf("read_file %s = %q, %v, want ErrViolation", path, got, err)
+		}
+	}
+	for _, path := range []string{"outdir/new.txt", "dangling", "secret"} {
+		if _, err := writer.Call(context.Background(), `{"filePath": "`+path+`", "content": "x"}`); !errors.Is(err, ErrViolation) {
+			t.Errorf("write_file %s = %v, want ErrViolation", path, err)
+		}
+	}
+	for _, name := range []string{"new.txt", "missing.txt"} {
+		if _, err := os.Stat(filepath.Join(outside, name)); err == nil {
+			t.Errorf("%s written outside the sandbox", name)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(outside, "secret.txt")); string(data) != "secret" {
+		t.Errorf("file outside the sandbox overwritten with %q", data)
+	}
+
+	// Links that stay inside the directory keep working
+	if got, err := reader.Call(context.Background(), `{"filePath": "inside"}`); err != nil || got != "notes" {
+		t.Errorf("read_file through an inner link = %q, %v", got, err)
+	}
+	if _, err := writer.Call(context.Background(), `{"filePath": "new.txt", "content": "x"}`); err != nil {
+		t.Errorf("write_file of a new file = %v", err)
+	}
+}
+
+func TestApplyMCPKeepsSecretsOffTheCommandLine(t *testing.T) {
+	const secret = "ghp_secret-token-value"
+	t.Setenv("LANGCHAT_TEST_INHERITED", "not for the server")
+	sb := New(configpkg.SandboxConfig{Enabled: true, Root: t.TempDir(), AllowedEnv: []string{"PATH"}}, nil)
+	dir, err := sb.SessionDir(testSessionID)
+	if err != nil {
+		t.Fatalf("SessionDir: %v", err)
+	}
+	config := &mcpclient.Config{MCPServers: map[string]mcpclient.MCPServer{
+		"github": {Command: "sh", Args: []string{"-c", "pwd; env"}, Env: map[string]string{"GITHUB_TOKEN": secret}},
+	}}
+
+	if err := sb.ApplyMCP(testSessionID, config); err != nil {
+		t.Fatalf("ApplyMCP: %v", err)
+	}
+	server := config.MCPServers["github"]
+	for _, arg := range append([]string{server.Command}, server.Args...) {
+		if strings.Contains(arg, secret) {
+			t.Fatalf("secret on the command line: %q", server.Args)
+		}
+	}
+	if server.Env["GITHUB_TOKEN"] != secret {
+		t.Fatalf("server environment = %v, want the secret", server.Env)
+	}
+
+	// Started as the MCP client does: the inherited environment plus Env
+	cmd := exec.Command(server.Command, server.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range server.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("server command: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if lines[0] != dir {
+		t.Fatalf("server started in %s, want %s", lines[0], dir)
+	}
+	environment := strings.Join(lines[1:], "\n")
+	for _, want := range []string{"GITHUB_TOKEN=" + secret, "PATH=" + os.Getenv("PATH"), "SANDBOX_DIR=" + dir} {
+		if !strings.Contains(environment, want) {
+			t.Errorf("server environment lacks %s:\n%s", want, environment)
+		}
+	}
+	if strings.Contains(environment, "LANGCHAT_TEST_INHERITED") {
+		t.Errorf("server inherited a variable that is not allowed:\n%s", environment)
+	}
+}
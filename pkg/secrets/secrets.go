@@ -0,0 +1,81 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrDisabled is returned when no encryption key is configured
+	ErrDisabled = errors.New("secrets require an encryption key (ENCRYPTION_KEY)")
+	// ErrInvalidSealed is returned for sealed values that cannot be opened,
+	// e.g. because they were sealed with another key
+	ErrInvalidSealed = errors.New("invalid sealed secret")
+)
+
+// Box encrypts secrets at rest with AES-256-GCM. The AES key is derived from
+// the configured encryption key, so any passphrase length works. A nil Box
+// is disabled and refuses to seal or open.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a box from an encryption key; an empty key disables secrets
+// and returns a nil box
+func New(key string) (*Box, error) {
+	if key == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secrets cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secrets cipher: %w", err)
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Enabled reports whether the box can seal and open secrets
+func (b *Box) Enabled() bool {
+	return b != nil
+}
+
+// Seal encrypts a secret and returns it base64 encoded, with a random nonce
+// in front. name is authenticated with the value, so a sealed value copied
+// to another name does not open.
+func (b *Box) Seal(name, value string) (string, error) {
+	if b == nil {
+		return "", ErrDisabled
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a secret sealed under name
+func (b *Box) Open(name, sealed string) (string, error) {
+	if b == nil {
+		return "", ErrDisabled
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return "", ErrInvalidSealed
+	}
+	nonce, ciphertext := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	value, err := b.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", ErrInvalidSealed
+	}
+	return string(value), nil
+}
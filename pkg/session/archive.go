@@ -0,0 +1,38 @@
+package session
+
+import "errors"
+
+// ErrSessionArchived is returned when an archived session is asked to continue
+var ErrSessionArchived = errors.New("session is archived")
+
+// SetSessionArchived archives or unarchives a session. Archived sessions are
+// read-only and hidden from the default session list.
+func (sm *SessionManager) SetSessionArchived(sessionID string, archived bool) error {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.Archived == archived {
+		return nil
+	}
+
+	now := sm.clock.Now()
+	session.Archived = archived
+	session.ArchivedAt = nil
+	if archived {
+		session.ArchivedAt = &now
+	}
+	session.UpdatedAt = now
+	return sm.save(session)
+}
+
+// IsArchived reports whether a session is archived
+func (s *Session) IsArchived() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Archived
+}
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrCorruptSession is returned by the Load of a store for a session that
+// cannot be decoded. FileSessionStore moves the file aside to
+// <id>.json.corrupt or <id>.json.gz.corrupt, RedisSessionStore to the key
+// corrupt:<id>, so the session no longer counts as stored and its ID can be
+// saved again.
+var ErrCorruptSession = errors.New("stored session is corrupt")
+
+// corruptSuffix is appended to the name of a session file that does not decode
+const corruptSuffix = ".corrupt"
+
+// writeFileAtomic replaces the file at path with data. The data is written
+// to a temporary file in the same directory and synced before it is renamed
+// into place, so a crash leaves either the old or the new file, never a
+// truncated one.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// quarantine moves the file at path of session id, which failed to decode
+// with decodeErr, out of the way and returns the ErrCorruptSession for it
+func quarantine(id, path string, decodeErr error) error {
+	corrupt := path + corruptSuffix
+	if err := os.Rename(path, corrupt); err != nil {
+		return fmt.Errorf("%w: %s: %v (failed to move it aside: %v)", ErrCorruptSession, id, decodeErr, err)
+	}
+	return fmt.Errorf("%w: %s: %v (moved to %s)", ErrCorruptSession, id, decodeErr, filepath.Base(corrupt))
+}
@@ -0,0 +1,114 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "s1.json")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new")); err != nil {
+		t.Fatalf("writeFileAtomic: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" || info.Mode().Perm() != 0o644 {
+		t.Fatalf("file = %q with mode %v, want the new data with mode 0644", data, info.Mode().Perm())
+	}
+	// No temporary file is left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("directory holds %d files, want only the session", len(entries))
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, "missing", "s2.json"), []byte("x")); err == nil {
+		t.Fatal("writeFileAtomic into a missing directory succeeded")
+	}
+}
+
+func TestStoreRecoversFromTruncatedFile(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		name := "json"
+		if compress {
+			name = "gzip"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			store := NewFileSessionStore(dir, WithCompression(compress))
+			for _, id := range []string{"s1", "s2"} {
+				if err := store.Save(testSession(id, "hello", "world")); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+			suffix, _ := store.suffixes()
+			path := filepath.Join(dir, "s1"+suffix)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			// A crash in the middle of a plain write
+			if err := os.WriteFile(path, data[:len(data)/2], 0o644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+
+			_, err = store.Load("s1")
+			if !errors.Is(err, ErrCorruptSession) || errors.Is(err, ErrSessionNotFound) {
+				t.Fatalf("Load of the truncated session = %v, want ErrCorruptSession", err)
+			}
+			if kept, err := os.ReadFile(path + corruptSuffix); err != nil || len(kept) != len(data)/2 {
+				t.Fatalf("corrupt file kept as %d bytes, %v, want the truncated data", len(kept), err)
+			}
+
+			// The damaged session is gone, the others are still served
+			if _, err := store.Load("s1"); !errors.Is(err, ErrSessionNotFound) {
+				t.Fatalf("second Load = %v, want ErrSessionNotFound", err)
+			}
+			sessions, err := store.List()
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var ids []string
+			for _, session := range sessions {
+				ids = append(ids, session.ID)
+			}
+			if !slices.Equal(ids, []string{"s2"}) {
+				t.Fatalf("List = %v, want [s2]", ids)
+			}
+			if ids, err := store.ListIDs(); err != nil || !slices.Equal(ids, []string{"s2"}) {
+				t.Fatalf("ListIDs = %v, %v, want [s2]", ids, err)
+			}
+
+			// The session can be written again
+			if err := store.Save(testSession("s1", "again")); err != nil {
+				t.Fatalf("Save after recovery: %v", err)
+			}
+			loaded, err := store.Load("s1")
+			if err != nil || !slices.Equal(contents(loaded.Messages), []string{"again"}) {
+				t.Fatalf("Load after recovery = %v, %v", loaded, err)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("ReadDir: %v", err)
+			}
+			for _, entry := range entries {
+				if strings.HasSuffix(entry.Name(), ".tmp") {
+					t.Fatalf("temporary file %s left behind", entry.Name())
+				}
+			}
+		})
+	}
+}
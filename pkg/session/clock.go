@@ -0,0 +1,34 @@
+package session
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Clock supplies the current time. It is injectable so that time-dependent
+// behavior (timestamps, ordering, expiry) can be tested with a fake clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator creates session and message IDs
+type IDGenerator interface {
+	NewID() string
+}
+
+// systemClock is the default Clock backed by time.Now
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// uuidGenerator is the default IDGenerator backed by random UUIDs
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() string { return uuid.New().String() }
+
+// SystemClock is the real wall clock
+var SystemClock Clock = systemClock{}
+
+// UUIDGenerator generates random UUIDs
+var UUIDGenerator IDGenerator = uuidGenerator{}
@@ -0,0 +1,95 @@
+package session
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Suffixes of the session files of a FileSessionStore
+const (
+	plainSuffix      = ".json"
+	compressedSuffix = ".json.gz"
+)
+
+// FileStoreOption configures a FileSessionStore
+type FileStoreOption func(*FileSessionStore)
+
+// WithCompression makes the store write sessions as gzip-compressed compact
+// JSON to <id>.json.gz instead of indented JSON to <id>.json. Sessions are
+// loaded from either kind of file regardless, and a saved session replaces
+// its file of the other kind, so the option can be switched at any time.
+func WithCompression(enabled bool) FileStoreOption {
+	return func(s *FileSessionStore) {
+		s.compress = enabled
+	}
+}
+
+// suffixes returns the suffix of the files the store writes, then the other one
+func (s *FileSessionStore) suffixes() (write, other string) {
+	if s.compress {
+		return compressedSuffix, plainSuffix
+	}
+	return plainSuffix, compressedSuffix
+}
+
+// encodeSession returns the file content of a session: gzip-compressed
+// compact JSON, or indented JSON
+func encodeSession(session *Session, compress bool) ([]byte, error) {
+	if !compress {
+		return json.MarshalIndent(session, "", "  ")
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(session); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeSession decodes the content of a session file, decompressing it
+// first when it was read from a compressed file
+func decodeSession(data []byte, compressed bool) (*Session, error) {
+	if compressed {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// sessionFileID returns the session ID of a session file name, or false for
+// another file
+func sessionFileID(name string) (string, bool) {
+	for _, suffix := range []string{compressedSuffix, plainSuffix} {
+		if id, ok := strings.CutSuffix(name, suffix); ok && id != "" {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// removeIfExists removes the file at path unless it does not exist
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// longSession returns a session of n messages alternating between the user
+// and the assistant, with answers of a few hundred bytes
+func longSession(id string, n int) *Session {
+	session := &Session{ID: id, Title: "A long conversation", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	for i := range n {
+		msg := Message{ID: fmt.Sprintf("m%d", i), Role: "user", Timestamp: time.Now(),
+			Content: fmt.Sprintf("Question %d: how do I write a table-driven test for case %d?", i, i*7)}
+		if i%2 == 1 {
+			msg.Role = "assistant"
+			msg.Content = fmt.Sprintf("For case %d, declare a slice of structs with the inputs and the expected output, "+
+				"loop over it, and call t.Run with the name of each case so that failures point at it. "+
+				"Keep the expected values literal; computing them with the code under test hides bugs. "+
+				"Use t.Fatalf when the rest of the case cannot run, t.Errorf otherwise. (answer %d)", i*7, i)
+		}
+		session.Messages = append(session.Messages, msg)
+	}
+	return session
+}
+
+func TestFileSessionStoreCompression(t *testing.T) {
+	dir := t.TempDir()
+	plain := NewFileSessionStore(dir)
+	compressed := NewFileSessionStore(dir, WithCompression(true))
+	session := longSession("s1", 500)
+	exists := func(suffix string) bool {
+		_, err := os.Stat(filepath.Join(dir, "s1"+suffix))
+		return err == nil
+	}
+
+	// A legacy plain file loads in a compressing store
+	if err := plain.Save(session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	plainInfo, err := os.Stat(filepath.Join(dir, "s1"+plainSuffix))
+	if err != nil {
+		t.Fatalf("plain session file: %v", err)
+	}
+	loaded, err := compressed.Load("s1")
+	if err != nil || !slices.Equal(contents(loaded.Messages), contents(session.Messages)) {
+		t.Fatalf("Load of the plain file = %v", err)
+	}
+
+	// Saving compressed replaces the plain file
+	if err := compressed.Save(session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if exists(plainSuffix) || !exists(compressedSuffix) {
+		t.Fatalf("after a compressed save, plain file %v, compressed file %v", exists(plainSuffix), exists(compressedSuffix))
+	}
+	compressedInfo, err := os.Stat(filepath.Join(dir, "s1"+compressedSuffix))
+	if err != nil || compressedInfo.Size() >= plainInfo.Size()/4 {
+		t.Fatalf("compressed file of %d bytes, %v, want under a quarter of the %d plain bytes", compressedInfo.Size(), err, plainInfo.Size())
+	}
+	for name, store := range map[string]*FileSessionStore{"plain": plain, "compressed": compressed} {
+		loaded, err := store.Load("s1")
+		if err != nil || !slices.Equal(contents(loaded.Messages), contents(session.Messages)) || loaded.Title != session.Title {
+			t.Fatalf("%s Load of the compressed file = %v", name, err)
+		}
+		if ok, err := store.Exists("s1"); err != nil || !ok {
+			t.Fatalf("%s Exists = %v, %v", name, ok, err)
+		}
+		if ids, err := store.ListIDs(); err != nil || !slices.Equal(ids, []string{"s1"}) {
+			t.Fatalf("%s ListIDs = %v, %v", name, ids, err)
+		}
+	}
+
+	// And switching back replaces the compressed file
+	if err := plain.Save(session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if !exists(plainSuffix) || exists(compressedSuffix) {
+		t.Fatalf("after a plain save, plain file %v, compressed file %v", exists(plainSuffix), exists(compressedSuffix))
+	}
+	if err := compressed.Delete("s1"); err != nil || exists(plainSuffix) {
+		t.Fatalf("Delete = %v, plain file left %v", err, exists(plainSuffix))
+	}
+}
+
+// benchmarkStores runs a benchmark against a plain and a compressing store
+// holding a 500-message session, reporting the size of its file
+func benchmarkStores(b *testing.B, run func(b *testing.B, store *FileSessionStore, session *Session)) {
+	session := longSession("s1", 500)
+	for _, compress := range []bool{false, true} {
+		name := "json"
+		if compress {
+			name = "gzip"
+		}
+		b.Run(name, func(b *testing.B) {
+			dir := b.TempDir()
+			store := NewFileSessionStore(dir, WithCompression(compress))
+			if err := store.Save(session); err != nil {
+				b.Fatalf("Save: %v", err)
+			}
+			suffix, _ := store.suffixes()
+			info, err := os.Stat(filepath.Join(dir, "s1"+suffix))
+			if err != nil {
+				b.Fatalf("Stat: %v", err)
+			}
+			run(b, store, session)
+			b.ReportMetric(float64(info.Size()), "file-bytes")
+		})
+	}
+}
+
+func BenchmarkFileSessionStoreSave(b *testing.B) {
+	benchmarkStores(b, func(b *testing.B, store *FileSessionStore, session *Session) {
+		for b.Loop() {
+			if err := store.Save(session); err != nil {
+				b.Fatalf("Save: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkFileSessionStoreLoad(b *testing.B) {
+	benchmarkStores(b, func(b *testing.B, store *FileSessionStore, session *Session) {
+		for b.Loop() {
+			if _, err := store.Load(session.ID); err != nil {
+				b.Fatalf("Load: %v", err)
+			}
+		}
+	})
+}
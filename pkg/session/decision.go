@@ -0,0 +1,38 @@
+package session
+
+// Stages of a selection decision
+const (
+	SelectionStageSkill     = "skill"      // whether to use a skill, and which
+	SelectionStageSkillTool = "skill_tool" // which tool of the selected skill
+	SelectionStageMCPTool   = "mcp_tool"   // whether to use an MCP tool, and which
+)
+
+// Limits of a stored selection decision
+const (
+	MaxDecisionReasonLength = 300 // characters of the model's reason
+	MaxDecisionCandidates   = 30  // names of the offered skills or tools
+	maxDecisionErrorLength  = 200
+)
+
+// SelectionDecision records how the model chose a skill or tool for a turn,
+// so users and administrators can see why a skill was or was not used
+type SelectionDecision struct {
+	Stage          string   `json:"stage"`              // one of the SelectionStage constants
+	Selected       string   `json:"selected,omitempty"` // chosen skill or tool; empty when none was
+	Reason         string   `json:"reason,omitempty"`   // the model's reason
+	Candidates     []string `json:"candidates"`         // offered skills or tools, possibly cut
+	CandidateCount int      `json:"candidate_count"`    // number of offered skills or tools
+	Error          string   `json:"error,omitempty"`    // why the selection failed
+}
+
+// Bounded returns the decision with the reason, error and candidates cut to
+// the limits of a stored decision
+func (d SelectionDecision) Bounded() SelectionDecision {
+	d.Reason = truncate(d.Reason, MaxDecisionReasonLength)
+	d.Error = truncate(d.Error, maxDecisionErrorLength)
+	d.CandidateCount = max(d.CandidateCount, len(d.Candidates))
+	if len(d.Candidates) > MaxDecisionCandidates {
+		d.Candidates = d.Candidates[:MaxDecisionCandidates:MaxDecisionCandidates]
+	}
+	return d
+}
@@ -0,0 +1,159 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// TruncatedServerRestart marks an answer recovered from a draft after the
+// server stopped while streaming it
+const TruncatedServerRestart = "server_restart"
+
+// TruncatedClientDisconnect marks the partial answer of a response whose
+// client went away while it was streamed
+const TruncatedClientDisconnect = "client_disconnect"
+
+// Draft is the partial answer of a response that is still being streamed
+type Draft struct {
+	Content   string    `json:"content"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DraftStore is implemented by session stores that can persist drafts
+// separately from the session, so checkpoints do not rewrite all messages
+type DraftStore interface {
+	SaveDraft(sessionID string, draft *Draft) error
+	// LoadDraft returns nil without error when the session has no draft
+	LoadDraft(sessionID string) (*Draft, error)
+	DeleteDraft(sessionID string) error
+}
+
+// draftPath returns the draft file of a session. It deliberately does not
+// end in .json so it is never mistaken for a session file.
+func (s *FileSessionStore) draftPath(sessionID string) (string, error) {
+	return s.filePath(sessionID, ".draft")
+}
+
+// SaveDraft writes the draft of a session. The file is replaced atomically so
+// a crash during the write leaves the previous checkpoint intact.
+func (s *FileSessionStore) SaveDraft(sessionID string, draft *Draft) error {
+	path, err := s.draftPath(sessionID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(draft)
+	if err != nil {
+		return fmt.Errorf("failed to marshal draft: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write draft: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write draft: %w", err)
+	}
+	return nil
+}
+
+// LoadDraft reads the draft of a session
+func (s *FileSessionStore) LoadDraft(sessionID string) (*Draft, error) {
+	path, err := s.draftPath(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read draft: %w", err)
+	}
+
+	var draft Draft
+	if err := json.Unmarshal(data, &draft); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal draft: %w", err)
+	}
+	return &draft, nil
+}
+
+// DeleteDraft removes the draft of a session, if any
+func (s *FileSessionStore) DeleteDraft(sessionID string) error {
+	path, err := s.draftPath(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete draft: %w", err)
+	}
+	return nil
+}
+
+// SaveDraft checkpoints the partial answer being streamed into a session
+func (sm *SessionManager) SaveDraft(sessionID string, draft *Draft) error {
+	draftStore, ok := sm.store.(DraftStore)
+	if !ok {
+		return nil
+	}
+	return draftStore.SaveDraft(sessionID, draft)
+}
+
+// ClearDraft removes the checkpoint of a session once its answer is complete
+func (sm *SessionManager) ClearDraft(sessionID string) error {
+	draftStore, ok := sm.store.(DraftStore)
+	if !ok {
+		return nil
+	}
+	return draftStore.DeleteDraft(sessionID)
+}
+
+// recoverDraft promotes a draft left behind by a previous process to an
+// assistant message marked as truncated. It is called when a session is
+// loaded from the store, before any stream of this process can own a draft.
+func (sm *SessionManager) recoverDraft(session *Session) {
+	draftStore, ok := sm.store.(DraftStore)
+	if !ok {
+		return
+	}
+
+	draft, err := draftStore.LoadDraft(session.ID)
+	if err != nil {
+		log.Printf("Warning: Failed to load draft of session %s: %v", redact.LogID(session.ID), err)
+		return
+	}
+	if draft == nil {
+		return
+	}
+
+	if draft.Content != "" {
+		session.mu.Lock()
+		session.Messages = append(session.Messages, Message{
+			ID:        sm.ids.NewID(),
+			Seq:       session.nextSeq(),
+			Role:      "assistant",
+			Content:   draft.Content,
+			Timestamp: draft.UpdatedAt,
+			Truncated: TruncatedServerRestart,
+		})
+		session.UpdatedAt = sm.clock.Now()
+		sm.refreshPreview(session)
+		err := sm.save(session)
+		session.mu.Unlock()
+		if err != nil {
+			log.Printf("Warning: Failed to save recovered draft of session %s: %v", redact.LogID(session.ID), err)
+			return
+		}
+		log.Printf("Recovered partial answer of session %s (%d bytes)", redact.LogID(session.ID), len(draft.Content))
+	}
+
+	if err := draftStore.DeleteDraft(session.ID); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// exportTimeFormat is the format of timestamps in Markdown exports
+const exportTimeFormat = "2006-01-02 15:04:05 MST"
+
+// exportRoles are the headings of the turns of a Markdown export
+var exportRoles = map[string]string{
+	"user":      "用户",
+	"assistant": "助手",
+}
+
+// ExportMarkdown renders the conversation of a session as a Markdown
+// document: the title, then one section per message with its role and UTC
+// timestamp. Message content is kept as is, so the tool result <details>
+// blocks of answers stay collapsible. Synthetic messages are left out.
+func ExportMarkdown(session *Session) ([]byte, error) {
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+
+	title := session.Title
+	if title == "" {
+		title = Title(session.Messages)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", oneLine(title))
+	fmt.Fprintf(&b, "创建于 %s，更新于 %s\n", session.CreatedAt.UTC().Format(exportTimeFormat), session.UpdatedAt.UTC().Format(exportTimeFormat))
+	for _, msg := range session.Messages {
+		if msg.Synthetic {
+			continue
+		}
+		role, ok := exportRoles[msg.Role]
+		if !ok {
+			role = msg.Role
+		}
+		fmt.Fprintf(&b, "\n---\n\n## %s · %s\n\n", role, msg.Timestamp.UTC().Format(exportTimeFormat))
+		b.WriteString(strings.TrimSpace(msg.Content))
+		b.WriteString("\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// ExportJSON returns the messages of a session as a JSON array
+func ExportJSON(session *Session) ([]byte, error) {
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+
+	messages := session.Messages
+	if messages == nil {
+		messages = []Message{}
+	}
+	data, err := json.MarshalIndent(messages, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode messages: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// ExportFilename returns the download name of an export of a session with a
+// file extension: the title reduced to letters, digits and dashes, and the
+// day the session was last updated
+func ExportFilename(session *Session, ext string) string {
+	var name strings.Builder
+	dash := false
+	for _, r := range truncateRunes(session.DisplayTitle(), 40) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && name.Len() > 0 {
+				name.WriteByte('-')
+			}
+			name.WriteRune(unicode.ToLower(r))
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if name.Len() == 0 {
+		name.WriteString("session")
+	}
+
+	session.mu.RLock()
+	day := session.UpdatedAt.UTC().Format("2006-01-02")
+	session.mu.RUnlock()
+	return fmt.Sprintf("%s-%s.%s", name.String(), day, ext)
+}
+
+// truncateRunes returns the first n characters of text
+func truncateRunes(text string, n int) []rune {
+	runes := []rune(text)
+	return runes[:min(n, len(runes))]
+}
@@ -0,0 +1,23 @@
+package session
+
+import (
+	"errors"
+	"slices"
+)
+
+// Feedback values of a message; an empty value clears the feedback
+const (
+	FeedbackLike    = "like"
+	FeedbackDislike = "dislike"
+)
+
+// feedbackValues are the values Message.Feedback may take
+var feedbackValues = []string{"", FeedbackLike, FeedbackDislike}
+
+// ErrInvalidFeedback is returned for feedback values that are not allowed
+var ErrInvalidFeedback = errors.New("invalid feedback")
+
+// ValidFeedback reports whether a message may be given the feedback value
+func ValidFeedback(feedback string) bool {
+	return slices.Contains(feedbackValues, feedback)
+}
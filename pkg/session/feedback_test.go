@@ -0,0 +1,43 @@
+package session
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpdateMessageFeedback(t *testing.T) {
+	sm := newTestManager(t)
+	session := sm.CreateSession()
+	messageID, err := sm.AddMessage(session.ID, "assistant", "an answer")
+	if err != nil {
+		t.Fatalf("AddMessage: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		sessionID string
+		messageID string
+		feedback  string
+		wantErr   error
+		want      string
+	}{
+		{"like", session.ID, messageID, FeedbackLike, nil, FeedbackLike},
+		{"dislike", session.ID, messageID, FeedbackDislike, nil, FeedbackDislike},
+		{"invalid value", session.ID, messageID, "love", ErrInvalidFeedback, FeedbackDislike},
+		{"unknown message", session.ID, "missing", FeedbackLike, ErrMessageNotFound, FeedbackDislike},
+		{"unknown session", UUIDGenerator.NewID(), messageID, FeedbackLike, ErrSessionNotFound, FeedbackDislike},
+		{"clear", session.ID, messageID, "", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sm.UpdateMessageFeedback(tt.sessionID, tt.messageID, tt.feedback)
+			if tt.wantErr == nil && err != nil || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateMessageFeedback = %v, want %v", err, tt.wantErr)
+			}
+			message, err := sm.GetMessage(session.ID, messageID)
+			if err != nil || message.Feedback != tt.want {
+				t.Fatalf("feedback = %q, %v, want %q", message.Feedback, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// indexFile holds the per-user session metadata index. It deliberately does
+// not end in .json so it is never mistaken for a session file.
+const indexFile = "sessions.index"
+
+// ErrFolderNotFound is returned for operations on an unknown folder
+var ErrFolderNotFound = errors.New("folder not found")
+
+// Folder groups sessions of a user
+type Folder struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Index is the metadata index of a user's sessions
+type Index struct {
+	Folders     []Folder    `json:"folders"`
+	Preferences Preferences `json:"preferences"`
+	Memories    []Memory    `json:"memories,omitempty"`
+	// Secrets are the user's named secrets, sealed with the encryption key
+	Secrets map[string]string `json:"secrets,omitempty"`
+}
+
+// IndexStore is implemented by session stores that persist a metadata index
+type IndexStore interface {
+	LoadIndex() (*Index, error)
+	SaveIndex(index *Index) error
+}
+
+// LoadIndex reads the metadata index; a missing index is empty
+func (s *FileSessionStore) LoadIndex() (*Index, error) {
+	data, err := os.ReadFile(filepath.Join(s.sessionDir, indexFile))
+	if os.IsNotExist(err) {
+		return &Index{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session index: %w", err)
+	}
+
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session index: %w", err)
+	}
+	return &index, nil
+}
+
+// SaveIndex writes the metadata index
+func (s *FileSessionStore) SaveIndex(index *Index) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.sessionDir, indexFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write session index: %w", err)
+	}
+	return nil
+}
+
+// loadIndex loads the metadata index from the store, if it keeps one
+func (sm *SessionManager) loadIndex() {
+	sm.index = &Index{}
+	indexStore, ok := sm.store.(IndexStore)
+	if !ok {
+		return
+	}
+	index, err := indexStore.LoadIndex()
+	if err != nil {
+		return
+	}
+	sm.index = index
+}
+
+// saveIndex persists the metadata index. The caller must hold sm.mu.
+func (sm *SessionManager) saveIndex() error {
+	if indexStore, ok := sm.store.(IndexStore); ok {
+		return indexStore.SaveIndex(sm.index)
+	}
+	return nil
+}
+
+// findFolder returns the index of a folder. The caller must hold sm.mu.
+func (sm *SessionManager) findFolder(id string) int {
+	for i, folder := range sm.index.Folders {
+		if folder.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// ListFolders returns the user's folders
+func (sm *SessionManager) ListFolders() []Folder {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	folders := make([]Folder, len(sm.index.Folders))
+	copy(folders, sm.index.Folders)
+	return folders
+}
+
+// CreateFolder creates a new folder
+func (sm *SessionManager) CreateFolder(name string) (*Folder, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("folder name is required")
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	now := sm.clock.Now()
+	folder := Folder{ID: sm.ids.NewID(), Name: name, CreatedAt: now, UpdatedAt: now}
+	sm.index.Folders = append(sm.index.Folders, folder)
+
+	if err := sm.saveIndex(); err != nil {
+		sm.index.Folders = sm.index.Folders[:len(sm.index.Folders)-1]
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// RenameFolder changes the name of a folder
+func (sm *SessionManager) RenameFolder(id, name string) (*Folder, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("folder name is required")
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	i := sm.findFolder(id)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrFolderNotFound, id)
+	}
+
+	previous := sm.index.Folders[i]
+	sm.index.Folders[i].Name = name
+	sm.index.Folders[i].UpdatedAt = sm.clock.Now()
+	if err := sm.saveIndex(); err != nil {
+		sm.index.Folders[i] = previous
+		return nil, err
+	}
+
+	folder := sm.index.Folders[i]
+	return &folder, nil
+}
+
+// DeleteFolder removes a folder and moves its sessions to the root.
+// It returns the IDs of the moved sessions.
+func (sm *SessionManager) DeleteFolder(id string) ([]string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	i := sm.findFolder(id)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrFolderNotFound, id)
+	}
+
+	// Sessions are moved, never deleted with their folder
+	var moved []string
+	for _, session := range sm.sessions {
+		session.mu.Lock()
+		if session.FolderID == id {
+			session.FolderID = ""
+			if err := sm.save(session); err != nil {
+				session.mu.Unlock()
+				return moved, fmt.Errorf("failed to move session %s to root: %w", session.ID, err)
+			}
+			moved = append(moved, session.ID)
+		}
+		session.mu.Unlock()
+	}
+
+	sm.index.Folders = append(sm.index.Folders[:i], sm.index.Folders[i+1:]...)
+	if err := sm.saveIndex(); err != nil {
+		return moved, err
+	}
+	return moved, nil
+}
+
+// SetSessionFolder moves a session into a folder; an empty folderID moves it to the root
+func (sm *SessionManager) SetSessionFolder(sessionID, folderID string) error {
+	if folderID != "" {
+		sm.mu.RLock()
+		exists := sm.findFolder(folderID) >= 0
+		sm.mu.RUnlock()
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrFolderNotFound, folderID)
+		}
+	}
+
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.FolderID = folderID
+	session.UpdatedAt = sm.clock.Now()
+	return sm.save(session)
+}
@@ -0,0 +1,110 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// forkTitlePrefix starts the title of a forked session
+const forkTitlePrefix = "Fork of "
+
+// ErrEmptyFork is returned when forking a session without messages
+var ErrEmptyFork = errors.New("no messages to fork")
+
+// ForkSession copies a session up to and including the message with the ID
+// messageID, or all of it for an empty messageID, into a new session titled
+// after the source. The copy shares nothing with the source: its messages
+// get new IDs, and later changes to either session leave the other as it
+// is. The folder, tags, persona and variables are copied; the archived state
+// and any draft are not.
+func (sm *SessionManager) ForkSession(sessionID, messageID string) (*Session, error) {
+	src, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	src.mu.RLock()
+	end := len(src.Messages)
+	if messageID != "" {
+		end = slices.IndexFunc(src.Messages, func(m Message) bool { return m.ID == messageID }) + 1
+		if end == 0 {
+			src.mu.RUnlock()
+			return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+		}
+	}
+	if end == 0 {
+		src.mu.RUnlock()
+		return nil, ErrEmptyFork
+	}
+	title := src.Title
+	if title == "" {
+		title = sm.previewTitle(src.Messages)
+	}
+	now := sm.clock.Now()
+	session := &Session{
+		ID:         sm.ids.NewID(),
+		Title:      truncate(forkTitlePrefix+title, MaxTitleLength-len("...")),
+		FolderID:   src.FolderID,
+		Tags:       slices.Clone(src.Tags),
+		Persona:    src.Persona,
+		Variables:  maps.Clone(src.Variables),
+		Messages:   make([]Message, 0, end),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		modifiedAt: now,
+	}
+	for _, msg := range src.Messages[:end] {
+		msg = msg.clone()
+		msg.ID = sm.ids.NewID()
+		msg.Seq = 0
+		session.Messages = append(session.Messages, msg)
+	}
+	src.mu.RUnlock()
+	assignSeqs(session)
+	sm.refreshPreview(session)
+
+	// Not marked stored until a save succeeded: with write-behind the save
+	// is only queued, and CheckStored would take the fork for deleted
+	sm.mu.Lock()
+	sm.sessions[session.ID] = session
+	sm.mu.Unlock()
+	sm.touchList(now)
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	// The fork is kept in memory and retried if saving fails
+	if err := sm.save(session); err != nil {
+		return session, fmt.Errorf("failed to save session: %w", err)
+	}
+	return session, nil
+}
+
+// clone returns a copy of the message that shares no memory with it
+func (m Message) clone() Message {
+	if m.ContentHints != nil {
+		hints := *m.ContentHints
+		hints.CodeLanguages = slices.Clone(hints.CodeLanguages)
+		m.ContentHints = &hints
+	}
+	if m.Settings != nil {
+		settings := *m.Settings
+		if settings.Temperature != nil {
+			temperature := *settings.Temperature
+			settings.Temperature = &temperature
+		}
+		m.Settings = &settings
+	}
+	if m.Usage != nil {
+		usage := *m.Usage
+		m.Usage = &usage
+	}
+	m.ToolCalls = slices.Clone(m.ToolCalls)
+	m.Decisions = slices.Clone(m.Decisions)
+	for i := range m.Decisions {
+		m.Decisions[i].Candidates = slices.Clone(m.Decisions[i].Candidates)
+	}
+	m.Suggestions = slices.Clone(m.Suggestions)
+	return m
+}
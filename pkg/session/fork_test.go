@@ -0,0 +1,34 @@
+package session
+
+import (
+	"testing"
+)
+
+func TestForkSessionQueuedSave(t *testing.T) {
+	sm := newTestManager(t)
+	src := sm.CreateSession()
+	addMessages(t, sm, src.ID, "hello", "hi there")
+
+	pauseWriteBehind(sm)
+	fork, err := sm.ForkSession(src.ID, "")
+	if err != nil {
+		t.Fatalf("ForkSession: %v", err)
+	}
+
+	// The save of the fork waits in the queue, so the store has no file yet
+	if err := sm.CheckStored(fork.ID); err != nil {
+		t.Fatalf("CheckStored of a fork waiting to be saved: %v", err)
+	}
+	if _, err := sm.GetSession(fork.ID); err != nil {
+		t.Fatalf("GetSession of a fork waiting to be saved: %v", err)
+	}
+	assertPersisted(t, sm, fork.ID)
+
+	messages, err := sm.GetMessages(fork.ID)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(messages) != 2 || messages[0].Content != "hello" || messages[1].Content != "hi there" {
+		t.Fatalf("fork messages = %+v", messages)
+	}
+}
@@ -0,0 +1,46 @@
+package session
+
+import "fmt"
+
+// StartSession records the persona a new session was created with and adds
+// the greeting, if any, as a synthetic assistant message. It returns the
+// greeting message, or nil without a greeting.
+func (sm *SessionManager) StartSession(sessionID, persona, greeting string) (*Message, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	now := sm.clock.Now()
+	session.Persona = persona
+	session.UpdatedAt = now
+
+	var message *Message
+	if greeting != "" {
+		message = &Message{
+			ID:        sm.ids.NewID(),
+			Seq:       session.nextSeq(),
+			Role:      "assistant",
+			Content:   greeting,
+			Timestamp: now,
+			Synthetic: true,
+		}
+		session.Messages = append(session.Messages, *message)
+		sm.addToPreview(session, *message)
+	}
+
+	if err := sm.save(session); err != nil {
+		return message, fmt.Errorf("failed to save session: %w", err)
+	}
+	return message, nil
+}
+
+// GetPersona returns the persona a session was created with
+func (s *Session) GetPersona() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Persona
+}
@@ -0,0 +1,40 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidID is returned for a session ID that cannot name a session file
+var ErrInvalidID = errors.New("invalid session ID")
+
+// ValidID reports whether id has the canonical form of the IDs generated by
+// UUIDGenerator. Handlers check the session IDs of clients with it, so an ID
+// can never reach a session file or agent it was not issued for.
+func ValidID(id string) bool {
+	return len(id) == 36 && uuid.Validate(id) == nil
+}
+
+// filePath returns the file of a session with suffix. IDs containing path
+// separators or parent references are refused, and the cleaned absolute path
+// must still be a file directly in the session directory, so a file outside
+// it can never be read, written or removed.
+func (s *FileSessionStore) filePath(id, suffix string) (string, error) {
+	if id == "" || id == "." || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidID, id)
+	}
+
+	dir, err := filepath.Abs(s.sessionDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve session directory: %w", err)
+	}
+	path := filepath.Join(dir, id+suffix)
+	if filepath.Dir(path) != dir {
+		return "", fmt.Errorf("%w: %q", ErrInvalidID, id)
+	}
+	return path, nil
+}
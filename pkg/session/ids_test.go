@@ -0,0 +1,106 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"7d444840-9dc0-11d1-b245-5ffdce74fad2", true},
+		{UUIDGenerator.NewID(), true},
+		{"__warmup__", false},
+		{"../../x", false},
+		{"", false},
+		{"{7d444840-9dc0-11d1-b245-5ffdce74fad2}", false},
+		{"urn:uuid:7d444840-9dc0-11d1-b245-5ffdce74fad2", false},
+		{"7d4448409dc011d1b2455ffdce74fad2", false},
+	}
+	for _, tt := range tests {
+		if got := ValidID(tt.id); got != tt.want {
+			t.Errorf("ValidID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestFileSessionStoreRefusesPathIDs(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "sessions")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	// A file a traversing ID would name
+	outside := filepath.Join(root, "x.json")
+	if err := os.WriteFile(outside, []byte(`{"id":"x"}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	store := NewFileSessionStore(dir)
+
+	for _, id := range []string{"../x", "../../x", "a/b", `a\b`, "..", ".", ""} {
+		t.Run(id, func(t *testing.T) {
+			operations := map[string]error{
+				"Save":        store.Save(&Session{ID: id}),
+				"Delete":      store.Delete(id),
+				"SaveDraft":   store.SaveDraft(id, &Draft{Content: "partial"}),
+				"DeleteDraft": store.DeleteDraft(id),
+			}
+			_, operations["Load"] = store.Load(id)
+			_, operations["Exists"] = store.Exists(id)
+			_, operations["LoadDraft"] = store.LoadDraft(id)
+			for name, err := range operations {
+				if !errors.Is(err, ErrInvalidID) {
+					t.Errorf("%s(%q) = %v, want ErrInvalidID", name, id, err)
+				}
+			}
+		})
+	}
+
+	if data, err := os.ReadFile(outside); err != nil || string(data) != `{"id":"x"}` {
+		t.Fatalf("file outside the session directory = %q, %v, want it untouched", data, err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	for _, entry := range entries {
+		if name := entry.Name(); name != "sessions" && name != "x.json" && !strings.HasPrefix(name, ".") {
+			t.Errorf("unexpected file %s outside the session directory", name)
+		}
+	}
+}
+
+func TestFileSessionStorePathsStayInDirectory(t *testing.T) {
+	// A relative session directory resolves against the working directory
+	t.Chdir(t.TempDir())
+	store := NewFileSessionStore("sessions")
+	dir, err := filepath.Abs("sessions")
+	if err != nil {
+		t.Fatalf("Abs: %v", err)
+	}
+
+	const id = "7d444840-9dc0-11d1-b245-5ffdce74fad2"
+	path, err := store.filePath(id, ".json")
+	if err != nil || path != filepath.Join(dir, id+".json") {
+		t.Fatalf("filePath(%q) = %q, %v, want %q", id, path, err, filepath.Join(dir, id+".json"))
+	}
+	if err := store.Save(&Session{ID: id, Messages: []Message{{Role: "user", Content: "hi"}}}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("saved session file: %v", err)
+	}
+	if _, err := store.Load(id); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// A suffix cannot move the file out of the directory either
+	if _, err := store.filePath(id, "/../../x"); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("filePath with a traversing suffix = %v, want ErrInvalidID", err)
+	}
+}
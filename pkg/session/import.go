@@ -0,0 +1,155 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// importClockSkew is how far in the future imported timestamps may be, for
+// exports of instances whose clocks run slightly ahead
+const importClockSkew = 5 * time.Minute
+
+// ErrInvalidImport is returned for import payloads that are not sessions or
+// whose sessions are not valid
+var ErrInvalidImport = errors.New("invalid session import")
+
+// ParseImport decodes an import payload: a session, an array of sessions, or
+// the message array of a JSON export, which becomes a single session
+func ParseImport(data []byte) ([]*Session, error) {
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0:
+		return nil, fmt.Errorf("%w: the payload is empty", ErrInvalidImport)
+	case data[0] == '{':
+		var session Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+		}
+		return []*Session{&session}, nil
+	case data[0] != '[':
+		return nil, fmt.Errorf("%w: expected a session, an array of sessions or an array of messages", ErrInvalidImport)
+	}
+
+	var elements []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	if len(elements) == 0 {
+		return nil, fmt.Errorf("%w: the array is empty", ErrInvalidImport)
+	}
+	if _, ok := elements[0]["role"]; ok {
+		var messages []Message
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+		}
+		return []*Session{{Messages: messages}}, nil
+	}
+	var sessions []*Session
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	return sessions, nil
+}
+
+// ImportSessions adds sessions of another instance or a backup as new
+// sessions and returns their IDs, in order. Sessions and messages get new
+// IDs, so an import never collides with existing sessions, and the folders
+// of the other instance are dropped. Every session is validated before any
+// is added: it needs messages, each with the role user or assistant and a
+// timestamp that is set and not in the future. Only the newest messages up
+// to the history limit are kept.
+func (sm *SessionManager) ImportSessions(sessions []*Session) ([]string, error) {
+	now := sm.clock.Now()
+	imported := make([]*Session, 0, len(sessions))
+	for i, src := range sessions {
+		session, err := sm.importSession(src, now)
+		if err != nil {
+			return nil, fmt.Errorf("%w: session %d: %w", ErrInvalidImport, i+1, err)
+		}
+		imported = append(imported, session)
+	}
+
+	ids := make([]string, 0, len(imported))
+	var saveErrs []error
+	for _, session := range imported {
+		// Marked stored only once a save succeeded, as with write-behind the
+		// save is only queued and CheckStored would take the session for deleted
+		session.modifiedAt = now
+		sm.refreshPreview(session)
+		sm.mu.Lock()
+		sm.sessions[session.ID] = session
+		sm.mu.Unlock()
+
+		session.mu.Lock()
+		if err := sm.save(session); err != nil {
+			saveErrs = append(saveErrs, err)
+		}
+		session.mu.Unlock()
+		ids = append(ids, session.ID)
+	}
+	sm.touchList(now)
+	return ids, errors.Join(saveErrs...)
+}
+
+// importSession returns a validated copy of an imported session with new IDs
+func (sm *SessionManager) importSession(src *Session, now time.Time) (*Session, error) {
+	if src == nil || len(src.Messages) == 0 {
+		return nil, errors.New("no messages")
+	}
+	title, err := NormalizeTitle(src.Title)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateVariables(src.Variables); err != nil {
+		return nil, err
+	}
+
+	latest := now.Add(importClockSkew)
+	messages := src.Messages
+	if sm.maxHistory > 0 && len(messages) > sm.maxHistory {
+		messages = messages[len(messages)-sm.maxHistory:]
+	}
+	session := &Session{
+		ID:        sm.ids.NewID(),
+		Title:     title,
+		Tags:      NormalizeTags(src.Tags, MaxTags),
+		Archived:  src.Archived,
+		Persona:   src.Persona,
+		Variables: src.Variables,
+		Messages:  make([]Message, 0, len(messages)),
+		CreatedAt: src.CreatedAt,
+		UpdatedAt: src.UpdatedAt,
+	}
+	for i, msg := range messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return nil, fmt.Errorf("message %d: invalid role %q, expected user or assistant", i+1, msg.Role)
+		}
+		if msg.Timestamp.IsZero() || msg.Timestamp.After(latest) {
+			return nil, fmt.Errorf("message %d: timestamp must be set and not in the future", i+1)
+		}
+		msg.ID = sm.ids.NewID()
+		msg.Seq = 0
+		session.Messages = append(session.Messages, msg)
+	}
+	assignSeqs(session)
+
+	// Timestamps of the session default to those of its messages
+	first, last := session.Messages[0].Timestamp, session.Messages[len(session.Messages)-1].Timestamp
+	if session.CreatedAt.IsZero() || session.CreatedAt.After(first) {
+		session.CreatedAt = first
+	}
+	if session.UpdatedAt.Before(last) || session.UpdatedAt.After(latest) {
+		session.UpdatedAt = last
+	}
+	if session.Archived {
+		archivedAt := now
+		if src.ArchivedAt != nil && !src.ArchivedAt.After(latest) {
+			archivedAt = *src.ArchivedAt
+		}
+		session.ArchivedAt = &archivedAt
+	}
+	return session, nil
+}
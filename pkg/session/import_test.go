@@ -0,0 +1,66 @@
+package session
+
+import (
+	"testing"
+)
+
+func TestImportSessionsQueuedSave(t *testing.T) {
+	sm := newTestManager(t)
+	pauseWriteBehind(sm)
+
+	sessions, err := ParseImport([]byte(`[
+		{"role": "user", "content": "hello", "timestamp": "2024-01-02T03:04:05Z"},
+		{"role": "assistant", "content": "hi there", "timestamp": "2024-01-02T03:04:06Z"}
+	]`))
+	if err != nil {
+		t.Fatalf("ParseImport: %v", err)
+	}
+	ids, err := sm.ImportSessions(sessions)
+	if err != nil {
+		t.Fatalf("ImportSessions: %v", err)
+	}
+	if len(ids) != 1 {
+		t.Fatalf("imported %d sessions, want 1", len(ids))
+	}
+
+	// The save of the session waits in the queue, so the store has no file yet
+	if err := sm.CheckStored(ids[0]); err != nil {
+		t.Fatalf("CheckStored of an import waiting to be saved: %v", err)
+	}
+	if _, err := sm.AddMessage(ids[0], "user", "and now?"); err != nil {
+		t.Fatalf("AddMessage to an import waiting to be saved: %v", err)
+	}
+	assertPersisted(t, sm, ids[0])
+
+	messages, err := sm.GetMessages(ids[0])
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("imported session has %d messages, want 3", len(messages))
+	}
+}
+
+func TestImportSessionsValidation(t *testing.T) {
+	sm := newTestManager(t)
+	for name, payload := range map[string]string{
+		"empty":        ``,
+		"no messages":  `{"messages": []}`,
+		"system role":  `[{"role": "system", "content": "x", "timestamp": "2024-01-02T03:04:05Z"}]`,
+		"no timestamp": `[{"role": "user", "content": "x"}]`,
+		"future":       `[{"role": "user", "content": "x", "timestamp": "2999-01-01T00:00:00Z"}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			sessions, err := ParseImport([]byte(payload))
+			if err == nil {
+				_, err = sm.ImportSessions(sessions)
+			}
+			if err == nil {
+				t.Fatal("import succeeded, want an error")
+			}
+		})
+	}
+	if n := len(sm.ListSessions()); n != 0 {
+		t.Fatalf("%d sessions after failed imports, want 0", n)
+	}
+}
@@ -0,0 +1,124 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits of user memories
+const (
+	MaxMemories     = 100
+	MaxMemoryLength = 300
+)
+
+// Sources of memories
+const (
+	MemorySourceUser = "user"      // added by the user
+	MemorySourceChat = "extracted" // proposed by the LLM from a conversation
+)
+
+var (
+	// ErrMemoryNotFound is returned for operations on an unknown memory
+	ErrMemoryNotFound = errors.New("memory not found")
+	// ErrInvalidMemory is returned for empty, too long or too many memories
+	ErrInvalidMemory = errors.New("invalid memory")
+)
+
+// Memory is a durable fact about a user carried across sessions
+type Memory struct {
+	ID        string    `json:"id"`
+	Content   string    `json:"content"`
+	Source    string    `json:"source"`               // MemorySourceUser or MemorySourceChat
+	SessionID string    `json:"session_id,omitempty"` // session an extracted memory comes from
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListMemories returns the user's memories, oldest first
+func (sm *SessionManager) ListMemories() []Memory {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	memories := make([]Memory, len(sm.index.Memories))
+	copy(memories, sm.index.Memories)
+	return memories
+}
+
+// AddMemory stores a memory of the user. A memory repeating an existing one
+// is not stored again; the existing one is returned instead.
+func (sm *SessionManager) AddMemory(content, source, sessionID string) (*Memory, error) {
+	content = strings.Join(strings.Fields(content), " ")
+	if content == "" {
+		return nil, fmt.Errorf("%w: content is required", ErrInvalidMemory)
+	}
+	if len([]rune(content)) > MaxMemoryLength {
+		return nil, fmt.Errorf("%w: content is longer than %d characters", ErrInvalidMemory, MaxMemoryLength)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for _, memory := range sm.index.Memories {
+		if strings.EqualFold(memory.Content, content) {
+			return &memory, nil
+		}
+	}
+	if len(sm.index.Memories) >= MaxMemories {
+		return nil, fmt.Errorf("%w: at most %d memories are kept; delete some first", ErrInvalidMemory, MaxMemories)
+	}
+
+	memory := Memory{ID: sm.ids.NewID(), Content: content, Source: source, SessionID: sessionID, CreatedAt: sm.clock.Now()}
+	sm.index.Memories = append(sm.index.Memories, memory)
+	if err := sm.saveIndex(); err != nil {
+		sm.index.Memories = sm.index.Memories[:len(sm.index.Memories)-1]
+		return nil, err
+	}
+	return &memory, nil
+}
+
+// DeleteMemory removes a memory of the user
+func (sm *SessionManager) DeleteMemory(id string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	i := slices.IndexFunc(sm.index.Memories, func(memory Memory) bool { return memory.ID == id })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrMemoryNotFound, id)
+	}
+
+	previous := slices.Clone(sm.index.Memories)
+	sm.index.Memories = slices.Delete(sm.index.Memories, i, i+1)
+	if err := sm.saveIndex(); err != nil {
+		sm.index.Memories = previous
+		return err
+	}
+	return nil
+}
+
+// MemoryPrompt returns the newest of the user's memories that fit in
+// maxChars characters as a compact list, or "" without memories. The list
+// is oldest first, so a new memory extends the prompt rather than changing
+// its start, which keeps the cached prompt prefix of providers valid.
+func (sm *SessionManager) MemoryPrompt(maxChars int) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	first := len(sm.index.Memories)
+	var length int
+	for first > 0 {
+		line := "- " + sm.index.Memories[first-1].Content + "\n"
+		if length += utf8.RuneCountInString(line); length > maxChars {
+			break
+		}
+		first--
+	}
+
+	var b strings.Builder
+	for _, memory := range sm.index.Memories[first:] {
+		b.WriteString("- " + memory.Content + "\n")
+	}
+	return b.String()
+}
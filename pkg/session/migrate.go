@@ -0,0 +1,285 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// SessionIDLister is implemented by stores that can enumerate session IDs
+// without loading every session into memory.
+type SessionIDLister interface {
+	ListIDs() ([]string, error)
+}
+
+// OpenStore opens a session store of the given type at the given location
+func OpenStore(storeType, location string) (SessionStore, error) {
+	return NewStore(configpkg.DatabaseConfig{Type: storeType}, configpkg.CacheConfig{}, location)
+}
+
+// MigrateOptions controls a session migration
+type MigrateOptions struct {
+	// StatePath records migrated session IDs so an interrupted migration can resume.
+	// Empty disables resume tracking.
+	StatePath string
+	// DeleteSource removes sessions from the source store after a successful verify.
+	DeleteSource bool
+	// DryRun reports what would be migrated without writing anything.
+	DryRun bool
+}
+
+// MigrateReport summarizes the result of a migration
+type MigrateReport struct {
+	Total    int      `json:"total"`
+	Migrated int      `json:"migrated"`
+	Skipped  int      `json:"skipped"` // already migrated in a previous run
+	Failed   []string `json:"failed,omitempty"`
+	Verified int      `json:"verified"`
+	Deleted  int      `json:"deleted"`
+}
+
+// Migrate copies every session from src to dst, preserving IDs, timestamps and
+// feedback. Sessions are loaded one at a time so large stores are streamed.
+func Migrate(src, dst SessionStore, opts MigrateOptions) (*MigrateReport, error) {
+	ids, err := listSessionIDs(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source sessions: %w", err)
+	}
+
+	done, err := loadMigrationState(opts.StatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var state *os.File
+	if opts.StatePath != "" && !opts.DryRun {
+		state, err = os.OpenFile(opts.StatePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open migration state: %w", err)
+		}
+		defer state.Close()
+	}
+
+	report := &MigrateReport{Total: len(ids)}
+	migrated := make([]string, 0, len(ids))
+
+	for _, id := range ids {
+		if done[id] {
+			report.Skipped++
+			migrated = append(migrated, id)
+			continue
+		}
+
+		session, err := src.Load(id)
+		if err != nil {
+			log.Printf("Migration: failed to load session %s: %v", redact.LogID(id), err)
+			report.Failed = append(report.Failed, id)
+			continue
+		}
+
+		if opts.DryRun {
+			report.Migrated++
+			continue
+		}
+
+		if err := dst.Save(session); err != nil {
+			log.Printf("Migration: failed to save session %s: %v", redact.LogID(id), err)
+			report.Failed = append(report.Failed, id)
+			continue
+		}
+
+		if state != nil {
+			if _, err := fmt.Fprintln(state, id); err != nil {
+				return report, fmt.Errorf("failed to record migration state: %w", err)
+			}
+		}
+		report.Migrated++
+		migrated = append(migrated, id)
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	// Verify every migrated session can be read back with the same content
+	for _, id := range migrated {
+		if err := verifyMigrated(src, dst, id); err != nil {
+			log.Printf("Migration: verification failed for session %s: %v", redact.LogID(id), err)
+			report.Failed = append(report.Failed, id)
+			continue
+		}
+		report.Verified++
+	}
+
+	if len(report.Failed) > 0 {
+		return report, fmt.Errorf("migration incomplete: %d of %d sessions failed", len(report.Failed), report.Total)
+	}
+
+	if opts.DeleteSource {
+		for _, id := range migrated {
+			if err := src.Delete(id); err != nil {
+				log.Printf("Migration: failed to delete source session %s: %v", redact.LogID(id), err)
+				continue
+			}
+			report.Deleted++
+		}
+		if opts.StatePath != "" {
+			os.Remove(opts.StatePath)
+		}
+	}
+
+	return report, nil
+}
+
+// MigrateTree migrates the root session namespace and every per-user
+// namespace (users/<id>) from one store location to another. Progress is
+// tracked per namespace in a state file next to the source sessions, so an
+// interrupted run picks up where it stopped.
+func MigrateTree(fromType, fromDir, toType, toDir string, opts MigrateOptions) (*MigrateReport, error) {
+	fromAbs, _ := filepath.Abs(fromDir)
+	toAbs, _ := filepath.Abs(toDir)
+	if strings.EqualFold(fromType, toType) && fromAbs == toAbs {
+		return nil, fmt.Errorf("source and destination are the same store")
+	}
+
+	namespaces := []string{""}
+	entries, err := os.ReadDir(filepath.Join(fromDir, "users"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read user namespaces: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			namespaces = append(namespaces, filepath.Join("users", entry.Name()))
+		}
+	}
+
+	total := &MigrateReport{}
+	for _, ns := range namespaces {
+		src, err := OpenStore(fromType, filepath.Join(fromDir, ns))
+		if err != nil {
+			return total, err
+		}
+		dst, err := OpenStore(toType, filepath.Join(toDir, ns))
+		if err != nil {
+			return total, err
+		}
+
+		nsOpts := opts
+		nsOpts.StatePath = filepath.Join(fromDir, ns, fmt.Sprintf(".migrate-%s.state", strings.ToLower(toType)))
+
+		report, err := Migrate(src, dst, nsOpts)
+		if report != nil {
+			total.Total += report.Total
+			total.Migrated += report.Migrated
+			total.Skipped += report.Skipped
+			total.Verified += report.Verified
+			total.Deleted += report.Deleted
+			for _, id := range report.Failed {
+				total.Failed = append(total.Failed, filepath.Join(ns, id))
+			}
+		}
+		if err != nil {
+			log.Printf("Migration: namespace %q: %v", ns, err)
+		}
+
+		// Carry over folders and other session metadata
+		if !opts.DryRun {
+			if err := migrateIndex(src, dst); err != nil {
+				log.Printf("Migration: namespace %q: failed to migrate session index: %v", ns, err)
+			}
+		}
+	}
+
+	if len(total.Failed) > 0 {
+		return total, fmt.Errorf("migration incomplete: %d of %d sessions failed", len(total.Failed), total.Total)
+	}
+	return total, nil
+}
+
+// migrateIndex copies the metadata index, with folders, preferences,
+// memories and secrets, between stores that keep one
+func migrateIndex(src, dst SessionStore) error {
+	srcIndex, ok := src.(IndexStore)
+	if !ok {
+		return nil
+	}
+	dstIndex, ok := dst.(IndexStore)
+	if !ok {
+		return nil
+	}
+	index, err := srcIndex.LoadIndex()
+	if err != nil {
+		return err
+	}
+	if len(index.Folders) == 0 && len(index.Memories) == 0 && len(index.Secrets) == 0 && index.Preferences == (Preferences{}) {
+		return nil
+	}
+	return dstIndex.SaveIndex(index)
+}
+
+// listSessionIDs enumerates the IDs of all sessions in a store
+func listSessionIDs(store SessionStore) ([]string, error) {
+	if lister, ok := store.(SessionIDLister); ok {
+		return lister.ListIDs()
+	}
+
+	sessions, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+	}
+	return ids, nil
+}
+
+// verifyMigrated checks that a session exists in dst with the same messages
+func verifyMigrated(src, dst SessionStore, id string) error {
+	migrated, err := dst.Load(id)
+	if err != nil {
+		return err
+	}
+
+	original, err := src.Load(id)
+	if err != nil {
+		// Source may already have been deleted by a previous run
+		return nil
+	}
+
+	if len(original.Messages) != len(migrated.Messages) {
+		return fmt.Errorf("message count mismatch: source %d, destination %d", len(original.Messages), len(migrated.Messages))
+	}
+	return nil
+}
+
+// loadMigrationState reads the IDs recorded by a previous migration run
+func loadMigrationState(path string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	if path == "" {
+		return done, nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration state: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			done[id] = true
+		}
+	}
+	return done, scanner.Err()
+}
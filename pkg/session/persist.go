@@ -0,0 +1,171 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// ErrNotPersisted is returned when a change was applied in memory but could
+// not be saved, e.g. because the disk is full or read-only. The session is
+// retried in the background until the store accepts it again.
+var ErrNotPersisted = errors.New("session changes are kept in memory but could not be saved")
+
+// Backoff between background save retries of unsaved sessions
+const (
+	saveRetryInitial = time.Second
+	saveRetryMax     = 30 * time.Second
+)
+
+// SetSaveFailureHook sets a function called with the error of every failed
+// save, including background retries, e.g. to count them
+func (sm *SessionManager) SetSaveFailureHook(hook func(err error)) {
+	sm.unsavedMu.Lock()
+	defer sm.unsavedMu.Unlock()
+	sm.onSaveFailure = hook
+}
+
+// SaveError returns the last save error of a session, or nil when everything
+// applied to it is persisted
+func (sm *SessionManager) SaveError(sessionID string) error {
+	sm.unsavedMu.Lock()
+	defer sm.unsavedMu.Unlock()
+	return sm.unsaved[sessionID]
+}
+
+// savePending reports whether changes of a session wait in the write-behind
+// queue or for a retry of a failed save, so the store may lag behind them
+func (sm *SessionManager) savePending(sessionID string) bool {
+	if sm.queue != nil && sm.queue.has(sessionID) {
+		return true
+	}
+	return sm.SaveError(sessionID) != nil
+}
+
+// PersistenceError returns an error describing the sessions waiting to be
+// saved, or nil when all sessions are persisted
+func (sm *SessionManager) PersistenceError() error {
+	sm.unsavedMu.Lock()
+	defer sm.unsavedMu.Unlock()
+
+	for _, err := range sm.unsaved {
+		return fmt.Errorf("%d sessions not saved: %w", len(sm.unsaved), err)
+	}
+	return nil
+}
+
+// save saves a session, or queues the save when write-behind is enabled, and
+// keeps track of failures; the caller must hold session.mu. A failed session
+// is retried in the background.
+func (sm *SessionManager) save(session *Session) error {
+	sm.touch(session)
+	if sm.queue != nil && sm.queue.enqueue(session.ID) {
+		return nil
+	}
+
+	err := sm.store.Save(session)
+	sm.recordSave(session.ID, err)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotPersisted, err)
+	}
+	session.stored = len(session.Messages) > 0
+	return nil
+}
+
+// recordSave records the outcome of a save and starts the retry loop when a
+// session is left unsaved
+func (sm *SessionManager) recordSave(sessionID string, err error) {
+	sm.unsavedMu.Lock()
+	defer sm.unsavedMu.Unlock()
+
+	if err == nil {
+		delete(sm.unsaved, sessionID)
+		return
+	}
+
+	if sm.unsaved == nil {
+		sm.unsaved = make(map[string]error)
+	}
+	sm.unsaved[sessionID] = err
+	if sm.onSaveFailure != nil {
+		sm.onSaveFailure(err)
+	}
+	if !sm.retrying && !sm.retryStopped() {
+		sm.retrying = true
+		log.Printf("Warning: Failed to save session %s, retrying in the background: %v", redact.LogID(sessionID), err)
+		go sm.retryUnsaved()
+	}
+}
+
+// retryStopped reports whether Close ended the retries
+func (sm *SessionManager) retryStopped() bool {
+	select {
+	case <-sm.retryStop:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryUnsaved saves the unsaved sessions with exponential backoff until all
+// of them are persisted or the manager is closed
+func (sm *SessionManager) retryUnsaved() {
+	backoff := saveRetryInitial
+	for {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-sm.retryStop:
+			timer.Stop()
+			sm.unsavedMu.Lock()
+			sm.retrying = false
+			sm.unsavedMu.Unlock()
+			return
+		}
+
+		sm.unsavedMu.Lock()
+		ids := make([]string, 0, len(sm.unsaved))
+		for id := range sm.unsaved {
+			ids = append(ids, id)
+		}
+		sm.unsavedMu.Unlock()
+
+		for _, id := range ids {
+			sm.saveLatest(id)
+		}
+
+		sm.unsavedMu.Lock()
+		if len(sm.unsaved) == 0 {
+			sm.retrying = false
+			sm.unsavedMu.Unlock()
+			log.Printf("All unsaved sessions are persisted again")
+			return
+		}
+		sm.unsavedMu.Unlock()
+		backoff = min(backoff*2, saveRetryMax)
+	}
+}
+
+// saveLatest saves the current state of a session in the background. The
+// manager lock is held so a session deleted meanwhile is not written back.
+func (sm *SessionManager) saveLatest(sessionID string) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[sessionID]
+	if !ok {
+		sm.recordSave(sessionID, nil)
+		return
+	}
+
+	session.mu.Lock()
+	err := sm.store.Save(session)
+	if err == nil {
+		session.stored = len(session.Messages) > 0
+	}
+	session.mu.Unlock()
+	sm.recordSave(sessionID, err)
+}
@@ -0,0 +1,131 @@
+package session
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyManager returns a session manager whose store fails saves while failing is set
+func newFlakyManager(t *testing.T) (*SessionManager, *flakyStore) {
+	t.Helper()
+	store := &flakyStore{FileSessionStore: NewFileSessionStore(t.TempDir())}
+	sm := NewSessionManager(store, 0)
+	t.Cleanup(func() { _ = sm.Close() })
+	return sm, store
+}
+
+func TestFailedSaveKeepsMessageInMemory(t *testing.T) {
+	sm, store := newFlakyManager(t)
+	var failures atomic.Int32
+	sm.SetSaveFailureHook(func(err error) {
+		if errors.Is(err, errDiskFull) {
+			failures.Add(1)
+		}
+	})
+	session := sm.CreateSession()
+	store.failing.Store(true)
+
+	id, err := sm.AddMessage(session.ID, "user", "kept in memory")
+	if !errors.Is(err, ErrNotPersisted) || !errors.Is(err, errDiskFull) {
+		t.Fatalf("AddMessage = %v, want ErrNotPersisted wrapping the store error", err)
+	}
+	if id == "" {
+		t.Fatal("AddMessage returned no message ID for the kept message")
+	}
+	if msg, err := sm.GetMessage(session.ID, id); err != nil || msg.Content != "kept in memory" {
+		t.Fatalf("GetMessage = %+v, %v", msg, err)
+	}
+	if !errors.Is(sm.SaveError(session.ID), errDiskFull) {
+		t.Fatalf("SaveError = %v, want the store error", sm.SaveError(session.ID))
+	}
+	if err := sm.PersistenceError(); !errors.Is(err, errDiskFull) {
+		t.Fatalf("PersistenceError = %v, want the store error", err)
+	}
+	if failures.Load() != 1 {
+		t.Fatalf("save failure hook called %d times, want 1", failures.Load())
+	}
+	if exists, _ := store.Exists(session.ID); exists {
+		t.Fatal("session was written by a failing store")
+	}
+}
+
+func TestFailedSaveIsRetried(t *testing.T) {
+	sm, store := newFlakyManager(t)
+	session := sm.CreateSession()
+	store.failing.Store(true)
+	if _, err := sm.AddMessage(session.ID, "user", "first"); err == nil {
+		t.Fatal("AddMessage succeeded with a full disk")
+	}
+	// Changes made while the store fails are retried with the rest
+	if _, err := sm.AddMessage(session.ID, "assistant", "second"); err == nil {
+		t.Fatal("AddMessage succeeded with a full disk")
+	}
+
+	store.failing.Store(false)
+	deadline := time.Now().Add(3 * saveRetryInitial)
+	for sm.SaveError(session.ID) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("unsaved session was not retried once the store recovered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := sm.PersistenceError(); err != nil {
+		t.Fatalf("PersistenceError = %v once saved", err)
+	}
+
+	loaded, err := store.Load(session.ID)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := contents(loaded.Messages); len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Fatalf("stored messages = %v, want both", got)
+	}
+}
+
+func TestCloseStopsRetriesAndReportsUnsaved(t *testing.T) {
+	sm, store := newFlakyManager(t)
+	session := sm.CreateSession()
+	store.failing.Store(true)
+	if _, err := sm.AddMessage(session.ID, "user", "lost on close"); err == nil {
+		t.Fatal("AddMessage succeeded with a full disk")
+	}
+
+	if err := sm.Close(); !errors.Is(err, errDiskFull) {
+		t.Fatalf("Close = %v, want the unsaved sessions reported", err)
+	}
+	// A successful save after Close clears the error without a retry loop
+	store.failing.Store(false)
+	if _, err := sm.AddMessage(session.ID, "assistant", "saved"); err != nil {
+		t.Fatalf("AddMessage after Close: %v", err)
+	}
+	if err := sm.Close(); err != nil {
+		t.Fatalf("second Close = %v", err)
+	}
+}
+
+func TestDeletedUnsavedSessionIsNotRetried(t *testing.T) {
+	sm, store := newFlakyManager(t)
+	session := sm.CreateSession()
+	store.failing.Store(true)
+	if _, err := sm.AddMessage(session.ID, "user", "deleted"); err == nil {
+		t.Fatal("AddMessage succeeded with a full disk")
+	}
+	// The store never held the session
+	if err := sm.DeleteSession(session.ID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+
+	store.failing.Store(false)
+	deadline := time.Now().Add(3 * saveRetryInitial)
+	for sm.SaveError(session.ID) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("retry did not drop the deleted session")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if exists, _ := store.Exists(session.ID); exists {
+		t.Fatal("retry wrote a deleted session back")
+	}
+}
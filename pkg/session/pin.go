@@ -0,0 +1,27 @@
+package session
+
+// SetSessionPinned pins or unpins a session. Pinned sessions are listed
+// before the others. The change leaves UpdatedAt as it is, so an unpinned
+// session returns to its place in the list.
+func (sm *SessionManager) SetSessionPinned(sessionID string, pinned bool) error {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.Pinned == pinned {
+		return nil
+	}
+	session.Pinned = pinned
+	return sm.save(session)
+}
+
+// IsPinned reports whether a session is pinned
+func (s *Session) IsPinned() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Pinned
+}
@@ -0,0 +1,110 @@
+package session
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+// listIDs returns the IDs of a page of the session list
+func listIDs(sm *SessionManager, offset, limit int) []string {
+	sessions, _ := sm.ListSessionsPage(offset, limit, nil)
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	return ids
+}
+
+func TestPinnedSessionsListedFirst(t *testing.T) {
+	sm := newTestManager(t)
+	sm.SetClock(newStepClock())
+
+	// Created oldest first, so the list starts with c
+	var a, b, c string
+	for _, id := range []*string{&a, &b, &c} {
+		session := sm.CreateSession()
+		addMessages(t, sm, session.ID, "hello")
+		*id = session.ID
+	}
+	if got, want := listIDs(sm, 0, 0), []string{c, b, a}; !slices.Equal(got, want) {
+		t.Fatalf("list = %v, want %v", got, want)
+	}
+
+	updatedAt := sm.sessions[a].Summary().UpdatedAt
+	if err := sm.SetSessionPinned(a, true); err != nil {
+		t.Fatalf("SetSessionPinned: %v", err)
+	}
+	if got := sm.sessions[a].Summary().UpdatedAt; !got.Equal(updatedAt) {
+		t.Fatalf("pinning changed UpdatedAt from %v to %v", updatedAt, got)
+	}
+	if got, want := listIDs(sm, 0, 0), []string{a, c, b}; !slices.Equal(got, want) {
+		t.Fatalf("list with a pinned = %v, want %v", got, want)
+	}
+	if got, want := listIDs(sm, 1, 1), []string{c}; !slices.Equal(got, want) {
+		t.Fatalf("second page = %v, want %v", got, want)
+	}
+
+	// Pinned sessions are ordered among themselves by UpdatedAt too
+	if err := sm.SetSessionPinned(b, true); err != nil {
+		t.Fatalf("SetSessionPinned: %v", err)
+	}
+	if got, want := listIDs(sm, 0, 0), []string{b, a, c}; !slices.Equal(got, want) {
+		t.Fatalf("list with a and b pinned = %v, want %v", got, want)
+	}
+
+	if err := sm.SetSessionPinned(a, false); err != nil {
+		t.Fatalf("SetSessionPinned: %v", err)
+	}
+	if err := sm.SetSessionPinned(b, false); err != nil {
+		t.Fatalf("SetSessionPinned: %v", err)
+	}
+	if got, want := listIDs(sm, 0, 0), []string{c, b, a}; !slices.Equal(got, want) {
+		t.Fatalf("list after unpinning = %v, want %v", got, want)
+	}
+}
+
+func TestPinnedSurvivesReload(t *testing.T) {
+	dir := t.TempDir()
+	sm := NewSessionManager(NewFileSessionStore(dir), 0)
+	session := sm.CreateSession()
+	addMessages(t, sm, session.ID, "hello")
+	if err := sm.SetSessionPinned(session.ID, true); err != nil {
+		t.Fatalf("SetSessionPinned: %v", err)
+	}
+
+	reloaded := NewSessionManager(NewFileSessionStore(dir), 0)
+	loaded, err := reloaded.GetSession(session.ID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if !loaded.IsPinned() {
+		t.Fatal("pin lost on reload")
+	}
+}
+
+func TestSummaryDuringChanges(t *testing.T) {
+	sm := newTestManager(t)
+	session := sm.CreateSession()
+	addMessages(t, sm, session.ID, "hello")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 100 {
+			_ = sm.SetSessionPinned(session.ID, i%2 == 0)
+			_, _ = sm.AddTag(session.ID, "topic")
+			_, _ = sm.RemoveTag(session.ID, "topic")
+		}
+	}()
+	for range 100 {
+		sessions, _ := sm.ListSessionsPage(0, 0, func(s *Session) bool { return !s.Summary().Archived })
+		for _, s := range sessions {
+			if summary := s.Summary(); summary.ID != session.ID || len(summary.Tags) > 1 {
+				t.Fatalf("summary = %+v", summary)
+			}
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,29 @@
+package session
+
+// Preferences are per-user settings stored with the session index
+type Preferences struct {
+	// DatasetOptOut excludes the user's conversations from the evaluation dataset
+	DatasetOptOut bool `json:"dataset_opt_out"`
+}
+
+// Preferences returns the user's preferences
+func (sm *SessionManager) Preferences() Preferences {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.index.Preferences
+}
+
+// SetPreferences replaces the user's preferences
+func (sm *SessionManager) SetPreferences(preferences Preferences) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	previous := sm.index.Preferences
+	sm.index.Preferences = preferences
+	if err := sm.saveIndex(); err != nil {
+		sm.index.Preferences = previous
+		return err
+	}
+	return nil
+}
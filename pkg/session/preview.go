@@ -0,0 +1,165 @@
+package session
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// Lengths in characters of the title and snippets of a preview
+const (
+	titleLength   = 20
+	snippetLength = 80
+)
+
+// DefaultTitle is the title of a session without user messages
+const DefaultTitle = "新会话"
+
+// Preview summarizes a session for the session list. It is kept up to date
+// as messages are added, so listing sessions never reads their messages.
+type Preview struct {
+	Title         string // title set by the user, or the start of the first user message
+	LastAssistant string // first line of the last assistant message
+	LastActivity  string // first line of the last message of either role
+	MessageCount  int
+}
+
+// Preview returns the list summary of the session, titled with the title
+// set by the user, if any
+func (s *Session) Preview() Preview {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p := s.preview
+	if s.Title != "" {
+		p.Title = s.Title
+	}
+	return p
+}
+
+// Summary is a snapshot of the fields of a session shown in the session
+// list, read at once under the session lock, so fields changed meanwhile
+// never mix. It shares no memory with the session.
+type Summary struct {
+	ID         string
+	FolderID   string
+	Tags       []string
+	Archived   bool
+	ArchivedAt *time.Time
+	Pinned     bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Preview    Preview
+}
+
+// Summary returns a snapshot of the list fields of the session
+func (s *Session) Summary() Summary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	summary := Summary{
+		ID:        s.ID,
+		FolderID:  s.FolderID,
+		Tags:      slices.Clone(s.Tags),
+		Archived:  s.Archived,
+		Pinned:    s.Pinned,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+		Preview:   s.preview,
+	}
+	if s.ArchivedAt != nil {
+		archivedAt := *s.ArchivedAt
+		summary.ArchivedAt = &archivedAt
+	}
+	if s.Title != "" {
+		summary.Preview.Title = s.Title
+	}
+	return summary
+}
+
+// Title returns the title of a conversation: the start of its first user message
+func Title(messages []Message) string {
+	for _, msg := range messages {
+		if msg.Role == "user" {
+			return truncate(msg.Content, titleLength)
+		}
+	}
+	return DefaultTitle
+}
+
+// snippet returns the first non-empty line of text, truncated and redacted
+func snippet(text string, redactor *redact.Redactor) string {
+	text = strings.TrimSpace(text)
+	if line, _, ok := strings.Cut(text, "\n"); ok {
+		text = strings.TrimSpace(line)
+	}
+	// Redact before truncating, so a cut cannot hide a match from the rules
+	return truncate(redactor.Redact(text), snippetLength)
+}
+
+// truncate shortens text to n characters, marking the cut with "..."
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) > n {
+		return string(runes[:n]) + "..."
+	}
+	return text
+}
+
+// addToPreview updates the preview of a session with an appended message.
+// The caller must hold session.mu.
+func (sm *SessionManager) addToPreview(session *Session, msg Message) {
+	p := &session.preview
+	// The title changes with the first user message, or when the history
+	// limit dropped the message it came from
+	if p.Title == "" || p.Title == DefaultTitle || len(session.Messages) <= p.MessageCount {
+		p.Title = sm.previewTitle(session.Messages)
+	}
+	p.MessageCount = len(session.Messages)
+	p.LastActivity = snippet(msg.Content, sm.previewRedactor)
+	if msg.Role == "assistant" {
+		p.LastAssistant = p.LastActivity
+	}
+}
+
+// refreshPreview rebuilds the preview of a session from its messages, after
+// changes other than appending a message. The caller must hold session.mu.
+func (sm *SessionManager) refreshPreview(session *Session) {
+	p := Preview{Title: sm.previewTitle(session.Messages), MessageCount: len(session.Messages)}
+	if n := len(session.Messages); n > 0 {
+		p.LastActivity = snippet(session.Messages[n-1].Content, sm.previewRedactor)
+	}
+	for i := len(session.Messages) - 1; i >= 0; i-- {
+		if session.Messages[i].Role == "assistant" {
+			p.LastAssistant = snippet(session.Messages[i].Content, sm.previewRedactor)
+			break
+		}
+	}
+	session.preview = p
+}
+
+// previewTitle returns the title of a conversation, redacted before it is
+// cut to length
+func (sm *SessionManager) previewTitle(messages []Message) string {
+	for _, msg := range messages {
+		if msg.Role == "user" {
+			return truncate(sm.previewRedactor.Redact(msg.Content), titleLength)
+		}
+	}
+	return DefaultTitle
+}
+
+// SetPreviewRedactor sets the redactor applied to the titles and snippets
+// of previews, nil for none, and rebuilds the previews of loaded sessions
+func (sm *SessionManager) SetPreviewRedactor(redactor *redact.Redactor) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.previewRedactor = redactor
+	for _, session := range sm.sessions {
+		session.mu.Lock()
+		sm.refreshPreview(session)
+		session.mu.Unlock()
+	}
+}
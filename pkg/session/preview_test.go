@@ -0,0 +1,85 @@
+package session
+
+import (
+	"testing"
+)
+
+// The preview kept up as messages are added matches the one rebuilt from
+// the messages, also once the history limit drops the first ones
+func TestPreviewFollowsMessages(t *testing.T) {
+	sm := NewSessionManager(NewFileSessionStore(t.TempDir()), 4)
+	session := sm.CreateSession()
+	if p := session.Preview(); p != (Preview{}) {
+		t.Fatalf("preview of a new session = %+v", p)
+	}
+	for i, content := range []string{
+		"How do I sort a slice in Go?",
+		"Use slices.Sort.\nIt sorts in place.",
+		"And in reverse?",
+		"Use slices.SortFunc with a reversed comparison.",
+		"Thanks, what about maps?",
+		"Collect the keys first.",
+	} {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		if _, err := sm.AddMessage(session.ID, role, content); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+		got := session.Preview()
+		session.mu.Lock()
+		sm.refreshPreview(session)
+		session.mu.Unlock()
+		if want := session.Preview(); got != want {
+			t.Fatalf("preview after %d messages = %+v, want %+v", i+1, got, want)
+		}
+	}
+	p := session.Preview()
+	if p.Title != "And in reverse?" || p.LastAssistant != "Collect the keys first." || p.MessageCount != 4 {
+		t.Fatalf("preview = %+v, want the title of the first kept question", p)
+	}
+}
+
+// listFixture returns a manager holding sessions sessions of messages
+// messages each, as loaded at startup
+func listFixture(b *testing.B, sessions, messages int) *SessionManager {
+	b.Helper()
+	sm := NewSessionManager(NewFileSessionStore(b.TempDir()), 0)
+	for range sessions {
+		session := longSession(UUIDGenerator.NewID(), messages)
+		sm.cached(session)
+		sm.sessions[session.ID] = session
+	}
+	return sm
+}
+
+// BenchmarkListSessions lists 1,000 sessions of 100 messages as
+// HandleListSessions does, with the previews kept up to date as messages are
+// added, and with them recomputed from the messages on every list as before
+func BenchmarkListSessions(b *testing.B) {
+	sm := listFixture(b, 1000, 100)
+	keep := func(session *Session) bool { return !session.Summary().Archived }
+
+	b.Run("incremental", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			page, _ := sm.ListSessionsPage(0, 0, keep)
+			for _, session := range page {
+				_ = session.Summary()
+			}
+		}
+	})
+	b.Run("recomputed", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			page, _ := sm.ListSessionsPage(0, 0, keep)
+			for _, session := range page {
+				session.mu.Lock()
+				sm.refreshPreview(session)
+				session.mu.Unlock()
+				_ = session.Summary()
+			}
+		}
+	})
+}
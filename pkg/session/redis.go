@@ -0,0 +1,376 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimeout bounds every operation of a RedisSessionStore; the
+// SessionStore interface has no context
+const redisTimeout = 5 * time.Second
+
+// redisListBatch is the number of sessions List fetches per round trip
+const redisListBatch = 100
+
+// RedisSessionStore implements SessionStore on Redis, so the replicas of a
+// deployment share their sessions. Each session is a JSON value; the IDs of a
+// namespace are kept in a set, so sessions are listed without scanning keys.
+// A counter next to each session is its revision, see RevisionStore. Drafts
+// and the metadata index are stored next to the sessions.
+type RedisSessionStore struct {
+	client *redis.Client
+	prefix string        // key prefix of the namespace, ending in ':'
+	ttl    time.Duration // expiry of a session after its last save; 0 keeps sessions forever
+}
+
+// redisClients are shared by the stores of all namespaces, one per URL
+var (
+	redisClientsMu sync.Mutex
+	redisClients   = make(map[string]*redis.Client)
+)
+
+// redisClient returns the client of url, connecting on first use
+func redisClient(url string) (*redis.Client, error) {
+	redisClientsMu.Lock()
+	defer redisClientsMu.Unlock()
+
+	if client, ok := redisClients[url]; ok {
+		return client, nil
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	redisClients[url] = client
+	return client, nil
+}
+
+// NewRedisSessionStore returns the store of the sessions of namespace in the
+// Redis server at url. Sessions expire ttl after their last save; 0 keeps
+// them until they are deleted.
+func NewRedisSessionStore(url, namespace string, ttl time.Duration) (*RedisSessionStore, error) {
+	if url == "" {
+		return nil, errors.New("redis session store requires a Redis URL")
+	}
+	client, err := redisClient(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisSessionStore{
+		client: client,
+		prefix: "langchat:" + filepath.ToSlash(filepath.Clean(namespace)) + ":",
+		ttl:    ttl,
+	}, nil
+}
+
+func (s *RedisSessionStore) sessionKey(id string) string { return s.prefix + "session:" + id }
+func (s *RedisSessionStore) draftKey(id string) string   { return s.prefix + "draft:" + id }
+func (s *RedisSessionStore) revKey(id string) string     { return s.prefix + "rev:" + id }
+func (s *RedisSessionStore) idsKey() string              { return s.prefix + "ids" }
+func (s *RedisSessionStore) indexKey() string            { return s.prefix + "index" }
+
+func (s *RedisSessionStore) Exists(id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := s.client.Exists(ctx, s.sessionKey(id)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (s *RedisSessionStore) Save(session *Session) error {
+	// Like files, only sessions that have messages are stored
+	if len(session.Messages) == 0 {
+		session.revision = 0
+		return s.Delete(session.ID)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	var revision *redis.IntCmd
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.sessionKey(session.ID), data, s.ttl)
+		pipe.SAdd(ctx, s.idsKey(), session.ID)
+		revision = pipe.Incr(ctx, s.revKey(session.ID))
+		if s.ttl > 0 {
+			pipe.Expire(ctx, s.revKey(session.ID), s.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	session.revision = revision.Val()
+	return nil
+}
+
+func (s *RedisSessionStore) Load(id string) (*Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	// Read together, so the revision is the one of the session read
+	var get, rev *redis.StringCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, s.sessionKey(id))
+		rev = pipe.Get(ctx, s.revKey(id))
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	data, err := get.Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Expired sessions leave their ID behind
+		s.client.SRem(ctx, s.idsKey(), id)
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	session, err := s.decode(ctx, id, data)
+	if err != nil {
+		return nil, err
+	}
+	if session.revision, err = rev.Int64(); err != nil {
+		session.revision = s.initRevision(ctx, id)
+	}
+	return session, nil
+}
+
+// initRevision gives a session saved before revisions were kept its first one
+func (s *RedisSessionStore) initRevision(ctx context.Context, id string) int64 {
+	s.client.SetNX(ctx, s.revKey(id), 1, s.ttl)
+	revision, _ := s.client.Get(ctx, s.revKey(id)).Int64()
+	return revision
+}
+
+// Revisions returns the revisions of sessions, 0 for those not stored
+func (s *RedisSessionStore) Revisions(ids []string) ([]int64, error) {
+	revisions := make([]int64, len(ids))
+	for start := 0; start < len(ids); start += redisListBatch {
+		batch := ids[start:min(start+redisListBatch, len(ids))]
+		keys := make([]string, len(batch))
+		for i, id := range batch {
+			keys[i] = s.revKey(id)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		values, err := s.client.MGet(ctx, keys...).Result()
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read session revisions: %w", err)
+		}
+		for i, value := range values {
+			if v, ok := value.(string); ok {
+				revisions[start+i], _ = strconv.ParseInt(v, 10, 64)
+			}
+		}
+	}
+	return revisions, nil
+}
+
+// decode unmarshals a stored session. A value that does not decode is moved
+// aside to the corrupt key of the session, see ErrCorruptSession.
+func (s *RedisSessionStore) decode(ctx context.Context, id string, data []byte) (*Session, error) {
+	var session Session
+	err := json.Unmarshal(data, &session)
+	if err == nil {
+		return &session, nil
+	}
+
+	corrupt := s.prefix + "corrupt:" + id
+	_, moveErr := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Rename(ctx, s.sessionKey(id), corrupt)
+		pipe.Del(ctx, s.revKey(id))
+		pipe.SRem(ctx, s.idsKey(), id)
+		return nil
+	})
+	if moveErr != nil {
+		return nil, fmt.Errorf("%w: %s: %v (failed to move it aside: %v)", ErrCorruptSession, id, err, moveErr)
+	}
+	return nil, fmt.Errorf("%w: %s: %v (moved to %s)", ErrCorruptSession, id, err, corrupt)
+}
+
+func (s *RedisSessionStore) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.sessionKey(id), s.draftKey(id), s.revKey(id))
+		pipe.SRem(ctx, s.idsKey(), id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// ListIDs returns the IDs of the sessions of the namespace from its ID set,
+// without loading them. IDs of expired sessions are pruned by Load and List.
+func (s *RedisSessionStore) ListIDs() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	ids, err := s.client.SMembers(ctx, s.idsKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return ids, nil
+}
+
+// List loads the sessions of the ID set, a batch of sessions per round trip
+func (s *RedisSessionStore) List() ([]*Session, error) {
+	ids, err := s.ListIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	for start := 0; start < len(ids); start += redisListBatch {
+		batch := ids[start:min(start+redisListBatch, len(ids))]
+		keys := make([]string, len(batch))
+		revKeys := make([]string, len(batch))
+		for i, id := range batch {
+			keys[i] = s.sessionKey(id)
+			revKeys[i] = s.revKey(id)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		var get, rev *redis.SliceCmd
+		_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			get = pipe.MGet(ctx, keys...)
+			rev = pipe.MGet(ctx, revKeys...)
+			return nil
+		})
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to load sessions: %w", err)
+		}
+		values, revisions := get.Val(), rev.Val()
+		var expired []any
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				expired = append(expired, batch[i])
+				continue
+			}
+			session, err := s.decode(ctx, batch[i], []byte(data))
+			if err != nil {
+				log.Printf("Warning: %v", err)
+				continue
+			}
+			if v, ok := revisions[i].(string); ok {
+				session.revision, _ = strconv.ParseInt(v, 10, 64)
+			} else {
+				session.revision = s.initRevision(ctx, batch[i])
+			}
+			if len(session.Messages) > 0 {
+				sessions = append(sessions, session)
+			}
+		}
+		if len(expired) > 0 {
+			s.client.SRem(ctx, s.idsKey(), expired...)
+		}
+		cancel()
+	}
+	return sessions, nil
+}
+
+// SaveDraft stores the draft of a session, expiring with the session
+func (s *RedisSessionStore) SaveDraft(sessionID string, draft *Draft) error {
+	data, err := json.Marshal(draft)
+	if err != nil {
+		return fmt.Errorf("failed to marshal draft: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := s.client.Set(ctx, s.draftKey(sessionID), data, s.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to write draft: %w", err)
+	}
+	return nil
+}
+
+// LoadDraft reads the draft of a session
+func (s *RedisSessionStore) LoadDraft(sessionID string) (*Draft, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	data, err := s.client.Get(ctx, s.draftKey(sessionID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read draft: %w", err)
+	}
+
+	var draft Draft
+	if err := json.Unmarshal(data, &draft); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal draft: %w", err)
+	}
+	return &draft, nil
+}
+
+// DeleteDraft removes the draft of a session, if any
+func (s *RedisSessionStore) DeleteDraft(sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := s.client.Del(ctx, s.draftKey(sessionID)).Err(); err != nil {
+		return fmt.Errorf("failed to delete draft: %w", err)
+	}
+	return nil
+}
+
+// LoadIndex reads the metadata index; a missing index is empty. The index
+// holds folders, preferences and secrets, so it never expires.
+func (s *RedisSessionStore) LoadIndex() (*Index, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	data, err := s.client.Get(ctx, s.indexKey()).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return &Index{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session index: %w", err)
+	}
+
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session index: %w", err)
+	}
+	return &index, nil
+}
+
+// SaveIndex writes the metadata index
+func (s *RedisSessionStore) SaveIndex(index *Index) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session index: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := s.client.Set(ctx, s.indexKey(), data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to write session index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package session
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newRedisStore returns a store of namespace in a fresh miniredis server
+func newRedisStore(t *testing.T, namespace string, ttl time.Duration) (*RedisSessionStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	store, err := NewRedisSessionStore("redis://"+mr.Addr(), namespace, ttl)
+	if err != nil {
+		t.Fatalf("NewRedisSessionStore: %v", err)
+	}
+	return store, mr
+}
+
+// testSession returns a session with one message per content
+func testSession(id string, contents ...string) *Session {
+	session := &Session{ID: id, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	for _, content := range contents {
+		session.Messages = append(session.Messages, Message{ID: content, Role: "user", Content: content, Timestamp: time.Now()})
+	}
+	return session
+}
+
+// contents returns the contents of messages
+func contents(messages []Message) []string {
+	var result []string
+	for _, msg := range messages {
+		result = append(result, msg.Content)
+	}
+	return result
+}
+
+func TestRedisStoreRoundTrip(t *testing.T) {
+	store, _ := newRedisStore(t, "users/alice", 0)
+
+	if err := store.Save(testSession("s1", "hello", "world")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if exists, err := store.Exists("s1"); err != nil || !exists {
+		t.Fatalf("Exists = %v, %v", exists, err)
+	}
+	loaded, err := store.Load("s1")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := contents(loaded.Messages); !slices.Equal(got, []string{"hello", "world"}) {
+		t.Fatalf("loaded messages = %v", got)
+	}
+	if loaded.revision != 1 {
+		t.Fatalf("revision = %d, want 1", loaded.revision)
+	}
+
+	// Sessions without messages are not stored
+	if err := store.Save(testSession("empty")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	ids, err := store.ListIDs()
+	if err != nil || !slices.Equal(ids, []string{"s1"}) {
+		t.Fatalf("ListIDs = %v, %v", ids, err)
+	}
+	sessions, err := store.List()
+	if err != nil || len(sessions) != 1 || sessions[0].ID != "s1" {
+		t.Fatalf("List = %v, %v", sessions, err)
+	}
+
+	if err := store.Delete("s1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Load("s1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Load after Delete = %v, want ErrSessionNotFound", err)
+	}
+	if revisions, err := store.Revisions([]string{"s1"}); err != nil || revisions[0] != 0 {
+		t.Fatalf("Revisions after Delete = %v, %v", revisions, err)
+	}
+}
+
+func TestRedisStoreNamespaces(t *testing.T) {
+	mr := miniredis.RunT(t)
+	alice, err := NewRedisSessionStore("redis://"+mr.Addr(), "users/alice", 0)
+	if err != nil {
+		t.Fatalf("NewRedisSessionStore: %v", err)
+	}
+	bob, err := NewRedisSessionStore("redis://"+mr.Addr(), "users/bob", 0)
+	if err != nil {
+		t.Fatalf("NewRedisSessionStore: %v", err)
+	}
+
+	if err := alice.Save(testSession("s1", "hello")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if exists, _ := bob.Exists("s1"); exists {
+		t.Fatal("session of alice visible to bob")
+	}
+	if ids, _ := bob.ListIDs(); len(ids) != 0 {
+		t.Fatalf("bob lists %v", ids)
+	}
+}
+
+func TestRedisStoreTTL(t *testing.T) {
+	store, mr := newRedisStore(t, "users/alice", time.Hour)
+	if err := store.Save(testSession("s1", "hello")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	mr.FastForward(30 * time.Minute)
+	if err := store.Save(testSession("s1", "hello", "again")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	mr.FastForward(45 * time.Minute)
+	if exists, _ := store.Exists("s1"); !exists {
+		t.Fatal("session expired although it was saved within the TTL")
+	}
+
+	mr.FastForward(2 * time.Hour)
+	sessions, err := store.List()
+	if err != nil || len(sessions) != 0 {
+		t.Fatalf("List after expiry = %v, %v", sessions, err)
+	}
+	if ids, _ := store.ListIDs(); len(ids) != 0 {
+		t.Fatalf("ID of an expired session kept: %v", ids)
+	}
+}
+
+func TestRedisStoreCorruptSession(t *testing.T) {
+	store, mr := newRedisStore(t, "users/alice", 0)
+	if err := store.Save(testSession("s1", "hello")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	mr.Set(store.sessionKey("s1"), "{not json")
+
+	if _, err := store.Load("s1"); !errors.Is(err, ErrCorruptSession) {
+		t.Fatalf("Load = %v, want ErrCorruptSession", err)
+	}
+	if !mr.Exists(store.prefix + "corrupt:s1") {
+		t.Fatal("corrupt session not moved aside")
+	}
+	if exists, _ := store.Exists("s1"); exists {
+		t.Fatal("corrupt session still counts as stored")
+	}
+}
+
+func TestRedisStoreDraftsAndIndex(t *testing.T) {
+	store, _ := newRedisStore(t, "users/alice", 0)
+
+	if draft, err := store.LoadDraft("s1"); err != nil || draft != nil {
+		t.Fatalf("LoadDraft of no draft = %v, %v", draft, err)
+	}
+	if err := store.SaveDraft("s1", &Draft{Content: "partial"}); err != nil {
+		t.Fatalf("SaveDraft: %v", err)
+	}
+	if draft, err := store.LoadDraft("s1"); err != nil || draft.Content != "partial" {
+		t.Fatalf("LoadDraft = %v, %v", draft, err)
+	}
+	if err := store.DeleteDraft("s1"); err != nil {
+		t.Fatalf("DeleteDraft: %v", err)
+	}
+
+	index := &Index{Folders: []Folder{{ID: "f1", Name: "Work"}}}
+	if err := store.SaveIndex(index); err != nil {
+		t.Fatalf("SaveIndex: %v", err)
+	}
+	loaded, err := store.LoadIndex()
+	if err != nil || len(loaded.Folders) != 1 || loaded.Folders[0].Name != "Work" {
+		t.Fatalf("LoadIndex = %+v, %v", loaded, err)
+	}
+}
+
+func TestRedisStoreSessionWithoutRevision(t *testing.T) {
+	store, mr := newRedisStore(t, "users/alice", 0)
+	if err := store.Save(testSession("s1", "hello")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// As saved before revisions were kept
+	mr.Del(store.revKey("s1"))
+
+	sessions, err := store.List()
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("List = %v, %v", sessions, err)
+	}
+	if sessions[0].revision == 0 {
+		t.Fatal("session without a revision not given one")
+	}
+}
+
+func TestRedisSessionManager(t *testing.T) {
+	store, _ := newRedisStore(t, "users/alice", 0)
+	sm := NewSessionManager(store, 0)
+	session := sm.CreateSession()
+	addMessages(t, sm, session.ID, "hello", "hi there")
+
+	// A restarted replica loads the sessions from Redis
+	restarted := NewSessionManager(store, 0)
+	messages, err := restarted.GetMessages(session.ID)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if got := contents(messages); !slices.Equal(got, []string{"hello", "hi there"}) {
+		t.Fatalf("messages after restart = %v", got)
+	}
+	if sessions, total := restarted.ListSessionsPage(0, 10, nil); total != 1 || sessions[0].ID != session.ID {
+		t.Fatalf("ListSessionsPage = %v, %d", sessions, total)
+	}
+}
+
+func TestRedisReplicasShareSessions(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replica := func() *SessionManager {
+		store, err := NewRedisSessionStore("redis://"+mr.Addr(), "users/alice", 0)
+		if err != nil {
+			t.Fatalf("NewRedisSessionStore: %v", err)
+		}
+		return NewSessionManager(store, 0)
+	}
+	a, b := replica(), replica()
+
+	session := a.CreateSession()
+	addMessages(t, a, session.ID, "hello")
+
+	// b lists the session a created after b started
+	if sessions := b.ListSessions(); len(sessions) != 1 || sessions[0].ID != session.ID {
+		t.Fatalf("b lists %v", sessions)
+	}
+
+	// Changes of either replica build on those of the other
+	if _, err := b.AddMessage(session.ID, "assistant", "from b"); err != nil {
+		t.Fatalf("AddMessage on b: %v", err)
+	}
+	if _, err := a.AddMessage(session.ID, "user", "from a"); err != nil {
+		t.Fatalf("AddMessage on a: %v", err)
+	}
+	for name, sm := range map[string]*SessionManager{"a": a, "b": b} {
+		messages, err := sm.GetMessages(session.ID)
+		if err != nil {
+			t.Fatalf("GetMessages on %s: %v", name, err)
+		}
+		if got, want := contents(messages), []string{"hello", "from b", "from a"}; !slices.Equal(got, want) {
+			t.Fatalf("messages on %s = %v, want %v", name, got, want)
+		}
+	}
+
+	// The list of a shows a change made on b
+	if _, err := b.SetSessionTags(session.ID, []string{"shared"}); err != nil {
+		t.Fatalf("SetSessionTags on b: %v", err)
+	}
+	sessions, _ := a.ListSessionsPage(0, 0, nil)
+	if len(sessions) != 1 || !slices.Equal(sessions[0].Summary().Tags, []string{"shared"}) {
+		t.Fatalf("a lists %v", sessions)
+	}
+
+	// A session deleted on b is gone on a
+	if err := b.DeleteSession(session.ID); err != nil {
+		t.Fatalf("DeleteSession on b: %v", err)
+	}
+	if _, err := a.GetSession(session.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("GetSession on a after delete on b = %v, want ErrSessionNotFound", err)
+	}
+	if sessions := a.ListSessions(); len(sessions) != 0 {
+		t.Fatalf("a still lists %v", sessions)
+	}
+}
+
+func TestRedisReplicaKeepsQueuedChanges(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewRedisSessionStore("redis://"+mr.Addr(), "users/alice", 0)
+	if err != nil {
+		t.Fatalf("NewRedisSessionStore: %v", err)
+	}
+	a, b := NewSessionManager(store, 0), NewSessionManager(store, 0)
+	session := a.CreateSession()
+	addMessages(t, a, session.ID, "hello")
+	if _, err := b.GetSession(session.ID); err != nil {
+		t.Fatalf("GetSession on b: %v", err)
+	}
+
+	// a change of a waiting in its queue is not replaced by the stored session
+	pauseWriteBehind(a)
+	addMessages(t, a, session.ID, "queued")
+	if _, err := b.AddMessage(session.ID, "assistant", "from b"); err != nil {
+		t.Fatalf("AddMessage on b: %v", err)
+	}
+	messages, err := a.GetMessages(session.ID)
+	if err != nil {
+		t.Fatalf("GetMessages on a: %v", err)
+	}
+	if got := contents(messages); !slices.Contains(got, "queued") {
+		t.Fatalf("queued change lost: %v", got)
+	}
+}
@@ -0,0 +1,62 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"time"
+)
+
+// StaleSessions returns the IDs of the sessions last updated before cutoff,
+// sorted
+func (sm *SessionManager) StaleSessions(cutoff time.Time) []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var ids []string
+	for id, session := range sm.sessions {
+		if session.updatedBefore(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// DeleteStaleSessions deletes the sessions last updated before cutoff and
+// returns their IDs, sorted. A session that fails to be deleted from the
+// store is still dropped from memory and returned, with the error.
+func (sm *SessionManager) DeleteStaleSessions(cutoff time.Time) ([]string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var ids []string
+	var deleteErrs []error
+	for id, session := range sm.sessions {
+		if !session.updatedBefore(cutoff) {
+			continue
+		}
+		delete(sm.sessions, id)
+		if sm.queue != nil {
+			sm.queue.remove(id)
+		}
+		// Sessions without messages were never saved
+		if err := sm.store.Delete(id); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			deleteErrs = append(deleteErrs, fmt.Errorf("session %s: %w", id, err))
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 {
+		sm.touchList(sm.clock.Now())
+	}
+	slices.Sort(ids)
+	return ids, errors.Join(deleteErrs...)
+}
+
+// updatedBefore reports whether a session was last updated before t
+func (s *Session) updatedBefore(t time.Time) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.UpdatedAt.Before(t)
+}
@@ -0,0 +1,161 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxQueryLength is the maximum length in characters of a search query
+const MaxQueryLength = 200
+
+// Limits of the matches returned per session by Search
+const (
+	maxSearchSnippets = 3  // snippets returned per session
+	searchContext     = 40 // characters around a match in a snippet
+)
+
+// ErrInvalidQuery is returned for search queries that are empty or too long
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// SearchSnippet is a message matching a search query, cut around the first
+// match. Match is the matched text, as written in the message, between
+// Before and After; a cut is marked with "...".
+type SearchSnippet struct {
+	MessageID string    `json:"message_id"`
+	Role      string    `json:"role"`
+	Before    string    `json:"before"`
+	Match     string    `json:"match"`
+	After     string    `json:"after"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// SearchResult is a session with messages matching a search query
+type SearchResult struct {
+	SessionID string          `json:"session_id"`
+	Title     string          `json:"title"`
+	Archived  bool            `json:"archived,omitempty"`
+	Matches   int             `json:"matches"`  // number of matching messages
+	Snippets  []SearchSnippet `json:"snippets"` // the latest matching messages, newest first
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Search returns the sessions with messages containing query, ignoring case,
+// most recently updated first and at most limit; a limit of 0 or less returns
+// all of them. Messages are scanned one by one, which is fine for the
+// sessions of one user. Snippets are redacted like previews, and a match
+// that only the redactor's rules would reveal is not returned.
+func (sm *SessionManager) Search(query string, limit int) ([]SearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: the query is empty", ErrInvalidQuery)
+	}
+	if n := utf8.RuneCountInString(query); n > MaxQueryLength {
+		return nil, fmt.Errorf("%w: %d characters, at most %d are allowed", ErrInvalidQuery, n, MaxQueryLength)
+	}
+	needle := foldRunes(query)
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var results []SearchResult
+	for _, session := range sm.sessions {
+		if result, ok := sm.searchSession(session, needle); ok {
+			results = append(results, result)
+		}
+	}
+	slices.SortFunc(results, func(a, b SearchResult) int { return b.UpdatedAt.Compare(a.UpdatedAt) })
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// searchSession returns the messages of a session containing needle, newest first
+func (sm *SessionManager) searchSession(session *Session, needle []rune) (SearchResult, bool) {
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+
+	result := SearchResult{
+		SessionID: session.ID,
+		Title:     session.preview.Title,
+		Archived:  session.Archived,
+		CreatedAt: session.CreatedAt,
+		UpdatedAt: session.UpdatedAt,
+	}
+	if session.Title != "" {
+		result.Title = session.Title
+	}
+	for i := len(session.Messages) - 1; i >= 0; i-- {
+		msg := session.Messages[i]
+		if msg.Synthetic || indexRunes(foldRunes(msg.Content), needle) < 0 {
+			continue
+		}
+		// Matched again after redacting, so a snippet never shows redacted text
+		text := []rune(sm.previewRedactor.Redact(msg.Content))
+		at := indexRunes(foldRunes(string(text)), needle)
+		if at < 0 {
+			continue
+		}
+		result.Matches++
+		if len(result.Snippets) < maxSearchSnippets {
+			result.Snippets = append(result.Snippets, searchSnippet(msg, text, at, len(needle)))
+		}
+	}
+	return result, result.Matches > 0
+}
+
+// searchSnippet cuts the text of a message around the match at [at, at+n)
+func searchSnippet(msg Message, text []rune, at, n int) SearchSnippet {
+	start, end := max(0, at-searchContext), min(len(text), at+n+searchContext)
+	before, after := oneLine(string(text[start:at])), oneLine(string(text[at+n:end]))
+	if start > 0 {
+		before = "..." + before
+	}
+	if end < len(text) {
+		after += "..."
+	}
+	return SearchSnippet{
+		MessageID: msg.ID,
+		Role:      msg.Role,
+		Before:    before,
+		Match:     string(text[at : at+n]),
+		After:     after,
+		Timestamp: msg.Timestamp,
+	}
+}
+
+// oneLine replaces line breaks and other control characters by spaces
+func oneLine(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// foldRunes returns the characters of text in lower case. Each character
+// maps to one character, so positions in the result are positions in text.
+func foldRunes(text string) []rune {
+	runes := []rune(text)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+// indexRunes returns the position of the first needle in haystack, or -1
+func indexRunes(haystack, needle []rune) int {
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		if slices.Equal(haystack[i:i+len(needle)], needle) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+)
+
+// Limits of user secrets
+const (
+	MaxSecrets           = 20
+	MaxSecretValueLength = 4096
+)
+
+var (
+	// ErrSecretNotFound is returned for operations on an unknown secret
+	ErrSecretNotFound = errors.New("secret not found")
+	// ErrInvalidSecret is returned for badly named, too long or too many secrets
+	ErrInvalidSecret = errors.New("invalid secret")
+)
+
+// secretNamePattern matches secret names, which are used as environment
+// variable names
+var secretNamePattern = regexp.MustCompile(`^[A-Z_][A-Z0-9_]{0,63}$`)
+
+// ValidateSecretName checks that a secret name is a valid environment
+// variable name
+func ValidateSecretName(name string) error {
+	if !secretNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: name must be an environment variable name of upper case letters, digits and underscores", ErrInvalidSecret)
+	}
+	return nil
+}
+
+// SecretNames returns the names of the user's secrets, sorted
+func (sm *SessionManager) SecretNames() []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(sm.index.Secrets))
+}
+
+// SealedSecrets returns the user's secrets by name, as sealed values
+func (sm *SessionManager) SealedSecrets() map[string]string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return maps.Clone(sm.index.Secrets)
+}
+
+// SetSecret stores a sealed secret of the user, replacing one of the same
+// name. The session manager never sees the plain value.
+func (sm *SessionManager) SetSecret(name, sealed string) error {
+	if err := ValidateSecretName(name); err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	previous, existed := sm.index.Secrets[name]
+	if !existed && len(sm.index.Secrets) >= MaxSecrets {
+		return fmt.Errorf("%w: at most %d secrets are kept; delete some first", ErrInvalidSecret, MaxSecrets)
+	}
+	if sm.index.Secrets == nil {
+		sm.index.Secrets = make(map[string]string)
+	}
+	sm.index.Secrets[name] = sealed
+	if err := sm.saveIndex(); err != nil {
+		if existed {
+			sm.index.Secrets[name] = previous
+		} else {
+			delete(sm.index.Secrets, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteSecret wipes a secret of the user
+func (sm *SessionManager) DeleteSecret(name string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	previous, ok := sm.index.Secrets[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+
+	delete(sm.index.Secrets, name)
+	if err := sm.saveIndex(); err != nil {
+		sm.index.Secrets[name] = previous
+		return err
+	}
+	return nil
+}
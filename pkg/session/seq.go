@@ -0,0 +1,56 @@
+package session
+
+import (
+	"cmp"
+	"slices"
+)
+
+// nextSeq returns the sequence number of a new message of the session. The
+// caller must hold session.mu.
+func (s *Session) nextSeq() uint64 {
+	s.LastSeq++
+	return s.LastSeq
+}
+
+// assignSeqs numbers the messages of a session saved before messages had
+// sequence numbers, in their stored order, and sorts the messages by them.
+// It is called when a session is loaded from the store, before it is shared.
+func assignSeqs(session *Session) {
+	for i := range session.Messages {
+		if session.Messages[i].Seq == 0 {
+			session.Messages[i].Seq = session.nextSeq()
+		}
+		session.LastSeq = max(session.LastSeq, session.Messages[i].Seq)
+	}
+	slices.SortStableFunc(session.Messages, func(a, b Message) int {
+		return cmp.Compare(a.Seq, b.Seq)
+	})
+}
+
+// GetMessagesSince retrieves the messages of a session added after the
+// message with sequence number seq, in order, and the session's last sequence
+// number. Messages removed by the history limit are not returned, so a gap
+// between seq and the first message means the client missed them.
+func (sm *SessionManager) GetMessagesSince(sessionID string, seq uint64) ([]Message, uint64, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+
+	start, _ := slices.BinarySearchFunc(session.Messages, seq+1, func(m Message, seq uint64) int {
+		return cmp.Compare(m.Seq, seq)
+	})
+	return slices.Clone(session.Messages[start:]), session.LastSeq, nil
+}
+
+// MessageSeq returns the sequence number of a message, or 0 if it is not found
+func (sm *SessionManager) MessageSeq(sessionID, messageID string) uint64 {
+	message, err := sm.GetMessage(sessionID, messageID)
+	if err != nil {
+		return 0
+	}
+	return message.Seq
+}
@@ -1,34 +1,121 @@
 package session
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/smallnest/langchat/pkg/redact"
 )
 
+// ErrMessageNotFound is returned when a session has no message with an ID
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrSessionNotFound is returned by a store for a session it does not hold
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrSessionDeleted is returned for a session kept in memory whose stored
+// copy was deleted outside the manager, see CheckStored
+var ErrSessionDeleted = errors.New("session was deleted")
+
+// ErrNotUserMessage is returned when a change only valid for user messages,
+// such as an edit, is made to another message
+var ErrNotUserMessage = errors.New("not a user message")
+
 // Message represents a single chat message
 type Message struct {
-	ID        string    `json:"id"`        // unique message id
-	Role      string    `json:"role"`      // "user" or "assistant"
-	Content   string    `json:"content"`   // message content
-	Timestamp time.Time `json:"timestamp"` // when the message was sent
-	Feedback  string    `json:"feedback"`  // "like", "dislike", or empty
+	ID        string    `json:"id"`                  // unique message id
+	Seq       uint64    `json:"seq,omitempty"`       // position in the session, increasing by one per added message
+	Role      string    `json:"role"`                // "user" or "assistant"
+	Content   string    `json:"content"`             // message content
+	Timestamp time.Time `json:"timestamp"`           // when the message was sent
+	Feedback  string    `json:"feedback"`            // "like", "dislike", or empty
+	Reasoning string    `json:"reasoning,omitempty"` // reasoning trace of the assistant, if stored
+	// ContentHints tells frontends which renderers the content needs
+	ContentHints *ContentHints `json:"content_hints,omitempty"`
+	// Experiment and variant the turn was assigned to, if any
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"`
+	// Truncated tells why the message is incomplete, e.g. TruncatedServerRestart
+	Truncated string `json:"truncated,omitempty"`
+	// Refusal tells why the assistant declined to answer, e.g. RefusalOffTopic
+	Refusal string `json:"refusal,omitempty"`
+	// Synthetic marks messages not produced by the conversation, such as the
+	// greeting; they are shown but never sent to the LLM
+	Synthetic bool `json:"synthetic,omitempty"`
+	// DryRun marks the messages of a turn whose tools were selected but not executed
+	DryRun bool `json:"dry_run,omitempty"`
+	// Settings are the chat settings a user message was sent with
+	Settings *Settings `json:"settings,omitempty"`
+	// Tools called while producing an assistant message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Skill and tool selections made while producing an assistant message
+	Decisions []SelectionDecision `json:"decisions,omitempty"`
+	// Usage is the provider-reported token usage of an assistant message
+	Usage *Usage `json:"usage,omitempty"`
+	// Suggestions are follow-up questions offered after an assistant message
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// RefusalOffTopic marks the canned answer to a message outside the topic
+// scope of the assistant
+const RefusalOffTopic = "off_topic"
+
+// ToolCall summarizes a tool invocation of an assistant turn
+type ToolCall struct {
+	Tool       string `json:"tool"`
+	Source     string `json:"source"` // "skill" or "mcp"
+	Error      string `json:"error,omitempty"`
+	DryRun     bool   `json:"dry_run,omitempty"` // selected but not executed
+	Attempts   int    `json:"attempts"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Usage is the token usage of a message
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	CachedTokens     int `json:"cached_tokens,omitempty"` // prompt tokens read from the provider's prompt cache
+}
+
+// ContentHints describes rich content found in a message
+type ContentHints struct {
+	CodeLanguages []string `json:"code_languages"` // languages of fenced code blocks, in order of appearance
+	HasLatex      bool     `json:"has_latex"`
+	HasMermaid    bool     `json:"has_mermaid"`
+	HasTable      bool     `json:"has_table"`
 }
 
 // Session represents a chat session with history
 type Session struct {
-	ID        string    `json:"id"`
-	Messages  []Message `json:"messages"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         string     `json:"id"`
+	Title      string     `json:"title,omitempty"`       // set by the user; empty for the start of the first user message
+	FolderID   string     `json:"folder_id,omitempty"`   // folder the session is filed in; empty for the root
+	Tags       []string   `json:"tags,omitempty"`        // topic tags, set automatically or by the user
+	Archived   bool       `json:"archived,omitempty"`    // read-only and hidden from the default list
+	Pinned     bool       `json:"pinned,omitempty"`      // listed before the other sessions
+	Persona    string     `json:"persona,omitempty"`     // persona chosen when the session was created
+	ArchivedAt *time.Time `json:"archived_at,omitempty"` // when the session was archived
+	// Variables are substituted for {{name}} in messages and passed to tools
+	// declaring a parameter of the same name
+	Variables map[string]string `json:"variables,omitempty"`
+	Messages  []Message         `json:"messages"`
+	LastSeq   uint64            `json:"last_seq,omitempty"` // sequence number of the last added message
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
 	mu        sync.RWMutex
+	preview   Preview // list summary, maintained as messages change
+
+	version    uint64    // incremented by every saved change, see Version
+	modifiedAt time.Time // time of the last saved change
+	stored     bool      // the store holds the session, as of the last load or save
+	revision   int64     // revision of the stored session in a shared store, see RevisionStore
 }
 
 // SessionStore defines the interface for session persistence
@@ -37,86 +124,146 @@ type SessionStore interface {
 	Load(id string) (*Session, error)
 	Delete(id string) error
 	List() ([]*Session, error)
+	// Exists reports whether the store holds a session, without loading it
+	Exists(id string) (bool, error)
 }
 
 // FileSessionStore implements SessionStore using local files
 type FileSessionStore struct {
 	sessionDir string
+	compress   bool // write gzip-compressed files, see WithCompression
 }
 
 // NewFileSessionStore creates a new FileSessionStore
-func NewFileSessionStore(sessionDir string) *FileSessionStore {
+func NewFileSessionStore(sessionDir string, opts ...FileStoreOption) *FileSessionStore {
 	if err := os.MkdirAll(sessionDir, 0755); err != nil {
 		log.Printf("Warning: Failed to create session directory %s: %v", sessionDir, err)
 	}
-	return &FileSessionStore{sessionDir: sessionDir}
+	s := &FileSessionStore{sessionDir: sessionDir}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *FileSessionStore) Save(session *Session) error {
+	suffix, otherSuffix := s.suffixes()
+	filePath, err := s.filePath(session.ID, suffix)
+	if err != nil {
+		return err
+	}
+	otherPath, err := s.filePath(session.ID, otherSuffix)
+	if err != nil {
+		return err
+	}
+
 	// Only save sessions that have messages
 	if len(session.Messages) == 0 {
 		// If the session has no messages, don't save it to disk
 		// If it exists on disk from before, delete it
-		filePath := filepath.Join(s.sessionDir, fmt.Sprintf("%s.json", session.ID))
-		if _, err := os.Stat(filePath); err == nil {
-			// File exists, delete it
-			os.Remove(filePath)
-		}
+		os.Remove(filePath)
+		os.Remove(otherPath)
 		return nil
 	}
 
-	filePath := filepath.Join(s.sessionDir, fmt.Sprintf("%s.json", session.ID))
-
-	data, err := json.MarshalIndent(session, "", "  ")
+	data, err := encodeSession(session, s.compress)
 	if err != nil {
 		return fmt.Errorf("failed to marshal session: %w", err)
 	}
 
-	err = os.WriteFile(filePath, data, 0644)
-	if err != nil {
+	if err := writeFileAtomic(filePath, data); err != nil {
 		return fmt.Errorf("failed to write session file: %w", err)
 	}
+	// A file of the other kind, left from before the compression was
+	// switched, would otherwise shadow this one
+	if err := removeIfExists(otherPath); err != nil {
+		return fmt.Errorf("failed to remove outdated session file: %w", err)
+	}
 
 	return nil
 }
 
 func (s *FileSessionStore) Load(id string) (*Session, error) {
-	filePath := filepath.Join(s.sessionDir, id+".json")
-
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("session file not found: %s", id)
+	suffix, otherSuffix := s.suffixes()
+	var data []byte
+	var filePath string
+	for _, suffix := range []string{suffix, otherSuffix} {
+		path, err := s.filePath(id, suffix)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = os.ReadFile(path); err == nil {
+			filePath = path
+			break
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read session file: %w", err)
+		}
+	}
+	if filePath == "" {
+		return nil, fmt.Errorf("%w: %s: %w", ErrSessionNotFound, id, os.ErrNotExist)
 	}
 
-	var session Session
-	err = json.Unmarshal(data, &session)
+	session, err := decodeSession(data, strings.HasSuffix(filePath, compressedSuffix))
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal session: %v", err)
+		return nil, quarantine(id, filePath, err)
 	}
 
-	return &session, nil
+	return session, nil
+}
+
+func (s *FileSessionStore) Exists(id string) (bool, error) {
+	for _, suffix := range []string{plainSuffix, compressedSuffix} {
+		filePath, err := s.filePath(id, suffix)
+		if err != nil {
+			return false, err
+		}
+		_, err = os.Stat(filePath)
+		if err == nil {
+			return true, nil
+		}
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return false, nil
 }
 
 func (s *FileSessionStore) Delete(id string) error {
-	filePath := filepath.Join(s.sessionDir, fmt.Sprintf("%s.json", id))
-	return os.Remove(filePath)
+	var removed bool
+	for _, suffix := range []string{plainSuffix, compressedSuffix} {
+		filePath, err := s.filePath(id, suffix)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(filePath); err == nil {
+			removed = true
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := s.DeleteDraft(id); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if !removed {
+		return fmt.Errorf("%w: %s: %w", ErrSessionNotFound, id, os.ErrNotExist)
+	}
+	return nil
 }
 
 func (s *FileSessionStore) List() ([]*Session, error) {
-	files, err := os.ReadDir(s.sessionDir)
+	ids, err := s.ListIDs()
 	if err != nil {
 		return nil, err
 	}
 
 	var sessions []*Session
-	for _, file := range files {
-		if filepath.Ext(file.Name()) != ".json" {
-			continue
-		}
-
-		id := strings.TrimSuffix(file.Name(), ".json")
+	for _, id := range ids {
 		session, err := s.Load(id)
 		if err != nil {
+			if errors.Is(err, ErrCorruptSession) {
+				log.Printf("Warning: %v", err)
+			}
 			continue
 		}
 
@@ -128,12 +275,56 @@ func (s *FileSessionStore) List() ([]*Session, error) {
 	return sessions, nil
 }
 
+// ListIDs returns the IDs of all sessions stored on disk without loading
+// them, compressed or not
+func (s *FileSessionStore) ListIDs() ([]string, error) {
+	files, err := os.ReadDir(s.sessionDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	seen := make(map[string]bool, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		// A session briefly has both files while the compression is switched
+		if id, ok := sessionFileID(file.Name()); ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
 // SessionManager manages multiple chat sessions with an in-memory cache
 type SessionManager struct {
 	sessions   map[string]*Session
 	store      SessionStore
 	maxHistory int
 	mu         sync.RWMutex
+	clock      Clock
+	ids        IDGenerator
+	index      *Index // folders and other per-user metadata
+
+	previewRedactor *redact.Redactor // applied to session previews; nil for none
+
+	// Version of the session list, see ListVersion
+	startedAt      time.Time
+	listVersion    atomic.Uint64
+	listModifiedAt atomic.Int64 // unix nanoseconds
+
+	// Sessions whose last save failed, with the error, retried in the background
+	unsavedMu     sync.Mutex
+	unsaved       map[string]error
+	retrying      bool
+	retryStop     chan struct{} // closed by Close to end the retry loop
+	closeOnce     sync.Once
+	onSaveFailure func(err error)
+
+	// queue is the write-behind queue; nil when sessions are saved synchronously
+	queue *writeQueue
 }
 
 // NewSessionManager creates a new session manager
@@ -142,14 +333,34 @@ func NewSessionManager(store SessionStore, maxHistory int) *SessionManager {
 		sessions:   make(map[string]*Session),
 		store:      store,
 		maxHistory: maxHistory,
+		clock:      SystemClock,
+		ids:        UUIDGenerator,
+		retryStop:  make(chan struct{}),
+		startedAt:  time.Now(),
 	}
+	sm.listModifiedAt.Store(sm.startedAt.UnixNano())
 
-	// Load all sessions at startup
+	// Load all sessions and the metadata index at startup
 	sm.loadSessions()
+	sm.loadIndex()
 
 	return sm
 }
 
+// SetClock replaces the time source used for session and message timestamps
+func (sm *SessionManager) SetClock(clock Clock) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.clock = clock
+}
+
+// SetIDGenerator replaces the generator used for session and message IDs
+func (sm *SessionManager) SetIDGenerator(ids IDGenerator) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.ids = ids
+}
+
 // GetMaxHistory returns the maximum history length
 func (sm *SessionManager) GetMaxHistory() int {
 	return sm.maxHistory
@@ -160,14 +371,17 @@ func (sm *SessionManager) CreateSession() *Session {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	now := sm.clock.Now()
 	session := &Session{
-		ID:        uuid.New().String(),
-		Messages:  make([]Message, 0),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:         sm.ids.NewID(),
+		Messages:   make([]Message, 0),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		modifiedAt: now,
 	}
 
 	sm.sessions[session.ID] = session
+	sm.touchList(now)
 	return session
 }
 
@@ -178,7 +392,8 @@ func (sm *SessionManager) GetSession(id string) (*Session, error) {
 	sm.mu.RUnlock()
 
 	if exists {
-		return session, nil
+		// Another replica may have changed the session
+		return sm.refreshShared(session)
 	}
 
 	// Try to load from store
@@ -186,17 +401,22 @@ func (sm *SessionManager) GetSession(id string) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
+	assignSeqs(session)
+	sm.recoverDraft(session)
 
 	// Store in memory for future access
+	sm.cached(session)
 	sm.mu.Lock()
 	sm.sessions[id] = session
 	sm.mu.Unlock()
+	sm.touchList(sm.clock.Now())
 
 	return session, nil
 }
 
 // ListSessions returns all active sessions
 func (sm *SessionManager) ListSessions() []*Session {
+	sm.syncShared()
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
@@ -208,17 +428,117 @@ func (sm *SessionManager) ListSessions() []*Session {
 	return sessions
 }
 
+// ListSessionsPage returns the sessions kept by keep, pinned ones first and
+// each group most recently updated first, skipping offset sessions and
+// returning at most limit, together with the number of sessions kept. A nil keep keeps every session; a limit of 0
+// or less returns all sessions after offset.
+func (sm *SessionManager) ListSessionsPage(offset, limit int, keep func(*Session) bool) ([]*Session, int) {
+	sm.syncShared()
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	// UpdatedAt and Pinned are read once per session, under its lock, as
+	// changes may update them while the list is sorted
+	type entry struct {
+		session   *Session
+		updatedAt time.Time
+		pinned    bool
+	}
+	entries := make([]entry, 0, len(sm.sessions))
+	for _, session := range sm.sessions {
+		if keep == nil || keep(session) {
+			session.mu.RLock()
+			entries = append(entries, entry{session, session.UpdatedAt, session.Pinned})
+			session.mu.RUnlock()
+		}
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		if a.pinned != b.pinned {
+			if a.pinned {
+				return -1
+			}
+			return 1
+		}
+		if c := b.updatedAt.Compare(a.updatedAt); c != 0 {
+			return c
+		}
+		// Sessions updated at the same time keep a stable order across pages
+		return strings.Compare(a.session.ID, b.session.ID)
+	})
+
+	total := len(entries)
+	start := min(max(offset, 0), total)
+	end := total
+	if limit > 0 {
+		end = min(start+limit, total)
+	}
+	sessions := make([]*Session, 0, end-start)
+	for _, e := range entries[start:end] {
+		sessions = append(sessions, e.session)
+	}
+	return sessions, total
+}
+
 // DeleteSession removes a session
 func (sm *SessionManager) DeleteSession(id string) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	delete(sm.sessions, id)
+	sm.touchList(sm.clock.Now())
+	if sm.queue != nil {
+		sm.queue.remove(id)
+	}
 	return sm.store.Delete(id)
 }
 
+// CheckStored returns ErrSessionDeleted when a session kept in memory is gone
+// from the store although it was saved there, e.g. because an operator
+// deleted its file, and drops the session from memory, so it is not saved
+// again with only the messages that follow. Sessions the store never held
+// are not checked, nor are sessions that are not in memory, as GetSession
+// loads those from the store. Sessions with a queued or failed save are kept:
+// the store may not have them yet, and the pending save writes them back.
+func (sm *SessionManager) CheckStored(id string) error {
+	sm.mu.RLock()
+	session, ok := sm.sessions[id]
+	sm.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	session.mu.RLock()
+	stored := session.stored
+	session.mu.RUnlock()
+	if !stored || sm.savePending(id) {
+		return nil
+	}
+
+	exists, err := sm.store.Exists(id)
+	if err != nil || exists {
+		return err
+	}
+
+	// A save may have been queued or failed while the store was checked
+	if sm.savePending(id) {
+		return nil
+	}
+	sm.evict(session)
+	return fmt.Errorf("%w: %s", ErrSessionDeleted, id)
+}
+
 // AddMessage adds a message to a session
 func (sm *SessionManager) AddMessage(sessionID, role, content string) (string, error) {
+	return sm.AddMessageWithReasoning(sessionID, role, content, "")
+}
+
+// AddMessageWithReasoning adds a message together with the reasoning trace that produced it
+func (sm *SessionManager) AddMessageWithReasoning(sessionID, role, content, reasoning string) (string, error) {
+	return sm.AppendMessage(sessionID, Message{Role: role, Content: content, Reasoning: reasoning})
+}
+
+// AppendMessage adds a message to a session, assigning its ID, sequence
+// number and timestamp
+func (sm *SessionManager) AppendMessage(sessionID string, message Message) (string, error) {
 	session, err := sm.GetSession(sessionID)
 	if err != nil {
 		return "", err
@@ -227,24 +547,23 @@ func (sm *SessionManager) AddMessage(sessionID, role, content string) (string, e
 	session.mu.Lock()
 	defer session.mu.Unlock()
 
-	msgID := uuid.New().String()
-	message := Message{
-		ID:        msgID,
-		Role:      role,
-		Content:   content,
-		Timestamp: time.Now(),
-	}
+	now := sm.clock.Now()
+	msgID := sm.ids.NewID()
+	message.ID = msgID
+	message.Seq = session.nextSeq()
+	message.Timestamp = now
 
 	session.Messages = append(session.Messages, message)
-	session.UpdatedAt = time.Now()
+	session.UpdatedAt = now
 
 	if sm.maxHistory > 0 && len(session.Messages) > sm.maxHistory {
 		session.Messages = session.Messages[len(session.Messages)-sm.maxHistory:]
 	}
+	sm.addToPreview(session, message)
 
-	// Save to store
-	if err := sm.store.Save(session); err != nil {
-		return "", fmt.Errorf("failed to save session: %w", err)
+	// Save to store; the message is kept in memory and retried if this fails
+	if err := sm.save(session); err != nil {
+		return msgID, fmt.Errorf("failed to save session: %w", err)
 	}
 
 	return msgID, nil
@@ -252,6 +571,9 @@ func (sm *SessionManager) AddMessage(sessionID, role, content string) (string, e
 
 // UpdateMessageFeedback updates the feedback for a specific message
 func (sm *SessionManager) UpdateMessageFeedback(sessionID, messageID, feedback string) error {
+	if !ValidFeedback(feedback) {
+		return fmt.Errorf("%w: %q", ErrInvalidFeedback, feedback)
+	}
 	session, err := sm.GetSession(sessionID)
 	if err != nil {
 		return err
@@ -270,11 +592,107 @@ func (sm *SessionManager) UpdateMessageFeedback(sessionID, messageID, feedback s
 	}
 
 	if !found {
-		return fmt.Errorf("message not found: %s", messageID)
+		return fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+	}
+
+	session.UpdatedAt = sm.clock.Now()
+	return sm.save(session)
+}
+
+// SetMessageSuggestions stores the follow-up questions suggested after a
+// message. They are metadata, so the session's update time is kept.
+func (sm *SessionManager) SetMessageSuggestions(sessionID, messageID string, suggestions []string) error {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	for i := range session.Messages {
+		if session.Messages[i].ID == messageID {
+			session.Messages[i].Suggestions = suggestions
+			return sm.save(session)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+}
+
+// DeleteMessage removes a message from a session. The sequence numbers of
+// the other messages are kept.
+func (sm *SessionManager) DeleteMessage(sessionID, messageID string) error {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	i := slices.IndexFunc(session.Messages, func(m Message) bool { return m.ID == messageID })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+	}
+	session.Messages = slices.Delete(session.Messages, i, i+1)
+	session.UpdatedAt = sm.clock.Now()
+	sm.refreshPreview(session)
+
+	return sm.save(session)
+}
+
+// EditMessage replaces the user message with the ID of message by message,
+// keeping its sequence number, and removes the messages after it, so the
+// conversation goes on from the edit. It returns the messages before the
+// edited one.
+func (sm *SessionManager) EditMessage(sessionID string, message Message) ([]Message, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	i := slices.IndexFunc(session.Messages, func(m Message) bool { return m.ID == message.ID })
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, message.ID)
+	}
+	if session.Messages[i].Role != "user" || message.Role != "user" {
+		return nil, fmt.Errorf("%w: %s", ErrNotUserMessage, message.ID)
+	}
+
+	now := sm.clock.Now()
+	message.Seq = session.Messages[i].Seq
+	message.Timestamp = now
+	session.Messages = append(session.Messages[:i], message)
+	session.UpdatedAt = now
+	sm.refreshPreview(session)
+	history := slices.Clone(session.Messages[:i])
+
+	// Save to store; the edit is kept in memory and retried if this fails
+	if err := sm.save(session); err != nil {
+		return history, fmt.Errorf("failed to save session: %w", err)
+	}
+	return history, nil
+}
+
+// GetMessage retrieves a single message of a session
+func (sm *SessionManager) GetMessage(sessionID, messageID string) (Message, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return Message{}, err
 	}
 
-	session.UpdatedAt = time.Now()
-	return sm.store.Save(session)
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+
+	for _, msg := range session.Messages {
+		if msg.ID == messageID {
+			return msg, nil
+		}
+	}
+	return Message{}, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
 }
 
 // GetMessages retrieves all messages from a session
@@ -299,9 +717,15 @@ func (sm *SessionManager) loadSessions() {
 		return
 	}
 
+	for _, s := range sessions {
+		assignSeqs(s)
+		sm.recoverDraft(s)
+	}
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	for _, s := range sessions {
+		sm.cached(s)
 		sm.sessions[s.ID] = s
 	}
 }
@@ -317,7 +741,8 @@ func (sm *SessionManager) ClearHistory(sessionID string) error {
 	defer session.mu.Unlock()
 
 	session.Messages = make([]Message, 0)
-	session.UpdatedAt = time.Now()
+	session.UpdatedAt = sm.clock.Now()
+	sm.refreshPreview(session)
 
-	return sm.store.Save(session)
+	return sm.save(session)
 }
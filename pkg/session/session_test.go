@@ -0,0 +1,157 @@
+package session
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stepClock is a fake clock that advances by a second on every reading
+type stepClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newStepClock() *stepClock {
+	return &stepClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (c *stepClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(time.Second)
+	return c.now
+}
+
+// flakyStore is a file store whose saves fail while failing is set
+type flakyStore struct {
+	*FileSessionStore
+	failing atomic.Bool
+}
+
+var errDiskFull = errors.New("disk full")
+
+func (s *flakyStore) Save(session *Session) error {
+	if s.failing.Load() {
+		return errDiskFull
+	}
+	return s.FileSessionStore.Save(session)
+}
+
+// newTestManager returns a session manager backed by files in a temporary directory
+func newTestManager(t *testing.T) *SessionManager {
+	t.Helper()
+	return NewSessionManager(NewFileSessionStore(t.TempDir()), 0)
+}
+
+// pauseWriteBehind gives sm a write-behind queue without a worker, so queued
+// saves stay pending until the test calls Flush
+func pauseWriteBehind(sm *SessionManager) {
+	sm.queue = newWriteQueue(256)
+}
+
+// addMessages appends alternating user and assistant messages to a session
+func addMessages(t *testing.T, sm *SessionManager, sessionID string, contents ...string) []string {
+	t.Helper()
+	ids := make([]string, 0, len(contents))
+	for i, content := range contents {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		id, err := sm.AddMessage(sessionID, role, content)
+		if err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// assertPersisted checks that the store holds a session after the queue is flushed
+func assertPersisted(t *testing.T, sm *SessionManager, sessionID string) {
+	t.Helper()
+	sm.Flush()
+	exists, err := sm.store.Exists(sessionID)
+	if err != nil || !exists {
+		t.Fatalf("session %s not in the store after Flush: exists=%v, err=%v", sessionID, exists, err)
+	}
+	if err := sm.CheckStored(sessionID); err != nil {
+		t.Fatalf("CheckStored after Flush: %v", err)
+	}
+}
+
+func TestCheckStoredDeletedExternally(t *testing.T) {
+	sm := newTestManager(t)
+	session := sm.CreateSession()
+	addMessages(t, sm, session.ID, "hello")
+
+	if err := sm.store.Delete(session.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := sm.CheckStored(session.ID); !errors.Is(err, ErrSessionDeleted) {
+		t.Fatalf("CheckStored = %v, want ErrSessionDeleted", err)
+	}
+	if _, err := sm.GetSession(session.ID); err == nil {
+		t.Fatal("deleted session still served from memory")
+	}
+}
+
+func TestCheckStoredKeepsQueuedSession(t *testing.T) {
+	sm := newTestManager(t)
+	session := sm.CreateSession()
+	addMessages(t, sm, session.ID, "hello")
+
+	pauseWriteBehind(sm)
+	addMessages(t, sm, session.ID, "queued")
+	if err := sm.store.Delete(session.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := sm.CheckStored(session.ID); err != nil {
+		t.Fatalf("CheckStored of a session waiting in the queue: %v", err)
+	}
+	assertPersisted(t, sm, session.ID)
+
+	loaded, err := sm.store.Load(session.ID)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Messages) != 2 {
+		t.Fatalf("stored session has %d messages, want 2", len(loaded.Messages))
+	}
+}
+
+func TestCheckStoredKeepsUnsavedSession(t *testing.T) {
+	store := &flakyStore{FileSessionStore: NewFileSessionStore(t.TempDir())}
+	sm := NewSessionManager(store, 0)
+	defer sm.Close()
+	session := sm.CreateSession()
+	addMessages(t, sm, session.ID, "hello")
+
+	store.failing.Store(true)
+	if _, err := sm.AddMessage(session.ID, "assistant", "not saved"); !errors.Is(err, ErrNotPersisted) {
+		t.Fatalf("AddMessage = %v, want ErrNotPersisted", err)
+	}
+	if err := store.Delete(session.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := sm.CheckStored(session.ID); err != nil {
+		t.Fatalf("CheckStored of a session whose save failed: %v", err)
+	}
+
+	// The retry writes the kept changes back once the store accepts them
+	store.failing.Store(false)
+	sm.saveLatest(session.ID)
+	if err := sm.SaveError(session.ID); err != nil {
+		t.Fatalf("SaveError after the retry: %v", err)
+	}
+	loaded, err := store.Load(session.ID)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Messages) != 2 {
+		t.Fatalf("stored session has %d messages, want 2", len(loaded.Messages))
+	}
+}
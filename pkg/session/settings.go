@@ -0,0 +1,56 @@
+package session
+
+import "fmt"
+
+// Settings are the chat settings a user message was sent with, recorded so
+// the turn can be answered again, forked or studied as it was first answered
+type Settings struct {
+	EnableSkills bool     `json:"enable_skills"`
+	EnableMCP    bool     `json:"enable_mcp"`
+	Model        string   `json:"model,omitempty"`       // model that answered; empty for the configured one
+	Persona      string   `json:"persona,omitempty"`     // persona of the session
+	Temperature  *float64 `json:"temperature,omitempty"` // nil for the configured temperature
+	MaxTokens    int      `json:"max_tokens,omitempty"`  // 0 for the configured limit
+}
+
+// DefaultSettings returns the settings assumed for the user messages of a
+// session with persona recorded before messages had settings: skills and MCP
+// enabled, as in the web UI, with the configured model
+func DefaultSettings(persona string) Settings {
+	return Settings{EnableSkills: true, EnableMCP: true, Persona: persona}
+}
+
+// SettingsOf returns the settings of the turn of a message of a session,
+// stored on its user message. An assistant message has the settings of the
+// user message it answered. The caller must hold session.mu or own session.
+func SettingsOf(session *Session, messageID string) (Settings, error) {
+	for i := range session.Messages {
+		if session.Messages[i].ID != messageID {
+			continue
+		}
+		for j := i; j >= 0; j-- {
+			msg := session.Messages[j]
+			if msg.Role != "user" {
+				continue
+			}
+			if msg.Settings != nil {
+				return *msg.Settings, nil
+			}
+			break
+		}
+		return DefaultSettings(session.Persona), nil
+	}
+	return Settings{}, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+}
+
+// MessageSettings returns the settings of the turn of a message, see SettingsOf
+func (sm *SessionManager) MessageSettings(sessionID, messageID string) (Settings, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+	return SettingsOf(session, messageID)
+}
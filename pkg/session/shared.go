@@ -0,0 +1,144 @@
+package session
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// RevisionStore is implemented by stores shared by several replicas, such as
+// RedisSessionStore. Every save gives a session a new revision, so a replica
+// can tell that another one changed or deleted a session it keeps in memory.
+type RevisionStore interface {
+	SessionIDLister
+	// Revisions returns the current revision of each session, in order; 0
+	// for a session the store does not hold
+	Revisions(ids []string) ([]int64, error)
+}
+
+// refreshShared returns the current state of a session kept in memory when
+// the store is shared with other replicas: the cached session while its
+// revision is current, the stored one after another replica saved it, or
+// ErrSessionNotFound after another replica deleted it. The stored session
+// replaces the cached one. Sessions with a queued or failed save keep their
+// changes, which the pending save writes over the stored ones.
+func (sm *SessionManager) refreshShared(session *Session) (*Session, error) {
+	store, ok := sm.store.(RevisionStore)
+	if !ok {
+		return session, nil
+	}
+	revisions, err := store.Revisions([]string{session.ID})
+	if err != nil {
+		log.Printf("Warning: Failed to check the revision of session %s, using the cached one: %v", redact.LogID(session.ID), err)
+		return session, nil
+	}
+	return sm.refreshRevision(session, revisions[0])
+}
+
+// refreshRevision brings a cached session up to the stored revision, see refreshShared
+func (sm *SessionManager) refreshRevision(session *Session, revision int64) (*Session, error) {
+	session.mu.RLock()
+	current := session.revision == revision
+	stored := session.stored
+	session.mu.RUnlock()
+	// Sessions never saved, e.g. new ones without messages, are not shared yet
+	if current || (!stored && revision == 0) || sm.savePending(session.ID) {
+		return session, nil
+	}
+
+	if revision == 0 {
+		sm.evict(session)
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, session.ID)
+	}
+	// A draft may belong to an answer another replica is streaming, so it is
+	// not recovered here
+	loaded, err := sm.store.Load(session.ID)
+	if err != nil {
+		log.Printf("Warning: Failed to reload session %s changed by another replica, using the cached one: %v", redact.LogID(session.ID), err)
+		return session, nil
+	}
+	assignSeqs(loaded)
+	sm.cached(loaded)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.sessions[session.ID] != session {
+		// Replaced or deleted meanwhile; the newer state wins
+		if current, ok := sm.sessions[session.ID]; ok {
+			return current, nil
+		}
+		return loaded, nil
+	}
+	sm.sessions[session.ID] = loaded
+	sm.touchList(sm.clock.Now())
+	return loaded, nil
+}
+
+// syncShared brings the sessions in memory up to the store when it is shared
+// with other replicas, before the sessions are listed: sessions other
+// replicas created are loaded, changed ones are reloaded and deleted ones
+// dropped.
+func (sm *SessionManager) syncShared() {
+	store, ok := sm.store.(RevisionStore)
+	if !ok {
+		return
+	}
+	ids, err := store.ListIDs()
+	if err != nil {
+		log.Printf("Warning: Failed to list shared sessions, listing the cached ones: %v", err)
+		return
+	}
+
+	sm.mu.RLock()
+	cached := make(map[string]*Session, len(sm.sessions))
+	for id, session := range sm.sessions {
+		cached[id] = session
+	}
+	sm.mu.RUnlock()
+	for id := range cached {
+		ids = append(ids, id)
+	}
+	ids = uniqueIDs(ids)
+
+	revisions, err := store.Revisions(ids)
+	if err != nil {
+		log.Printf("Warning: Failed to check the revisions of shared sessions, listing the cached ones: %v", err)
+		return
+	}
+	for i, id := range ids {
+		if session, ok := cached[id]; ok {
+			_, _ = sm.refreshRevision(session, revisions[i])
+		} else if revisions[i] > 0 {
+			if _, err := sm.GetSession(id); err != nil {
+				log.Printf("Warning: Failed to load shared session %s: %v", redact.LogID(id), err)
+			}
+		}
+	}
+}
+
+// evict drops a session from memory unless it was replaced meanwhile
+func (sm *SessionManager) evict(session *Session) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.sessions[session.ID] == session {
+		delete(sm.sessions, session.ID)
+		sm.touchList(sm.clock.Now())
+		if sm.queue != nil {
+			sm.queue.remove(session.ID)
+		}
+	}
+}
+
+// uniqueIDs returns ids without duplicates, in their first order
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,27 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// NewStore returns the session store of the backend selected by db.Type,
+// keeping the sessions of one namespace under baseDir: files, compressed
+// with db.Compression, or Redis at cache.RedisURL with the expiry cache.TTL,
+// for replicas that share sessions.
+// The SQL database types of DatabaseConfig are refused rather than silently
+// stored as files.
+func NewStore(db configpkg.DatabaseConfig, cache configpkg.CacheConfig, baseDir string) (SessionStore, error) {
+	switch strings.ToLower(db.Type) {
+	case "file", "":
+		return NewFileSessionStore(baseDir, WithCompression(db.Compression)), nil
+	case "redis":
+		return NewRedisSessionStore(cache.RedisURL, baseDir, cache.TTL)
+	case "sqlite", "postgres", "mysql":
+		return nil, fmt.Errorf("session store type %s is not available in this build", db.Type)
+	default:
+		return nil, fmt.Errorf("unsupported session store type: %s", db.Type)
+	}
+}
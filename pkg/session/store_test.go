@@ -0,0 +1,65 @@
+package session
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+func TestNewStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	tests := []struct {
+		name       string
+		db         configpkg.DatabaseConfig
+		redisURL   string
+		wantFile   bool
+		wantGzip   bool
+		wantRedis  bool
+		wantErrSub string
+	}{
+		{name: "default", db: configpkg.DatabaseConfig{}, wantFile: true},
+		{name: "file", db: configpkg.DatabaseConfig{Type: "file"}, wantFile: true},
+		{name: "file in capitals", db: configpkg.DatabaseConfig{Type: "FILE"}, wantFile: true},
+		{name: "compressed files", db: configpkg.DatabaseConfig{Type: "file", Compression: true}, wantFile: true, wantGzip: true},
+		{name: "redis", db: configpkg.DatabaseConfig{Type: "redis"}, redisURL: "redis://" + mr.Addr(), wantRedis: true},
+		{name: "redis with an invalid URL", db: configpkg.DatabaseConfig{Type: "redis"}, redisURL: "http://" + mr.Addr(), wantErrSub: "redis"},
+		{name: "sqlite", db: configpkg.DatabaseConfig{Type: "sqlite"}, wantErrSub: "not available in this build"},
+		{name: "postgres", db: configpkg.DatabaseConfig{Type: "postgres"}, wantErrSub: "not available in this build"},
+		{name: "mysql", db: configpkg.DatabaseConfig{Type: "mysql"}, wantErrSub: "not available in this build"},
+		{name: "unknown", db: configpkg.DatabaseConfig{Type: "mongodb"}, wantErrSub: "unsupported session store type: mongodb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewStore(tt.db, configpkg.CacheConfig{RedisURL: tt.redisURL, TTL: time.Hour}, t.TempDir())
+			if tt.wantErrSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSub) {
+					t.Fatalf("NewStore = %T, %v, want an error containing %q", store, err, tt.wantErrSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewStore: %v", err)
+			}
+			switch s := store.(type) {
+			case *FileSessionStore:
+				if !tt.wantFile || s.compress != tt.wantGzip {
+					t.Fatalf("NewStore = file store compressing %v, want file %v compressing %v", s.compress, tt.wantFile, tt.wantGzip)
+				}
+			case *RedisSessionStore:
+				if !tt.wantRedis || s.ttl != time.Hour {
+					t.Fatalf("NewStore = Redis store with TTL %v, want Redis %v with the cache TTL", s.ttl, tt.wantRedis)
+				}
+				// The store works against the configured server
+				if err := s.Save(testSession("s1", "hello")); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			default:
+				t.Fatalf("NewStore = %T", store)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MaxTags is the maximum number of tags a session may carry
+const MaxTags = 10
+
+// Errors of adding and removing single tags
+var (
+	ErrInvalidTag  = errors.New("tag must not be empty")
+	ErrTooManyTags = fmt.Errorf("a session carries at most %d tags", MaxTags)
+	ErrTagNotFound = errors.New("tag not found")
+)
+
+// NormalizeTags lowercases, trims and de-duplicates tags, keeping at most limit of them
+func NormalizeTags(tags []string, limit int) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		normalized = append(normalized, tag)
+		if limit > 0 && len(normalized) == limit {
+			break
+		}
+	}
+	return normalized
+}
+
+// SetSessionTags replaces the tags of a session
+func (sm *SessionManager) SetSessionTags(sessionID string, tags []string) ([]string, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.Tags = NormalizeTags(tags, MaxTags)
+	session.UpdatedAt = sm.clock.Now()
+	if err := sm.save(session); err != nil {
+		return nil, err
+	}
+	return slices.Clone(session.Tags), nil
+}
+
+// AddTag adds a tag to a session and returns its tags. The tag is
+// normalized like NormalizeTags; a tag the session already carries is
+// ignored.
+func (sm *SessionManager) AddTag(sessionID, tag string) ([]string, error) {
+	tag = normalizeTag(tag)
+	if tag == "" {
+		return nil, ErrInvalidTag
+	}
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if slices.Contains(session.Tags, tag) {
+		return slices.Clone(session.Tags), nil
+	}
+	if len(session.Tags) >= MaxTags {
+		return nil, ErrTooManyTags
+	}
+	session.Tags = append(session.Tags, tag)
+	session.UpdatedAt = sm.clock.Now()
+	if err := sm.save(session); err != nil {
+		return nil, err
+	}
+	return slices.Clone(session.Tags), nil
+}
+
+// RemoveTag removes a tag from a session and returns the remaining tags
+func (sm *SessionManager) RemoveTag(sessionID, tag string) ([]string, error) {
+	tag = normalizeTag(tag)
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if !slices.Contains(session.Tags, tag) {
+		return nil, fmt.Errorf("%w: %s", ErrTagNotFound, tag)
+	}
+	// A new slice, as readers may still hold the old one
+	session.Tags = slices.DeleteFunc(slices.Clone(session.Tags), func(t string) bool { return t == tag })
+	session.UpdatedAt = sm.clock.Now()
+	if err := sm.save(session); err != nil {
+		return nil, err
+	}
+	return slices.Clone(session.Tags), nil
+}
+
+// ListByTag returns the sessions carrying a tag, see ListSessions
+func (sm *SessionManager) ListByTag(tag string) []*Session {
+	return slices.DeleteFunc(sm.ListSessions(), func(session *Session) bool {
+		return !session.HasTag(tag)
+	})
+}
+
+// normalizeTag trims and lowercases a tag
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// GetTags returns a copy of the tags of a session
+func (s *Session) GetTags() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.Tags)
+}
+
+// HasTag reports whether a session carries a tag
+func (s *Session) HasTag(tag string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Contains(s.Tags, normalizeTag(tag))
+}
@@ -0,0 +1,111 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestAddRemoveTag(t *testing.T) {
+	sm := newTestManager(t)
+	session := sm.CreateSession()
+	addMessages(t, sm, session.ID, "hello")
+
+	if _, err := sm.AddTag(session.ID, "  Go "); err != nil {
+		t.Fatalf("AddTag: %v", err)
+	}
+	tags, err := sm.AddTag(session.ID, "go")
+	if err != nil {
+		t.Fatalf("AddTag of a carried tag: %v", err)
+	}
+	if !slices.Equal(tags, []string{"go"}) {
+		t.Fatalf("tags = %v, want [go]", tags)
+	}
+	if _, err := sm.AddTag(session.ID, " "); !errors.Is(err, ErrInvalidTag) {
+		t.Fatalf("AddTag of an empty tag = %v, want ErrInvalidTag", err)
+	}
+	for i := len(tags); i < MaxTags; i++ {
+		if _, err := sm.AddTag(session.ID, fmt.Sprintf("tag%d", i)); err != nil {
+			t.Fatalf("AddTag: %v", err)
+		}
+	}
+	if _, err := sm.AddTag(session.ID, "one-too-many"); !errors.Is(err, ErrTooManyTags) {
+		t.Fatalf("AddTag beyond MaxTags = %v, want ErrTooManyTags", err)
+	}
+
+	tags, err = sm.RemoveTag(session.ID, "GO")
+	if err != nil {
+		t.Fatalf("RemoveTag: %v", err)
+	}
+	if len(tags) != MaxTags-1 || slices.Contains(tags, "go") {
+		t.Fatalf("tags after RemoveTag = %v", tags)
+	}
+	if _, err := sm.RemoveTag(session.ID, "go"); !errors.Is(err, ErrTagNotFound) {
+		t.Fatalf("RemoveTag of a missing tag = %v, want ErrTagNotFound", err)
+	}
+	if got := sm.ListByTag("tag1"); len(got) != 1 || got[0].ID != session.ID {
+		t.Fatalf("ListByTag = %v", got)
+	}
+}
+
+func TestRemoveTagKeepsEarlierCopies(t *testing.T) {
+	sm := newTestManager(t)
+	session := sm.CreateSession()
+	if _, err := sm.SetSessionTags(session.ID, []string{"a", "b", "c"}); err != nil {
+		t.Fatalf("SetSessionTags: %v", err)
+	}
+
+	// A reader holding the tag slice must not see it change under it
+	session.mu.RLock()
+	held := session.Tags
+	session.mu.RUnlock()
+	if _, err := sm.RemoveTag(session.ID, "a"); err != nil {
+		t.Fatalf("RemoveTag: %v", err)
+	}
+	if !slices.Equal(held, []string{"a", "b", "c"}) {
+		t.Fatalf("held tags changed to %v", held)
+	}
+	if got := session.GetTags(); !slices.Equal(got, []string{"b", "c"}) {
+		t.Fatalf("GetTags = %v, want [b c]", got)
+	}
+}
+
+func TestTagsConcurrentReaders(t *testing.T) {
+	sm := newTestManager(t)
+	session := sm.CreateSession()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, tag := range session.GetTags() {
+					if tag == "" {
+						t.Error("read an empty tag")
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := range 200 {
+		tag := fmt.Sprintf("t%d", i%3)
+		if _, err := sm.AddTag(session.ID, tag); err != nil {
+			t.Fatalf("AddTag: %v", err)
+		}
+		if _, err := sm.RemoveTag(session.ID, tag); err != nil {
+			t.Fatalf("RemoveTag: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,64 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxTitleLength is the maximum length in characters of a session title set by the user
+const MaxTitleLength = 100
+
+// ErrInvalidTitle is returned for session titles that are not allowed
+var ErrInvalidTitle = errors.New("invalid title")
+
+// NormalizeTitle trims a session title and replaces line breaks and other
+// control characters by spaces, so a title stays a single line
+func NormalizeTitle(title string) (string, error) {
+	title = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, title))
+	if n := utf8.RuneCountInString(title); n > MaxTitleLength {
+		return "", fmt.Errorf("%w: %d characters, at most %d are allowed", ErrInvalidTitle, n, MaxTitleLength)
+	}
+	return title, nil
+}
+
+// RenameSession sets the title of a session. An empty title reverts to the
+// title derived from the first user message.
+func (sm *SessionManager) RenameSession(sessionID, title string) (string, error) {
+	title, err := NormalizeTitle(title)
+	if err != nil {
+		return "", err
+	}
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.Title = title
+	session.UpdatedAt = sm.clock.Now()
+	if err := sm.save(session); err != nil {
+		return "", err
+	}
+	return title, nil
+}
+
+// DisplayTitle returns the title set by the user or, without one, the start
+// of the first user message of the session
+func (s *Session) DisplayTitle() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.Title != "" {
+		return s.Title
+	}
+	return Title(s.Messages)
+}
@@ -0,0 +1,109 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Limits of session variables
+const (
+	MaxVariables          = 50
+	MaxVariableNameLength = 64
+	MaxVariableLength     = 1000
+)
+
+// ErrInvalidVariable is returned for variable names or values that are not allowed
+var ErrInvalidVariable = errors.New("invalid variable")
+
+// variableName matches the names usable in {{name}} placeholders
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// placeholder matches {{name}}, optionally with spaces inside the braces, and
+// the escaped form \{{name}} that is kept literally
+var placeholder = regexp.MustCompile(`\\?\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// MissingVariablesError is returned when text refers to variables that are not set
+type MissingVariablesError struct {
+	Names []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return "undefined variables: " + strings.Join(e.Names, ", ")
+}
+
+// ValidateVariables checks the names, values and number of session variables
+func ValidateVariables(variables map[string]string) error {
+	if len(variables) > MaxVariables {
+		return fmt.Errorf("%w: at most %d variables are allowed", ErrInvalidVariable, MaxVariables)
+	}
+	for name, value := range variables {
+		if len(name) > MaxVariableNameLength || !variableName.MatchString(name) {
+			return fmt.Errorf("%w: name %q must be a letter or underscore followed by letters, digits or underscores", ErrInvalidVariable, name)
+		}
+		if len(value) > MaxVariableLength {
+			return fmt.Errorf("%w: value of %s is longer than %d bytes", ErrInvalidVariable, name, MaxVariableLength)
+		}
+	}
+	return nil
+}
+
+// ExpandVariables replaces the {{name}} placeholders of text with the values
+// of variables. A placeholder preceded by a backslash is kept literally,
+// without the backslash. Placeholders of unset variables fail with a
+// *MissingVariablesError listing them.
+func ExpandVariables(text string, variables map[string]string) (string, error) {
+	var missing []string
+	expanded := placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		if strings.HasPrefix(match, `\`) {
+			return match[1:]
+		}
+		name := placeholder.FindStringSubmatch(match)[1]
+		value, ok := variables[name]
+		if !ok {
+			if !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+			return match
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return text, &MissingVariablesError{Names: missing}
+	}
+	return expanded, nil
+}
+
+// SetSessionVariables replaces the variables of a session
+func (sm *SessionManager) SetSessionVariables(sessionID string, variables map[string]string) (map[string]string, error) {
+	if err := ValidateVariables(variables); err != nil {
+		return nil, err
+	}
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.Variables = maps.Clone(variables)
+	if len(session.Variables) == 0 {
+		session.Variables = nil
+	}
+	session.UpdatedAt = sm.clock.Now()
+	if err := sm.save(session); err != nil {
+		return nil, err
+	}
+	return maps.Clone(session.Variables), nil
+}
+
+// GetVariables returns a copy of the variables of a session
+func (s *Session) GetVariables() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.Variables)
+}
@@ -0,0 +1,67 @@
+package session
+
+import (
+	"strconv"
+	"time"
+)
+
+// bootID tells the versions of this process apart from those of earlier
+// ones, whose counters started from the same values
+var bootID = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// Version identifies the state of a session, or of the session list of a
+// user, e.g. to build HTTP validators. It changes with every saved change,
+// including changes that keep UpdatedAt such as suggestions, and on restart.
+type Version struct {
+	Tag        string    // opaque, equal for equal states within a process
+	ModifiedAt time.Time // when the state last changed, or when it was loaded
+}
+
+// Version returns the current version of the session
+func (s *Session) Version() Version {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Version{
+		Tag:        bootID + "." + strconv.FormatUint(s.version, 36),
+		ModifiedAt: s.modifiedAt,
+	}
+}
+
+// ListVersion returns the current version of the user's session list, which
+// changes whenever a session is created, loaded, changed or deleted
+func (sm *SessionManager) ListVersion() Version {
+	return Version{
+		Tag:        bootID + "." + strconv.FormatUint(sm.listVersion.Load(), 36),
+		ModifiedAt: time.Unix(0, sm.listModifiedAt.Load()),
+	}
+}
+
+// touch records a change of a session; the caller must hold session.mu
+func (sm *SessionManager) touch(session *Session) {
+	now := sm.clock.Now()
+	session.version++
+	session.modifiedAt = now
+	sm.touchList(now)
+}
+
+// touchList records a change of the session list. It does not take sm.mu,
+// so it may be called with a session lock held.
+func (sm *SessionManager) touchList(now time.Time) {
+	sm.listVersion.Add(1)
+	sm.listModifiedAt.Store(now.UnixNano())
+}
+
+// cached prepares a session read from the store for the in-memory cache.
+// Changes made before a restart are not tracked, so the session counts as
+// modified when the manager started.
+func (sm *SessionManager) cached(session *Session) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.stored = true
+	session.modifiedAt = sm.startedAt
+	if session.UpdatedAt.After(sm.startedAt) {
+		session.modifiedAt = session.UpdatedAt
+	}
+	sm.refreshPreview(session)
+}
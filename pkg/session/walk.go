@@ -0,0 +1,48 @@
+package session
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/smallnest/langchat/pkg/redact"
+)
+
+// WalkUsers calls fn for every session of every user namespace
+// (<root>/users/<userID>) of a file store tree. Sessions are loaded one at a
+// time, so the whole tree is never held in memory. Sessions that cannot be
+// loaded are skipped with a warning; an error from fn ends the walk.
+func WalkUsers(root string, fn func(userID string, session *Session) error) error {
+	entries, err := os.ReadDir(filepath.Join(root, "users"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read user namespaces: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		userID := entry.Name()
+		store := &FileSessionStore{sessionDir: filepath.Join(root, "users", userID)}
+		ids, err := store.ListIDs()
+		if err != nil {
+			return fmt.Errorf("failed to list sessions of user %s: %w", userID, err)
+		}
+		for _, id := range ids {
+			session, err := store.Load(id)
+			if err != nil {
+				log.Printf("Warning: Skipping session %s of user %s: %v", redact.LogID(id), redact.LogID(userID), err)
+				continue
+			}
+			assignSeqs(session)
+			if err := fn(userID, session); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
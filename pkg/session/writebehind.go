@@ -0,0 +1,190 @@
+package session
+
+import (
+	"sync"
+)
+
+// writeQueue is the write-behind queue of a session manager. It holds session
+// IDs rather than snapshots: the worker saves the latest in-memory state, so
+// several saves of a session waiting in the queue are coalesced into one write
+// and writes of a session never go back in time.
+type writeQueue struct {
+	mu      sync.Mutex
+	pending map[string]struct{}
+	order   []string // FIFO of the pending session IDs
+	writing int      // saves taken from the queue and not finished yet
+	idle    *sync.Cond
+	size    int
+	wake    chan struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+// EnableWriteBehind moves session saves to a background worker with a queue
+// of up to size sessions. Saves fall back to writing synchronously while the
+// queue is full or after Close. It must be called before the manager is used.
+func (sm *SessionManager) EnableWriteBehind(size int) {
+	if size <= 0 || sm.queue != nil {
+		return
+	}
+	sm.queue = newWriteQueue(size)
+	go sm.writeBehind()
+}
+
+// newWriteQueue returns an empty queue of up to size sessions
+func newWriteQueue(size int) *writeQueue {
+	q := &writeQueue{
+		pending: make(map[string]struct{}),
+		size:    size,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	q.idle = sync.NewCond(&q.mu)
+	return q
+}
+
+// enqueue queues a save of a session and reports whether it was queued
+func (q *writeQueue) enqueue(sessionID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+	if _, ok := q.pending[sessionID]; ok {
+		return true
+	}
+	if len(q.order) >= q.size {
+		return false
+	}
+	q.pending[sessionID] = struct{}{}
+	q.order = append(q.order, sessionID)
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// has reports whether a save of a session waits in the queue
+func (q *writeQueue) has(sessionID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.pending[sessionID]
+	return ok
+}
+
+// next removes the oldest pending session ID; ok is false when the queue is
+// empty, and closed tells whether the queue accepts no more saves. A taken
+// save must be finished with written.
+func (q *writeQueue) next() (sessionID string, ok, closed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.order) == 0 {
+		return "", false, q.closed
+	}
+	sessionID = q.order[0]
+	q.order = q.order[1:]
+	delete(q.pending, sessionID)
+	q.writing++
+	return sessionID, true, q.closed
+}
+
+// written marks a save taken with next as finished
+func (q *writeQueue) written() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.writing--
+	if q.writing == 0 && len(q.order) == 0 {
+		q.idle.Broadcast()
+	}
+}
+
+// remove drops a pending save, e.g. of a deleted session
+func (q *writeQueue) remove(sessionID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.pending[sessionID]; !ok {
+		return
+	}
+	delete(q.pending, sessionID)
+	for i, id := range q.order {
+		if id == sessionID {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+	if q.writing == 0 && len(q.order) == 0 {
+		q.idle.Broadcast()
+	}
+}
+
+// writeBehind saves queued sessions until the queue is closed and drained
+func (sm *SessionManager) writeBehind() {
+	q := sm.queue
+	defer close(q.done)
+
+	for {
+		sessionID, ok, closed := q.next()
+		if ok {
+			sm.saveLatest(sessionID)
+			q.written()
+			continue
+		}
+		if closed {
+			return
+		}
+		<-q.wake
+	}
+}
+
+// Flush writes every queued session and waits for saves in progress, e.g.
+// before the session files are read directly
+func (sm *SessionManager) Flush() {
+	q := sm.queue
+	if q == nil {
+		return
+	}
+
+	// Help the worker drain the queue rather than wait behind it
+	for {
+		sessionID, ok, _ := q.next()
+		if !ok {
+			break
+		}
+		sm.saveLatest(sessionID)
+		q.written()
+	}
+
+	q.mu.Lock()
+	for q.writing > 0 || len(q.order) > 0 {
+		q.idle.Wait()
+	}
+	q.mu.Unlock()
+}
+
+// Close flushes the write-behind queue, waits until every queued session is
+// written and stops retrying failed saves. Saves after Close are synchronous
+// and not retried. Close can be called more than once.
+func (sm *SessionManager) Close() error {
+	if q := sm.queue; q != nil {
+		q.mu.Lock()
+		if !q.closed {
+			q.closed = true
+			select {
+			case q.wake <- struct{}{}:
+			default:
+			}
+		}
+		q.mu.Unlock()
+
+		<-q.done
+	}
+
+	sm.closeOnce.Do(func() { close(sm.retryStop) })
+	return sm.PersistenceError()
+}
@@ -0,0 +1,151 @@
+package session
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// countingStore is a file store counting the saves of each session
+type countingStore struct {
+	*FileSessionStore
+	mu    sync.Mutex
+	saves map[string]int
+}
+
+func newCountingStore(dir string) *countingStore {
+	return &countingStore{FileSessionStore: NewFileSessionStore(dir), saves: make(map[string]int)}
+}
+
+func (s *countingStore) Save(session *Session) error {
+	s.mu.Lock()
+	s.saves[session.ID]++
+	s.mu.Unlock()
+	return s.FileSessionStore.Save(session)
+}
+
+func (s *countingStore) count(sessionID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves[sessionID]
+}
+
+func TestWriteBehindCoalescesSaves(t *testing.T) {
+	store := newCountingStore(t.TempDir())
+	sm := NewSessionManager(store, 0)
+	pauseWriteBehind(sm)
+	session := sm.CreateSession()
+
+	addMessages(t, sm, session.ID, "one", "two", "three", "four")
+	if n := store.count(session.ID); n != 0 {
+		t.Fatalf("%d saves before the queue is drained, want 0", n)
+	}
+	sm.Flush()
+	if n := store.count(session.ID); n != 1 {
+		t.Fatalf("%d saves for four queued changes, want 1", n)
+	}
+
+	loaded, err := store.Load(session.ID)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := contents(loaded.Messages); len(got) != 4 || got[3] != "four" {
+		t.Fatalf("stored messages = %v, want the latest state", got)
+	}
+}
+
+func TestWriteBehindFallsBackWhenFull(t *testing.T) {
+	store := newCountingStore(t.TempDir())
+	sm := NewSessionManager(store, 0)
+	sm.queue = newWriteQueue(1)
+	first, second := sm.CreateSession(), sm.CreateSession()
+
+	addMessages(t, sm, first.ID, "queued")
+	addMessages(t, sm, second.ID, "written now")
+	if n := store.count(first.ID); n != 0 {
+		t.Fatalf("queued session saved %d times before the flush", n)
+	}
+	if n := store.count(second.ID); n != 1 {
+		t.Fatalf("session saved %d times while the queue was full, want 1", n)
+	}
+	assertPersisted(t, sm, first.ID)
+}
+
+func TestWriteBehindDropsDeletedSession(t *testing.T) {
+	store := newCountingStore(t.TempDir())
+	sm := NewSessionManager(store, 0)
+	pauseWriteBehind(sm)
+	session := sm.CreateSession()
+	addMessages(t, sm, session.ID, "deleted before written")
+
+	// The store never held the session
+	_ = sm.DeleteSession(session.ID)
+	sm.Flush()
+	if n := store.count(session.ID); n != 0 {
+		t.Fatalf("deleted session saved %d times", n)
+	}
+	if exists, _ := store.Exists(session.ID); exists {
+		t.Fatal("deleted session written back")
+	}
+}
+
+func TestWriteBehindSavesSynchronouslyAfterClose(t *testing.T) {
+	store := newCountingStore(t.TempDir())
+	sm := NewSessionManager(store, 0)
+	sm.EnableWriteBehind(16)
+	session := sm.CreateSession()
+	if err := sm.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	addMessages(t, sm, session.ID, "after close")
+	if n := store.count(session.ID); n != 1 {
+		t.Fatalf("session saved %d times after Close, want 1 synchronous save", n)
+	}
+}
+
+// TestWriteBehindCloseLosesNoAcknowledgedMessage checks crash consistency:
+// every message AddMessage acknowledged is in the store after a clean Close,
+// in order, even while many sessions are written concurrently.
+func TestWriteBehindCloseLosesNoAcknowledgedMessage(t *testing.T) {
+	dir := t.TempDir()
+	sm := NewSessionManager(NewFileSessionStore(dir), 0)
+	sm.EnableWriteBehind(4)
+
+	const sessions, messages = 8, 25
+	ids := make([]string, sessions)
+	for i := range ids {
+		ids[i] = sm.CreateSession().ID
+	}
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Go(func() {
+			for j := range messages {
+				if _, err := sm.AddMessage(id, "user", fmt.Sprint(j)); err != nil {
+					t.Errorf("AddMessage: %v", err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+	if err := sm.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened := NewSessionManager(NewFileSessionStore(dir), 0)
+	for _, id := range ids {
+		stored, err := reopened.GetMessages(id)
+		if err != nil {
+			t.Fatalf("GetMessages of %s after Close: %v", id, err)
+		}
+		if len(stored) != messages {
+			t.Fatalf("session %s has %d messages after Close, want %d", id, len(stored), messages)
+		}
+		for j, msg := range stored {
+			if msg.Content != fmt.Sprint(j) || msg.Seq != uint64(j+1) {
+				t.Fatalf("message %d of session %s = %q seq %d, out of order", j, id, msg.Content, msg.Seq)
+			}
+		}
+	}
+}
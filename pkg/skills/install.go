@@ -0,0 +1,325 @@
+// Package skills installs and removes skill packages in the skills directory.
+// Packages are zip archives verified by checksum and, optionally, by an
+// Ed25519 signature before they are unpacked. Installed skills keep their
+// previous versions, so a failing update can be rolled back.
+package skills
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smallnest/goskills"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// Errors of skill installation
+var (
+	ErrInvalidPackage   = errors.New("invalid skill package")
+	ErrTooLarge         = errors.New("skill package too large")
+	ErrChecksumMismatch = errors.New("skill package checksum mismatch")
+	ErrBadSignature     = errors.New("skill package signature not valid")
+	ErrExists           = errors.New("skill version already installed")
+	ErrNotFound         = errors.New("skill not installed")
+	ErrNoVersion        = errors.New("skill version not available")
+)
+
+// Limits of a skill package besides its size
+const (
+	maxPackageFiles = 1000
+	downloadTimeout = time.Minute
+)
+
+// skillName matches the names a skill may be installed under
+var skillName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Installer installs skill packages into a skills directory
+type Installer struct {
+	dir              string
+	maxSize          int64
+	keys             []ed25519.PublicKey
+	requireSignature bool
+	keepVersions     int
+	client           *http.Client
+	now              func() time.Time
+
+	mu sync.Mutex // serializes changes to the installed versions
+}
+
+// NewInstaller creates an installer for the skills directory dir
+func NewInstaller(dir string, config configpkg.SkillsConfig) (*Installer, error) {
+	installer := &Installer{
+		dir:              dir,
+		maxSize:          int64(config.MaxPackageSize) << 20,
+		requireSignature: config.RequireSignature,
+		keepVersions:     config.KeepVersions,
+		client:           &http.Client{Timeout: downloadTimeout},
+		now:              time.Now,
+	}
+	for _, key := range config.TrustedKeys {
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid trusted skill key %q", key)
+		}
+		installer.keys = append(installer.keys, ed25519.PublicKey(raw))
+	}
+	return installer, nil
+}
+
+// Dir returns the skills directory
+func (i *Installer) Dir() string {
+	return i.dir
+}
+
+// MaxSize returns the maximum size of a package in bytes
+func (i *Installer) MaxSize() int64 {
+	return i.maxSize
+}
+
+// Download fetches a skill package over HTTP(S)
+func (i *Installer) Download(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("%w: package URL must be an http(s) URL", ErrInvalidPackage)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download skill package: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download skill package: HTTP %d", resp.StatusCode)
+	}
+
+	return i.ReadPackage(resp.Body)
+}
+
+// ReadPackage reads a skill package, failing with ErrTooLarge above the size limit
+func (i *Installer) ReadPackage(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, i.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read skill package: %w", err)
+	}
+	if int64(len(data)) > i.maxSize {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrTooLarge, i.maxSize)
+	}
+	return data, nil
+}
+
+// Verify checks the SHA-256 checksum (hex) of a package and its base64
+// Ed25519 signature. The signature may be omitted unless signatures are
+// required; a given signature must be valid for one of the trusted keys.
+func (i *Installer) Verify(data []byte, checksum, signature string) (signed bool, err error) {
+	sum := sha256.Sum256(data)
+	if checksum == "" {
+		return false, fmt.Errorf("%w: sha256 checksum is required", ErrChecksumMismatch)
+	}
+	if !strings.EqualFold(strings.TrimPrefix(checksum, "sha256:"), hex.EncodeToString(sum[:])) {
+		return false, fmt.Errorf("%w: got sha256 %s", ErrChecksumMismatch, hex.EncodeToString(sum[:]))
+	}
+
+	if signature == "" {
+		if i.requireSignature {
+			return false, fmt.Errorf("%w: a signature is required", ErrBadSignature)
+		}
+		return false, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false, fmt.Errorf("%w: signature is not base64", ErrBadSignature)
+	}
+	for _, key := range i.keys {
+		if ed25519.Verify(key, data, raw) {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("%w: not signed by a trusted key", ErrBadSignature)
+}
+
+// Install unpacks a verified package into the skills directory, parses it
+// and makes it the active version of its skill. The package must contain
+// SKILL.md (or skill.md) at its root or in a single top-level directory. The
+// version is taken from the skill metadata or, without one, the install time;
+// installing a version that is already there fails with ErrExists.
+func (i *Installer) Install(data []byte, checksum string) (*Skill, error) {
+	if err := os.MkdirAll(i.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create skills directory: %w", err)
+	}
+	// Unpack next to the skills directory, so agents scanning it never see
+	// half-extracted packages, and on the same file system for the rename
+	tmp, err := os.MkdirTemp(filepath.Dir(filepath.Clean(i.dir)), ".skill-install-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	staged := filepath.Join(tmp, "package")
+	if err := os.Mkdir(staged, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if err := i.extract(data, staged); err != nil {
+		return nil, err
+	}
+	root, err := packageRoot(staged)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := goskills.ParseSkillPackage(root)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	name := parsed.Meta.Name
+	if !skillName.MatchString(name) {
+		return nil, fmt.Errorf("%w: skill name %q must be letters, digits, '.', '_' or '-'", ErrInvalidPackage, name)
+	}
+	version := parsed.Meta.Version
+	if !skillName.MatchString(version) {
+		version = i.now().UTC().Format("20060102T150405Z")
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.addVersion(name, version, root, checksum, tmp)
+}
+
+// Remove deletes an installed skill and all its versions from the skills directory
+func (i *Installer) Remove(name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !skillName.MatchString(name) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	target := filepath.Join(i.dir, name)
+	if info, err := os.Stat(target); err != nil || !info.IsDir() {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err := os.RemoveAll(target); err != nil {
+		return fmt.Errorf("failed to remove skill %s: %w", name, err)
+	}
+	return nil
+}
+
+// extract unpacks a zip archive into dir. Entries escaping dir, links and
+// special files are rejected, and the unpacked size is limited like the package.
+func (i *Installer) extract(data []byte, dir string) error {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("%w: not a zip archive: %v", ErrInvalidPackage, err)
+	}
+	if len(archive.File) > maxPackageFiles {
+		return fmt.Errorf("%w: more than %d files", ErrTooLarge, maxPackageFiles)
+	}
+
+	remaining := i.maxSize
+	for _, file := range archive.File {
+		name := path.Clean(strings.ReplaceAll(file.Name, `\`, "/"))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") || strings.Contains(name, ":") {
+			return fmt.Errorf("%w: entry %q escapes the package", ErrInvalidPackage, file.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			return fmt.Errorf("%w: entry %q escapes the package", ErrInvalidPackage, file.Name)
+		}
+
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("failed to unpack skill package: %w", err)
+			}
+			continue
+		case !mode.IsRegular():
+			return fmt.Errorf("%w: entry %q is not a regular file", ErrInvalidPackage, file.Name)
+		}
+
+		written, err := extractFile(file, target, remaining)
+		if err != nil {
+			return err
+		}
+		remaining -= written
+	}
+	return nil
+}
+
+// extractFile writes a zip entry to target, failing when it is larger than limit
+func extractFile(file *zip.File, target string, limit int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, fmt.Errorf("failed to unpack skill package: %w", err)
+	}
+	src, err := file.Open()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	defer src.Close()
+
+	// Scripts keep their executable bit; nothing else is taken from the archive
+	perm := os.FileMode(0644)
+	if file.Mode().Perm()&0111 != 0 {
+		perm = 0755
+	}
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unpack skill package: %w", err)
+	}
+	written, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	if written > limit {
+		return 0, fmt.Errorf("%w: unpacked size exceeds the limit", ErrTooLarge)
+	}
+	return written, nil
+}
+
+// packageRoot returns the directory of an unpacked package holding the skill file
+func packageRoot(dir string) (string, error) {
+	if hasSkillFile(dir) {
+		return dir, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read unpacked package: %w", err)
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		if root := filepath.Join(dir, entries[0].Name()); hasSkillFile(root) {
+			return root, nil
+		}
+	}
+	return "", fmt.Errorf("%w: SKILL.md not found at the package root", ErrInvalidPackage)
+}
+
+// hasSkillFile reports whether dir contains SKILL.md or skill.md
+func hasSkillFile(dir string) bool {
+	for _, name := range []string{"SKILL.md", "skill.md"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Mode().IsRegular() {
+			return true
+		}
+	}
+	return false
+}
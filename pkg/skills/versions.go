@@ -0,0 +1,349 @@
+package skills
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/smallnest/goskills"
+)
+
+// Layout of an installed skill: the unpacked versions live in
+// <skills>/<name>/versions/<version> and the manifest records their order and
+// which one is active. Skills copied into the skills directory by hand have
+// no manifest and a single version.
+const (
+	manifestFile = "versions.json"
+	versionsDir  = "versions"
+)
+
+// Skill is a skill package in the version agents use
+type Skill struct {
+	Package *goskills.SkillPackage
+	Version string // empty for skills without a version in their metadata
+}
+
+// VersionInfo describes an installed version of a skill
+type VersionInfo struct {
+	Version     string    `json:"version"`
+	InstalledAt time.Time `json:"installed_at"`
+	SHA256      string    `json:"sha256,omitempty"`
+}
+
+// manifest records the installed versions of a skill, oldest first
+type manifest struct {
+	Active   string        `json:"active"`
+	Versions []VersionInfo `json:"versions"`
+}
+
+// index returns the position of a version in the manifest, or -1
+func (m *manifest) index(version string) int {
+	return slices.IndexFunc(m.Versions, func(v VersionInfo) bool { return v.Version == version })
+}
+
+// BrokenSkill is a skill package of the skills directory that could not be loaded
+type BrokenSkill struct {
+	Name  string `json:"name"`  // directory of the skill in the skills directory
+	Path  string `json:"path"`  // file or directory that is wrong
+	Error string `json:"error"` // why it could not be loaded
+}
+
+// Load parses the skills of a skills directory in their active versions. A
+// package that does not parse is skipped and reported as broken, so one bad
+// skill never keeps the others from loading. The error is only set when the
+// directory itself cannot be read.
+func Load(dir string) ([]*Skill, []BrokenSkill, error) {
+	var loaded []*Skill
+	var broken []BrokenSkill
+	fail := func(name, path string, err error) {
+		log.Printf("Warning: Skipping skill %s: %s: %v", name, path, err)
+		broken = append(broken, BrokenSkill{Name: name, Path: path, Error: err.Error()})
+	}
+	addPackage := func(name, root string) {
+		pkg, err := goskills.ParseSkillPackage(root)
+		if err != nil {
+			fail(name, skillFile(root), err)
+			return
+		}
+		loaded = append(loaded, &Skill{Package: pkg, Version: pkg.Meta.Version})
+	}
+	// addPackages adds every package below root, like goskills.ParseSkillPackages
+	// but recording the packages that do not parse instead of dropping them
+	addPackages := func(name, root string) {
+		var dirs []string
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				fail(name, path, err)
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if !d.IsDir() && (d.Name() == "SKILL.md" || d.Name() == "skill.md") && !slices.Contains(dirs, filepath.Dir(path)) {
+				dirs = append(dirs, filepath.Dir(path))
+			}
+			return nil
+		})
+		if err != nil {
+			fail(name, root, err)
+		}
+		for _, dir := range dirs {
+			addPackage(name, dir)
+		}
+	}
+
+	if hasSkillFile(dir) {
+		addPackage(filepath.Base(dir), dir)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read skills directory %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		root := filepath.Join(dir, entry.Name())
+		m, err := readManifest(root)
+		if err != nil {
+			fail(entry.Name(), filepath.Join(root, manifestFile), err)
+			continue
+		}
+		if m == nil {
+			addPackages(entry.Name(), root)
+			continue
+		}
+		active := filepath.Join(root, versionsDir, m.Active)
+		pkg, err := goskills.ParseSkillPackage(active)
+		if err != nil {
+			fail(entry.Name(), skillFile(active), fmt.Errorf("active version %s does not parse: %w", m.Active, err))
+			continue
+		}
+		loaded = append(loaded, &Skill{Package: pkg, Version: m.Active})
+	}
+	return loaded, broken, nil
+}
+
+// skillFile returns the SKILL.md or skill.md of a skill package, or the
+// package directory if it has neither
+func skillFile(dir string) string {
+	for _, name := range []string{"SKILL.md", "skill.md"} {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return dir
+}
+
+// Versions returns the installed versions of a skill, oldest first, and the active one
+func (i *Installer) Versions(name string) ([]VersionInfo, string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !skillName.MatchString(name) {
+		return nil, "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	m, err := readManifest(filepath.Join(i.dir, name))
+	if err != nil {
+		return nil, "", err
+	}
+	if m == nil {
+		return nil, "", fmt.Errorf("%w: %s has no installed versions", ErrNotFound, name)
+	}
+	return m.Versions, m.Active, nil
+}
+
+// Rollback makes another installed version of a skill active: the given one
+// or, if version is empty, the one installed before the active version. It
+// returns the skill in that version and the previously active version.
+func (i *Installer) Rollback(name, version string) (*Skill, string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !skillName.MatchString(name) {
+		return nil, "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	target := filepath.Join(i.dir, name)
+	m, err := readManifest(target)
+	if err != nil {
+		return nil, "", err
+	}
+	if m == nil {
+		if _, err := os.Stat(target); err == nil {
+			return nil, "", fmt.Errorf("%w: %s was not installed through the API and has no previous versions", ErrNoVersion, name)
+		}
+		return nil, "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	if version == "" {
+		active := m.index(m.Active)
+		if active <= 0 {
+			return nil, "", fmt.Errorf("%w: %s has no version before %s", ErrNoVersion, name, m.Active)
+		}
+		version = m.Versions[active-1].Version
+	} else if m.index(version) < 0 {
+		return nil, "", fmt.Errorf("%w: %s %s", ErrNoVersion, name, version)
+	}
+
+	pkg, err := goskills.ParseSkillPackage(filepath.Join(target, versionsDir, version))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s %s: %v", ErrInvalidPackage, name, version, err)
+	}
+	previous := m.Active
+	m.Active = version
+	if err := writeManifest(target, m); err != nil {
+		return nil, "", err
+	}
+	return &Skill{Package: pkg, Version: version}, previous, nil
+}
+
+// addVersion moves the unpacked package root into the versions of a skill,
+// makes it active and prunes the oldest versions. A skill copied into the
+// skills directory by hand becomes the first version. tmp is a staging
+// directory on the file system of the skills directory. The caller must hold i.mu.
+func (i *Installer) addVersion(name, version, root, checksum, tmp string) (*Skill, error) {
+	target := filepath.Join(i.dir, name)
+	m, err := readManifest(target)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		if m, err = i.adoptSkill(name, tmp); err != nil {
+			return nil, err
+		}
+	}
+	if m.index(version) >= 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrExists, name, version)
+	}
+
+	versionDir := filepath.Join(target, versionsDir, version)
+	if err := os.MkdirAll(filepath.Dir(versionDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to install skill %s: %w", name, err)
+	}
+	if err := os.Rename(root, versionDir); err != nil {
+		return nil, fmt.Errorf("failed to install skill %s: %w", name, err)
+	}
+	installed, err := goskills.ParseSkillPackage(versionDir)
+	if err != nil {
+		os.RemoveAll(versionDir)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+
+	m.Versions = append(m.Versions, VersionInfo{Version: version, InstalledAt: i.now().UTC(), SHA256: checksum})
+	m.Active = version
+	pruned := i.prune(m)
+	if err := writeManifest(target, m); err != nil {
+		os.RemoveAll(versionDir)
+		return nil, err
+	}
+	for _, old := range pruned {
+		if err := os.RemoveAll(filepath.Join(target, versionsDir, old)); err != nil {
+			log.Printf("Warning: Failed to remove version %s of skill %s: %v", old, name, err)
+		}
+	}
+	return &Skill{Package: installed, Version: version}, nil
+}
+
+// adoptSkill returns the manifest of a skill without one. A skill copied
+// into the skills directory by hand is moved to its first version, keeping
+// it available for rollback. The caller must hold i.mu.
+func (i *Installer) adoptSkill(name, tmp string) (*manifest, error) {
+	target := filepath.Join(i.dir, name)
+	info, err := os.Stat(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &manifest{}, nil
+	}
+	if err != nil || !info.IsDir() || !hasSkillFile(target) {
+		return nil, fmt.Errorf("%w: %s exists in the skills directory but is not a skill package", ErrExists, name)
+	}
+
+	version := "initial"
+	if pkg, err := goskills.ParseSkillPackage(target); err == nil && skillName.MatchString(pkg.Meta.Version) {
+		version = pkg.Meta.Version
+	}
+	moved := filepath.Join(tmp, "adopted")
+	if err := os.Rename(target, moved); err != nil {
+		return nil, fmt.Errorf("failed to move skill %s: %w", name, err)
+	}
+	if err := os.MkdirAll(filepath.Join(target, versionsDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to move skill %s: %w", name, err)
+	}
+	if err := os.Rename(moved, filepath.Join(target, versionsDir, version)); err != nil {
+		return nil, fmt.Errorf("failed to move skill %s: %w", name, err)
+	}
+
+	m := &manifest{Active: version, Versions: []VersionInfo{{Version: version, InstalledAt: info.ModTime().UTC()}}}
+	if err := writeManifest(target, m); err != nil {
+		return nil, err
+	}
+	log.Printf("Skill %s moved to version %s for rollback", name, version)
+	return m, nil
+}
+
+// prune drops the oldest versions beyond the active one and keepVersions
+// others from the manifest and returns them
+func (i *Installer) prune(m *manifest) []string {
+	var pruned []string
+	for len(m.Versions) > i.keepVersions+1 {
+		oldest := 0
+		if m.Versions[0].Version == m.Active {
+			oldest = 1
+		}
+		pruned = append(pruned, m.Versions[oldest].Version)
+		m.Versions = slices.Delete(m.Versions, oldest, oldest+1)
+	}
+	return pruned
+}
+
+// readManifest reads the manifest of a skill directory. It returns nil
+// without an error when the skill has none.
+func readManifest(dir string) (*manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read skill versions: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse skill versions %s: %w", filepath.Join(dir, manifestFile), err)
+	}
+	if m.index(m.Active) < 0 {
+		return nil, fmt.Errorf("skill versions %s: active version %q is not installed", filepath.Join(dir, manifestFile), m.Active)
+	}
+	return &m, nil
+}
+
+// writeManifest replaces the manifest of a skill directory atomically, so the
+// active version switches in one step
+func writeManifest(dir string, m *manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode skill versions: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".versions-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write skill versions: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write skill versions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write skill versions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, manifestFile)); err != nil {
+		return fmt.Errorf("failed to write skill versions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Package usage estimates token counts and the cost of LLM calls.
+package usage
+
+import (
+	"strings"
+	"unicode"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+// DefaultPricing is the built-in pricing table in USD per million tokens.
+// Entries from the usage.pricing config override or extend it.
+var DefaultPricing = map[string]configpkg.ModelPrice{
+	"gpt-4":             {Input: 30, Output: 60},
+	"gpt-4-turbo":       {Input: 10, Output: 30},
+	"gpt-4o":            {Input: 2.5, Output: 10},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+	"gpt-3.5-turbo":     {Input: 0.5, Output: 1.5},
+	"deepseek-chat":     {Input: 0.27, Output: 1.1},
+	"deepseek-v3":       {Input: 0.27, Output: 1.1},
+	"deepseek-reasoner": {Input: 0.55, Output: 2.19},
+}
+
+// Usage is the token usage and cost of a chat turn
+type Usage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`      // USD, 0 if the model has no known price
+	Estimated        bool    `json:"estimated"` // true when counted locally rather than reported by the provider
+	Model            string  `json:"model,omitempty"`
+	// CachedTokens are the prompt tokens the provider read from its prompt cache
+	CachedTokens int `json:"cached_tokens,omitempty"`
+}
+
+// Pricing looks up model prices
+type Pricing struct {
+	prices map[string]configpkg.ModelPrice
+}
+
+// NewPricing merges configured prices over DefaultPricing
+func NewPricing(overrides map[string]configpkg.ModelPrice) *Pricing {
+	prices := make(map[string]configpkg.ModelPrice, len(DefaultPricing)+len(overrides))
+	for model, price := range DefaultPricing {
+		prices[model] = price
+	}
+	for model, price := range overrides {
+		prices[strings.ToLower(model)] = price
+	}
+	return &Pricing{prices: prices}
+}
+
+// Lookup returns the price of a model. Dated or suffixed model names
+// (e.g. "gpt-4o-2024-08-06") match the longest known prefix.
+func (p *Pricing) Lookup(model string) (configpkg.ModelPrice, bool) {
+	model = strings.ToLower(model)
+	if price, ok := p.prices[model]; ok {
+		return price, true
+	}
+
+	var best string
+	for name := range p.prices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return configpkg.ModelPrice{}, false
+	}
+	return p.prices[best], true
+}
+
+// Cost returns the cost of a call in USD
+func (p *Pricing) Cost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := p.Lookup(model)
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1_000_000
+}
+
+// Counter approximates the number of tokens in streamed text without calling
+// the provider's tokenizer: about four ASCII characters per token, one token
+// per CJK character and two other characters per token.
+type Counter struct {
+	ascii int
+	cjk   int
+	other int
+}
+
+// Add counts a chunk of text
+func (c *Counter) Add(text string) {
+	for _, r := range text {
+		switch {
+		case r <= unicode.MaxASCII:
+			c.ascii++
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			c.cjk++
+		default:
+			c.other++
+		}
+	}
+}
+
+// Tokens returns the estimated token count so far
+func (c *Counter) Tokens() int {
+	return (c.ascii+3)/4 + c.cjk + (c.other+1)/2
+}
+
+// EstimateTokens approximates the number of tokens in text
+func EstimateTokens(text string) int {
+	var c Counter
+	c.Add(text)
+	return c.Tokens()
+}
@@ -0,0 +1,114 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Build metadata injected at build time, e.g.
+//
+//	go build -ldflags "-X github.com/smallnest/langchat/pkg/version.Version=v1.2.0 \
+//	  -X github.com/smallnest/langchat/pkg/version.Commit=abc123 \
+//	  -X github.com/smallnest/langchat/pkg/version.BuildTime=2025-01-01T00:00:00Z"
+//
+// When not set, Commit and BuildTime fall back to the VCS information embedded by the Go toolchain.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// startTime is used to report process uptime
+var startTime = time.Now()
+
+// trackedDependencies are the modules whose versions are reported for support
+var trackedDependencies = []string{
+	"github.com/tmc/langchaingo",
+	"github.com/smallnest/goskills",
+	"github.com/smallnest/langgraphgo",
+}
+
+// Info describes the running build
+type Info struct {
+	Version      string            `json:"version"`
+	Commit       string            `json:"commit,omitempty"`
+	BuildTime    string            `json:"build_time,omitempty"`
+	GoVersion    string            `json:"go_version"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	StartTime    time.Time         `json:"start_time"`
+	Uptime       string            `json:"uptime"`
+}
+
+// Get returns the build information of the running binary
+func Get() Info {
+	info := Info{
+		Version:      Version,
+		Commit:       Commit,
+		BuildTime:    BuildTime,
+		GoVersion:    runtime.Version(),
+		Dependencies: make(map[string]string),
+		StartTime:    startTime.UTC(),
+		Uptime:       time.Since(startTime).Round(time.Second).String(),
+	}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	if info.Version == "dev" && buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+		info.Version = buildInfo.Main.Version
+	}
+
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.BuildTime == "" {
+				info.BuildTime = setting.Value
+			}
+		case "vcs.modified":
+			if setting.Value == "true" && info.Commit != "" && !strings.HasSuffix(info.Commit, "-dirty") {
+				info.Commit += "-dirty"
+			}
+		}
+	}
+
+	for _, dep := range buildInfo.Deps {
+		for _, tracked := range trackedDependencies {
+			if dep.Path == tracked {
+				version := dep.Version
+				if dep.Replace != nil {
+					version = dep.Replace.Version + " (replaced by " + dep.Replace.Path + ")"
+				}
+				info.Dependencies[dep.Path] = version
+			}
+		}
+	}
+
+	return info
+}
+
+// String returns a human readable, multi-line description of the build
+func (i Info) String() string {
+	var b strings.Builder
+	b.WriteString("langchat " + i.Version + "\n")
+	if i.Commit != "" {
+		b.WriteString("  commit:     " + i.Commit + "\n")
+	}
+	if i.BuildTime != "" {
+		b.WriteString("  built:      " + i.BuildTime + "\n")
+	}
+	b.WriteString("  go:         " + i.GoVersion + "\n")
+	for _, dep := range trackedDependencies {
+		if v, ok := i.Dependencies[dep]; ok {
+			b.WriteString("  " + dep + " " + v + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,240 @@
+// Package workspace stores workspaces, which host several teams on one
+// server. The members of a workspace have their own sessions, preferences,
+// memories, budgets and quotas, and see the global config with the overrides
+// of their workspace applied.
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	configpkg "github.com/smallnest/langchat/pkg/config"
+)
+
+var (
+	// ErrNotFound is returned for an unknown workspace ID
+	ErrNotFound = errors.New("workspace not found")
+	// ErrExists is returned when creating a workspace with an ID in use
+	ErrExists = errors.New("workspace already exists")
+	// ErrInvalidID is returned for an ID that is not a valid workspace ID
+	ErrInvalidID = errors.New("workspace ID must be 1 to 32 lowercase letters, digits or dashes")
+)
+
+// validID matches workspace IDs; they are part of user keys and directory names
+var validID = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+// keySeparator separates the workspace from the user ID in a user key. Dots
+// are not used by user IDs, which are URL-safe base64.
+const keySeparator = "."
+
+// Workspace is a team hosted on the server
+type Workspace struct {
+	ID        string                       `json:"id"`
+	Name      string                       `json:"name"`
+	Overrides configpkg.WorkspaceOverrides `json:"overrides"`
+	CreatedAt time.Time                    `json:"created_at"`
+	UpdatedAt time.Time                    `json:"updated_at"`
+}
+
+// Store keeps the workspaces in memory and persists them on every change
+type Store struct {
+	mu         sync.RWMutex
+	path       string
+	workspaces map[string]*Workspace
+	now        func() time.Time
+}
+
+// New creates a store and loads the persisted workspaces. It returns nil
+// when workspaces are disabled; a nil store has no workspaces.
+func New(config configpkg.WorkspacesConfig) (*Store, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	s := &Store{
+		path:       config.StatePath,
+		workspaces: make(map[string]*Workspace),
+		now:        time.Now,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ValidID reports whether id is a valid workspace ID
+func ValidID(id string) bool {
+	return validID.MatchString(id)
+}
+
+// UserKey returns the key the per-user state of a user is stored under: the
+// user ID, prefixed with the workspace for members of one
+func UserKey(workspace, userID string) string {
+	if workspace == "" {
+		return userID
+	}
+	return workspace + keySeparator + userID
+}
+
+// SplitUserKey returns the workspace and the user ID of a user key
+func SplitUserKey(key string) (workspace, userID string) {
+	if workspace, userID, ok := strings.Cut(key, keySeparator); ok {
+		return workspace, userID
+	}
+	return "", key
+}
+
+// Get returns a copy of a workspace
+func (s *Store) Get(id string) (Workspace, bool) {
+	if s == nil {
+		return Workspace{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return Workspace{}, false
+	}
+	return *ws, true
+}
+
+// List returns all workspaces sorted by ID
+func (s *Store) List() []Workspace {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Workspace, 0, len(s.workspaces))
+	for _, ws := range s.workspaces {
+		list = append(list, *ws)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Create adds a workspace
+func (s *Store) Create(id, name string, overrides configpkg.WorkspaceOverrides) (Workspace, error) {
+	if !ValidID(id) {
+		return Workspace{}, ErrInvalidID
+	}
+	if err := configpkg.ValidateWorkspaceOverrides(overrides); err != nil {
+		return Workspace{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.workspaces[id]; exists {
+		return Workspace{}, ErrExists
+	}
+	now := s.now()
+	ws := &Workspace{ID: id, Name: name, Overrides: overrides, CreatedAt: now, UpdatedAt: now}
+	s.workspaces[id] = ws
+	if err := s.save(); err != nil {
+		delete(s.workspaces, id)
+		return Workspace{}, err
+	}
+	return *ws, nil
+}
+
+// Update changes the name or replaces the overrides of a workspace; nil
+// arguments are left unchanged
+func (s *Store) Update(id string, name *string, overrides *configpkg.WorkspaceOverrides) (Workspace, error) {
+	if overrides != nil {
+		if err := configpkg.ValidateWorkspaceOverrides(*overrides); err != nil {
+			return Workspace{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return Workspace{}, ErrNotFound
+	}
+	previous := *ws
+	if name != nil {
+		ws.Name = *name
+	}
+	if overrides != nil {
+		ws.Overrides = *overrides
+	}
+	ws.UpdatedAt = s.now()
+	if err := s.save(); err != nil {
+		*ws = previous
+		return Workspace{}, err
+	}
+	return *ws, nil
+}
+
+// Delete removes a workspace. The state of its members is kept under their
+// user keys.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.workspaces, id)
+	if err := s.save(); err != nil {
+		s.workspaces[id] = ws
+		return err
+	}
+	return nil
+}
+
+// load reads the state file, if any
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read workspaces: %w", err)
+	}
+	var list []*Workspace
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to unmarshal workspaces: %w", err)
+	}
+	for _, ws := range list {
+		s.workspaces[ws.ID] = ws
+	}
+	return nil
+}
+
+// save writes the state file atomically. The caller must hold s.mu.
+func (s *Store) save() error {
+	list := make([]*Workspace, 0, len(s.workspaces))
+	for _, ws := range s.workspaces {
+		list = append(list, ws)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal workspaces: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create workspaces directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write workspaces: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write workspaces: %w", err)
+	}
+	return nil
+}